@@ -0,0 +1,215 @@
+package cron
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+var (
+	runIDMatcher = regexp.MustCompile(`^[0-9A-Za-z_-]+$`)
+
+	ErrBadRunID = errors.New("CRONIC: Bad run ID")
+)
+
+// Compression algorithms for archived output
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+)
+
+// Archive stores the combined output of each job run in a file named after
+// the run's ID in Dir.
+type Archive struct {
+	Dir string
+
+	// How to compress the output of runs that emitted at least
+	// CompressMinSize bytes (CompressionNone or empty to never compress)
+	Compression     string
+	CompressMinSize int64
+}
+
+// ParseCompression checks that compression is a supported algorithm.
+func ParseCompression(compression string) (string, error) {
+	switch compression {
+	case CompressionNone, CompressionGzip:
+		return compression, nil
+	default:
+		return "", fmt.Errorf("CRONIC: Bad compression: %q (expected %s or %s)", compression, CompressionNone, CompressionGzip)
+	}
+}
+
+func NewArchive(dir string) (*Archive, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Archive{Dir: dir}, nil
+}
+
+func newRunID(position int, iteration uint64, startedAt time.Time) string {
+	return fmt.Sprintf("%s-%d-%d", startedAt.UTC().Format("20060102T150405Z"), position, iteration)
+}
+
+func (a *Archive) path(runID string) (string, error) {
+	if !runIDMatcher.MatchString(runID) {
+		return "", ErrBadRunID
+	}
+	return filepath.Join(a.Dir, runID+".log"), nil
+}
+
+// Open returns the stored output for a run (decompressed, if it was
+// compressed).
+func (a *Archive) Open(runID string) (io.ReadCloser, error) {
+	path, err := a.path(runID)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if !os.IsNotExist(err) {
+		return file, err
+	}
+
+	compressed, err := os.Open(path + ".gz")
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := gzip.NewReader(compressed)
+	if err != nil {
+		compressed.Close()
+		return nil, err
+	}
+
+	return &gzipFile{Reader: reader, file: compressed}, nil
+}
+
+// file returns the path of the file holding the stored output for a run
+// (which ends with .gz if it was compressed).
+func (a *Archive) file(runID string) (string, error) {
+	path, err := a.path(runID)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		return path, err
+	}
+
+	if _, err := os.Stat(path + ".gz"); err != nil {
+		return "", err
+	}
+	return path + ".gz", nil
+}
+
+// gzipFile decompresses a file, and closes it once done.
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (f *gzipFile) Close() error {
+	f.Reader.Close()
+	return f.file.Close()
+}
+
+// compress replaces the file at path with a compressed copy (at path.gz),
+// if it's large enough.
+func (a *Archive) compress(path string, size int64) error {
+	if a.Compression != CompressionGzip || size < a.CompressMinSize {
+		return nil
+	}
+
+	input, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	// Readers never see a partial file: the output is still available
+	// uncompressed until the compressed copy is complete.
+	tmp, err := os.OpenFile(path+".gz.tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := gzip.NewWriter(tmp)
+	if _, err := io.Copy(writer, input); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := writer.Close(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), path+".gz"); err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+func (a *Archive) create(runID string) (*archiveWriter, error) {
+	path, err := a.path(runID)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &archiveWriter{archive: a, path: path, file: file}, nil
+}
+
+// archiveWriter serializes writes from the stdout and stderr drains.
+type archiveWriter struct {
+	archive *Archive
+	path    string
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+	err  error
+}
+
+func (w *archiveWriter) writeLine(line string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err == nil {
+		var n int
+		n, w.err = fmt.Fprintln(w.file, line)
+		w.size += int64(n)
+	}
+}
+
+// Close compresses the output if needed, and returns the first error
+// encountered while writing, if any.
+func (w *archiveWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.file.Close(); w.err == nil {
+		w.err = err
+	}
+
+	if w.err == nil {
+		w.err = w.archive.compress(w.path, w.size)
+	}
+	return w.err
+}
@@ -0,0 +1,110 @@
+package cron
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunJobArchivesOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cronic-archive")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	archive, err := NewArchive(dir)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	logger, _ := newTestLogger()
+	status := newTestStatus("echo hello; sleep 0.1; echo world >&2")
+	runID := status.startRun(0)
+
+	assert.Nil(t, runJob(context.Background(), &basicContext, &Options{Archive: archive}, status, logger))
+	status.finishRun(nil, nil, "")
+	assert.Equal(t, runID, status.Snapshot().LastResult.RunID)
+
+	output, err := archive.Open(runID)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer output.Close()
+
+	data, err := ioutil.ReadAll(output)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello\nworld\n", string(data))
+}
+
+func TestRunJobCompressesLargeOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cronic-archive")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	archive, err := NewArchive(dir)
+	if !assert.Nil(t, err) {
+		return
+	}
+	archive.Compression = CompressionGzip
+	archive.CompressMinSize = 10
+
+	logger, _ := newTestLogger()
+
+	for i, tt := range []struct {
+		command    string
+		output     string
+		compressed bool
+	}{
+		{"echo small", "small\n", false},
+		{"echo much larger; echo output", "much larger\noutput\n", true},
+	} {
+		status := newTestStatus(tt.command)
+		runID := status.startRun(uint64(i))
+
+		assert.Nil(t, runJob(context.Background(), &basicContext, &Options{Archive: archive}, status, logger))
+
+		_, err := os.Stat(filepath.Join(dir, runID+".log.gz"))
+		assert.Equal(t, tt.compressed, err == nil, tt.command)
+
+		_, err = os.Stat(filepath.Join(dir, runID+".log"))
+		assert.Equal(t, !tt.compressed, err == nil, tt.command)
+
+		output, err := archive.Open(runID)
+		if !assert.Nil(t, err) {
+			return
+		}
+
+		data, err := ioutil.ReadAll(output)
+		output.Close()
+		assert.Nil(t, err)
+		assert.Equal(t, tt.output, string(data), tt.command)
+	}
+
+	// No temporary files are left behind
+	entries, err := ioutil.ReadDir(dir)
+	if assert.Nil(t, err) {
+		assert.Equal(t, 2, len(entries))
+	}
+}
+
+func TestArchiveRejectsBadRunIDs(t *testing.T) {
+	archive := &Archive{Dir: "/nonexistent"}
+
+	for _, runID := range []string{"", "../etc/passwd", "foo/bar", "foo.log"} {
+		_, err := archive.Open(runID)
+		assert.Equal(t, ErrBadRunID, err, runID)
+	}
+}
+
+func TestNewRunID(t *testing.T) {
+	startedAt := time.Date(2018, 4, 7, 19, 40, 44, 0, time.UTC)
+	assert.Equal(t, "20180407T194044Z-3-12", newRunID(3, 12, startedAt))
+}
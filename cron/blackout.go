@@ -0,0 +1,48 @@
+package cron
+
+import (
+	"sync"
+	"time"
+
+	"github.com/samgaw/cronic/crontab"
+)
+
+// GlobalBlackout is the blackout of all jobs (in addition to their own, see
+// crontab.Job.Blackout), which can be changed while cronic runs, e.g. with
+// the API of the dashboard for a deploy freeze.
+type GlobalBlackout struct {
+	mu       sync.Mutex
+	blackout crontab.Blackout
+}
+
+func NewGlobalBlackout(blackout crontab.Blackout) *GlobalBlackout {
+	return &GlobalBlackout{blackout: blackout}
+}
+
+// Get returns the blackout (nil if b is nil, or if there's none).
+func (b *GlobalBlackout) Get() crontab.Blackout {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.blackout
+}
+
+// Set replaces the blackout, for runs that are due from now on.
+func (b *GlobalBlackout) Set(blackout crontab.Blackout) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.blackout = blackout
+}
+
+// blackoutEnd reports whether a run of job at tick falls in its blackout, or
+// the global one, and if so when that blackout ends.
+func blackoutEnd(opts *Options, job *crontab.Job, tick time.Time) (time.Time, bool) {
+	end, ok := job.Blackout.Contains(tick)
+	if globalEnd, globalOk := opts.Blackout.Get().Contains(tick); globalOk && globalEnd.After(end) {
+		end, ok = globalEnd, true
+	}
+	return end, ok
+}
@@ -0,0 +1,79 @@
+package cron
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+var (
+	// How often the clock watcher compares the wall clock to the monotonic
+	// clock, and by how much they must differ for it to reschedule jobs
+	CLOCK_CHECK_INTERVAL = time.Second
+	CLOCK_JUMP_THRESHOLD = 5 * time.Second
+)
+
+// ClockWatcher detects jumps of the wall clock (e.g. when NTP steps it, or
+// when the host resumes from suspend), after which jobs must be rescheduled:
+// the scheduler waits using timers, which follow the monotonic clock, so they
+// would otherwise fire at the wrong wall clock time (or late, since the
+// monotonic clock stops while the host is suspended).
+type ClockWatcher struct {
+	mu sync.Mutex
+
+	// Closed (and replaced) when the clock jumps
+	jumped chan struct{}
+}
+
+// StartClockWatcher watches the clock until ctx is done.
+func StartClockWatcher(ctx context.Context, logger *Logger) *ClockWatcher {
+	c := &ClockWatcher{jumped: make(chan struct{})}
+
+	go func() {
+		ticker := time.NewTicker(CLOCK_CHECK_INTERVAL)
+		defer ticker.Stop()
+
+		last := time.Now()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			now := time.Now()
+
+			// Round(0) strips the monotonic clock reading
+			jump := now.Round(0).Sub(last.Round(0)) - now.Sub(last)
+			last = now
+
+			if jump > CLOCK_JUMP_THRESHOLD || jump < -CLOCK_JUMP_THRESHOLD {
+				logger.WithField("jump", jump).Warnf("CRONIC: Clock jumped by %v, rescheduling jobs", jump)
+				c.notifyJump()
+			}
+		}
+	}()
+
+	return c
+}
+
+// Jumped returns a channel that's closed the next time the clock jumps (or
+// nil, which blocks forever, if c is nil).
+func (c *ClockWatcher) Jumped() <-chan struct{} {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.jumped
+}
+
+func (c *ClockWatcher) notifyJump() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	close(c.jumped)
+	c.jumped = make(chan struct{})
+}
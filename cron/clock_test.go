@@ -0,0 +1,101 @@
+package cron
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/samgaw/cronic/crontab"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClockWatcherNotifiesJumps(t *testing.T) {
+	var none *ClockWatcher
+	assert.Nil(t, none.Jumped())
+
+	clock := &ClockWatcher{jumped: make(chan struct{})}
+	jumped := clock.Jumped()
+
+	select {
+	case <-jumped:
+		t.Fatalf("notified before the clock jumped")
+	default:
+	}
+
+	clock.notifyJump()
+
+	select {
+	case <-jumped:
+	default:
+		t.Fatalf("not notified after the clock jumped")
+	}
+
+	select {
+	case <-clock.Jumped():
+		t.Fatalf("notified before the clock jumped again")
+	default:
+	}
+}
+
+// jumpingExpression runs a job an hour from now, except for its next run
+// after jump is set, which is earlier by jump (as if the clock had jumped
+// forward by it).
+type jumpingExpression struct {
+	mu   sync.Mutex
+	jump time.Duration
+}
+
+func (expr *jumpingExpression) Next(t time.Time) time.Time {
+	expr.mu.Lock()
+	defer expr.mu.Unlock()
+
+	next := t.Add(time.Hour - expr.jump)
+	expr.jump = 0
+	return next
+}
+
+func TestStartJobReschedulesWhenClockJumps(t *testing.T) {
+	expr := &jumpingExpression{}
+	job := crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: expr,
+			Schedule:   "hourly!",
+			Command:    "true",
+		},
+	}
+
+	clock := &ClockWatcher{jumped: make(chan struct{})}
+	opts := basicOptions
+	opts.Clock = clock
+
+	ctx, stop := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+
+	logger, channel := newTestLogger()
+	status := NewJobStatus(&job)
+
+	StartJob(ctx, &wg, &basicContext, &opts, status, logger)
+
+	expectMessages(t, channel, "Job will run next")
+
+	// The clock jumping doesn't change the schedule by itself
+	clock.notifyJump()
+	expectMessages(t, channel, "Clock jumped, rescheduling the job", "Job will run next")
+
+	// But runs it jumped past are skipped
+	expr.mu.Lock()
+	expr.jump = 2 * time.Hour
+	expr.mu.Unlock()
+
+	clock.notifyJump()
+	expectMessages(t, channel, "Clock jumped, rescheduling the job", "Job will run next", "Clock jumped past the job's run, which should have started .* ago. Skipping it", "Job will run next")
+
+	if next := status.Snapshot().NextRun; assert.NotNil(t, next) {
+		assert.True(t, next.After(time.Now().Add(59*time.Minute)))
+	}
+
+	stop()
+	wg.Wait()
+}
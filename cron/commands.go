@@ -0,0 +1,138 @@
+package cron
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/samgaw/cronic/crontab"
+)
+
+// What to do at startup about jobs whose command doesn't exist (see
+// CheckCommand)
+const (
+	MissingCommandIgnore = "ignore"
+	MissingCommandWarn   = "warn"
+	MissingCommandFail   = "fail"
+)
+
+var (
+	missingCommandPolicies = []string{MissingCommandIgnore, MissingCommandWarn, MissingCommandFail}
+
+	// e.g. "FOO=bar" in "FOO=bar command"
+	assignmentMatcher = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+
+	// Programs that are part of the shell, which can't be found in PATH
+	shellBuiltins = map[string]bool{
+		"!": true, ".": true, ":": true, "[": true, "alias": true, "break": true,
+		"case": true, "cd": true, "command": true, "continue": true,
+		"echo": true, "eval": true, "exec": true, "exit": true, "export": true,
+		"false": true, "for": true, "if": true, "printf": true, "pwd": true,
+		"read": true, "readonly": true, "return": true, "set": true,
+		"shift": true, "source": true, "test": true, "times": true,
+		"trap": true, "true": true, "ulimit": true, "umask": true,
+		"unset": true, "until": true, "wait": true, "while": true,
+	}
+)
+
+// ParseMissingCommandPolicy checks that policy is one of
+// MissingCommandIgnore, MissingCommandWarn or MissingCommandFail.
+func ParseMissingCommandPolicy(policy string) (string, error) {
+	for _, known := range missingCommandPolicies {
+		if policy == known {
+			return policy, nil
+		}
+	}
+	return "", fmt.Errorf("unknown missing command policy %q (expected one of %s)", policy, strings.Join(missingCommandPolicies, ", "))
+}
+
+// commandProgram returns the program a command starts (its first word,
+// after any variable assignments), or "" if it can't tell without running a
+// shell (e.g. if the command starts with a subshell, or a variable).
+func commandProgram(command string) string {
+	for _, word := range strings.Fields(command) {
+		if assignmentMatcher.MatchString(word) {
+			continue
+		}
+
+		if len(word) > 1 && (word[0] == '"' || word[0] == '\'') && word[len(word)-1] == word[0] {
+			word = word[1 : len(word)-1]
+		}
+
+		if shellBuiltins[word] || strings.ContainsAny(word, "$`(){}<>|&;*?[]~\\\"'") {
+			return ""
+		}
+		return word
+	}
+	return ""
+}
+
+// environValue returns the value of key in env (as KEY=VALUE, where the
+// last value wins).
+func environValue(env []string, key string) (string, bool) {
+	for i := len(env) - 1; i >= 0; i-- {
+		if strings.HasPrefix(env[i], key+"=") {
+			return env[i][len(key)+1:], true
+		}
+	}
+	return "", false
+}
+
+// isExecutable reports whether path is a file that can be executed.
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir() && info.Mode()&0111 != 0
+}
+
+// CheckCommand checks that the program a job's command starts exists,
+// looking it up in the job's PATH like the shell would (or relative to the
+// job's directory if it contains a slash). Commands that start with shell
+// builtins or syntax (e.g. "cd /app && make"), and those of jobs with an
+// image or a remote host, aren't checked.
+func CheckCommand(cronCtx *crontab.Context, opts *Options, job *crontab.Job) error {
+	program := commandProgram(job.Command)
+	if program == "" || job.Image != "" || job.Host != "" {
+		return nil
+	}
+
+	dir := JobDir(cronCtx, job)
+
+	if strings.Contains(program, "/") {
+		path := program
+		if !filepath.IsAbs(path) && dir != "" {
+			path = filepath.Join(dir, path)
+		}
+
+		if !isExecutable(path) {
+			return fmt.Errorf("CRONIC: Command not found: %q", program)
+		}
+		return nil
+	}
+
+	namespace, err := opts.Namespace(job)
+	if err != nil {
+		return err
+	}
+
+	path, ok := environValue(jobEnviron(cronCtx, opts, namespace, job), "PATH")
+	if !ok {
+		return nil
+	}
+
+	for _, pathDir := range filepath.SplitList(path) {
+		if pathDir == "" {
+			pathDir = "."
+		}
+		if !filepath.IsAbs(pathDir) && dir != "" {
+			pathDir = filepath.Join(dir, pathDir)
+		}
+
+		if isExecutable(filepath.Join(pathDir, program)) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("CRONIC: Command not found in PATH (%s): %q", path, program)
+}
@@ -0,0 +1,66 @@
+package cron
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var commandProgramTestCases = []struct {
+	command  string
+	expected string
+}{
+	{"backup.sh --all", "backup.sh"},
+	{"  /usr/bin/backup", "/usr/bin/backup"},
+	{"FOO=bar BAZ= ./run.sh", "./run.sh"},
+	{`"backup.sh" --all`, "backup.sh"},
+	{"cd /app && make", ""},
+	{"$HOME/bin/backup", ""},
+	{"(cd /app; make)", ""},
+	{"echo hello", ""},
+	{"FOO=bar", ""},
+	{"", ""},
+}
+
+func TestCommandProgram(t *testing.T) {
+	for _, tt := range commandProgramTestCases {
+		assert.Equal(t, tt.expected, commandProgram(tt.command), tt.command)
+	}
+}
+
+func TestCheckCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cronic-commands")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	bin := filepath.Join(dir, "bin")
+	assert.Nil(t, os.Mkdir(bin, 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(bin, "backup"), []byte("#!/bin/sh\n"), 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(bin, "notes"), []byte("hello\n"), 0644))
+
+	testCases := []struct {
+		job *crontab.Job
+		ok  bool
+	}{
+		{&crontab.Job{CrontabLine: crontab.CrontabLine{Command: "backup --all"}, Environ: map[string]string{"PATH": bin}}, true},
+		{&crontab.Job{CrontabLine: crontab.CrontabLine{Command: "backup --all"}, PathPrepend: bin}, true},
+		{&crontab.Job{CrontabLine: crontab.CrontabLine{Command: "bakcup --all"}, Environ: map[string]string{"PATH": bin}}, false},
+		{&crontab.Job{CrontabLine: crontab.CrontabLine{Command: "notes"}, Environ: map[string]string{"PATH": bin}}, false},
+		{&crontab.Job{CrontabLine: crontab.CrontabLine{Command: filepath.Join(bin, "backup")}}, true},
+		{&crontab.Job{CrontabLine: crontab.CrontabLine{Command: "bin/backup"}, Dir: dir}, true},
+		{&crontab.Job{CrontabLine: crontab.CrontabLine{Command: "bin/bakcup"}, Dir: dir}, false},
+		{&crontab.Job{CrontabLine: crontab.CrontabLine{Command: "cd / && bakcup"}, Environ: map[string]string{"PATH": bin}}, true},
+	}
+
+	for _, tt := range testCases {
+		err := CheckCommand(&basicContext, &basicOptions, tt.job)
+		assert.Equal(t, tt.ok, err == nil, "%s: %v", tt.job.Command, err)
+	}
+}
@@ -7,22 +7,50 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/samgaw/cronic/crontab"
-	
-	"github.com/sirupsen/logrus"
 )
 
+// What to do with lines of output that are longer than READ_BUFFER_SIZE.
+const (
+	// Log the line in chunks of READ_BUFFER_SIZE
+	LongLineSplit = "split"
+
+	// Log the start of the line, followed by TRUNCATED_LINE_MARKER
+	LongLineTruncate = "truncate"
+
+	// Don't log the line at all
+	LongLineDrop = "drop"
+)
 
 var (
 	READ_BUFFER_SIZE = 64 * 1024
+
+	LONG_LINE_POLICY = LongLineSplit
+
+	// Appended to lines that were truncated
+	TRUNCATED_LINE_MARKER = " [truncated]"
+
+	longLinePolicies = []string{LongLineSplit, LongLineTruncate, LongLineDrop}
 )
 
-func startReaderDrain(wg *sync.WaitGroup, readerLogger *logrus.Entry, reader io.ReadCloser) {
+// ParseLongLinePolicy checks that policy is one of LongLineSplit,
+// LongLineTruncate or LongLineDrop.
+func ParseLongLinePolicy(policy string) (string, error) {
+	for _, known := range longLinePolicies {
+		if policy == known {
+			return policy, nil
+		}
+	}
+	return "", fmt.Errorf("unknown long line policy %q (expected one of %s)", policy, strings.Join(longLinePolicies, ", "))
+}
+
+func startReaderDrain(wg *sync.WaitGroup, readerLogger *Logger, reader io.ReadCloser, onLine func(string)) {
 	wg.Add(1)
 
 	go func() {
@@ -34,6 +62,10 @@ func startReaderDrain(wg *sync.WaitGroup, readerLogger *logrus.Entry, reader io.
 		}()
 
 		bufReader := bufio.NewReaderSize(reader, READ_BUFFER_SIZE)
+		policy := LONG_LINE_POLICY
+
+		// Whether the chunk being read is the rest of a long line
+		continued := false
 
 		for {
 			line, isPrefix, err := bufReader.ReadLine()
@@ -54,126 +86,1132 @@ func startReaderDrain(wg *sync.WaitGroup, readerLogger *logrus.Entry, reader io.
 				break
 			}
 
-			readerLogger.Info(string(line))
+			switch {
+			case policy == LongLineSplit:
+				onLine(string(line))
 
-			if isPrefix {
-				readerLogger.Warn("CRONIC: Last line exceeded buffer size, continuing...")
+				if isPrefix {
+					readerLogger.Warn("CRONIC: Last line exceeded buffer size, continuing...")
+				}
+			case continued:
+				// The rest of a line that was truncated, or
+				// dropped
+			case isPrefix && policy == LongLineTruncate:
+				onLine(string(line) + TRUNCATED_LINE_MARKER)
+				readerLogger.Warnf("CRONIC: Line exceeded buffer size (%d bytes), truncated it", len(line))
+			case isPrefix:
+				readerLogger.Warnf("CRONIC: Line exceeded buffer size (%d bytes), dropped it", len(line))
+			default:
+				onLine(string(line))
 			}
+
+			continued = isPrefix
 		}
 	}()
 }
 
-func runJob(cronCtx *crontab.Context, command string, jobLogger *logrus.Entry) error {
-	jobLogger.Info("CRONIC: Starting")
+// jobEnviron returns the environment for a job, given cronic's own, less
+// the variables opts doesn't let jobs inherit (see JobEnviron).
+func jobEnviron(cronCtx *crontab.Context, opts *Options, namespace *Namespace, job *crontab.Job) []string {
+	return JobEnviron(scrubEnviron(os.Environ(), opts.EnvAllow, opts.EnvDeny), cronCtx, namespace, job)
+}
 
-	cmd := exec.Command(cronCtx.Shell, "-c", command)
+// JobEnviron returns the environment for a job: environ (cronic's own
+// environment, as KEY=VALUE) less the variables the job's env-allow and
+// env-deny annotations exclude, overridden by the crontab's, and then by the
+// job's annotations. Only the variables allowed by the job's namespace (if
+// any) are inherited.
+func JobEnviron(environ []string, cronCtx *crontab.Context, namespace *Namespace, job *crontab.Job) []string {
+	inherited := make(map[string]string)
+	for _, kv := range scrubEnviron(environ, job.EnvAllow, job.EnvDeny) {
+		if i := strings.Index(kv, "="); i != -1 {
+			inherited[kv[:i]] = kv[i+1:]
+		}
+	}
 
-	// Run in a separate process group so that in interactive usage
-	// CTRL+C stops cronic, not the children threads.
-	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	// Like cron, tell jobs of system crontabs who they run as
+	if job.User != "" {
+		inherited["USER"] = job.User
+		inherited["LOGNAME"] = job.User
+	}
 
-	env := os.Environ()
 	for k, v := range cronCtx.Environ {
+		inherited[k] = v
+	}
+
+	env := make([]string, 0, len(inherited)+len(job.Environ)+1)
+	for k, v := range inherited {
+		if namespace.allowsEnv(k) {
+			env = append(env, fmt.Sprintf("%s=%s", k, v))
+		}
+	}
+
+	// The job's own variables are set explicitly, so they aren't subject to
+	// the namespace's allow-list. When there are duplicates, the last value
+	// wins.
+	for k, v := range job.Environ {
 		env = append(env, fmt.Sprintf("%s=%s", k, v))
 	}
-	cmd.Env = env
 
-	stdout, err := cmd.StdoutPipe()
+	if job.PathPrepend != "" {
+		path, ok := job.Environ["PATH"]
+		if !ok {
+			path, ok = inherited["PATH"]
+			if !ok || !namespace.allowsEnv("PATH") {
+				path = ""
+			}
+		}
+
+		env = append(env, fmt.Sprintf("PATH=%s", strings.TrimSuffix(job.PathPrepend+":"+path, ":")))
+	}
+
+	return env
+}
+
+// scrubEnviron returns the variables of environ (as KEY=VALUE) that allow
+// matches (if set), and deny doesn't (see crontab.ParseEnvPatterns).
+func scrubEnviron(environ []string, allow []string, deny []string) []string {
+	if allow == nil && deny == nil {
+		return environ
+	}
+
+	scrubbed := make([]string, 0, len(environ))
+	for _, kv := range environ {
+		name := kv
+		if i := strings.Index(kv, "="); i != -1 {
+			name = kv[:i]
+		}
+
+		if allow != nil && !crontab.MatchesEnvPattern(allow, name) || crontab.MatchesEnvPattern(deny, name) {
+			continue
+		}
+		scrubbed = append(scrubbed, kv)
+	}
+	return scrubbed
+}
+
+// lifecycleLevel returns the level for routine messages about a job (e.g.
+// that it started), which quiet jobs only log at debug level.
+func lifecycleLevel(job *crontab.Job) crontab.Level {
+	if job.Quiet {
+		return crontab.LevelDebug
+	}
+	return crontab.LevelInfo
+}
+
+func outputLevel(level *crontab.Level) crontab.Level {
+	if level == nil {
+		return crontab.LevelInfo
+	}
+	return *level
+}
+
+func runJob(ctx context.Context, cronCtx *crontab.Context, opts *Options, status *JobStatus, jobLogger *Logger) error {
+	job := status.Job
+
+	namespace, err := opts.Namespace(job)
 	if err != nil {
 		return err
 	}
 
-	stderr, err := cmd.StderrPipe()
+	jobLogger.Log(lifecycleLevel(job), "CRONIC: Starting")
+
+	command := &Command{
+		Shell:     jobShell(cronCtx, job),
+		Command:   job.Command,
+		Argv:      job.Argv,
+		Env:       jobEnviron(cronCtx, opts, namespace, job),
+		Dir:       JobDir(cronCtx, job),
+		Stdin:     job.Stdin,
+		StdinFile: job.StdinFile,
+		User:      job.User,
+		Limits:    opts.resourceLimits(job),
+		Image:     job.Image,
+		ImagePull: job.ImagePull,
+		Mounts:    job.Mounts,
+
+		JobTemplate: job.JobTemplate,
+		Host:        job.Host,
+		SSHKey:      job.SSHKey,
+	}
+	if job.Image != "" || job.Host != "" {
+		// Containers and remote hosts have an environment of their own,
+		// which cronic's (e.g. its PATH) would only break
+		command.Env = JobEnviron(nil, cronCtx, namespace, job)
+	}
+	if opts.PropagateTraceContext {
+		command.Env = append(command.Env, "TRACEPARENT="+status.traceParent())
+	}
+
+	// Secrets are resolved on each run, so that rotated ones are picked up.
+	// When they can't be, the command can't start.
+	command.Env, err = opts.resolveSecrets(ctx, command.Env)
 	if err != nil {
-		return err
+		return &StartError{err}
 	}
 
-	if err := cmd.Start(); err != nil {
-		return err
+	signals, stopSignals := status.runSignals()
+	defer stopSignals()
+	command.Signals = signals
+	command.Kill = opts.Kill
+
+	if deadline, ok := ctx.Deadline(); ok && job.CheckpointSignal != 0 {
+		checkpoint := time.AfterFunc(time.Until(deadline.Add(-job.CheckpointGrace)), func() {
+			select {
+			case signals <- job.CheckpointSignal:
+				jobLogger.Infof("CRONIC: Job is about to time out, sending %v", job.CheckpointSignal)
+			default:
+				jobLogger.Warnf("CRONIC: Job is about to time out, but has too many signals pending to be sent %v", job.CheckpointSignal)
+			}
+		})
+		defer checkpoint.Stop()
+	}
+
+	runID := status.currentRunID()
+
+	var archive *archiveWriter
+	if opts.Archive != nil {
+		archive, err = opts.Archive.create(runID)
+		if err != nil {
+			jobLogger.Errorf("CRONIC: Failed to archive output: %v", err)
+		} else {
+			defer func() {
+				if err := archive.Close(); err != nil {
+					jobLogger.Errorf("CRONIC: Failed to archive output: %v", err)
+				}
+			}()
+		}
+	}
+
+	expectation := newOutputExpectation(job)
+
+	limit := opts.outputRateLimit(job)
+	throttle := newLineThrottle(limit, func() {
+		jobLogger.Warnf("CRONIC: Job emits more than %d lines of output per second, throttling it", limit)
+	})
+
+	logRateLimit, logBurst, logSample := opts.logLimits(job)
+	limiter := newLogLimiter(logRateLimit, logBurst, logSample, func() {
+		jobLogger.Warnf("CRONIC: Job logs more than %d lines of output per second, not logging some of them", logRateLimit)
+	})
+
+	jsonOutput := opts.jsonOutput(job)
+
+	budget := newOutputBudget(job.MaxOutput, func() {
+		jobLogger.Warnf("CRONIC: Job output exceeds max-output (%d bytes), not logging the rest", job.MaxOutput)
+	})
+
+	onLine := func(channel string, lineLogger *Logger, level crontab.Level) func(string) {
+		return func(line string) {
+			throttle.wait()
+			expectation.check(line)
+
+			// Quiet jobs' output is still available via the
+			// dashboard and archive.
+			if !job.Quiet && limiter.allow() && budget.allow(line) {
+				if opts.Passthrough != nil {
+					opts.Passthrough.writeLine(job, channel, line)
+				} else {
+					logOutputLine(lineLogger, level, line, jsonOutput)
+				}
+			}
+
+			entry := status.recordOutput(channel, line)
+			if opts.EventStream != nil {
+				opts.EventStream.line(job, namespace, runID, entry)
+			}
+			if archive != nil {
+				archive.writeLine(line)
+			}
+		}
 	}
 
+	stdout, stdoutWriter := io.Pipe()
+	stderr, stderrWriter := io.Pipe()
+
 	var wg sync.WaitGroup
 
-	stdoutLogger := jobLogger.WithFields(logrus.Fields{"channel": "stdout"})
-	startReaderDrain(&wg, stdoutLogger, stdout)
+	stdoutLogger := jobLogger.WithFields(Fields{"channel": "stdout"})
+	startReaderDrain(&wg, stdoutLogger, stdout, onLine("stdout", stdoutLogger, outputLevel(job.StdoutLevel)))
 
-	stderrLogger := jobLogger.WithFields(logrus.Fields{"channel": "stderr"})
-	startReaderDrain(&wg, stderrLogger, stderr)
+	stderrLogger := jobLogger.WithFields(Fields{"channel": "stderr"})
+	startReaderDrain(&wg, stderrLogger, stderr, onLine("stderr", stderrLogger, outputLevel(job.StderrLevel)))
 
+	executor, err := opts.commandExecutor(command)
+	if err == nil {
+		err = executor.Run(ctx, command, stdoutWriter, stderrWriter)
+	} else {
+		err = &StartError{err}
+	}
+
+	stdoutWriter.Close()
+	stderrWriter.Close()
 	wg.Wait()
 
-	if err := cmd.Wait(); err != nil {
-		return fmt.Errorf("CRONIC: Error running command: %v", err)
+	if lines, bytes := budget.dropped(); lines > 0 {
+		jobLogger.WithFields(Fields{
+			"dropped_lines": lines,
+			"dropped_bytes": bytes,
+		}).Warnf("CRONIC: Didn't log %d lines (%d bytes) of output over max-output", lines, bytes)
+	}
+
+	if sampled, limited := limiter.dropped(); sampled+limited > 0 {
+		jobLogger.WithFields(Fields{
+			"sampled_lines": sampled,
+			"limited_lines": limited,
+		}).Warnf("CRONIC: Didn't log %d lines of output (%d sampled out, %d over log-rate-limit)", sampled+limited, sampled, limited)
+	}
+
+	// A command that exits cleanly once asked to stop (see stopProcessGroup)
+	// still timed out, or was cancelled
+	if err == nil && ctx.Err() == nil {
+		if missing := expectation.missing(); missing != "" {
+			return &commandError{missingOutput: missing}
+		}
+		return nil
+	}
+
+	if _, ok := err.(*StartError); ok {
+		return err
+	}
+
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return &commandError{err: err, timeout: opts.timeout(job)}
+	case context.Canceled:
+		return &commandError{err: err, cancelled: true}
 	}
 
-	return nil
+	return &commandError{err: err}
 }
 
-func monitorJob(ctx context.Context, expression crontab.Expression, t0 time.Time, jobLogger *logrus.Entry) {
-	t := t0
+// jobShell returns the shell that runs the job's commands.
+func jobShell(cronCtx *crontab.Context, job *crontab.Job) string {
+	if job.Shell != "" {
+		return job.Shell
+	}
+	return cronCtx.Shell
+}
 
-	for {
-		t = expression.Next(t)
+// JobDir returns the working directory of a job: its own, or the crontab's
+// HOME (or cronic's working directory if neither is set).
+func JobDir(cronCtx *crontab.Context, job *crontab.Job) string {
+	if job.Dir != "" {
+		return job.Dir
+	}
+	return cronCtx.Home
+}
+
+// commandError is returned when a job's command fails.
+type commandError struct {
+	err error
+
+	// Set if the command was stopped for running longer than this
+	timeout time.Duration
 
-		select {
-		case <-time.After(time.Until(t)):
-			jobLogger.Warnf("CRONIC: Not starting. Job is still running since %s (%s elapsed)", t0, t.Sub(t0))
-		case <-ctx.Done():
+	// Set if the command was stopped because the run was cancelled
+	cancelled bool
+
+	// Set if the command succeeded without the output the job expects
+	missingOutput string
+}
+
+func (e *commandError) Error() string {
+	var message string
+	switch {
+	case e.timeout > 0:
+		message = fmt.Sprintf("CRONIC: Job timed out after %v", e.timeout)
+	case e.cancelled:
+		message = "CRONIC: Run cancelled"
+	case e.missingOutput != "":
+		message = fmt.Sprintf("CRONIC: Job output has no line %s", e.missingOutput)
+	default:
+		message = "CRONIC: Error running command"
+	}
+
+	// The command may have exited cleanly once stopped
+	if e.err == nil {
+		return message
+	}
+	return fmt.Sprintf("%s: %v", message, e.err)
+}
+
+// timedOut reports whether a run failed because of its timeout.
+func timedOut(err error) bool {
+	cmdErr, ok := err.(*commandError)
+	return ok && cmdErr.timeout > 0
+}
+
+// cancelled reports whether a run failed because it was cancelled.
+func cancelled(err error) bool {
+	cmdErr, ok := err.(*commandError)
+	return ok && cmdErr.cancelled
+}
+
+// failureCondition classifies the error of a run, for retry policies: it's
+// either the exit code of the command, or a failure class.
+func failureCondition(err error) string {
+	cmdErr, ok := err.(*commandError)
+	if !ok {
+		return crontab.FailureSpawn
+	}
+
+	if cmdErr.timeout > 0 {
+		return crontab.FailureTimeout
+	}
+
+	if cmdErr.missingOutput != "" {
+		return crontab.FailureOutput
+	}
+
+	code, ok := exitCode(err)
+	if !ok || code == -1 {
+		return crontab.FailureSignal
+	}
+
+	return strconv.Itoa(code)
+}
+
+// exitCode returns the exit code of a failed command (or -1 if it was killed
+// by a signal), and whether there is one.
+func exitCode(err error) (int, bool) {
+	cmdErr, ok := err.(*commandError)
+	if !ok {
+		return 0, false
+	}
+
+	// The command succeeded, but that doesn't make the run a success
+	if cmdErr.missingOutput != "" {
+		return 0, true
+	}
+
+	exitErr, ok := cmdErr.err.(*exec.ExitError)
+	if !ok {
+		// Other executors' errors may report exit codes too
+		if coder, ok := cmdErr.err.(interface{ ExitCode() int }); ok {
+			return coder.ExitCode(), true
+		}
+		return 0, false
+	}
+
+	waitStatus, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok {
+		return 0, false
+	}
+
+	return waitStatus.ExitStatus(), true
+}
+
+// FormatOutput renders lines of output as text, prefixing each line with the
+// channel it came from.
+func FormatOutput(lines []OutputLine) string {
+	formatted := make([]string, 0, len(lines))
+	for _, line := range lines {
+		formatted = append(formatted, fmt.Sprintf("[%s] %s", line.Channel, line.Line))
+	}
+	return strings.Join(formatted, "\n")
+}
+
+// monitorJob warns, and calls onSkip, whenever a run is skipped because the
+// job is still running, until ctx is done, from the goroutine of timers.
+func monitorJob(ctx context.Context, expression crontab.Expression, t0 time.Time, timers *TimerQueue, jobLogger *Logger, onSkip func()) {
+	// Only used from the goroutine of timers
+	var w *wakeup
+
+	var wait func(t time.Time)
+	wait = func(t time.Time) {
+		t = expression.Next(t)
+		if t.IsZero() {
+			// The job has no more runs scheduled, so none can be skipped
 			return
 		}
+
+		// If the clock jumps, this waits for the same run again
+		w = timers.at(t, func() {
+			decisionLogger(jobLogger, DecisionSkip, t).WithField("reason", SkipReasonRunning).Warnf("CRONIC: Not starting. Job is still running since %s (%s elapsed)", t0, t.Sub(t0))
+			onSkip()
+			wait(t)
+		}, nil)
 	}
+
+	timers.post(func() { wait(t0) })
+	context.AfterFunc(ctx, func() {
+		timers.post(func() { timers.cancel(w) })
+	})
 }
 
-func StartJob(wg *sync.WaitGroup, cronCtx *crontab.Context, job *crontab.Job, exitChan chan interface{}, cronLogger *logrus.Entry) {
+// StartJob schedules a job until ctx is done. Runs that are in progress
+// then are left to finish (see JobStatus.Cancel to stop them).
+func StartJob(ctx context.Context, wg *sync.WaitGroup, cronCtx *crontab.Context, opts *Options, status *JobStatus, cronLogger *Logger) {
 	wg.Add(1)
+	startJob(ctx, cronCtx, opts, status, cronLogger, wg.Done)
+}
 
-	go func() {
-		defer wg.Done()
+// startJob schedules a job like StartJob, and calls onDone once it's done
+// with it.
+func startJob(ctx context.Context, cronCtx *crontab.Context, opts *Options, status *JobStatus, cronLogger *Logger, onDone func()) {
+	job := status.Job
 
-		var cronIteration uint64 = 0
-		nextRun := time.Now()
+	// Unknown namespaces are reported when running the job
+	namespace, _ := opts.Namespace(job)
+	if namespace != nil {
+		cronLogger = cronLogger.WithFields(namespace.labelFields())
+	}
 
-		// NOTE: this (intentionally) does not run multiple instances of the
-		// job concurrently
-		for {
-			nextRun = job.Expression.Next(nextRun)
-			cronLogger.Debugf("CRONIC: Job will run next at %v", nextRun)
-
-			delay := nextRun.Sub(time.Now())
-			if delay < 0 {
-				cronLogger.Warningf("CRONIC: Job took too long to run. Tt should have started %v ago", -delay)
-				nextRun = time.Now()
-				continue
-			}
+	if opts.Syslog != nil {
+		cronLogger = opts.Syslog.Logger(cronLogger, job)
+	}
+	if opts.GELF != nil {
+		cronLogger = opts.GELF.Logger(cronLogger, job)
+	}
+	if opts.Loki != nil {
+		cronLogger = opts.Loki.Logger(cronLogger, job)
+	}
+	if opts.Journal != nil {
+		cronLogger = opts.Journal.Logger(cronLogger, job)
+	}
 
-			select {
-			case <-exitChan:
-				cronLogger.Debug("CRONIC: Shutting down")
-				return
-			case <-time.After(delay):
-				// Proceed normally
+	timers := opts.Timers
+	if timers == nil {
+		timers = NewTimerQueue(opts.Clock)
+	}
+
+	j := &scheduledJob{
+		ctx:          ctx,
+		cronCtx:      cronCtx,
+		opts:         opts,
+		status:       status,
+		namespace:    namespace,
+		cronLogger:   cronLogger,
+		timers:       timers,
+		onDone:       onDone,
+		scheduleFrom: time.Now(),
+	}
+
+	restoreState(opts, status, cronLogger)
+
+	status.setOnTrigger(func() { timers.post(j.triggered) })
+	timers.post(j.start)
+	context.AfterFunc(ctx, func() { timers.post(j.stop) })
+}
+
+// scheduledJob is a job scheduled by StartJob. It doesn't have a goroutine
+// of its own: its TimerQueue calls it back when the time it's waiting for
+// comes (or when it's triggered manually, or stopped), and it hands its
+// runs to the WorkerPool. Its methods are called from the goroutine of the
+// queue (except attempt), so they must not block.
+type scheduledJob struct {
+	ctx        context.Context
+	cronCtx    *crontab.Context
+	opts       *Options
+	status     *JobStatus
+	namespace  *Namespace
+	cronLogger *Logger
+	timers     *TimerQueue
+	onDone     func()
+
+	cronIteration uint64
+	scheduleFrom  time.Time
+
+	// Whether the clock jumped while waiting for nextRun
+	clockJumped bool
+
+	// The run the splay offset was picked for, so that it stays the same
+	// while waiting for that run again
+	splayedRun time.Time
+	splay      time.Duration
+
+	// The run the job waits for, as scheduled, and once its splay offset
+	// is added
+	scheduledRun time.Time
+	nextRun      time.Time
+
+	// What the job waits for, if anything
+	wakeup *wakeup
+
+	// Called when the job is triggered manually, if it's waiting for its
+	// next run (otherwise, the trigger stays pending until it is)
+	onTrigger func()
+
+	// Whether a run is in progress (including waiting for its namespace,
+	// or a worker), and how to stop waiting for them, if it is
+	running    bool
+	cancelWait func() bool
+
+	// Whether ctx is done, and whether the job is
+	stopped  bool
+	finished bool
+}
+
+func (j *scheduledJob) start() {
+	// Jobs that run a single time are done once they have, whether they
+	// were scheduled or triggered manually
+	if at, ok := j.status.Job.RunsOnce(); ok {
+		j.runOnce(at)
+		return
+	}
+
+	j.schedule()
+}
+
+// schedule waits for the job's next run. NOTE: this (intentionally) does
+// not run multiple instances of the job concurrently.
+func (j *scheduledJob) schedule() {
+	job := j.status.Job
+
+	j.scheduledRun = job.Expression.Next(j.scheduleFrom)
+	if !j.scheduledRun.Equal(j.splayedRun) {
+		j.splayedRun, j.splay = j.scheduledRun, splayOffset(job)
+	}
+
+	j.nextRun = j.scheduledRun
+	if !j.nextRun.IsZero() {
+		j.nextRun = j.nextRun.Add(j.splay)
+	}
+	j.status.setNextTick(j.scheduledRun, j.nextRun)
+
+	if j.nextRun.IsZero() {
+		// e.g. all the dates of a calendar have passed. The job can still
+		// be triggered manually.
+		decisionLogger(j.cronLogger, DecisionWait, time.Time{}).Info("CRONIC: Job will not run again")
+		j.wait(time.Time{}, nil, nil, j.runTriggered)
+		return
+	}
+
+	delay := j.nextRun.Sub(time.Now())
+	decisionLogger(j.cronLogger, DecisionSchedule, j.nextRun).WithField("delay", delay).Debug("CRONIC: Job will run next")
+
+	if delay < 0 && j.clockJumped {
+		decisionLogger(j.cronLogger, DecisionSkip, j.nextRun).WithFields(Fields{"reason": SkipReasonClock, "delay": -delay}).Warnf("CRONIC: Clock jumped past the job's run, which should have started %v ago. Skipping it", -delay)
+		j.skip(SkipReasonClock)
+		j.scheduleFrom = time.Now()
+		j.clockJumped = false
+		j.schedule()
+		return
+	}
+
+	if delay < 0 {
+		decisionLogger(j.cronLogger, DecisionReschedule, j.nextRun).WithField("delay", -delay).Warnf("CRONIC: Job took too long to run. It should have started %v ago", -delay)
+		j.scheduleFrom = time.Now()
+		j.schedule()
+		return
+	}
+
+	j.clockJumped = false
+	j.wait(j.nextRun, j.due, j.jumped, j.runTriggered)
+}
+
+// runTriggered runs the job, which was triggered manually while waiting for
+// its next run.
+func (j *scheduledJob) runTriggered() {
+	decisionLogger(j.cronLogger, DecisionRun, time.Time{}).WithField("reason", RunReasonManual).Info("CRONIC: Job triggered manually")
+
+	// Manual runs don't affect the schedule: the job waits for the same
+	// nextRun again
+	j.run(time.Now(), j.schedule)
+}
+
+func (j *scheduledJob) jumped() {
+	// The delay is wrong: wait for the same nextRun again
+	decisionLogger(j.cronLogger, DecisionReschedule, j.nextRun).WithField("reason", RescheduleReasonClock).Debug("CRONIC: Clock jumped, rescheduling the job")
+	j.clockJumped = true
+	j.schedule()
+}
+
+// due runs the job's next run, unless it's skipped or deferred.
+func (j *scheduledJob) due() {
+	job := j.status.Job
+	j.scheduleFrom = j.scheduledRun
+
+	if job.SkipHolidays && j.opts.Holidays.Contains(j.nextRun) {
+		decisionLogger(j.cronLogger, DecisionSkip, j.nextRun).WithField("reason", SkipReasonHoliday).Info("CRONIC: Run falls on a holiday, skipping it")
+		j.skip(SkipReasonHoliday)
+		j.schedule()
+		return
+	}
+
+	if end, ok := blackoutEnd(j.opts, job, j.nextRun); ok {
+		if job.OnBlackout != crontab.BlackoutDefer {
+			decisionLogger(j.cronLogger, DecisionSkip, j.nextRun).WithFields(Fields{"reason": SkipReasonBlackout, "until": end}).Info("CRONIC: Run falls in a blackout window, skipping it")
+			j.skip(SkipReasonBlackout)
+			j.schedule()
+			return
+		}
+
+		j.waitForBlackout(end)
+		return
+	}
+
+	j.checkRun()
+}
+
+// waitForBlackout waits for the blackout window the job's next run fell in
+// to end (along with those that follow it right away).
+func (j *scheduledJob) waitForBlackout(end time.Time) {
+	decisionLogger(j.cronLogger, DecisionDefer, j.nextRun).WithFields(Fields{"reason": SkipReasonBlackout, "delay": time.Until(end)}).Infof("CRONIC: Run falls in a blackout window, deferring it until %s", end)
+
+	j.wait(end, func() {
+		if end, ok := blackoutEnd(j.opts, j.status.Job, end); ok {
+			j.waitForBlackout(end)
+			return
+		}
+
+		// The runs that fell in the blackout are merged into this one
+		j.scheduleFrom = time.Now()
+		j.checkRun()
+	}, nil, nil)
+}
+
+// checkRun runs the job's next run, unless the job is draining or paused,
+// once the jobs it runs after are done.
+func (j *scheduledJob) checkRun() {
+	if j.status.Draining() {
+		decisionLogger(j.cronLogger, DecisionSkip, j.nextRun).WithField("reason", SkipReasonDraining).Info("CRONIC: Jobs are draining, skipping run")
+		j.skip(SkipReasonDraining)
+		j.schedule()
+		return
+	}
+
+	if j.status.skipsRuns() {
+		decisionLogger(j.cronLogger, DecisionSkip, j.nextRun).WithField("reason", SkipReasonPaused).Info("CRONIC: Job is paused, skipping run")
+		j.skip(SkipReasonPaused)
+		j.schedule()
+		return
+	}
+
+	j.waitForDependencies()
+}
+
+func (j *scheduledJob) waitForDependencies() {
+	done, err := checkDependencies(j.status, j.scheduledRun)
+	if !done {
+		j.sleep(DEPENDENCY_POLL_INTERVAL, j.waitForDependencies)
+		return
+	}
+
+	if err != nil {
+		decisionLogger(j.cronLogger, DecisionSkip, j.nextRun).WithField("reason", SkipReasonDependency).Infof("CRONIC: Not starting, %v", err)
+		j.skip(SkipReasonDependency)
+		j.schedule()
+		return
+	}
+
+	j.run(j.nextRun, func() {
+		if j.status.Job.IntervalFromEnd {
+			j.scheduleFrom = time.Now()
+		}
+		j.schedule()
+	})
+}
+
+// runOnce runs a job that runs a single time, at (or right away, if at is
+// zero).
+func (j *scheduledJob) runOnce(at time.Time) {
+	var delay time.Duration
+	if at.IsZero() {
+		at = time.Now()
+	} else {
+		delay = time.Until(at)
+	}
+
+	if delay < 0 {
+		// e.g. cronic restarted after the job's time
+		decisionLogger(j.cronLogger, DecisionDone, at).WithField("reason", DoneReasonPassed).Warnf("CRONIC: Job was to run once at %s, which has passed. It will not run", at)
+		j.done()
+		return
+	}
+
+	j.status.setNextRun(at)
+	decisionLogger(j.cronLogger, DecisionSchedule, at).WithField("delay", delay).Debug("CRONIC: Job will run next")
+
+	j.waitOnce(at)
+}
+
+func (j *scheduledJob) waitOnce(at time.Time) {
+	ranOnce := func() {
+		decisionLogger(j.cronLogger, DecisionDone, time.Time{}).Info("CRONIC: Job ran once, it will not run again")
+		j.done()
+	}
+
+	onJump := func() {
+		// If the clock jumped past the run, it runs right away (since it
+		// won't have another chance)
+		decisionLogger(j.cronLogger, DecisionReschedule, at).WithFields(Fields{"reason": RescheduleReasonClock, "delay": time.Until(at)}).Debug("CRONIC: Clock jumped, rescheduling the job")
+		j.waitOnce(at)
+	}
+
+	onTrigger := func() {
+		// Like other jobs, paused jobs can still be triggered manually
+		decisionLogger(j.cronLogger, DecisionRun, time.Time{}).WithField("reason", RunReasonManual).Info("CRONIC: Job triggered manually")
+		j.status.setNextRun(time.Time{})
+		j.run(time.Now(), ranOnce)
+	}
+
+	j.wait(at, func() {
+		j.status.setNextRun(time.Time{})
+
+		reason := ""
+		if j.status.Draining() {
+			reason = SkipReasonDraining
+			decisionLogger(j.cronLogger, DecisionSkip, at).WithField("reason", reason).Info("CRONIC: Jobs are draining, skipping run")
+		} else if j.status.skipsRuns() {
+			reason = SkipReasonPaused
+			decisionLogger(j.cronLogger, DecisionSkip, at).WithField("reason", reason).Info("CRONIC: Job is paused, skipping run")
+		}
+
+		if reason != "" {
+			j.skip(reason)
+			decisionLogger(j.cronLogger, DecisionDone, at).WithField("reason", reason).Info("CRONIC: Job was to run once, it will not run again")
+			j.done()
+			return
+		}
+
+		j.run(at, ranOnce)
+	}, onJump, onTrigger)
+}
+
+// wait waits until the wall clock reaches at, and calls onDue (or, if they
+// come first, onJump when the clock jumps, and onTrigger when the job is
+// triggered manually, if they're set). A zero at waits for a trigger only.
+// If the job is stopped, it's done instead.
+func (j *scheduledJob) wait(at time.Time, onDue func(), onJump func(), onTrigger func()) {
+	if j.stopping() {
+		return
+	}
+
+	if onTrigger != nil && j.status.takeTrigger() {
+		onTrigger()
+		return
+	}
+
+	j.onTrigger = onTrigger
+	if at.IsZero() {
+		return
+	}
+
+	var jumped func()
+	if onJump != nil {
+		jumped = func() {
+			j.onTrigger = nil
+			onJump()
+		}
+	}
+
+	j.wakeup = j.timers.at(at, func() {
+		j.onTrigger = nil
+		onDue()
+	}, jumped)
+}
+
+// sleep calls f once d has elapsed, unless the job is stopped first.
+func (j *scheduledJob) sleep(d time.Duration, f func()) {
+	if j.stopping() {
+		return
+	}
+
+	j.wakeup = j.timers.after(d, f)
+}
+
+// triggered runs the job if it was triggered manually while waiting for its
+// next run.
+func (j *scheduledJob) triggered() {
+	onTrigger := j.onTrigger
+	if onTrigger == nil || !j.status.takeTrigger() {
+		return
+	}
+
+	j.onTrigger = nil
+	j.timers.cancel(j.wakeup)
+	onTrigger()
+}
+
+// stop stops the job once ctx is done, unless a run is in progress, which
+// is left to finish (runs waiting for their namespace or a worker don't
+// start).
+func (j *scheduledJob) stop() {
+	if j.finished {
+		return
+	}
+
+	j.stopped = true
+	j.onTrigger = nil
+
+	if j.running {
+		if j.cancelWait != nil && j.cancelWait() {
+			j.running, j.cancelWait = false, nil
+			j.finish()
+		}
+		return
+	}
+
+	j.timers.cancel(j.wakeup)
+	j.finish()
+}
+
+// stopping finishes the job, and returns true, if it's stopped (for it not
+// to wait for anything else).
+func (j *scheduledJob) stopping() bool {
+	if j.stopped {
+		j.finish()
+	}
+	return j.stopped
+}
+
+func (j *scheduledJob) finish() {
+	decisionLogger(j.cronLogger, DecisionStop, time.Time{}).Debug("CRONIC: Shutting down")
+	j.done()
+}
+
+func (j *scheduledJob) done() {
+	j.finished = true
+	j.status.setOnTrigger(nil)
+	j.onDone()
+}
+
+func (j *scheduledJob) skip(reason string) {
+	event := newEvent(crontab.EventSkip, j.status.Job, j.namespace)
+	event.SkipReason = reason
+	j.opts.notify(event)
+}
+
+// run runs the job, retrying it if it fails (as per its RetryPolicy, or its
+// spawn failure policy), and then calls next (unless cronic is shutting
+// down).
+func (j *scheduledJob) run(scheduledAt time.Time, next func()) {
+	j.try(scheduledAt, 0, next)
+}
+
+// try hands a run of the job to a worker, once its namespace lets it run.
+func (j *scheduledJob) try(scheduledAt time.Time, retry int, next func()) {
+	j.running = true
+
+	entered, stopWaiting := j.namespace.enter(func() {
+		j.timers.post(func() {
+			j.cancelWait = nil
+			j.handOff(scheduledAt, retry, next)
+		})
+	})
+	if !entered {
+		j.cronLogger.Infof("CRONIC: Waiting for one of the %d jobs running in namespace %s to finish", j.namespace.MaxConcurrent, j.namespace.Name)
+		j.cancelWait = stopWaiting
+		return
+	}
+
+	j.handOff(scheduledAt, retry, next)
+}
+
+func (j *scheduledJob) handOff(scheduledAt time.Time, retry int, next func()) {
+	if j.stopped {
+		j.namespace.leave()
+		j.running = false
+		j.finish()
+		return
+	}
+
+	started, stopWaiting := j.opts.Workers.run(func() {
+		again, delay, started := false, time.Duration(0), false
+		if j.ctx.Err() == nil {
+			again, delay, started = j.attempt(scheduledAt, retry)
+		}
+		j.namespace.leave()
+
+		j.timers.post(func() {
+			j.attempted(scheduledAt, retry, next, again, delay, started)
+		})
+	})
+	if !started {
+		j.cronLogger.Infof("CRONIC: Waiting for one of the %d workers to be free", j.opts.Workers.size)
+		j.cancelWait = func() bool {
+			if !stopWaiting() {
+				return false
 			}
+			j.namespace.leave()
+			return true
+		}
+	}
+}
+
+// attempted retries the job after an attempt, if it must, or calls next.
+func (j *scheduledJob) attempted(scheduledAt time.Time, retry int, next func(), again bool, delay time.Duration, started bool) {
+	j.running, j.cancelWait = false, nil
+
+	if !started {
+		j.finish()
+		return
+	}
+
+	if again && !j.status.Draining() {
+		j.sleep(delay, func() {
+			j.try(scheduledAt, retry+1, next)
+		})
+		return
+	}
+
+	next()
+}
+
+// attempt runs the job, on a worker, and returns whether to retry it (and
+// after how long), or false if cronic shut down before it could start.
+func (j *scheduledJob) attempt(scheduledAt time.Time, retry int) (bool, time.Duration, bool) {
+	cronCtx, opts, status, namespace, cronLogger := j.cronCtx, j.opts, j.status, j.namespace, j.cronLogger
+	job := status.Job
+
+	// Waiting for the job's lock isn't part of the run, which doesn't show
+	// as running until it has it
+	releaseLock, lockErr := acquireLock(j.ctx, opts, job, cronLogger)
+	if lockErr != nil && j.ctx.Err() != nil {
+		return false, 0, false
+	}
+	if lockErr == nil {
+		defer releaseLock()
+	}
+
+	runID := status.startRun(j.cronIteration)
+
+	// How late the run starts (e.g. because it waited for its namespace,
+	// or cronic was busy), which retries don't tell
+	lag := time.Since(scheduledAt)
+
+	jobLogger := cronLogger.WithFields(Fields{
+		"iteration": j.cronIteration,
+		"run.id":    runID,
+	})
+	if retry > 0 {
+		jobLogger = jobLogger.WithField("retry", retry)
+	} else {
+		jobLogger = jobLogger.WithField("lag", lag)
+	}
+
+	startEvent := newEvent(crontab.EventStart, job, namespace)
+	startEvent.RunID = runID
+	startEvent.Iteration = j.cronIteration
+	opts.notify(startEvent)
 
-			jobLogger := cronLogger.WithFields(logrus.Fields{
-				"iteration": cronIteration,
+	err := func() error {
+		if lockErr != nil {
+			return lockErr
+		}
+
+		runCtx, cancel := status.runContext(opts.timeout(job))
+		defer cancel()
+
+		watchRun(runCtx, opts.warnAfter(job), j.timers, jobLogger)
+
+		// Runs can't be skipped when the schedule starts once they're
+		// over
+		if !job.IntervalFromEnd {
+			monitorJob(runCtx, job.Expression, scheduledAt, j.timers, jobLogger, func() {
+				j.skip(SkipReasonRunning)
 			})
+		}
 
-			err := func() error {
-				ctx, cancel := context.WithCancel(context.Background())
-				defer cancel()
+		return runJob(runCtx, cronCtx, opts, status, jobLogger)
+	}()
 
-				go monitorJob(ctx, job.Expression, nextRun, jobLogger)
+	var (
+		outputTail  []OutputLine
+		debugOutput string
+	)
 
-				return runJob(cronCtx, job.Command, jobLogger)
-			}()
+	if err == nil {
+		jobLogger.Log(lifecycleLevel(job), "CRONIC: Job succeeded")
+	} else {
+		// Report everything we know about the failure in a single entry,
+		// so it's easy to find.
+		failureLogger := jobLogger
+
+		outputTail = status.outputTail(opts.FailureTailLines)
+		if len(outputTail) > 0 {
+			failureLogger = failureLogger.WithField("output_tail", FormatOutput(outputTail))
+		}
+
+		if job.DebugCommand != "" {
+			var debugErr error
+			debugOutput, debugErr = runDebugCommand(cronCtx, opts, namespace, job)
+			if debugErr != nil {
+				jobLogger.Error(debugErr)
+			}
+			failureLogger = failureLogger.WithField("debug_output", debugOutput)
+		}
+
+		failureLogger.Error(err)
+	}
+
+	output := status.outputTail(OUTPUT_BUFFER_SIZE)
+	result := status.finishRun(err, outputTail, debugOutput)
+	result.Retry = retry
+	if retry == 0 {
+		result.ScheduledAt = &scheduledAt
+		result.LagSeconds = lag.Seconds()
+	}
+
+	// The archived output is complete once runJob returns
+	if opts.Archive != nil {
+		result.OutputFile, _ = opts.Archive.file(result.RunID)
+	}
 
-			if err == nil {
-				jobLogger.Info("CRONIC: Job succeeded")
-			} else {
-				jobLogger.Error(err)
+	var delay time.Duration
+	pause := false
+
+	if err != nil && !cancelled(err) {
+		spawnFailed := failureCondition(err) == crontab.FailureSpawn
+
+		switch policy := opts.spawnFailurePolicy(job); {
+		case spawnFailed && policy == crontab.SpawnFailureRetry:
+			result.WillRetry = retry < SPAWN_RETRIES
+			delay = spawnRetryDelay(retry)
+			if result.WillRetry {
+				decisionLogger(cronLogger, DecisionRetry, scheduledAt).WithFields(Fields{"reason": crontab.FailureSpawn, "delay": delay}).Warnf("CRONIC: Failed to start the job, retrying in %v (retry %d of %d)", delay, retry+1, SPAWN_RETRIES)
+			}
+		case spawnFailed && policy == crontab.SpawnFailurePause:
+			pause = true
+		default:
+			result.WillRetry = job.Retry.Allows(failureCondition(err), retry)
+			if result.WillRetry {
+				delay = job.Retry.Delay
+				decisionLogger(cronLogger, DecisionRetry, scheduledAt).WithFields(Fields{"reason": failureCondition(err), "delay": delay}).Infof("CRONIC: Retrying in %v (retry %d of %d)", delay, retry+1, job.Retry.Retries)
 			}
+		}
+	}
+
+	// The circuit breaker: a job that keeps failing is paused, so it
+	// doesn't keep hammering whatever it's failing on
+	tripped := err != nil && !cancelled(err) && !pause && !result.WillRetry &&
+		job.PauseAfterFailures > 0 && result.ConsecutiveFailures >= job.PauseAfterFailures
+
+	var pausedUntil time.Time
+	if tripped && job.PauseFor > 0 {
+		pausedUntil = time.Now().Add(job.PauseFor)
+		result.PausedUntil = &pausedUntil
+	}
+	result.Paused = pause || tripped
 
-			cronIteration++
+	recordState(opts, job, result, jobLogger)
+
+	resultEvent := newResultEvent(job, namespace, result)
+	resultEvent.Output = output
+	opts.notify(resultEvent)
+
+	runHook(cronCtx, opts, namespace, job, result, output, jobLogger)
+
+	if pause {
+		// Until someone fixes the host, and resumes the job
+		status.Pause()
+		decisionLogger(cronLogger, DecisionPause, scheduledAt).WithField("reason", crontab.FailureSpawn).Error("CRONIC: Failed to start the job, pausing it")
+	}
+
+	if tripped {
+		status.pauseUntil(pausedUntil)
+
+		pauseLogger := decisionLogger(cronLogger, DecisionPause, scheduledAt).WithField("reason", failureCondition(err))
+		if job.PauseFor > 0 {
+			pauseLogger.WithField("delay", job.PauseFor).Errorf("CRONIC: Job failed %d times in a row, pausing it for %v", result.ConsecutiveFailures, job.PauseFor)
+		} else {
+			pauseLogger.Errorf("CRONIC: Job failed %d times in a row, pausing it until it's resumed", result.ConsecutiveFailures)
 		}
-	}()
+	}
+
+	j.cronIteration++
+
+	return result.WillRetry, delay, true
 }
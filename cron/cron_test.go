@@ -1,52 +1,54 @@
 package cron
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"sync"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/samgaw/cronic/crontab"
-	
-	"github.com/sirupsen/logrus"
+
 	"github.com/stretchr/testify/assert"
 )
 
-
 var (
 	TEST_CHANNEL_BUFFER_SIZE = 100
 )
 
-type testHook struct {
-	channel chan *logrus.Entry
+type testHandler struct {
+	channel chan *Entry
 }
 
-func newTestHook(channel chan *logrus.Entry) *testHook {
-	return &testHook{channel: channel}
+func (handler *testHandler) Enabled(crontab.Level) bool {
+	return true
 }
 
-func (hook *testHook) Fire(entry *logrus.Entry) error {
-	hook.channel <- entry
-	return nil
+func (handler *testHandler) Handle(entry *Entry) {
+	handler.channel <- entry
 }
 
-func (hook *testHook) Levels() []logrus.Level {
-	return logrus.AllLevels
-}
+type testHook chan *Entry
 
-func newTestLogger() (*logrus.Entry, chan *logrus.Entry) {
-	logger := logrus.New()
-	logger.Out = ioutil.Discard
-	logger.Level = logrus.DebugLevel
+func (hook testHook) Fire(entry *Entry) error {
+	hook <- entry
+	return nil
+}
 
-	channel := make(chan *logrus.Entry, TEST_CHANNEL_BUFFER_SIZE)
-	hook := newTestHook(channel)
-	logger.Hooks.Add(hook)
+func newTestLogger() (*Logger, chan *Entry) {
+	channel := make(chan *Entry, TEST_CHANNEL_BUFFER_SIZE)
+	return NewLogger(&testHandler{channel: channel}), channel
+}
 
-	return logger.WithFields(logrus.Fields{}), channel
+func newTestStatus(command string) *JobStatus {
+	return NewJobStatus(&crontab.Job{CrontabLine: crontab.CrontabLine{Command: command}})
 }
 
 type testExpression struct {
@@ -63,41 +65,43 @@ var (
 		Environ: map[string]string{},
 	}
 
-	noData     logrus.Fields = logrus.Fields{}
-	stdoutData               = logrus.Fields{"channel": "stdout"}
-	stderrData               = logrus.Fields{"channel": "stderr"}
+	basicOptions = Options{}
+
+	noData     Fields = Fields{}
+	stdoutData        = Fields{"channel": "stdout"}
+	stderrData        = Fields{"channel": "stderr"}
 )
 
 var runJobTestCases = []struct {
 	command  string
 	success  bool
 	context  *crontab.Context
-	messages []*logrus.Entry
+	messages []*Entry
 }{
 	{
 		"true", true, &basicContext,
-		[]*logrus.Entry{
-			{Message: "starting", Level: logrus.InfoLevel, Data: noData},
+		[]*Entry{
+			{Message: "starting", Level: crontab.LevelInfo, Data: noData},
 		},
 	},
 	{
 		"false", false, &basicContext,
-		[]*logrus.Entry{
-			{Message: "starting", Level: logrus.InfoLevel, Data: noData},
+		[]*Entry{
+			{Message: "starting", Level: crontab.LevelInfo, Data: noData},
 		},
 	},
 	{
 		"echo hello", true, &basicContext,
-		[]*logrus.Entry{
-			{Message: "starting", Level: logrus.InfoLevel, Data: noData},
-			{Message: "hello", Level: logrus.InfoLevel, Data: stdoutData},
+		[]*Entry{
+			{Message: "starting", Level: crontab.LevelInfo, Data: noData},
+			{Message: "hello", Level: crontab.LevelInfo, Data: stdoutData},
 		},
 	},
 	{
 		"echo hello >&2", true, &basicContext,
-		[]*logrus.Entry{
-			{Message: "starting", Level: logrus.InfoLevel, Data: noData},
-			{Message: "hello", Level: logrus.InfoLevel, Data: stderrData},
+		[]*Entry{
+			{Message: "starting", Level: crontab.LevelInfo, Data: noData},
+			{Message: "hello", Level: crontab.LevelInfo, Data: stderrData},
 		},
 	},
 	{
@@ -106,9 +110,9 @@ var runJobTestCases = []struct {
 			Shell:   "/bin/sh",
 			Environ: map[string]string{"FOO": "BAR"},
 		},
-		[]*logrus.Entry{
-			{Message: "starting", Level: logrus.InfoLevel, Data: noData},
-			{Message: "BAR", Level: logrus.InfoLevel, Data: stdoutData},
+		[]*Entry{
+			{Message: "starting", Level: crontab.LevelInfo, Data: noData},
+			{Message: "BAR", Level: crontab.LevelInfo, Data: stdoutData},
 		},
 	},
 	{
@@ -117,27 +121,27 @@ var runJobTestCases = []struct {
 			Shell:   "/bin/false",
 			Environ: map[string]string{},
 		},
-		[]*logrus.Entry{
-			{Message: "starting", Level: logrus.InfoLevel, Data: noData},
+		[]*Entry{
+			{Message: "starting", Level: crontab.LevelInfo, Data: noData},
 		},
 	},
 	{
 		"echo hello\nsleep 0.1\necho bar >&2", true, &basicContext,
-		[]*logrus.Entry{
-			{Message: "starting", Level: logrus.InfoLevel, Data: noData},
-			{Message: "hello", Level: logrus.InfoLevel, Data: stdoutData},
-			{Message: "bar", Level: logrus.InfoLevel, Data: stderrData},
+		[]*Entry{
+			{Message: "starting", Level: crontab.LevelInfo, Data: noData},
+			{Message: "hello", Level: crontab.LevelInfo, Data: stdoutData},
+			{Message: "bar", Level: crontab.LevelInfo, Data: stderrData},
 		},
 	},
 	{
 		fmt.Sprintf("python -c 'print(\"a\" * %d * 3)'", READ_BUFFER_SIZE), true, &basicContext,
-		[]*logrus.Entry{
-			{Message: "starting", Level: logrus.InfoLevel, Data: noData},
-			{Message: strings.Repeat("a", READ_BUFFER_SIZE), Level: logrus.InfoLevel, Data: stdoutData},
-			{Message: "last line exceeded buffer size, continuing...", Level: logrus.WarnLevel, Data: stdoutData},
-			{Message: strings.Repeat("a", READ_BUFFER_SIZE), Level: logrus.InfoLevel, Data: stdoutData},
-			{Message: "last line exceeded buffer size, continuing...", Level: logrus.WarnLevel, Data: stdoutData},
-			{Message: strings.Repeat("a", READ_BUFFER_SIZE), Level: logrus.InfoLevel, Data: stdoutData},
+		[]*Entry{
+			{Message: "starting", Level: crontab.LevelInfo, Data: noData},
+			{Message: strings.Repeat("a", READ_BUFFER_SIZE), Level: crontab.LevelInfo, Data: stdoutData},
+			{Message: "last line exceeded buffer size, continuing...", Level: crontab.LevelWarn, Data: stdoutData},
+			{Message: strings.Repeat("a", READ_BUFFER_SIZE), Level: crontab.LevelInfo, Data: stdoutData},
+			{Message: "last line exceeded buffer size, continuing...", Level: crontab.LevelWarn, Data: stdoutData},
+			{Message: strings.Repeat("a", READ_BUFFER_SIZE), Level: crontab.LevelInfo, Data: stdoutData},
 		},
 	},
 }
@@ -147,7 +151,7 @@ func TestRunJob(t *testing.T) {
 		label := fmt.Sprintf("RunJob(%q)", tt.command)
 		logger, channel := newTestLogger()
 
-		err := runJob(tt.context, tt.command, logger)
+		err := runJob(context.Background(), tt.context, &basicOptions, newTestStatus(tt.command), logger)
 		if tt.success {
 			assert.Nil(t, err, label)
 		} else {
@@ -163,7 +167,7 @@ func TestRunJob(t *testing.T) {
 
 			select {
 			case entry := <-channel:
-				var expected *logrus.Entry
+				var expected *Entry
 				expected, tt.messages = tt.messages[0], tt.messages[1:]
 				assert.Equal(t, expected.Message, entry.Message, label)
 				assert.Equal(t, expected.Level, entry.Level, label)
@@ -176,6 +180,64 @@ func TestRunJob(t *testing.T) {
 	}
 }
 
+func TestRunJobRunsInHome(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cronic-home")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	dir, err = filepath.EvalSymlinks(dir)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	cronCtx := &crontab.Context{Shell: "/bin/sh", Environ: map[string]string{"HOME": dir}, Home: dir}
+
+	logger, channel := newTestLogger()
+	assert.Nil(t, runJob(context.Background(), cronCtx, &basicOptions, newTestStatus("pwd"), logger))
+	expectMessages(t, channel, "Starting", "^"+regexp.QuoteMeta(dir)+"$")
+
+	// The job's own directory wins
+	status := newTestStatus("pwd")
+	status.Job.Dir = "/"
+
+	assert.Nil(t, runJob(context.Background(), cronCtx, &basicOptions, status, logger))
+	expectMessages(t, channel, "Starting", "^/$")
+}
+
+func TestRunJobLooksUpShellInPath(t *testing.T) {
+	cronCtx := &crontab.Context{Shell: "sh", Environ: map[string]string{"PATH": "/usr/bin:/bin"}}
+
+	logger, channel := newTestLogger()
+	assert.Nil(t, runJob(context.Background(), cronCtx, &basicOptions, newTestStatus("echo hello"), logger))
+	expectMessages(t, channel, "Starting", "^hello$")
+
+	cronCtx = &crontab.Context{Shell: "no-such-shell", Environ: map[string]string{"PATH": "/usr/bin:/bin"}}
+	_, ok := runJob(context.Background(), cronCtx, &basicOptions, newTestStatus("echo hello"), logger).(*StartError)
+	assert.True(t, ok)
+}
+
+func TestRunJobRunsAsUser(t *testing.T) {
+	current, err := user.Current()
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	// Running as cronic's own user doesn't need any privileges
+	status := newTestStatus("echo $USER $LOGNAME")
+	status.Job.User = current.Username
+
+	logger, channel := newTestLogger()
+	assert.Nil(t, runJob(context.Background(), &basicContext, &basicOptions, status, logger))
+	expectMessages(t, channel, "Starting", "^"+regexp.QuoteMeta(current.Username+" "+current.Username)+"$")
+
+	status = newTestStatus("true")
+	status.Job.User = "no-such-user"
+	_, ok := runJob(context.Background(), &basicContext, &basicOptions, status, logger).(*StartError)
+	assert.True(t, ok)
+}
+
 func TestStartJobExitsOnRequest(t *testing.T) {
 	job := crontab.Job{
 		CrontabLine: crontab.CrontabLine{
@@ -186,14 +248,14 @@ func TestStartJobExitsOnRequest(t *testing.T) {
 		Position: 1,
 	}
 
-	exitChan := make(chan interface{}, 1)
-	exitChan <- nil
+	ctx, stop := context.WithCancel(context.Background())
+	stop()
 
 	logger, _ := newTestLogger()
 
 	var wg sync.WaitGroup
 
-	StartJob(&wg, &basicContext, &job, exitChan, logger)
+	StartJob(ctx, &wg, &basicContext, &basicOptions, NewJobStatus(&job), logger)
 
 	wg.Wait()
 }
@@ -208,13 +270,13 @@ func TestStartJobRunsJob(t *testing.T) {
 		Position: 1,
 	}
 
-	exitChan := make(chan interface{}, 1)
+	ctx, stop := context.WithCancel(context.Background())
 
 	var wg sync.WaitGroup
 
 	logger, channel := newTestLogger()
 
-	StartJob(&wg, &basicContext, &job, exitChan, logger)
+	StartJob(ctx, &wg, &basicContext, &basicOptions, NewJobStatus(&job), logger)
 
 	select {
 	case entry := <-channel:
@@ -258,6 +320,802 @@ func TestStartJobRunsJob(t *testing.T) {
 		t.Fatalf("timed out waiting for second success")
 	}
 
-	exitChan <- nil
+	stop()
+	wg.Wait()
+}
+
+func expectMessages(t *testing.T, channel chan *Entry, messages ...string) {
+	for _, message := range messages {
+		select {
+		case entry := <-channel:
+			assert.Regexp(t, regexp.MustCompile(message), entry.Message)
+		case <-time.After(3 * time.Second):
+			t.Fatalf("timed out waiting for %q", message)
+		}
+	}
+}
+
+func TestStartJobRunsTriggeredJob(t *testing.T) {
+	job := crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: &testExpression{time.Minute},
+			Schedule:   "always!",
+			Command:    "echo triggered",
+		},
+		Position: 1,
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+
+	logger, channel := newTestLogger()
+	status := NewJobStatus(&job)
+
+	StartJob(ctx, &wg, &basicContext, &basicOptions, status, logger)
+	assert.Nil(t, status.Trigger())
+
+	expectMessages(t, channel,
+		"Job will run next",
+		"Job triggered manually",
+		"Starting",
+		"triggered",
+		"Job succeeded",
+		"Job will run next",
+	)
+
+	snapshot := status.Snapshot()
+	assert.False(t, snapshot.Running)
+	if assert.NotNil(t, snapshot.LastResult) {
+		assert.True(t, snapshot.LastResult.Success)
+	}
+
+	output := status.Output()
+	if assert.Equal(t, 1, len(output)) {
+		assert.Equal(t, "triggered", output[0].Line)
+		assert.Equal(t, "stdout", output[0].Channel)
+	}
+
+	stop()
+	wg.Wait()
+}
+
+func TestStartJobSkipsPausedJob(t *testing.T) {
+	job := crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: &testExpression{100 * time.Millisecond},
+			Schedule:   "always!",
+			Command:    "true",
+		},
+		Position: 1,
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+
+	logger, channel := newTestLogger()
+	status := NewJobStatus(&job)
+	status.Pause()
+
+	StartJob(ctx, &wg, &basicContext, &basicOptions, status, logger)
+
+	expectMessages(t, channel,
+		"Job will run next",
+		"Job is paused, skipping run",
+		"Job will run next",
+	)
+
+	assert.Nil(t, status.Snapshot().LastResult)
+
+	stop()
+	wg.Wait()
+}
+
+func TestStartJobSkipsRunsInBlackout(t *testing.T) {
+	blackout, err := crontab.ParseBlackout("00:00-24:00")
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	job := crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: &testExpression{100 * time.Millisecond},
+			Schedule:   "always!",
+			Command:    "true",
+		},
+		Position: 1,
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+
+	logger, channel := newTestLogger()
+	status := NewJobStatus(&job)
+
+	StartJob(ctx, &wg, &basicContext, &Options{Blackout: NewGlobalBlackout(blackout)}, status, logger)
+
+	expectMessages(t, channel,
+		"Job will run next",
+		"Run falls in a blackout window, skipping it",
+		"Job will run next",
+	)
+
+	assert.Nil(t, status.Snapshot().LastResult)
+
+	stop()
+	wg.Wait()
+}
+
+func TestStartJobSkipsRunsOnHolidays(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cronic-holidays")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// Tomorrow too, in case the test runs at midnight
+	path := filepath.Join(dir, "holidays")
+	now := time.Now()
+	assert.Nil(t, ioutil.WriteFile(path, []byte(now.Format("2006-01-02")+"\n"+now.AddDate(0, 0, 1).Format("2006-01-02")+"\n"), 0644))
+
+	holidays, err := crontab.ReadHolidays(path)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	job := crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: &testExpression{100 * time.Millisecond},
+			Schedule:   "always!",
+			Command:    "true",
+		},
+		Position:     1,
+		SkipHolidays: true,
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+
+	logger, channel := newTestLogger()
+	status := NewJobStatus(&job)
+
+	StartJob(ctx, &wg, &basicContext, &Options{Holidays: holidays}, status, logger)
+
+	expectMessages(t, channel,
+		"Job will run next",
+		"Run falls on a holiday, skipping it",
+		"Job will run next",
+	)
+
+	assert.Nil(t, status.Snapshot().LastResult)
+
+	stop()
+	wg.Wait()
+}
+
+func TestStartJobLogsDecisions(t *testing.T) {
+	job := crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: &testExpression{100 * time.Millisecond},
+			Schedule:   "always!",
+			Command:    "true",
+		},
+		Position: 1,
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+
+	logger, channel := newTestLogger()
+	status := NewJobStatus(&job)
+	status.Pause()
+
+	StartJob(ctx, &wg, &basicContext, &basicOptions, status, logger)
+
+	var schedule, skip *Entry
+	for _, entry := range []**Entry{&schedule, &skip} {
+		select {
+		case *entry = <-channel:
+		case <-time.After(3 * time.Second):
+			t.Fatalf("timed out waiting for decisions")
+		}
+	}
+
+	assert.Equal(t, crontab.LevelDebug, schedule.Level)
+	assert.Equal(t, DecisionSchedule, schedule.Data["decision"])
+	if delay, ok := schedule.Data["delay"].(time.Duration); assert.True(t, ok) {
+		assert.True(t, delay > 0 && delay <= 100*time.Millisecond)
+	}
+
+	assert.Equal(t, DecisionSkip, skip.Data["decision"])
+	assert.Equal(t, SkipReasonPaused, skip.Data["reason"])
+	assert.Equal(t, schedule.Data["tick"], skip.Data["tick"])
+
+	stop()
+	wg.Wait()
+}
+
+// neverExpression has no runs left, like a calendar whose dates have passed.
+type neverExpression struct{}
+
+func (expr *neverExpression) Next(t time.Time) time.Time {
+	return time.Time{}
+}
+
+func TestStartJobWaitsForTriggerWhenScheduleIsOver(t *testing.T) {
+	job := crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: &neverExpression{},
+			Schedule:   "never!",
+			Command:    "echo triggered",
+		},
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+
+	logger, channel := newTestLogger()
+	status := NewJobStatus(&job)
+
+	StartJob(ctx, &wg, &basicContext, &basicOptions, status, logger)
+
+	expectMessages(t, channel, "Job will not run again")
+	assert.Nil(t, status.Snapshot().NextRun)
+
+	assert.Nil(t, status.Trigger())
+	expectMessages(t, channel, "Job triggered manually", "Starting", "triggered", "Job succeeded", "Job will not run again")
+
+	stop()
+	wg.Wait()
+}
+
+func TestTriggerDoesNotOverlapRuns(t *testing.T) {
+	status := NewJobStatus(&crontab.Job{})
+
+	status.startRun(0)
+	assert.Equal(t, ErrJobRunning, status.Trigger())
+
+	status.finishRun(nil, nil, "")
+	assert.Nil(t, status.Trigger())
+	assert.Equal(t, ErrRunPending, status.Trigger())
+}
+
+func TestRunJobPrependsPath(t *testing.T) {
+	logger, channel := newTestLogger()
+
+	status := newTestStatus("echo $PATH")
+	status.Job.PathPrepend = "/opt/app/bin"
+
+	cronCtx := &crontab.Context{
+		Shell:   "/bin/sh",
+		Environ: map[string]string{"PATH": "/usr/bin:/bin"},
+	}
+
+	assert.Nil(t, runJob(context.Background(), cronCtx, &basicOptions, status, logger))
+	expectMessages(t, channel, "Starting", "^/opt/app/bin:/usr/bin:/bin$")
+}
+
+func TestRunJobPropagatesTraceContext(t *testing.T) {
+	logger, channel := newTestLogger()
+
+	status := newTestStatus("echo $TRACEPARENT")
+	status.startRun(1)
+
+	opts := basicOptions
+	opts.PropagateTraceContext = true
+
+	assert.Nil(t, runJob(context.Background(), &basicContext, &opts, status, logger))
+	expectMessages(t, channel, "Starting", "^00-[0-9a-f]{32}-[0-9a-f]{16}-01$")
+
+	result := status.finishRun(nil, nil, "")
+	assert.Equal(t, fmt.Sprintf("00-%s-%s-01", result.TraceID, result.SpanID), status.traceParent())
+}
+
+func TestRunJobUsesJobEnvironAndDir(t *testing.T) {
+	logger, channel := newTestLogger()
+
+	status := newTestStatus("echo $GREETING; pwd")
+	status.Job.Environ = map[string]string{"GREETING": "hello"}
+	status.Job.Dir = "/"
+
+	assert.Nil(t, runJob(context.Background(), &basicContext, &basicOptions, status, logger))
+	expectMessages(t, channel, "Starting", "^hello$", "^/$")
+}
+
+func TestRunJobUsesJobShell(t *testing.T) {
+	logger, channel := newTestLogger()
+
+	status := newTestStatus("hello")
+	status.Job.Shell = "/bin/echo"
+
+	assert.Nil(t, runJob(context.Background(), &basicContext, &basicOptions, status, logger))
+	expectMessages(t, channel, "Starting", "^-c hello$")
+}
+
+func TestRunJobExecsWithoutShell(t *testing.T) {
+	logger, channel := newTestLogger()
+
+	status := newTestStatus("exec: echo '$HOME; exit 1'")
+	status.Job.Argv = []string{"echo", "$HOME; exit 1"}
+
+	assert.Nil(t, runJob(context.Background(), &basicContext, &basicOptions, status, logger))
+	expectMessages(t, channel, "Starting", `^\$HOME; exit 1$`)
+
+	status.Job.Argv = []string{"no-such-command"}
+	err := runJob(context.Background(), &basicContext, &basicOptions, status, logger)
+	assert.Equal(t, crontab.FailureSpawn, failureCondition(err))
+}
+
+func TestRunJobChecksExpectedOutput(t *testing.T) {
+	type testCase struct {
+		command string
+		output  string
+		match   string
+		err     string
+	}
+
+	testCases := []testCase{
+		{"echo 'Backed up 12 rows'", "Backed up", "", ""},
+		{"echo 'Backed up 12 rows' >&2", "", "^Backed up [0-9]+ rows$", ""},
+		{"echo Backed up; echo 12 rows", "Backed up", "^[0-9]+ rows$", ""},
+		{"echo Nothing to do", "Backed up", "", `^CRONIC: Job output has no line containing "Backed up"$`},
+		{"echo Backed up", "Backed up", "[0-9]+ rows", `^CRONIC: Job output has no line matching "\[0-9\]\+ rows"$`},
+		{"echo Backed up; exit 1", "Backed up", "", "^CRONIC: Error running command: exit status 1$"},
+	}
+
+	for _, tc := range testCases {
+		logger, _ := newTestLogger()
+
+		status := newTestStatus(tc.command)
+		status.Job.ExpectOutput = tc.output
+		if tc.match != "" {
+			status.Job.ExpectOutputMatch = regexp.MustCompile(tc.match)
+		}
+
+		err := runJob(context.Background(), &basicContext, &basicOptions, status, logger)
+		if tc.err == "" {
+			assert.Nil(t, err, tc.command)
+			continue
+		}
+
+		if assert.NotNil(t, err, tc.command) {
+			assert.Regexp(t, tc.err, err.Error())
+		}
+	}
+
+	status := newTestStatus("true")
+	status.Job.ExpectOutput = "done"
+
+	logger, _ := newTestLogger()
+	err := runJob(context.Background(), &basicContext, &basicOptions, status, logger)
+	assert.Equal(t, crontab.FailureOutput, failureCondition(err))
+
+	code, ok := exitCode(err)
+	assert.True(t, ok)
+	assert.Equal(t, 0, code)
+}
+
+func TestRunJobHandlesLongLines(t *testing.T) {
+	defer func(size int, policy string) {
+		READ_BUFFER_SIZE = size
+		LONG_LINE_POLICY = policy
+	}(READ_BUFFER_SIZE, LONG_LINE_POLICY)
+
+	READ_BUFFER_SIZE = 16
+
+	zeroes := strings.Repeat("0", 16)
+	testCases := map[string][]string{
+		LongLineSplit: {
+			"^" + zeroes + "$", "exceeded buffer size",
+			"^" + zeroes + "$", "exceeded buffer size",
+			"^00000000$",
+		},
+		LongLineTruncate: {
+			"^" + zeroes + ` \[truncated\]$`,
+			`^CRONIC: Line exceeded buffer size \(16 bytes\), truncated it$`,
+		},
+		LongLineDrop: {
+			`^CRONIC: Line exceeded buffer size \(16 bytes\), dropped it$`,
+		},
+	}
+
+	for policy, messages := range testCases {
+		LONG_LINE_POLICY = policy
+
+		logger, channel := newTestLogger()
+		status := newTestStatus("printf 'short\\n%040d\\nafter\\n' 0")
+
+		assert.Nil(t, runJob(context.Background(), &basicContext, &basicOptions, status, logger), policy)
+
+		expected := append([]string{"Starting", "^short$"}, messages...)
+		expectMessages(t, channel, append(expected, "^after$")...)
+	}
+}
+
+func TestParseLongLinePolicy(t *testing.T) {
+	for _, policy := range []string{LongLineSplit, LongLineTruncate, LongLineDrop} {
+		parsed, err := ParseLongLinePolicy(policy)
+		assert.Nil(t, err)
+		assert.Equal(t, policy, parsed)
+	}
+
+	_, err := ParseLongLinePolicy("wrap")
+	assert.NotNil(t, err)
+}
+
+func TestRunJobCapsOutput(t *testing.T) {
+	logger, channel := newTestLogger()
+
+	// Each line is 6 bytes, with its newline
+	status := newTestStatus("for i in 1 2 3 4 5; do echo line$i; done")
+	status.Job.MaxOutput = 15
+
+	assert.Nil(t, runJob(context.Background(), &basicContext, &basicOptions, status, logger))
+	expectMessages(t, channel,
+		"Starting", "^line1$", "^line2$",
+		`^CRONIC: Job output exceeds max-output \(15 bytes\), not logging the rest$`,
+		`^CRONIC: Didn't log 3 lines \(18 bytes\) of output over max-output$`,
+	)
+
+	// The output is still recorded
+	assert.Len(t, status.outputTail(10), 5)
+}
+
+func TestRunJobThrottlesOutput(t *testing.T) {
+	logger, channel := newTestLogger()
+
+	status := newTestStatus("seq 30")
+	status.Job.OutputRateLimit = 20
+
+	opts := basicOptions
+	opts.OutputRateLimit = 1000
+
+	start := time.Now()
+	assert.Nil(t, runJob(context.Background(), &basicContext, &opts, status, logger))
+
+	// The first 20 lines are a burst, and the next 10 are spaced by 50ms
+	assert.True(t, time.Since(start) >= 450*time.Millisecond, "Output wasn't throttled")
+
+	messages := []string{"Starting"}
+	for i := 1; i <= 30; i++ {
+		if i == 21 {
+			messages = append(messages, "^CRONIC: Job emits more than 20 lines of output per second, throttling it$")
+		}
+		messages = append(messages, fmt.Sprintf("^%d$", i))
+	}
+	expectMessages(t, channel, messages...)
+}
+
+func TestRunJobLimitsLoggedOutput(t *testing.T) {
+	logger, channel := newTestLogger()
+
+	status := newTestStatus("seq 30")
+	status.Job.LogRateLimit = 1
+	status.Job.LogSample = 2
+
+	opts := basicOptions
+	opts.LogBurst = 5
+
+	start := time.Now()
+	assert.Nil(t, runJob(context.Background(), &basicContext, &opts, status, logger))
+
+	// The job isn't slowed down
+	assert.True(t, time.Since(start) < 500*time.Millisecond, "Output was throttled")
+
+	// One in two lines is sampled, and the first 5 of those are a burst
+	expectMessages(t, channel,
+		"Starting", "^1$", "^3$", "^5$", "^7$", "^9$",
+		"^CRONIC: Job logs more than 1 lines of output per second, not logging some of them$",
+		`^CRONIC: Didn't log 25 lines of output \(15 sampled out, 10 over log-rate-limit\)$`,
+	)
+
+	// The output is still recorded
+	assert.Len(t, status.outputTail(30), 30)
+}
+
+func TestRunJobFeedsStdin(t *testing.T) {
+	logger, channel := newTestLogger()
+
+	status := newTestStatus("tr a-z A-Z")
+	status.Job.Stdin = "hello\nworld\n"
+
+	assert.Nil(t, runJob(context.Background(), &basicContext, &basicOptions, status, logger))
+	expectMessages(t, channel, "Starting", "^HELLO$", "^WORLD$")
+}
+
+func TestRunJobFeedsStdinFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cronic-stdin")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	if !assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "answers"), []byte("yes\n"), 0644)) {
+		return
+	}
+
+	logger, channel := newTestLogger()
+
+	// Relative to the job's directory
+	status := newTestStatus("cat")
+	status.Job.Dir = dir
+	status.Job.StdinFile = "answers"
+
+	assert.Nil(t, runJob(context.Background(), &basicContext, &basicOptions, status, logger))
+	expectMessages(t, channel, "Starting", "^yes$")
+
+	status.Job.StdinFile = "missing"
+	err = runJob(context.Background(), &basicContext, &basicOptions, status, logger)
+	if assert.NotNil(t, err) {
+		assert.Regexp(t, "^CRONIC: Failed to start command", err.Error())
+	}
+}
+
+func TestRunJobTimesOut(t *testing.T) {
+	logger, _ := newTestLogger()
+
+	// The child keeps the output open: it must be killed too
+	status := newTestStatus("sleep 10 & sleep 10")
+	status.Job.Timeout = 100 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), status.Job.Timeout)
+	defer cancel()
+
+	started := time.Now()
+	err := runJob(ctx, &basicContext, &basicOptions, status, logger)
+	assert.True(t, time.Since(started) < 5*time.Second)
+
+	if assert.NotNil(t, err) {
+		assert.True(t, timedOut(err))
+		assert.Equal(t, crontab.FailureTimeout, failureCondition(err))
+		assert.Regexp(t, "^CRONIC: Job timed out after 100ms", err.Error())
+	}
+}
+
+func TestRunJobStopsProcessGroup(t *testing.T) {
+	defer func(grace time.Duration) {
+		KILL_GRACE_PERIOD = grace
+	}(KILL_GRACE_PERIOD)
+
+	KILL_GRACE_PERIOD = 200 * time.Millisecond
+
+	type testCase struct {
+		name    string
+		command string
+		output  []string
+		killed  bool
+	}
+
+	testCases := []testCase{
+		{"stops on SIGTERM", "trap 'echo stopping; exit 0' TERM; sleep 10 & wait", []string{"^stopping$"}, false},
+		{"ignores SIGTERM", "trap '' TERM; sleep 10", nil, true},
+		{"child ignores SIGTERM", "(trap '' TERM; sleep 10) & wait", nil, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger, channel := newTestLogger()
+
+			status := newTestStatus(tc.command)
+			status.Job.Timeout = 100 * time.Millisecond
+
+			ctx, cancel := context.WithTimeout(context.Background(), status.Job.Timeout)
+			defer cancel()
+
+			started := time.Now()
+			err := runJob(ctx, &basicContext, &basicOptions, status, logger)
+			elapsed := time.Since(started)
+
+			assert.True(t, elapsed < 5*time.Second)
+			if tc.killed {
+				assert.True(t, elapsed >= status.Job.Timeout+KILL_GRACE_PERIOD, elapsed.String())
+			}
+
+			if assert.NotNil(t, err) {
+				assert.True(t, timedOut(err))
+				assert.Regexp(t, "^CRONIC: Job timed out after 100ms", err.Error())
+			}
+
+			expectMessages(t, channel, append([]string{"Starting"}, tc.output...)...)
+		})
+	}
+}
+
+func TestRunJobSendsCheckpointSignal(t *testing.T) {
+	logger, channel := newTestLogger()
+
+	status := newTestStatus("trap 'echo checkpoint; exit 0' USR1; while true; do :; done")
+	status.Job.Timeout = time.Second
+	status.Job.CheckpointSignal = syscall.SIGUSR1
+	status.Job.CheckpointGrace = 800 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), status.Job.Timeout)
+	defer cancel()
+
+	assert.Nil(t, runJob(ctx, &basicContext, &basicOptions, status, logger))
+	expectMessages(t, channel, "Starting", "^CRONIC: Job is about to time out, sending user defined signal 1$", "^checkpoint$")
+}
+
+func TestRunJobForwardsSignals(t *testing.T) {
+	logger, channel := newTestLogger()
+
+	status := newTestStatus("trap 'echo signalled; exit 0' USR1; echo ready; while true; do :; done")
+	assert.Equal(t, ErrNotRunning, status.Signal(syscall.SIGUSR1))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- runJob(context.Background(), &basicContext, &basicOptions, status, logger)
+	}()
+
+	expectMessages(t, channel, "Starting", "^ready$")
+	assert.Nil(t, status.Signal(syscall.SIGUSR1))
+	expectMessages(t, channel, "^signalled$")
+
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(3 * time.Second):
+		t.Fatalf("job did not exit")
+	}
+
+	assert.Equal(t, ErrNotRunning, status.Signal(syscall.SIGUSR1))
+}
+
+func TestStartJobCancelsRuns(t *testing.T) {
+	job := crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: &testExpression{time.Hour},
+			Schedule:   "always!",
+			Command:    "sleep 10",
+		},
+		Retry: &crontab.RetryPolicy{Retries: 1},
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+
+	logger, _ := newTestLogger()
+	status := NewJobStatus(&job)
+
+	assert.Equal(t, ErrNotRunning, status.Cancel())
+
+	StartJob(ctx, &wg, &basicContext, &basicOptions, status, logger)
+	assert.Nil(t, status.Trigger())
+
+	waitFor(t, "the job to run", func() bool { return status.Snapshot().Running })
+	assert.Nil(t, status.Cancel())
+
+	waitFor(t, "the run to be cancelled", func() bool { return status.Snapshot().LastResult != nil })
+
+	result := status.Snapshot().LastResult
+	assert.False(t, result.Success)
+	assert.False(t, result.WillRetry)
+	assert.Regexp(t, "^CRONIC: Run cancelled", result.Error)
+
+	stop()
 	wg.Wait()
 }
+
+func TestRunJobUsesOutputLevels(t *testing.T) {
+	logger, channel := newTestLogger()
+
+	stdoutLevel, stderrLevel := crontab.LevelDebug, crontab.LevelError
+	status := newTestStatus("echo out; sleep 0.1; echo err >&2")
+	status.Job.StdoutLevel = &stdoutLevel
+	status.Job.StderrLevel = &stderrLevel
+
+	assert.Nil(t, runJob(context.Background(), &basicContext, &basicOptions, status, logger))
+
+	for _, expected := range []*Entry{
+		{Message: "CRONIC: Starting", Level: crontab.LevelInfo, Data: noData},
+		{Message: "out", Level: crontab.LevelDebug, Data: stdoutData},
+		{Message: "err", Level: crontab.LevelError, Data: stderrData},
+	} {
+		select {
+		case entry := <-channel:
+			assert.Equal(t, expected.Message, entry.Message)
+			assert.Equal(t, expected.Level, entry.Level)
+			assert.Equal(t, expected.Data, entry.Data)
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %q", expected.Message)
+		}
+	}
+}
+
+func TestRunJobQuiet(t *testing.T) {
+	logger, channel := newTestLogger()
+
+	status := newTestStatus("echo out; echo err >&2")
+	status.Job.Quiet = true
+
+	assert.Nil(t, runJob(context.Background(), &basicContext, &basicOptions, status, logger))
+
+	select {
+	case entry := <-channel:
+		assert.Equal(t, "CRONIC: Starting", entry.Message)
+		assert.Equal(t, crontab.LevelDebug, entry.Level)
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for start")
+	}
+
+	assert.Equal(t, 0, len(channel))
+	assert.Equal(t, 2, len(status.Output()))
+}
+
+func TestStartJobReportsFailures(t *testing.T) {
+	job := crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: &testExpression{time.Minute},
+			Schedule:   "always!",
+			Command:    "echo a; echo b; sleep 0.1; echo c >&2; exit 1",
+		},
+		DebugCommand: "echo debugging",
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+
+	logger, channel := newTestLogger()
+	status := NewJobStatus(&job)
+
+	StartJob(ctx, &wg, &basicContext, &Options{FailureTailLines: 2}, status, logger)
+	assert.Nil(t, status.Trigger())
+
+	expectMessages(t, channel, "Job will run next", "Job triggered manually", "Starting", "^a$", "^b$", "^c$")
+
+	select {
+	case entry := <-channel:
+		assert.Equal(t, crontab.LevelError, entry.Level)
+		assert.Regexp(t, regexp.MustCompile("Error running command"), entry.Message)
+		assert.Equal(t, "[stdout] b\n[stderr] c", entry.Data["output_tail"])
+		assert.Equal(t, "debugging\n", entry.Data["debug_output"])
+	case <-time.After(3 * time.Second):
+		t.Fatalf("timed out waiting for failure report")
+	}
+
+	expectMessages(t, channel, "Job will run next")
+
+	if result := status.Snapshot().LastResult; assert.NotNil(t, result) {
+		assert.Equal(t, 2, len(result.OutputTail))
+		assert.Equal(t, 3, result.OutputLines)
+		if assert.NotNil(t, result.ExitCode) {
+			assert.Equal(t, 1, *result.ExitCode)
+		}
+	}
+
+	stop()
+	wg.Wait()
+}
+
+func TestOutputTailOnlyIncludesCurrentRun(t *testing.T) {
+	status := newTestStatus("true")
+
+	status.startRun(0)
+	status.recordOutput("stdout", "first run")
+	status.finishRun(nil, nil, "")
+
+	status.startRun(1)
+	assert.Nil(t, status.outputTail(10))
+
+	status.recordOutput("stdout", "a")
+	status.recordOutput("stderr", "b")
+	status.recordOutput("stdout", "c")
+
+	tail := status.outputTail(10)
+	if assert.Equal(t, 3, len(tail)) {
+		assert.Equal(t, "a", tail[0].Line)
+	}
+
+	tail = status.outputTail(2)
+	if assert.Equal(t, 2, len(tail)) {
+		assert.Equal(t, "b", tail[0].Line)
+		assert.Equal(t, "stderr", tail[0].Channel)
+	}
+}
@@ -0,0 +1,77 @@
+package cron
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/samgaw/cronic/crontab"
+)
+
+var (
+	DEBUG_COMMAND_TIMEOUT      = 30 * time.Second
+	DEBUG_COMMAND_OUTPUT_LIMIT = 64 * 1024
+)
+
+// limitedBuffer keeps the first limit bytes written to it, and discards the
+// rest.
+type limitedBuffer struct {
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if room := b.limit - b.buf.Len(); len(p) > room {
+		b.buf.Write(p[:room])
+		b.truncated = true
+	} else {
+		b.buf.Write(p)
+	}
+
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.truncated {
+		return b.buf.String() + "\n[output truncated]"
+	}
+	return b.buf.String()
+}
+
+// runDebugCommand runs a job's debug command (used to help triage failures)
+// and returns its combined output. The command is stopped if it doesn't
+// complete within DEBUG_COMMAND_TIMEOUT.
+func runDebugCommand(cronCtx *crontab.Context, opts *Options, namespace *Namespace, job *crontab.Job) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DEBUG_COMMAND_TIMEOUT)
+	defer cancel()
+
+	env, err := opts.resolveSecrets(ctx, jobEnviron(cronCtx, opts, namespace, job))
+	if err != nil {
+		return "", fmt.Errorf("CRONIC: Error running debug command: %v", err)
+	}
+
+	command := &Command{
+		Shell:   jobShell(cronCtx, job),
+		Command: job.DebugCommand,
+		Env:     env,
+		Dir:     JobDir(cronCtx, job),
+	}
+
+	output := &limitedBuffer{limit: DEBUG_COMMAND_OUTPUT_LIMIT}
+
+	if err := opts.executor().Run(ctx, command, output, output); err != nil {
+		return output.String(), fmt.Errorf("CRONIC: Error running debug command: %v", err)
+	}
+
+	return output.String(), nil
+}
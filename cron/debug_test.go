@@ -0,0 +1,89 @@
+package cron
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunDebugCommand(t *testing.T) {
+	job := &crontab.Job{DebugCommand: "echo out; echo err >&2; exit 3"}
+
+	output, err := runDebugCommand(&basicContext, &basicOptions, nil, job)
+	assert.NotNil(t, err)
+	assert.Contains(t, output, "out\n")
+	assert.Contains(t, output, "err\n")
+}
+
+func TestRunDebugCommandTimesOut(t *testing.T) {
+	defer func(timeout time.Duration) { DEBUG_COMMAND_TIMEOUT = timeout }(DEBUG_COMMAND_TIMEOUT)
+	DEBUG_COMMAND_TIMEOUT = 100 * time.Millisecond
+
+	// The subshell keeps the output pipe open even if sh itself is killed
+	job := &crontab.Job{DebugCommand: "(sleep 10; echo late); echo never"}
+
+	done := make(chan struct{})
+	go func() {
+		_, err := runDebugCommand(&basicContext, &basicOptions, nil, job)
+		assert.NotNil(t, err)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("debug command did not time out")
+	}
+}
+
+func TestRunDebugCommandLimitsOutput(t *testing.T) {
+	job := &crontab.Job{DebugCommand: "yes | head -c 100000"}
+
+	output, err := runDebugCommand(&basicContext, &basicOptions, nil, job)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasSuffix(output, "[output truncated]"))
+	assert.True(t, len(output) < DEBUG_COMMAND_OUTPUT_LIMIT+100)
+}
+
+func TestStartJobRunsDebugCommandOnFailure(t *testing.T) {
+	job := crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: &testExpression{time.Minute},
+			Schedule:   "always!",
+			Command:    "false",
+		},
+		DebugCommand: "echo debugging",
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+
+	logger, channel := newTestLogger()
+	status := NewJobStatus(&job)
+
+	StartJob(ctx, &wg, &basicContext, &basicOptions, status, logger)
+	assert.Nil(t, status.Trigger())
+
+	expectMessages(t, channel,
+		"Job will run next",
+		"Job triggered manually",
+		"Starting",
+		"Error running command",
+		"Job will run next",
+	)
+
+	if result := status.Snapshot().LastResult; assert.NotNil(t, result) {
+		assert.False(t, result.Success)
+		assert.Equal(t, "debugging\n", result.DebugOutput)
+	}
+
+	stop()
+	wg.Wait()
+}
@@ -0,0 +1,67 @@
+package cron
+
+import (
+	"time"
+)
+
+// Decisions the scheduler makes about jobs. The log entries reporting them
+// have a "decision" field, as well as "tick" (the scheduled run the decision
+// is about), "reason" and "delay" when they apply, so that tools can follow
+// the scheduler from its logs (with debug logging enabled, since some are
+// only logged at debug level).
+const (
+	// The next run is scheduled (at tick, in delay)
+	DecisionSchedule = "schedule"
+
+	// The job runs outside of its schedule (reason is RunReasonManual)
+	DecisionRun = "run"
+
+	// The scheduled run is skipped (reason is one of the SkipReason*
+	// constants)
+	DecisionSkip = "skip"
+
+	// The failed run is retried (in delay, reason being the failure)
+	DecisionRetry = "retry"
+
+	// The next run is scheduled again, from now, because it's late
+	// (by delay), or because the clock jumped (reason is
+	// RescheduleReasonClock)
+	DecisionReschedule = "reschedule"
+
+	// The scheduled run waits for the blackout window it fell in to end (in
+	// delay)
+	DecisionDefer = "defer"
+
+	// The job is paused (reason being the failure that paused it)
+	DecisionPause = "pause"
+
+	// The job has no more scheduled runs, and waits for manual ones
+	DecisionWait = "wait"
+
+	// The job ran a single time ("@at" or "@once"), and won't run again (if
+	// it didn't, reason is DoneReasonPassed, or one of the SkipReason*
+	// constants)
+	DecisionDone = "done"
+
+	// The scheduler is shutting down
+	DecisionStop = "stop"
+)
+
+// The time of a job that runs a single time passed before it was scheduled
+const DoneReasonPassed = "passed"
+
+// The job was triggered manually (e.g. from the web dashboard)
+const RunReasonManual = "manual"
+
+// The wall clock jumped (see ClockWatcher)
+const RescheduleReasonClock = "clock"
+
+// decisionLogger returns a logger for entries reporting a decision about a
+// scheduled run (tick is zero if it isn't about one).
+func decisionLogger(logger *Logger, decision string, tick time.Time) *Logger {
+	fields := Fields{"decision": decision}
+	if !tick.IsZero() {
+		fields["tick"] = tick
+	}
+	return logger.WithFields(fields)
+}
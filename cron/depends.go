@@ -0,0 +1,57 @@
+package cron
+
+import (
+	"fmt"
+	"time"
+)
+
+var (
+	// How often a job checks whether the jobs it runs after are done
+	DEPENDENCY_POLL_INTERVAL = 100 * time.Millisecond
+)
+
+// checkDependencies returns whether the jobs the job runs after (see
+// crontab.Job.After) are done with their runs at tick (as scheduled, before
+// splay offsets), if they have one, and then an error unless their most
+// recent runs all succeeded. Jobs check again every
+// DEPENDENCY_POLL_INTERVAL until they are.
+func checkDependencies(status *JobStatus, tick time.Time) (bool, error) {
+	for _, name := range status.Job.After {
+		var dependency *JobStatus
+		if status.dependency != nil {
+			dependency = status.dependency(name)
+		}
+		if dependency == nil {
+			return true, fmt.Errorf("no job is named %q", name)
+		}
+
+		pending, lastResult := dependency.tickState(tick)
+		if pending {
+			return false, nil
+		}
+		if lastResult == nil {
+			return true, fmt.Errorf("job %q hasn't run yet", name)
+		}
+		if !lastResult.Success {
+			return true, fmt.Errorf("the last run of job %q failed", name)
+		}
+	}
+
+	return true, nil
+}
+
+// tickState returns whether the job's run at tick (as scheduled, before its
+// splay offset) is still to come (or in progress, including its retries),
+// and its most recent result.
+func (s *JobStatus) tickState(tick time.Time) (bool, *RunResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending := s.nextTick.Equal(tick)
+	if s.lastResult == nil {
+		return pending, nil
+	}
+
+	lastResult := *s.lastResult
+	return pending, &lastResult
+}
@@ -0,0 +1,93 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// alignedExpression runs jobs at multiples of period, so that jobs using it
+// run at the same times.
+type alignedExpression struct {
+	period time.Duration
+}
+
+func (expr *alignedExpression) Next(t time.Time) time.Time {
+	return t.Truncate(expr.period).Add(expr.period)
+}
+
+func TestStartJobWaitsForDependencies(t *testing.T) {
+	for _, tt := range []struct {
+		command string
+		runs    bool
+	}{
+		{"sleep 0.2", true},
+		{"sleep 0.2; false", false},
+	} {
+		logger, _ := newTestLogger()
+		registry := NewRegistry(&basicContext, &basicOptions, logger, nil)
+
+		dependency := newNamedTestJob("backup", tt.command)
+		dependency.Expression = &alignedExpression{time.Second}
+
+		// The dependent job comes first, but still waits
+		dependent := newTestJob("true")
+		dependent.Expression = &alignedExpression{time.Second}
+		dependent.After = []string{"backup"}
+
+		dependentStatus := registry.Add(dependent, false)
+		dependencyStatus := registry.Add(dependency, false)
+		registry.Start()
+
+		waitFor(t, "the dependency to run", func() bool {
+			return dependencyStatus.Snapshot().LastResult != nil
+		})
+
+		if tt.runs {
+			waitFor(t, "the dependent job to run", func() bool {
+				return dependentStatus.Snapshot().LastResult != nil
+			})
+			assert.False(t, dependentStatus.Snapshot().LastResult.StartedAt.Before(dependencyStatus.Snapshot().LastResult.FinishedAt), tt.command)
+		} else {
+			time.Sleep(2 * DEPENDENCY_POLL_INTERVAL)
+			assert.Nil(t, dependentStatus.Snapshot().LastResult, tt.command)
+		}
+
+		registry.Shutdown()
+	}
+}
+
+func TestStartJobWaitsForSplayedDependencies(t *testing.T) {
+	logger, _ := newTestLogger()
+	registry := NewRegistry(&basicContext, &basicOptions, logger, nil)
+
+	// The dependency runs later than the dependent job in each tick, but
+	// the dependent job still waits for it
+	dependency := newNamedTestJob("backup", "sleep 0.2")
+	dependency.Expression = &alignedExpression{time.Second}
+	dependency.Splay = 300 * time.Millisecond
+
+	dependent := newTestJob("true")
+	dependent.Expression = &alignedExpression{time.Second}
+	dependent.Splay = 50 * time.Millisecond
+	dependent.After = []string{"backup"}
+
+	dependentStatus := registry.Add(dependent, false)
+	dependencyStatus := registry.Add(dependency, false)
+	registry.Start()
+	defer registry.Shutdown()
+
+	waitFor(t, "the dependent job to run", func() bool {
+		return dependentStatus.Snapshot().LastResult != nil
+	})
+
+	// It ran right after the dependency's run of the same tick (rather than
+	// after the run of the previous tick)
+	dependentResult := dependentStatus.Snapshot().LastResult
+	dependencyResult := dependencyStatus.Snapshot().LastResult
+	if assert.NotNil(t, dependencyResult) {
+		assert.False(t, dependentResult.StartedAt.Before(dependencyResult.FinishedAt))
+		assert.True(t, dependentResult.StartedAt.Sub(dependencyResult.FinishedAt) < 400*time.Millisecond, "%v", dependentResult.StartedAt.Sub(dependencyResult.FinishedAt))
+	}
+}
@@ -0,0 +1,396 @@
+package cron
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/samgaw/cronic/crontab"
+)
+
+var (
+	// The Docker daemon to run the containers of jobs with (see
+	// DockerExecutor)
+	DOCKER_HOST = "unix:///var/run/docker.sock"
+
+	// The version of the Docker Engine API to use (that of Docker 19.03, so
+	// that older daemons are supported too)
+	DOCKER_API_VERSION = "v1.40"
+)
+
+// DockerExecutor runs commands in fresh containers (see Command.Image), with
+// a Docker daemon: each run creates a container, follows its output until it
+// exits, and removes it.
+type DockerExecutor struct {
+	// The daemon's address: unix:///PATH, or tcp://HOST:PORT (or
+	// http://HOST:PORT)
+	Host string
+
+	client *http.Client
+	url    string
+}
+
+func NewDockerExecutor(host string) (*DockerExecutor, error) {
+	executor := &DockerExecutor{Host: host}
+
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("CRONIC: Bad Docker host %q: %v", host, err)
+	}
+
+	switch u.Scheme {
+	case "unix":
+		path := u.Path
+		executor.client = &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var dialer net.Dialer
+					return dialer.DialContext(ctx, "unix", path)
+				},
+			},
+		}
+		executor.url = "http://docker"
+	case "tcp", "http":
+		executor.client = &http.Client{}
+		executor.url = "http://" + u.Host
+	default:
+		return nil, fmt.Errorf("CRONIC: Bad Docker host %q (expected unix:///PATH or tcp://HOST:PORT)", host)
+	}
+
+	executor.url += "/" + DOCKER_API_VERSION
+	return executor, nil
+}
+
+type dockerContainerConfig struct {
+	Image        string
+	Cmd          []string
+	Env          []string
+	User         string `json:",omitempty"`
+	AttachStdout bool
+	AttachStderr bool
+	Labels       map[string]string
+	HostConfig   dockerHostConfig
+}
+
+type dockerHostConfig struct {
+	Binds     []string       `json:",omitempty"`
+	Memory    int64          `json:",omitempty"`
+	NanoCpus  int64          `json:",omitempty"`
+	Ulimits   []dockerUlimit `json:",omitempty"`
+	LogConfig struct {
+		Type string
+	}
+}
+
+type dockerUlimit struct {
+	Name string
+	Soft int
+	Hard int
+}
+
+func (d *DockerExecutor) Run(ctx context.Context, command *Command, stdout io.Writer, stderr io.Writer) error {
+	if command.Stdin != "" || command.StdinFile != "" {
+		return &StartError{fmt.Errorf("commands run in containers can't have a stdin")}
+	}
+
+	if err := d.pull(ctx, command.Image, command.ImagePull); err != nil {
+		return &StartError{err}
+	}
+
+	config := dockerContainerConfig{
+		Image:        command.Image,
+		Cmd:          command.Argv,
+		Env:          command.Env,
+		User:         command.User,
+		AttachStdout: true,
+		AttachStderr: true,
+		Labels:       map[string]string{"cronic": "true"},
+		HostConfig: dockerHostConfig{
+			Binds:    command.Mounts,
+			Memory:   command.Limits.Memory,
+			NanoCpus: int64(command.Limits.CPUs * 1e9),
+		},
+	}
+	if len(config.Cmd) == 0 {
+		config.Cmd = []string{command.Shell, "-c", command.Command}
+	}
+	if command.Limits.OpenFiles > 0 {
+		config.HostConfig.Ulimits = []dockerUlimit{{Name: "nofile", Soft: command.Limits.OpenFiles, Hard: command.Limits.OpenFiles}}
+	}
+
+	// Cronic relays the output, so the daemon doesn't need to keep it
+	// beyond the container's life (but the local driver still lets it be
+	// followed)
+	config.HostConfig.LogConfig.Type = "local"
+
+	var created struct {
+		ID string `json:"Id"`
+	}
+	if err := d.call(ctx, http.MethodPost, "/containers/create", config, &created); err != nil {
+		return &StartError{fmt.Errorf("can't create the container: %v", err)}
+	}
+
+	// The container is removed even if the run is over (e.g. it timed
+	// out), so this doesn't use ctx
+	defer d.call(context.Background(), http.MethodDelete, "/containers/"+created.ID+"?force=1", nil, nil)
+
+	if err := d.call(ctx, http.MethodPost, "/containers/"+created.ID+"/start", nil, nil); err != nil {
+		return &StartError{fmt.Errorf("can't start the container: %v", err)}
+	}
+
+	// The output is followed until the container exits, or the run is
+	// over
+	logsCtx, stopLogs := context.WithCancel(context.Background())
+	defer stopLogs()
+
+	logsDone := make(chan struct{})
+	go func() {
+		defer close(logsDone)
+		d.followLogs(logsCtx, created.ID, stdout, stderr)
+	}()
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- d.wait(logsCtx, created.ID)
+	}()
+
+	for {
+		select {
+		case err := <-exited:
+			<-logsDone
+			return err
+		case signal := <-command.Signals:
+			d.kill(created.ID, signal)
+		case <-ctx.Done():
+			// Like processes (see stopProcessGroup): SIGTERM, then
+			// SIGKILL after KILL_GRACE_PERIOD (or right away, once
+			// killing)
+			grace := KILL_GRACE_PERIOD
+			select {
+			case <-command.Kill:
+				grace = 0
+			default:
+			}
+			d.call(context.Background(), http.MethodPost, fmt.Sprintf("/containers/%s/stop?t=%d", created.ID, int(grace/time.Second)), nil, nil)
+
+			err := <-exited
+			stopLogs()
+			<-logsDone
+			return err
+		}
+	}
+}
+
+// pull pulls image, according to policy (one of the crontab.Pull* policies,
+// or empty for crontab.PullMissing).
+func (d *DockerExecutor) pull(ctx context.Context, image string, policy string) error {
+	switch policy {
+	case crontab.PullNever:
+		return nil
+	case crontab.PullAlways:
+	default:
+		err := d.call(ctx, http.MethodGet, "/images/"+image+"/json", nil, nil)
+		if err == nil {
+			return nil
+		}
+		if apiErr, ok := err.(*dockerError); !ok || apiErr.status != http.StatusNotFound {
+			return fmt.Errorf("can't inspect image %s: %v", image, err)
+		}
+	}
+
+	name, tag := splitImageTag(image)
+
+	query := url.Values{"fromImage": {name}}
+	if tag != "" {
+		query.Set("tag", tag)
+	}
+
+	response, err := d.do(ctx, http.MethodPost, "/images/create?"+query.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("can't pull image %s: %v", image, err)
+	}
+	defer response.Body.Close()
+
+	// The pull's progress is streamed, and it fails with an error message
+	// in the stream
+	decoder := json.NewDecoder(response.Body)
+	for {
+		var progress struct {
+			Error string `json:"error"`
+		}
+		if err := decoder.Decode(&progress); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("can't pull image %s: %v", image, err)
+		}
+
+		if progress.Error != "" {
+			return fmt.Errorf("can't pull image %s: %s", image, progress.Error)
+		}
+	}
+}
+
+// splitImageTag splits an image reference into its name and tag (latest if
+// it has none, so that pulls don't fetch every tag), unless it has a digest.
+func splitImageTag(image string) (string, string) {
+	if strings.Contains(image, "@") {
+		return image, ""
+	}
+
+	if i := strings.LastIndex(image, ":"); i != -1 && !strings.Contains(image[i:], "/") {
+		return image[:i], image[i+1:]
+	}
+	return image, "latest"
+}
+
+// followLogs copies the output of a container to stdout and stderr, until it
+// exits (or ctx is done).
+func (d *DockerExecutor) followLogs(ctx context.Context, id string, stdout io.Writer, stderr io.Writer) error {
+	response, err := d.do(ctx, http.MethodGet, "/containers/"+id+"/logs?follow=1&stdout=1&stderr=1", nil)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	return demuxDockerStream(response.Body, stdout, stderr)
+}
+
+// demuxDockerStream copies a multiplexed stream of the Docker API (whose
+// frames have an 8-byte header with their stream, and size) to stdout and
+// stderr.
+func demuxDockerStream(r io.Reader, stdout io.Writer, stderr io.Writer) error {
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		out := stdout
+		if header[0] == 2 {
+			out = stderr
+		}
+
+		if _, err := io.CopyN(out, r, int64(binary.BigEndian.Uint32(header[4:]))); err != nil {
+			return err
+		}
+	}
+}
+
+// wait waits for a container to exit, and returns a containerExitError if
+// its command failed.
+func (d *DockerExecutor) wait(ctx context.Context, id string) error {
+	var result struct {
+		StatusCode int
+		Error      *struct {
+			Message string
+		}
+	}
+	if err := d.call(ctx, http.MethodPost, "/containers/"+id+"/wait", nil, &result); err != nil {
+		return err
+	}
+
+	if result.Error != nil && result.Error.Message != "" {
+		return fmt.Errorf("the container failed: %s", result.Error.Message)
+	}
+	if result.StatusCode != 0 {
+		return &containerExitError{code: result.StatusCode}
+	}
+	return nil
+}
+
+func (d *DockerExecutor) kill(id string, signal syscall.Signal) {
+	d.call(context.Background(), http.MethodPost, fmt.Sprintf("/containers/%s/kill?signal=%d", id, int(signal)), nil, nil)
+}
+
+// containerExitError is returned when the command run in a container exits
+// with a non-zero code.
+type containerExitError struct {
+	code int
+}
+
+func (e *containerExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+func (e *containerExitError) ExitCode() int {
+	return e.code
+}
+
+type dockerError struct {
+	status  int
+	message string
+}
+
+func (e *dockerError) Error() string {
+	if e.message == "" {
+		return fmt.Sprintf("Docker responded with status %d", e.status)
+	}
+	return e.message
+}
+
+// call calls the Docker API, with body encoded as JSON (if any), and decodes
+// its JSON response into result (if any).
+func (d *DockerExecutor) call(ctx context.Context, method string, path string, body interface{}, result interface{}) error {
+	response, err := d.do(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if result == nil {
+		io.Copy(ioutil.Discard, response.Body)
+		return nil
+	}
+	return json.NewDecoder(response.Body).Decode(result)
+}
+
+// do sends a request to the Docker API, and returns its response if it
+// succeeded.
+func (d *DockerExecutor) do(ctx context.Context, method string, path string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	request, err := http.NewRequest(method, d.url+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	response, err := d.client.Do(request.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode >= 300 && response.StatusCode != http.StatusNotModified {
+		defer response.Body.Close()
+
+		var message struct {
+			Message string `json:"message"`
+		}
+		contents, _ := ioutil.ReadAll(response.Body)
+		json.Unmarshal(contents, &message)
+		return nil, &dockerError{status: response.StatusCode, message: message.Message}
+	}
+
+	return response, nil
+}
@@ -0,0 +1,219 @@
+package cron
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDocker serves the parts of the Docker API that DockerExecutor uses.
+type fakeDocker struct {
+	mu       sync.Mutex
+	images   map[string]bool
+	pulls    []string
+	config   dockerContainerConfig
+	removed  bool
+	exitCode int
+	stopped  chan struct{}
+}
+
+func newFakeDocker() *fakeDocker {
+	return &fakeDocker{images: map[string]bool{}, stopped: make(chan struct{})}
+}
+
+func dockerFrame(stream byte, line string) []byte {
+	header := make([]byte, 8)
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(line)))
+	return append(header, line...)
+}
+
+func (f *fakeDocker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/"+DOCKER_API_VERSION)
+
+	switch {
+	case strings.HasPrefix(path, "/images/") && strings.HasSuffix(path, "/json"):
+		if !f.images[strings.TrimSuffix(strings.TrimPrefix(path, "/images/"), "/json")] {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message": "no such image"}`))
+		}
+	case path == "/images/create":
+		image := r.URL.Query().Get("fromImage") + ":" + r.URL.Query().Get("tag")
+		f.pulls = append(f.pulls, image)
+		if strings.HasPrefix(image, "nope") {
+			w.Write([]byte(`{"status": "Pulling"}` + "\n" + `{"error": "manifest unknown"}`))
+			return
+		}
+		f.images[image] = true
+		w.Write([]byte(`{"status": "Pulling"}` + "\n" + `{"status": "Downloaded"}`))
+	case path == "/containers/create":
+		json.NewDecoder(r.Body).Decode(&f.config)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"Id": "c0ffee"}`))
+	case path == "/containers/c0ffee/start":
+		w.WriteHeader(http.StatusNoContent)
+	case path == "/containers/c0ffee/logs":
+		w.Write(dockerFrame(1, "hello\n"))
+		w.Write(dockerFrame(2, "oops\n"))
+	case path == "/containers/c0ffee/wait":
+		if strings.Contains(strings.Join(f.config.Cmd, " "), "sleep") {
+			f.mu.Unlock()
+			<-f.stopped
+			f.mu.Lock()
+		}
+		w.Write([]byte(`{"StatusCode": ` + strconv.Itoa(f.exitCode) + `}`))
+	case path == "/containers/c0ffee/stop":
+		close(f.stopped)
+		f.exitCode = 3
+		w.WriteHeader(http.StatusNoContent)
+	case path == "/containers/c0ffee" && r.Method == http.MethodDelete:
+		f.removed = true
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestDockerExecutor(t *testing.T, docker *fakeDocker) (*DockerExecutor, func()) {
+	server := httptest.NewServer(docker)
+
+	executor, err := NewDockerExecutor("tcp://" + strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return executor, server.Close
+}
+
+func TestDockerExecutorRunsCommandsInContainers(t *testing.T) {
+	docker := newFakeDocker()
+	docker.exitCode = 2
+
+	executor, stop := newTestDockerExecutor(t, docker)
+	defer stop()
+
+	command := &Command{
+		Shell:   "/bin/sh",
+		Command: "echo hello; echo oops >&2; exit 2",
+		Env:     []string{"FOO=bar"},
+		Image:   "alpine:3.20",
+		Mounts:  []string{"/srv/data:/data:ro"},
+		Limits:  ResourceLimits{Memory: 512 << 20, CPUs: 0.5, OpenFiles: 64},
+	}
+
+	var stdout, stderr bytes.Buffer
+	err := executor.Run(context.Background(), command, &stdout, &stderr)
+
+	if assert.IsType(t, &containerExitError{}, err) {
+		assert.Equal(t, 2, err.(*containerExitError).ExitCode())
+	}
+	assert.Equal(t, "hello\n", stdout.String())
+	assert.Equal(t, "oops\n", stderr.String())
+
+	assert.Equal(t, []string{"alpine:3.20"}, docker.pulls)
+	assert.Equal(t, "alpine:3.20", docker.config.Image)
+	assert.Equal(t, []string{"/bin/sh", "-c", command.Command}, docker.config.Cmd)
+	assert.Equal(t, []string{"FOO=bar"}, docker.config.Env)
+	assert.Equal(t, []string{"/srv/data:/data:ro"}, docker.config.HostConfig.Binds)
+	assert.Equal(t, int64(512<<20), docker.config.HostConfig.Memory)
+	assert.Equal(t, int64(5e8), docker.config.HostConfig.NanoCpus)
+	assert.Equal(t, []dockerUlimit{{Name: "nofile", Soft: 64, Hard: 64}}, docker.config.HostConfig.Ulimits)
+	assert.True(t, docker.removed)
+
+	// The image is only pulled if it's missing, unless the job says
+	// otherwise
+	docker.exitCode = 0
+	assert.Nil(t, executor.Run(context.Background(), command, &stdout, &stderr))
+	assert.Len(t, docker.pulls, 1)
+
+	command.ImagePull = crontab.PullAlways
+	assert.Nil(t, executor.Run(context.Background(), command, &stdout, &stderr))
+	assert.Len(t, docker.pulls, 2)
+
+	command.Image, command.ImagePull = "nope", crontab.PullMissing
+	err = executor.Run(context.Background(), command, &stdout, &stderr)
+	if assert.IsType(t, &StartError{}, err) {
+		assert.EqualError(t, err, "CRONIC: Failed to start command: can't pull image nope: manifest unknown")
+	}
+	assert.Equal(t, "nope:latest", docker.pulls[2])
+}
+
+func TestDockerExecutorStopsContainers(t *testing.T) {
+	docker := newFakeDocker()
+	docker.images["busybox:latest"] = true
+
+	executor, stop := newTestDockerExecutor(t, docker)
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	command := &Command{Argv: []string{"sleep", "60"}, Image: "busybox:latest"}
+	err := executor.Run(ctx, command, &bytes.Buffer{}, &bytes.Buffer{})
+
+	if assert.IsType(t, &containerExitError{}, err) {
+		assert.Equal(t, 3, err.(*containerExitError).ExitCode())
+	}
+	assert.Equal(t, []string{"sleep", "60"}, docker.config.Cmd)
+	assert.True(t, docker.removed)
+}
+
+func TestRunJobRunsImageJobsInContainers(t *testing.T) {
+	os.Setenv("CRONIC_TEST_SECRET", "hunter2")
+	defer os.Unsetenv("CRONIC_TEST_SECRET")
+
+	docker := newFakeDocker()
+	executor, stop := newTestDockerExecutor(t, docker)
+	defer stop()
+
+	logger, _ := newTestLogger()
+
+	status := newTestStatus("./report.sh")
+	status.Job.Image = "alpine:3.20"
+	status.Job.Environ = map[string]string{"FOO": "bar"}
+
+	// Without a container executor, the command can't start
+	err := runJob(context.Background(), &basicContext, &basicOptions, status, logger)
+	assert.IsType(t, &StartError{}, err)
+
+	opts := basicOptions
+	opts.ContainerExecutor = executor
+
+	logger, channel := newTestLogger()
+	assert.Nil(t, runJob(context.Background(), &basicContext, &opts, status, logger))
+	expectMessages(t, channel, "Starting", "^(hello|oops)$", "^(hello|oops)$")
+
+	// Containers don't inherit cronic's environment
+	assert.Equal(t, []string{"FOO=bar"}, docker.config.Env)
+}
+
+func TestSplitImageTag(t *testing.T) {
+	for _, tt := range []struct {
+		image, name, tag string
+	}{
+		{"alpine", "alpine", "latest"},
+		{"alpine:3.20", "alpine", "3.20"},
+		{"registry:5000/team/app", "registry:5000/team/app", "latest"},
+		{"registry:5000/team/app:v2", "registry:5000/team/app", "v2"},
+		{"alpine@sha256:abc", "alpine@sha256:abc", ""},
+	} {
+		name, tag := splitImageTag(tt.image)
+		assert.Equal(t, tt.name, name, tt.image)
+		assert.Equal(t, tt.tag, tag, tt.image)
+	}
+}
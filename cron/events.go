@@ -0,0 +1,110 @@
+package cron
+
+import (
+	"time"
+
+	"github.com/samgaw/cronic/crontab"
+)
+
+const (
+	SkipReasonPaused   = "paused"
+	SkipReasonRunning  = "running"
+	SkipReasonDraining = "draining"
+
+	// The wall clock jumped past the run (see ClockWatcher)
+	SkipReasonClock = "clock"
+
+	// The most recent run of a job the job runs after didn't succeed
+	SkipReasonDependency = "dependency"
+
+	// The run fell in a blackout window (see crontab.Blackout)
+	SkipReasonBlackout = "blackout"
+
+	// The run fell on a holiday (see crontab.Job.SkipHolidays)
+	SkipReasonHoliday = "holiday"
+)
+
+// Event describes something that happened to a job, for notifiers.
+type Event struct {
+	Type     crontab.EventType `json:"type"`
+	Time     time.Time         `json:"time"`
+	Job      *crontab.Job      `json:"-"`
+	Name     string            `json:"name,omitempty"`
+	Position int               `json:"position"`
+	Schedule string            `json:"schedule"`
+	Command  string            `json:"command"`
+
+	// The job's namespace, if any, and its labels
+	Namespace string            `json:"namespace,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+
+	// The run the event is about (not set for skipped runs)
+	RunID     string `json:"run_id,omitempty"`
+	Iteration uint64 `json:"iteration"`
+
+	// Set once the run is done
+	Result          *RunResult `json:"result,omitempty"`
+	DurationSeconds float64    `json:"duration_seconds,omitempty"`
+
+	// The last lines of the run's output (up to OUTPUT_BUFFER_SIZE, see
+	// Result.OutputLines for the total), once it's done
+	Output []OutputLine `json:"-"`
+
+	// Why the run was skipped (one of the SkipReason* constants)
+	SkipReason string `json:"skip_reason,omitempty"`
+}
+
+// Notifier is notified of job events. Notify is called from the goroutines
+// that schedule and run jobs (see TimerQueue), so it must not block (e.g. on
+// network I/O).
+type Notifier interface {
+	Notify(event *Event)
+}
+
+// CrontabMonitor is implemented by notifiers that also report on the crontab
+// itself. CrontabParsed is called when cronic reads it, and when it reloads
+// it.
+type CrontabMonitor interface {
+	CrontabParsed(tab *crontab.Crontab)
+}
+
+func newEvent(eventType crontab.EventType, job *crontab.Job, namespace *Namespace) *Event {
+	event := &Event{
+		Type:     eventType,
+		Time:     time.Now(),
+		Job:      job,
+		Name:     job.Name,
+		Position: job.Position,
+		Schedule: job.Schedule,
+		Command:  job.Command,
+	}
+
+	if namespace != nil {
+		event.Namespace = namespace.Name
+		event.Labels = namespace.Labels
+	}
+
+	return event
+}
+
+func newResultEvent(job *crontab.Job, namespace *Namespace, result *RunResult) *Event {
+	eventType := crontab.EventSuccess
+	if result.TimedOut {
+		eventType = crontab.EventTimeout
+	} else if !result.Success {
+		eventType = crontab.EventFailure
+	}
+
+	event := newEvent(eventType, job, namespace)
+	event.RunID = result.RunID
+	event.Iteration = result.Iteration
+	event.Result = result
+	event.DurationSeconds = result.FinishedAt.Sub(result.StartedAt).Seconds()
+	return event
+}
+
+func (opts *Options) notify(event *Event) {
+	for _, notifier := range opts.Notifiers {
+		notifier.Notify(event)
+	}
+}
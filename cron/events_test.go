@@ -0,0 +1,477 @@
+package cron
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testNotifier struct {
+	events chan *Event
+}
+
+func (n *testNotifier) Notify(event *Event) {
+	n.events <- event
+}
+
+func expectEvent(t *testing.T, events chan *Event, eventType crontab.EventType) *Event {
+	select {
+	case event := <-events:
+		assert.Equal(t, eventType, event.Type)
+		return event
+	case <-time.After(3 * time.Second):
+		t.Fatalf("timed out waiting for %s event", eventType)
+		return nil
+	}
+}
+
+func TestStartJobSendsEvents(t *testing.T) {
+	job := crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: &testExpression{100 * time.Millisecond},
+			Schedule:   "always!",
+			Command:    "test -e /nonexistent",
+		},
+		Position: 1,
+	}
+
+	notifier := &testNotifier{make(chan *Event, TEST_CHANNEL_BUFFER_SIZE)}
+	opts := &Options{Notifiers: []Notifier{notifier}}
+
+	ctx, stop := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+
+	logger, _ := newTestLogger()
+	status := NewJobStatus(&job)
+
+	StartJob(ctx, &wg, &basicContext, opts, status, logger)
+
+	start := expectEvent(t, notifier.events, crontab.EventStart)
+	failure := expectEvent(t, notifier.events, crontab.EventFailure)
+
+	assert.Equal(t, start.RunID, failure.RunID)
+	assert.Equal(t, "test -e /nonexistent", failure.Command)
+	if assert.NotNil(t, failure.Result) {
+		assert.False(t, failure.Result.Success)
+		assert.NotNil(t, failure.Result.ScheduledAt)
+		assert.True(t, failure.Result.LagSeconds >= 0 && failure.Result.LagSeconds < 1, failure.Result.LagSeconds)
+	}
+
+	status.Pause()
+
+	// The next run might have started before the job was paused
+	for event := range notifier.events {
+		if event.Type == crontab.EventSkip {
+			assert.Equal(t, SkipReasonPaused, event.SkipReason)
+			break
+		}
+	}
+
+	stop()
+	wg.Wait()
+}
+
+func TestStartJobSendsSkipEventsForOverlappingRuns(t *testing.T) {
+	job := crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: &testExpression{100 * time.Millisecond},
+			Schedule:   "always!",
+			Command:    "sleep 0.25",
+		},
+		Position: 1,
+	}
+
+	notifier := &testNotifier{make(chan *Event, TEST_CHANNEL_BUFFER_SIZE)}
+	opts := &Options{Notifiers: []Notifier{notifier}}
+
+	ctx, stop := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+
+	logger, _ := newTestLogger()
+	status := NewJobStatus(&job)
+
+	StartJob(ctx, &wg, &basicContext, opts, status, logger)
+
+	expectEvent(t, notifier.events, crontab.EventStart)
+	skip := expectEvent(t, notifier.events, crontab.EventSkip)
+	assert.Equal(t, SkipReasonRunning, skip.SkipReason)
+
+	stop()
+	wg.Wait()
+}
+
+func TestStartJobSchedulesIntervalsFromRunEnd(t *testing.T) {
+	job := crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: &testExpression{100 * time.Millisecond},
+			Schedule:   "always!",
+			Command:    "sleep 0.25",
+		},
+		Position:        1,
+		IntervalFromEnd: true,
+	}
+
+	notifier := &testNotifier{make(chan *Event, TEST_CHANNEL_BUFFER_SIZE)}
+	opts := &Options{Notifiers: []Notifier{notifier}}
+
+	ctx, stop := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+
+	logger, _ := newTestLogger()
+	status := NewJobStatus(&job)
+
+	StartJob(ctx, &wg, &basicContext, opts, status, logger)
+
+	// Runs aren't skipped while the job is running, and the interval
+	// starts once it's done
+	expectEvent(t, notifier.events, crontab.EventStart)
+	success := expectEvent(t, notifier.events, crontab.EventSuccess)
+	start := expectEvent(t, notifier.events, crontab.EventStart)
+	assert.True(t, start.Time.Sub(success.Time) >= 100*time.Millisecond)
+
+	stop()
+	wg.Wait()
+}
+
+func TestStartJobRetriesFailures(t *testing.T) {
+	type testCase struct {
+		name     string
+		command  string
+		retry    *crontab.RetryPolicy
+		attempts int
+	}
+
+	testCases := []testCase{
+		{"matching exit code", "exit 75", &crontab.RetryPolicy{Retries: 2, On: []string{"75"}}, 3},
+		{"other exit code", "exit 1", &crontab.RetryPolicy{Retries: 2, On: []string{"75"}}, 1},
+		{"never retried", "exit 2", &crontab.RetryPolicy{Retries: 2, Never: []string{"2"}}, 1},
+		{"killed", "kill -9 $$", &crontab.RetryPolicy{Retries: 1, On: []string{crontab.FailureSignal}}, 2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.retry.Delay = 10 * time.Millisecond
+
+			job := crontab.Job{
+				CrontabLine: crontab.CrontabLine{
+					Expression: &testExpression{time.Hour},
+					Schedule:   "always!",
+					Command:    tc.command,
+				},
+				Retry: tc.retry,
+			}
+
+			notifier := &testNotifier{make(chan *Event, TEST_CHANNEL_BUFFER_SIZE)}
+			opts := &Options{Notifiers: []Notifier{notifier}}
+
+			ctx, stop := context.WithCancel(context.Background())
+
+			var wg sync.WaitGroup
+
+			logger, _ := newTestLogger()
+			status := NewJobStatus(&job)
+
+			StartJob(ctx, &wg, &basicContext, opts, status, logger)
+			assert.Nil(t, status.Trigger())
+
+			for i := 0; i < tc.attempts; i++ {
+				expectEvent(t, notifier.events, crontab.EventStart)
+				failure := expectEvent(t, notifier.events, crontab.EventFailure)
+				if assert.NotNil(t, failure.Result) {
+					assert.Equal(t, i, failure.Result.Retry)
+					assert.Equal(t, i < tc.attempts-1, failure.Result.WillRetry)
+				}
+			}
+
+			select {
+			case event := <-notifier.events:
+				t.Fatalf("unexpected %s event", event.Type)
+			case <-time.After(100 * time.Millisecond):
+			}
+
+			stop()
+			wg.Wait()
+		})
+	}
+}
+
+func TestStartJobSendsTimeoutEvents(t *testing.T) {
+	job := crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: &testExpression{time.Hour},
+			Schedule:   "always!",
+			Command:    "sleep 10",
+		},
+		Timeout: 50 * time.Millisecond,
+	}
+
+	notifier := &testNotifier{make(chan *Event, TEST_CHANNEL_BUFFER_SIZE)}
+	opts := &Options{Notifiers: []Notifier{notifier}}
+
+	ctx, stop := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+
+	logger, _ := newTestLogger()
+	status := NewJobStatus(&job)
+
+	StartJob(ctx, &wg, &basicContext, opts, status, logger)
+	assert.Nil(t, status.Trigger())
+
+	expectEvent(t, notifier.events, crontab.EventStart)
+	timeout := expectEvent(t, notifier.events, crontab.EventTimeout)
+	if assert.NotNil(t, timeout.Result) {
+		assert.True(t, timeout.Result.TimedOut)
+		assert.False(t, timeout.Result.Success)
+	}
+
+	stop()
+	wg.Wait()
+}
+
+func TestStartJobHandlesSpawnFailures(t *testing.T) {
+	defer func(retries int, delay time.Duration) {
+		SPAWN_RETRIES = retries
+		SPAWN_RETRY_DELAY = delay
+	}(SPAWN_RETRIES, SPAWN_RETRY_DELAY)
+
+	SPAWN_RETRIES = 2
+	SPAWN_RETRY_DELAY = 10 * time.Millisecond
+
+	type testCase struct {
+		policy   string
+		attempts int
+		paused   bool
+	}
+
+	testCases := []testCase{
+		{"", 1, false},
+		{crontab.SpawnFailureFail, 1, false},
+		{crontab.SpawnFailureRetry, 3, false},
+		{crontab.SpawnFailurePause, 1, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.policy, func(t *testing.T) {
+			job := crontab.Job{
+				CrontabLine: crontab.CrontabLine{
+					Expression: &testExpression{time.Hour},
+					Schedule:   "always!",
+					Command:    "true",
+				},
+				OnSpawnFailure: tc.policy,
+			}
+
+			cronCtx := &crontab.Context{Shell: "/no/such/shell", Environ: map[string]string{}}
+
+			notifier := &testNotifier{make(chan *Event, TEST_CHANNEL_BUFFER_SIZE)}
+			opts := &Options{Notifiers: []Notifier{notifier}}
+
+			ctx, stop := context.WithCancel(context.Background())
+
+			var wg sync.WaitGroup
+
+			logger, _ := newTestLogger()
+			status := NewJobStatus(&job)
+
+			StartJob(ctx, &wg, cronCtx, opts, status, logger)
+			assert.Nil(t, status.Trigger())
+
+			for i := 0; i < tc.attempts; i++ {
+				expectEvent(t, notifier.events, crontab.EventStart)
+				failure := expectEvent(t, notifier.events, crontab.EventFailure)
+				if assert.NotNil(t, failure.Result) {
+					assert.Regexp(t, "^CRONIC: Failed to start command", failure.Result.Error)
+					assert.Equal(t, i < tc.attempts-1, failure.Result.WillRetry)
+				}
+			}
+
+			select {
+			case event := <-notifier.events:
+				t.Fatalf("unexpected %s event", event.Type)
+			case <-time.After(100 * time.Millisecond):
+			}
+
+			assert.Equal(t, tc.paused, status.Paused())
+
+			stop()
+			wg.Wait()
+		})
+	}
+}
+
+func TestStartJobPausesAfterFailures(t *testing.T) {
+	job := crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: &testExpression{50 * time.Millisecond},
+			Schedule:   "always!",
+			Command:    "false",
+		},
+		PauseAfterFailures: 2,
+		PauseFor:           300 * time.Millisecond,
+	}
+
+	notifier := &testNotifier{make(chan *Event, TEST_CHANNEL_BUFFER_SIZE)}
+	opts := &Options{Notifiers: []Notifier{notifier}}
+
+	ctx, stop := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+
+	logger, _ := newTestLogger()
+	status := NewJobStatus(&job)
+
+	StartJob(ctx, &wg, &basicContext, opts, status, logger)
+
+	expectEvent(t, notifier.events, crontab.EventStart)
+	failure := expectEvent(t, notifier.events, crontab.EventFailure)
+	if assert.NotNil(t, failure.Result) {
+		assert.False(t, failure.Result.Paused)
+	}
+
+	expectEvent(t, notifier.events, crontab.EventStart)
+	failure = expectEvent(t, notifier.events, crontab.EventFailure)
+	if assert.NotNil(t, failure.Result) {
+		assert.True(t, failure.Result.Paused)
+		assert.NotNil(t, failure.Result.PausedUntil)
+	}
+
+	assert.True(t, status.Paused())
+
+	// Runs are skipped until the cool-down is over
+	skipped := 0
+	for {
+		var event *Event
+		select {
+		case event = <-notifier.events:
+		case <-time.After(3 * time.Second):
+			t.Fatalf("timed out waiting for the job to resume")
+		}
+
+		if event.Type == crontab.EventStart {
+			break
+		}
+
+		assert.Equal(t, crontab.EventSkip, event.Type)
+		assert.Equal(t, SkipReasonPaused, event.SkipReason)
+		skipped++
+	}
+
+	assert.True(t, skipped > 0)
+	assert.False(t, status.Paused())
+
+	stop()
+	wg.Wait()
+}
+
+func TestSpawnRetryDelay(t *testing.T) {
+	assert.Equal(t, SPAWN_RETRY_DELAY, spawnRetryDelay(0))
+	assert.Equal(t, 4*SPAWN_RETRY_DELAY, spawnRetryDelay(2))
+	assert.Equal(t, SPAWN_RETRY_MAX_DELAY, spawnRetryDelay(1000))
+}
+
+func TestStartJobSkipsRunsWhileDraining(t *testing.T) {
+	job := crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: &testExpression{time.Hour},
+			Schedule:   "always!",
+			Command:    "sleep 0.1; exit 1",
+		},
+		Retry: &crontab.RetryPolicy{Retries: 5, Delay: 10 * time.Millisecond},
+	}
+
+	notifier := &testNotifier{make(chan *Event, TEST_CHANNEL_BUFFER_SIZE)}
+	opts := &Options{Notifiers: []Notifier{notifier}}
+
+	ctx, stop := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+
+	logger, _ := newTestLogger()
+	status := NewJobStatus(&job)
+
+	StartJob(ctx, &wg, &basicContext, opts, status, logger)
+	assert.Nil(t, status.Trigger())
+
+	// The run in progress finishes, but isn't retried
+	expectEvent(t, notifier.events, crontab.EventStart)
+	status.Drain()
+	expectEvent(t, notifier.events, crontab.EventFailure)
+	assert.Equal(t, ErrDraining, status.Trigger())
+
+	select {
+	case event := <-notifier.events:
+		t.Fatalf("unexpected %s event", event.Type)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Scheduled runs are skipped
+	scheduled := job
+	scheduled.Expression = &testExpression{50 * time.Millisecond}
+	status = NewJobStatus(&scheduled)
+	status.Drain()
+
+	StartJob(ctx, &wg, &basicContext, opts, status, logger)
+
+	skip := expectEvent(t, notifier.events, crontab.EventSkip)
+	assert.Equal(t, SkipReasonDraining, skip.SkipReason)
+
+	stop()
+	wg.Wait()
+}
+
+func TestStartJobRunsOneShotJobsOnce(t *testing.T) {
+	type testCase struct {
+		schedule string
+		runs     bool
+	}
+
+	testCases := []testCase{
+		{"@once", true},
+		{"@at " + time.Now().Add(100*time.Millisecond).Format(time.RFC3339Nano), true},
+		{"@at 2018-04-07T13:00", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.schedule, func(t *testing.T) {
+			job, err := crontab.NewJob(tc.schedule, "true", nil)
+			if !assert.Nil(t, err) {
+				return
+			}
+
+			notifier := &testNotifier{make(chan *Event, TEST_CHANNEL_BUFFER_SIZE)}
+			opts := &Options{Notifiers: []Notifier{notifier}}
+
+			var wg sync.WaitGroup
+
+			logger, _ := newTestLogger()
+			status := NewJobStatus(job)
+
+			// The job's goroutine returns once it's done, without
+			// cronic shutting down
+			StartJob(context.Background(), &wg, &basicContext, opts, status, logger)
+			wg.Wait()
+
+			if tc.runs {
+				expectEvent(t, notifier.events, crontab.EventStart)
+				expectEvent(t, notifier.events, crontab.EventSuccess)
+			}
+
+			select {
+			case event := <-notifier.events:
+				t.Fatalf("unexpected %s event", event.Type)
+			default:
+			}
+
+			assert.Nil(t, status.Snapshot().NextRun)
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package cron
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/samgaw/cronic/crontab"
+)
+
+var (
+	// How many events to hold for each client of the event stream (in
+	// excess, events are dropped)
+	EVENT_STREAM_BUFFER_SIZE = 1024
+
+	// How long clients have to read an event before they're disconnected
+	EVENT_STREAM_WRITE_TIMEOUT = 10 * time.Second
+)
+
+// EventStream streams job events to the clients of a Unix socket, as
+// newline-delimited JSON, so that sidecars can follow runs without parsing
+// logs: the notifier events (start, success, failure, timeout and skip, see
+// Event) along with a "line" event for each line of output runs emit.
+//
+// Clients that fall behind miss events, since streaming them must not block
+// jobs.
+type EventStream struct {
+	listener net.Listener
+	logger   *Logger
+
+	mu      sync.Mutex
+	clients map[chan []byte]struct{}
+	closed  bool
+
+	wg sync.WaitGroup
+}
+
+// eventStreamLine is the event for a line of output.
+type eventStreamLine struct {
+	Type      string    `json:"type"`
+	Time      time.Time `json:"time"`
+	Name      string    `json:"name,omitempty"`
+	Position  int       `json:"position"`
+	Namespace string    `json:"namespace,omitempty"`
+	RunID     string    `json:"run_id"`
+	Iteration uint64    `json:"iteration"`
+	Channel   string    `json:"channel"`
+	Line      string    `json:"line"`
+}
+
+// NewEventStream listens on a Unix socket at path, replacing the socket a
+// previous cronic may have left there. logger reports errors streaming
+// events.
+func NewEventStream(path string, logger *Logger) (*EventStream, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("CRONIC: Failed to listen for event stream clients: %v", err)
+	}
+
+	s := &EventStream{
+		listener: listener,
+		logger:   logger,
+		clients:  make(map[chan []byte]struct{}),
+	}
+
+	s.wg.Add(1)
+	go s.accept()
+
+	return s, nil
+}
+
+func (s *EventStream) accept() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+
+			if !closed {
+				s.logger.Errorf("CRONIC: Stopped accepting event stream clients: %v", err)
+			}
+			return
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		client := make(chan []byte, EVENT_STREAM_BUFFER_SIZE)
+		s.clients[client] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.serve(conn, client)
+	}
+}
+
+// serve writes events to a client until it goes away, or the stream is
+// closed.
+func (s *EventStream) serve(conn net.Conn, client chan []byte) {
+	defer s.wg.Done()
+	defer conn.Close()
+
+	for message := range client {
+		conn.SetWriteDeadline(time.Now().Add(EVENT_STREAM_WRITE_TIMEOUT))
+		if _, err := conn.Write(message); err != nil {
+			s.logger.Debugf("CRONIC: Event stream client went away: %v", err)
+			s.remove(client)
+
+			// Drain what was queued before the client was removed
+			for range client {
+			}
+			return
+		}
+	}
+}
+
+func (s *EventStream) remove(client chan []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.clients[client]; ok {
+		delete(s.clients, client)
+		close(client)
+	}
+}
+
+func (s *EventStream) Notify(event *Event) {
+	s.send(event)
+}
+
+// line streams a line of a run's output.
+func (s *EventStream) line(job *crontab.Job, namespace *Namespace, runID string, line OutputLine) {
+	event := &eventStreamLine{
+		Type:      "line",
+		Time:      line.Time,
+		Name:      job.Name,
+		Position:  job.Position,
+		RunID:     runID,
+		Iteration: line.Iteration,
+		Channel:   line.Channel,
+		Line:      line.Line,
+	}
+	if namespace != nil {
+		event.Namespace = namespace.Name
+	}
+
+	s.send(event)
+}
+
+func (s *EventStream) send(event interface{}) {
+	message, err := json.Marshal(event)
+	if err != nil {
+		s.logger.Errorf("CRONIC: Failed to encode event: %v", err)
+		return
+	}
+	message = append(message, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for client := range s.clients {
+		select {
+		case client <- message:
+		default:
+			// The client is too slow
+		}
+	}
+}
+
+// Close disconnects the clients (once they got the events queued for them),
+// and removes the socket.
+func (s *EventStream) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	for client := range s.clients {
+		delete(s.clients, client)
+		close(client)
+	}
+	s.mu.Unlock()
+
+	s.listener.Close()
+	s.wg.Wait()
+}
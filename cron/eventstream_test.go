@@ -0,0 +1,175 @@
+package cron
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// connectToEventStream connects to the event stream, and waits until it
+// streams events to the connection.
+func connectToEventStream(t *testing.T, stream *EventStream, path string) net.Conn {
+	stream.mu.Lock()
+	clients := len(stream.clients)
+	stream.mu.Unlock()
+
+	conn, err := net.Dial("unix", path)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		stream.mu.Lock()
+		connected := len(stream.clients) > clients
+		stream.mu.Unlock()
+
+		if connected {
+			return conn
+		}
+	}
+
+	t.Fatalf("timed out waiting for the event stream to accept the connection")
+	return nil
+}
+
+func TestEventStreamStreamsRuns(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cronic-events")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "events.sock")
+	logger, _ := newTestLogger()
+
+	stream, err := NewEventStream(path, logger)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	conn := connectToEventStream(t, stream, path)
+	defer conn.Close()
+
+	status := newTestStatus("echo hello; echo oops >&2")
+	runID := status.startRun(7)
+
+	startEvent := newEvent(crontab.EventStart, status.Job, nil)
+	startEvent.RunID = runID
+	stream.Notify(startEvent)
+
+	opts := basicOptions
+	opts.EventStream = stream
+	assert.Nil(t, runJob(context.Background(), &basicContext, &opts, status, logger))
+
+	// Close sends what's left, then disconnects clients
+	stream.Close()
+
+	var events []map[string]interface{}
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var event map[string]interface{}
+		if assert.Nil(t, json.Unmarshal(scanner.Bytes(), &event), scanner.Text()) {
+			events = append(events, event)
+		}
+	}
+
+	if !assert.Len(t, events, 3) {
+		return
+	}
+
+	assert.Equal(t, "start", events[0]["type"])
+	assert.Equal(t, runID, events[0]["run_id"])
+
+	// The order of lines on stdout and stderr isn't guaranteed
+	lines := map[string]string{}
+	for _, event := range events[1:] {
+		assert.Equal(t, "line", event["type"])
+		assert.Equal(t, runID, event["run_id"])
+		assert.Equal(t, 7.0, event["iteration"])
+		lines[event["channel"].(string)] = event["line"].(string)
+	}
+	assert.Equal(t, map[string]string{"stdout": "hello", "stderr": "oops"}, lines)
+
+	// The socket is removed
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestEventStreamDropsEventsForSlowClients(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cronic-events")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(size int) { EVENT_STREAM_BUFFER_SIZE = size }(EVENT_STREAM_BUFFER_SIZE)
+	EVENT_STREAM_BUFFER_SIZE = 0
+
+	path := filepath.Join(dir, "events.sock")
+	logger, _ := newTestLogger()
+
+	stream, err := NewEventStream(path, logger)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer stream.Close()
+
+	conn := connectToEventStream(t, stream, path)
+	defer conn.Close()
+
+	// Without a buffer, events the client isn't ready for are dropped
+	// rather than blocking
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			stream.Notify(&Event{Type: crontab.EventSkip})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("streaming events blocked")
+	}
+}
+
+func TestNewEventStreamReplacesStaleSockets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cronic-events")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "events.sock")
+
+	// A socket left behind by a cronic that didn't exit cleanly
+	listener, err := net.Listen("unix", path)
+	if !assert.Nil(t, err) {
+		return
+	}
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	listener.Close()
+
+	logger, _ := newTestLogger()
+
+	stream, err := NewEventStream(path, logger)
+	if assert.Nil(t, err) {
+		stream.Close()
+	}
+
+	// But not other files
+	assert.Nil(t, ioutil.WriteFile(path, []byte("data"), 0644))
+	_, err = NewEventStream(path, logger)
+	assert.NotNil(t, err)
+}
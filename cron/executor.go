@@ -0,0 +1,324 @@
+package cron
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	// How long the processes of a run that's over (e.g. because it timed
+	// out) have to exit after SIGTERM, before they're killed with SIGKILL
+	KILL_GRACE_PERIOD = 10 * time.Second
+
+	PROCESS_GROUP_POLL_INTERVAL = 50 * time.Millisecond
+)
+
+// Command is what an executor runs for a job.
+type Command struct {
+	Shell   string
+	Command string
+
+	// If set, run these arguments directly instead of running Command
+	// with Shell
+	Argv []string
+
+	Env []string
+	Dir string
+
+	// If set, fed to the command's stdin (which is otherwise empty, i.e.
+	// /dev/null): the contents of Stdin, or the file at StdinFile
+	// (relative to Dir)
+	Stdin     string
+	StdinFile string
+
+	// If set, fed to the command's stdin instead (see SSHExecutor)
+	stdin io.Reader
+
+	// If set, run the command as this user (which requires cronic to run
+	// as root, unless it's cronic's own user)
+	User string
+
+	// Signals to send to the command's processes while it runs (e.g. its
+	// checkpoint signal)
+	Signals <-chan syscall.Signal
+
+	// Once closed, stopped commands are killed right away (see
+	// Options.Kill)
+	Kill <-chan struct{}
+
+	Limits ResourceLimits
+
+	// If set, run the command in a fresh container of this image (with
+	// Options.ContainerExecutor), pulled according to ImagePull (one of the
+	// crontab.Pull* policies), with these bind mounts
+	Image     string
+	ImagePull string
+	Mounts    []string
+
+	// With a KubernetesExecutor, the Job manifest to run the command with
+	// (relative to Dir), instead of the executor's
+	JobTemplate string
+
+	// If set, run the command on this remote host ([USER@]HOST[:PORT],
+	// with Options.RemoteExecutor), authenticating with SSHKey (relative
+	// to Dir) rather than the executor's key
+	Host   string
+	SSHKey string
+}
+
+// Executor runs the commands of jobs (see LocalExecutor). Run returns once
+// the command exits, or once ctx is done (e.g. because the run timed out, or
+// was cancelled), in which case it must stop the command first. Errors
+// starting the command must be returned as a StartError.
+type Executor interface {
+	Run(ctx context.Context, command *Command, stdout io.Writer, stderr io.Writer) error
+}
+
+// StartError is returned by executors when a command couldn't be started.
+type StartError struct {
+	Err error
+}
+
+func (e *StartError) Error() string {
+	return fmt.Sprintf("CRONIC: Failed to start command: %v", e.Err)
+}
+
+// LocalExecutor runs commands as processes on this machine.
+type LocalExecutor struct{}
+
+func (LocalExecutor) Run(ctx context.Context, command *Command, stdout io.Writer, stderr io.Writer) error {
+	var cmd *exec.Cmd
+
+	if len(command.Argv) > 0 {
+		path, err := lookPath(command.Argv[0], command.Env)
+		if err != nil {
+			return &StartError{err}
+		}
+		cmd = exec.Command(path, command.Argv[1:]...)
+	} else {
+		// Like the commands they run, shells are looked up in the job's
+		// PATH (e.g. for SHELL=bash), if it has one
+		shell := command.Shell
+		if _, ok := environValue(command.Env, "PATH"); ok {
+			path, err := lookPath(shell, command.Env)
+			if err != nil {
+				return &StartError{err}
+			}
+			shell = path
+		}
+		cmd = exec.Command(shell, "-c", command.Command)
+	}
+
+	// Run in a separate process group so that in interactive usage
+	// CTRL+C stops cronic, not the children threads (and so that the
+	// command's children can be stopped along with it, see
+	// stopProcessGroup).
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	if command.User != "" {
+		credential, err := userCredential(command.User)
+		if err != nil {
+			return &StartError{err}
+		}
+		cmd.SysProcAttr.Credential = credential
+	}
+
+	cmd.Env = command.Env
+	cmd.Dir = command.Dir
+	switch {
+	case command.stdin != nil:
+		cmd.Stdin = command.stdin
+	case command.StdinFile != "":
+		path := command.StdinFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(command.Dir, path)
+		}
+
+		stdin, err := os.Open(path)
+		if err != nil {
+			return &StartError{err}
+		}
+		defer stdin.Close()
+		cmd.Stdin = stdin
+	case command.Stdin != "":
+		cmd.Stdin = strings.NewReader(command.Stdin)
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	limits, err := applyResourceLimits(cmd, command.Limits)
+	if err != nil {
+		return &StartError{err}
+	}
+	defer limits.remove()
+
+	if err := processes.start(cmd); err != nil {
+		return &StartError{err}
+	}
+	defer processes.forget(cmd.Process.Pid)
+
+	if err := limits.started(cmd.Process.Pid); err != nil {
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		cmd.Wait()
+		return &StartError{err}
+	}
+
+	waited := make(chan error, 1)
+	go func() {
+		waited <- cmd.Wait()
+	}()
+
+	for {
+		select {
+		case err := <-waited:
+			return err
+		case signal := <-command.Signals:
+			syscall.Kill(-cmd.Process.Pid, signal)
+		case <-ctx.Done():
+			return stopProcessGroup(cmd.Process.Pid, waited, command.Kill)
+		}
+	}
+}
+
+// stopProcessGroup stops the process group of a command, once its run is
+// over (e.g. because it timed out), and returns the result of waiting for the
+// command.
+//
+// The whole group is signalled, since children (e.g. of the shell) would
+// keep the output pipes open, and Wait from returning, or linger after the
+// command exits. They're asked to stop with SIGTERM, then killed with
+// SIGKILL if some are still running after KILL_GRACE_PERIOD (or once kill is
+// closed).
+func stopProcessGroup(pgid int, waited chan error, kill <-chan struct{}) error {
+	select {
+	case <-kill:
+		syscall.Kill(-pgid, syscall.SIGKILL)
+		return <-waited
+	default:
+	}
+
+	syscall.Kill(-pgid, syscall.SIGTERM)
+	grace := time.After(KILL_GRACE_PERIOD)
+
+	select {
+	case err := <-waited:
+		// The command is gone, but its children might not be yet
+		for syscall.Kill(-pgid, 0) == nil {
+			select {
+			case <-grace:
+				syscall.Kill(-pgid, syscall.SIGKILL)
+				return err
+			case <-kill:
+				syscall.Kill(-pgid, syscall.SIGKILL)
+				return err
+			case <-time.After(PROCESS_GROUP_POLL_INTERVAL):
+			}
+		}
+		return err
+	case <-grace:
+		syscall.Kill(-pgid, syscall.SIGKILL)
+		return <-waited
+	case <-kill:
+		syscall.Kill(-pgid, syscall.SIGKILL)
+		return <-waited
+	}
+}
+
+// lookPath finds an executable like a shell would, using the PATH in env
+// (rather than cronic's).
+func lookPath(file string, env []string) (string, error) {
+	if strings.Contains(file, "/") {
+		return file, nil
+	}
+
+	path := ""
+	for _, variable := range env {
+		if strings.HasPrefix(variable, "PATH=") {
+			path = variable[len("PATH="):]
+		}
+	}
+
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			dir = "."
+		}
+
+		candidate := filepath.Join(dir, file)
+		if info, err := os.Stat(candidate); err == nil && info.Mode().IsRegular() && info.Mode()&0111 != 0 {
+			return candidate, nil
+		}
+	}
+
+	return "", fmt.Errorf("%s: executable file not found in PATH", file)
+}
+
+// userCredential returns the credential to run commands as a user with, or
+// nil if it's the user cronic runs as.
+func userCredential(name string) (*syscall.Credential, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("bad uid for user %s: %s", name, u.Uid)
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("bad gid for user %s: %s", name, u.Gid)
+	}
+
+	if int(uid) == os.Getuid() {
+		return nil, nil
+	}
+
+	groupIDs, err := u.GroupIds()
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]uint32, 0, len(groupIDs))
+	for _, groupID := range groupIDs {
+		if group, err := strconv.ParseUint(groupID, 10, 32); err == nil {
+			groups = append(groups, uint32(group))
+		}
+	}
+
+	return &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid), Groups: groups}, nil
+}
+
+// commandExecutor returns the executor to run command with.
+func (opts *Options) commandExecutor(command *Command) (Executor, error) {
+	if command.Host != "" {
+		if opts.RemoteExecutor == nil {
+			return nil, fmt.Errorf("running jobs on remote hosts requires a remote executor")
+		}
+		return opts.RemoteExecutor, nil
+	}
+
+	if command.Image == "" {
+		return opts.executor(), nil
+	}
+
+	if opts.ContainerExecutor == nil {
+		return nil, fmt.Errorf("running jobs in containers requires a container executor")
+	}
+	return opts.ContainerExecutor, nil
+}
+
+func (opts *Options) executor() Executor {
+	if opts.Executor == nil {
+		return LocalExecutor{}
+	}
+	return opts.Executor
+}
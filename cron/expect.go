@@ -0,0 +1,58 @@
+package cron
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/samgaw/cronic/crontab"
+)
+
+// outputExpectation checks the output of a run for what the job expects to
+// find in it (see crontab.Job.ExpectOutput).
+type outputExpectation struct {
+	job *crontab.Job
+
+	// Lines come from both stdout and stderr
+	mu           sync.Mutex
+	foundOutput  bool
+	foundPattern bool
+}
+
+func newOutputExpectation(job *crontab.Job) *outputExpectation {
+	return &outputExpectation{
+		job:          job,
+		foundOutput:  job.ExpectOutput == "",
+		foundPattern: job.ExpectOutputMatch == nil,
+	}
+}
+
+func (e *outputExpectation) check(line string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.foundOutput && strings.Contains(line, e.job.ExpectOutput) {
+		e.foundOutput = true
+	}
+
+	if !e.foundPattern && e.job.ExpectOutputMatch.MatchString(line) {
+		e.foundPattern = true
+	}
+}
+
+// missing describes what wasn't found in the output (or returns an empty
+// string if everything was).
+func (e *outputExpectation) missing() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.foundOutput {
+		return fmt.Sprintf("containing %q", e.job.ExpectOutput)
+	}
+
+	if !e.foundPattern {
+		return fmt.Sprintf("matching %q", e.job.ExpectOutputMatch.String())
+	}
+
+	return ""
+}
@@ -0,0 +1,37 @@
+package cron
+
+import (
+	"github.com/samgaw/cronic/crontab"
+)
+
+// FailFast is a notifier reporting the first run of any job that fails for
+// good (i.e. that won't be retried), e.g. to stop cronic and let whatever
+// runs it restart it.
+type FailFast struct {
+	failures chan *Event
+}
+
+func NewFailFast() *FailFast {
+	return &FailFast{failures: make(chan *Event, 1)}
+}
+
+func (f *FailFast) Notify(event *Event) {
+	if event.Type != crontab.EventFailure && event.Type != crontab.EventTimeout {
+		return
+	}
+
+	if event.Result != nil && event.Result.WillRetry {
+		return
+	}
+
+	// Only the first failure is reported
+	select {
+	case f.failures <- event:
+	default:
+	}
+}
+
+// Failures receives the first failure.
+func (f *FailFast) Failures() <-chan *Event {
+	return f.failures
+}
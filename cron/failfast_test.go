@@ -0,0 +1,39 @@
+package cron
+
+import (
+	"testing"
+
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailFastReportsFirstFailure(t *testing.T) {
+	failFast := NewFailFast()
+
+	failFast.Notify(&Event{Type: crontab.EventStart})
+	failFast.Notify(&Event{Type: crontab.EventSuccess, Result: &RunResult{Success: true}})
+	failFast.Notify(&Event{Type: crontab.EventFailure, Result: &RunResult{WillRetry: true}})
+
+	select {
+	case event := <-failFast.Failures():
+		t.Fatalf("unexpected %s event", event.Type)
+	default:
+	}
+
+	failFast.Notify(&Event{Type: crontab.EventTimeout, Position: 1, Result: &RunResult{TimedOut: true}})
+	failFast.Notify(&Event{Type: crontab.EventFailure, Position: 2, Result: &RunResult{}})
+
+	select {
+	case event := <-failFast.Failures():
+		assert.Equal(t, 1, event.Position)
+	default:
+		t.Fatal("expected a failure")
+	}
+
+	select {
+	case event := <-failFast.Failures():
+		t.Fatalf("unexpected failure of job %d", event.Position)
+	default:
+	}
+}
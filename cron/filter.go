@@ -0,0 +1,120 @@
+package cron
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/samgaw/cronic/crontab"
+)
+
+// JobFilter selects the jobs of a crontab to run (e.g. so that a crontab can
+// be deployed in several roles, each running some of its jobs): those that
+// match one of its Only patterns (if there are any), and none of its Exclude
+// patterns. A pattern matches a job if it matches its name or its command.
+type JobFilter struct {
+	Only    []*regexp.Regexp
+	Exclude []*regexp.Regexp
+}
+
+// ParseJobFilter parses comma-separated lists of patterns to include and
+// exclude jobs, and returns nil if both are empty. Patterns are globs (where
+// * matches any characters, including /, and ? any single one), which must
+// match the whole name or command, or regular expressions between slashes
+// (e.g. /^backup-/), which can match part of it.
+func ParseJobFilter(only string, exclude string) (*JobFilter, error) {
+	if only == "" && exclude == "" {
+		return nil, nil
+	}
+
+	var err error
+	filter := &JobFilter{}
+
+	if filter.Only, err = parseJobPatterns(only); err != nil {
+		return nil, err
+	}
+	if filter.Exclude, err = parseJobPatterns(exclude); err != nil {
+		return nil, err
+	}
+
+	return filter, nil
+}
+
+func parseJobPatterns(value string) ([]*regexp.Regexp, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	patterns := make([]*regexp.Regexp, 0)
+	for _, pattern := range strings.Split(value, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			return nil, fmt.Errorf("empty pattern in %q", value)
+		}
+
+		if len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+			matcher, err := regexp.Compile(pattern[1 : len(pattern)-1])
+			if err != nil {
+				return nil, fmt.Errorf("bad pattern %q (%v)", pattern, err)
+			}
+			patterns = append(patterns, matcher)
+			continue
+		}
+
+		patterns = append(patterns, globMatcher(pattern))
+	}
+
+	return patterns, nil
+}
+
+// globMatcher returns a regular expression matching the same strings as the
+// glob pattern.
+func globMatcher(pattern string) *regexp.Regexp {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.MustCompile(expr.String())
+}
+
+// Matches reports whether job is selected by the filter (all jobs are
+// selected by a nil filter).
+func (f *JobFilter) Matches(job *crontab.Job) bool {
+	if f == nil {
+		return true
+	}
+
+	if len(f.Only) > 0 && !matchesJob(f.Only, job) {
+		return false
+	}
+	return !matchesJob(f.Exclude, job)
+}
+
+func matchesJob(patterns []*regexp.Regexp, job *crontab.Job) bool {
+	for _, pattern := range patterns {
+		if job.Name != "" && pattern.MatchString(job.Name) || pattern.MatchString(job.Command) {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter removes the jobs that the filter doesn't select from tab.
+func (f *JobFilter) Filter(tab *crontab.Crontab) {
+	jobs := make([]*crontab.Job, 0, len(tab.Jobs))
+	for _, job := range tab.Jobs {
+		if f.Matches(job) {
+			jobs = append(jobs, job)
+		}
+	}
+	tab.Jobs = jobs
+}
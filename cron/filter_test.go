@@ -0,0 +1,59 @@
+package cron
+
+import (
+	"testing"
+
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var jobFilterTestCases = []struct {
+	only     string
+	exclude  string
+	job      *crontab.Job
+	expected bool
+}{
+	{"backup-*", "", &crontab.Job{Name: "backup-db"}, true},
+	{"backup-*", "", &crontab.Job{Name: "report"}, false},
+	{"backup-*", "", &crontab.Job{Name: "daily-backup-db"}, false},
+	{"backup-?", "", &crontab.Job{Name: "backup-1"}, true},
+	{"/backup/", "", &crontab.Job{Name: "daily-backup-db"}, true},
+	{"/^backup/", "", &crontab.Job{Name: "daily-backup-db"}, false},
+	{"report,backup-*", "", &crontab.Job{Name: "report"}, true},
+
+	// Commands match too, and * matches /
+	{"*/backup.sh", "", &crontab.Job{CrontabLine: crontab.CrontabLine{Command: "/opt/app/bin/backup.sh"}}, true},
+	{"/^php /", "", &crontab.Job{Name: "report", CrontabLine: crontab.CrontabLine{Command: "php report.php"}}, true},
+
+	{"", "backup-*", &crontab.Job{Name: "backup-db"}, false},
+	{"", "backup-*", &crontab.Job{Name: "report"}, true},
+	{"backup-*", "backup-test", &crontab.Job{Name: "backup-test"}, false},
+	{"backup-*", "backup-test", &crontab.Job{Name: "backup-db"}, true},
+
+	// Special characters of regular expressions are literal in globs
+	{"a.b", "", &crontab.Job{Name: "axb"}, false},
+	{"a.b", "", &crontab.Job{Name: "a.b"}, true},
+}
+
+func TestJobFilter(t *testing.T) {
+	for _, tt := range jobFilterTestCases {
+		filter, err := ParseJobFilter(tt.only, tt.exclude)
+		if assert.Nil(t, err, "%q %q", tt.only, tt.exclude) {
+			assert.Equal(t, tt.expected, filter.Matches(tt.job), "%q %q %+v", tt.only, tt.exclude, tt.job)
+		}
+	}
+}
+
+func TestParseJobFilter(t *testing.T) {
+	filter, err := ParseJobFilter("", "")
+	assert.Nil(t, err)
+	assert.Nil(t, filter)
+	assert.True(t, filter.Matches(&crontab.Job{Name: "anything"}))
+
+	_, err = ParseJobFilter("a,,b", "")
+	assert.NotNil(t, err)
+
+	_, err = ParseJobFilter("", "/(/")
+	assert.NotNil(t, err)
+}
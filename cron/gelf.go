@@ -0,0 +1,239 @@
+package cron
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samgaw/cronic/crontab"
+)
+
+var (
+	// How many messages to hold while Graylog is slow or unreachable (in
+	// excess, messages are dropped)
+	GELF_QUEUE_SIZE = 1024
+
+	// The largest UDP datagram to send (larger messages are chunked)
+	GELF_CHUNK_SIZE = 1420
+
+	GELF_DIAL_TIMEOUT = 5 * time.Second
+
+	// Graylog rejects GELF messages with more chunks
+	gelfMaxChunks = 128
+
+	gelfFieldReplacer = regexp.MustCompile(`[^\w.-]`)
+)
+
+// GELF sends the messages of jobs (their output, and what happens to their
+// runs) to Graylog in the GELF format, over UDP or TCP, in addition to
+// logging them. Their fields (e.g. job.name and run.id) become additional
+// fields (e.g. _job.name and _run.id).
+//
+// Messages are sent in the background, since logging must not block jobs.
+type GELF struct {
+	network string
+	addr    string
+	host    string
+	logger  *Logger
+
+	messages chan []byte
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+// NewGELF sends messages to addr, a URL such as udp://graylog:12201 or
+// tcp://graylog:12201 (or host:port, for UDP). logger reports errors
+// sending them.
+func NewGELF(addr string, logger *Logger) (*GELF, error) {
+	bad := fmt.Errorf("CRONIC: Bad GELF address: %s (expected e.g. udp://graylog:12201 or tcp://graylog:12201)", addr)
+
+	network, hostPort := "udp", addr
+	if strings.Contains(addr, "://") {
+		u, err := url.Parse(addr)
+		if err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") {
+			return nil, bad
+		}
+		network, hostPort = u.Scheme, u.Host
+	}
+
+	if _, _, err := net.SplitHostPort(hostPort); err != nil {
+		hostPort = net.JoinHostPort(hostPort, "12201")
+	}
+	if host, _, err := net.SplitHostPort(hostPort); err != nil || host == "" {
+		return nil, bad
+	}
+
+	hostname, _ := os.Hostname()
+
+	g := &GELF{
+		network:  network,
+		addr:     hostPort,
+		host:     hostname,
+		logger:   logger,
+		messages: make(chan []byte, GELF_QUEUE_SIZE),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go g.run()
+
+	return g, nil
+}
+
+// Logger returns a logger that logs like logger, and also sends the job's
+// messages to Graylog.
+func (g *GELF) Logger(logger *Logger, job *crontab.Job) *Logger {
+	return withHook(logger, logger.handler, &gelfHook{gelf: g})
+}
+
+// Close sends the messages that are left, and stops sending messages.
+func (g *GELF) Close() {
+	g.once.Do(func() { close(g.stop) })
+	<-g.done
+}
+
+func (g *GELF) run() {
+	defer close(g.done)
+
+	var conn net.Conn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	for {
+		var message []byte
+		select {
+		case message = <-g.messages:
+		case <-g.stop:
+			select {
+			case message = <-g.messages:
+			default:
+				return
+			}
+		}
+
+		if conn == nil {
+			var err error
+			conn, err = net.DialTimeout(g.network, g.addr, GELF_DIAL_TIMEOUT)
+			if err != nil {
+				g.logger.Debugf("CRONIC: Failed to connect to Graylog at %s, dropping a message: %v", g.addr, err)
+				continue
+			}
+		}
+
+		if err := g.send(conn, message); err != nil {
+			g.logger.Debugf("CRONIC: Failed to send a message to Graylog at %s: %v", g.addr, err)
+
+			// Reconnect for the next message (TCP connections don't
+			// recover from errors)
+			conn.Close()
+			conn = nil
+		}
+	}
+}
+
+// send sends a message: over TCP, followed by a null byte; over UDP, in
+// chunks if it's larger than GELF_CHUNK_SIZE.
+func (g *GELF) send(conn net.Conn, message []byte) error {
+	if g.network == "tcp" {
+		_, err := conn.Write(append(message, 0))
+		return err
+	}
+
+	if len(message) <= GELF_CHUNK_SIZE {
+		_, err := conn.Write(message)
+		return err
+	}
+
+	chunks, err := gelfChunks(message)
+	if err != nil {
+		return err
+	}
+
+	for _, chunk := range chunks {
+		if _, err := conn.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gelfChunks splits a message into chunks of GELF_CHUNK_SIZE, each with a
+// 12-byte header: the chunk magic bytes, the message's ID, and the number of
+// each chunk and of chunks.
+func gelfChunks(message []byte) ([][]byte, error) {
+	size := GELF_CHUNK_SIZE - 12
+	count := (len(message) + size - 1) / size
+	if count > gelfMaxChunks {
+		return nil, fmt.Errorf("message too large (%d bytes)", len(message))
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	chunks := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * size
+		if end > len(message) {
+			end = len(message)
+		}
+
+		chunk := append([]byte{0x1e, 0x0f}, id...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunks = append(chunks, append(chunk, message[i*size:end]...))
+	}
+	return chunks, nil
+}
+
+// gelfHook queues the entries of a job's logger as GELF messages.
+type gelfHook struct {
+	gelf *GELF
+}
+
+func (h *gelfHook) Fire(entry *Entry) error {
+	message := map[string]interface{}{
+		"version":       "1.1",
+		"host":          h.gelf.host,
+		"short_message": entry.Message,
+		"timestamp":     float64(entry.Time.UnixNano()) / float64(time.Second),
+		"level":         severity(entry.Level),
+	}
+
+	for key, value := range entry.Data {
+		name := "_" + gelfFieldReplacer.ReplaceAllString(key, "_")
+		if name == "_id" {
+			name = "_id_"
+		}
+
+		switch value := value.(type) {
+		case int, int64, uint64, float64, string:
+			message[name] = value
+		default:
+			message[name] = fmt.Sprint(value)
+		}
+	}
+
+	encoded, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case h.gelf.messages <- encoded:
+	default:
+		// Graylog is too slow
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package cron
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGELFSendsJobMessagesOverUDP(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer server.Close()
+
+	logger, channel := newTestLogger()
+
+	gelf, err := NewGELF("udp://"+server.LocalAddr().String(), logger)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer gelf.Close()
+
+	receive := func() []byte {
+		server.SetReadDeadline(time.Now().Add(time.Second))
+		buffer := make([]byte, 65536)
+		n, _, err := server.ReadFrom(buffer)
+		assert.Nil(t, err)
+		return buffer[:n]
+	}
+
+	job := &crontab.Job{CrontabLine: crontab.CrontabLine{Command: "./backup.sh"}, Name: "backup-db"}
+	gelf.Logger(JobLogger(logger, job), job).WithField("run.id", "42").Warn("CRONIC: Job is still running")
+
+	var message map[string]interface{}
+	if assert.Nil(t, json.Unmarshal(receive(), &message)) {
+		assert.Equal(t, "1.1", message["version"])
+		assert.Equal(t, "CRONIC: Job is still running", message["short_message"])
+		assert.Equal(t, 4.0, message["level"])
+		assert.Equal(t, "backup-db", message["_job.name"])
+		assert.Equal(t, "42", message["_run.id"])
+	}
+
+	// The entries are still logged
+	expectMessages(t, channel, "Job is still running")
+
+	// Large messages are chunked
+	gelf.Logger(JobLogger(logger, job), job).Info(strings.Repeat("x", 3*GELF_CHUNK_SIZE))
+
+	var reassembled []byte
+	for i := 0; i < 4; i++ {
+		chunk := receive()
+		if !assert.True(t, len(chunk) <= GELF_CHUNK_SIZE) {
+			return
+		}
+		assert.Equal(t, []byte{0x1e, 0x0f}, chunk[:2])
+		assert.Equal(t, []byte{byte(i), 4}, chunk[10:12])
+		reassembled = append(reassembled, chunk[12:]...)
+	}
+	assert.Nil(t, json.Unmarshal(reassembled, &message))
+}
+
+func TestGELFSendsJobMessagesOverTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer listener.Close()
+
+	received := make(chan string, 2)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		for {
+			message, err := reader.ReadString(0)
+			if err != nil {
+				return
+			}
+			received <- strings.TrimSuffix(message, "\x00")
+		}
+	}()
+
+	logger, _ := newTestLogger()
+
+	gelf, err := NewGELF("tcp://"+listener.Addr().String(), logger)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	job := &crontab.Job{CrontabLine: crontab.CrontabLine{Command: "./backup.sh"}}
+	jobLogger := gelf.Logger(JobLogger(logger, job), job)
+	jobLogger.Info("first")
+	jobLogger.Info("second")
+
+	// Close sends what's left
+	gelf.Close()
+
+	for _, expected := range []string{"first", "second"} {
+		select {
+		case message := <-received:
+			assert.Contains(t, message, `"short_message":"`+expected+`"`)
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %q", expected)
+		}
+	}
+}
+
+func TestNewGELFRejectsBadAddresses(t *testing.T) {
+	logger, _ := newTestLogger()
+
+	for _, addr := range []string{"http://graylog:12201", "udp://", ":12201"} {
+		_, err := NewGELF(addr, logger)
+		assert.NotNil(t, err, addr)
+	}
+
+	gelf, err := NewGELF("graylog", logger)
+	if assert.Nil(t, err) {
+		assert.Equal(t, "udp", gelf.network)
+		assert.Equal(t, "graylog:12201", gelf.addr)
+		gelf.Close()
+	}
+}
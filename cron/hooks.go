@@ -0,0 +1,114 @@
+package cron
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/samgaw/cronic/crontab"
+)
+
+var (
+	HOOK_TIMEOUT = time.Minute
+)
+
+// hookEnviron describes a finished run to its hook, whose output is in
+// outputFile.
+func hookEnviron(job *crontab.Job, result *RunResult, outputFile string) []string {
+	env := []string{
+		"CRONIC_JOB_NAME=" + job.Name,
+		"CRONIC_JOB_COMMAND=" + job.Command,
+		"CRONIC_RUN_ID=" + result.RunID,
+		"CRONIC_SUCCESS=" + strconv.FormatBool(result.Success),
+		"CRONIC_TIMED_OUT=" + strconv.FormatBool(result.TimedOut),
+		"CRONIC_ERROR=" + result.Error,
+		"CRONIC_STARTED_AT=" + result.StartedAt.Format(time.RFC3339),
+		"CRONIC_FINISHED_AT=" + result.FinishedAt.Format(time.RFC3339),
+		"CRONIC_DURATION=" + strconv.FormatFloat(result.FinishedAt.Sub(result.StartedAt).Seconds(), 'f', 3, 64),
+		"CRONIC_RETRY=" + strconv.Itoa(result.Retry),
+		"CRONIC_OUTPUT_FILE=" + outputFile,
+	}
+
+	// Empty if the command didn't run
+	exitCode := ""
+	if result.ExitCode != nil {
+		exitCode = strconv.Itoa(*result.ExitCode)
+	}
+	return append(env, "CRONIC_EXIT_CODE="+exitCode)
+}
+
+// hookOutputFile returns the path of a file holding the output of a run:
+// the archived one if there's an archive, or a temporary file holding the
+// last lines of output otherwise, which the returned function removes.
+func hookOutputFile(opts *Options, result *RunResult, output []OutputLine) (string, func(), error) {
+	if opts.Archive != nil {
+		path, err := opts.Archive.file(result.RunID)
+		return path, func() {}, err
+	}
+
+	file, err := ioutil.TempFile("", "cronic-output-")
+	if err != nil {
+		return "", func() {}, err
+	}
+	remove := func() { os.Remove(file.Name()) }
+
+	for _, line := range output {
+		fmt.Fprintln(file, line.Line)
+	}
+
+	if err := file.Close(); err != nil {
+		remove()
+		return "", func() {}, err
+	}
+	return file.Name(), remove, nil
+}
+
+// runHook runs the job's on-success or on-failure command, if any, once a
+// run is over (and won't be retried). The hook is stopped if it doesn't
+// complete within HOOK_TIMEOUT.
+func runHook(cronCtx *crontab.Context, opts *Options, namespace *Namespace, job *crontab.Job, result *RunResult, output []OutputLine, logger *Logger) {
+	name, hook := "on-success", job.OnSuccess
+	if !result.Success {
+		name, hook = "on-failure", job.OnFailure
+	}
+
+	if hook == "" || result.WillRetry {
+		return
+	}
+
+	hookLogger := logger.WithField("hook", name)
+
+	outputFile, remove, err := hookOutputFile(opts, result, output)
+	if err != nil {
+		hookLogger.Warnf("CRONIC: Failed to provide the run's output to the %s hook: %v", name, err)
+	}
+	defer remove()
+
+	ctx, cancel := context.WithTimeout(context.Background(), HOOK_TIMEOUT)
+	defer cancel()
+
+	env, err := opts.resolveSecrets(ctx, jobEnviron(cronCtx, opts, namespace, job))
+	if err != nil {
+		hookLogger.Errorf("CRONIC: Error running %s hook: %v", name, err)
+		return
+	}
+
+	command := &Command{
+		Shell:   jobShell(cronCtx, job),
+		Command: hook,
+		Env:     append(env, hookEnviron(job, result, outputFile)...),
+		Dir:     JobDir(cronCtx, job),
+	}
+
+	hookOutput := &limitedBuffer{limit: DEBUG_COMMAND_OUTPUT_LIMIT}
+
+	if err := opts.executor().Run(ctx, command, hookOutput, hookOutput); err != nil {
+		hookLogger.WithField("hook_output", hookOutput.String()).Errorf("CRONIC: Error running %s hook: %v", name, err)
+		return
+	}
+
+	hookLogger.WithField("hook_output", hookOutput.String()).Debugf("CRONIC: Ran %s hook", name)
+}
@@ -0,0 +1,115 @@
+package cron
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func hookTestResult(success bool) *RunResult {
+	startedAt := time.Date(2018, 4, 7, 9, 30, 0, 0, time.UTC)
+	exitCode := 0
+	if !success {
+		exitCode = 3
+	}
+
+	return &RunResult{
+		RunID:      "20180407T093000Z-0-0",
+		StartedAt:  startedAt,
+		FinishedAt: startedAt.Add(1500 * time.Millisecond),
+		Success:    success,
+		ExitCode:   &exitCode,
+	}
+}
+
+func TestRunHook(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cronic-hooks")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	env := filepath.Join(dir, "env")
+	job := &crontab.Job{
+		CrontabLine: crontab.CrontabLine{Command: "false"},
+		Name:        "backup",
+		OnSuccess:   "echo ok > " + env,
+		OnFailure:   `echo "$CRONIC_JOB_NAME $CRONIC_EXIT_CODE $CRONIC_DURATION $CRONIC_SUCCESS" > ` + env + `; cat "$CRONIC_OUTPUT_FILE" >> ` + env,
+	}
+
+	output := []OutputLine{{Channel: "stdout", Line: "hello"}, {Channel: "stderr", Line: "oops"}}
+
+	logger, _ := newTestLogger()
+	runHook(&basicContext, &basicOptions, nil, job, hookTestResult(false), output, logger)
+
+	contents, err := ioutil.ReadFile(env)
+	if assert.Nil(t, err) {
+		assert.Equal(t, "backup 3 1.500 false\nhello\noops\n", string(contents))
+	}
+
+	runHook(&basicContext, &basicOptions, nil, job, hookTestResult(true), output, logger)
+
+	contents, err = ioutil.ReadFile(env)
+	if assert.Nil(t, err) {
+		assert.Equal(t, "ok\n", string(contents))
+	}
+}
+
+func TestRunHookSkipsRetriedRuns(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cronic-hooks")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	marker := filepath.Join(dir, "marker")
+	job := &crontab.Job{OnFailure: "touch " + marker}
+
+	result := hookTestResult(false)
+	result.WillRetry = true
+
+	logger, _ := newTestLogger()
+	runHook(&basicContext, &basicOptions, nil, job, result, nil, logger)
+
+	_, err = os.Stat(marker)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRunHookProvidesArchivedOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cronic-hooks")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	archive, err := NewArchive(filepath.Join(dir, "archive"))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	result := hookTestResult(true)
+
+	writer, err := archive.create(result.RunID)
+	if !assert.Nil(t, err) {
+		return
+	}
+	writer.writeLine("archived")
+	assert.Nil(t, writer.Close())
+
+	env := filepath.Join(dir, "env")
+	job := &crontab.Job{OnSuccess: `echo "$CRONIC_OUTPUT_FILE" > ` + env}
+
+	logger, _ := newTestLogger()
+	runHook(&basicContext, &Options{Archive: archive}, nil, job, result, nil, logger)
+
+	contents, err := ioutil.ReadFile(env)
+	if assert.Nil(t, err) {
+		assert.Equal(t, filepath.Join(dir, "archive", result.RunID+".log")+"\n", string(contents))
+	}
+}
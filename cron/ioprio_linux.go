@@ -0,0 +1,30 @@
+package cron
+
+import (
+	"syscall"
+
+	"github.com/samgaw/cronic/crontab"
+)
+
+// See ioprio_set(2)
+const (
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+)
+
+var ioprioClasses = map[string]int{
+	crontab.IOClassRealtime:   1,
+	crontab.IOClassBestEffort: 2,
+	crontab.IOClassIdle:       3,
+}
+
+// setIOPriority sets the I/O scheduling class and level of a process.
+func setIOPriority(pid int, class string, level int) error {
+	priority := ioprioClasses[class]<<ioprioClassShift | level
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(pid), uintptr(priority))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package cron
+
+import (
+	"errors"
+)
+
+// setIOPriority sets the I/O scheduling class and level of a process, which
+// only Linux supports.
+func setIOPriority(pid int, class string, level int) error {
+	return errors.New("I/O scheduling classes are only supported on Linux")
+}
@@ -0,0 +1,175 @@
+package cron
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/samgaw/cronic/crontab"
+)
+
+var (
+	// Where journald receives entries over its native protocol
+	JOURNAL_SOCKET = "/run/systemd/journal/socket"
+
+	// The SYSLOG_IDENTIFIER of unnamed jobs without a syslog-tag
+	JOURNAL_IDENTIFIER = "cronic"
+)
+
+// syslog(3) severities, which journald (and GELF) use as priorities
+const (
+	severityErr     = 3
+	severityWarning = 4
+	severityInfo    = 6
+	severityDebug   = 7
+)
+
+// severity returns the syslog severity of a level.
+func severity(level crontab.Level) int {
+	switch level {
+	case crontab.LevelError:
+		return severityErr
+	case crontab.LevelWarn:
+		return severityWarning
+	case crontab.LevelInfo:
+		return severityInfo
+	default:
+		return severityDebug
+	}
+}
+
+// Journal sends the messages of jobs (their output, and what happens to
+// their runs) to the systemd journal using its native protocol, instead of
+// logging them to stderr. Each job's entries have its name (or syslog-tag)
+// as SYSLOG_IDENTIFIER, so "journalctl -t NAME" shows them, and the fields
+// cronic would have logged (e.g. JOB_NAME, RUN_ID or CHANNEL).
+type Journal struct {
+	conn *net.UnixConn
+}
+
+// NewJournal connects to journald's socket (JOURNAL_SOCKET).
+func NewJournal() (*Journal, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: JOURNAL_SOCKET, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("CRONIC: Failed to connect to journald at %s: %v", JOURNAL_SOCKET, err)
+	}
+	return &Journal{conn: conn}, nil
+}
+
+// Logger returns a logger that sends the job's messages to the journal
+// (along with the hooks of logger).
+func (j *Journal) Logger(logger *Logger, job *crontab.Job) *Logger {
+	identifier := JOURNAL_IDENTIFIER
+	if job.SyslogTag != "" {
+		identifier = job.SyslogTag
+	} else if job.Name != "" {
+		identifier = job.Name
+	}
+
+	return withHook(logger, discardOutput{logger.handler}, &journalHook{journal: j, job: job, identifier: identifier})
+}
+
+func (j *Journal) Close() {
+	j.conn.Close()
+}
+
+// journalHook sends the entries of a job's logger to the journal.
+type journalHook struct {
+	journal    *Journal
+	job        *crontab.Job
+	identifier string
+}
+
+func (h *journalHook) Fire(entry *Entry) error {
+	fields := map[string]string{
+		"MESSAGE":           entry.Message,
+		"PRIORITY":          fmt.Sprint(h.priority(entry)),
+		"SYSLOG_IDENTIFIER": h.identifier,
+	}
+
+	if h.job.SyslogFacility != "" {
+		fields["SYSLOG_FACILITY"] = fmt.Sprint(syslogFacilities[h.job.SyslogFacility] >> 3)
+	}
+
+	for key, value := range entry.Data {
+		if name := journalFieldName(key); name != "" {
+			if _, ok := fields[name]; !ok {
+				fields[name] = fmt.Sprint(value)
+			}
+		}
+	}
+
+	_, err := h.journal.conn.Write(encodeJournalEntry(fields))
+	return err
+}
+
+// priority returns the priority of an entry: lines of output at the default
+// level are info on stdout and errors on stderr (like systemd's own
+// StandardError=journal), and other entries have the priority of their
+// level.
+func (h *journalHook) priority(entry *Entry) int {
+	switch entry.Data["channel"] {
+	case "stdout":
+		if h.job.StdoutLevel == nil {
+			return severityInfo
+		}
+	case "stderr":
+		if h.job.StderrLevel == nil {
+			return severityErr
+		}
+	}
+
+	return severity(entry.Level)
+}
+
+// journalFieldName turns the name of a field into that of a journal
+// field, which only has uppercase letters, digits and underscores (and
+// can't start with an underscore, which is for trusted fields): e.g.
+// "job.name" becomes JOB_NAME. It returns an empty name if nothing's left.
+func journalFieldName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, key)
+
+	name = strings.TrimLeft(name, "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return ""
+	}
+	return name
+}
+
+// encodeJournalEntry encodes fields in journald's native format: one
+// NAME=value line per field, or, for values with a newline, the name on its
+// own line and the value prefixed with its length (as 64 bits, little
+// endian).
+func encodeJournalEntry(fields map[string]string) []byte {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buffer bytes.Buffer
+	for _, name := range names {
+		value := fields[name]
+		if !strings.Contains(value, "\n") {
+			fmt.Fprintf(&buffer, "%s=%s\n", name, value)
+			continue
+		}
+
+		buffer.WriteString(name + "\n")
+		binary.Write(&buffer, binary.LittleEndian, uint64(len(value)))
+		buffer.WriteString(value + "\n")
+	}
+	return buffer.Bytes()
+}
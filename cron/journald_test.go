@@ -0,0 +1,88 @@
+package cron
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournalSendsJobMessages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cronic-journal")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(socket string) { JOURNAL_SOCKET = socket }(JOURNAL_SOCKET)
+	JOURNAL_SOCKET = filepath.Join(dir, "socket")
+
+	server, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: JOURNAL_SOCKET, Net: "unixgram"})
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer server.Close()
+
+	journal, err := NewJournal()
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer journal.Close()
+
+	receive := func() string {
+		server.SetReadDeadline(time.Now().Add(time.Second))
+		buffer := make([]byte, 65536)
+		n, err := server.Read(buffer)
+		assert.Nil(t, err)
+		return string(buffer[:n])
+	}
+
+	job := &crontab.Job{CrontabLine: crontab.CrontabLine{Command: "./backup.sh"}, Name: "backup-db"}
+
+	logger, channel := newTestLogger()
+	hooked := make(chan *Entry, TEST_CHANNEL_BUFFER_SIZE)
+	logger = withHook(logger, logger.handler, testHook(hooked))
+	jobLogger := journal.Logger(JobLogger(logger, job), job)
+
+	jobLogger.WithField("run.id", "42").Warn("CRONIC: Job is still running")
+	assert.Equal(t, "JOB_NAME=backup-db\nJOB_SCHEDULE=\nMESSAGE=CRONIC: Job is still running\nPRIORITY=4\nRUN_ID=42\nSYSLOG_IDENTIFIER=backup-db\n", receive())
+
+	// The entries aren't logged, but the other hooks still get them
+	expectMessages(t, hooked, "Job is still running")
+	assert.Len(t, channel, 0)
+
+	// Output lines on stderr are errors, unless the job sets their level
+	jobLogger.WithField("channel", "stderr").Info("connection refused")
+	assert.Contains(t, receive(), "PRIORITY=3\n")
+
+	level := crontab.LevelWarn
+	job.StderrLevel = &level
+	jobLogger.WithField("channel", "stderr").Warn("connection refused")
+	assert.Contains(t, receive(), "PRIORITY=4\n")
+
+	// The syslog annotations apply too
+	job.SyslogTag = "backups"
+	job.SyslogFacility = "local3"
+	journal.Logger(JobLogger(logger, job), job).Info("done")
+	message := receive()
+	assert.Contains(t, message, "SYSLOG_IDENTIFIER=backups\n")
+	assert.Contains(t, message, "SYSLOG_FACILITY=19\n")
+}
+
+func TestEncodeJournalEntry(t *testing.T) {
+	assert.Equal(t, "MESSAGE\n\x03\x00\x00\x00\x00\x00\x00\x00a\nb\nPRIORITY=6\n", string(encodeJournalEntry(map[string]string{"MESSAGE": "a\nb", "PRIORITY": "6"})))
+}
+
+func TestJournalFieldName(t *testing.T) {
+	assert.Equal(t, "JOB_NAME", journalFieldName("job.name"))
+	assert.Equal(t, "OUTPUT_TAIL", journalFieldName("output_tail"))
+	assert.Equal(t, "TRUSTED", journalFieldName("_trusted"))
+	assert.Equal(t, "", journalFieldName("42"))
+	assert.Equal(t, "", journalFieldName("..."))
+}
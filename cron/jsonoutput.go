@@ -0,0 +1,63 @@
+package cron
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/samgaw/cronic/crontab"
+)
+
+// The fields of JSON output lines that are their message
+var jsonMessageFields = []string{"msg", "message"}
+
+// jsonOutput returns whether to log the fields of the job's output lines
+// that are JSON objects.
+func (opts *Options) jsonOutput(job *crontab.Job) bool {
+	if job.JSONOutput != nil {
+		return *job.JSONOutput
+	}
+	return opts.JSONOutput
+}
+
+// logOutputLine logs a line of a job's output. With jsonOutput, lines that
+// are JSON objects are logged as their fields (merged with cronic's, which
+// win when they clash), rather than as a string that log pipelines would
+// have to decode a second time. Their "msg" (or "message") is the message,
+// and their "level" the level, if it's one of cronic's (e.g. not panic or
+// fatal).
+func logOutputLine(lineLogger *Logger, level crontab.Level, line string, jsonOutput bool) {
+	if !jsonOutput || !strings.HasPrefix(strings.TrimSpace(line), "{") {
+		lineLogger.Log(level, line)
+		return
+	}
+
+	fields := make(map[string]interface{})
+
+	// Keep numbers as they are (e.g. large IDs would lose precision as
+	// floats)
+	decoder := json.NewDecoder(bytes.NewBufferString(line))
+	decoder.UseNumber()
+	if err := decoder.Decode(&fields); err != nil || decoder.More() {
+		lineLogger.Log(level, line)
+		return
+	}
+
+	message := ""
+	for _, field := range jsonMessageFields {
+		if value, ok := fields[field].(string); ok {
+			message = value
+			delete(fields, field)
+			break
+		}
+	}
+
+	if value, ok := fields["level"].(string); ok {
+		if parsed, err := crontab.ParseLevel(value); err == nil {
+			level = parsed
+			delete(fields, "level")
+		}
+	}
+
+	lineLogger.WithFields(fields).WithFields(lineLogger.Data).Log(level, message)
+}
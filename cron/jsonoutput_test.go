@@ -0,0 +1,78 @@
+package cron
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogOutputLine(t *testing.T) {
+	type testCase struct {
+		line    string
+		message string
+		level   crontab.Level
+		fields  Fields
+	}
+
+	testCases := []testCase{
+		{"not json", "not json", crontab.LevelInfo, Fields{"channel": "stdout"}},
+		{`{"msg": "hello", "rows": 12}`, "hello", crontab.LevelInfo, Fields{"channel": "stdout", "rows": json.Number("12")}},
+		{`{"message": "oops", "level": "error"}`, "oops", crontab.LevelError, Fields{"channel": "stdout"}},
+		// Levels that aren't cronic's are kept as fields
+		{`{"msg": "bye", "level": "fatal"}`, "bye", crontab.LevelInfo, Fields{"channel": "stdout", "level": "fatal"}},
+		{`{"id": 12345678901234567890}`, "", crontab.LevelInfo, Fields{"channel": "stdout", "id": json.Number("12345678901234567890")}},
+
+		// Cronic's fields win
+		{`{"msg": "hi", "channel": "fake"}`, "hi", crontab.LevelInfo, Fields{"channel": "stdout"}},
+
+		// Lines that aren't a JSON object are logged as they are
+		{`{"msg": "truncated`, `{"msg": "truncated`, crontab.LevelInfo, Fields{"channel": "stdout"}},
+		{`{"a": 1} {"b": 2}`, `{"a": 1} {"b": 2}`, crontab.LevelInfo, Fields{"channel": "stdout"}},
+		{`[1, 2]`, `[1, 2]`, crontab.LevelInfo, Fields{"channel": "stdout"}},
+	}
+
+	for _, tc := range testCases {
+		logger, channel := newTestLogger()
+		logOutputLine(logger.WithField("channel", "stdout"), crontab.LevelInfo, tc.line, true)
+
+		entry := <-channel
+		assert.Equal(t, tc.message, entry.Message, tc.line)
+		assert.Equal(t, tc.level, entry.Level, tc.line)
+		assert.Equal(t, tc.fields, entry.Data, tc.line)
+	}
+
+	// Without JSON output, lines are logged as they are
+	logger, channel := newTestLogger()
+	logOutputLine(logger, crontab.LevelInfo, `{"msg": "hello"}`, false)
+	assert.Equal(t, `{"msg": "hello"}`, (<-channel).Message)
+}
+
+func TestRunJobLogsJSONOutput(t *testing.T) {
+	logger, channel := newTestLogger()
+
+	status := newTestStatus(`echo '{"msg": "Backed up", "rows": 12}'`)
+
+	opts := basicOptions
+	opts.JSONOutput = true
+
+	assert.Nil(t, runJob(context.Background(), &basicContext, &opts, status, logger))
+	expectMessages(t, channel, "Starting")
+
+	entry := <-channel
+	assert.Equal(t, "Backed up", entry.Message)
+	assert.Equal(t, json.Number("12"), entry.Data["rows"])
+
+	// The output itself is kept as is
+	assert.Equal(t, `{"msg": "Backed up", "rows": 12}`, status.outputTail(1)[0].Line)
+
+	// Jobs can opt out
+	disabled := false
+	status.Job.JSONOutput = &disabled
+
+	assert.Nil(t, runJob(context.Background(), &basicContext, &opts, status, logger))
+	expectMessages(t, channel, "Starting", `^\{"msg": "Backed up", "rows": 12\}$`)
+}
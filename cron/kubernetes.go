@@ -0,0 +1,466 @@
+package cron
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samgaw/cronic/crontab"
+
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	// Where pods find the credentials of their service account
+	KUBERNETES_SERVICE_ACCOUNT_DIR = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+	// How often to check on the Jobs of runs
+	KUBERNETES_POLL_INTERVAL = time.Second
+)
+
+// The name of the container that runs the command in the pods of Jobs
+const kubernetesContainerName = "job"
+
+// KubernetesExecutor runs commands in containers (see Command.Image), as
+// Kubernetes Jobs: each run creates a Job from a template (the command's, or
+// the executor's), relays the output of its pod until it completes, and
+// deletes it.
+type KubernetesExecutor struct {
+	// The API server, and the namespace of Jobs whose template doesn't have
+	// one
+	URL       string
+	Namespace string
+
+	// The Job manifest that runs have their Job created from, unless their
+	// command has a template of its own (nil for a bare Job)
+	Template map[string]interface{}
+
+	tokenFile string
+	client    *http.Client
+}
+
+// NewKubernetesExecutor returns an executor using the API server at apiURL
+// (without authentication, e.g. that of kubectl proxy), or the cluster's it
+// runs in, with its service account, if apiURL is empty. The namespace
+// defaults to that of the service account, and templatePath (if set) is the
+// Job manifest (as YAML or JSON) of commands that don't have one.
+func NewKubernetesExecutor(apiURL string, namespace string, templatePath string) (*KubernetesExecutor, error) {
+	executor := &KubernetesExecutor{URL: strings.TrimSuffix(apiURL, "/"), Namespace: namespace}
+
+	if apiURL == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, fmt.Errorf("CRONIC: Not running in a Kubernetes cluster (see -kubernetes-api)")
+		}
+
+		ca, err := ioutil.ReadFile(filepath.Join(KUBERNETES_SERVICE_ACCOUNT_DIR, "ca.crt"))
+		if err != nil {
+			return nil, fmt.Errorf("CRONIC: Can't read the cluster's CA: %v", err)
+		}
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(ca)
+
+		executor.URL = "https://" + strings.Join([]string{host, port}, ":")
+		executor.tokenFile = filepath.Join(KUBERNETES_SERVICE_ACCOUNT_DIR, "token")
+		executor.client = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	} else {
+		executor.client = &http.Client{}
+	}
+
+	if executor.Namespace == "" {
+		executor.Namespace = "default"
+		if contents, err := ioutil.ReadFile(filepath.Join(KUBERNETES_SERVICE_ACCOUNT_DIR, "namespace")); err == nil {
+			executor.Namespace = strings.TrimSpace(string(contents))
+		}
+	}
+
+	if templatePath != "" {
+		template, err := ReadJobTemplate(templatePath)
+		if err != nil {
+			return nil, fmt.Errorf("CRONIC: Bad Kubernetes Job template: %v", err)
+		}
+		executor.Template = template
+	}
+
+	return executor, nil
+}
+
+// ReadJobTemplate reads a Job manifest, as YAML (or JSON).
+func ReadJobTemplate(path string) (map[string]interface{}, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest interface{}
+	if err := yaml.Unmarshal(contents, &manifest); err != nil {
+		return nil, err
+	}
+
+	template, ok := jsonValue(manifest).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s isn't a Job manifest", path)
+	}
+	if kind, ok := template["kind"]; ok && kind != "Job" {
+		return nil, fmt.Errorf("%s is a %v, not a Job", path, kind)
+	}
+	return template, nil
+}
+
+// jsonValue converts a value decoded from YAML (whose maps have interface{}
+// keys) to one that encodes to JSON.
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			converted[fmt.Sprint(key)] = jsonValue(item)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(v))
+		for i, item := range v {
+			converted[i] = jsonValue(item)
+		}
+		return converted
+	default:
+		return v
+	}
+}
+
+func (k *KubernetesExecutor) Run(ctx context.Context, command *Command, stdout io.Writer, stderr io.Writer) error {
+	if command.Stdin != "" || command.StdinFile != "" {
+		return &StartError{fmt.Errorf("commands run in containers can't have a stdin")}
+	}
+	if len(command.Mounts) > 0 {
+		return &StartError{fmt.Errorf("mounts aren't supported with Kubernetes (use volumes in a Job template)")}
+	}
+
+	job, namespace, err := k.newJob(command)
+	if err != nil {
+		return &StartError{err}
+	}
+
+	var created struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+	}
+	if err := k.call(ctx, http.MethodPost, fmt.Sprintf("/apis/batch/v1/namespaces/%s/jobs", namespace), job, &created); err != nil {
+		return &StartError{fmt.Errorf("can't create the Job: %v", err)}
+	}
+	name := created.Metadata.Name
+
+	// The Job (and its pod) is deleted even if the run is over (e.g. it
+	// timed out), so this doesn't use ctx
+	defer k.call(context.Background(), http.MethodDelete, fmt.Sprintf("/apis/batch/v1/namespaces/%s/jobs/%s?propagationPolicy=Background", namespace, name), nil, nil)
+
+	// The pod's output is followed once it started, until it completes
+	logsCtx, stopLogs := context.WithCancel(context.Background())
+	defer stopLogs()
+	logsDone := make(chan struct{})
+	following := false
+
+	for {
+		pod, err := k.jobPod(ctx, namespace, name)
+		if err != nil && ctx.Err() == nil {
+			return err
+		}
+
+		if pod != nil && !following && pod.Status.Phase != "Pending" {
+			following = true
+			go func() {
+				defer close(logsDone)
+				k.followLogs(logsCtx, namespace, pod.Metadata.Name, stdout)
+			}()
+		}
+
+		if pod != nil && (pod.Status.Phase == "Succeeded" || pod.Status.Phase == "Failed") {
+			<-logsDone
+			return pod.exitError()
+		}
+
+		select {
+		case <-command.Signals:
+			// Pods can't be signalled through the API
+		case <-ctx.Done():
+			stopLogs()
+			if following {
+				<-logsDone
+			}
+			return ctx.Err()
+		case <-time.After(KUBERNETES_POLL_INTERVAL):
+		}
+	}
+}
+
+// newJob returns the Job that runs command, and its namespace.
+func (k *KubernetesExecutor) newJob(command *Command) (map[string]interface{}, string, error) {
+	template := k.Template
+	if command.JobTemplate != "" {
+		path := command.JobTemplate
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(command.Dir, path)
+		}
+
+		var err error
+		template, err = ReadJobTemplate(path)
+		if err != nil {
+			return nil, "", fmt.Errorf("bad Job template: %v", err)
+		}
+	} else {
+		// The template is modified below
+		template = jsonCopy(template)
+	}
+	if template == nil {
+		template = make(map[string]interface{})
+	}
+
+	job := template
+	job["apiVersion"] = "batch/v1"
+	job["kind"] = "Job"
+
+	metadata := jsonObject(job, "metadata")
+	delete(metadata, "name")
+	metadata["generateName"] = "cronic-"
+	jsonObject(metadata, "labels")["app.kubernetes.io/managed-by"] = "cronic"
+
+	namespace, _ := metadata["namespace"].(string)
+	if namespace == "" {
+		namespace = k.Namespace
+	}
+
+	spec := jsonObject(job, "spec")
+
+	// Cronic retries runs itself (see the retries annotation)
+	if _, ok := spec["backoffLimit"]; !ok {
+		spec["backoffLimit"] = 0
+	}
+
+	podSpec := jsonObject(jsonObject(spec, "template"), "spec")
+	podSpec["restartPolicy"] = "Never"
+
+	containers, _ := podSpec["containers"].([]interface{})
+	var container map[string]interface{}
+	for _, c := range containers {
+		if c, ok := c.(map[string]interface{}); ok && c["name"] == kubernetesContainerName {
+			container = c
+		}
+	}
+	if container == nil {
+		container = map[string]interface{}{"name": kubernetesContainerName}
+		containers = append([]interface{}{container}, containers...)
+		podSpec["containers"] = containers
+	}
+
+	container["image"] = command.Image
+	switch command.ImagePull {
+	case crontab.PullAlways:
+		container["imagePullPolicy"] = "Always"
+	case crontab.PullNever:
+		container["imagePullPolicy"] = "Never"
+	case crontab.PullMissing:
+		container["imagePullPolicy"] = "IfNotPresent"
+	}
+
+	if len(command.Argv) > 0 {
+		container["command"] = command.Argv
+	} else {
+		container["command"] = []string{command.Shell, "-c", command.Command}
+	}
+	delete(container, "args")
+
+	env, _ := container["env"].([]interface{})
+	for _, kv := range command.Env {
+		if i := strings.Index(kv, "="); i != -1 {
+			env = append(env, map[string]interface{}{"name": kv[:i], "value": kv[i+1:]})
+		}
+	}
+	container["env"] = env
+
+	limits := make(map[string]interface{})
+	if command.Limits.Memory > 0 {
+		limits["memory"] = strconv.FormatInt(command.Limits.Memory, 10)
+	}
+	if command.Limits.CPUs > 0 {
+		limits["cpu"] = fmt.Sprintf("%dm", int(command.Limits.CPUs*1000))
+	}
+	if len(limits) > 0 {
+		resources := jsonObject(container, "resources")
+		for name, limit := range limits {
+			jsonObject(resources, "limits")[name] = limit
+		}
+	}
+
+	return job, namespace, nil
+}
+
+// jsonObject returns the object at key in parent, adding it if it's missing.
+func jsonObject(parent map[string]interface{}, key string) map[string]interface{} {
+	object, ok := parent[key].(map[string]interface{})
+	if !ok {
+		object = make(map[string]interface{})
+		parent[key] = object
+	}
+	return object
+}
+
+// jsonCopy returns a deep copy of a JSON object (or nil).
+func jsonCopy(object map[string]interface{}) map[string]interface{} {
+	if object == nil {
+		return nil
+	}
+
+	encoded, _ := json.Marshal(object)
+
+	var copied map[string]interface{}
+	json.Unmarshal(encoded, &copied)
+	return copied
+}
+
+type kubernetesPod struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Status struct {
+		Phase             string `json:"phase"`
+		Message           string `json:"message"`
+		ContainerStatuses []struct {
+			Name  string `json:"name"`
+			State struct {
+				Terminated *struct {
+					ExitCode int    `json:"exitCode"`
+					Reason   string `json:"reason"`
+				} `json:"terminated"`
+			} `json:"state"`
+		} `json:"containerStatuses"`
+	} `json:"status"`
+}
+
+// exitError returns the error of a completed pod: nil if it succeeded, or a
+// containerExitError if its command failed.
+func (p *kubernetesPod) exitError() error {
+	if p.Status.Phase == "Succeeded" {
+		return nil
+	}
+
+	for _, status := range p.Status.ContainerStatuses {
+		if status.Name == kubernetesContainerName && status.State.Terminated != nil {
+			return &containerExitError{code: status.State.Terminated.ExitCode}
+		}
+	}
+
+	if p.Status.Message != "" {
+		return fmt.Errorf("the pod failed: %s", p.Status.Message)
+	}
+	return fmt.Errorf("the pod failed")
+}
+
+// jobPod returns the pod of a Job, if it was created.
+func (k *KubernetesExecutor) jobPod(ctx context.Context, namespace string, name string) (*kubernetesPod, error) {
+	var pods struct {
+		Items []kubernetesPod `json:"items"`
+	}
+	query := url.Values{"labelSelector": {"job-name=" + name}}
+	if err := k.call(ctx, http.MethodGet, fmt.Sprintf("/api/v1/namespaces/%s/pods?%s", namespace, query.Encode()), nil, &pods); err != nil {
+		return nil, fmt.Errorf("can't get the Job's pod: %v", err)
+	}
+
+	if len(pods.Items) == 0 {
+		return nil, nil
+	}
+	return &pods.Items[0], nil
+}
+
+// followLogs copies the output of a pod's container to out (Kubernetes
+// doesn't tell stdout and stderr apart), until it completes (or ctx is
+// done).
+func (k *KubernetesExecutor) followLogs(ctx context.Context, namespace string, pod string, out io.Writer) error {
+	response, err := k.do(ctx, http.MethodGet, fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/log?follow=true&container=%s", namespace, pod, kubernetesContainerName), nil)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	_, err = io.Copy(out, response.Body)
+	return err
+}
+
+// call calls the API server, with body encoded as JSON (if any), and decodes
+// its JSON response into result (if any).
+func (k *KubernetesExecutor) call(ctx context.Context, method string, path string, body interface{}, result interface{}) error {
+	response, err := k.do(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if result == nil {
+		io.Copy(ioutil.Discard, response.Body)
+		return nil
+	}
+	return json.NewDecoder(response.Body).Decode(result)
+}
+
+// do sends a request to the API server, and returns its response if it
+// succeeded.
+func (k *KubernetesExecutor) do(ctx context.Context, method string, path string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	request, err := http.NewRequest(method, k.URL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	// Service account tokens are rotated, so the file is read each time
+	if k.tokenFile != "" {
+		token, err := ioutil.ReadFile(k.tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't read the service account's token: %v", err)
+		}
+		request.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	response, err := k.client.Do(request.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode >= 300 {
+		defer response.Body.Close()
+
+		var status struct {
+			Message string `json:"message"`
+		}
+		contents, _ := ioutil.ReadAll(response.Body)
+		json.Unmarshal(contents, &status)
+		if status.Message != "" {
+			return nil, fmt.Errorf("the API server responded with status %d: %s", response.StatusCode, status.Message)
+		}
+		return nil, fmt.Errorf("the API server responded with status %d", response.StatusCode)
+	}
+
+	return response, nil
+}
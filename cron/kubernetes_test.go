@@ -0,0 +1,212 @@
+package cron
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeKubernetes serves the parts of the Kubernetes API that
+// KubernetesExecutor uses, for a Job whose pod is pending when it's first
+// polled, and then in phase.
+type fakeKubernetes struct {
+	mu       sync.Mutex
+	job      map[string]interface{}
+	polls    int
+	phase    string
+	exitCode int
+	deleted  string
+}
+
+func (f *fakeKubernetes) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/apis/batch/v1/namespaces/batch/jobs":
+		json.NewDecoder(r.Body).Decode(&f.job)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"metadata": {"name": "cronic-x7k2p"}}`))
+	case r.URL.Path == "/api/v1/namespaces/batch/pods" && r.URL.Query().Get("labelSelector") == "job-name=cronic-x7k2p":
+		f.polls++
+		phase := "Pending"
+		if f.polls > 1 {
+			phase = f.phase
+		}
+		fmt.Fprintf(w, `{"items": [{"metadata": {"name": "cronic-x7k2p-abcde"}, "status": {"phase": %q, "containerStatuses": [{"name": "job", "state": {"terminated": {"exitCode": %d}}}]}}]}`, phase, f.exitCode)
+	case r.URL.Path == "/api/v1/namespaces/batch/pods/cronic-x7k2p-abcde/log":
+		w.Write([]byte("hello\nworld\n"))
+	case r.Method == http.MethodDelete:
+		f.deleted = r.URL.Path + "?" + r.URL.RawQuery
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"kind": "Status", "message": "not found"}`))
+	}
+}
+
+func newTestKubernetesExecutor(t *testing.T, kubernetes *fakeKubernetes, template string) (*KubernetesExecutor, func()) {
+	pollInterval := KUBERNETES_POLL_INTERVAL
+	KUBERNETES_POLL_INTERVAL = 10 * time.Millisecond
+
+	server := httptest.NewServer(kubernetes)
+
+	executor, err := NewKubernetesExecutor(server.URL, "batch", template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return executor, func() {
+		server.Close()
+		KUBERNETES_POLL_INTERVAL = pollInterval
+	}
+}
+
+func TestKubernetesExecutorRunsCommandsAsJobs(t *testing.T) {
+	kubernetes := &fakeKubernetes{phase: "Succeeded"}
+	executor, stop := newTestKubernetesExecutor(t, kubernetes, "")
+	defer stop()
+
+	command := &Command{
+		Shell:     "/bin/sh",
+		Command:   "./report.sh",
+		Env:       []string{"FOO=bar"},
+		Image:     "python:3.12",
+		ImagePull: "always",
+		Limits:    ResourceLimits{Memory: 256 << 20, CPUs: 0.5},
+	}
+
+	var stdout bytes.Buffer
+	assert.Nil(t, executor.Run(context.Background(), command, &stdout, &bytes.Buffer{}))
+	assert.Equal(t, "hello\nworld\n", stdout.String())
+	assert.Equal(t, "/apis/batch/v1/namespaces/batch/jobs/cronic-x7k2p?propagationPolicy=Background", kubernetes.deleted)
+
+	encoded, _ := json.Marshal(kubernetes.job)
+	assert.JSONEq(t, `{
+		"apiVersion": "batch/v1",
+		"kind": "Job",
+		"metadata": {"generateName": "cronic-", "labels": {"app.kubernetes.io/managed-by": "cronic"}},
+		"spec": {
+			"backoffLimit": 0,
+			"template": {"spec": {
+				"restartPolicy": "Never",
+				"containers": [{
+					"name": "job",
+					"image": "python:3.12",
+					"imagePullPolicy": "Always",
+					"command": ["/bin/sh", "-c", "./report.sh"],
+					"env": [{"name": "FOO", "value": "bar"}],
+					"resources": {"limits": {"memory": "268435456", "cpu": "500m"}}
+				}]
+			}}
+		}
+	}`, string(encoded))
+
+	// Failures report the command's exit code
+	kubernetes.polls, kubernetes.phase, kubernetes.exitCode = 0, "Failed", 3
+	err := executor.Run(context.Background(), command, &stdout, &bytes.Buffer{})
+	if assert.IsType(t, &containerExitError{}, err) {
+		assert.Equal(t, 3, err.(*containerExitError).ExitCode())
+	}
+}
+
+func TestKubernetesExecutorUsesTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cronic-kubernetes")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	template := filepath.Join(dir, "job.yaml")
+	assert.Nil(t, ioutil.WriteFile(template, []byte(`
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: ignored
+  labels:
+    team: data
+spec:
+  backoffLimit: 2
+  template:
+    spec:
+      serviceAccountName: reports
+      containers:
+        - name: proxy
+          image: cloud-sql-proxy
+        - name: job
+          image: ignored
+          args: ["ignored"]
+          env:
+            - name: FROM_TEMPLATE
+              value: "1"
+`), 0644))
+
+	kubernetes := &fakeKubernetes{phase: "Succeeded"}
+	executor, stop := newTestKubernetesExecutor(t, kubernetes, template)
+	defer stop()
+
+	command := &Command{Argv: []string{"./report.sh", "--daily"}, Image: "python:3.12", Env: []string{"FOO=bar"}}
+
+	assert.Nil(t, executor.Run(context.Background(), command, &bytes.Buffer{}, &bytes.Buffer{}))
+
+	encoded, _ := json.Marshal(kubernetes.job)
+	assert.JSONEq(t, `{
+		"apiVersion": "batch/v1",
+		"kind": "Job",
+		"metadata": {"generateName": "cronic-", "labels": {"team": "data", "app.kubernetes.io/managed-by": "cronic"}},
+		"spec": {
+			"backoffLimit": 2,
+			"template": {"spec": {
+				"restartPolicy": "Never",
+				"serviceAccountName": "reports",
+				"containers": [
+					{"name": "proxy", "image": "cloud-sql-proxy"},
+					{
+						"name": "job",
+						"image": "python:3.12",
+						"command": ["./report.sh", "--daily"],
+						"env": [{"name": "FROM_TEMPLATE", "value": "1"}, {"name": "FOO", "value": "bar"}]
+					}
+				]
+			}}
+		}
+	}`, string(encoded))
+
+	// The executor's template isn't changed by runs
+	_, _, err = executor.newJob(command)
+	assert.Nil(t, err)
+	assert.Equal(t, "ignored", executor.Template["metadata"].(map[string]interface{})["name"])
+
+	// Jobs can have their own, relative to their directory
+	_, _, err = executor.newJob(&Command{Image: "alpine", JobTemplate: "nope.yaml", Dir: dir})
+	assert.NotNil(t, err)
+
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "pod.yaml"), []byte("kind: Pod\n"), 0644))
+	_, _, err = executor.newJob(&Command{Image: "alpine", JobTemplate: "pod.yaml", Dir: dir})
+	assert.EqualError(t, err, "bad Job template: "+filepath.Join(dir, "pod.yaml")+" is a Pod, not a Job")
+}
+
+func TestKubernetesExecutorDeletesJobsOfCancelledRuns(t *testing.T) {
+	kubernetes := &fakeKubernetes{phase: "Running"}
+	executor, stop := newTestKubernetesExecutor(t, kubernetes, "")
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err := executor.Run(ctx, &Command{Shell: "/bin/sh", Command: "sleep 60", Image: "alpine"}, &bytes.Buffer{}, &bytes.Buffer{})
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	kubernetes.mu.Lock()
+	defer kubernetes.mu.Unlock()
+	assert.Equal(t, "/apis/batch/v1/namespaces/batch/jobs/cronic-x7k2p?propagationPolicy=Background", kubernetes.deleted)
+}
@@ -0,0 +1,221 @@
+package cron
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/samgaw/cronic/crontab"
+)
+
+var (
+	// The shell that applies the resource limits of a command, before
+	// executing it (see applyResourceLimits)
+	LIMITS_SHELL = "/bin/sh"
+
+	// The period of the CPU quotas of cgroups, in microseconds
+	CGROUP_CPU_PERIOD = 100000
+)
+
+// ResourceLimits caps the resources of a command's processes, so that a
+// runaway job can't exhaust those of the whole machine (or container). Zero
+// values are no limit.
+type ResourceLimits struct {
+	// In bytes: the memory.max of the command's cgroup if there's a
+	// CgroupDir, or its RLIMIT_AS otherwise
+	Memory int64
+
+	// How many CPUs' worth of time the command can use (its cgroup's
+	// cpu.max, which requires a CgroupDir)
+	CPUs float64
+
+	// The command's RLIMIT_NOFILE
+	OpenFiles int
+
+	// The command's niceness (0 to inherit cronic's), and its I/O
+	// scheduling class (one of the crontab.IOClass* classes, or empty to
+	// inherit cronic's) and level. Unlike the limits, these don't cap
+	// resources, but let the processes of more important jobs (or of the
+	// application sharing the machine) have them first.
+	Nice    int
+	IOClass string
+	IOLevel int
+
+	// The command's umask (nil to inherit cronic's), which its shell sets
+	// like the rlimits
+	Umask *int
+
+	// A cgroup v2 directory delegated to cronic, with the memory and cpu
+	// controllers enabled, in which each command with a memory or CPU limit
+	// gets its own cgroup
+	CgroupDir string
+}
+
+func (l *ResourceLimits) priority() bool {
+	return l.Nice != 0 || l.IOClass != ""
+}
+
+func (l *ResourceLimits) cgroup() bool {
+	return l.CPUs > 0 || (l.Memory > 0 && l.CgroupDir != "")
+}
+
+// resourceLimits returns the resource limits of the job's commands.
+func (opts *Options) resourceLimits(job *crontab.Job) ResourceLimits {
+	return ResourceLimits{
+		Memory:    job.MemoryLimit,
+		CPUs:      job.CPULimit,
+		OpenFiles: job.NoFile,
+		Nice:      job.Nice,
+		IOClass:   job.IOClass,
+		IOLevel:   job.IOLevel,
+		Umask:     job.Umask,
+		CgroupDir: opts.CgroupDir,
+	}
+}
+
+// appliedLimits are the resource limits of a command being started.
+type appliedLimits struct {
+	limits ResourceLimits
+	cgroup string
+
+	// The ends of a pipe the command's shell waits on before executing
+	// the command, while its priorities are set (see started)
+	hold, release *os.File
+}
+
+// applyResourceLimits makes cmd run its command with limits, by running it
+// with LIMITS_SHELL, which moves itself to the command's cgroup and sets its
+// rlimits (and waits for its priorities to be set, see started), then
+// executes the command. This way the limits apply from the start, including
+// to the processes the command starts. Call remove once the command exited.
+func applyResourceLimits(cmd *exec.Cmd, limits ResourceLimits) (*appliedLimits, error) {
+	applied := &appliedLimits{limits: limits}
+	script := make([]string, 0, 4)
+
+	if limits.priority() {
+		hold, release, err := os.Pipe()
+		if err != nil {
+			return nil, err
+		}
+		applied.hold, applied.release = hold, release
+
+		cmd.ExtraFiles = []*os.File{hold}
+		script = append(script, "read -r _ <&3", "exec 3<&-")
+	}
+
+	if limits.cgroup() {
+		if limits.CgroupDir == "" {
+			applied.remove()
+			return nil, fmt.Errorf("cpu-limit requires a cgroup directory (see -cgroup-dir)")
+		}
+
+		dir, err := createCgroup(limits)
+		if err != nil {
+			applied.remove()
+			return nil, err
+		}
+		applied.cgroup = dir
+		script = append(script, `echo $$ > "$0/cgroup.procs"`)
+	} else if limits.Memory > 0 {
+		// ulimit counts kilobytes
+		script = append(script, fmt.Sprintf("ulimit -v %d", (limits.Memory+1023)/1024))
+	}
+
+	if limits.OpenFiles > 0 {
+		script = append(script, fmt.Sprintf("ulimit -n %d", limits.OpenFiles))
+	}
+
+	if limits.Umask != nil {
+		script = append(script, fmt.Sprintf("umask %03o", *limits.Umask))
+	}
+
+	if len(script) == 0 {
+		return applied, nil
+	}
+
+	script = append(script, `exec "$@"`)
+	cmd.Args = append([]string{LIMITS_SHELL, "-c", strings.Join(script, " && "), applied.cgroup, cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = LIMITS_SHELL
+
+	return applied, nil
+}
+
+// started sets the priorities of the command, once its shell is started as
+// pid, and lets it execute the command.
+func (a *appliedLimits) started(pid int) error {
+	if a.release == nil {
+		return nil
+	}
+
+	// The command's shell got its own copy
+	a.hold.Close()
+	a.hold = nil
+
+	defer func() {
+		a.release.Close()
+		a.release = nil
+	}()
+
+	if a.limits.Nice != 0 {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, pid, a.limits.Nice); err != nil {
+			return fmt.Errorf("can't set niceness to %d: %v", a.limits.Nice, err)
+		}
+	}
+
+	if a.limits.IOClass != "" {
+		if err := setIOPriority(pid, a.limits.IOClass, a.limits.IOLevel); err != nil {
+			return fmt.Errorf("can't set I/O priority: %v", err)
+		}
+	}
+
+	_, err := a.release.Write([]byte("\n"))
+	return err
+}
+
+// remove removes the command's cgroup (and the pipe its shell waits on, if
+// it's still open).
+func (a *appliedLimits) remove() {
+	for _, file := range []*os.File{a.hold, a.release} {
+		if file != nil {
+			file.Close()
+		}
+	}
+
+	if a.cgroup != "" {
+		// This fails if some of the command's processes are still
+		// running, in which case the cgroup is left to them
+		os.Remove(a.cgroup)
+	}
+}
+
+// createCgroup creates a cgroup for a command in limits.CgroupDir, and
+// returns its directory.
+func createCgroup(limits ResourceLimits) (string, error) {
+	dir, err := ioutil.TempDir(limits.CgroupDir, "cronic-")
+	if err != nil {
+		return "", fmt.Errorf("can't create cgroup: %v", err)
+	}
+
+	settings := make(map[string]string)
+	if limits.Memory > 0 {
+		settings["memory.max"] = strconv.FormatInt(limits.Memory, 10)
+	}
+	if limits.CPUs > 0 {
+		quota := int(limits.CPUs * float64(CGROUP_CPU_PERIOD))
+		settings["cpu.max"] = fmt.Sprintf("%d %d", quota, CGROUP_CPU_PERIOD)
+	}
+
+	for file, value := range settings {
+		if err := ioutil.WriteFile(filepath.Join(dir, file), []byte(value), 0644); err != nil {
+			os.Remove(dir)
+			return "", fmt.Errorf("can't set %s of cgroup %s: %v", file, dir, err)
+		}
+	}
+
+	return dir, nil
+}
@@ -0,0 +1,126 @@
+package cron
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/samgaw/cronic/crontab"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunJobAppliesRlimits(t *testing.T) {
+	logger, channel := newTestLogger()
+
+	status := newTestStatus("ulimit -n; ulimit -v")
+	status.Job.NoFile = 64
+	status.Job.MemoryLimit = 512 << 20
+
+	assert.Nil(t, runJob(context.Background(), &basicContext, &basicOptions, status, logger))
+	expectMessages(t, channel, "Starting", "^64$", "^524288$")
+
+	// Commands run without a shell are limited too
+	status = newTestStatus("exec: sh -c 'ulimit -n'")
+	status.Job.Argv = []string{"sh", "-c", "ulimit -n"}
+	status.Job.NoFile = 32
+
+	assert.Nil(t, runJob(context.Background(), &basicContext, &basicOptions, status, logger))
+	expectMessages(t, channel, "Starting", "^32$")
+}
+
+func TestRunJobSetsUmask(t *testing.T) {
+	logger, channel := newTestLogger()
+
+	umask := 027
+	status := newTestStatus("umask")
+	status.Job.Umask = &umask
+
+	assert.Nil(t, runJob(context.Background(), &basicContext, &basicOptions, status, logger))
+	expectMessages(t, channel, "Starting", "^0027$")
+}
+
+func TestRunJobCreatesCgroup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cronic-cgroup")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	logger, channel := newTestLogger()
+
+	status := newTestStatus("echo $$; ulimit -v")
+	status.Job.MemoryLimit = 512 << 20
+	status.Job.CPULimit = 1.5
+
+	opts := basicOptions
+	opts.CgroupDir = dir
+
+	assert.Nil(t, runJob(context.Background(), &basicContext, &opts, status, logger))
+
+	entry := <-channel
+	assert.Equal(t, "CRONIC: Starting", entry.Message)
+	pid := (<-channel).Message
+
+	// With a cgroup, memory isn't limited with an rlimit
+	expectMessages(t, channel, "^unlimited$")
+
+	// The directory isn't a cgroup, so the run's can't be removed
+	cgroups, err := filepath.Glob(filepath.Join(dir, "cronic-*"))
+	if !assert.Nil(t, err) || !assert.Len(t, cgroups, 1) {
+		return
+	}
+
+	for file, expected := range map[string]string{
+		"memory.max":   strconv.Itoa(512 << 20),
+		"cpu.max":      "150000 100000",
+		"cgroup.procs": pid,
+	} {
+		contents, err := ioutil.ReadFile(filepath.Join(cgroups[0], file))
+		if assert.Nil(t, err, file) {
+			assert.Equal(t, expected, strings.TrimSpace(string(contents)), file)
+		}
+	}
+}
+
+func TestRunJobSetsPriorities(t *testing.T) {
+	logger, channel := newTestLogger()
+
+	// Field 19 of stat is the niceness
+	status := newTestStatus("awk '{ print $19 }' /proc/$$/stat")
+	status.Job.Nice = 5
+
+	assert.Nil(t, runJob(context.Background(), &basicContext, &basicOptions, status, logger))
+	expectMessages(t, channel, "Starting", "^5$")
+
+	if _, err := exec.LookPath("ionice"); err != nil {
+		t.Skip("ionice is not installed")
+	}
+
+	status = newTestStatus("ionice -p $$")
+	status.Job.IOClass = crontab.IOClassBestEffort
+	status.Job.IOLevel = 7
+
+	assert.Nil(t, runJob(context.Background(), &basicContext, &basicOptions, status, logger))
+	expectMessages(t, channel, "Starting", "^best-effort: prio 7$")
+
+	status = newTestStatus("ionice -p $$")
+	status.Job.IOClass = crontab.IOClassIdle
+
+	assert.Nil(t, runJob(context.Background(), &basicContext, &basicOptions, status, logger))
+	expectMessages(t, channel, "Starting", "^idle$")
+}
+
+func TestRunJobRequiresCgroupForCPULimit(t *testing.T) {
+	logger, _ := newTestLogger()
+
+	status := newTestStatus("true")
+	status.Job.CPULimit = 1
+
+	err := runJob(context.Background(), &basicContext, &basicOptions, status, logger)
+	assert.Equal(t, crontab.FailureSpawn, failureCondition(err))
+}
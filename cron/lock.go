@@ -0,0 +1,120 @@
+package cron
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/samgaw/cronic/crontab"
+)
+
+var (
+	// Where host-wide locks are kept, unless Options.LockDir is set. Other
+	// cronic processes must use the same directory to share locks.
+	DEFAULT_LOCK_DIR = filepath.Join(os.TempDir(), "cronic-locks")
+
+	// How long to wait before trying to take a lock someone else holds
+	// again, at first and at most (the wait doubles each time)
+	LOCK_POLL_INTERVAL     = 10 * time.Millisecond
+	MAX_LOCK_POLL_INTERVAL = time.Second
+)
+
+// acquireLock takes the job's host-wide lock (if it has one), waiting for
+// other jobs holding it to finish, including those of other cronic
+// processes, or for ctx to be done. It returns a function that releases the
+// lock.
+func acquireLock(ctx context.Context, opts *Options, job *crontab.Job, jobLogger *Logger) (func(), error) {
+	if job.Lock == "" {
+		return func() {}, nil
+	}
+
+	dir := opts.LockDir
+	if dir == "" {
+		dir = DEFAULT_LOCK_DIR
+	}
+
+	if err := prepareLockDir(dir); err != nil {
+		return nil, fmt.Errorf("CRONIC: Bad lock directory %s: %v", dir, err)
+	}
+
+	path := filepath.Join(dir, job.Lock+".lock")
+
+	// Other users can create files in the directory, so the lock file
+	// mustn't be a link to some other file
+	file, err := os.OpenFile(path, os.O_RDONLY|os.O_CREATE|syscall.O_NOFOLLOW, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("CRONIC: Failed to open lock %s: %v", job.Lock, err)
+	}
+
+	// flock locks are released when the file is closed, including when
+	// cronic dies, so they can't be left behind. A blocking flock couldn't
+	// be given up on, so a held lock is polled.
+	interval := LOCK_POLL_INTERVAL
+	for waiting := false; ; waiting = true {
+		err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err != syscall.EWOULDBLOCK && err != syscall.EINTR {
+			break
+		}
+
+		if !waiting {
+			jobLogger.Infof("CRONIC: Waiting for lock %s", job.Lock)
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			file.Close()
+			return nil, ctx.Err()
+		}
+
+		if interval *= 2; interval > MAX_LOCK_POLL_INTERVAL {
+			interval = MAX_LOCK_POLL_INTERVAL
+		}
+	}
+
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("CRONIC: Failed to take lock %s: %v", job.Lock, err)
+	}
+
+	return func() { file.Close() }, nil
+}
+
+// prepareLockDir creates the directory of host-wide locks, if it doesn't
+// exist. It's shared with other users' cronic processes, so like /tmp, anyone
+// can create lock files in it, but not remove or replace others'. It must
+// belong to root or to cronic's user, or they could anyway.
+func prepareLockDir(dir string) error {
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return err
+	}
+
+	if err := os.Mkdir(dir, 0777); err == nil {
+		// Mkdir applies the umask, and can't set the sticky bit
+		return os.Chmod(dir, 0777|os.ModeSticky)
+	} else if !os.IsExist(err) {
+		return err
+	}
+
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("not a directory")
+	}
+
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && stat.Uid != 0 && int(stat.Uid) != os.Getuid() {
+		return fmt.Errorf("owned by another user (uid %d)", stat.Uid)
+	}
+
+	if info.Mode()&0002 != 0 && info.Mode()&os.ModeSticky == 0 {
+		return fmt.Errorf("writable by anyone, without the sticky bit")
+	}
+
+	return nil
+}
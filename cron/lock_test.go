@@ -0,0 +1,135 @@
+package cron
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcquireLockWaitsForHolder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cronic-locks")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	logger, channel := newTestLogger()
+	opts := &Options{LockDir: dir + "/nested"}
+	job := &crontab.Job{Lock: "apt"}
+
+	release, err := acquireLock(context.Background(), opts, job, logger)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	// flock locks conflict between open files, even in the same process
+	acquired := make(chan func())
+	go func() {
+		release, err := acquireLock(context.Background(), opts, job, logger)
+		assert.Nil(t, err)
+		acquired <- release
+	}()
+
+	expectMessages(t, channel, "Waiting for lock apt")
+
+	select {
+	case <-acquired:
+		t.Fatalf("lock was taken twice")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	release()
+
+	select {
+	case release := <-acquired:
+		release()
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for lock")
+	}
+
+	// Other locks are independent
+	release, err = acquireLock(context.Background(), opts, &crontab.Job{Lock: "dnf"}, logger)
+	if assert.Nil(t, err) {
+		release()
+	}
+}
+
+func TestAcquireLockWithoutLock(t *testing.T) {
+	logger, _ := newTestLogger()
+
+	release, err := acquireLock(context.Background(), &Options{LockDir: "/nonexistent/dir"}, &crontab.Job{}, logger)
+	if assert.Nil(t, err) {
+		release()
+	}
+}
+
+func TestAcquireLockGivesUpWhenCancelled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cronic-locks")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	logger, channel := newTestLogger()
+	opts := &Options{LockDir: dir + "/nested"}
+	job := &crontab.Job{Lock: "apt"}
+
+	release, err := acquireLock(context.Background(), opts, job, logger)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := acquireLock(ctx, opts, job, logger)
+		done <- err
+	}()
+
+	expectMessages(t, channel, "Waiting for lock apt")
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.Equal(t, context.Canceled, err)
+	case <-time.After(time.Second):
+		t.Fatalf("still waiting for lock")
+	}
+}
+
+func TestPrepareLockDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cronic-locks")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// It's shared like /tmp, whatever the umask
+	shared := dir + "/nested/locks"
+	if assert.Nil(t, prepareLockDir(shared)) {
+		info, err := os.Stat(shared)
+		if assert.Nil(t, err) {
+			assert.Equal(t, os.ModeDir|os.ModeSticky|0777, info.Mode())
+		}
+	}
+	assert.Nil(t, prepareLockDir(shared))
+
+	// Anyone could replace others' lock files
+	assert.Nil(t, os.Chmod(shared, 0777))
+	assert.NotNil(t, prepareLockDir(shared))
+
+	file := dir + "/file"
+	assert.Nil(t, ioutil.WriteFile(file, nil, 0644))
+	assert.NotNil(t, prepareLockDir(file))
+
+	link := dir + "/link"
+	assert.Nil(t, os.Symlink(shared, link))
+	assert.NotNil(t, prepareLockDir(link))
+}
@@ -0,0 +1,213 @@
+package cron
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/samgaw/cronic/crontab"
+)
+
+// Fields are the fields of what's logged (e.g. job.name, or run.id).
+type Fields map[string]interface{}
+
+// Entry is a message of cronic, or a line of a job's output.
+type Entry struct {
+	Time    time.Time
+	Level   crontab.Level
+	Message string
+	Data    Fields
+}
+
+// Handler receives the entries of loggers, e.g. to write them to stderr, or
+// pass them on to a logging library. Entries are only made at the levels
+// Enabled reports. Handle is called from the goroutines that schedule and
+// run jobs, so it must be safe for concurrent use, and shouldn't block.
+type Handler interface {
+	Enabled(level crontab.Level) bool
+	Handle(entry *Entry)
+}
+
+// hook receives the entries of a job's logger, in addition to its handler
+// (e.g. to send them to syslog).
+type hook interface {
+	Fire(entry *Entry) error
+}
+
+// Logger logs messages with fields, which WithField and WithFields add.
+type Logger struct {
+	Data Fields
+
+	handler Handler
+	hooks   []hook
+}
+
+// NewLogger returns a logger that passes its entries on to handler (or
+// discards them, if it's nil).
+func NewLogger(handler Handler) *Logger {
+	if handler == nil {
+		handler = discardHandler{}
+	}
+	return &Logger{Data: Fields{}, handler: handler}
+}
+
+// WithField returns a logger with the fields of l, and key.
+func (l *Logger) WithField(key string, value interface{}) *Logger {
+	return l.WithFields(Fields{key: value})
+}
+
+// WithFields returns a logger with the fields of l, and fields (which win
+// when they clash).
+func (l *Logger) WithFields(fields Fields) *Logger {
+	data := make(Fields, len(l.Data)+len(fields))
+	for key, value := range l.Data {
+		data[key] = value
+	}
+	for key, value := range fields {
+		data[key] = value
+	}
+	return &Logger{Data: data, handler: l.handler, hooks: l.hooks}
+}
+
+// Log logs args (formatted like fmt.Sprint) at a level chosen at runtime.
+func (l *Logger) Log(level crontab.Level, args ...interface{}) {
+	if l.handler.Enabled(level) {
+		l.log(level, fmt.Sprint(args...))
+	}
+}
+
+// Logf logs a message (formatted like fmt.Sprintf) at a level chosen at
+// runtime.
+func (l *Logger) Logf(level crontab.Level, format string, args ...interface{}) {
+	if l.handler.Enabled(level) {
+		l.log(level, fmt.Sprintf(format, args...))
+	}
+}
+
+func (l *Logger) Debug(args ...interface{}) {
+	l.Log(crontab.LevelDebug, args...)
+}
+
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.Logf(crontab.LevelDebug, format, args...)
+}
+
+func (l *Logger) Info(args ...interface{}) {
+	l.Log(crontab.LevelInfo, args...)
+}
+
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.Logf(crontab.LevelInfo, format, args...)
+}
+
+func (l *Logger) Warn(args ...interface{}) {
+	l.Log(crontab.LevelWarn, args...)
+}
+
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.Logf(crontab.LevelWarn, format, args...)
+}
+
+func (l *Logger) Error(args ...interface{}) {
+	l.Log(crontab.LevelError, args...)
+}
+
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.Logf(crontab.LevelError, format, args...)
+}
+
+func (l *Logger) log(level crontab.Level, message string) {
+	entry := &Entry{Time: time.Now(), Level: level, Message: message, Data: l.Data}
+
+	for _, hook := range l.hooks {
+		if err := hook.Fire(entry); err != nil {
+			fmt.Fprintf(os.Stderr, "CRONIC: Failed to fire hook: %v\n", err)
+		}
+	}
+
+	l.handler.Handle(entry)
+}
+
+// withHook returns a logger with the fields and hooks of logger, and jobHook,
+// that passes its entries on to handler (whose levels the hooks get
+// entries at).
+func withHook(logger *Logger, handler Handler, jobHook hook) *Logger {
+	hooks := append(append([]hook(nil), logger.hooks...), jobHook)
+	return &Logger{Data: logger.Data, handler: handler, hooks: hooks}
+}
+
+type discardHandler struct{}
+
+func (discardHandler) Enabled(crontab.Level) bool {
+	return false
+}
+
+func (discardHandler) Handle(*Entry) {}
+
+// discardOutput makes entries at the levels of a handler, without passing
+// them on to it (so that only hooks get them).
+type discardOutput struct {
+	Handler
+}
+
+func (discardOutput) Handle(*Entry) {}
+
+// formatText formats an entry as logfmt (without its time), e.g.
+// `level=info msg="CRONIC: Starting" job.name=backup-db`, with its fields
+// sorted. Fields that clash with time, level or msg are prefixed with
+// "fields.".
+func formatText(entry *Entry) string {
+	data := make(Fields, len(entry.Data))
+	for key, value := range entry.Data {
+		if key == "time" || key == "level" || key == "msg" {
+			key = "fields." + key
+		}
+		data[key] = value
+	}
+
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b bytes.Buffer
+	appendKeyValue(&b, "level", entry.Level.String())
+	if entry.Message != "" {
+		appendKeyValue(&b, "msg", entry.Message)
+	}
+	for _, key := range keys {
+		appendKeyValue(&b, key, data[key])
+	}
+	return string(bytes.TrimRight(b.Bytes(), " "))
+}
+
+func appendKeyValue(b *bytes.Buffer, key string, value interface{}) {
+	b.WriteString(key)
+	b.WriteByte('=')
+
+	switch value := value.(type) {
+	case string:
+		appendString(b, value)
+	case error:
+		appendString(b, value.Error())
+	default:
+		fmt.Fprint(b, value)
+	}
+
+	b.WriteByte(' ')
+}
+
+// appendString quotes strings, unless they only have letters, digits, dashes
+// and dots.
+func appendString(b *bytes.Buffer, value string) {
+	for _, ch := range value {
+		if !((ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9') || ch == '-' || ch == '.') {
+			fmt.Fprintf(b, "%q", value)
+			return
+		}
+	}
+	b.WriteString(value)
+}
@@ -0,0 +1,64 @@
+package cron
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type infoHandler struct {
+	entries []*Entry
+}
+
+func (handler *infoHandler) Enabled(level crontab.Level) bool {
+	return level >= crontab.LevelInfo
+}
+
+func (handler *infoHandler) Handle(entry *Entry) {
+	handler.entries = append(handler.entries, entry)
+}
+
+func TestLoggerLogsAtEnabledLevels(t *testing.T) {
+	handler := &infoHandler{}
+	logger := NewLogger(handler).WithField("job.name", "backup")
+
+	logger.Debug("CRONIC: Not logged")
+	logger.WithFields(Fields{"run.id": 42, "job.name": "backup-db"}).Warnf("CRONIC: Job is still running after %s", "1h")
+	logger.Info("done")
+
+	if assert.Len(t, handler.entries, 2) {
+		assert.Equal(t, crontab.LevelWarn, handler.entries[0].Level)
+		assert.Equal(t, "CRONIC: Job is still running after 1h", handler.entries[0].Message)
+		assert.Equal(t, Fields{"job.name": "backup-db", "run.id": 42}, handler.entries[0].Data)
+		assert.False(t, handler.entries[0].Time.IsZero())
+
+		assert.Equal(t, Fields{"job.name": "backup"}, handler.entries[1].Data)
+	}
+
+	// Hooks get the entries at the levels of the handler
+	hooked := make(chan *Entry, TEST_CHANNEL_BUFFER_SIZE)
+	hookedLogger := withHook(logger, discardOutput{handler}, testHook(hooked))
+	hookedLogger.Debug("CRONIC: Not logged")
+	hookedLogger.Error("CRONIC: Failed")
+	assert.Len(t, hooked, 1)
+	assert.Len(t, handler.entries, 2)
+
+	// Without a handler, nothing is logged
+	NewLogger(nil).Error("CRONIC: Failed")
+}
+
+func TestFormatText(t *testing.T) {
+	assert.Equal(t, `level=warning msg="CRONIC: Job is still running" fields.level=fatal job.name=backup-db run.id=42`, formatText(&Entry{
+		Level:   crontab.LevelWarn,
+		Message: "CRONIC: Job is still running",
+		Data:    Fields{"job.name": "backup-db", "run.id": 42, "level": "fatal"},
+	}))
+
+	assert.Equal(t, `level=error error="exit status 1" path="say \"hi\""`, formatText(&Entry{
+		Level: crontab.LevelError,
+		Data:  Fields{"error": errors.New("exit status 1"), "path": `say "hi"`},
+	}))
+}
@@ -0,0 +1,260 @@
+package cron
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samgaw/cronic/crontab"
+)
+
+var (
+	// How often to push lines to Loki, and how many to hold while it's slow
+	// or unreachable (in excess, lines are dropped)
+	LOKI_PUSH_INTERVAL = time.Second
+	LOKI_QUEUE_SIZE    = 10000
+
+	LOKI_PUSH_TIMEOUT = 10 * time.Second
+
+	lokiPushPath       = "/loki/api/v1/push"
+	lokiLabelReplacer  = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+	lokiLabelledFields = map[string]bool{"job.name": true, "job.position": true, "job.namespace": true, "channel": true}
+)
+
+// Loki pushes the messages of jobs (their output, and what happens to their
+// runs) to Grafana Loki, in addition to logging them. Each job has its own
+// streams, labelled with its name (job="backup-db", or job="job-3" for
+// unnamed jobs), namespace and the namespace's labels, along with the
+// channel (stdout, stderr, or cronic for cronic's own messages) and level
+// of lines. The other fields (e.g. run.id, whose values would make too many
+// streams) are part of the lines, which are in logfmt.
+//
+// Lines are pushed in batches, in the background, since logging must not
+// block jobs.
+type Loki struct {
+	url    string
+	client *http.Client
+	logger *Logger
+
+	mu      sync.Mutex
+	streams map[string]*lokiStream
+	queued  int
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+type lokiPush struct {
+	Streams []*lokiStream `json:"streams"`
+}
+
+// NewLoki pushes lines to the Loki server at rawURL (e.g.
+// http://loki:3100, to which the push API's path is added if it has no
+// path). logger reports errors pushing them.
+func NewLoki(rawURL string, logger *Logger) (*Loki, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("CRONIC: Bad Loki URL: %s (expected e.g. http://loki:3100)", rawURL)
+	}
+
+	if u.Path == "" || u.Path == "/" {
+		u.Path = lokiPushPath
+	}
+
+	l := &Loki{
+		url:     u.String(),
+		client:  &http.Client{Timeout: LOKI_PUSH_TIMEOUT},
+		logger:  logger,
+		streams: make(map[string]*lokiStream),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	go l.run()
+
+	return l, nil
+}
+
+// Logger returns a logger that logs like logger, and also pushes the job's
+// messages to Loki.
+func (l *Loki) Logger(logger *Logger, job *crontab.Job) *Logger {
+	return withHook(logger, logger.handler, &lokiHook{loki: l, job: job})
+}
+
+// Close pushes what's left, and stops pushing lines.
+func (l *Loki) Close() {
+	l.once.Do(func() { close(l.stop) })
+	<-l.done
+}
+
+func (l *Loki) run() {
+	defer close(l.done)
+
+	ticker := time.NewTicker(LOKI_PUSH_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			l.push()
+		case <-l.stop:
+			l.push()
+			return
+		}
+	}
+}
+
+func (l *Loki) add(labels map[string]string, at time.Time, line string) {
+	key := lokiStreamKey(labels)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.queued >= LOKI_QUEUE_SIZE {
+		return
+	}
+	l.queued++
+
+	stream, ok := l.streams[key]
+	if !ok {
+		stream = &lokiStream{Stream: labels}
+		l.streams[key] = stream
+	}
+	stream.Values = append(stream.Values, [2]string{strconv.FormatInt(at.UnixNano(), 10), line})
+}
+
+// push pushes the queued lines. They're dropped if that fails, except when
+// Loki asks to retry later (e.g. when rate limiting).
+func (l *Loki) push() {
+	l.mu.Lock()
+	streams, queued := l.streams, l.queued
+	l.streams, l.queued = make(map[string]*lokiStream), 0
+	l.mu.Unlock()
+
+	if queued == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(streams))
+	for key := range streams {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	push := &lokiPush{}
+	for _, key := range keys {
+		push.Streams = append(push.Streams, streams[key])
+	}
+
+	retry, err := l.post(push)
+	if err == nil {
+		return
+	}
+
+	if !retry {
+		l.logger.Warnf("CRONIC: Failed to push %d lines to Loki, dropping them: %v", queued, err)
+		return
+	}
+
+	l.logger.Debugf("CRONIC: Failed to push %d lines to Loki, retrying: %v", queued, err)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, key := range keys {
+		stream := streams[key]
+		if current, ok := l.streams[key]; ok {
+			stream.Values = append(stream.Values, current.Values...)
+		}
+		l.streams[key] = stream
+	}
+	l.queued += queued
+}
+
+// post posts a push request, and returns whether it's worth retrying if it
+// failed.
+func (l *Loki) post(push *lokiPush) (bool, error) {
+	body, err := json.Marshal(push)
+	if err != nil {
+		return false, err
+	}
+
+	response, err := l.client.Post(l.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return true, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode/100 == 2 {
+		return false, nil
+	}
+
+	retry := response.StatusCode == http.StatusTooManyRequests || response.StatusCode/100 == 5
+	return retry, fmt.Errorf("%s", response.Status)
+}
+
+func lokiStreamKey(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var key strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&key, "%s=%q,", name, labels[name])
+	}
+	return key.String()
+}
+
+// lokiHook queues the entries of a job's logger.
+type lokiHook struct {
+	loki *Loki
+	job  *crontab.Job
+}
+
+func (h *lokiHook) Fire(entry *Entry) error {
+	labels := map[string]string{
+		"job":     fmt.Sprintf("job-%d", h.job.Position),
+		"channel": "cronic",
+		"level":   entry.Level.String(),
+	}
+	if h.job.Name != "" {
+		labels["job"] = h.job.Name
+	}
+	if h.job.Namespace != "" {
+		labels["namespace"] = h.job.Namespace
+	}
+	if channel, ok := entry.Data["channel"].(string); ok {
+		labels["channel"] = channel
+	}
+
+	// The fields that aren't labels stay in the line
+	lineEntry := &Entry{Message: entry.Message, Level: entry.Level, Data: Fields{}}
+	for key, value := range entry.Data {
+		if strings.HasPrefix(key, "label.") {
+			if name := lokiLabelReplacer.ReplaceAllString(key[len("label."):], "_"); labels[name] == "" {
+				labels[name] = fmt.Sprint(value)
+			}
+		} else if !lokiLabelledFields[key] {
+			lineEntry.Data[key] = value
+		}
+	}
+
+	h.loki.add(labels, entry.Time, formatText(lineEntry))
+	return nil
+}
@@ -0,0 +1,110 @@
+package cron
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLokiPushesJobMessages(t *testing.T) {
+	pushes := make(chan lokiPush, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/loki/api/v1/push", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		body, _ := ioutil.ReadAll(r.Body)
+
+		var push lokiPush
+		assert.Nil(t, json.Unmarshal(body, &push))
+		pushes <- push
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	logger, channel := newTestLogger()
+
+	loki, err := NewLoki(server.URL, logger)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	job := &crontab.Job{CrontabLine: crontab.CrontabLine{Command: "./backup.sh", Schedule: "@daily"}, Name: "backup-db"}
+	namespace := &Namespace{Name: "batch", Labels: map[string]string{"team": "data"}}
+	jobLogger := loki.Logger(JobLogger(logger, job).WithFields(namespace.labelFields()), job)
+
+	jobLogger.WithField("run.id", "42").Info("CRONIC: Starting")
+	jobLogger.WithFields(map[string]interface{}{"run.id": "42", "channel": "stderr"}).Info("dumping database")
+	jobLogger.WithFields(map[string]interface{}{"run.id": "42", "channel": "stderr"}).Info("done")
+
+	// The entries are still logged
+	expectMessages(t, channel, "Starting", "dumping database", "done")
+
+	// Close pushes what's left
+	loki.Close()
+
+	push := <-pushes
+	if assert.Len(t, push.Streams, 2) {
+		// Streams are sorted by their labels
+		assert.Equal(t, map[string]string{"job": "backup-db", "channel": "cronic", "level": "info", "team": "data"}, push.Streams[0].Stream)
+
+		stderr := push.Streams[1]
+		assert.Equal(t, map[string]string{"job": "backup-db", "channel": "stderr", "level": "info", "team": "data"}, stderr.Stream)
+		if assert.Len(t, stderr.Values, 2) {
+			assert.Equal(t, `level=info msg="dumping database" job.schedule="@daily" run.id=42`, stderr.Values[0][1])
+			assert.Equal(t, `level=info msg=done job.schedule="@daily" run.id=42`, stderr.Values[1][1])
+		}
+	}
+}
+
+func TestLokiRetriesLater(t *testing.T) {
+	pushes := make(chan lokiPush, 10)
+	status := http.StatusTooManyRequests
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var push lokiPush
+		json.NewDecoder(r.Body).Decode(&push)
+		pushes <- push
+
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	logger, _ := newTestLogger()
+
+	loki, err := NewLoki(server.URL+"/custom/push", logger)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer loki.Close()
+
+	job := &crontab.Job{CrontabLine: crontab.CrontabLine{Command: "./backup.sh"}, Position: 3}
+	loki.Logger(JobLogger(logger, job), job).Info("first")
+	loki.push()
+	assert.Equal(t, "job-3", (<-pushes).Streams[0].Stream["job"])
+
+	// Rate limited lines are pushed again
+	status = http.StatusNoContent
+	loki.Logger(JobLogger(logger, job), job).Info("second")
+	loki.push()
+
+	values := (<-pushes).Streams[0].Values
+	if assert.Len(t, values, 2) {
+		assert.Contains(t, values[0][1], "msg=first")
+		assert.Contains(t, values[1][1], "msg=second")
+	}
+}
+
+func TestNewLokiRejectsBadURLs(t *testing.T) {
+	logger, _ := newTestLogger()
+
+	for _, rawURL := range []string{"loki:3100", "ftp://loki", "http://"} {
+		_, err := NewLoki(rawURL, logger)
+		assert.NotNil(t, err, rawURL)
+	}
+}
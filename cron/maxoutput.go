@@ -0,0 +1,66 @@
+package cron
+
+import (
+	"sync"
+)
+
+// outputBudget caps how much of a run's output is logged (see the
+// max-output annotation), and counts what's left out.
+type outputBudget struct {
+	limit int64
+
+	// Called the first time a line is left out
+	onExceeded func()
+
+	mu           sync.Mutex
+	used         int64
+	droppedLines int64
+	droppedBytes int64
+}
+
+// newOutputBudget returns a budget of limit bytes, or nil for no limit.
+func newOutputBudget(limit int64, onExceeded func()) *outputBudget {
+	if limit <= 0 {
+		return nil
+	}
+	return &outputBudget{limit: limit, onExceeded: onExceeded}
+}
+
+// allow returns whether to log a line, which counts against the budget
+// (with its newline) if so.
+func (b *outputBudget) allow(line string) bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+
+	size := int64(len(line)) + 1
+	if b.droppedLines == 0 && b.used+size <= b.limit {
+		b.used += size
+		b.mu.Unlock()
+		return true
+	}
+
+	first := b.droppedLines == 0
+	b.droppedLines++
+	b.droppedBytes += size
+
+	b.mu.Unlock()
+
+	if first {
+		b.onExceeded()
+	}
+	return false
+}
+
+// dropped returns how many lines (and bytes) of output were left out.
+func (b *outputBudget) dropped() (int64, int64) {
+	if b == nil {
+		return 0, 0
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.droppedLines, b.droppedBytes
+}
@@ -0,0 +1,147 @@
+package cron
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+
+	"github.com/samgaw/cronic/crontab"
+)
+
+var (
+	ErrNoSuchNamespace = errors.New("CRONIC: No such namespace")
+
+	namespaceNameMatcher = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+// Namespace groups jobs (usually those of an application or tenant sharing
+// cronic), and restricts what they can do.
+type Namespace struct {
+	Name string `json:"-"`
+
+	// How many of the namespace's jobs can run at once (0 for no limit)
+	MaxConcurrent int `json:"max_concurrent"`
+
+	// Which variables of cronic's environment (and the crontab's) the jobs
+	// inherit: either names, or prefixes ending in "*". If nil, all of
+	// them.
+	AllowedEnv []string `json:"allowed_env"`
+
+	// Attached to the namespace's logs, events and metrics
+	Labels map[string]string `json:"labels"`
+
+	mu      sync.Mutex
+	running int
+	waiting waitQueue
+}
+
+// ParseNamespaces reads namespaces from a JSON object mapping their names to
+// their settings.
+func ParseNamespaces(reader io.Reader) (map[string]*Namespace, error) {
+	namespaces := make(map[string]*Namespace)
+
+	decoder := json.NewDecoder(reader)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&namespaces); err != nil {
+		return nil, fmt.Errorf("CRONIC: Bad namespaces: %v", err)
+	}
+
+	for name, namespace := range namespaces {
+		if !namespaceNameMatcher.MatchString(name) {
+			return nil, fmt.Errorf("CRONIC: Bad namespace name: %q", name)
+		}
+
+		if namespace == nil {
+			namespace = &Namespace{}
+			namespaces[name] = namespace
+		}
+
+		if namespace.MaxConcurrent < 0 {
+			return nil, fmt.Errorf("CRONIC: Bad namespace %s: max_concurrent must not be negative", name)
+		}
+
+		namespace.Name = name
+	}
+
+	return namespaces, nil
+}
+
+// Namespace returns the namespace of a job, or nil if it doesn't have one.
+func (opts *Options) Namespace(job *crontab.Job) (*Namespace, error) {
+	if job.Namespace == "" {
+		return nil, nil
+	}
+
+	namespace, ok := opts.Namespaces[job.Namespace]
+	if !ok {
+		return nil, ErrNoSuchNamespace
+	}
+
+	return namespace, nil
+}
+
+// enter returns true if one more of the namespace's jobs can run.
+// Otherwise it returns false, and a function that stops waiting (which
+// returns false if it's too late): f is called once one can (from the
+// goroutine of the job that leaves). Jobs that entered must leave once
+// they're done.
+func (n *Namespace) enter(f func()) (bool, func() bool) {
+	if n == nil || n.MaxConcurrent == 0 {
+		return true, nil
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.running < n.MaxConcurrent {
+		n.running++
+		return true, nil
+	}
+
+	w := n.waiting.push(f)
+	return false, func() bool {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		return n.waiting.remove(w)
+	}
+}
+
+// leave lets the job that has waited longest run, if any, in place of one
+// that's done.
+func (n *Namespace) leave() {
+	if n == nil || n.MaxConcurrent == 0 {
+		return
+	}
+
+	n.mu.Lock()
+	f := n.waiting.pop()
+	if f == nil {
+		n.running--
+	}
+	n.mu.Unlock()
+
+	if f != nil {
+		f()
+	}
+}
+
+func (n *Namespace) allowsEnv(name string) bool {
+	if n == nil || n.AllowedEnv == nil {
+		return true
+	}
+
+	return crontab.MatchesEnvPattern(n.AllowedEnv, name)
+}
+
+// labelFields returns the namespace's labels, as log fields.
+func (n *Namespace) labelFields() Fields {
+	fields := Fields{}
+	for key, value := range n.Labels {
+		fields["label."+key] = value
+	}
+	return fields
+}
@@ -0,0 +1,174 @@
+package cron
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var parseNamespacesTestCases = []struct {
+	config string
+	ok     bool
+}{
+	{`{}`, true},
+	{`{"billing": {"max_concurrent": 2, "allowed_env": ["PATH", "BILLING_*"], "labels": {"team": "payments"}}}`, true},
+	{`{"billing": null}`, true},
+
+	// Failure cases
+	{``, false},
+	{`{"billing": {"max_concurrent": -1}}`, false},
+	{`{"billing": {"max_concurent": 1}}`, false},
+	{`{"bad name": {}}`, false},
+}
+
+func TestParseNamespaces(t *testing.T) {
+	for _, tt := range parseNamespacesTestCases {
+		label := fmt.Sprintf("ParseNamespaces(%q)", tt.config)
+
+		namespaces, err := ParseNamespaces(strings.NewReader(tt.config))
+
+		if !tt.ok {
+			assert.Nil(t, namespaces, label)
+			assert.NotNil(t, err, label)
+			continue
+		}
+
+		if assert.Nil(t, err, label) {
+			for name, namespace := range namespaces {
+				assert.Equal(t, name, namespace.Name, label)
+			}
+		}
+	}
+}
+
+func TestJobEnvironOnlyInheritsAllowedVariables(t *testing.T) {
+	os.Setenv("CRONIC_TEST_SECRET", "hunter2")
+	defer os.Unsetenv("CRONIC_TEST_SECRET")
+
+	cronCtx := &crontab.Context{
+		Shell:   "/bin/sh",
+		Environ: map[string]string{"BILLING_DB": "db1", "OTHER": "x", "PATH": "/usr/bin"},
+	}
+
+	namespace := &Namespace{Name: "billing", AllowedEnv: []string{"PATH", "BILLING_*"}}
+
+	job := &crontab.Job{PathPrepend: "/opt/billing/bin"}
+
+	env := jobEnviron(cronCtx, &Options{}, namespace, job)
+	assert.Contains(t, env, "BILLING_DB=db1")
+	assert.Contains(t, env, "PATH=/usr/bin")
+	assert.Equal(t, "PATH=/opt/billing/bin:/usr/bin", env[len(env)-1])
+	assert.NotContains(t, env, "OTHER=x")
+	assert.NotContains(t, env, "CRONIC_TEST_SECRET=hunter2")
+
+	// Without a namespace, everything is inherited
+	assert.Contains(t, jobEnviron(cronCtx, &Options{}, nil, job), "CRONIC_TEST_SECRET=hunter2")
+}
+
+func TestJobEnvironScrubsInheritedVariables(t *testing.T) {
+	os.Setenv("CRONIC_TEST_SECRET", "hunter2")
+	os.Setenv("CRONIC_TEST_TOKEN", "s3cr3t")
+	defer os.Unsetenv("CRONIC_TEST_SECRET")
+	defer os.Unsetenv("CRONIC_TEST_TOKEN")
+
+	cronCtx := &crontab.Context{
+		Shell:   "/bin/sh",
+		Environ: map[string]string{"CRONIC_TEST_FROM_CRONTAB": "x"},
+	}
+
+	job := &crontab.Job{
+		Environ: map[string]string{"CRONIC_TEST_TOKEN": "mine"},
+		EnvDeny: []string{"CRONIC_TEST_*"},
+	}
+
+	// The crontab's and the job's own variables aren't inherited, so they
+	// aren't scrubbed
+	env := jobEnviron(cronCtx, &Options{}, nil, job)
+	assert.Contains(t, env, "CRONIC_TEST_FROM_CRONTAB=x")
+	assert.Contains(t, env, "CRONIC_TEST_TOKEN=mine")
+	assert.NotContains(t, env, "CRONIC_TEST_SECRET=hunter2")
+	assert.NotContains(t, env, "CRONIC_TEST_TOKEN=s3cr3t")
+
+	opts := &Options{EnvAllow: []string{"PATH", "CRONIC_TEST_TOKEN"}}
+	env = jobEnviron(cronCtx, opts, nil, &crontab.Job{})
+	assert.Contains(t, env, "CRONIC_TEST_TOKEN=s3cr3t")
+	assert.NotContains(t, env, "CRONIC_TEST_SECRET=hunter2")
+	for _, kv := range env {
+		assert.Regexp(t, "^(PATH|CRONIC_TEST_TOKEN|CRONIC_TEST_FROM_CRONTAB)=", kv)
+	}
+
+	opts = &Options{EnvDeny: []string{"CRONIC_TEST_SECRET"}}
+	env = jobEnviron(cronCtx, opts, nil, &crontab.Job{EnvAllow: []string{"CRONIC_TEST_*"}})
+	assert.Contains(t, env, "CRONIC_TEST_TOKEN=s3cr3t")
+	assert.NotContains(t, env, "CRONIC_TEST_SECRET=hunter2")
+}
+
+func TestNamespaceLimitsConcurrentRuns(t *testing.T) {
+	namespaces, err := ParseNamespaces(strings.NewReader(`{"billing": {"max_concurrent": 1}}`))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	opts := &Options{Namespaces: namespaces}
+
+	var wg sync.WaitGroup
+
+	ctx, stop := context.WithCancel(context.Background())
+	statuses := make([]*JobStatus, 0)
+
+	for i := 0; i < 2; i++ {
+		job := newTestJob("sleep 0.2")
+		job.Position = i
+		job.Namespace = "billing"
+
+		logger, _ := newTestLogger()
+		status := NewJobStatus(job)
+		statuses = append(statuses, status)
+
+		StartJob(ctx, &wg, &basicContext, opts, status, logger)
+	}
+
+	for _, status := range statuses {
+		assert.Nil(t, status.Trigger())
+	}
+
+	waitFor(t, "both jobs to run", func() bool {
+		return statuses[0].Snapshot().LastResult != nil && statuses[1].Snapshot().LastResult != nil
+	})
+
+	first, second := statuses[0].Snapshot().LastResult, statuses[1].Snapshot().LastResult
+	if first.StartedAt.After(second.StartedAt) {
+		first, second = second, first
+	}
+	assert.False(t, second.StartedAt.Before(first.FinishedAt))
+
+	stop()
+	wg.Wait()
+}
+
+func TestRunJobRejectsUnknownNamespace(t *testing.T) {
+	logger, _ := newTestLogger()
+
+	status := newTestStatus("true")
+	status.Job.Namespace = "nope"
+
+	assert.Equal(t, ErrNoSuchNamespace, runJob(context.Background(), &basicContext, &basicOptions, status, logger))
+}
+
+func TestRegistryRejectsUnknownNamespace(t *testing.T) {
+	logger, _ := newTestLogger()
+	registry := NewRegistry(&basicContext, &Options{}, logger, func([]*crontab.Job) error { return nil })
+
+	job := newTestJob("true")
+	job.Namespace = "nope"
+
+	_, err := registry.Create(job)
+	assert.Equal(t, ErrNoSuchNamespace, err)
+}
@@ -0,0 +1,124 @@
+package cron
+
+import (
+	"time"
+
+	"github.com/samgaw/cronic/crontab"
+)
+
+// Options holds the settings that apply to all jobs, as opposed to those
+// found in the crontab.
+type Options struct {
+	// Archive stores the output of each run, if set.
+	Archive *Archive
+
+	// State stores the result of each run, if set.
+	State StateStore
+
+	// How many of the last lines of output to include when reporting a
+	// failure.
+	FailureTailLines int
+
+	// Notifiers are notified of job events (e.g. failures).
+	Notifiers []Notifier
+
+	// Namespaces jobs can belong to, by name
+	Namespaces map[string]*Namespace
+
+	// Whether to pass the trace context of each run to the job (as
+	// TRACEPARENT), so its own traces are part of the run's.
+	PropagateTraceContext bool
+
+	// Where to keep the files of host-wide locks (DEFAULT_LOCK_DIR if
+	// empty)
+	LockDir string
+
+	// Runs the commands of jobs (LocalExecutor if nil), those of jobs with
+	// an image (e.g. a DockerExecutor), and those of jobs with a remote
+	// host (e.g. an SSHExecutor)
+	Executor          Executor
+	ContainerExecutor Executor
+	RemoteExecutor    Executor
+
+	// What to do when a job's command can't be started, unless the job
+	// says otherwise (one of the crontab.SpawnFailure* policies, or empty
+	// for crontab.SpawnFailureFail)
+	OnSpawnFailure string
+
+	// How many lines of output per second to relay from each job, unless
+	// the job says otherwise (0 for no limit)
+	OutputRateLimit int
+
+	// How many lines of output per second to log from each job, with bursts
+	// of how many, and one in how many lines to log, unless the job says
+	// otherwise (0 for no limit, a second's worth, or all lines)
+	LogRateLimit int
+	LogBurst     int
+	LogSample    int
+
+	// The cgroup v2 directory in which to create the cgroups of jobs with
+	// memory or CPU limits (see ResourceLimits)
+	CgroupDir string
+
+	// Which of cronic's environment variables jobs inherit (see
+	// crontab.ParseEnvPatterns): only those EnvAllow matches (if set),
+	// except those EnvDeny matches. Jobs can narrow this further with their
+	// env-allow and env-deny annotations.
+	EnvAllow []string
+	EnvDeny  []string
+
+	// Resolves the secrets jobs' environment variables refer to, if set
+	Secrets SecretResolver
+
+	// Whether to log the fields of jobs' output lines that are JSON
+	// objects, unless the job says otherwise (see logOutputLine)
+	JSONOutput bool
+
+	// Writes jobs' output as it is instead of logging it, if set.
+	Passthrough *Passthrough
+
+	// Sends jobs' messages to syslog too, if set.
+	Syslog *Syslog
+
+	// Sends jobs' messages to the systemd journal instead of logging them,
+	// if set.
+	Journal *Journal
+
+	// Sends jobs' messages to Graylog too, if set.
+	GELF *GELF
+
+	// Pushes jobs' messages to Loki too, if set.
+	Loki *Loki
+
+	// Streams jobs' events and output to the clients of a Unix socket, if
+	// set.
+	EventStream *EventStream
+
+	// Reschedules jobs when the wall clock jumps, if set.
+	Clock *ClockWatcher
+
+	// Schedules the jobs sharing it from a single goroutine, if set
+	// (otherwise, each job has a queue of its own).
+	Timers *TimerQueue
+
+	// Runs jobs' runs, with a limit on how many run at once, if set
+	// (otherwise, each run has a goroutine of its own).
+	Workers *WorkerPool
+
+	// When none of the jobs run, if set.
+	Blackout *GlobalBlackout
+
+	// The days when jobs with a skip-holidays annotation don't run, if set.
+	Holidays *crontab.Holidays
+
+	// Closed to kill the processes of the runs that are stopped from then
+	// on right away, rather than after KILL_GRACE_PERIOD, if set (see
+	// StopRunsOnShutdown).
+	Kill chan struct{}
+
+	// How long runs can last before they're killed, or before cronic warns
+	// about them, unless the job says otherwise (0 for no limit, or no
+	// warning)
+	Timeout   time.Duration
+	WarnAfter time.Duration
+}
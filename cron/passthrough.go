@@ -0,0 +1,54 @@
+package cron
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/samgaw/cronic/crontab"
+)
+
+// Passthrough writes the output of jobs as it is, instead of logging it, for
+// log collectors that expect the jobs' own format.
+type Passthrough struct {
+	stdout io.Writer
+	stderr io.Writer
+
+	// Whether to prefix lines with the name of their job
+	prefix bool
+
+	// Lines of jobs running at the same time mustn't be interleaved
+	mu sync.Mutex
+}
+
+// NewPassthrough returns a Passthrough writing jobs' stdout to stdout and
+// their stderr to stderr, with lines prefixed with the name of their job
+// (e.g. "[backup] ") if prefix is set.
+func NewPassthrough(stdout io.Writer, stderr io.Writer, prefix bool) *Passthrough {
+	return &Passthrough{stdout: stdout, stderr: stderr, prefix: prefix}
+}
+
+func (p *Passthrough) writeLine(job *crontab.Job, channel string, line string) {
+	out := p.stdout
+	if channel == "stderr" {
+		out = p.stderr
+	}
+
+	if p.prefix {
+		line = fmt.Sprintf("[%s] %s", passthroughName(job), line)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	io.WriteString(out, line+"\n")
+}
+
+// passthroughName returns the name of a job for prefixes, which is its
+// position for jobs without a name.
+func passthroughName(job *crontab.Job) string {
+	if job.Name != "" {
+		return job.Name
+	}
+	return fmt.Sprintf("job-%d", job.Position)
+}
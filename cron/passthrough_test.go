@@ -0,0 +1,50 @@
+package cron
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunJobPassesOutputThrough(t *testing.T) {
+	for _, prefix := range []bool{false, true} {
+		var stdout, stderr bytes.Buffer
+
+		logger, channel := newTestLogger()
+
+		status := newTestStatus("echo hello; echo oops >&2; echo bye")
+		status.Job.Name = "greet"
+
+		opts := basicOptions
+		opts.Passthrough = NewPassthrough(&stdout, &stderr, prefix)
+
+		assert.Nil(t, runJob(context.Background(), &basicContext, &opts, status, logger))
+
+		if prefix {
+			assert.Equal(t, "[greet] hello\n[greet] bye\n", stdout.String())
+			assert.Equal(t, "[greet] oops\n", stderr.String())
+		} else {
+			assert.Equal(t, "hello\nbye\n", stdout.String())
+			assert.Equal(t, "oops\n", stderr.String())
+		}
+
+		// The output isn't logged, but it's still recorded
+		expectMessages(t, channel, "Starting")
+		assert.Len(t, channel, 0)
+		assert.Len(t, status.outputTail(10), 3)
+	}
+
+	var stdout bytes.Buffer
+
+	logger, _ := newTestLogger()
+	status := newTestStatus("echo hello")
+	status.Job.Position = 3
+
+	opts := basicOptions
+	opts.Passthrough = NewPassthrough(&stdout, &stdout, true)
+
+	assert.Nil(t, runJob(context.Background(), &basicContext, &opts, status, logger))
+	assert.Equal(t, "[job-3] hello\n", stdout.String())
+}
@@ -0,0 +1,140 @@
+package cron
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+var (
+	PROC_DIR = "/proc"
+
+	// The processes cronic started, and waits for itself
+	processes = &processTable{pids: make(map[int]struct{})}
+)
+
+// processTable tracks the processes started by cronic, so that the reaper
+// (see StartReaper) leaves them to exec.Cmd.Wait.
+type processTable struct {
+	mu   sync.Mutex
+	pids map[int]struct{}
+}
+
+// start starts cmd, and tracks it until forget is called.
+func (t *processTable) start(cmd *exec.Cmd) error {
+	// Hold the lock while starting, or the process could exit and be
+	// reaped before it is tracked
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	t.pids[cmd.Process.Pid] = struct{}{}
+	return nil
+}
+
+func (t *processTable) forget(pid int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.pids, pid)
+}
+
+// StartReaper reaps the zombies of orphaned processes until ctx is done.
+// This is init's job, which falls to cronic when it is PID 1 (e.g. in a
+// container): processes started by jobs that outlive their parent (e.g.
+// daemons that double-fork) are re-parented to it, and would otherwise
+// accumulate as zombies once they exit.
+func StartReaper(ctx context.Context, logger *Logger) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGCHLD)
+
+	go func() {
+		defer signal.Stop(sigChan)
+
+		for {
+			// Signals are coalesced, so every exited orphan is
+			// reaped each time
+			reapOrphans(logger)
+
+			select {
+			case <-sigChan:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// reapOrphans reaps the zombie children of cronic that it didn't start, and
+// returns how many there were.
+func reapOrphans(logger *Logger) int {
+	processes.mu.Lock()
+	defer processes.mu.Unlock()
+
+	entries, err := ioutil.ReadDir(PROC_DIR)
+	if err != nil {
+		logger.Errorf("CRONIC: Failed to list processes: %v", err)
+		return 0
+	}
+
+	self := os.Getpid()
+	reaped := 0
+
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		if _, ok := processes.pids[pid]; ok {
+			continue
+		}
+
+		// The process may have exited (and been reaped) since
+		ppid, zombie, err := readProcessStat(pid)
+		if err != nil || ppid != self || !zombie {
+			continue
+		}
+
+		var waitStatus syscall.WaitStatus
+		if reapedPid, err := syscall.Wait4(pid, &waitStatus, syscall.WNOHANG, nil); err == nil && reapedPid == pid {
+			logger.Debugf("CRONIC: Reaped orphaned process %d", pid)
+			reaped++
+		}
+	}
+
+	return reaped
+}
+
+// readProcessStat returns the parent of a process, and whether it is a
+// zombie, from its /proc/PID/stat file.
+func readProcessStat(pid int) (int, bool, error) {
+	data, err := ioutil.ReadFile(filepath.Join(PROC_DIR, strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return 0, false, err
+	}
+
+	// The command name may contain spaces and parentheses, but is followed
+	// by the last ")" of the line: e.g. "42 (sleep) Z 1 ..."
+	stat := string(data)
+	fields := strings.Fields(stat[strings.LastIndex(stat, ")")+1:])
+	if len(fields) < 2 {
+		return 0, false, syscall.EINVAL
+	}
+
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return 0, false, err
+	}
+
+	return ppid, fields[0] == "Z", nil
+}
@@ -0,0 +1,84 @@
+package cron
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func waitForZombie(t *testing.T, pid int) {
+	for start := time.Now(); time.Since(start) < 3*time.Second; time.Sleep(10 * time.Millisecond) {
+		if _, zombie, err := readProcessStat(pid); err == nil && zombie {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for process %d to exit", pid)
+}
+
+func TestReapOrphans(t *testing.T) {
+	logger, _ := newTestLogger()
+
+	// Processes cronic started are left alone
+	tracked := exec.Command("true")
+	if !assert.Nil(t, processes.start(tracked)) {
+		return
+	}
+	waitForZombie(t, tracked.Process.Pid)
+
+	assert.Equal(t, 0, reapOrphans(logger))
+	assert.Nil(t, tracked.Wait())
+	processes.forget(tracked.Process.Pid)
+
+	// Others are reaped
+	orphan := exec.Command("true")
+	if !assert.Nil(t, orphan.Start()) {
+		return
+	}
+	waitForZombie(t, orphan.Process.Pid)
+
+	assert.Equal(t, 1, reapOrphans(logger))
+	assert.NotNil(t, orphan.Wait())
+}
+
+func TestReadProcessStat(t *testing.T) {
+	defer func(dir string) {
+		PROC_DIR = dir
+	}(PROC_DIR)
+
+	dir, err := ioutil.TempDir("", "cronic-proc")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	PROC_DIR = dir
+
+	for pid, stat := range map[string]string{
+		"42": "42 (sleep) Z 1 42 42 0 -1 4194560",
+		"43": "43 (a (b) c) S 7 43 43 0 -1 4194560",
+		"44": "44 (broken",
+	} {
+		assert.Nil(t, os.MkdirAll(filepath.Join(dir, pid), 0755))
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, pid, "stat"), []byte(stat), 0644))
+	}
+
+	ppid, zombie, err := readProcessStat(42)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, ppid)
+	assert.True(t, zombie)
+
+	ppid, zombie, err = readProcessStat(43)
+	assert.Nil(t, err)
+	assert.Equal(t, 7, ppid)
+	assert.False(t, zombie)
+
+	_, _, err = readProcessStat(44)
+	assert.NotNil(t, err)
+
+	_, _, err = readProcessStat(45)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,596 @@
+package cron
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/samgaw/cronic/crontab"
+)
+
+var (
+	ErrNoSuchJob        = errors.New("CRONIC: No such job")
+	ErrNotManaged       = errors.New("CRONIC: Job is defined in the crontab and cannot be changed at runtime")
+	ErrNotPersisted     = errors.New("CRONIC: Jobs cannot be changed at runtime without a managed crontab")
+	ErrRegistryShutdown = errors.New("CRONIC: Shutting down")
+	ErrDuplicateName    = errors.New("CRONIC: Another job has the same name")
+)
+
+// PersistFunc saves the managed jobs (in position order), e.g. to a managed
+// crontab. Changes are only applied once they have been persisted.
+type PersistFunc func(jobs []*crontab.Job) error
+
+// Registry holds the scheduled jobs. Jobs from the crontab are fixed, but
+// managed jobs can be created, updated and deleted while cronic runs.
+type Registry struct {
+	cronCtx *crontab.Context
+	opts    *Options
+	logger  *Logger
+	persist PersistFunc
+
+	// Stops scheduling the jobs, and their runs (see StartContext)
+	ctx context.Context
+
+	mu           sync.Mutex
+	wg           sync.WaitGroup
+	entries      map[int]*registryEntry
+	nextPosition int
+	started      bool
+	shutdown     bool
+	draining     bool
+
+	// Whether all jobs are paused, whatever their own paused state (see
+	// Pause)
+	paused *globalPause
+}
+
+type registryEntry struct {
+	status *JobStatus
+
+	// Stops scheduling the job (only set once started)
+	stop context.CancelFunc
+
+	// Closed once the job's goroutine returns (only set once started)
+	done chan struct{}
+}
+
+// NewRegistry creates a registry for jobs sharing the crontab context
+// cronCtx. If persist is nil, managed jobs cannot be changed.
+func NewRegistry(cronCtx *crontab.Context, opts *Options, logger *Logger, persist PersistFunc) *Registry {
+	return &Registry{
+		cronCtx: cronCtx,
+		opts:    opts,
+		logger:  logger,
+		persist: persist,
+		ctx:     context.Background(),
+		entries: make(map[int]*registryEntry),
+		paused:  &globalPause{},
+	}
+}
+
+// JobLogger returns a logger tagged with the job's details (see JobFields).
+func JobLogger(logger *Logger, job *crontab.Job) *Logger {
+	return logger.WithFields(JobFields(job))
+}
+
+// JobFields returns the fields that identify a job in what's logged. Named
+// jobs are identified by their name, rather than their position and
+// command.
+func JobFields(job *crontab.Job) Fields {
+	fields := Fields{
+		"job.schedule": job.Schedule,
+	}
+
+	if job.Name != "" {
+		fields["job.name"] = job.Name
+	} else {
+		fields["job.command"] = job.Command
+		fields["job.position"] = job.Position
+	}
+
+	if job.Namespace != "" {
+		fields["job.namespace"] = job.Namespace
+	}
+
+	return fields
+}
+
+// Add registers a job without persisting it, e.g. when loading jobs at
+// startup. The job is assigned the next position, which identifies it from
+// then on.
+func (r *Registry) Add(job *crontab.Job, managed bool) *JobStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job.Position = r.nextPosition
+	r.nextPosition++
+
+	return r.add(job, managed, nil)
+}
+
+// Start schedules the registered jobs. Jobs added later are scheduled
+// immediately.
+func (r *Registry) Start() {
+	r.StartContext(context.Background())
+}
+
+// StartContext schedules the registered jobs like Start, until ctx is done:
+// its cancellation then also stops the runs in progress (along with the
+// processes they started), unlike Shutdown, which lets them finish.
+func (r *Registry) StartContext(ctx context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.ctx = ctx
+	r.started = true
+	for _, entry := range r.entries {
+		r.start(entry, nil)
+	}
+}
+
+// Create adds a managed job, and persists it.
+func (r *Registry) Create(job *crontab.Job) (*JobStatus, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkWritable(); err != nil {
+		return nil, err
+	}
+
+	if _, err := r.opts.Namespace(job); err != nil {
+		return nil, err
+	}
+
+	if r.nameTaken(job.Name, -1) {
+		return nil, ErrDuplicateName
+	}
+
+	job.Position = r.nextPosition
+
+	if err := r.persistWith(job, -1); err != nil {
+		return nil, err
+	}
+
+	r.nextPosition++
+
+	return r.add(job, true, nil), nil
+}
+
+// Update replaces the managed job at position, keeping its position and
+// paused state. If the job is running, the new job is only scheduled once the
+// run is done, so runs never overlap.
+func (r *Registry) Update(position int, job *crontab.Job) (*JobStatus, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkWritable(); err != nil {
+		return nil, err
+	}
+
+	entry, err := r.managedEntry(position)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := r.opts.Namespace(job); err != nil {
+		return nil, err
+	}
+
+	if r.nameTaken(job.Name, position) {
+		return nil, ErrDuplicateName
+	}
+
+	job.Position = position
+
+	if err := r.persistWith(job, position); err != nil {
+		return nil, err
+	}
+
+	return r.replace(entry, job), nil
+}
+
+// Delete removes the managed job at position. A run in progress is left to
+// finish.
+func (r *Registry) Delete(position int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkWritable(); err != nil {
+		return err
+	}
+
+	entry, err := r.managedEntry(position)
+	if err != nil {
+		return err
+	}
+
+	if err := r.persistWith(nil, position); err != nil {
+		return err
+	}
+
+	r.stop(entry)
+	delete(r.entries, position)
+
+	return nil
+}
+
+// Reload replaces the jobs from the crontab with those of tab (e.g. once the
+// crontab file changed), leaving managed jobs alone. A job is the same one
+// in both if it has the same name or, for jobs without a name, the same
+// definition. Jobs that didn't change keep being scheduled as they were,
+// while those that did keep their position and paused state, like with
+// Update. If the crontab's context (e.g. its environment) changed, all jobs
+// are rescheduled with the new one. If tab is invalid, nothing changes.
+func (r *Registry) Reload(tab *crontab.Crontab) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.shutdown {
+		return ErrRegistryShutdown
+	}
+
+	for _, job := range tab.Jobs {
+		if _, err := r.opts.Namespace(job); err != nil {
+			return fmt.Errorf("%v: %q (job %d)", err, job.Namespace, job.Position)
+		}
+
+		for _, entry := range r.entries {
+			if entry.status.managed && job.Name != "" && entry.status.Job.Name == job.Name {
+				return fmt.Errorf("%v: %q (managed job %d)", ErrDuplicateName, job.Name, entry.status.Job.Position)
+			}
+		}
+	}
+
+	contextChanged := !reflect.DeepEqual(r.cronCtx, tab.Context)
+	r.cronCtx = tab.Context
+
+	previous := make([]*registryEntry, 0, len(r.entries))
+	for _, status := range r.jobs(false) {
+		if !status.managed {
+			previous = append(previous, r.entries[status.Job.Position])
+		}
+	}
+
+	matched := make(map[*registryEntry]bool)
+
+	for _, job := range tab.Jobs {
+		entry := matchEntry(previous, matched, job)
+		if entry == nil {
+			job.Position = r.nextPosition
+			r.nextPosition++
+
+			r.add(job, false, nil)
+			JobLogger(r.logger, job).Info("CRONIC: Job added to the crontab")
+			continue
+		}
+
+		matched[entry] = true
+		if !contextChanged && sameJob(entry.status.Job, job) {
+			continue
+		}
+
+		job.Position = entry.status.Job.Position
+		r.replace(entry, job)
+		JobLogger(r.logger, job).Info("CRONIC: Job changed in the crontab, rescheduling it")
+	}
+
+	for _, entry := range previous {
+		if !matched[entry] {
+			r.stop(entry)
+			delete(r.entries, entry.status.Job.Position)
+			JobLogger(r.logger, entry.status.Job).Info("CRONIC: Job removed from the crontab")
+		}
+	}
+
+	if contextChanged {
+		for _, status := range r.jobs(true) {
+			r.replace(r.entries[status.Job.Position], status.Job)
+		}
+	}
+
+	return nil
+}
+
+// matchEntry returns the entry (among those that aren't matched yet) of the
+// job that job is a new version of, or nil if it's a new job.
+func matchEntry(entries []*registryEntry, matched map[*registryEntry]bool, job *crontab.Job) *registryEntry {
+	for _, entry := range entries {
+		if matched[entry] {
+			continue
+		}
+
+		if job.Name != "" && entry.status.Job.Name == job.Name {
+			return entry
+		}
+
+		if job.Name == "" && entry.status.Job.Name == "" && sameJob(entry.status.Job, job) {
+			return entry
+		}
+	}
+	return nil
+}
+
+// sameJob reports whether two jobs have the same definition, wherever they
+// are in the crontab (or in the files it includes).
+func sameJob(a *crontab.Job, b *crontab.Job) bool {
+	aCopy, bCopy := *a, *b
+	aCopy.Position, bCopy.Position = 0, 0
+	aCopy.File, bCopy.File = "", ""
+	aCopy.Line, bCopy.Line = 0, 0
+	return reflect.DeepEqual(aCopy, bCopy)
+}
+
+// Blackout returns the global blackout of the jobs (nil if there's none,
+// see Options.Blackout).
+func (r *Registry) Blackout() *GlobalBlackout {
+	return r.opts.Blackout
+}
+
+// Jobs returns all jobs, in position order.
+func (r *Registry) Jobs() []*JobStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.jobs(false)
+}
+
+// Job returns the job at position, or nil.
+func (r *Registry) Job(position int) *JobStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.entries[position]
+	if !ok {
+		return nil
+	}
+	return entry.status
+}
+
+// JobByName returns the job named name, or nil.
+func (r *Registry) JobByName(name string) *JobStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, status := range r.jobs(false) {
+		if name != "" && status.Job.Name == name {
+			return status
+		}
+	}
+	return nil
+}
+
+// WaitOneShots waits until the jobs that run a single time (see
+// crontab.Job.RunsOnce) are done, and returns them, or nil if there are none.
+// Call it once the registry is started.
+func (r *Registry) WaitOneShots() []*JobStatus {
+	r.mu.Lock()
+	entries := make([]*registryEntry, 0)
+	for _, entry := range r.entries {
+		if _, ok := entry.status.Job.RunsOnce(); ok && entry.done != nil {
+			entries = append(entries, entry)
+		}
+	}
+	r.mu.Unlock()
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	statuses := make([]*JobStatus, len(entries))
+	for i, entry := range entries {
+		<-entry.done
+		statuses[i] = entry.status
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Job.Position < statuses[j].Job.Position })
+	return statuses
+}
+
+// Drain stops all new runs of all jobs (including jobs added later), but
+// lets runs in progress finish (see JobStatus.Drain).
+func (r *Registry) Drain() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.draining = true
+	for _, entry := range r.entries {
+		entry.status.Drain()
+	}
+}
+
+// Pause stops scheduled runs of all jobs (e.g. while performing maintenance)
+// until Resume is called. Jobs keep their own paused state (see
+// JobStatus.Pause), which Resume leaves as it was.
+func (r *Registry) Pause() {
+	r.paused.set(true)
+}
+
+func (r *Registry) Resume() {
+	r.paused.set(false)
+}
+
+// Paused reports whether all jobs are paused (see Pause).
+func (r *Registry) Paused() bool {
+	return r.paused.get()
+}
+
+// Shutdown stops scheduling all jobs, and waits for runs in progress to
+// finish.
+func (r *Registry) Shutdown() {
+	r.mu.Lock()
+	r.shutdown = true
+	for _, entry := range r.entries {
+		r.stop(entry)
+	}
+	r.mu.Unlock()
+
+	r.wg.Wait()
+}
+
+func (r *Registry) checkWritable() error {
+	if r.shutdown {
+		return ErrRegistryShutdown
+	}
+
+	if r.persist == nil {
+		return ErrNotPersisted
+	}
+
+	return nil
+}
+
+// nameTaken reports whether a job other than the one at position is named
+// name.
+func (r *Registry) nameTaken(name string, position int) bool {
+	if name == "" {
+		return false
+	}
+
+	for _, entry := range r.entries {
+		if entry.status.Job.Name == name && entry.status.Job.Position != position {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Registry) managedEntry(position int) (*registryEntry, error) {
+	entry, ok := r.entries[position]
+	if !ok {
+		return nil, ErrNoSuchJob
+	}
+
+	if !entry.status.managed {
+		return nil, ErrNotManaged
+	}
+
+	return entry, nil
+}
+
+// persistWith persists the managed jobs, replacing the one at position (if
+// any) with job (if not nil).
+func (r *Registry) persistWith(job *crontab.Job, position int) error {
+	jobs := make([]*crontab.Job, 0, len(r.entries)+1)
+	for _, status := range r.jobs(true) {
+		if status.Job.Position != position {
+			jobs = append(jobs, status.Job)
+		}
+	}
+
+	if job != nil {
+		jobs = append(jobs, job)
+		sort.Slice(jobs, func(i, j int) bool { return jobs[i].Position < jobs[j].Position })
+	}
+
+	return r.persist(jobs)
+}
+
+func (r *Registry) jobs(managedOnly bool) []*JobStatus {
+	statuses := make([]*JobStatus, 0, len(r.entries))
+	for _, entry := range r.entries {
+		if managedOnly && !entry.status.managed {
+			continue
+		}
+		statuses = append(statuses, entry.status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Job.Position < statuses[j].Job.Position })
+
+	return statuses
+}
+
+// add registers job, replacing previous (if not nil), whose job must be
+// stopped.
+func (r *Registry) add(job *crontab.Job, managed bool, previous *registryEntry) *JobStatus {
+	status := NewJobStatus(job)
+	status.managed = managed
+	status.allPaused = r.paused
+	if r.draining {
+		status.Drain()
+	}
+	if previous != nil {
+		status.carryOver(previous.status)
+	}
+
+	entry := &registryEntry{status: status}
+	r.entries[job.Position] = entry
+
+	if r.started {
+		r.start(entry, previous)
+	}
+
+	return status
+}
+
+// replace replaces the job of entry with job, keeping its paused state, last
+// result and failure streak. If the job is running, the new job is only
+// scheduled once the run is done (and takes on its result).
+func (r *Registry) replace(entry *registryEntry, job *crontab.Job) *JobStatus {
+	r.stop(entry)
+
+	return r.add(job, entry.status.managed, entry)
+}
+
+// start schedules the job of entry, once the job it replaces (previous, if
+// not nil) is done.
+func (r *Registry) start(entry *registryEntry, previous *registryEntry) {
+	ctx, stop := context.WithCancel(r.ctx)
+	entry.stop = stop
+	entry.done = make(chan struct{})
+	entry.status.dependency = r.JobByName
+	entry.status.runParent = r.ctx
+
+	r.wg.Add(1)
+
+	onDone := func() {
+		close(entry.done)
+		r.wg.Done()
+	}
+	jobLogger := JobLogger(r.logger, entry.status.Job)
+
+	if previous == nil || previous.done == nil {
+		startJob(ctx, r.cronCtx, r.opts, entry.status, jobLogger, onDone)
+		return
+	}
+
+	// The job it replaces may still be running
+	go func() {
+		<-previous.done
+		entry.status.carryOver(previous.status)
+		startJob(ctx, r.cronCtx, r.opts, entry.status, jobLogger, onDone)
+	}()
+}
+
+// globalPause is whether all the jobs of a registry are paused, which their
+// statuses share.
+type globalPause struct {
+	mu     sync.Mutex
+	paused bool
+}
+
+func (p *globalPause) set(paused bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.paused = paused
+}
+
+// get reports whether jobs are paused (never, if p is nil, for jobs that
+// aren't in a registry).
+func (p *globalPause) get() bool {
+	if p == nil {
+		return false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.paused
+}
+
+func (r *Registry) stop(entry *registryEntry) {
+	if entry.stop != nil {
+		entry.stop()
+	}
+}
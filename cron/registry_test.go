@@ -0,0 +1,420 @@
+package cron
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestJob(command string) *crontab.Job {
+	return &crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: &testExpression{time.Hour},
+			Schedule:   "@hourly",
+			Command:    command,
+		},
+	}
+}
+
+func waitFor(t *testing.T, label string, condition func() bool) {
+	deadline := time.Now().Add(3 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", label)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRegistryPersistsManagedJobs(t *testing.T) {
+	var persisted []*crontab.Job
+	persistErr := error(nil)
+
+	logger, _ := newTestLogger()
+	registry := NewRegistry(&basicContext, &basicOptions, logger, func(jobs []*crontab.Job) error {
+		if persistErr != nil {
+			return persistErr
+		}
+		persisted = jobs
+		return nil
+	})
+
+	fixed := registry.Add(newTestJob("true"), false)
+	loaded := registry.Add(newTestJob("loaded"), true)
+	assert.Equal(t, 0, fixed.Job.Position)
+	assert.Equal(t, 1, loaded.Job.Position)
+
+	created, err := registry.Create(newTestJob("created"))
+	if assert.Nil(t, err) {
+		assert.Equal(t, 2, created.Job.Position)
+		assert.True(t, created.Snapshot().Managed)
+	}
+
+	// Only managed jobs are persisted, in position order
+	if assert.Equal(t, 2, len(persisted)) {
+		assert.Equal(t, "loaded", persisted[0].Command)
+		assert.Equal(t, "created", persisted[1].Command)
+	}
+
+	loaded.Pause()
+	updated, err := registry.Update(1, newTestJob("updated"))
+	if assert.Nil(t, err) {
+		assert.Equal(t, 1, updated.Job.Position)
+		assert.True(t, updated.Paused())
+		assert.Equal(t, updated, registry.Job(1))
+	}
+
+	if assert.Equal(t, 2, len(persisted)) {
+		assert.Equal(t, "updated", persisted[0].Command)
+	}
+
+	_, err = registry.Update(0, newTestJob("nope"))
+	assert.Equal(t, ErrNotManaged, err)
+	assert.Equal(t, ErrNotManaged, registry.Delete(0))
+	assert.Equal(t, ErrNoSuchJob, registry.Delete(3))
+
+	// Changes that can't be persisted aren't applied
+	persistErr = errors.New("disk full")
+	assert.Equal(t, persistErr, registry.Delete(2))
+	_, err = registry.Create(newTestJob("lost"))
+	assert.Equal(t, persistErr, err)
+	assert.Equal(t, 3, len(registry.Jobs()))
+
+	persistErr = nil
+	assert.Nil(t, registry.Delete(2))
+
+	jobs := registry.Jobs()
+	if assert.Equal(t, 2, len(jobs)) {
+		assert.Equal(t, fixed, jobs[0])
+		assert.Equal(t, updated, jobs[1])
+	}
+
+	if assert.Equal(t, 1, len(persisted)) {
+		assert.Equal(t, "updated", persisted[0].Command)
+	}
+
+	// Positions aren't reused
+	created, err = registry.Create(newTestJob("created"))
+	if assert.Nil(t, err) {
+		assert.Equal(t, 3, created.Job.Position)
+	}
+}
+
+func newNamedTestJob(name string, command string) *crontab.Job {
+	job := newTestJob(command)
+	job.Name = name
+	return job
+}
+
+func TestRegistryRejectsDuplicateNames(t *testing.T) {
+	logger, _ := newTestLogger()
+	registry := NewRegistry(&basicContext, &basicOptions, logger, func(jobs []*crontab.Job) error {
+		return nil
+	})
+
+	fixed := registry.Add(newNamedTestJob("backup", "true"), false)
+	registry.Add(newTestJob("unnamed"), false)
+
+	_, err := registry.Create(newNamedTestJob("backup", "true"))
+	assert.Equal(t, ErrDuplicateName, err)
+
+	created, err := registry.Create(newNamedTestJob("report", "true"))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	assert.Equal(t, fixed, registry.JobByName("backup"))
+	assert.Equal(t, created, registry.JobByName("report"))
+	assert.Nil(t, registry.JobByName("nope"))
+	assert.Nil(t, registry.JobByName(""))
+
+	// A job keeps its name when it's updated
+	_, err = registry.Update(created.Job.Position, newNamedTestJob("report", "false"))
+	assert.Nil(t, err)
+
+	_, err = registry.Update(created.Job.Position, newNamedTestJob("backup", "false"))
+	assert.Equal(t, ErrDuplicateName, err)
+}
+
+func TestRegistryWithoutPersistenceIsReadOnly(t *testing.T) {
+	logger, _ := newTestLogger()
+	registry := NewRegistry(&basicContext, &basicOptions, logger, nil)
+	registry.Add(newTestJob("true"), true)
+
+	_, err := registry.Create(newTestJob("true"))
+	assert.Equal(t, ErrNotPersisted, err)
+	assert.Equal(t, ErrNotPersisted, registry.Delete(0))
+}
+
+func TestRegistryUpdateDoesNotOverlapRuns(t *testing.T) {
+	logger, _ := newTestLogger()
+	registry := NewRegistry(&basicContext, &basicOptions, logger, func([]*crontab.Job) error { return nil })
+
+	old := registry.Add(newTestJob("sleep 0.3"), true)
+	registry.Start()
+	defer registry.Shutdown()
+
+	assert.Nil(t, old.Trigger())
+	waitFor(t, "the job to start", func() bool { return old.Snapshot().Running })
+
+	updated, err := registry.Update(0, newTestJob("true"))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	// The run is queued until the old job is done (whose last result the
+	// updated job carries over until then). Both runs can have the same ID,
+	// if they start in the same second.
+	assert.Nil(t, updated.Trigger())
+	waitFor(t, "the updated job to run", func() bool {
+		result, oldResult := updated.Snapshot().LastResult, old.Snapshot().LastResult
+		return result != nil && oldResult != nil && !result.StartedAt.Equal(oldResult.StartedAt)
+	})
+
+	oldResult := old.Snapshot().LastResult
+	if assert.NotNil(t, oldResult) {
+		assert.False(t, updated.Snapshot().LastResult.StartedAt.Before(oldResult.FinishedAt))
+	}
+}
+
+func TestRegistrySchedulesCreatedJobs(t *testing.T) {
+	logger, _ := newTestLogger()
+	registry := NewRegistry(&basicContext, &basicOptions, logger, func([]*crontab.Job) error { return nil })
+	registry.Start()
+
+	status, err := registry.Create(newTestJob("true"))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	assert.Nil(t, status.Trigger())
+	waitFor(t, "the job to run", func() bool { return status.Snapshot().LastResult != nil })
+
+	registry.Shutdown()
+
+	_, err = registry.Create(newTestJob("true"))
+	assert.Equal(t, ErrRegistryShutdown, err)
+}
+
+func TestRegistryContextStopsRuns(t *testing.T) {
+	logger, _ := newTestLogger()
+	registry := NewRegistry(&basicContext, &basicOptions, logger, nil)
+	status := registry.Add(newTestJob("sleep 60"), false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	registry.StartContext(ctx)
+
+	assert.Nil(t, status.Trigger())
+	waitFor(t, "the job to start", func() bool { return status.Snapshot().Running })
+
+	// The run is stopped, rather than waited for
+	started := time.Now()
+	cancel()
+	registry.Shutdown()
+	assert.True(t, time.Since(started) < 5*time.Second)
+
+	result := status.Snapshot().LastResult
+	if assert.NotNil(t, result) {
+		assert.False(t, result.Success)
+		assert.False(t, result.WillRetry)
+	}
+}
+
+func TestJobLoggerIdentifiesNamedJobs(t *testing.T) {
+	logger, _ := newTestLogger()
+
+	fields := JobLogger(logger, newTestJob("true")).Data
+	assert.Equal(t, "true", fields["job.command"])
+	assert.Equal(t, 0, fields["job.position"])
+	assert.NotContains(t, fields, "job.name")
+
+	fields = JobLogger(logger, newNamedTestJob("backup", "true")).Data
+	assert.Equal(t, "backup", fields["job.name"])
+	assert.NotContains(t, fields, "job.command")
+	assert.NotContains(t, fields, "job.position")
+}
+
+func TestRegistryDrainsJobs(t *testing.T) {
+	logger, _ := newTestLogger()
+	registry := NewRegistry(&basicContext, &basicOptions, logger, func(jobs []*crontab.Job) error {
+		return nil
+	})
+
+	existing := registry.Add(newTestJob("true"), false)
+	registry.Drain()
+
+	created, err := registry.Create(newTestJob("true"))
+	if assert.Nil(t, err) {
+		assert.True(t, created.Draining())
+	}
+
+	assert.True(t, existing.Draining())
+	assert.True(t, existing.Snapshot().Draining)
+	assert.Equal(t, ErrDraining, existing.Trigger())
+}
+
+func TestRegistryWaitsForOneShotJobs(t *testing.T) {
+	logger, _ := newTestLogger()
+	registry := NewRegistry(&basicContext, &basicOptions, logger, nil)
+
+	registry.Add(newTestJob("true"), false)
+	assert.Nil(t, registry.WaitOneShots())
+
+	once, err := crontab.NewJob("@once", "exit 1", nil)
+	if !assert.Nil(t, err) {
+		return
+	}
+	registry.Add(once, false)
+	registry.Start()
+
+	oneShots := registry.WaitOneShots()
+	if assert.Equal(t, 1, len(oneShots)) {
+		assert.Equal(t, "exit 1", oneShots[0].Job.Command)
+		if result := oneShots[0].Snapshot().LastResult; assert.NotNil(t, result) {
+			assert.False(t, result.Success)
+		}
+	}
+
+	registry.Shutdown()
+}
+
+func TestRegistryReloadsCrontab(t *testing.T) {
+	logger, _ := newTestLogger()
+	registry := NewRegistry(&basicContext, &basicOptions, logger, nil)
+
+	kept := registry.Add(newTestJob("kept"), false)
+	renamed := registry.Add(newNamedTestJob("backup", "./backup.sh"), false)
+	removed := registry.Add(newTestJob("removed"), false)
+	managed := registry.Add(newTestJob("managed"), true)
+
+	renamed.Pause()
+
+	tab := &crontab.Crontab{
+		Context: &basicContext,
+		Jobs: []*crontab.Job{
+			newNamedTestJob("backup", "./backup.sh --full"),
+			newTestJob("added"),
+			newTestJob("kept"),
+		},
+	}
+	assert.Nil(t, registry.Reload(tab))
+
+	jobs := registry.Jobs()
+	if !assert.Equal(t, 4, len(jobs)) {
+		return
+	}
+
+	// Unchanged jobs keep their status, and changed ones their position
+	// and paused state
+	assert.Equal(t, kept, jobs[0])
+	assert.Equal(t, 1, jobs[1].Job.Position)
+	assert.Equal(t, "./backup.sh --full", jobs[1].Job.Command)
+	assert.True(t, jobs[1].Paused())
+	assert.Equal(t, managed, jobs[2])
+	assert.Equal(t, 4, jobs[3].Job.Position)
+	assert.Equal(t, "added", jobs[3].Job.Command)
+	assert.Nil(t, registry.Job(removed.Job.Position))
+
+	// When the context changes, all jobs are rescheduled with it
+	tab = &crontab.Crontab{
+		Context: &crontab.Context{Shell: "/bin/bash", Environ: map[string]string{}},
+		Jobs:    []*crontab.Job{newTestJob("kept")},
+	}
+	assert.Nil(t, registry.Reload(tab))
+
+	jobs = registry.Jobs()
+	if assert.Equal(t, 2, len(jobs)) {
+		assert.True(t, kept != jobs[0])
+		assert.Equal(t, "kept", jobs[0].Job.Command)
+		assert.True(t, managed != jobs[1])
+		assert.Equal(t, "managed", jobs[1].Job.Command)
+	}
+}
+
+func TestRegistryReloadKeepsCircuitBreakerPause(t *testing.T) {
+	logger, _ := newTestLogger()
+	registry := NewRegistry(&basicContext, &basicOptions, logger, nil)
+	registry.Start()
+	defer registry.Shutdown()
+
+	status := registry.Add(newNamedTestJob("backup", "./backup.sh"), false)
+
+	for i := 0; i < 3; i++ {
+		status.startRun(uint64(i))
+		status.finishRun(errors.New("failed"), nil, "")
+	}
+	until := time.Now().Add(time.Hour)
+	status.pauseUntil(until)
+
+	tab := &crontab.Crontab{
+		Context: &basicContext,
+		Jobs:    []*crontab.Job{newNamedTestJob("backup", "./backup.sh --full")},
+	}
+	assert.Nil(t, registry.Reload(tab))
+
+	reloaded := registry.JobByName("backup")
+	if !assert.NotEqual(t, status, reloaded) {
+		return
+	}
+
+	// The cool-down still ends when it would have, and the streak goes on
+	snapshot := reloaded.Snapshot()
+	assert.True(t, snapshot.Paused)
+	if assert.NotNil(t, snapshot.PausedUntil) {
+		assert.True(t, until.Equal(*snapshot.PausedUntil))
+	}
+	if assert.NotNil(t, snapshot.LastResult) {
+		assert.Equal(t, 3, snapshot.LastResult.ConsecutiveFailures)
+	}
+
+	reloaded.startRun(3)
+	assert.Equal(t, 4, reloaded.finishRun(errors.New("failed"), nil, "").ConsecutiveFailures)
+}
+
+func TestRegistryPausesAllJobs(t *testing.T) {
+	logger, _ := newTestLogger()
+	registry := NewRegistry(&basicContext, &basicOptions, logger, nil)
+
+	paused := registry.Add(newTestJob("paused"), false)
+	other := registry.Add(newTestJob("other"), false)
+	paused.Pause()
+
+	registry.Pause()
+	assert.True(t, registry.Paused())
+	assert.True(t, other.skipsRuns())
+	assert.False(t, other.Paused())
+	assert.True(t, other.Snapshot().AllPaused)
+
+	// Jobs that were paused on their own stay paused
+	registry.Resume()
+	assert.False(t, other.skipsRuns())
+	assert.True(t, paused.skipsRuns())
+	assert.False(t, paused.Snapshot().AllPaused)
+}
+
+func TestRegistryRejectsBadReloads(t *testing.T) {
+	logger, _ := newTestLogger()
+	registry := NewRegistry(&basicContext, &basicOptions, logger, nil)
+
+	fixed := registry.Add(newTestJob("true"), false)
+	registry.Add(newNamedTestJob("backup", "./backup.sh"), true)
+
+	for _, job := range []*crontab.Job{
+		newNamedTestJob("backup", "./other.sh"),
+		{CrontabLine: crontab.CrontabLine{Expression: &testExpression{time.Hour}, Command: "true"}, Namespace: "nope"},
+	} {
+		tab := &crontab.Crontab{Context: &basicContext, Jobs: []*crontab.Job{job}}
+		assert.NotNil(t, registry.Reload(tab))
+	}
+
+	// Nothing changed
+	jobs := registry.Jobs()
+	if assert.Equal(t, 2, len(jobs)) {
+		assert.Equal(t, fixed, jobs[0])
+	}
+}
@@ -0,0 +1,100 @@
+package cron
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+var (
+	// How many of the last results of each job status reports show, when
+	// there's a state store (which keeps more than the last one)
+	REPORT_RESULTS = 5
+)
+
+// WriteReport writes a human-readable report of the status of jobs to w
+// (e.g. when cronic gets SIGQUIT), to help find out why a job didn't run:
+// when each job runs next, whether it's running or paused, and its last
+// results (from state, if set).
+func WriteReport(w io.Writer, statuses []*JobStatus, state StateStore, now time.Time) {
+	sorted := make([]*JobStatus, len(statuses))
+	copy(sorted, statuses)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Job.Position < sorted[j].Job.Position })
+
+	fmt.Fprintf(w, "CRONIC: Status at %s (%d jobs)\n", now.Format(time.RFC3339), len(sorted))
+
+	for _, status := range sorted {
+		snapshot := status.Snapshot()
+
+		name := snapshot.Name
+		if name == "" {
+			name = fmt.Sprintf("job %d", snapshot.Position)
+		}
+
+		fmt.Fprintf(w, "\n%s: %s %s\n", name, snapshot.Schedule, snapshot.Command)
+
+		if snapshot.NextRun != nil {
+			fmt.Fprintf(w, "  next run: %s (in %v)\n", snapshot.NextRun.Format(time.RFC3339), snapshot.NextRun.Sub(now).Round(time.Second))
+		} else {
+			fmt.Fprintf(w, "  next run: none scheduled\n")
+		}
+
+		if snapshot.RunningSince != nil {
+			fmt.Fprintf(w, "  running:  since %s (%v)\n", snapshot.RunningSince.Format(time.RFC3339), now.Sub(*snapshot.RunningSince).Round(time.Second))
+		}
+
+		if snapshot.PausedSince != nil {
+			until := "until resumed"
+			if snapshot.PausedUntil != nil {
+				until = "until " + snapshot.PausedUntil.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "  paused:   since %s, %s\n", snapshot.PausedSince.Format(time.RFC3339), until)
+		}
+
+		if snapshot.Draining {
+			fmt.Fprintf(w, "  draining: no new runs can start\n")
+		}
+
+		results := reportResults(status, snapshot, state)
+		if len(results) == 0 {
+			fmt.Fprintf(w, "  results:  never ran\n")
+		}
+
+		for i, result := range results {
+			label := "results: "
+			if i > 0 {
+				label = "         "
+			}
+			fmt.Fprintf(w, "  %s %s\n", label, formatReportResult(result))
+		}
+	}
+}
+
+// reportResults returns the last results of a job, most recent first: from
+// the state store if there's one, or only the last one otherwise.
+func reportResults(status *JobStatus, snapshot JobSnapshot, state StateStore) []*RunResult {
+	if state != nil {
+		if results, err := state.History(StateKey(status.Job), REPORT_RESULTS); err == nil {
+			return results
+		}
+	}
+
+	if snapshot.LastResult == nil {
+		return nil
+	}
+	return []*RunResult{snapshot.LastResult}
+}
+
+func formatReportResult(result *RunResult) string {
+	outcome := "succeeded"
+	switch {
+	case result.TimedOut:
+		outcome = "timed out"
+	case !result.Success:
+		outcome = "failed: " + result.Error
+	}
+
+	duration := result.FinishedAt.Sub(result.StartedAt).Round(time.Millisecond)
+	return fmt.Sprintf("%s %s after %v (run %s)", result.StartedAt.Format(time.RFC3339), outcome, duration, result.RunID)
+}
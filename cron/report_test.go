@@ -0,0 +1,70 @@
+package cron
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteReport(t *testing.T) {
+	now := time.Date(2018, 4, 7, 9, 30, 0, 0, time.UTC)
+
+	backup := NewJobStatus(&crontab.Job{
+		CrontabLine: crontab.CrontabLine{Schedule: "0 3 * * *", Command: "./backup.sh"},
+		Name:        "backup-db",
+		Position:    1,
+	})
+	backup.setNextRun(now.Add(17*time.Hour + 30*time.Minute))
+	backup.restoreLastResult(&RunResult{
+		RunID:      "20180407T030000Z-1-0",
+		StartedAt:  now.Add(-6*time.Hour - 30*time.Minute),
+		FinishedAt: now.Add(-6*time.Hour - 29*time.Minute),
+		Error:      "CRONIC: Command exited with status 1",
+	})
+
+	cleanup := NewJobStatus(&crontab.Job{
+		CrontabLine: crontab.CrontabLine{Schedule: "@hourly", Command: "./cleanup.sh"},
+	})
+	cleanup.Pause()
+
+	var report bytes.Buffer
+	WriteReport(&report, []*JobStatus{backup, cleanup}, nil, now)
+
+	assert.Regexp(t, `^CRONIC: Status at 2018-04-07T09:30:00Z \(2 jobs\)
+
+job 0: @hourly ./cleanup.sh
+  next run: none scheduled
+  paused:   since \S+, until resumed
+  results:  never ran
+
+backup-db: 0 3 \* \* \* ./backup.sh
+  next run: 2018-04-08T03:00:00Z \(in 17h30m0s\)
+  results:  2018-04-07T03:00:00Z failed: CRONIC: Command exited with status 1 after 1m0s \(run 20180407T030000Z-1-0\)
+$`, report.String())
+}
+
+func TestWriteReportShowsHistory(t *testing.T) {
+	now := time.Date(2018, 4, 7, 9, 30, 0, 0, time.UTC)
+
+	job := &crontab.Job{CrontabLine: crontab.CrontabLine{Schedule: "@hourly", Command: "./sync.sh"}}
+	status := NewJobStatus(job)
+
+	store := &testStateStore{runs: map[string][]*RunResult{}}
+	for i := 3; i > 0; i-- {
+		startedAt := now.Add(-time.Duration(i) * time.Hour)
+		store.Record(StateKey(job), &RunResult{StartedAt: startedAt, FinishedAt: startedAt.Add(time.Second), Success: i != 2, TimedOut: i == 2})
+	}
+
+	var report bytes.Buffer
+	WriteReport(&report, []*JobStatus{status}, store, now)
+
+	assert.Contains(t, report.String(), `
+  results:  2018-04-07T08:30:00Z succeeded after 1s (run )
+            2018-04-07T07:30:00Z timed out after 1s (run )
+            2018-04-07T06:30:00Z succeeded after 1s (run )
+`)
+}
@@ -0,0 +1,40 @@
+package cron
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// SecretResolver resolves the secrets the values of jobs' environment
+// variables refer to (e.g. VAR=@/run/secrets/foo), when their commands are
+// started (see secrets.Resolver).
+type SecretResolver interface {
+	// Resolve returns the value of a variable whose value starts with @:
+	// the secret it refers to, or value itself if it doesn't refer to one.
+	Resolve(ctx context.Context, value string) (string, error)
+}
+
+// resolveSecrets returns env (as KEY=VALUE) with the secrets its values
+// refer to, if opts has a SecretResolver.
+func (opts *Options) resolveSecrets(ctx context.Context, env []string) ([]string, error) {
+	if opts.Secrets == nil {
+		return env, nil
+	}
+
+	resolved := make([]string, 0, len(env))
+	for _, kv := range env {
+		i := strings.Index(kv, "=")
+		if i == -1 || !strings.HasPrefix(kv[i+1:], "@") {
+			resolved = append(resolved, kv)
+			continue
+		}
+
+		value, err := opts.Secrets.Resolve(ctx, kv[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("can't resolve the secret of %s: %v", kv[:i], err)
+		}
+		resolved = append(resolved, kv[:i+1]+value)
+	}
+	return resolved, nil
+}
@@ -0,0 +1,41 @@
+package cron
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testSecrets map[string]string
+
+func (s testSecrets) Resolve(ctx context.Context, value string) (string, error) {
+	secret, ok := s[value]
+	if !ok {
+		return "", errors.New("no such secret")
+	}
+	return secret, nil
+}
+
+func TestRunJobResolvesSecrets(t *testing.T) {
+	logger, channel := newTestLogger()
+
+	status := newTestStatus(`echo "$DB_PASSWORD"`)
+	status.Job.Environ = map[string]string{"DB_PASSWORD": "@vault:secret/data/db#password"}
+
+	opts := basicOptions
+	opts.Secrets = testSecrets{"@vault:secret/data/db#password": "hunter2"}
+
+	assert.Nil(t, runJob(context.Background(), &basicContext, &opts, status, logger))
+	expectMessages(t, channel, "Starting", "^hunter2$")
+
+	// A secret that can't be resolved is a spawn failure
+	status = newTestStatus(`echo "$DB_PASSWORD"`)
+	status.Job.Environ = map[string]string{"DB_PASSWORD": "@vault:secret/data/nope#password"}
+
+	err := runJob(context.Background(), &basicContext, &opts, status, logger)
+	if assert.IsType(t, &StartError{}, err) {
+		assert.EqualError(t, err, "CRONIC: Failed to start command: can't resolve the secret of DB_PASSWORD: no such secret")
+	}
+}
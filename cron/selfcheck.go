@@ -0,0 +1,134 @@
+package cron
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samgaw/cronic/crontab"
+)
+
+// SELF_CHECK_JOB_NAME identifies the self-check in events (and so in
+// metrics and alerts).
+const SELF_CHECK_JOB_NAME = "cronic-self-check"
+
+var (
+	SELF_CHECK_TIMEOUT = 30 * time.Second
+)
+
+// HealthChecker is implemented by notifiers that can tell whether they work,
+// e.g. whether their notifications were delivered since they were last
+// checked.
+type HealthChecker interface {
+	Healthy() error
+}
+
+// CheckNotifiers checks all the notifiers that implement HealthChecker.
+func CheckNotifiers(notifiers []Notifier) error {
+	var problems []string
+
+	for _, notifier := range notifiers {
+		if checker, ok := notifier.(HealthChecker); ok {
+			if err := checker.Healthy(); err != nil {
+				problems = append(problems, err.Error())
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// StartSelfCheck checks every interval, until ctx is done, that cronic can
+// still run jobs: that it can start a trivial command, that it captures its
+// output, and that its notifiers work. Failures are logged, and sent to the
+// notifiers as failures of a job named SELF_CHECK_JOB_NAME, so that broken
+// plumbing doesn't go unnoticed just because no job failed.
+func StartSelfCheck(ctx context.Context, wg *sync.WaitGroup, cronCtx *crontab.Context, opts *Options, interval time.Duration, logger *Logger) {
+	wg.Add(1)
+
+	quiet := crontab.LevelDebug
+	job := &crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Schedule: fmt.Sprintf("every %v", interval),
+			Command:  "echo $CRONIC_SELF_CHECK",
+		},
+		Position:    -1,
+		Name:        SELF_CHECK_JOB_NAME,
+		Quiet:       true,
+		StdoutLevel: &quiet,
+		StderrLevel: &quiet,
+	}
+
+	status := NewJobStatus(job)
+	logger = JobLogger(logger, job)
+
+	// The check's output isn't worth archiving
+	checkOpts := *opts
+	checkOpts.Archive = nil
+
+	go func() {
+		defer wg.Done()
+
+		healthy := true
+
+		for iteration := uint64(0); ; iteration++ {
+			err := selfCheck(ctx, cronCtx, &checkOpts, status, iteration, logger)
+
+			switch {
+			case err != nil:
+				logger.Errorf("CRONIC: Self-check failed: %v", err)
+				healthy = false
+			case !healthy:
+				logger.Info("CRONIC: Self-check passed again")
+				healthy = true
+			default:
+				logger.Debug("CRONIC: Self-check passed")
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+		}
+	}()
+}
+
+func selfCheck(ctx context.Context, cronCtx *crontab.Context, opts *Options, status *JobStatus, iteration uint64, logger *Logger) error {
+	runID := status.startRun(iteration)
+	logger = logger.WithField("run.id", runID)
+
+	// The command must echo this back, so we know its output was captured
+	token := fmt.Sprintf("cronic-self-check-%s", runID)
+
+	status.Job.Environ = map[string]string{"CRONIC_SELF_CHECK": token}
+
+	runCtx, cancel := context.WithTimeout(ctx, SELF_CHECK_TIMEOUT)
+	err := runJob(runCtx, cronCtx, opts, status, logger)
+	cancel()
+
+	if err == nil {
+		output := status.outputTail(OUTPUT_BUFFER_SIZE)
+		if len(output) != 1 || output[0].Line != token {
+			err = fmt.Errorf("CRONIC: Output of the self-check wasn't captured (got %q)", FormatOutput(output))
+		}
+	}
+
+	if err == nil {
+		if notifyErr := CheckNotifiers(opts.Notifiers); notifyErr != nil {
+			err = fmt.Errorf("CRONIC: Notifiers are failing: %v", notifyErr)
+		}
+	}
+
+	result := status.finishRun(err, status.outputTail(opts.FailureTailLines), "")
+	if err != nil {
+		opts.notify(newResultEvent(status.Job, nil, result))
+	}
+
+	return err
+}
@@ -0,0 +1,70 @@
+package cron
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type healthNotifier struct {
+	testNotifier
+	err error
+}
+
+func (n *healthNotifier) Healthy() error {
+	return n.err
+}
+
+func TestSelfCheck(t *testing.T) {
+	type testCase struct {
+		name     string
+		shell    string
+		health   error
+		expected string
+	}
+
+	testCases := []testCase{
+		{"healthy", "/bin/sh", nil, ""},
+		{"broken shell", "/no/such/shell", nil, "^CRONIC: Failed to start command"},
+		{"lost output", "/bin/true", nil, "^CRONIC: Output of the self-check wasn't captured"},
+		{"failing notifier", "/bin/sh", errors.New("connection refused"), "^CRONIC: Notifiers are failing: connection refused"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			notifier := &healthNotifier{testNotifier{make(chan *Event, TEST_CHANNEL_BUFFER_SIZE)}, tc.health}
+			opts := &Options{Notifiers: []Notifier{notifier}}
+			cronCtx := &crontab.Context{Shell: tc.shell, Environ: map[string]string{}}
+
+			ctx, stop := context.WithCancel(context.Background())
+
+			var wg sync.WaitGroup
+
+			logger, _ := newTestLogger()
+			StartSelfCheck(ctx, &wg, cronCtx, opts, time.Hour, logger)
+
+			if tc.expected != "" {
+				failure := expectEvent(t, notifier.events, crontab.EventFailure)
+				assert.Equal(t, SELF_CHECK_JOB_NAME, failure.Name)
+				if assert.NotNil(t, failure.Result) {
+					assert.Regexp(t, tc.expected, failure.Result.Error)
+				}
+			}
+
+			select {
+			case event := <-notifier.events:
+				t.Fatalf("unexpected %s event", event.Type)
+			case <-time.After(100 * time.Millisecond):
+			}
+
+			stop()
+			wg.Wait()
+		})
+	}
+}
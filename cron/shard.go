@@ -0,0 +1,82 @@
+package cron
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/samgaw/cronic/crontab"
+)
+
+// Shard is the subset of a crontab's jobs that an instance of cronic runs,
+// when several instances share the crontab (without coordinating): each job
+// belongs to one of Count shards, picked from a hash of the job (see
+// StateKey), so that every instance agrees on it.
+type Shard struct {
+	Index int
+	Count int
+}
+
+// ParseShard parses a shard written as I/N (e.g. "0/3" for the first of 3
+// shards), or as host/N to pick the shard from a hash of the hostname. With
+// host/N, instances don't know about each other, so several of them may
+// pick the same shard (and none of them another one): prefer I/N if each
+// instance knows its own index (e.g. the ordinal of a StatefulSet's pod).
+func ParseShard(shard string) (*Shard, error) {
+	parts := strings.Split(shard, "/")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("expected I/N or host/N, got %q", shard)
+	}
+
+	count, err := strconv.Atoi(parts[1])
+	if err != nil || count < 1 {
+		return nil, fmt.Errorf("the number of shards must be a positive integer, got %q", parts[1])
+	}
+
+	if parts[0] == "host" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+
+		hash := fnv.New32a()
+		hash.Write([]byte(hostname))
+		return &Shard{Index: int(hash.Sum32() % uint32(count)), Count: count}, nil
+	}
+
+	index, err := strconv.Atoi(parts[0])
+	if err != nil || index < 0 || index >= count {
+		return nil, fmt.Errorf("the shard must be host, or an integer from 0 to %d, got %q", count-1, parts[0])
+	}
+
+	return &Shard{Index: index, Count: count}, nil
+}
+
+// Owns reports whether job belongs to the shard (all jobs belong to a nil
+// shard).
+func (s *Shard) Owns(job *crontab.Job) bool {
+	if s == nil {
+		return true
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(StateKey(job)))
+	return int(hash.Sum32()%uint32(s.Count)) == s.Index
+}
+
+// Filter removes the jobs that don't belong to the shard from tab.
+func (s *Shard) Filter(tab *crontab.Crontab) {
+	jobs := make([]*crontab.Job, 0, len(tab.Jobs))
+	for _, job := range tab.Jobs {
+		if s.Owns(job) {
+			jobs = append(jobs, job)
+		}
+	}
+	tab.Jobs = jobs
+}
+
+func (s *Shard) String() string {
+	return fmt.Sprintf("%d/%d", s.Index, s.Count)
+}
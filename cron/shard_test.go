@@ -0,0 +1,57 @@
+package cron
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseShard(t *testing.T) {
+	shard, err := ParseShard("1/3")
+	if assert.Nil(t, err) {
+		assert.Equal(t, &Shard{Index: 1, Count: 3}, shard)
+		assert.Equal(t, "1/3", shard.String())
+	}
+
+	shard, err = ParseShard("host/4")
+	if assert.Nil(t, err) {
+		assert.True(t, shard.Index >= 0 && shard.Index < 4, shard.Index)
+	}
+
+	for _, bad := range []string{"", "1", "3/3", "-1/3", "a/3", "0/0", "0/x", "1/2/3"} {
+		_, err := ParseShard(bad)
+		assert.NotNil(t, err, bad)
+	}
+}
+
+func TestShardsSplitJobs(t *testing.T) {
+	tab := &crontab.Crontab{}
+	for i := 0; i < 100; i++ {
+		tab.Jobs = append(tab.Jobs, &crontab.Job{Name: fmt.Sprintf("job-%d", i)})
+	}
+
+	owners := make(map[string]int)
+	for i := 0; i < 3; i++ {
+		shard := &Shard{Index: i, Count: 3}
+
+		sharded := &crontab.Crontab{Jobs: tab.Jobs}
+		shard.Filter(sharded)
+		assert.NotEmpty(t, sharded.Jobs)
+
+		for _, job := range sharded.Jobs {
+			owners[job.Name]++
+		}
+	}
+
+	// Each job belongs to exactly one shard
+	assert.Len(t, owners, len(tab.Jobs))
+	for name, count := range owners {
+		assert.Equal(t, 1, count, name)
+	}
+
+	var shard *Shard
+	assert.True(t, shard.Owns(tab.Jobs[0]))
+}
@@ -0,0 +1,56 @@
+package cron
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+// What to do with the runs in progress when cronic shuts down
+const (
+	// Wait for them to finish
+	ShutdownWait = "wait"
+
+	// Send SIGTERM to their processes, and wait for them to finish
+	ShutdownTerm = "term"
+
+	// Stop them right away, killing their processes without waiting for
+	// KILL_GRACE_PERIOD
+	ShutdownKill = "kill"
+)
+
+var shutdownPolicies = []string{ShutdownWait, ShutdownTerm, ShutdownKill}
+
+// ParseShutdownPolicy checks that policy is one of ShutdownWait, ShutdownTerm
+// or ShutdownKill.
+func ParseShutdownPolicy(policy string) (string, error) {
+	for _, known := range shutdownPolicies {
+		if policy == known {
+			return policy, nil
+		}
+	}
+	return "", fmt.Errorf("unknown shutdown policy %q (expected one of %s)", policy, strings.Join(shutdownPolicies, ", "))
+}
+
+// StopRunsOnShutdown applies policy to the runs in progress of the registry's
+// jobs, once cronic is shutting down: with ShutdownTerm, it sends SIGTERM to
+// their processes, and with ShutdownKill, it closes the registry's
+// Options.Kill (if set) and calls stopRuns (which cancels the context the
+// registry was started with).
+func StopRunsOnShutdown(registry *Registry, policy string, stopRuns func(), logger *Logger) {
+	switch policy {
+	case ShutdownTerm:
+		logger.Info("CRONIC: Sending SIGTERM to running jobs (-on-shutdown)")
+		for _, status := range registry.Jobs() {
+			if err := status.Signal(syscall.SIGTERM); err != nil && err != ErrNotRunning {
+				JobLogger(logger, status.Job).Warnf("CRONIC: Can't send SIGTERM to the job: %v", err)
+			}
+		}
+	case ShutdownKill:
+		logger.Info("CRONIC: Killing running jobs (-on-shutdown)")
+		if registry.opts.Kill != nil {
+			close(registry.opts.Kill)
+		}
+		stopRuns()
+	}
+}
@@ -0,0 +1,72 @@
+package cron
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseShutdownPolicy(t *testing.T) {
+	for _, tt := range []struct {
+		policy string
+		ok     bool
+	}{
+		{"wait", true},
+		{"term", true},
+		{"kill", true},
+		{"", false},
+		{"KILL", false},
+		{"stop", false},
+	} {
+		policy, err := ParseShutdownPolicy(tt.policy)
+		if tt.ok {
+			assert.Nil(t, err, tt.policy)
+			assert.Equal(t, tt.policy, policy)
+		} else {
+			assert.NotNil(t, err, tt.policy)
+		}
+	}
+}
+
+func TestStopRunsOnShutdown(t *testing.T) {
+	for _, tt := range []struct {
+		policy  string
+		command string
+	}{
+		{ShutdownTerm, "sleep 30"},
+
+		// Ignores SIGTERM, so only stops once killed (well before
+		// KILL_GRACE_PERIOD)
+		{ShutdownKill, "trap '' TERM; sleep 30"},
+	} {
+		logger, _ := newTestLogger()
+		opts := &Options{Kill: make(chan struct{})}
+		registry := NewRegistry(&basicContext, opts, logger, nil)
+
+		status := registry.Add(newTestJob(tt.command), false)
+
+		runsCtx, stopRuns := context.WithCancel(context.Background())
+		registry.StartContext(runsCtx)
+
+		assert.Nil(t, status.Trigger())
+		waitFor(t, "the job to run", func() bool {
+			return status.Snapshot().Running
+		})
+
+		// Let the shell start
+		time.Sleep(100 * time.Millisecond)
+
+		start := time.Now()
+		StopRunsOnShutdown(registry, tt.policy, stopRuns, logger)
+		registry.Shutdown()
+
+		assert.True(t, time.Since(start) < 5*time.Second, "%s took %v", tt.policy, time.Since(start))
+		if result := status.Snapshot().LastResult; assert.NotNil(t, result, tt.policy) {
+			assert.False(t, result.Success, tt.policy)
+		}
+
+		stopRuns()
+	}
+}
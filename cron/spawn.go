@@ -0,0 +1,42 @@
+package cron
+
+import (
+	"time"
+
+	"github.com/samgaw/cronic/crontab"
+)
+
+var (
+	// How many times to try starting a command again, under the
+	// crontab.SpawnFailureRetry policy, and how long to wait before the
+	// first time (doubling each time, up to SPAWN_RETRY_MAX_DELAY)
+	SPAWN_RETRIES         = 8
+	SPAWN_RETRY_DELAY     = time.Second
+	SPAWN_RETRY_MAX_DELAY = 5 * time.Minute
+)
+
+// spawnFailurePolicy returns what to do when the job's command can't be
+// started.
+func (opts *Options) spawnFailurePolicy(job *crontab.Job) string {
+	if job.OnSpawnFailure != "" {
+		return job.OnSpawnFailure
+	}
+	if opts.OnSpawnFailure != "" {
+		return opts.OnSpawnFailure
+	}
+	return crontab.SpawnFailureFail
+}
+
+// spawnRetryDelay returns how long to wait before trying to start a command
+// again, after retry tries.
+func spawnRetryDelay(retry int) time.Duration {
+	delay := SPAWN_RETRY_DELAY
+	for i := 0; i < retry && delay < SPAWN_RETRY_MAX_DELAY; i++ {
+		delay *= 2
+	}
+
+	if delay > SPAWN_RETRY_MAX_DELAY {
+		return SPAWN_RETRY_MAX_DELAY
+	}
+	return delay
+}
@@ -0,0 +1,36 @@
+package cron
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/samgaw/cronic/crontab"
+)
+
+// splayOffset returns how long to delay a run of job by (see
+// crontab.Job.Splay). Stable offsets are derived from the job (see StateKey)
+// and the host it runs on (its host annotation, or this one), so that a job
+// always runs at the same time on a given host, but at different times on
+// different hosts.
+func splayOffset(job *crontab.Job) time.Duration {
+	if job.Splay <= 0 {
+		return 0
+	}
+
+	if !job.SplayStable {
+		return time.Duration(rand.Int63n(int64(job.Splay)))
+	}
+
+	host := job.Host
+	if host == "" {
+		host, _ = os.Hostname()
+	}
+
+	hash := fnv.New64a()
+	hash.Write([]byte(host))
+	hash.Write([]byte{0})
+	hash.Write([]byte(StateKey(job)))
+	return time.Duration(hash.Sum64() % uint64(job.Splay))
+}
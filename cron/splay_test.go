@@ -0,0 +1,33 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplayOffset(t *testing.T) {
+	job := &crontab.Job{Name: "backup", Splay: 10 * time.Minute}
+
+	for i := 0; i < 100; i++ {
+		offset := splayOffset(job)
+		assert.True(t, offset >= 0 && offset < job.Splay, offset)
+	}
+
+	job.SplayStable = true
+	offset := splayOffset(job)
+	assert.True(t, offset >= 0 && offset < job.Splay, offset)
+	assert.Equal(t, offset, splayOffset(job))
+
+	// Other hosts get other offsets
+	remote := *job
+	remote.Host = "db1.internal"
+	other := remote
+	other.Host = "db2.internal"
+	assert.NotEqual(t, splayOffset(&remote), splayOffset(&other))
+
+	assert.Equal(t, time.Duration(0), splayOffset(&crontab.Job{Name: "backup"}))
+}
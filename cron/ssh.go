@@ -0,0 +1,174 @@
+package cron
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	// The OpenSSH client to run the commands of remote jobs with (see
+	// SSHExecutor)
+	SSH_BINARY = "ssh"
+
+	// How long to wait for connections to remote hosts
+	SSH_CONNECT_TIMEOUT = 10 * time.Second
+
+	// The command ssh runs on remote hosts (with the login shell of the
+	// user), which reads the length of the job's script from stdin, then
+	// the script, and runs it (see remoteScript). read and dd bs=1 don't
+	// read past what they need, so the rest of stdin is left to the job.
+	REMOTE_SHELL = `exec /bin/sh -c 'read -r length && eval "$(dd bs=1 count="$length" 2>/dev/null)"'`
+
+	// The names of the variables that shells can export
+	shellNameMatcher = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// SSHExecutor runs commands on remote hosts (see Command.Host), with
+// OpenSSH's client: each run connects to the host, runs the command there,
+// and relays its output, stdin and exit code.
+type SSHExecutor struct {
+	// The private key to authenticate with, unless the command has its own
+	// (if empty, ssh's defaults, and the keys of its agent)
+	Key string
+
+	// The known_hosts file to check the keys of hosts against (if empty,
+	// ssh's defaults)
+	KnownHostsFile string
+
+	// Additional options, as given with ssh -o (e.g. ProxyJump=bastion)
+	Options []string
+}
+
+func NewSSHExecutor(key string, knownHostsFile string) *SSHExecutor {
+	return &SSHExecutor{Key: key, KnownHostsFile: knownHostsFile}
+}
+
+func (s *SSHExecutor) Run(ctx context.Context, command *Command, stdout io.Writer, stderr io.Writer) error {
+	// ssh runs as cronic (or as the job's user, so that it uses their
+	// keys), and with cronic's environment (e.g. for SSH_AUTH_SOCK), while
+	// the command gets the job's environment on the host. Signals can't be
+	// relayed to the command, and resource limits are the host's business.
+	//
+	// The command, and its environment (which may hold secrets), are sent
+	// to a shell on the host through ssh's stdin, followed by the command's
+	// own stdin, rather than on ssh's command line (where anybody could
+	// see them with ps, on either host).
+	var stdin io.Reader = strings.NewReader(command.Stdin)
+	if command.StdinFile != "" {
+		path := command.StdinFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(command.Dir, path)
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return &StartError{err}
+		}
+		defer file.Close()
+		stdin = file
+	}
+
+	script, err := remoteScript(command)
+	if err != nil {
+		return &StartError{err}
+	}
+	script = fmt.Sprintf("%d\n%s", len(script), script)
+
+	local := &Command{
+		Argv:  append([]string{SSH_BINARY}, s.args(command)...),
+		Env:   os.Environ(),
+		Dir:   command.Dir,
+		User:  command.User,
+		Kill:  command.Kill,
+		stdin: io.MultiReader(strings.NewReader(script), stdin),
+	}
+	return LocalExecutor{}.Run(ctx, local, stdout, stderr)
+}
+
+// args returns the arguments of ssh to run command on its host.
+func (s *SSHExecutor) args(command *Command) []string {
+	args := []string{
+		// Commands have no terminal, and nobody is there to type
+		// passwords, or accept the keys of unknown hosts
+		"-T",
+		"-o", "BatchMode=yes",
+		"-o", fmt.Sprintf("ConnectTimeout=%d", int(SSH_CONNECT_TIMEOUT/time.Second)),
+	}
+
+	key := s.Key
+	if command.SSHKey != "" {
+		key = command.SSHKey
+		if !filepath.IsAbs(key) {
+			key = filepath.Join(command.Dir, key)
+		}
+	}
+	if key != "" {
+		args = append(args, "-i", key, "-o", "IdentitiesOnly=yes")
+	}
+
+	if s.KnownHostsFile != "" {
+		args = append(args, "-o", "UserKnownHostsFile="+s.KnownHostsFile)
+	}
+	for _, option := range s.Options {
+		args = append(args, "-o", option)
+	}
+
+	destination, port := splitSSHHost(command.Host)
+	if port != "" {
+		args = append(args, "-p", port)
+	}
+
+	return append(args, "--", destination, REMOTE_SHELL)
+}
+
+// splitSSHHost splits a [USER@]HOST[:PORT] host into ssh's destination
+// ([USER@]HOST) and port (empty if it has none).
+func splitSSHHost(host string) (string, string) {
+	user := ""
+	if i := strings.LastIndex(host, "@"); i != -1 {
+		user, host = host[:i+1], host[i+1:]
+	}
+
+	if name, port, err := net.SplitHostPort(host); err == nil {
+		return user + name, port
+	}
+	return user + host, ""
+}
+
+// remoteScript returns the shell script that runs command, with its
+// environment, on its host (where REMOTE_SHELL reads it from stdin). The
+// environment is set with export, a builtin, so that its values aren't on
+// the command line of any process there either.
+func remoteScript(command *Command) (string, error) {
+	var b strings.Builder
+	for _, kv := range command.Env {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || !shellNameMatcher.MatchString(parts[0]) {
+			return "", fmt.Errorf("environment variable %q can't be set on remote hosts", parts[0])
+		}
+		b.WriteString("export " + parts[0] + "=" + shellQuote(parts[1]) + "\n")
+	}
+
+	b.WriteString("exec")
+	if len(command.Argv) > 0 {
+		for _, arg := range command.Argv {
+			b.WriteString(" " + shellQuote(arg))
+		}
+	} else {
+		b.WriteString(" " + shellQuote(command.Shell) + " -c " + shellQuote(command.Command))
+	}
+
+	return b.String(), nil
+}
+
+// shellQuote quotes s for POSIX shells.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
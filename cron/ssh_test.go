@@ -0,0 +1,147 @@
+package cron
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSSH is an ssh that records its arguments in args, and runs the remote
+// command locally.
+const fakeSSH = `#!/bin/sh
+printf '%s\n' "$@" > "$(dirname "$0")/args"
+for arg; do command=$arg; done
+exec /bin/sh -c "$command"
+`
+
+func newTestSSHExecutor(t *testing.T) (*SSHExecutor, string, func()) {
+	dir, err := ioutil.TempDir("", "cronic-ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "ssh"), []byte(fakeSSH), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	binary := SSH_BINARY
+	SSH_BINARY = filepath.Join(dir, "ssh")
+
+	return NewSSHExecutor("/keys/cronic", ""), dir, func() {
+		SSH_BINARY = binary
+		os.RemoveAll(dir)
+	}
+}
+
+func TestSSHExecutorRunsCommandsOnHosts(t *testing.T) {
+	executor, dir, stop := newTestSSHExecutor(t)
+	defer stop()
+
+	command := &Command{
+		Shell:   "/bin/sh",
+		Command: `echo "$GREETING"; read line; echo "$line" >&2`,
+		Env:     []string{"GREETING=it's me"},
+		Stdin:   "hello\n",
+		Dir:     dir,
+		Host:    "backup@db1:2222",
+		SSHKey:  "keys/id_ed25519",
+	}
+
+	var stdout, stderr bytes.Buffer
+	assert.Nil(t, executor.Run(context.Background(), command, &stdout, &stderr))
+	assert.Equal(t, "it's me\n", stdout.String())
+	assert.Equal(t, "hello\n", stderr.String())
+
+	args, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+	if assert.Nil(t, err) {
+		assert.Equal(t, []string{
+			"-T", "-o", "BatchMode=yes", "-o", "ConnectTimeout=10",
+			"-i", filepath.Join(dir, "keys/id_ed25519"), "-o", "IdentitiesOnly=yes",
+			"-p", "2222",
+			"--", "backup@db1", REMOTE_SHELL,
+		}, strings.Split(strings.TrimSuffix(string(args), "\n"), "\n"))
+	}
+}
+
+func TestSSHExecutorKeepsEnvironmentOffCommandLine(t *testing.T) {
+	executor, dir, stop := newTestSSHExecutor(t)
+	defer stop()
+
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "input"), []byte("from a file\n"), 0644))
+
+	command := &Command{
+		Argv:      []string{"sh", "-c", `echo "$DB_PASSWORD"; cat`},
+		Env:       []string{"DB_PASSWORD=hunter2", "TRACEPARENT=00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		Dir:       dir,
+		StdinFile: "input",
+		Host:      "db1",
+	}
+
+	var stdout bytes.Buffer
+	assert.Nil(t, executor.Run(context.Background(), command, &stdout, &bytes.Buffer{}))
+	assert.Equal(t, "hunter2\nfrom a file\n", stdout.String())
+
+	args, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+	if assert.Nil(t, err) {
+		for _, kv := range command.Env {
+			assert.NotContains(t, string(args), kv)
+		}
+		assert.NotContains(t, string(args), "hunter2")
+	}
+}
+
+func TestRemoteScriptKeepsEnvironmentOffCommandLines(t *testing.T) {
+	script, err := remoteScript(&Command{
+		Argv: []string{"pg_dump", "--no-password"},
+		Env:  []string{"PGPASSWORD=it's hunter2", "EMPTY="},
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	// Only the export builtin sees the values: nothing is exec'd with them
+	lines := strings.Split(script, "\n")
+	assert.Equal(t, []string{
+		`export PGPASSWORD='it'\''s hunter2'`,
+		`export EMPTY=''`,
+		`exec 'pg_dump' '--no-password'`,
+	}, lines)
+
+	_, err = remoteScript(&Command{Argv: []string{"true"}, Env: []string{"NOT-A-NAME=x"}})
+	assert.NotNil(t, err)
+}
+
+func TestSSHExecutorReportsExitCodes(t *testing.T) {
+	executor, _, stop := newTestSSHExecutor(t)
+	defer stop()
+
+	err := executor.Run(context.Background(), &Command{Argv: []string{"sh", "-c", "exit 3"}, Host: "db1"}, &bytes.Buffer{}, &bytes.Buffer{})
+	if assert.IsType(t, &exec.ExitError{}, err) {
+		assert.Equal(t, 3, err.(*exec.ExitError).ExitCode())
+	}
+}
+
+func TestSplitSSHHost(t *testing.T) {
+	for _, testCase := range []struct {
+		host        string
+		destination string
+		port        string
+	}{
+		{"db1", "db1", ""},
+		{"backup@db1", "backup@db1", ""},
+		{"backup@db1:2222", "backup@db1", "2222"},
+		{"[2001:db8::1]:2222", "2001:db8::1", "2222"},
+		{"2001:db8::1", "2001:db8::1", ""},
+	} {
+		destination, port := splitSSHHost(testCase.host)
+		assert.Equal(t, testCase.destination, destination, testCase.host)
+		assert.Equal(t, testCase.port, port, testCase.host)
+	}
+}
@@ -0,0 +1,61 @@
+package cron
+
+import (
+	"github.com/samgaw/cronic/crontab"
+)
+
+// StateStore persists the results of runs, so that they survive restarts,
+// and can be shared by several cronic processes (see the state package).
+// Jobs are identified by StateKey. Since stores may be remote, their methods
+// can block: they're called from the job's goroutine, between runs.
+type StateStore interface {
+	// Record saves the result of a run of the job.
+	Record(key string, result *RunResult) error
+
+	// Last returns the result of the last run of the job, or nil if it
+	// never ran.
+	Last(key string) (*RunResult, error)
+
+	// History returns the results of up to limit of the last runs of the
+	// job, most recent first.
+	History(key string, limit int) ([]*RunResult, error)
+
+	Close() error
+}
+
+// StateKey identifies a job in a StateStore: by its name, or by its
+// schedule and command (since positions change when the crontab does).
+func StateKey(job *crontab.Job) string {
+	if job.Name != "" {
+		return job.Name
+	}
+	return job.Schedule + " " + job.Command
+}
+
+// restoreState loads the last result of the job from the state store (if
+// any), unless it already ran.
+func restoreState(opts *Options, status *JobStatus, logger *Logger) {
+	if opts.State == nil {
+		return
+	}
+
+	result, err := opts.State.Last(StateKey(status.Job))
+	if err != nil {
+		logger.Errorf("CRONIC: Failed to load the job's last result: %v", err)
+		return
+	}
+
+	if result != nil {
+		status.restoreLastResult(result)
+	}
+}
+
+func recordState(opts *Options, job *crontab.Job, result *RunResult, logger *Logger) {
+	if opts.State == nil {
+		return
+	}
+
+	if err := opts.State.Record(StateKey(job), result); err != nil {
+		logger.Errorf("CRONIC: Failed to record the run's result: %v", err)
+	}
+}
@@ -0,0 +1,157 @@
+package cron
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testStateStore struct {
+	mu   sync.Mutex
+	runs map[string][]*RunResult
+}
+
+func (s *testStateStore) Record(key string, result *RunResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.runs[key] = append([]*RunResult{result}, s.runs[key]...)
+	return nil
+}
+
+func (s *testStateStore) Last(key string) (*RunResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.runs[key]) == 0 {
+		return nil, nil
+	}
+	return s.runs[key][0], nil
+}
+
+func (s *testStateStore) History(key string, limit int) ([]*RunResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.runs[key], nil
+}
+
+func (s *testStateStore) Close() error {
+	return nil
+}
+
+func TestStateKey(t *testing.T) {
+	job := &crontab.Job{CrontabLine: crontab.CrontabLine{Schedule: "@hourly", Command: "echo hi"}}
+	assert.Equal(t, "@hourly echo hi", StateKey(job))
+
+	job.Name = "greeting"
+	assert.Equal(t, "greeting", StateKey(job))
+}
+
+func TestStartJobRecordsAndRestoresState(t *testing.T) {
+	job := crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: &testExpression{time.Hour},
+			Schedule:   "always!",
+			Command:    "exit 3",
+		},
+	}
+
+	previous := &RunResult{RunID: "previous", ConsecutiveFailures: 2}
+	store := &testStateStore{runs: map[string][]*RunResult{StateKey(&job): {previous}}}
+
+	notifier := &testNotifier{make(chan *Event, TEST_CHANNEL_BUFFER_SIZE)}
+	opts := &Options{Notifiers: []Notifier{notifier}, State: store}
+
+	ctx, stop := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+
+	logger, _ := newTestLogger()
+	status := NewJobStatus(&job)
+
+	StartJob(ctx, &wg, &basicContext, opts, status, logger)
+
+	// The last result is the one from before the restart, until the job
+	// runs again
+	waitFor(t, "the last result", func() bool { return status.Snapshot().LastResult != nil })
+	assert.Equal(t, "previous", status.Snapshot().LastResult.RunID)
+
+	assert.Nil(t, status.Trigger())
+	expectEvent(t, notifier.events, crontab.EventStart)
+	failure := expectEvent(t, notifier.events, crontab.EventFailure)
+
+	last, _ := store.Last(StateKey(&job))
+	if assert.NotNil(t, last) {
+		assert.Equal(t, failure.RunID, last.RunID)
+		assert.False(t, last.Success)
+
+		// Failures are counted from before the restart
+		assert.Equal(t, 3, last.ConsecutiveFailures)
+	}
+
+	stop()
+	wg.Wait()
+}
+
+func TestStartJobRecordsArchivedOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cronic-archive")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	archive, err := NewArchive(dir)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	job := crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: &testExpression{time.Hour},
+			Schedule:   "always!",
+			Command:    "echo hello",
+		},
+	}
+
+	store := &testStateStore{runs: map[string][]*RunResult{}}
+	notifier := &testNotifier{make(chan *Event, TEST_CHANNEL_BUFFER_SIZE)}
+	opts := &Options{Notifiers: []Notifier{notifier}, State: store, Archive: archive}
+
+	ctx, stop := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+
+	logger, _ := newTestLogger()
+	status := NewJobStatus(&job)
+
+	StartJob(ctx, &wg, &basicContext, opts, status, logger)
+
+	assert.Nil(t, status.Trigger())
+	expectEvent(t, notifier.events, crontab.EventStart)
+	success := expectEvent(t, notifier.events, crontab.EventSuccess)
+
+	last, _ := store.Last(StateKey(&job))
+	if assert.NotNil(t, last) {
+		assert.Equal(t, filepath.Join(dir, success.RunID+".log"), last.OutputFile)
+	}
+
+	stop()
+	wg.Wait()
+}
+
+func TestJobStatusCountsConsecutiveFailures(t *testing.T) {
+	status := NewJobStatus(&crontab.Job{})
+
+	for i, err := range []error{errors.New("failed"), errors.New("failed"), nil, errors.New("failed")} {
+		status.startRun(uint64(i))
+		result := status.finishRun(err, nil, "")
+		assert.Equal(t, []int{1, 2, 0, 1}[i], result.ConsecutiveFailures)
+	}
+}
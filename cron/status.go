@@ -0,0 +1,610 @@
+package cron
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/samgaw/cronic/crontab"
+)
+
+var (
+	OUTPUT_BUFFER_SIZE = 100
+
+	ErrJobRunning = errors.New("CRONIC: Job is already running")
+	ErrRunPending = errors.New("CRONIC: Job run is already pending")
+	ErrNotRunning = errors.New("CRONIC: Job is not running")
+	ErrDraining   = errors.New("CRONIC: Jobs are draining, no new runs can start")
+
+	ErrSignalsPending = errors.New("CRONIC: Job has too many signals pending")
+
+	// How many signals can be waiting to be sent to a run (see Signal)
+	SIGNAL_BUFFER_SIZE = 8
+)
+
+type OutputLine struct {
+	Time      time.Time `json:"time"`
+	Iteration uint64    `json:"iteration"`
+	Channel   string    `json:"channel"`
+	Line      string    `json:"line"`
+}
+
+type RunResult struct {
+	RunID      string    `json:"run_id"`
+	TraceID    string    `json:"trace_id"`
+	SpanID     string    `json:"span_id"`
+	Iteration  uint64    `json:"iteration"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Success    bool      `json:"success"`
+	TimedOut   bool      `json:"timed_out"`
+	Error      string    `json:"error,omitempty"`
+
+	// The exit code of the command, if it ran (-1 if it was killed by a
+	// signal)
+	ExitCode *int `json:"exit_code,omitempty"`
+
+	// How many lines of output the run emitted, and the file holding it, if
+	// it was archived (see Archive)
+	OutputLines int    `json:"output_lines"`
+	OutputFile  string `json:"output_file,omitempty"`
+
+	// How many runs of the job in a row failed, up to this one (0 if it
+	// succeeded)
+	ConsecutiveFailures int `json:"consecutive_failures"`
+
+	// When the run was due (when it was triggered, for manual runs), and
+	// how late it started (unset for retries)
+	ScheduledAt *time.Time `json:"scheduled_at,omitempty"`
+	LagSeconds  float64    `json:"lag_seconds,omitempty"`
+
+	// How many times the scheduled run was retried before this one, and
+	// whether it will be retried again (see the job's RetryPolicy)
+	Retry     int  `json:"retry"`
+	WillRetry bool `json:"will_retry"`
+
+	// Whether the job was paused after the run (e.g. by its
+	// pause-after-failures circuit breaker), and until when (if it resumes
+	// by itself)
+	Paused      bool       `json:"paused,omitempty"`
+	PausedUntil *time.Time `json:"paused_until,omitempty"`
+
+	// When the run fails, the last lines of its output, and the output of
+	// the job's debug command (if any)
+	OutputTail  []OutputLine `json:"output_tail,omitempty"`
+	DebugOutput string       `json:"debug_output,omitempty"`
+}
+
+// JobSnapshot is a point-in-time copy of a JobStatus, safe to serialize.
+type JobSnapshot struct {
+	Name         string            `json:"name,omitempty"`
+	Position     int               `json:"position"`
+	Schedule     string            `json:"schedule"`
+	Command      string            `json:"command"`
+	User         string            `json:"user,omitempty"`
+	File         string            `json:"file,omitempty"`
+	Line         int               `json:"line,omitempty"`
+	Namespace    string            `json:"namespace,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	Managed      bool              `json:"managed"`
+	NextRun      *time.Time        `json:"next_run,omitempty"`
+	Running      bool              `json:"running"`
+	RunningSince *time.Time        `json:"running_since,omitempty"`
+	Paused       bool              `json:"paused"`
+	AllPaused    bool              `json:"all_paused,omitempty"`
+	PausedSince  *time.Time        `json:"paused_since,omitempty"`
+	PausedUntil  *time.Time        `json:"paused_until,omitempty"`
+	Draining     bool              `json:"draining,omitempty"`
+	LastResult   *RunResult        `json:"last_result,omitempty"`
+}
+
+// JobStatus tracks the runtime state of a job, and lets other components
+// (e.g. the web dashboard) observe and control it while it is scheduled.
+type JobStatus struct {
+	Job *crontab.Job
+
+	// Whether the job can be changed at runtime (see Registry)
+	managed bool
+
+	mu          sync.Mutex
+	nextRun     time.Time
+	nextTick    time.Time
+	running     bool
+	iteration   uint64
+	runID       string
+	traceID     string
+	spanID      string
+	startedAt   time.Time
+	outputLines int
+	paused      bool
+	pausedSince time.Time
+	pausedUntil time.Time
+	draining    bool
+	lastResult  *RunResult
+	failures    int
+	output      []OutputLine
+	subscribers map[chan OutputLine]struct{}
+
+	// Cancels the current run (nil if there is none)
+	cancel context.CancelFunc
+
+	// Sends signals to the processes of the current run (nil if there is
+	// none)
+	signals chan syscall.Signal
+
+	// Looks up the jobs this one runs after (set by the Registry)
+	dependency func(name string) *JobStatus
+
+	// Whether all jobs are paused, besides this one (set by the Registry,
+	// see Registry.Pause)
+	allPaused *globalPause
+
+	// The context runs derive from, whose cancellation stops them (set by
+	// the Registry, see Registry.StartContext)
+	runParent context.Context
+
+	// Whether a manual run was requested, and hasn't started yet, and what
+	// to call when one is (set by StartJob)
+	triggered bool
+	onTrigger func()
+}
+
+func NewJobStatus(job *crontab.Job) *JobStatus {
+	return &JobStatus{
+		Job:         job,
+		subscribers: make(map[chan OutputLine]struct{}),
+	}
+}
+
+func (s *JobStatus) Snapshot() JobSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.resumeIfDue()
+
+	snapshot := JobSnapshot{
+		Name:        s.Job.Name,
+		Position:    s.Job.Position,
+		Schedule:    s.Job.Schedule,
+		Command:     s.Job.Command,
+		User:        s.Job.User,
+		File:        s.Job.File,
+		Line:        s.Job.Line,
+		Namespace:   s.Job.Namespace,
+		Annotations: s.Job.Annotations,
+		Managed:     s.managed,
+		Running:     s.running,
+		Paused:      s.paused,
+		AllPaused:   s.allPaused.get(),
+		Draining:    s.draining,
+	}
+
+	if !s.nextRun.IsZero() {
+		nextRun := s.nextRun
+		snapshot.NextRun = &nextRun
+	}
+
+	if s.running {
+		startedAt := s.startedAt
+		snapshot.RunningSince = &startedAt
+	}
+
+	if s.paused {
+		pausedSince := s.pausedSince
+		snapshot.PausedSince = &pausedSince
+
+		if !s.pausedUntil.IsZero() {
+			pausedUntil := s.pausedUntil
+			snapshot.PausedUntil = &pausedUntil
+		}
+	}
+
+	if s.lastResult != nil {
+		lastResult := *s.lastResult
+		snapshot.LastResult = &lastResult
+	}
+
+	return snapshot
+}
+
+// Trigger requests an immediate run of the job. Like scheduled runs, manual
+// runs never overlap: if the job is running, or a run was already requested
+// and hasn't started yet, this returns an error.
+func (s *JobStatus) Trigger() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.draining {
+		return ErrDraining
+	}
+
+	if s.running {
+		return ErrJobRunning
+	}
+
+	if s.triggered {
+		return ErrRunPending
+	}
+
+	s.triggered = true
+	if s.onTrigger != nil {
+		s.onTrigger()
+	}
+	return nil
+}
+
+// takeTrigger returns whether a manual run was requested, which then no
+// longer is.
+func (s *JobStatus) takeTrigger() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	triggered := s.triggered
+	s.triggered = false
+	return triggered
+}
+
+func (s *JobStatus) setOnTrigger(onTrigger func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onTrigger = onTrigger
+}
+
+// Cancel stops the current run, which then fails (and isn't retried).
+func (s *JobStatus) Cancel() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancel == nil {
+		return ErrNotRunning
+	}
+
+	s.cancel()
+	return nil
+}
+
+// Signal sends sig to the processes of the current run (e.g. so a long job
+// reopens its logs).
+func (s *JobStatus) Signal(sig syscall.Signal) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.signals == nil {
+		return ErrNotRunning
+	}
+
+	select {
+	case s.signals <- sig:
+		return nil
+	default:
+		return ErrSignalsPending
+	}
+}
+
+// runSignals returns the channel of signals for the current run, which
+// Signal sends to until the returned function is called.
+func (s *JobStatus) runSignals() (chan syscall.Signal, func()) {
+	signals := make(chan syscall.Signal, SIGNAL_BUFFER_SIZE)
+
+	s.mu.Lock()
+	s.signals = signals
+	s.mu.Unlock()
+
+	return signals, func() {
+		s.mu.Lock()
+		s.signals = nil
+		s.mu.Unlock()
+	}
+}
+
+// Pause stops scheduled runs of the job until Resume is called (manual runs
+// are still allowed).
+func (s *JobStatus) Pause() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.paused {
+		s.paused = true
+		s.pausedSince = time.Now()
+	}
+	s.pausedUntil = time.Time{}
+}
+
+// pauseUntil pauses the job like Pause, but resumes it automatically at
+// until (e.g. once a circuit breaker's cool-down is over), unless it's zero.
+func (s *JobStatus) pauseUntil(until time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.paused {
+		s.paused = true
+		s.pausedSince = time.Now()
+	}
+	s.pausedUntil = until
+}
+
+func (s *JobStatus) Resume() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = false
+	s.pausedUntil = time.Time{}
+}
+
+func (s *JobStatus) Paused() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.resumeIfDue()
+	return s.paused
+}
+
+// skipsRuns reports whether scheduled runs of the job are skipped, because
+// it's paused, or all jobs are.
+func (s *JobStatus) skipsRuns() bool {
+	return s.Paused() || s.allPaused.get()
+}
+
+// resumeIfDue resumes the job if it was paused for a while, and the while is
+// over. s.mu must be held.
+func (s *JobStatus) resumeIfDue() {
+	if s.paused && !s.pausedUntil.IsZero() && !time.Now().Before(s.pausedUntil) {
+		s.paused = false
+		s.pausedUntil = time.Time{}
+	}
+}
+
+// carryOver takes on the state of previous, the status of the job this one
+// replaces, that outlives the job's definition: whether (and until when) it's
+// paused, and its last result and failure streak. It can be called again once
+// previous is done running, but never unpauses the job.
+func (s *JobStatus) carryOver(previous *JobStatus) {
+	previous.mu.Lock()
+	previous.resumeIfDue()
+	paused, pausedSince, pausedUntil := previous.paused, previous.pausedSince, previous.pausedUntil
+	lastResult, failures := previous.lastResult, previous.failures
+	previous.mu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if paused && !s.paused {
+		s.paused, s.pausedSince, s.pausedUntil = true, pausedSince, pausedUntil
+	}
+	if lastResult != nil {
+		s.lastResult, s.failures = lastResult, failures
+	}
+}
+
+// Drain stops all new runs of the job, for good (e.g. because the machine is
+// going away): the current run, if any, is left to finish, but isn't
+// retried.
+func (s *JobStatus) Drain() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.draining = true
+}
+
+func (s *JobStatus) Draining() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.draining
+}
+
+// Output returns the most recent lines of output emitted by the job.
+func (s *JobStatus) Output() []OutputLine {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	output := make([]OutputLine, len(s.output))
+	copy(output, s.output)
+	return output
+}
+
+// Subscribe returns a channel receiving the job's output as it is emitted.
+// Lines are dropped if the subscriber falls behind. Call Unsubscribe once
+// done.
+func (s *JobStatus) Subscribe() chan OutputLine {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	channel := make(chan OutputLine, OUTPUT_BUFFER_SIZE)
+	s.subscribers[channel] = struct{}{}
+	return channel
+}
+
+func (s *JobStatus) Unsubscribe(channel chan OutputLine) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subscribers, channel)
+}
+
+func (s *JobStatus) setNextRun(nextRun time.Time) {
+	s.setNextTick(nextRun, nextRun)
+}
+
+// setNextTick records the job's next run, and the time it's scheduled for
+// before its splay offset (which jobs that run after it wait for it at).
+func (s *JobStatus) setNextTick(tick time.Time, nextRun time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextRun = nextRun
+	s.nextTick = tick
+}
+
+// startRun records the start of a run, and returns its ID.
+func (s *JobStatus) startRun(iteration uint64) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running = true
+	s.iteration = iteration
+	s.startedAt = time.Now()
+	s.outputLines = 0
+	s.runID = newRunID(s.Job.Position, iteration, s.startedAt)
+	s.traceID = randomHex(16)
+	s.spanID = randomHex(8)
+	return s.runID
+}
+
+// runContext returns the context of a run, which is done when timeout (the
+// job's, see Options) expires, when the run is cancelled, or when the
+// context of the Registry is.
+func (s *JobStatus) runContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	parent := s.runParent
+	if parent == nil {
+		parent = context.Background()
+	}
+
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(parent, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(parent)
+	}
+
+	s.mu.Lock()
+	s.cancel = cancel
+	s.mu.Unlock()
+
+	return ctx, func() {
+		s.mu.Lock()
+		s.cancel = nil
+		s.mu.Unlock()
+
+		cancel()
+	}
+}
+
+// traceParent returns the W3C trace context of the current run.
+func (s *JobStatus) traceParent() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fmt.Sprintf("00-%s-%s-01", s.traceID, s.spanID)
+}
+
+func (s *JobStatus) currentRunID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.runID
+}
+
+// finishRun records the result of the current run, and returns a copy of it.
+func (s *JobStatus) finishRun(err error, outputTail []OutputLine, debugOutput string) *RunResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := &RunResult{
+		RunID:       s.runID,
+		TraceID:     s.traceID,
+		SpanID:      s.spanID,
+		Iteration:   s.iteration,
+		StartedAt:   s.startedAt,
+		FinishedAt:  time.Now(),
+		Success:     err == nil,
+		OutputLines: s.outputLines,
+		OutputTail:  outputTail,
+		DebugOutput: debugOutput,
+	}
+
+	if err == nil {
+		s.failures = 0
+	} else {
+		s.failures++
+	}
+	result.ConsecutiveFailures = s.failures
+
+	if err == nil {
+		success := 0
+		result.ExitCode = &success
+	} else {
+		result.Error = err.Error()
+		result.TimedOut = timedOut(err)
+
+		if code, ok := exitCode(err); ok {
+			result.ExitCode = &code
+		}
+	}
+
+	s.running = false
+	s.lastResult = result
+
+	resultCopy := *result
+	return &resultCopy
+}
+
+// restoreLastResult sets the last result of a job that hasn't run yet, e.g.
+// to the one it had before cronic restarted (along with how many runs in a
+// row had failed).
+func (s *JobStatus) restoreLastResult(result *RunResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.lastResult == nil {
+		s.lastResult = result
+		s.failures = result.ConsecutiveFailures
+	}
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		// This never happens on the platforms we support
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// outputTail returns up to n of the last lines of output emitted by the
+// current run (but no more than OUTPUT_BUFFER_SIZE).
+func (s *JobStatus) outputTail(n int) []OutputLine {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	start := len(s.output)
+	for start > 0 && len(s.output)-start < n && s.output[start-1].Iteration == s.iteration {
+		start--
+	}
+
+	if start == len(s.output) {
+		return nil
+	}
+
+	tail := make([]OutputLine, len(s.output)-start)
+	copy(tail, s.output[start:])
+	return tail
+}
+
+func (s *JobStatus) recordOutput(channel string, line string) OutputLine {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := OutputLine{
+		Time:      time.Now(),
+		Iteration: s.iteration,
+		Channel:   channel,
+		Line:      line,
+	}
+
+	s.output = append(s.output, entry)
+	s.outputLines++
+	if len(s.output) > OUTPUT_BUFFER_SIZE {
+		s.output = s.output[len(s.output)-OUTPUT_BUFFER_SIZE:]
+	}
+
+	for subscriber := range s.subscribers {
+		select {
+		case subscriber <- entry:
+		default:
+		}
+	}
+
+	return entry
+}
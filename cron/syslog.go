@@ -0,0 +1,166 @@
+package cron
+
+import (
+	"fmt"
+	"log/syslog"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/samgaw/cronic/crontab"
+)
+
+var (
+	syslogFacilities = map[string]syslog.Priority{
+		"kern":     syslog.LOG_KERN,
+		"user":     syslog.LOG_USER,
+		"mail":     syslog.LOG_MAIL,
+		"daemon":   syslog.LOG_DAEMON,
+		"auth":     syslog.LOG_AUTH,
+		"syslog":   syslog.LOG_SYSLOG,
+		"lpr":      syslog.LOG_LPR,
+		"news":     syslog.LOG_NEWS,
+		"uucp":     syslog.LOG_UUCP,
+		"cron":     syslog.LOG_CRON,
+		"authpriv": syslog.LOG_AUTHPRIV,
+		"ftp":      syslog.LOG_FTP,
+		"local0":   syslog.LOG_LOCAL0,
+		"local1":   syslog.LOG_LOCAL1,
+		"local2":   syslog.LOG_LOCAL2,
+		"local3":   syslog.LOG_LOCAL3,
+		"local4":   syslog.LOG_LOCAL4,
+		"local5":   syslog.LOG_LOCAL5,
+		"local6":   syslog.LOG_LOCAL6,
+		"local7":   syslog.LOG_LOCAL7,
+	}
+)
+
+// Syslog sends the messages of jobs (their output, and what happens to
+// their runs) to a syslog server, in addition to logging them. Jobs can
+// override the facility and tag of their messages (see
+// crontab.Job.SyslogFacility).
+type Syslog struct {
+	network string
+	addr    string
+
+	facility string
+	tag      string
+
+	// One connection per facility and tag, since syslog.Writer only has one
+	mu      sync.Mutex
+	writers map[string]*syslog.Writer
+}
+
+// NewSyslog connects to a syslog server: endpoint is "local" for the local
+// server (e.g. /dev/log), or a URL such as udp://host:514, tcp://host:514 or
+// unix:///dev/log.
+func NewSyslog(endpoint string, facility string, tag string) (*Syslog, error) {
+	s := &Syslog{facility: facility, tag: tag, writers: make(map[string]*syslog.Writer)}
+
+	if endpoint != "local" {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("CRONIC: Bad syslog endpoint: %s (%v)", endpoint, err)
+		}
+
+		switch u.Scheme {
+		case "udp", "tcp":
+			if u.Host == "" {
+				return nil, fmt.Errorf("CRONIC: Bad syslog endpoint: %s (missing host)", endpoint)
+			}
+			s.network, s.addr = u.Scheme, u.Host
+			if u.Port() == "" {
+				s.addr += ":514"
+			}
+		case "unix", "unixgram":
+			if u.Path == "" {
+				return nil, fmt.Errorf("CRONIC: Bad syslog endpoint: %s (missing path)", endpoint)
+			}
+			s.network, s.addr = u.Scheme, u.Path
+		default:
+			return nil, fmt.Errorf("CRONIC: Bad syslog endpoint: %s (expected local, or a udp, tcp or unix URL)", endpoint)
+		}
+	}
+
+	if _, ok := syslogFacilities[facility]; !ok {
+		return nil, fmt.Errorf("CRONIC: Bad syslog facility: %q (expected one of %s)", facility, strings.Join(crontab.SyslogFacilities, ", "))
+	}
+
+	// Connect with the default facility and tag, to report errors now
+	if _, err := s.writer(facility, tag); err != nil {
+		return nil, fmt.Errorf("CRONIC: Failed to connect to syslog at %s: %v", endpoint, err)
+	}
+
+	return s, nil
+}
+
+// Logger returns a logger that logs like logger, and also sends the job's
+// messages to syslog.
+func (s *Syslog) Logger(logger *Logger, job *crontab.Job) *Logger {
+	facility, tag := s.facility, s.tag
+	if job.SyslogFacility != "" {
+		facility = job.SyslogFacility
+	}
+	if job.SyslogTag != "" {
+		tag = job.SyslogTag
+	}
+
+	return withHook(logger, logger.handler, &syslogHook{syslog: s, facility: facility, tag: tag})
+}
+
+// Close closes the connections to the syslog server.
+func (s *Syslog) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, writer := range s.writers {
+		writer.Close()
+		delete(s.writers, key)
+	}
+}
+
+func (s *Syslog) writer(facility string, tag string) (*syslog.Writer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := facility + " " + tag
+	if writer, ok := s.writers[key]; ok {
+		return writer, nil
+	}
+
+	writer, err := syslog.Dial(s.network, s.addr, syslogFacilities[facility]|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	s.writers[key] = writer
+	return writer, nil
+}
+
+// syslogHook sends the entries of a job's logger to syslog, with the
+// severity of their level.
+type syslogHook struct {
+	syslog   *Syslog
+	facility string
+	tag      string
+}
+
+func (h *syslogHook) Fire(entry *Entry) error {
+	writer, err := h.syslog.writer(h.facility, h.tag)
+	if err != nil {
+		return err
+	}
+
+	line := formatText(entry)
+
+	switch entry.Level {
+	case crontab.LevelError:
+		return writer.Err(line)
+	case crontab.LevelWarn:
+		return writer.Warning(line)
+	case crontab.LevelInfo:
+		return writer.Info(line)
+	default:
+		return writer.Debug(line)
+	}
+}
@@ -0,0 +1,68 @@
+package cron
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyslogSendsJobMessages(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer server.Close()
+
+	s, err := NewSyslog("udp://"+server.LocalAddr().String(), "cron", "cronic")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer s.Close()
+
+	receive := func() string {
+		server.SetReadDeadline(time.Now().Add(time.Second))
+		buffer := make([]byte, 65536)
+		n, _, err := server.ReadFrom(buffer)
+		assert.Nil(t, err)
+		return string(buffer[:n])
+	}
+
+	job := &crontab.Job{CrontabLine: crontab.CrontabLine{Command: "backup"}}
+
+	logger, channel := newTestLogger()
+	jobLogger := s.Logger(JobLogger(logger, job), job)
+
+	// cron.warning is 9*8+4
+	jobLogger.Warn("CRONIC: Job is still running")
+	message := receive()
+	assert.True(t, strings.HasPrefix(message, "<76>"), message)
+	assert.Contains(t, message, " cronic[")
+	assert.Contains(t, message, `msg="CRONIC: Job is still running" job.command=backup`)
+
+	// The entries are still logged
+	expectMessages(t, channel, "Job is still running")
+
+	// local3.info is 19*8+6
+	job.SyslogFacility = "local3"
+	job.SyslogTag = "backups"
+	s.Logger(JobLogger(logger, job), job).WithField("channel", "stdout").Info("done")
+	message = receive()
+	assert.True(t, strings.HasPrefix(message, "<158>"), message)
+	assert.Contains(t, message, " backups[")
+	assert.Contains(t, message, "msg=done channel=stdout")
+}
+
+func TestNewSyslogRejectsBadSettings(t *testing.T) {
+	for _, endpoint := range []string{"udp://", "http://logs:514", "unix://", "logs:514"} {
+		_, err := NewSyslog(endpoint, "cron", "cronic")
+		assert.NotNil(t, err, endpoint)
+	}
+
+	_, err := NewSyslog("udp://127.0.0.1:514", "local8", "cronic")
+	assert.NotNil(t, err)
+}
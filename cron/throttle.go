@@ -0,0 +1,195 @@
+package cron
+
+import (
+	"sync"
+	"time"
+
+	"github.com/samgaw/cronic/crontab"
+)
+
+// outputRateLimit returns how many lines of output per second to relay from
+// the job (0 for no limit).
+func (opts *Options) outputRateLimit(job *crontab.Job) int {
+	if job.OutputRateLimit > 0 {
+		return job.OutputRateLimit
+	}
+	return opts.OutputRateLimit
+}
+
+// lineThrottle limits how fast the output of a run is read, so that a job
+// emitting enormous amounts of output can't keep cronic busy relaying it
+// (the job just blocks writing to its pipes instead). It allows bursts of up
+// to a second's worth of lines.
+type lineThrottle struct {
+	interval  time.Duration
+	tolerance time.Duration
+
+	// Called the first time a line is held back
+	onThrottle func()
+
+	mu        sync.Mutex
+	next      time.Time
+	throttled bool
+}
+
+// newLineThrottle returns a throttle allowing limit lines per second, or nil
+// for no limit.
+func newLineThrottle(limit int, onThrottle func()) *lineThrottle {
+	if limit <= 0 {
+		return nil
+	}
+
+	interval := time.Second / time.Duration(limit)
+	return &lineThrottle{
+		interval:   interval,
+		tolerance:  time.Second - interval,
+		onThrottle: onThrottle,
+	}
+}
+
+// wait blocks until the next line can be relayed.
+func (t *lineThrottle) wait() {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+
+	now := time.Now()
+	if t.next.Before(now) {
+		t.next = now
+	}
+
+	delay := t.next.Sub(now) - t.tolerance
+	t.next = t.next.Add(t.interval)
+
+	first := delay > 0 && !t.throttled
+	if delay > 0 {
+		t.throttled = true
+	}
+
+	t.mu.Unlock()
+
+	if first {
+		t.onThrottle()
+	}
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// logLimits returns how many lines of output per second to log from the job
+// (0 for no limit), with bursts of how many (the rate limit's worth if 0),
+// and one in how many lines to log (0 or 1 for all of them).
+func (opts *Options) logLimits(job *crontab.Job) (rateLimit int, burst int, sample int) {
+	rateLimit, burst, sample = opts.LogRateLimit, opts.LogBurst, opts.LogSample
+	if job.LogRateLimit > 0 {
+		rateLimit = job.LogRateLimit
+	}
+	if job.LogBurst > 0 {
+		burst = job.LogBurst
+	}
+	if job.LogSample > 0 {
+		sample = job.LogSample
+	}
+	return rateLimit, burst, sample
+}
+
+// logLimiter decides which lines of the output of a run to log, so that a
+// chatty job can't flood the logs (or keep logging busy): one in every sample
+// lines, and no more than rateLimit lines per second, with bursts of up to
+// burst lines (a token bucket). Unlike with lineThrottle, the job isn't slowed
+// down, and the other lines are still recorded (e.g. for the dashboard and
+// archive).
+type logLimiter struct {
+	sample    int
+	rateLimit float64
+	burst     float64
+
+	// Called the first time a line is over the rate limit
+	onLimit func()
+
+	mu      sync.Mutex
+	lines   int
+	tokens  float64
+	last    time.Time
+	sampled int
+	limited int
+}
+
+// newLogLimiter returns a limiter, or nil to log all lines.
+func newLogLimiter(rateLimit int, burst int, sample int, onLimit func()) *logLimiter {
+	if rateLimit <= 0 && sample <= 1 {
+		return nil
+	}
+
+	if burst <= 0 {
+		burst = rateLimit
+	}
+
+	return &logLimiter{
+		sample:    sample,
+		rateLimit: float64(rateLimit),
+		burst:     float64(burst),
+		onLimit:   onLimit,
+		tokens:    float64(burst),
+	}
+}
+
+// allow reports whether to log the next line.
+func (l *logLimiter) allow() bool {
+	if l == nil {
+		return true
+	}
+
+	l.mu.Lock()
+
+	l.lines++
+	if l.sample > 1 && (l.lines-1)%l.sample != 0 {
+		l.sampled++
+		l.mu.Unlock()
+		return false
+	}
+
+	if l.rateLimit <= 0 {
+		l.mu.Unlock()
+		return true
+	}
+
+	now := time.Now()
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rateLimit
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+
+	if l.tokens >= 1 {
+		l.tokens--
+		l.mu.Unlock()
+		return true
+	}
+
+	l.limited++
+	first := l.limited == 1
+	l.mu.Unlock()
+
+	if first {
+		l.onLimit()
+	}
+	return false
+}
+
+// dropped returns how many lines weren't logged, because of sampling and
+// because of the rate limit.
+func (l *logLimiter) dropped() (sampled int, limited int) {
+	if l == nil {
+		return 0, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.sampled, l.limited
+}
@@ -0,0 +1,229 @@
+package cron
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// TimerQueue schedules jobs (see Options.Timers). Jobs sharing a queue don't
+// wait in goroutines of their own: a single goroutine, the queue's, holds
+// the times they're waiting for in a min-heap, sleeps until the earliest
+// one with a single timer, and calls them back once it's due (or once
+// they're triggered, or stopped). That's where jobs decide whether to run,
+// and hand their runs to the WorkerPool (see scheduledJob), so a crontab
+// with thousands of jobs has a single goroutine scheduling them, whichever
+// are waiting.
+//
+// It follows the wall clock, like schedules: a timer measures elapsed
+// time, so it may fire before the wall clock reaches its time (e.g. if NTP
+// slowed the clock down meanwhile), in which case the queue sets it again
+// rather than calling jobs back early. When the clock jumps, it calls back
+// the jobs that reschedule then instead.
+//
+// The goroutine is started when jobs start waiting, and exits once none
+// are, or have anything to do.
+type TimerQueue struct {
+	clock *ClockWatcher
+
+	mu      sync.Mutex
+	pending wakeupHeap
+	posted  []func()
+	running bool
+
+	// Wakes the goroutine up when a job starts waiting, or posts
+	// something, so that it sets its timer again
+	wake chan struct{}
+}
+
+type wakeup struct {
+	at time.Time
+	f  func()
+
+	// Called instead of f if the clock jumps first, if set (otherwise the
+	// wakeup stays in the queue, for the same wall clock time)
+	onJump func()
+
+	index int
+}
+
+// NewTimerQueue returns a queue that follows the jumps of clock (which may
+// be nil).
+func NewTimerQueue(clock *ClockWatcher) *TimerQueue {
+	return &TimerQueue{clock: clock, wake: make(chan struct{}, 1)}
+}
+
+// at calls f from the queue's goroutine once the wall clock reaches t (or
+// onJump, if it's set and the clock jumps first).
+func (q *TimerQueue) at(t time.Time, f func(), onJump func()) *wakeup {
+	// Round(0) strips the monotonic clock reading, for t to be compared to
+	// the wall clock
+	return q.push(&wakeup{at: t.Round(0), f: f, onJump: onJump})
+}
+
+// after calls f from the queue's goroutine once d has elapsed (e.g. between
+// retries), whatever the wall clock does meanwhile.
+func (q *TimerQueue) after(d time.Duration, f func()) *wakeup {
+	return q.push(&wakeup{at: time.Now().Add(d), f: f})
+}
+
+func (q *TimerQueue) push(w *wakeup) *wakeup {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	heap.Push(&q.pending, w)
+	q.start()
+
+	return w
+}
+
+// cancel stops a wakeup (if w isn't nil, and hasn't been called yet).
+func (q *TimerQueue) cancel(w *wakeup) {
+	if w == nil {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if w.index >= 0 {
+		heap.Remove(&q.pending, w.index)
+	}
+}
+
+// post calls f from the queue's goroutine, as soon as it's done with what
+// it's doing (in the order they're posted).
+func (q *TimerQueue) post(f func()) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.posted = append(q.posted, f)
+	q.start()
+}
+
+// start starts the queue's goroutine, or wakes it up if it's running.
+func (q *TimerQueue) start() {
+	if !q.running {
+		q.running = true
+		go q.run()
+		return
+	}
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *TimerQueue) run() {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		// Taken before looking at the wakeups, so that a jump meanwhile
+		// isn't missed
+		jumped := q.clock.Jumped()
+
+		f, delay, ok := q.next()
+		if !ok {
+			return
+		}
+		if f != nil {
+			f()
+			continue
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(delay)
+
+		select {
+		case <-timer.C:
+		case <-q.wake:
+		case <-jumped:
+			q.jump()
+		}
+	}
+}
+
+// next returns what the goroutine calls next (what was posted first, or the
+// earliest wakeup, if it's due), or else how long it waits for the earliest
+// wakeup, or false if nothing is waiting (in which case the goroutine exits).
+func (q *TimerQueue) next() (func(), time.Duration, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.posted) > 0 {
+		f := q.posted[0]
+		q.posted[0] = nil
+		q.posted = q.posted[1:]
+		return f, 0, true
+	}
+
+	if len(q.pending) == 0 {
+		q.running = false
+		return nil, 0, false
+	}
+
+	if w := q.pending[0]; !time.Now().Before(w.at) {
+		heap.Pop(&q.pending)
+		return w.f, 0, true
+	}
+
+	return nil, time.Until(q.pending[0].at), true
+}
+
+// jump calls back the jobs that reschedule when the clock jumps.
+func (q *TimerQueue) jump() {
+	q.mu.Lock()
+	var jumped []*wakeup
+	for _, w := range q.pending {
+		if w.onJump != nil {
+			jumped = append(jumped, w)
+		}
+	}
+	for _, w := range jumped {
+		heap.Remove(&q.pending, w.index)
+	}
+	q.mu.Unlock()
+
+	for _, w := range jumped {
+		w.onJump()
+	}
+}
+
+// wakeupHeap implements heap.Interface, ordering wakeups by time.
+type wakeupHeap []*wakeup
+
+func (h wakeupHeap) Len() int {
+	return len(h)
+}
+
+func (h wakeupHeap) Less(i, j int) bool {
+	return h[i].at.Before(h[j].at)
+}
+
+func (h wakeupHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *wakeupHeap) Push(x interface{}) {
+	w := x.(*wakeup)
+	w.index = len(*h)
+	*h = append(*h, w)
+}
+
+func (h *wakeupHeap) Pop() interface{} {
+	old := *h
+	w := old[len(old)-1]
+	old[len(old)-1] = nil
+	w.index = -1
+	*h = old[:len(old)-1]
+	return w
+}
@@ -0,0 +1,70 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimerQueueWakesUpInOrder(t *testing.T) {
+	queue := NewTimerQueue(nil)
+	now := time.Now()
+
+	order := make(chan string, 4)
+	wakeUp := func(name string) func() {
+		return func() { order <- name }
+	}
+
+	queue.at(now.Add(200*time.Millisecond), wakeUp("late"), nil)
+	queue.at(now.Add(50*time.Millisecond), wakeUp("early"), nil)
+	queue.at(now.Add(-time.Second), wakeUp("past"), nil)
+	queue.post(wakeUp("posted"))
+	queue.cancel(queue.at(now.Add(100*time.Millisecond), wakeUp("cancelled"), nil))
+
+	for _, expected := range []string{"posted", "past", "early", "late"} {
+		select {
+		case name := <-order:
+			assert.Equal(t, expected, name)
+		case <-time.After(time.Second):
+			t.Fatalf("%s wasn't woken up", expected)
+		}
+	}
+
+	select {
+	case name := <-order:
+		t.Fatalf("%s was woken up", name)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	assert.Len(t, queue.pending, 0)
+	assert.False(t, queue.running)
+}
+
+func TestTimerQueueReschedulesWhenClockJumps(t *testing.T) {
+	clock := &ClockWatcher{jumped: make(chan struct{})}
+	queue := NewTimerQueue(clock)
+
+	jumped := make(chan string, 2)
+	queue.at(time.Now().Add(time.Hour), func() {}, func() { jumped <- "rescheduled" })
+	kept := queue.at(time.Now().Add(time.Hour), func() {}, nil)
+
+	// Once the queue waits for them
+	time.Sleep(50 * time.Millisecond)
+	clock.notifyJump()
+
+	select {
+	case name := <-jumped:
+		assert.Equal(t, "rescheduled", name)
+	case <-time.After(time.Second):
+		t.Fatal("the job wasn't rescheduled")
+	}
+
+	queue.mu.Lock()
+	assert.Len(t, queue.pending, 1)
+	queue.mu.Unlock()
+
+	queue.cancel(kept)
+}
@@ -0,0 +1,51 @@
+package cron
+
+import (
+	"context"
+	"time"
+
+	"github.com/samgaw/cronic/crontab"
+)
+
+// timeout returns how long runs of the job can last before they're killed.
+func (opts *Options) timeout(job *crontab.Job) time.Duration {
+	if job.Timeout > 0 {
+		return job.Timeout
+	}
+	return opts.Timeout
+}
+
+// warnAfter returns how long runs of the job can last before cronic warns
+// that they're still running.
+func (opts *Options) warnAfter(job *crontab.Job) time.Duration {
+	if job.WarnAfter > 0 {
+		return job.WarnAfter
+	}
+	return opts.WarnAfter
+}
+
+// watchRun warns every warnAfter that a run is still going, until ctx is
+// done, from the goroutine of timers. Unlike the warnings about skipped
+// runs (see monitorJob), this doesn't depend on the job's schedule, so runs
+// of jobs that seldom run don't go unnoticed for long.
+func watchRun(ctx context.Context, warnAfter time.Duration, timers *TimerQueue, jobLogger *Logger) {
+	if warnAfter <= 0 {
+		return
+	}
+
+	// Only used from the goroutine of timers
+	var w *wakeup
+
+	var wait func(elapsed time.Duration)
+	wait = func(elapsed time.Duration) {
+		w = timers.after(warnAfter, func() {
+			jobLogger.WithField("elapsed", elapsed).Warnf("CRONIC: Job is still running after %v (warn-after is %v)", elapsed, warnAfter)
+			wait(elapsed + warnAfter)
+		})
+	}
+
+	timers.post(func() { wait(warnAfter) })
+	context.AfterFunc(ctx, func() {
+		timers.post(func() { timers.cancel(w) })
+	})
+}
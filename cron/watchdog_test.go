@@ -0,0 +1,69 @@
+package cron
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchRunWarns(t *testing.T) {
+	logger, channel := newTestLogger()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	watchRun(ctx, 50*time.Millisecond, NewTimerQueue(nil), logger)
+
+	expectMessages(t, channel,
+		`^CRONIC: Job is still running after 50ms \(warn-after is 50ms\)$`,
+		`^CRONIC: Job is still running after 100ms \(warn-after is 50ms\)$`,
+	)
+
+	cancel()
+}
+
+func TestOptionsOverrideJobsWithoutTimeouts(t *testing.T) {
+	opts := &Options{Timeout: time.Hour, WarnAfter: time.Minute}
+
+	assert.Equal(t, time.Hour, opts.timeout(&crontab.Job{}))
+	assert.Equal(t, time.Minute, opts.warnAfter(&crontab.Job{}))
+
+	job := &crontab.Job{Timeout: 2 * time.Hour, WarnAfter: 5 * time.Minute}
+	assert.Equal(t, 2*time.Hour, opts.timeout(job))
+	assert.Equal(t, 5*time.Minute, opts.warnAfter(job))
+}
+
+func TestStartJobAppliesDefaultTimeout(t *testing.T) {
+	job := crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: &testExpression{time.Hour},
+			Schedule:   "always!",
+			Command:    "sleep 10",
+		},
+	}
+
+	notifier := &testNotifier{make(chan *Event, TEST_CHANNEL_BUFFER_SIZE)}
+	opts := &Options{Notifiers: []Notifier{notifier}, Timeout: 50 * time.Millisecond}
+
+	ctx, stop := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+
+	logger, _ := newTestLogger()
+	status := NewJobStatus(&job)
+
+	StartJob(ctx, &wg, &basicContext, opts, status, logger)
+	assert.Nil(t, status.Trigger())
+
+	expectEvent(t, notifier.events, crontab.EventStart)
+	timeout := expectEvent(t, notifier.events, crontab.EventTimeout)
+	if assert.NotNil(t, timeout.Result) {
+		assert.True(t, timeout.Result.TimedOut)
+	}
+
+	stop()
+	wg.Wait()
+}
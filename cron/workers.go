@@ -0,0 +1,112 @@
+package cron
+
+import (
+	"sync"
+)
+
+var (
+	// How many runs cronic's workers run at once by default, across all
+	// jobs (see -max-concurrent-runs)
+	MAX_CONCURRENT_RUNS = 64
+)
+
+// WorkerPool runs jobs' runs on at most size goroutines (its workers) at
+// once, across all jobs (e.g. so that a crontab with thousands of jobs due
+// at midnight doesn't start thousands of processes at once). The
+// TimerQueue hands it runs as they're due, and those that find all the
+// workers busy wait in line for one, in the order they were due. Workers
+// are started as they're needed, and exit once no runs are waiting.
+//
+// Runs wait for a worker after their namespace's limit, so that runs
+// waiting for a busy namespace don't hold workers.
+type WorkerPool struct {
+	size int
+
+	mu      sync.Mutex
+	workers int
+	waiting waitQueue
+}
+
+// NewWorkerPool returns a pool of size workers (which must be positive).
+func NewWorkerPool(size int) *WorkerPool {
+	return &WorkerPool{size: size}
+}
+
+// run runs f on a worker if one is free (or, if p is nil, on a goroutine of
+// its own), and returns true. Otherwise f waits for a worker, and run
+// returns false, and a function that stops waiting (which returns false if
+// a worker took f meanwhile).
+func (p *WorkerPool) run(f func()) (bool, func() bool) {
+	if p == nil {
+		go f()
+		return true, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.workers < p.size {
+		p.workers++
+		go p.work(f)
+		return true, nil
+	}
+
+	w := p.waiting.push(f)
+	return false, func() bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.waiting.remove(w)
+	}
+}
+
+// work runs f, then the runs waiting for a worker, until none are.
+func (p *WorkerPool) work(f func()) {
+	for f != nil {
+		f()
+
+		p.mu.Lock()
+		f = p.waiting.pop()
+		if f == nil {
+			p.workers--
+		}
+		p.mu.Unlock()
+	}
+}
+
+// waitQueue holds the functions waiting for something (e.g. a worker), in
+// the order they started waiting.
+type waitQueue []*waiter
+
+type waiter struct {
+	f func()
+}
+
+func (q *waitQueue) push(f func()) *waiter {
+	w := &waiter{f}
+	*q = append(*q, w)
+	return w
+}
+
+// pop returns the function that has waited longest, or nil if none are
+// waiting.
+func (q *waitQueue) pop() func() {
+	if len(*q) == 0 {
+		return nil
+	}
+
+	w := (*q)[0]
+	(*q)[0] = nil
+	*q = (*q)[1:]
+	return w.f
+}
+
+// remove stops w from waiting, and returns false if it wasn't (any longer).
+func (q *waitQueue) remove(w *waiter) bool {
+	for i, waiting := range *q {
+		if waiting == w {
+			*q = append((*q)[:i], (*q)[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
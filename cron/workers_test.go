@@ -0,0 +1,103 @@
+package cron
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkerPoolLimitsConcurrentRuns(t *testing.T) {
+	opts := &Options{Workers: NewWorkerPool(1)}
+
+	var wg sync.WaitGroup
+
+	ctx, stop := context.WithCancel(context.Background())
+	statuses := make([]*JobStatus, 0)
+
+	for i := 0; i < 2; i++ {
+		job := newTestJob("sleep 0.2")
+		job.Position = i
+
+		logger, _ := newTestLogger()
+		status := NewJobStatus(job)
+		statuses = append(statuses, status)
+
+		StartJob(ctx, &wg, &basicContext, opts, status, logger)
+	}
+
+	for _, status := range statuses {
+		assert.Nil(t, status.Trigger())
+	}
+
+	waitFor(t, "both jobs to run", func() bool {
+		return statuses[0].Snapshot().LastResult != nil && statuses[1].Snapshot().LastResult != nil
+	})
+
+	first, second := statuses[0].Snapshot().LastResult, statuses[1].Snapshot().LastResult
+	if first.StartedAt.After(second.StartedAt) {
+		first, second = second, first
+	}
+	assert.False(t, second.StartedAt.Before(first.FinishedAt))
+
+	stop()
+	wg.Wait()
+}
+
+func TestWorkerPoolRunsInOrder(t *testing.T) {
+	pool := NewWorkerPool(1)
+
+	release := make(chan struct{})
+	started, _ := pool.run(func() { <-release })
+	assert.True(t, started)
+
+	order := make(chan int, 3)
+	for i := 0; i < 3; i++ {
+		i := i
+		started, _ := pool.run(func() { order <- i })
+		assert.False(t, started)
+	}
+
+	close(release)
+	for expected := 0; expected < 3; expected++ {
+		select {
+		case i := <-order:
+			assert.Equal(t, expected, i)
+		case <-time.After(time.Second):
+			t.Fatalf("run %d didn't run", expected)
+		}
+	}
+
+	waitFor(t, "the worker to exit", func() bool {
+		pool.mu.Lock()
+		defer pool.mu.Unlock()
+		return pool.workers == 0
+	})
+}
+
+func TestWorkerPoolDoesntStartRunsOnShutdown(t *testing.T) {
+	opts := &Options{Workers: NewWorkerPool(1)}
+
+	release := make(chan struct{})
+	opts.Workers.run(func() { <-release })
+
+	ctx, stop := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+
+	logger, channel := newTestLogger()
+	status := NewJobStatus(newTestJob("true"))
+
+	StartJob(ctx, &wg, &basicContext, opts, status, logger)
+	assert.Nil(t, status.Trigger())
+	expectMessages(t, channel, "Job will run next", "Job triggered manually", "Waiting for one of the 1 workers to be free")
+
+	// The job is done without waiting for the worker
+	stop()
+	wg.Wait()
+
+	close(release)
+	time.Sleep(100 * time.Millisecond)
+	assert.Nil(t, status.Snapshot().LastResult)
+}
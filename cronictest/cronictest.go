@@ -0,0 +1,312 @@
+// Package cronictest simulates the schedule of a crontab against a fake
+// clock, so that Go tests can check which commands it would run, when, and
+// with what environment, without running them (or waiting):
+//
+//	func TestBackupsRunNightly(t *testing.T) {
+//		start := time.Date(2018, 4, 7, 12, 0, 0, 0, time.UTC)
+//		tab, err := cronictest.Load("crontab", start)
+//		if err != nil {
+//			t.Fatal(err)
+//		}
+//
+//		runs := tab.Advance(24 * time.Hour)
+//		run := cronictest.ExpectRun(t, runs, "./backup.sh", start.Add(15*time.Hour))
+//		if run.Env["BUCKET"] != "s3://backups" {
+//			t.Errorf("backups go to %q", run.Env["BUCKET"])
+//		}
+//	}
+//
+// Runs are assumed to take no time, and are never skipped (e.g. because the
+// previous run is still in progress).
+package cronictest
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samgaw/cronic/cron"
+	"github.com/samgaw/cronic/crontab"
+)
+
+// Crontab is a crontab whose jobs are scheduled against a fake clock.
+type Crontab struct {
+	*crontab.Crontab
+
+	// The environment cronic would inherit (none by default, so that
+	// tests don't depend on the environment they run in)
+	Environ map[string]string
+
+	// The namespaces jobs can belong to, by name (see cron.ParseNamespaces)
+	Namespaces map[string]*cron.Namespace
+
+	now     time.Time
+	started time.Time
+
+	// The next run of each job (the zero time once it won't run again)
+	next []time.Time
+}
+
+// Run is a run of a job that cronic would start.
+type Run struct {
+	At  time.Time
+	Job *crontab.Job
+
+	// What cronic would execute: Argv if the job runs without a shell, or
+	// Command with Shell otherwise
+	Shell   string
+	Command string
+	Argv    []string
+	Dir     string
+	Env     map[string]string
+
+	// What cronic would feed to the command's stdin (see crontab.Job.Stdin)
+	Stdin string
+}
+
+// New schedules the jobs of tab from start.
+func New(tab *crontab.Crontab, start time.Time) *Crontab {
+	c := &Crontab{
+		Crontab: tab,
+		Environ: make(map[string]string),
+		now:     start,
+		started: start,
+		next:    make([]time.Time, len(tab.Jobs)),
+	}
+
+	for i, job := range tab.Jobs {
+		c.next[i] = c.firstRun(job)
+	}
+
+	return c
+}
+
+// Parse reads a crontab, and schedules its jobs from start.
+func Parse(reader io.Reader, start time.Time) (*Crontab, error) {
+	tab, err := crontab.ParseCrontab(reader)
+	if err != nil {
+		return nil, err
+	}
+	return New(tab, start), nil
+}
+
+// Load reads the crontab at path, and schedules its jobs from start.
+func Load(path string, start time.Time) (*Crontab, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	return Parse(file, start)
+}
+
+// LoadConfig reads the configuration file (see crontab.ParseConfig) at
+// path, and schedules its jobs from start.
+func LoadConfig(path string, start time.Time) (*Crontab, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	tab, err := crontab.ParseConfig(file)
+	if err != nil {
+		return nil, err
+	}
+	return New(tab, start), nil
+}
+
+// Now returns the time of the fake clock.
+func (c *Crontab) Now() time.Time {
+	return c.now
+}
+
+// Job returns the job with this name, or nil if there's none.
+func (c *Crontab) Job(name string) *crontab.Job {
+	for _, job := range c.Jobs {
+		if job.Name == name {
+			return job
+		}
+	}
+	return nil
+}
+
+// Advance moves the fake clock forward by d, and returns the runs cronic
+// would have started meanwhile, in order.
+func (c *Crontab) Advance(d time.Duration) []Run {
+	return c.AdvanceTo(c.now.Add(d))
+}
+
+// AdvanceTo moves the fake clock forward to until, and returns the runs
+// cronic would have started meanwhile (including at until), in order. Runs
+// that start at the same time are in the order of the crontab.
+func (c *Crontab) AdvanceTo(until time.Time) []Run {
+	runs := make([]Run, 0)
+
+	for i, job := range c.Jobs {
+		for !c.next[i].IsZero() && !c.next[i].After(until) {
+			runs = append(runs, c.run(job, c.next[i]))
+			c.next[i] = c.nextRun(job, c.next[i])
+		}
+	}
+
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].At.Before(runs[j].At)
+	})
+
+	if until.After(c.now) {
+		c.now = until
+	}
+	return runs
+}
+
+// Next moves the fake clock forward to the nth next run cronic would start
+// (or as far as the last run, if there are fewer), and returns the runs up
+// to it, in the same order as AdvanceTo.
+func (c *Crontab) Next(n int) []Run {
+	runs := make([]Run, 0, n)
+
+	for len(runs) < n {
+		next := -1
+		for i := range c.Jobs {
+			if !c.next[i].IsZero() && (next == -1 || c.next[i].Before(c.next[next])) {
+				next = i
+			}
+		}
+		if next == -1 {
+			break
+		}
+
+		at := c.next[next]
+		runs = append(runs, c.run(c.Jobs[next], at))
+		c.next[next] = c.nextRun(c.Jobs[next], at)
+
+		if at.After(c.now) {
+			c.now = at
+		}
+	}
+
+	return runs
+}
+
+// firstRun returns when cronic would first run the job after starting,
+// or the zero time if it wouldn't.
+func (c *Crontab) firstRun(job *crontab.Job) time.Time {
+	if at, ok := job.RunsOnce(); ok {
+		if at.IsZero() {
+			return c.started
+		}
+		if !at.After(c.started) {
+			// Its time has passed
+			return time.Time{}
+		}
+		return at
+	}
+
+	return job.Expression.Next(c.started)
+}
+
+// nextRun returns when cronic would run the job after a run at previous, or
+// the zero time if it wouldn't.
+func (c *Crontab) nextRun(job *crontab.Job, previous time.Time) time.Time {
+	if _, ok := job.RunsOnce(); ok {
+		return time.Time{}
+	}
+	return job.Expression.Next(previous)
+}
+
+func (c *Crontab) run(job *crontab.Job, at time.Time) Run {
+	environ := make([]string, 0, len(c.Environ))
+	for k, v := range c.Environ {
+		environ = append(environ, fmt.Sprintf("%s=%s", k, v))
+	}
+
+	// Unknown namespaces don't restrict the environment (cronic fails
+	// the runs of their jobs)
+	opts := &cron.Options{Namespaces: c.Namespaces}
+	namespace, _ := opts.Namespace(job)
+
+	env := make(map[string]string)
+	for _, kv := range cron.JobEnviron(environ, c.Context, namespace, job) {
+		if i := strings.Index(kv, "="); i != -1 {
+			env[kv[:i]] = kv[i+1:]
+		}
+	}
+
+	shell := job.Shell
+	if shell == "" {
+		shell = c.Context.Shell
+	}
+
+	return Run{
+		At:      at,
+		Job:     job,
+		Shell:   shell,
+		Command: job.Command,
+		Argv:    job.Argv,
+		Dir:     cron.JobDir(c.Context, job),
+		Env:     env,
+		Stdin:   job.Stdin,
+	}
+}
+
+// Commands returns the commands of runs, in order.
+func Commands(runs []Run) []string {
+	commands := make([]string, len(runs))
+	for i, run := range runs {
+		commands[i] = run.Command
+	}
+	return commands
+}
+
+// ExpectRun checks that runs include a run of command (or of the job with
+// this name) at at, and returns it. It reports an error with t if not.
+func ExpectRun(t testing.TB, runs []Run, command string, at time.Time) Run {
+	t.Helper()
+
+	for _, run := range runs {
+		if run.is(command) && run.At.Equal(at) {
+			return run
+		}
+	}
+
+	t.Errorf("cronictest: expected %q to run at %v, but got:\n%s", command, at, formatRuns(runs))
+	return Run{}
+}
+
+// ExpectNoRun checks that runs don't include a run of command (or of the job
+// with this name). It reports an error with t if they do.
+func ExpectNoRun(t testing.TB, runs []Run, command string) {
+	t.Helper()
+
+	for _, run := range runs {
+		if run.is(command) {
+			t.Errorf("cronictest: expected %q not to run, but it runs at %v", command, run.At)
+			return
+		}
+	}
+}
+
+// is reports whether the run is of command, or of the job with this name.
+func (run *Run) is(command string) bool {
+	return run.Command == command || (run.Job.Name != "" && run.Job.Name == command)
+}
+
+func formatRuns(runs []Run) string {
+	if len(runs) == 0 {
+		return "  (no runs)"
+	}
+
+	lines := make([]string, len(runs))
+	for i, run := range runs {
+		lines[i] = fmt.Sprintf("  %v: %s", run.At, run.Command)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,138 @@
+package cronictest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samgaw/cronic/cron"
+	"github.com/stretchr/testify/assert"
+)
+
+// Saturday, April 7th 2018, at noon
+var testStart = time.Date(2018, 4, 7, 12, 0, 0, 0, time.Local)
+
+const testCrontab = `
+SHELL=/bin/bash
+PATH=/usr/bin:/bin
+BUCKET=s3://backups
+
+# name: backup
+# cronic: path-prepend=/opt/backup/bin
+0 3 * * * ./backup.sh
+
+*/30 * * * * ./poll.sh
+@every 45m ./sync.sh
+@once ./migrate.sh
+@at 2018-04-06T12:00:00Z ./missed.sh
+`
+
+func parseTestCrontab(t *testing.T) *Crontab {
+	tab, err := Parse(strings.NewReader(testCrontab), testStart)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	return tab
+}
+
+func TestAdvance(t *testing.T) {
+	tab := parseTestCrontab(t)
+
+	runs := tab.Advance(time.Hour)
+	assert.Equal(t, []string{"./migrate.sh", "./poll.sh", "./sync.sh", "./poll.sh"}, Commands(runs))
+	assert.Equal(t, testStart, runs[0].At)
+	assert.Equal(t, testStart.Add(30*time.Minute), runs[1].At)
+	assert.Equal(t, testStart.Add(45*time.Minute), runs[2].At)
+	assert.Equal(t, testStart.Add(time.Hour), runs[3].At)
+	assert.Equal(t, testStart.Add(time.Hour), tab.Now())
+
+	// One-shot jobs only run once, and intervals carry on from their last
+	// run
+	runs = tab.Advance(time.Hour)
+	assert.Equal(t, []string{"./poll.sh", "./sync.sh", "./poll.sh"}, Commands(runs))
+	assert.Equal(t, testStart.Add(90*time.Minute), runs[1].At)
+
+	runs = tab.AdvanceTo(testStart.Add(24 * time.Hour))
+	ExpectRun(t, runs, "backup", time.Date(2018, 4, 8, 3, 0, 0, 0, time.Local))
+	ExpectNoRun(t, runs, "./missed.sh")
+	ExpectNoRun(t, runs, "./migrate.sh")
+}
+
+func TestNext(t *testing.T) {
+	tab := parseTestCrontab(t)
+
+	runs := tab.Next(4)
+	assert.Equal(t, []string{"./migrate.sh", "./poll.sh", "./sync.sh", "./poll.sh"}, Commands(runs))
+	assert.Equal(t, testStart.Add(time.Hour), tab.Now())
+
+	// Next carries on from there, like Advance
+	runs = tab.Next(2)
+	assert.Equal(t, []string{"./poll.sh", "./sync.sh"}, Commands(runs))
+	assert.Equal(t, testStart.Add(90*time.Minute), runs[1].At)
+
+	// There are only as many runs as the jobs start
+	tab, err := Parse(strings.NewReader("@once ./migrate.sh"), testStart)
+	if assert.Nil(t, err) {
+		assert.Equal(t, []string{"./migrate.sh"}, Commands(tab.Next(10)))
+	}
+}
+
+func TestRunEnvironment(t *testing.T) {
+	tab := parseTestCrontab(t)
+	tab.Environ["HOME"] = "/home/cronic"
+
+	run := ExpectRun(t, tab.Advance(24*time.Hour), "./backup.sh", time.Date(2018, 4, 8, 3, 0, 0, 0, time.Local))
+	assert.Equal(t, "/bin/bash", run.Shell)
+	assert.Equal(t, map[string]string{
+		"SHELL":  "/bin/bash",
+		"PATH":   "/opt/backup/bin:/usr/bin:/bin",
+		"BUCKET": "s3://backups",
+		"HOME":   "/home/cronic",
+	}, run.Env)
+}
+
+func TestRunEnvironmentOfNamespaces(t *testing.T) {
+	tab, err := Parse(strings.NewReader("# cronic: namespace=team\n@hourly ./report.sh"), testStart)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	tab.Environ["HOME"] = "/home/cronic"
+	tab.Environ["AWS_SECRET_ACCESS_KEY"] = "hunter2"
+	tab.Namespaces = map[string]*cron.Namespace{
+		"team": {Name: "team", AllowedEnv: []string{"HOME"}},
+	}
+
+	runs := tab.Advance(time.Hour)
+	if assert.Len(t, runs, 1) {
+		assert.Equal(t, map[string]string{"HOME": "/home/cronic"}, runs[0].Env)
+	}
+}
+
+// recordingT records the errors reported by the functions it's passed to.
+type recordingT struct {
+	testing.TB
+	errors []string
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestExpectRunReportsMissingRuns(t *testing.T) {
+	tab := parseTestCrontab(t)
+	runs := tab.Advance(time.Hour)
+
+	for _, check := range []func(t testing.TB){
+		func(t testing.TB) { ExpectRun(t, runs, "./backup.sh", testStart) },
+		func(t testing.TB) { ExpectRun(t, runs, "./poll.sh", testStart) },
+		func(t testing.TB) { ExpectNoRun(t, runs, "./poll.sh") },
+	} {
+		recorder := &recordingT{TB: t}
+		check(recorder)
+		assert.Len(t, recorder.errors, 1)
+	}
+}
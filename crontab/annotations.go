@@ -0,0 +1,724 @@
+package crontab
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	annotationMatcher = regexp.MustCompile(`^#\s*cronic:(.*)$`)
+	lockNameMatcher   = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+	// The facilities of syslog-facility (see RFC 5424)
+	SyslogFacilities = []string{
+		"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news", "uucp", "cron", "authpriv", "ftp",
+		"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+	}
+)
+
+type annotation struct {
+	key      string
+	value    string
+	hasValue bool
+}
+
+// parseAnnotation parses the body of a "# cronic:" comment, which is a
+// whitespace-separated list of key=value pairs. Values may be quoted (using
+// single or double quotes) to include whitespace. A key without a value is
+// set to "true".
+func parseAnnotation(text string) ([]annotation, error) {
+	annotations := make([]annotation, 0)
+
+	rest := strings.TrimSpace(text)
+	for rest != "" {
+		keyEnds := strings.IndexAny(rest, "= \t")
+		if keyEnds == -1 {
+			keyEnds = len(rest)
+		}
+
+		key := rest[:keyEnds]
+		if key == "" {
+			return nil, fmt.Errorf("missing annotation name before %q", rest)
+		}
+
+		rest = rest[keyEnds:]
+		value := "true"
+		hasValue := strings.HasPrefix(rest, "=")
+
+		if hasValue {
+			rest = rest[1:]
+
+			if rest != "" && (rest[0] == '"' || rest[0] == '\'') {
+				quoteEnds := strings.IndexByte(rest[1:], rest[0])
+				if quoteEnds == -1 {
+					return nil, fmt.Errorf("unterminated quote in annotation %q", key)
+				}
+
+				value = rest[1 : quoteEnds+1]
+				rest = rest[quoteEnds+2:]
+
+				if rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+					return nil, fmt.Errorf("unexpected %q after closing quote in annotation %q", rest, key)
+				}
+			} else {
+				valueEnds := strings.IndexAny(rest, " \t")
+				if valueEnds == -1 {
+					valueEnds = len(rest)
+				}
+
+				value = rest[:valueEnds]
+				rest = rest[valueEnds:]
+			}
+		}
+
+		annotations = append(annotations, annotation{key: key, value: value, hasValue: hasValue})
+		rest = strings.TrimSpace(rest)
+	}
+
+	return annotations, nil
+}
+
+func (a annotation) requireValue() (string, error) {
+	if !a.hasValue || a.value == "" {
+		return "", fmt.Errorf("annotation %q requires a value", a.key)
+	}
+	return a.value, nil
+}
+
+func (a annotation) boolValue() (bool, error) {
+	value, err := strconv.ParseBool(a.value)
+	if err != nil {
+		return false, fmt.Errorf("annotation %q must be true or false", a.key)
+	}
+	return value, nil
+}
+
+func applyAnnotations(job *Job, annotations []annotation) error {
+	for _, a := range annotations {
+		if _, ok := job.Annotations[a.key]; ok {
+			return fmt.Errorf("duplicate annotation %q", a.key)
+		}
+
+		if job.Annotations == nil {
+			job.Annotations = make(map[string]string)
+		}
+		job.Annotations[a.key] = a.value
+
+		switch a.key {
+		case "path-prepend":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+			job.PathPrepend = value
+		case "stdout-level", "stderr-level":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+
+			level, err := ParseLevel(value)
+			if err != nil {
+				return fmt.Errorf("annotation %q must be one of debug, info, warning, or error", a.key)
+			}
+
+			if a.key == "stdout-level" {
+				job.StdoutLevel = &level
+			} else {
+				job.StderrLevel = &level
+			}
+		case "debug-command":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+			job.DebugCommand = value
+		case "on-success", "on-failure":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+
+			if a.key == "on-success" {
+				job.OnSuccess = value
+			} else {
+				job.OnFailure = value
+			}
+		case "webhook-url":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+
+			parsed, err := url.Parse(value)
+			if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+				return fmt.Errorf("annotation %q must be an http or https URL", a.key)
+			}
+			job.WebhookURL = value
+		case "webhook-events":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+
+			eventTypes, err := ParseEventTypes(value)
+			if err != nil {
+				return fmt.Errorf("annotation %q: %v", a.key, err)
+			}
+			job.WebhookEvents = eventTypes
+		case "namespace":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+			job.Namespace = value
+		case "slack-channel":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+			job.SlackChannel = value
+		case "syslog-facility":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+			if !containsString(SyslogFacilities, value) {
+				return fmt.Errorf("annotation %q: unknown facility %q (expected one of %s)", a.key, value, strings.Join(SyslogFacilities, ", "))
+			}
+			job.SyslogFacility = value
+		case "syslog-tag":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+			job.SyslogTag = value
+		case "timeout":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+
+			timeout, err := time.ParseDuration(value)
+			if err != nil || timeout <= 0 {
+				return fmt.Errorf("annotation %q must be a positive duration (e.g. 1h)", a.key)
+			}
+			job.Timeout = timeout
+		case "warn-after":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+
+			warnAfter, err := time.ParseDuration(value)
+			if err != nil || warnAfter <= 0 {
+				return fmt.Errorf("annotation %q must be a positive duration (e.g. 30m)", a.key)
+			}
+			job.WarnAfter = warnAfter
+		case "splay":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+
+			splay, err := time.ParseDuration(value)
+			if err != nil || splay <= 0 {
+				return fmt.Errorf("annotation %q must be a positive duration (e.g. 5m)", a.key)
+			}
+			job.Splay = splay
+		case "splay-stable":
+			stable, err := a.boolValue()
+			if err != nil {
+				return err
+			}
+			job.SplayStable = stable
+		case "checkpoint-signal":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+
+			signal, err := ParseSignal(value)
+			if err != nil {
+				return fmt.Errorf("annotation %q: %v", a.key, err)
+			}
+			job.CheckpointSignal = signal
+		case "checkpoint-grace":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+
+			grace, err := time.ParseDuration(value)
+			if err != nil || grace <= 0 {
+				return fmt.Errorf("annotation %q must be a positive duration (e.g. 5m)", a.key)
+			}
+			job.CheckpointGrace = grace
+		case "after":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+
+			for _, name := range strings.Split(value, ",") {
+				if err := ValidateJobName(name); err != nil {
+					return fmt.Errorf("annotation %q: %v", a.key, err)
+				}
+				for _, other := range job.After {
+					if other == name {
+						return fmt.Errorf("annotation %q lists %q twice", a.key, name)
+					}
+				}
+				job.After = append(job.After, name)
+			}
+		case "lock":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+
+			if !lockNameMatcher.MatchString(value) || strings.Trim(value, ".") == "" {
+				return fmt.Errorf("annotation %q must only contain letters, digits, '_', '-' and '.'", a.key)
+			}
+			job.Lock = value
+		case "retries":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+
+			retries, err := strconv.Atoi(value)
+			if err != nil || retries < 0 {
+				return fmt.Errorf("annotation %q must be a non-negative number", a.key)
+			}
+			job.retryPolicy().Retries = retries
+		case "pause-after-failures":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+
+			failures, err := strconv.Atoi(value)
+			if err != nil || failures <= 0 {
+				return fmt.Errorf("annotation %q must be a positive number", a.key)
+			}
+			job.PauseAfterFailures = failures
+		case "pause-for":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+
+			pauseFor, err := time.ParseDuration(value)
+			if err != nil || pauseFor <= 0 {
+				return fmt.Errorf("annotation %q must be a positive duration (e.g. 1h)", a.key)
+			}
+			job.PauseFor = pauseFor
+		case "retry-delay":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+
+			delay, err := time.ParseDuration(value)
+			if err != nil || delay < 0 {
+				return fmt.Errorf("annotation %q must be a duration (e.g. 30s)", a.key)
+			}
+			job.retryPolicy().Delay = delay
+		case "retry-on", "retry-never":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+
+			conditions, err := ParseFailureConditions(value)
+			if err != nil {
+				return fmt.Errorf("annotation %q: %v", a.key, err)
+			}
+
+			if a.key == "retry-on" {
+				job.retryPolicy().On = conditions
+			} else {
+				job.retryPolicy().Never = conditions
+			}
+		case "shell":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+			job.Shell = value
+		case "stdin":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+			job.StdinFile = value
+		case "on-spawn-failure":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+
+			policy, err := ParseSpawnFailurePolicy(value)
+			if err != nil {
+				return fmt.Errorf("annotation %q: %v", a.key, err)
+			}
+			job.OnSpawnFailure = policy
+		case "expect-output":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+			job.ExpectOutput = value
+		case "expect-output-match":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+
+			pattern, err := regexp.Compile(value)
+			if err != nil {
+				return fmt.Errorf("annotation %q: %v", a.key, err)
+			}
+			job.ExpectOutputMatch = pattern
+		case "interval-from":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+
+			switch value {
+			case IntervalFromStart:
+				job.IntervalFromEnd = false
+			case IntervalFromEnd:
+				job.IntervalFromEnd = true
+			default:
+				return fmt.Errorf("annotation %q must be %s or %s", a.key, IntervalFromStart, IntervalFromEnd)
+			}
+		case "output-rate-limit":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+
+			limit, err := strconv.Atoi(value)
+			if err != nil || limit < 1 {
+				return fmt.Errorf("annotation %q must be a positive number of lines per second", a.key)
+			}
+			job.OutputRateLimit = limit
+		case "log-rate-limit", "log-burst", "log-sample":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return fmt.Errorf("annotation %q must be a positive number of lines", a.key)
+			}
+
+			switch a.key {
+			case "log-rate-limit":
+				job.LogRateLimit = n
+			case "log-burst":
+				job.LogBurst = n
+			default:
+				job.LogSample = n
+			}
+		case "max-output":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+
+			limit, err := ParseByteSize(value)
+			if err != nil || limit == 0 {
+				return fmt.Errorf("annotation %q must be a positive size (e.g. 1MB)", a.key)
+			}
+			job.MaxOutput = limit
+		case "memory-limit":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+
+			limit, err := ParseByteSize(value)
+			if err != nil || limit == 0 {
+				return fmt.Errorf("annotation %q must be a positive size (e.g. 512M)", a.key)
+			}
+			job.MemoryLimit = limit
+		case "cpu-limit":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+
+			limit, err := strconv.ParseFloat(value, 64)
+			if err != nil || !(limit > 0) || math.IsInf(limit, 0) {
+				return fmt.Errorf("annotation %q must be a positive number of CPUs (e.g. 0.5)", a.key)
+			}
+			job.CPULimit = limit
+		case "nofile":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+
+			limit, err := strconv.Atoi(value)
+			if err != nil || limit < 1 {
+				return fmt.Errorf("annotation %q must be a positive number of files", a.key)
+			}
+			job.NoFile = limit
+		case "umask":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+
+			umask, err := strconv.ParseUint(value, 8, 32)
+			if err != nil || umask > 0777 {
+				return fmt.Errorf("annotation %q must be an octal mask (e.g. 027)", a.key)
+			}
+			mask := int(umask)
+			job.Umask = &mask
+		case "env-allow", "env-deny":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+
+			patterns, err := ParseEnvPatterns(value)
+			if err != nil {
+				return fmt.Errorf("annotation %q: %v", a.key, err)
+			}
+			if a.key == "env-allow" {
+				job.EnvAllow = patterns
+			} else {
+				job.EnvDeny = patterns
+			}
+		case "image":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+			job.Image = value
+		case "pull":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+
+			policy, err := ParsePullPolicy(value)
+			if err != nil {
+				return fmt.Errorf("annotation %q: %v", a.key, err)
+			}
+			job.ImagePull = policy
+		case "mounts":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+
+			mounts, err := ParseMounts(value)
+			if err != nil {
+				return fmt.Errorf("annotation %q: %v", a.key, err)
+			}
+			job.Mounts = mounts
+		case "k8s-template":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+			job.JobTemplate = value
+		case "host":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+			if strings.ContainsAny(value, " \t") || strings.HasPrefix(value, "-") {
+				return fmt.Errorf("annotation %q: bad host: %q", a.key, value)
+			}
+			job.Host = value
+		case "key":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+			job.SSHKey = value
+		case "nice":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+
+			nice, err := strconv.Atoi(value)
+			if err != nil || nice < -20 || nice > 19 {
+				return fmt.Errorf("annotation %q must be a niceness from -20 to 19", a.key)
+			}
+			job.Nice = nice
+		case "ionice":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+
+			class, level, err := ParseIOPriority(value)
+			if err != nil {
+				return fmt.Errorf("annotation %q: %v", a.key, err)
+			}
+			job.IOClass = class
+			job.IOLevel = level
+		case "json-output":
+			jsonOutput, err := a.boolValue()
+			if err != nil {
+				return err
+			}
+			job.JSONOutput = &jsonOutput
+		case "quiet":
+			quiet, err := a.boolValue()
+			if err != nil {
+				return err
+			}
+			job.Quiet = quiet
+		case "blackout":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+
+			blackout, err := ParseBlackout(value)
+			if err != nil {
+				return fmt.Errorf("annotation %q: %v", a.key, err)
+			}
+			job.Blackout = blackout
+		case "on-blackout":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+
+			policy, err := ParseBlackoutPolicy(value)
+			if err != nil {
+				return fmt.Errorf("annotation %q: %v", a.key, err)
+			}
+			job.OnBlackout = policy
+		case "skip-holidays":
+			skipHolidays, err := a.boolValue()
+			if err != nil {
+				return err
+			}
+			job.SkipHolidays = skipHolidays
+		case "if-env", "unless-env":
+			value, err := a.requireValue()
+			if err != nil {
+				return err
+			}
+
+			condition, err := parseEnvCondition(value)
+			if err != nil {
+				return fmt.Errorf("annotation %q: %v", a.key, err)
+			}
+
+			if a.key == "if-env" {
+				job.IfEnv = condition
+			} else {
+				job.UnlessEnv = condition
+			}
+		default:
+			return fmt.Errorf("unknown annotation %q", a.key)
+		}
+	}
+
+	if _, ok := job.Annotations["retries"]; job.Retry != nil && !ok {
+		return fmt.Errorf("annotations retry-delay, retry-on and retry-never require retries")
+	}
+
+	if _, ok := job.Annotations["interval-from"]; ok && !job.isInterval() {
+		return fmt.Errorf("annotation interval-from requires an @every schedule")
+	}
+
+	if job.isAfterInterval() {
+		if _, ok := job.Annotations["interval-from"]; ok {
+			return fmt.Errorf("annotation interval-from can't be used with an @after schedule (whose interval always starts at the end of the previous run)")
+		}
+		job.IntervalFromEnd = true
+	}
+
+	if job.StdinFile != "" && job.Stdin != "" {
+		return fmt.Errorf("annotation stdin can't be used with a %% in the command (whose rest is already its stdin)")
+	}
+
+	if job.Image == "" && (job.ImagePull != "" || job.Mounts != nil || job.JobTemplate != "") {
+		return fmt.Errorf("annotations pull, mounts and k8s-template require image")
+	}
+
+	if job.Host == "" && job.SSHKey != "" {
+		return fmt.Errorf("annotation key requires host")
+	}
+
+	if job.Host != "" && job.Image != "" {
+		return fmt.Errorf("annotation host can't be used with image")
+	}
+
+	if job.Image != "" && (job.Stdin != "" || job.StdinFile != "") {
+		return fmt.Errorf("annotation image can't be used with stdin (or a %% in the command)")
+	}
+
+	if job.WarnAfter != 0 && job.Timeout != 0 && job.WarnAfter >= job.Timeout {
+		return fmt.Errorf("annotation warn-after must be shorter than timeout")
+	}
+
+	if _, ok := job.Annotations["splay-stable"]; ok && job.Splay == 0 {
+		return fmt.Errorf("annotation splay-stable requires splay")
+	}
+
+	if _, once := job.RunsOnce(); once && job.Splay != 0 {
+		return fmt.Errorf("annotation splay can't be used with an @at or @once schedule")
+	}
+
+	if _, once := job.RunsOnce(); once && (job.Blackout != nil || job.OnBlackout != "") {
+		return fmt.Errorf("annotations blackout and on-blackout can't be used with an @at or @once schedule")
+	}
+
+	if _, once := job.RunsOnce(); once && job.SkipHolidays {
+		return fmt.Errorf("annotation skip-holidays can't be used with an @at or @once schedule")
+	}
+
+	if job.PauseFor != 0 && job.PauseAfterFailures == 0 {
+		return fmt.Errorf("annotation pause-for requires pause-after-failures")
+	}
+
+	if _, ok := job.Annotations["checkpoint-grace"]; ok && job.CheckpointSignal == 0 {
+		return fmt.Errorf("annotation checkpoint-grace requires checkpoint-signal")
+	}
+
+	if job.CheckpointSignal != 0 {
+		if job.Timeout == 0 {
+			return fmt.Errorf("annotation checkpoint-signal requires timeout")
+		}
+
+		if job.CheckpointGrace == 0 {
+			job.CheckpointGrace = DEFAULT_CHECKPOINT_GRACE
+			if job.CheckpointGrace > job.Timeout/2 {
+				job.CheckpointGrace = job.Timeout / 2
+			}
+		} else if job.CheckpointGrace >= job.Timeout {
+			return fmt.Errorf("annotation checkpoint-grace must be shorter than timeout")
+		}
+	}
+
+	return nil
+}
+
+// retryPolicy returns the job's retry policy, creating it if necessary.
+func (job *Job) retryPolicy() *RetryPolicy {
+	if job.Retry == nil {
+		job.Retry = &RetryPolicy{Delay: DEFAULT_RETRY_DELAY}
+	}
+	return job.Retry
+}
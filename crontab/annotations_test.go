@@ -0,0 +1,473 @@
+package crontab
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var parseAnnotationTestCases = []struct {
+	text     string
+	expected []annotation
+}{
+	{"", []annotation{}},
+	{"  ", []annotation{}},
+	{"foo=bar", []annotation{{"foo", "bar", true}}},
+	{" foo=bar  baz=qux ", []annotation{{"foo", "bar", true}, {"baz", "qux", true}}},
+	{"foo", []annotation{{"foo", "true", false}}},
+	{"foo= bar", []annotation{{"foo", "", true}, {"bar", "true", false}}},
+	{`foo="a b" bar='c "d"'`, []annotation{{"foo", "a b", true}, {"bar", `c "d"`, true}}},
+	{`foo=""`, []annotation{{"foo", "", true}}},
+	{"foo=a=b", []annotation{{"foo", "a=b", true}}},
+
+	// Failure cases
+	{"=bar", nil},
+	{`foo="bar`, nil},
+	{`foo="bar"baz`, nil},
+}
+
+func TestParseAnnotation(t *testing.T) {
+	for _, tt := range parseAnnotationTestCases {
+		label := fmt.Sprintf("parseAnnotation(%q)", tt.text)
+
+		annotations, err := parseAnnotation(tt.text)
+
+		if tt.expected == nil {
+			assert.NotNil(t, err, label)
+		} else {
+			assert.Nil(t, err, label)
+			assert.Equal(t, tt.expected, annotations, label)
+		}
+	}
+}
+
+func levelPtr(level Level) *Level {
+	return &level
+}
+
+func boolPtr(value bool) *bool {
+	return &value
+}
+
+var umask027 = 027
+
+var annotatedCrontabTestCases = []struct {
+	crontab  string
+	expected []Job
+}{
+	{
+		"# cronic: path-prepend=/opt/app/bin\n* * * * * foo\n* * * * * bar",
+		[]Job{
+			{Annotations: map[string]string{"path-prepend": "/opt/app/bin"}, PathPrepend: "/opt/app/bin"},
+			{},
+		},
+	},
+	{
+		"#cronic:path-prepend=/opt/app/bin\n# Some comment\nFOO=bar\n* * * * * foo",
+		[]Job{
+			{Annotations: map[string]string{"path-prepend": "/opt/app/bin"}, PathPrepend: "/opt/app/bin"},
+		},
+	},
+	{
+		"# cronic: stdout-level=debug stderr-level=warn\n# cronic: quiet\n* * * * * foo\n# cronic: quiet=false\n* * * * * bar",
+		[]Job{
+			{
+				Annotations: map[string]string{"stdout-level": "debug", "stderr-level": "warn", "quiet": "true"},
+				StdoutLevel: levelPtr(LevelDebug),
+				StderrLevel: levelPtr(LevelWarn),
+				Quiet:       true,
+			},
+			{Annotations: map[string]string{"quiet": "false"}},
+		},
+	},
+
+	{
+		"# cronic: webhook-url=https://hooks.example.com/cronic webhook-events=failure,timeout\n* * * * * foo",
+		[]Job{
+			{
+				Annotations:   map[string]string{"webhook-url": "https://hooks.example.com/cronic", "webhook-events": "failure,timeout"},
+				WebhookURL:    "https://hooks.example.com/cronic",
+				WebhookEvents: []EventType{EventFailure, EventTimeout},
+			},
+		},
+	},
+
+	{
+		"# cronic: namespace=billing\n* * * * * foo",
+		[]Job{
+			{Annotations: map[string]string{"namespace": "billing"}, Namespace: "billing"},
+		},
+	},
+
+	{
+		"# cronic: slack-channel=#billing-alerts\n* * * * * foo",
+		[]Job{
+			{Annotations: map[string]string{"slack-channel": "#billing-alerts"}, SlackChannel: "#billing-alerts"},
+		},
+	},
+
+	{
+		"# cronic: syslog-facility=local3 syslog-tag=billing\n* * * * * foo",
+		[]Job{
+			{Annotations: map[string]string{"syslog-facility": "local3", "syslog-tag": "billing"}, SyslogFacility: "local3", SyslogTag: "billing"},
+		},
+	},
+
+	{
+		"# cronic: retries=3 retry-on=timeout,75 retry-never=2\n* * * * * foo\n# cronic: retries=1 retry-delay=1m\n* * * * * bar",
+		[]Job{
+			{
+				Annotations: map[string]string{"retries": "3", "retry-on": "timeout,75", "retry-never": "2"},
+				Retry:       &RetryPolicy{Retries: 3, Delay: DEFAULT_RETRY_DELAY, On: []string{FailureTimeout, "75"}, Never: []string{"2"}},
+			},
+			{
+				Annotations: map[string]string{"retries": "1", "retry-delay": "1m"},
+				Retry:       &RetryPolicy{Retries: 1, Delay: time.Minute},
+			},
+		},
+	},
+
+	{
+		"# cronic: lock=apt.dnf\n* * * * * foo",
+		[]Job{
+			{Annotations: map[string]string{"lock": "apt.dnf"}, Lock: "apt.dnf"},
+		},
+	},
+
+	{
+		"# cronic: timeout=90m\n* * * * * foo",
+		[]Job{
+			{Annotations: map[string]string{"timeout": "90m"}, Timeout: 90 * time.Minute},
+		},
+	},
+
+	{
+		"# cronic: on-spawn-failure=pause\n* * * * * foo",
+		[]Job{
+			{Annotations: map[string]string{"on-spawn-failure": "pause"}, OnSpawnFailure: SpawnFailurePause},
+		},
+	},
+
+	{
+		"# cronic: shell=/bin/bash\n* * * * * foo",
+		[]Job{
+			{Annotations: map[string]string{"shell": "/bin/bash"}, Shell: "/bin/bash"},
+		},
+	},
+
+	{
+		"# cronic: expect-output='Backed up' expect-output-match='^[0-9]+ rows$'\n* * * * * foo",
+		[]Job{
+			{
+				Annotations:       map[string]string{"expect-output": "Backed up", "expect-output-match": "^[0-9]+ rows$"},
+				ExpectOutput:      "Backed up",
+				ExpectOutputMatch: regexp.MustCompile("^[0-9]+ rows$"),
+			},
+		},
+	},
+
+	{
+		"# cronic: timeout=1h checkpoint-signal=USR1 checkpoint-grace=5m\n* * * * * foo\n# cronic: timeout=1m checkpoint-signal=SIGHUP\n* * * * * bar",
+		[]Job{
+			{
+				Annotations:      map[string]string{"timeout": "1h", "checkpoint-signal": "USR1", "checkpoint-grace": "5m"},
+				Timeout:          time.Hour,
+				CheckpointSignal: syscall.SIGUSR1,
+				CheckpointGrace:  5 * time.Minute,
+			},
+			{
+				Annotations:      map[string]string{"timeout": "1m", "checkpoint-signal": "SIGHUP"},
+				Timeout:          time.Minute,
+				CheckpointSignal: syscall.SIGHUP,
+				CheckpointGrace:  30 * time.Second,
+			},
+		},
+	},
+
+	{
+		"# cronic: interval-from=end\n@every 10m foo\n# cronic: interval-from=start\n@every 10m bar",
+		[]Job{
+			{Annotations: map[string]string{"interval-from": "end"}, IntervalFromEnd: true},
+			{Annotations: map[string]string{"interval-from": "start"}},
+		},
+	},
+
+	{
+		"# cronic: output-rate-limit=500\n* * * * * foo",
+		[]Job{
+			{Annotations: map[string]string{"output-rate-limit": "500"}, OutputRateLimit: 500},
+		},
+	},
+
+	{
+		"# cronic: log-rate-limit=100 log-burst=500 log-sample=10\n* * * * * foo",
+		[]Job{
+			{Annotations: map[string]string{"log-rate-limit": "100", "log-burst": "500", "log-sample": "10"}, LogRateLimit: 100, LogBurst: 500, LogSample: 10},
+		},
+	},
+
+	{
+		"# cronic: memory-limit=512M cpu-limit=1.5 nofile=1024\n* * * * * foo",
+		[]Job{
+			{
+				Annotations: map[string]string{"memory-limit": "512M", "cpu-limit": "1.5", "nofile": "1024"},
+				MemoryLimit: 512 << 20,
+				CPULimit:    1.5,
+				NoFile:      1024,
+			},
+		},
+	},
+
+	{
+		"# cronic: nice=10 ionice=best-effort:7\n* * * * * foo",
+		[]Job{
+			{
+				Annotations: map[string]string{"nice": "10", "ionice": "best-effort:7"},
+				Nice:        10,
+				IOClass:     IOClassBestEffort,
+				IOLevel:     7,
+			},
+		},
+	},
+	{
+		"# cronic: ionice=idle\n* * * * * foo",
+		[]Job{
+			{Annotations: map[string]string{"ionice": "idle"}, IOClass: IOClassIdle},
+		},
+	},
+
+	{
+		"# cronic: image=alpine:3.20 pull=always mounts=/srv/data:/data:ro,/tmp:/tmp\n* * * * * foo",
+		[]Job{
+			{
+				Annotations: map[string]string{"image": "alpine:3.20", "pull": "always", "mounts": "/srv/data:/data:ro,/tmp:/tmp"},
+				Image:       "alpine:3.20",
+				ImagePull:   PullAlways,
+				Mounts:      []string{"/srv/data:/data:ro", "/tmp:/tmp"},
+			},
+		},
+	},
+	{
+		"# cronic: image=python:3.12 k8s-template=./jobs/gpu.yaml\n* * * * * foo",
+		[]Job{
+			{
+				Annotations: map[string]string{"image": "python:3.12", "k8s-template": "./jobs/gpu.yaml"},
+				Image:       "python:3.12",
+				JobTemplate: "./jobs/gpu.yaml",
+			},
+		},
+	},
+	{
+		"# cronic: host=backup@db1:2222 key=/keys/id_ed25519\n* * * * * foo",
+		[]Job{
+			{
+				Annotations: map[string]string{"host": "backup@db1:2222", "key": "/keys/id_ed25519"},
+				Host:        "backup@db1:2222",
+				SSHKey:      "/keys/id_ed25519",
+			},
+		},
+	},
+
+	{
+		"# cronic: umask=027 env-allow=PATH,HOME,APP_* env-deny=AWS_*\n* * * * * foo",
+		[]Job{
+			{
+				Annotations: map[string]string{"umask": "027", "env-allow": "PATH,HOME,APP_*", "env-deny": "AWS_*"},
+				Umask:       &umask027,
+				EnvAllow:    []string{"PATH", "HOME", "APP_*"},
+				EnvDeny:     []string{"AWS_*"},
+			},
+		},
+	},
+
+	{
+		"# cronic: json-output\n* * * * * foo\n# cronic: json-output=false\n* * * * * bar",
+		[]Job{
+			{Annotations: map[string]string{"json-output": "true"}, JSONOutput: boolPtr(true)},
+			{Annotations: map[string]string{"json-output": "false"}, JSONOutput: boolPtr(false)},
+		},
+	},
+
+	{
+		"# cronic: stdin=/etc/cronic/answers\n* * * * * foo\n# cronic: stdin=/dev/null\n* * * * * bar",
+		[]Job{
+			{Annotations: map[string]string{"stdin": "/etc/cronic/answers"}, StdinFile: "/etc/cronic/answers"},
+			{Annotations: map[string]string{"stdin": "/dev/null"}, StdinFile: "/dev/null"},
+		},
+	},
+
+	{
+		"# cronic: max-output=1MB\n* * * * * foo",
+		[]Job{
+			{Annotations: map[string]string{"max-output": "1MB"}, MaxOutput: 1 << 20},
+		},
+	},
+
+	{
+		"# cronic: on-failure=/scripts/alert.sh on-success=\"/scripts/ok.sh --quiet\"\n* * * * * foo",
+		[]Job{
+			{
+				Annotations: map[string]string{"on-failure": "/scripts/alert.sh", "on-success": "/scripts/ok.sh --quiet"},
+				OnSuccess:   "/scripts/ok.sh --quiet",
+				OnFailure:   "/scripts/alert.sh",
+			},
+		},
+	},
+
+	{
+		"# cronic: timeout=2h warn-after=30m\n* * * * * foo\n# cronic: warn-after=1h\n* * * * * bar",
+		[]Job{
+			{Annotations: map[string]string{"timeout": "2h", "warn-after": "30m"}, Timeout: 2 * time.Hour, WarnAfter: 30 * time.Minute},
+			{Annotations: map[string]string{"warn-after": "1h"}, WarnAfter: time.Hour},
+		},
+	},
+
+	{
+		"# cronic: splay=10m\n0 * * * * foo\n# cronic: splay=5m splay-stable\n0 * * * * bar",
+		[]Job{
+			{Annotations: map[string]string{"splay": "10m"}, Splay: 10 * time.Minute},
+			{Annotations: map[string]string{"splay": "5m", "splay-stable": "true"}, Splay: 5 * time.Minute, SplayStable: true},
+		},
+	},
+
+	{
+		"# cronic: if-env=ROLE=worker unless-env=DISABLE_REPORTS\n* * * * * foo\n# cronic: if-env=REPORTS= \n* * * * * bar",
+		[]Job{
+			{
+				Annotations: map[string]string{"if-env": "ROLE=worker", "unless-env": "DISABLE_REPORTS"},
+				IfEnv:       &EnvCondition{Name: "ROLE", Value: "worker", HasValue: true},
+				UnlessEnv:   &EnvCondition{Name: "DISABLE_REPORTS"},
+			},
+			{Annotations: map[string]string{"if-env": "REPORTS="}, IfEnv: &EnvCondition{Name: "REPORTS", HasValue: true}},
+		},
+	},
+
+	{
+		"# cronic: skip-holidays\n0 18 * * 1-5 ./settle.sh",
+		[]Job{{Annotations: map[string]string{"skip-holidays": "true"}, SkipHolidays: true}},
+	},
+
+	{
+		"# cronic: pause-after-failures=3 pause-for=1h\n* * * * * foo\n# cronic: pause-after-failures=5\n* * * * * bar",
+		[]Job{
+			{Annotations: map[string]string{"pause-after-failures": "3", "pause-for": "1h"}, PauseAfterFailures: 3, PauseFor: time.Hour},
+			{Annotations: map[string]string{"pause-after-failures": "5"}, PauseAfterFailures: 5},
+		},
+	},
+
+	// Failure cases
+	{"# cronic: max-output=0\n* * * * * foo", nil},
+	{"# cronic: json-output=maybe\n* * * * * foo", nil},
+	{"# cronic: nice=20\n* * * * * foo", nil},
+	{"# cronic: umask=0999\n* * * * * foo", nil},
+	{"# cronic: pull=always\n* * * * * foo", nil},
+	{"# cronic: k8s-template=./job.yaml\n* * * * * foo", nil},
+	{"# cronic: image=alpine pull=sometimes\n* * * * * foo", nil},
+	{"# cronic: image=alpine mounts=data:/data\n* * * * * foo", nil},
+	{"# cronic: image=alpine mounts=/data:/data:rx\n* * * * * foo", nil},
+	{"# cronic: image=alpine\n* * * * * mail -s hi root%hello", nil},
+	{"# cronic: image=alpine stdin=./input\n* * * * * foo", nil},
+	{"# cronic: key=/keys/id_ed25519\n* * * * * foo", nil},
+	{"# cronic: host=-oProxyCommand=sh\n* * * * * foo", nil},
+	{"# cronic: host=db1 image=alpine\n* * * * * foo", nil},
+	{"# cronic: umask=01777\n* * * * * foo", nil},
+	{"# cronic: env-deny=AWS_*_KEY\n* * * * * foo", nil},
+	{"# cronic: env-allow=PATH,,HOME\n* * * * * foo", nil},
+	{"# cronic: ionice=slow\n* * * * * foo", nil},
+	{"# cronic: ionice=idle:3\n* * * * * foo", nil},
+	{"# cronic: ionice=realtime:8\n* * * * * foo", nil},
+	{"# cronic: memory-limit=0\n* * * * * foo", nil},
+	{"# cronic: memory-limit=lots\n* * * * * foo", nil},
+	{"# cronic: cpu-limit=0\n* * * * * foo", nil},
+	{"# cronic: cpu-limit=NaN\n* * * * * foo", nil},
+	{"# cronic: nofile=-1\n* * * * * foo", nil},
+	{"# cronic: output-rate-limit=0\n* * * * * foo", nil},
+	{"# cronic: output-rate-limit=fast\n* * * * * foo", nil},
+	{"# cronic: log-rate-limit=0\n* * * * * foo", nil},
+	{"# cronic: log-burst=lots\n* * * * * foo", nil},
+	{"# cronic: log-sample\n* * * * * foo", nil},
+	{"# cronic: interval-from=end\n* * * * * foo", nil},
+	{"# cronic: interval-from=middle\n@every 10m foo", nil},
+	{"# cronic: checkpoint-signal=USR1\n* * * * * foo", nil},
+	{"# cronic: timeout=1h checkpoint-signal=LOUD\n* * * * * foo", nil},
+	{"# cronic: timeout=1h checkpoint-grace=5m\n* * * * * foo", nil},
+	{"# cronic: timeout=1h checkpoint-signal=USR1 checkpoint-grace=2h\n* * * * * foo", nil},
+	{"# cronic: expect-output\n* * * * * foo", nil},
+	{"# cronic: expect-output-match=(\n* * * * * foo", nil},
+	{"# cronic: shell\n* * * * * foo", nil},
+	{"# cronic: stdin\n* * * * * foo", nil},
+	{"# cronic: stdin=/etc/cronic/answers\n* * * * * foo%bar", nil},
+	{"# cronic: on-spawn-failure=explode\n* * * * * foo", nil},
+	{"# cronic: on-spawn-failure\n* * * * * foo", nil},
+	{"# cronic: timeout=0s\n* * * * * foo", nil},
+	{"# cronic: warn-after=0s\n* * * * * foo", nil},
+	{"# cronic: warn-after=soon\n* * * * * foo", nil},
+	{"# cronic: timeout=1h warn-after=1h\n* * * * * foo", nil},
+	{"# cronic: timeout=forever\n* * * * * foo", nil},
+	{"# cronic: splay=0s\n* * * * * foo", nil},
+	{"# cronic: if-env\n* * * * * foo", nil},
+	{"# cronic: skip-holidays=sometimes\n* * * * * foo", nil},
+	{"# cronic: skip-holidays\n@once foo", nil},
+	{"# cronic: blackout=Sat\n* * * * * foo", nil},
+	{"# cronic: on-blackout=later\n* * * * * foo", nil},
+	{"# cronic: blackout=\"Sat 00:00-04:00\"\n@once foo", nil},
+	{"# cronic: if-env==worker\n* * * * * foo", nil},
+	{"# cronic: unless-env=1ROLE\n* * * * * foo", nil},
+	{"# cronic: splay-stable\n* * * * * foo", nil},
+	{"# cronic: splay=5m\n@once foo", nil},
+	{"# cronic: lock=../etc/passwd\n* * * * * foo", nil},
+	{"# cronic: lock=..\n* * * * * foo", nil},
+	{"# cronic: retries=-1\n* * * * * foo", nil},
+	{"# cronic: pause-after-failures=0\n* * * * * foo", nil},
+	{"# cronic: pause-after-failures=3 pause-for=later\n* * * * * foo", nil},
+	{"# cronic: pause-for=1h\n* * * * * foo", nil},
+	{"# cronic: retries=1 retry-delay=soon\n* * * * * foo", nil},
+	{"# cronic: retries=1 retry-on=explosion\n* * * * * foo", nil},
+	{"# cronic: retry-on=75\n* * * * * foo", nil},
+	{"# cronic: slack-channel\n* * * * * foo", nil},
+	{"# cronic: syslog-facility=local8\n* * * * * foo", nil},
+	{"# cronic: syslog-tag=\n* * * * * foo", nil},
+	{"# cronic: namespace\n* * * * * foo", nil},
+	{"# cronic: on-success\n* * * * * foo", nil},
+	{"# cronic: on-failure=\n* * * * * foo", nil},
+	{"# cronic: webhook-url=/no/host\n* * * * * foo", nil},
+	{"# cronic: webhook-url=ftp://example.com\n* * * * * foo", nil},
+	{"# cronic: webhook-events=failure,explosion\n* * * * * foo", nil},
+	{"# cronic: stdout-level=loud\n* * * * * foo", nil},
+	{"# cronic: stderr-level=fatal\n* * * * * foo", nil},
+	{"# cronic: quiet=maybe\n* * * * * foo", nil},
+	{"# cronic: path-prepend\n* * * * * foo", nil},
+	{"# cronic: path-prepend=a path-prepend=b\n* * * * * foo", nil},
+	{"# cronic: no-such-thing\n* * * * * foo", nil},
+	{"* * * * * foo\n# cronic: path-prepend=/opt/app/bin", nil},
+}
+
+func TestParseCrontabAppliesAnnotations(t *testing.T) {
+	for _, tt := range annotatedCrontabTestCases {
+		label := fmt.Sprintf("ParseCrontab(%q)", tt.crontab)
+
+		crontab, err := ParseCrontab(bytes.NewBufferString(tt.crontab))
+
+		if tt.expected == nil {
+			assert.Nil(t, crontab, label)
+			assert.NotNil(t, err, label)
+			continue
+		}
+
+		if assert.Nil(t, err, label) && assert.Equal(t, len(tt.expected), len(crontab.Jobs), label) {
+			for i, job := range crontab.Jobs {
+				// Only compare the fields set by annotations
+				expected := tt.expected[i]
+				expected.CrontabLine = job.CrontabLine
+				expected.Position = job.Position
+				expected.Line = job.Line
+				assert.Equal(t, expected, *job, label)
+			}
+		}
+	}
+}
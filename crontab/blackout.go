@@ -0,0 +1,172 @@
+package crontab
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// What happens to the scheduled runs of a job that fall in a blackout
+const (
+	// They're skipped
+	BlackoutSkip = "skip"
+
+	// They wait for the blackout to end (those that fall in the same
+	// blackout run once, when it ends)
+	BlackoutDefer = "defer"
+)
+
+var (
+	// e.g. "Sat 00:00-04:00", "Mon-Fri 22:00-06:00", or "12:00-13:00"
+	blackoutWindowMatcher = regexp.MustCompile(`^(?:([A-Za-z]{3})(?:-([A-Za-z]{3}))?\s+)?(\d{1,2}):(\d{2})-(\d{1,2}):(\d{2})$`)
+
+	weekdays = map[string]time.Weekday{
+		"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+		"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+	}
+)
+
+// Blackout is a list of weekly windows of (local) time during which jobs
+// don't run, e.g. for deploy freezes and database maintenance.
+type Blackout []*BlackoutWindow
+
+// BlackoutWindow is a window of time, on some days of the week (or every
+// day). Windows that end before they start end the next day.
+type BlackoutWindow struct {
+	// The days the window starts on (every day if none is set)
+	Days [7]bool
+
+	// When it starts and ends, as a time of day (End may be 24h)
+	Start time.Duration
+	End   time.Duration
+
+	text string
+}
+
+// ParseBlackout parses a comma-separated list of windows, each written as
+// "[DAY[-DAY] ]HH:MM-HH:MM", with days abbreviated to 3 letters (e.g. "Sat
+// 00:00-04:00,Mon-Fri 12:00-13:00").
+func ParseBlackout(value string) (Blackout, error) {
+	blackout := make(Blackout, 0)
+
+	for _, text := range strings.Split(value, ",") {
+		text = strings.TrimSpace(text)
+
+		m := blackoutWindowMatcher.FindStringSubmatch(text)
+		if m == nil {
+			return nil, fmt.Errorf("bad blackout window %q (expected e.g. Sat 00:00-04:00)", text)
+		}
+
+		window := &BlackoutWindow{text: text}
+
+		if m[1] != "" {
+			first, ok := weekdays[strings.ToLower(m[1])]
+			if !ok {
+				return nil, fmt.Errorf("bad day %q in blackout window %q", m[1], text)
+			}
+
+			last := first
+			if m[2] != "" {
+				if last, ok = weekdays[strings.ToLower(m[2])]; !ok {
+					return nil, fmt.Errorf("bad day %q in blackout window %q", m[2], text)
+				}
+			}
+
+			// Ranges may wrap around the end of the week (e.g. Fri-Mon)
+			for day := first; ; day = (day + 1) % 7 {
+				window.Days[day] = true
+				if day == last {
+					break
+				}
+			}
+		}
+
+		var err error
+		if window.Start, err = parseTimeOfDay(m[3], m[4]); err != nil {
+			return nil, fmt.Errorf("%v in blackout window %q", err, text)
+		}
+		if window.End, err = parseTimeOfDay(m[5], m[6]); err != nil {
+			return nil, fmt.Errorf("%v in blackout window %q", err, text)
+		}
+
+		if window.Start == window.End || window.Start == 24*time.Hour {
+			return nil, fmt.Errorf("empty blackout window %q", text)
+		}
+
+		blackout = append(blackout, window)
+	}
+
+	return blackout, nil
+}
+
+func parseTimeOfDay(hours string, minutes string) (time.Duration, error) {
+	h, _ := strconv.Atoi(hours)
+	m, _ := strconv.Atoi(minutes)
+
+	if m > 59 || h > 24 || h == 24 && m > 0 {
+		return 0, fmt.Errorf("bad time %s:%s", hours, minutes)
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
+
+// Contains reports whether t falls in one of the blackout's windows, and if
+// so when that window ends (the window might be followed by another one).
+func (b Blackout) Contains(t time.Time) (time.Time, bool) {
+	var end time.Time
+	for _, window := range b {
+		if windowEnd, ok := window.contains(t); ok && windowEnd.After(end) {
+			end = windowEnd
+		}
+	}
+	return end, !end.IsZero()
+}
+
+func (w *BlackoutWindow) contains(t time.Time) (time.Time, bool) {
+	// The window may have started today, or yesterday if it ends the day
+	// after it starts
+	for _, daysAgo := range []int{0, 1} {
+		day := t.AddDate(0, 0, -daysAgo)
+		if w.daily() || w.Days[day.Weekday()] {
+			start := timeOfDay(day, w.Start)
+
+			end := timeOfDay(day, w.End)
+			if w.End <= w.Start {
+				end = timeOfDay(day.AddDate(0, 0, 1), w.End)
+			}
+
+			if !t.Before(start) && t.Before(end) {
+				return end, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+func (w *BlackoutWindow) daily() bool {
+	return w.Days == [7]bool{}
+}
+
+// timeOfDay returns the time of day on the day of t, in its location (so
+// that, around daylight saving time transitions, it's still the time on the
+// clock).
+func timeOfDay(t time.Time, offset time.Duration) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, int(offset/time.Minute), 0, 0, t.Location())
+}
+
+func (b Blackout) String() string {
+	windows := make([]string, 0, len(b))
+	for _, window := range b {
+		windows = append(windows, window.text)
+	}
+	return strings.Join(windows, ",")
+}
+
+// ParseBlackoutPolicy checks that policy is BlackoutSkip or BlackoutDefer.
+func ParseBlackoutPolicy(policy string) (string, error) {
+	if policy != BlackoutSkip && policy != BlackoutDefer {
+		return "", fmt.Errorf("unknown blackout policy %q (expected %s or %s)", policy, BlackoutSkip, BlackoutDefer)
+	}
+	return policy, nil
+}
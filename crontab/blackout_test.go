@@ -0,0 +1,78 @@
+package crontab
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 2018-04-07 is a Saturday
+var blackoutTestCases = []struct {
+	blackout string
+	time     string
+	end      string
+}{
+	{"Sat 00:00-04:00", "2018-04-07 00:00", "2018-04-07 04:00"},
+	{"Sat 00:00-04:00", "2018-04-07 03:59", "2018-04-07 04:00"},
+	{"Sat 00:00-04:00", "2018-04-07 04:00", ""},
+	{"Sat 00:00-04:00", "2018-04-06 23:59", ""},
+	{"Sat 00:00-04:00", "2018-04-14 01:00", "2018-04-14 04:00"},
+	{"sun 00:00-04:00", "2018-04-07 01:00", ""},
+
+	// Windows that end before they start end the next day
+	{"Fri 22:00-02:00", "2018-04-07 01:00", "2018-04-07 02:00"},
+	{"Fri 22:00-02:00", "2018-04-06 23:00", "2018-04-07 02:00"},
+	{"Sat 22:00-02:00", "2018-04-07 01:00", ""},
+
+	// Day ranges, which may wrap around the week
+	{"Mon-Fri 12:00-13:00", "2018-04-06 12:30", "2018-04-06 13:00"},
+	{"Mon-Fri 12:00-13:00", "2018-04-07 12:30", ""},
+	{"Fri-Mon 12:00-13:00", "2018-04-08 12:30", "2018-04-08 13:00"},
+	{"Fri-Mon 12:00-13:00", "2018-04-04 12:30", ""},
+
+	// Windows without days are daily
+	{"12:00-13:00", "2018-04-04 12:30", "2018-04-04 13:00"},
+	{"23:00-24:00", "2018-04-04 23:30", "2018-04-05 00:00"},
+
+	// The latest end of the windows a time falls in
+	{"Sat 00:00-04:00,Sat 02:00-06:00", "2018-04-07 03:00", "2018-04-07 06:00"},
+	{"Sat 00:00-04:00, Sun 00:00-04:00", "2018-04-08 03:00", "2018-04-08 04:00"},
+}
+
+func TestBlackoutContains(t *testing.T) {
+	parse := func(value string) time.Time {
+		parsed, err := time.ParseInLocation("2006-01-02 15:04", value, time.Local)
+		assert.Nil(t, err)
+		return parsed
+	}
+
+	for _, tt := range blackoutTestCases {
+		blackout, err := ParseBlackout(tt.blackout)
+		if !assert.Nil(t, err, tt.blackout) {
+			continue
+		}
+
+		end, ok := blackout.Contains(parse(tt.time))
+		if tt.end == "" {
+			assert.False(t, ok, "%s at %s", tt.blackout, tt.time)
+		} else if assert.True(t, ok, "%s at %s", tt.blackout, tt.time) {
+			assert.Equal(t, parse(tt.end), end, "%s at %s", tt.blackout, tt.time)
+		}
+	}
+}
+
+func TestParseBlackout(t *testing.T) {
+	blackout, err := ParseBlackout("Sat 00:00-04:00, Mon-Fri 9:30-10:00")
+	if assert.Nil(t, err) && assert.Len(t, blackout, 2) {
+		assert.Equal(t, 9*time.Hour+30*time.Minute, blackout[1].Start)
+		assert.True(t, blackout[1].Days[time.Wednesday])
+		assert.False(t, blackout[1].Days[time.Sunday])
+		assert.Equal(t, "Sat 00:00-04:00,Mon-Fri 9:30-10:00", blackout.String())
+	}
+
+	for _, bad := range []string{"", "Sat", "Sat 00:00", "Someday 00:00-04:00", "Sat-Xyz 00:00-04:00", "Sat 25:00-04:00", "Sat 00:60-04:00", "Sat 24:30-04:00", "Sat 04:00-04:00", "Sat 24:00-04:00", "Sat 00:00-04:00,"} {
+		_, err := ParseBlackout(bad)
+		assert.NotNil(t, err, bad)
+	}
+}
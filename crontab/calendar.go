@@ -0,0 +1,130 @@
+package crontab
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// e.g. "@dates 2018-04-07,2018-05-07T09:30 command", or
+	// "@dates-file /path/to/dates command"
+	calendarLineMatcher = regexp.MustCompile(`^(@dates(-file)?\s+(\S+))\s+(\S.*)$`)
+
+	calendarLayouts = []string{
+		"2006-01-02",
+		"2006-01-02T15:04",
+		"2006-01-02T15:04:05",
+		time.RFC3339,
+	}
+)
+
+// calendarExpression runs a job at an explicit list of times.
+type calendarExpression struct {
+	times []time.Time
+}
+
+// Next returns the first time after fromTime, or the zero time if there are
+// none left.
+func (c *calendarExpression) Next(fromTime time.Time) time.Time {
+	i := sort.Search(len(c.times), func(i int) bool { return c.times[i].After(fromTime) })
+	if i == len(c.times) {
+		return time.Time{}
+	}
+	return c.times[i]
+}
+
+// parseCalendarLine parses a job line whose schedule is a list of dates. It
+// returns nil if the line has another kind of schedule.
+func parseCalendarLine(line string) (*CrontabLine, error) {
+	matches := calendarLineMatcher.FindStringSubmatch(line)
+	if matches == nil {
+		return nil, nil
+	}
+
+	var (
+		dates []string
+		err   error
+	)
+
+	if matches[2] == "" {
+		dates = strings.Split(matches[3], ",")
+	} else {
+		dates, err = readCalendarFile(matches[3])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	expr, err := parseCalendar(dates)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CrontabLine{
+		Expression: expr,
+		Schedule:   matches[1],
+		Command:    matches[4],
+	}, nil
+}
+
+func parseCalendar(dates []string) (*calendarExpression, error) {
+	times := make([]time.Time, 0, len(dates))
+
+	for _, date := range dates {
+		t, err := ParseDate(strings.TrimSpace(date))
+		if err != nil {
+			return nil, err
+		}
+		times = append(times, t)
+	}
+
+	if len(times) == 0 {
+		return nil, fmt.Errorf("no dates")
+	}
+
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+
+	return &calendarExpression{times: times}, nil
+}
+
+// ParseDate parses a date (at midnight), or a date and time, in the
+// local timezone unless specified.
+func ParseDate(date string) (time.Time, error) {
+	for _, layout := range calendarLayouts {
+		if t, err := time.ParseInLocation(layout, date, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("bad date: %q (expected e.g. 2018-04-07 or 2018-04-07T09:30)", date)
+}
+
+// readCalendarFile reads dates from a file with one date per line. Empty lines
+// and comments are ignored.
+func readCalendarFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	dates := make([]string, 0)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			dates = append(dates, line)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return dates, nil
+}
@@ -0,0 +1,106 @@
+package crontab
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func localTime(year int, month time.Month, day int, hour int, min int) time.Time {
+	return time.Date(year, month, day, hour, min, 0, 0, time.Local)
+}
+
+var calendarTestCases = []struct {
+	line     string
+	schedule string
+	command  string
+	times    []time.Time
+}{
+	{
+		"@dates 2018-05-07T09:30,2018-04-07 echo hi",
+		"@dates 2018-05-07T09:30,2018-04-07",
+		"echo hi",
+		[]time.Time{localTime(2018, 4, 7, 0, 0), localTime(2018, 5, 7, 9, 30)},
+	},
+	{
+		"@dates   2018-04-07T09:30:15   echo  hi",
+		"@dates   2018-04-07T09:30:15",
+		"echo  hi",
+		[]time.Time{localTime(2018, 4, 7, 9, 30).Add(15 * time.Second)},
+	},
+	{
+		"@dates 2018-04-07T09:30:00Z echo hi",
+		"@dates 2018-04-07T09:30:00Z",
+		"echo hi",
+		[]time.Time{time.Date(2018, 4, 7, 9, 30, 0, 0, time.UTC)},
+	},
+
+	// Failure cases
+	{"@dates 2018-04-31 echo hi", "", "", nil},
+	{"@dates 2018-04-07,tomorrow echo hi", "", "", nil},
+	{"@dates 2018-04-07,,2018-04-08 echo hi", "", "", nil},
+	{"@dates-file /nonexistent echo hi", "", "", nil},
+}
+
+func TestParseCalendarLine(t *testing.T) {
+	for _, tt := range calendarTestCases {
+		label := fmt.Sprintf("parseJobLine(%q)", tt.line)
+
+		line, err := parseJobLine(tt.line)
+
+		if tt.times == nil {
+			assert.Nil(t, line, label)
+			assert.NotNil(t, err, label)
+			continue
+		}
+
+		if assert.Nil(t, err, label) {
+			assert.Equal(t, tt.schedule, line.Schedule, label)
+			assert.Equal(t, tt.command, line.Command, label)
+
+			expr, ok := line.Expression.(*calendarExpression)
+			if assert.True(t, ok, label) {
+				assert.Equal(t, len(tt.times), len(expr.times), label)
+				for i := range tt.times {
+					assert.True(t, tt.times[i].Equal(expr.times[i]), label)
+				}
+			}
+		}
+	}
+}
+
+func TestCalendarNext(t *testing.T) {
+	expr, err := parseCalendar([]string{"2018-04-07", "2018-05-07T09:30"})
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	assert.Equal(t, localTime(2018, 4, 7, 0, 0), expr.Next(localTime(2018, 1, 1, 0, 0)))
+	assert.Equal(t, localTime(2018, 5, 7, 9, 30), expr.Next(localTime(2018, 4, 7, 0, 0)))
+	assert.True(t, expr.Next(localTime(2018, 5, 7, 9, 30)).IsZero())
+}
+
+func TestParseCrontabReadsCalendarFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cronic-test")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "billing-dates")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("# Billing runs\n2018-04-30\n\n  2018-05-31T06:00\n"), 0644))
+
+	tab, err := ParseCrontab(bytes.NewBufferString(fmt.Sprintf("@dates-file %s ./bill.sh\n", path)))
+	if assert.Nil(t, err) && assert.Equal(t, 1, len(tab.Jobs)) {
+		job := tab.Jobs[0]
+		assert.Equal(t, "./bill.sh", job.Command)
+		assert.Equal(t, localTime(2018, 4, 30, 0, 0), job.Expression.Next(localTime(2018, 4, 1, 0, 0)))
+		assert.Equal(t, localTime(2018, 5, 31, 6, 0), job.Expression.Next(localTime(2018, 4, 30, 0, 0)))
+	}
+}
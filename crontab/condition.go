@@ -0,0 +1,86 @@
+package crontab
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var envNameMatcher = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// EnvCondition is the condition of an if-env or unless-env annotation: that
+// a variable is set to Value or, without a Value, that it's set (and isn't
+// empty).
+type EnvCondition struct {
+	Name     string
+	Value    string
+	HasValue bool
+}
+
+// parseEnvCondition parses NAME, or NAME=VALUE.
+func parseEnvCondition(value string) (*EnvCondition, error) {
+	parts := strings.SplitN(value, "=", 2)
+	if !envNameMatcher.MatchString(parts[0]) {
+		return nil, fmt.Errorf("bad variable name %q", parts[0])
+	}
+
+	condition := &EnvCondition{Name: parts[0]}
+	if len(parts) == 2 {
+		condition.Value = parts[1]
+		condition.HasValue = true
+	}
+	return condition, nil
+}
+
+// Holds reports whether the condition holds in environ (or, for variables
+// it doesn't set, in cronic's environment).
+func (c *EnvCondition) Holds(environ map[string]string) bool {
+	value, ok := environ[c.Name]
+	if !ok {
+		value, ok = os.LookupEnv(c.Name)
+	}
+	if c.HasValue {
+		return ok && value == c.Value
+	}
+	return value != ""
+}
+
+func (c *EnvCondition) String() string {
+	if c.HasValue {
+		return c.Name + "=" + c.Value
+	}
+	return c.Name
+}
+
+// Enabled reports whether the job's if-env and unless-env conditions allow
+// it to run with environ (e.g. the crontab's variables).
+func (job *Job) Enabled(environ map[string]string) bool {
+	if job.IfEnv != nil && !job.IfEnv.Holds(environ) {
+		return false
+	}
+	return job.UnlessEnv == nil || !job.UnlessEnv.Holds(environ)
+}
+
+// RemoveDisabled removes the jobs that their if-env and unless-env
+// annotations disable (given the crontab's variables, and cronic's
+// environment) from tab, and returns them.
+func (tab *Crontab) RemoveDisabled() []*Job {
+	var environ map[string]string
+	if tab.Context != nil {
+		environ = tab.Context.Environ
+	}
+
+	enabled := make([]*Job, 0, len(tab.Jobs))
+	disabled := make([]*Job, 0)
+	for _, job := range tab.Jobs {
+		if job.Enabled(environ) {
+			enabled = append(enabled, job)
+		} else {
+			disabled = append(disabled, job)
+		}
+	}
+
+	tab.Jobs = enabled
+	return disabled
+}
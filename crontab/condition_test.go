@@ -0,0 +1,65 @@
+package crontab
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var envConditionTestCases = []struct {
+	condition string
+	environ   map[string]string
+	expected  bool
+}{
+	{"ROLE=worker", map[string]string{"ROLE": "worker"}, true},
+	{"ROLE=worker", map[string]string{"ROLE": "web"}, false},
+	{"ROLE=worker", map[string]string{}, false},
+	{"ROLE=", map[string]string{"ROLE": ""}, true},
+	{"ROLE=", map[string]string{}, false},
+	{"ROLE", map[string]string{"ROLE": "worker"}, true},
+	{"ROLE", map[string]string{"ROLE": ""}, false},
+	{"ROLE", map[string]string{}, false},
+
+	// Variables the crontab doesn't set are looked up in cronic's
+	// environment
+	{"CRONIC_TEST_ROLE=worker", map[string]string{}, true},
+	{"CRONIC_TEST_ROLE=worker", map[string]string{"CRONIC_TEST_ROLE": "web"}, false},
+}
+
+func TestEnvConditionHolds(t *testing.T) {
+	os.Setenv("CRONIC_TEST_ROLE", "worker")
+	defer os.Unsetenv("CRONIC_TEST_ROLE")
+
+	for _, tt := range envConditionTestCases {
+		condition, err := parseEnvCondition(tt.condition)
+		if assert.Nil(t, err, tt.condition) {
+			assert.Equal(t, tt.expected, condition.Holds(tt.environ), "%s with %v", tt.condition, tt.environ)
+			assert.Equal(t, tt.condition, condition.String())
+		}
+	}
+}
+
+func TestRemoveDisabled(t *testing.T) {
+	tab := &Crontab{
+		Context: &Context{Environ: map[string]string{"ROLE": "worker", "DISABLE_REPORTS": "1"}},
+		Jobs: []*Job{
+			{Name: "always"},
+			{Name: "worker", IfEnv: &EnvCondition{Name: "ROLE", Value: "worker", HasValue: true}},
+			{Name: "web", IfEnv: &EnvCondition{Name: "ROLE", Value: "web", HasValue: true}},
+			{Name: "report", UnlessEnv: &EnvCondition{Name: "DISABLE_REPORTS"}},
+		},
+	}
+
+	disabled := tab.RemoveDisabled()
+
+	names := func(jobs []*Job) []string {
+		result := make([]string, 0, len(jobs))
+		for _, job := range jobs {
+			result = append(result, job.Name)
+		}
+		return result
+	}
+	assert.Equal(t, []string{"always", "worker"}, names(tab.Jobs))
+	assert.Equal(t, []string{"web", "report"}, names(disabled))
+}
@@ -0,0 +1,221 @@
+package crontab
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// config is the structured alternative to crontabs (see ParseConfig).
+type config struct {
+	Shell string            `yaml:"shell"`
+	Env   map[string]string `yaml:"env"`
+	Jobs  []jobConfig       `yaml:"jobs"`
+}
+
+type jobConfig struct {
+	Name     string            `yaml:"name"`
+	Schedule string            `yaml:"schedule"`
+	Command  string            `yaml:"command"`
+	Env      map[string]string `yaml:"env"`
+	Dir      string            `yaml:"dir"`
+
+	// Fed to the command's stdin (in crontabs, what follows a %)
+	Stdin string `yaml:"stdin"`
+
+	// These are shorthands for the annotations of the same name
+	Shell             string             `yaml:"shell"`
+	StdinFile         string             `yaml:"stdin_file"`
+	Timeout           string             `yaml:"timeout"`
+	WarnAfter         string             `yaml:"warn_after"`
+	Namespace         string             `yaml:"namespace"`
+	Retries           *int               `yaml:"retries"`
+	RetryDelay        string             `yaml:"retry_delay"`
+	RetryOn           []string           `yaml:"retry_on"`
+	RetryNever        []string           `yaml:"retry_never"`
+	OnSpawnFailure    string             `yaml:"on_spawn_failure"`
+	ExpectOutput      string             `yaml:"expect_output"`
+	ExpectOutputMatch string             `yaml:"expect_output_match"`
+	Notifications     notificationConfig `yaml:"notifications"`
+
+	// Any other annotation
+	Annotations map[string]string `yaml:"annotations"`
+}
+
+type notificationConfig struct {
+	WebhookURL    string   `yaml:"webhook_url"`
+	WebhookEvents []string `yaml:"webhook_events"`
+	SlackChannel  string   `yaml:"slack_channel"`
+}
+
+// ParseConfig parses a configuration file like the zero Parser does.
+func ParseConfig(reader io.Reader) (*Crontab, error) {
+	return (&Parser{}).ParseConfig(reader)
+}
+
+// ParseConfig reads jobs from a YAML (or JSON) document, for jobs whose
+// settings would be unwieldy as annotations:
+//
+//	shell: /bin/bash
+//	env:
+//	  PATH: /usr/local/bin:/usr/bin:/bin
+//	jobs:
+//	  - name: backup-db
+//	    schedule: "0 3 * * *"
+//	    command: ./backup.sh
+//	    dir: /srv/db
+//	    stdin: |
+//	      SELECT pg_start_backup('cronic');
+//	    env:
+//	      PGHOST: db.internal
+//	    timeout: 1h
+//	    retries: 2
+//	    retry_on: [timeout, 75]
+//	    notifications:
+//	      slack_channel: "#db-alerts"
+//
+// The jobs are the same as those of a crontab, so settings are validated the
+// same way.
+func (p *Parser) ParseConfig(reader io.Reader) (*Crontab, error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	var c config
+	if err := yaml.UnmarshalStrict(data, &c); err != nil {
+		return nil, fmt.Errorf("CRONIC: Bad configuration: %v", err)
+	}
+
+	environ := c.Env
+	if environ == nil {
+		environ = make(map[string]string)
+	}
+
+	// Like in a crontab, SHELL (if "shell" isn't set) and HOME apply to
+	// all jobs
+	shell := c.Shell
+	if shell == "" {
+		shell = environ["SHELL"]
+	}
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+
+	names := make(map[string]bool)
+	jobs := make([]*Job, 0, len(c.Jobs))
+
+	for position, jc := range c.Jobs {
+		label := fmt.Sprintf("job %d", position+1)
+		if jc.Name != "" {
+			label = fmt.Sprintf("job %s", jc.Name)
+
+			if err := ValidateJobName(jc.Name); err != nil {
+				return nil, fmt.Errorf("CRONIC: Bad configuration for %s: %v", label, err)
+			}
+
+			if names[jc.Name] {
+				return nil, fmt.Errorf("CRONIC: Bad configuration: duplicate job name %q", jc.Name)
+			}
+			names[jc.Name] = true
+		}
+
+		annotations, err := jc.annotations()
+		if err != nil {
+			return nil, fmt.Errorf("CRONIC: Bad configuration for %s: %v", label, err)
+		}
+
+		vars := p.jobVariables(annotations, jc.Env, environ)
+		schedule := p.expandVariables(jc.Schedule, vars)
+		command := p.expandCommand(jc.Command, vars)
+
+		// Unlike in crontabs, % is left as-is: stdin is set with "stdin"
+		job, err := p.newJob(schedule, command, annotations, false)
+		if err != nil {
+			return nil, fmt.Errorf("CRONIC: Bad configuration for %s: %v", label, err)
+		}
+
+		if jc.Stdin != "" && job.StdinFile != "" {
+			return nil, fmt.Errorf("CRONIC: Bad configuration for %s: stdin and stdin_file can't both be set", label)
+		}
+
+		job.Position = position
+		job.Name = jc.Name
+		job.Environ = jc.Env
+		job.Dir = jc.Dir
+		job.Stdin = jc.Stdin
+
+		jobs = append(jobs, job)
+	}
+
+	if err := validateDependencies(jobs); err != nil {
+		return nil, err
+	}
+
+	return &Crontab{
+		Jobs: jobs,
+		Context: &Context{
+			Shell:   shell,
+			Environ: environ,
+			Home:    environ["HOME"],
+		},
+	}, nil
+}
+
+// annotations returns the annotations a job's settings are shorthands for,
+// along with its other annotations.
+func (jc *jobConfig) annotations() (map[string]string, error) {
+	annotations := make(map[string]string, len(jc.Annotations))
+	for key, value := range jc.Annotations {
+		annotations[key] = value
+	}
+
+	set := func(key string, value string) error {
+		if value == "" {
+			return nil
+		}
+
+		if _, ok := annotations[key]; ok {
+			return fmt.Errorf("%q is set both as a setting and as an annotation", key)
+		}
+
+		annotations[key] = value
+		return nil
+	}
+
+	retries := ""
+	if jc.Retries != nil {
+		retries = strconv.Itoa(*jc.Retries)
+	}
+
+	for _, setting := range []struct {
+		key   string
+		value string
+	}{
+		{"shell", jc.Shell},
+		{"stdin", jc.StdinFile},
+		{"timeout", jc.Timeout},
+		{"warn-after", jc.WarnAfter},
+		{"namespace", jc.Namespace},
+		{"retries", retries},
+		{"retry-delay", jc.RetryDelay},
+		{"retry-on", strings.Join(jc.RetryOn, ",")},
+		{"retry-never", strings.Join(jc.RetryNever, ",")},
+		{"on-spawn-failure", jc.OnSpawnFailure},
+		{"expect-output", jc.ExpectOutput},
+		{"expect-output-match", jc.ExpectOutputMatch},
+		{"webhook-url", jc.Notifications.WebhookURL},
+		{"webhook-events", strings.Join(jc.Notifications.WebhookEvents, ",")},
+		{"slack-channel", jc.Notifications.SlackChannel},
+	} {
+		if err := set(setting.key, setting.value); err != nil {
+			return nil, err
+		}
+	}
+
+	return annotations, nil
+}
@@ -0,0 +1,113 @@
+package crontab
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseConfig(t *testing.T) {
+	config := `
+shell: /bin/bash
+env:
+  PATH: /usr/bin:/bin
+jobs:
+  - name: backup-db
+    schedule: "0 3 * * *"
+    command: ./backup.sh --all
+    dir: /srv/db
+    env:
+      PGHOST: db.internal
+    timeout: 1h
+    retries: 2
+    retry_on: [timeout, 75]
+    notifications:
+      slack_channel: "#db-alerts"
+      webhook_events: [failure, timeout]
+    annotations:
+      quiet: "true"
+  - schedule: "@hourly"
+    command: date +%F
+    stdin: |
+      hello
+      world
+  - schedule: "@hourly"
+    command: ./report.sh
+    stdin_file: answers.txt
+`
+
+	tab, err := ParseConfig(strings.NewReader(config))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	assert.Equal(t, &Context{Shell: "/bin/bash", Environ: map[string]string{"PATH": "/usr/bin:/bin"}}, tab.Context)
+
+	if !assert.Len(t, tab.Jobs, 3) {
+		return
+	}
+
+	job := tab.Jobs[0]
+	assert.Equal(t, 0, job.Position)
+	assert.Equal(t, "backup-db", job.Name)
+	assert.Equal(t, "0 3 * * *", job.Schedule)
+	assert.Equal(t, "./backup.sh --all", job.Command)
+	assert.Equal(t, "/srv/db", job.Dir)
+	assert.Equal(t, map[string]string{"PGHOST": "db.internal"}, job.Environ)
+	assert.Equal(t, time.Hour, job.Timeout)
+	assert.Equal(t, &RetryPolicy{Retries: 2, Delay: DEFAULT_RETRY_DELAY, On: []string{FailureTimeout, "75"}}, job.Retry)
+	assert.Equal(t, "#db-alerts", job.SlackChannel)
+	assert.Equal(t, []EventType{EventFailure, EventTimeout}, job.WebhookEvents)
+	assert.True(t, job.Quiet)
+
+	assert.Equal(t, 1, tab.Jobs[1].Position)
+	assert.NotNil(t, tab.Jobs[1].Expression)
+
+	// Unlike in crontabs, % is left as-is
+	assert.Equal(t, "date +%F", tab.Jobs[1].Command)
+	assert.Equal(t, "hello\nworld\n", tab.Jobs[1].Stdin)
+
+	assert.Equal(t, "answers.txt", tab.Jobs[2].StdinFile)
+}
+
+func TestParseConfigUsesShellAndHome(t *testing.T) {
+	tab, err := ParseConfig(strings.NewReader(`{"env": {"SHELL": "/bin/bash", "HOME": "/srv/app"}, "jobs": [{"schedule": "@daily", "command": "true"}]}`))
+	if assert.Nil(t, err) {
+		assert.Equal(t, "/bin/bash", tab.Context.Shell)
+		assert.Equal(t, "/srv/app", tab.Context.Home)
+	}
+}
+
+func TestParseConfigDefaults(t *testing.T) {
+	tab, err := ParseConfig(strings.NewReader(`{"jobs": [{"schedule": "@daily", "command": "true"}]}`))
+	if assert.Nil(t, err) {
+		assert.Equal(t, &Context{Shell: "/bin/sh", Environ: map[string]string{}}, tab.Context)
+		assert.Len(t, tab.Jobs, 1)
+	}
+}
+
+var badConfigTestCases = []string{
+	"jobs: [{schedule: '@daily'}]",
+	"jobs: [{command: 'true'}]",
+	"jobs: [{schedule: 'every day', command: 'true'}]",
+	"jobs: [{schedule: '@daily', command: 'true', timeout: soon}]",
+	"jobs: [{schedule: '@daily', command: 'true', colour: blue}]",
+	"jobs: [{schedule: '@daily', command: 'true', retries: 1, annotations: {retries: '2'}}]",
+	"jobs: [{schedule: '@daily', command: 'true', name: 'has spaces'}]",
+	"jobs: [{schedule: '@daily', command: 'true', name: a}, {schedule: '@daily', command: 'true', name: a}]",
+	"jobs: {schedule: '@daily'}",
+	"jobs: [{schedule: '@daily', command: 'true', stdin: 'yes', stdin_file: answers.txt}]",
+}
+
+func TestParseConfigRejectsBadConfigs(t *testing.T) {
+	for _, config := range badConfigTestCases {
+		label := fmt.Sprintf("ParseConfig(%q)", config)
+
+		tab, err := ParseConfig(strings.NewReader(config))
+		assert.Nil(t, tab, label)
+		assert.NotNil(t, err, label)
+	}
+}
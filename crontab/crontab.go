@@ -4,41 +4,112 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"os"
 	"regexp"
+	"sort"
 	"strings"
 
-	"github.com/gorhill/cronexpr"
 	"github.com/sirupsen/logrus"
 )
 
-
 var (
-	jobLineSeparator = regexp.MustCompile(`\S+`)
-	envLineMatcher   = regexp.MustCompile(`^([^\s=]+)\s*=\s*(.*)$`)
+	jobLineSeparator  = regexp.MustCompile(`\S+`)
+	envLineMatcher    = regexp.MustCompile(`^([^\s=]+)\s*=\s*(.*)$`)
+	envCommentMatcher = regexp.MustCompile(`\s#`)
+	nameLineMatcher   = regexp.MustCompile(`^#\s*name:(.*)$`)
+	jobNameMatcher    = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+)
+
+// Parser parses crontabs and configuration files, and formats jobs so that
+// it parses them back. The zero value parses them like cronic does by
+// default.
+type Parser struct {
+	// Whether malformed lines are logged and skipped (see Crontab.BadLines).
+	// Otherwise, they make the whole crontab invalid.
+	Lenient bool
+
+	// The format of crontabs (see ParseCrontabFormat), FormatAuto if empty
+	Format string
+
+	// The syntax of schedules without a prefix (see ParseScheduleSyntax),
+	// SyntaxCron if empty
+	ScheduleSyntax string
+
+	// Whether "${VAR}" in schedules and commands is replaced (see
+	// expandVariables), and which of cronic's environment variables it can
+	// be replaced with, like those jobs inherit (see cron.Options.EnvAllow
+	// and EnvDeny)
+	ExpandVariables bool
+	EnvAllow        []string
+	EnvDeny         []string
 
-	parameterCounts = []int{
-		7, // POSIX + seconds + years
-		6, // POSIX + years
-		5, // POSIX
-		1, // shorthand (e.g. @hourly)
+	// Whether % is left as-is in the commands of crontab lines, rather than
+	// ending them (see splitStdin)
+	LiteralPercent bool
+
+	// Where messages are logged (logrus' standard logger if nil)
+	Logger *logrus.Entry
+}
+
+func (p *Parser) logger() *logrus.Entry {
+	if p.Logger == nil {
+		return logrus.NewEntry(logrus.StandardLogger())
 	}
-)
+	return p.Logger
+}
 
 func parseJobLine(line string) (*CrontabLine, error) {
+	return (&Parser{}).parseJobLine(line)
+}
+
+// parseJobLine parses a job line, whose schedule is in p's syntax unless it
+// has a prefix.
+func (p *Parser) parseJobLine(line string) (*CrontabLine, error) {
+	calendarLine, err := parseCalendarLine(line)
+	if err != nil {
+		return nil, fmt.Errorf("CRONIC: Bad crontab line: %s (%v)", line, err)
+	} else if calendarLine != nil {
+		return calendarLine, nil
+	}
+
+	onceLine, err := parseOnceLine(line)
+	if err != nil {
+		return nil, fmt.Errorf("CRONIC: Bad crontab line: %s (%v)", line, err)
+	} else if onceLine != nil {
+		return onceLine, nil
+	}
+
+	intervalLine, err := parseIntervalLine(line)
+	if err != nil {
+		return nil, fmt.Errorf("CRONIC: Bad crontab line: %s (%v)", line, err)
+	} else if intervalLine != nil {
+		return intervalLine, nil
+	}
+
 	indices := jobLineSeparator.FindAllStringIndex(line, -1)
 
-	for _, count := range parameterCounts {
-		if len(indices) <= count {
+	// The schedule may be prefixed with its syntax (e.g. "@quartz")
+	syntax, prefixEnds := splitSyntaxPrefix(line, indices, p.ScheduleSyntax)
+	if prefixEnds > 0 {
+		indices = indices[1:]
+	}
+
+	fields := make([]string, len(indices))
+	for i, index := range indices {
+		fields[i] = line[index[0]:index[1]]
+	}
+
+	for _, count := range syntax.fieldCounts(fields) {
+		if count == 0 || len(indices) <= count {
 			continue
 		}
 
 		scheduleEnds := indices[count-1][1]
 		commandStarts := indices[count][0]
 
-		// TODO: Should receive a logger?
-		logrus.Debugf("CRONIC: Try parse(%d): %s[0:%d] = %s", count, line, scheduleEnds, line[0:scheduleEnds])
+		p.logger().WithFields(logrus.Fields{"fields": count, "schedule": line[:scheduleEnds]}).Debug("CRONIC: Trying to parse schedule")
 
-		expr, err := cronexpr.Parse(line[:scheduleEnds])
+		expr, err := syntax.parse(line[prefixEnds:scheduleEnds])
 
 		if err != nil {
 			continue
@@ -53,72 +124,470 @@ func parseJobLine(line string) (*CrontabLine, error) {
 	return nil, fmt.Errorf("CRONIC: Bad crontab line: %s", line)
 }
 
+// ValidateJobName checks that name can identify a job. Names can't start with
+// a digit, so they're never mistaken for positions (e.g. in the API).
+func ValidateJobName(name string) error {
+	if !jobNameMatcher.MatchString(name) {
+		return fmt.Errorf("name %q must start with a letter or '_', and only contain letters, digits, '_', '-' and '.'", name)
+	}
+	return nil
+}
+
+// NewJob creates a job outside of a crontab (e.g. via the API), like the zero
+// Parser does.
+func NewJob(schedule string, command string, annotations map[string]string) (*Job, error) {
+	return (&Parser{}).NewJob(schedule, command, annotations)
+}
+
+// NewJob creates a job outside of a crontab (e.g. via the API). The job must
+// be representable as a crontab line, so that it can be written to a
+// crontab (see WriteCrontab).
+func (p *Parser) NewJob(schedule string, command string, annotations map[string]string) (*Job, error) {
+	return p.newJob(schedule, command, annotations, !p.LiteralPercent)
+}
+
+// newJob creates a job like NewJob, leaving % in the command as-is unless
+// percentStdin.
+func (p *Parser) newJob(schedule string, command string, annotations map[string]string, percentStdin bool) (*Job, error) {
+	schedule = strings.TrimSpace(schedule)
+	command = strings.TrimSpace(command)
+
+	if command == "" {
+		return nil, fmt.Errorf("CRONIC: Command is required")
+	}
+
+	if strings.ContainsAny(command, "\r\n") {
+		return nil, fmt.Errorf("CRONIC: Command must be a single line")
+	}
+
+	if continues, _ := splitContinuation(command); continues {
+		return nil, fmt.Errorf("CRONIC: Command must not end with a backslash")
+	}
+
+	// The line must be parsed back into the same schedule and command,
+	// which isn't the case for e.g. a 5-field schedule followed by a
+	// command starting with a year.
+	line, err := p.parseJobLine(schedule + " " + command)
+	if err != nil || line.Schedule != schedule || line.Command != command {
+		return nil, fmt.Errorf("CRONIC: Bad schedule: %q", schedule)
+	}
+
+	keys := make([]string, 0, len(annotations))
+	for key := range annotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pending := make([]annotation, 0, len(keys))
+	for _, key := range keys {
+		pending = append(pending, annotation{key: key, value: annotations[key], hasValue: true})
+	}
+
+	job := &Job{CrontabLine: *line}
+	if percentStdin {
+		job.Command, job.Stdin = splitStdin(job.Command)
+	}
+	if err := job.parseExec(); err != nil {
+		return nil, fmt.Errorf("CRONIC: Bad command: %v", err)
+	}
+
+	if err := applyAnnotations(job, pending); err != nil {
+		return nil, fmt.Errorf("CRONIC: Bad annotation: %v", err)
+	}
+
+	if _, err := p.FormatJob(job); err != nil {
+		return nil, fmt.Errorf("CRONIC: Bad annotation: %v", err)
+	}
+
+	return job, nil
+}
+
+// splitContinuation reports whether line ends with a line continuation (i.e.
+// an unescaped backslash, optionally followed by whitespace), and returns the
+// line without it.
+func splitContinuation(line string) (bool, string) {
+	trimmed := strings.TrimRight(line, " \t")
+	backslashes := len(trimmed) - len(strings.TrimRight(trimmed, "\\"))
+
+	if backslashes%2 == 0 {
+		return false, line
+	}
+
+	return true, strings.TrimRight(trimmed[:len(trimmed)-1], " \t")
+}
+
+// parseEnvValue extracts the value from the right-hand side of a KEY=VALUE
+// line:
+//
+//   - A value wrapped in matching single or double quotes is taken literally,
+//     including whitespace and '#'. Only a comment may follow the closing quote.
+//   - An unquoted value runs until the end of the line, or until a '#' that
+//     follows whitespace (i.e. a trailing comment). Surrounding whitespace is
+//     removed, but inner whitespace is kept, so multi-word values work.
+//   - A value that opens a quote but never closes it is taken as-is (this
+//     emulates what Vixie cron does).
+func parseEnvValue(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+
+	if raw == "" {
+		return "", nil
+	}
+
+	if quote := raw[0]; quote == '"' || quote == '\'' {
+		end := strings.IndexByte(raw[1:], quote)
+		if end == -1 {
+			return raw, nil
+		}
+
+		rest := strings.TrimSpace(raw[end+2:])
+		if rest != "" && rest[0] != '#' {
+			return "", fmt.Errorf("unexpected %q after closing quote", rest)
+		}
+
+		return raw[1 : end+1], nil
+	}
+
+	if comment := envCommentMatcher.FindStringIndex(raw); comment != nil {
+		raw = raw[:comment[0]]
+	}
+
+	return strings.TrimSpace(raw), nil
+}
+
 func ParseCrontab(reader io.Reader) (*Crontab, error) {
-	scanner := bufio.NewScanner(reader)
+	return ParseCrontabAt(reader, "")
+}
+
+// ParseCrontabAt parses a crontab read from path like the zero Parser does.
+func ParseCrontabAt(reader io.Reader, path string) (*Crontab, error) {
+	return (&Parser{}).ParseCrontab(reader, path)
+}
+
+// ParseCrontab parses a crontab read from path: "#include" lines resolve
+// relative to its directory, and its jobs record it as their File. The path
+// can be empty if the crontab wasn't read from a file.
+func (parser *Parser) ParseCrontab(reader io.Reader, path string) (*Crontab, error) {
+	p := &crontabParser{
+		Parser:  parser,
+		jobs:    make([]*Job, 0),
+		environ: make(map[string]string),
+		shell:   "/bin/sh",
+		names:   make(map[string]bool),
+	}
+
+	if path != "" {
+		id, err := includeID(path)
+		if err != nil {
+			return nil, err
+		}
+		p.including = []string{id}
+	}
+
+	if err := p.parse(reader, path); err != nil {
+		return nil, err
+	}
+
+	if err := validateDependencies(p.jobs); err != nil {
+		return nil, err
+	}
+
+	return &Crontab{
+		Jobs: p.jobs,
+		Context: &Context{
+			Shell:   p.shell,
+			Environ: p.environ,
+			Home:    p.home,
+		},
+		BadLines: p.badLines,
+	}, nil
+}
 
-	position := 0
+// crontabParser holds what's shared by a crontab and the files it includes.
+type crontabParser struct {
+	*Parser
 
-	jobs := make([]*Job, 0)
+	jobs []*Job
 
 	// TODO: CRON_TZ?
-	environ := make(map[string]string)
-	shell := "/bin/sh"
+	environ map[string]string
+	shell   string
+	home    string
+
+	// How many lines were skipped, when parsing is Lenient
+	badLines int
+
+	names map[string]bool
+
+	// The files being parsed, outermost first (see includeID), and how
+	// deep in includes the current one is
+	including []string
+	depth     int
+}
+
+// parse parses the lines of file. Errors about the lines of included files
+// say where they are (those of the crontab itself are reported as-is).
+func (p *crontabParser) parse(reader io.Reader, file string) error {
+	scanner := bufio.NewScanner(reader)
+	lineNumber := 0
+
+	// bad returns the error about the current line, unless parsing is
+	// Lenient: the line is then logged and skipped, and bad returns nil.
+	bad := func(err error) error {
+		if p.depth > 0 {
+			err = fmt.Errorf("%v (in %s:%d)", err, file, lineNumber)
+		}
+
+		if !p.Lenient {
+			return err
+		}
 
+		p.logger().Errorf("%v, skipping it", err)
+		p.badLines++
+		return nil
+	}
+
+	// Annotations and names apply to the next job line, which is skipped
+	// too if some of them were bad
+	var pendingAnnotations []annotation
+	var pendingName string
+	skipJob := false
+
+	format := p.Format
+	if format == "" {
+		format = FormatAuto
+	}
+
+lines:
 	for scanner.Scan() {
+		lineNumber++
 		line := strings.TrimLeft(scanner.Text(), " \t")
 
 		if line == "" {
 			continue
 		}
 
+		if m := annotationMatcher.FindStringSubmatch(line); m != nil {
+			annotations, err := parseAnnotation(m[1])
+			if err != nil {
+				if err := bad(fmt.Errorf("CRONIC: Bad annotation: %s (%v)", line, err)); err != nil {
+					return err
+				}
+				skipJob = true
+				continue
+			}
+			pendingAnnotations = append(pendingAnnotations, annotations...)
+			continue
+		}
+
+		if m := nameLineMatcher.FindStringSubmatch(line); m != nil {
+			name := strings.TrimSpace(m[1])
+			if err := ValidateJobName(name); err != nil {
+				if err := bad(fmt.Errorf("CRONIC: Bad job name: %s (%v)", line, err)); err != nil {
+					return err
+				}
+				skipJob = true
+				continue
+			}
+			if pendingName != "" {
+				if err := bad(fmt.Errorf("CRONIC: Bad job name: %s (the job is already named %q)", line, pendingName)); err != nil {
+					return err
+				}
+				skipJob = true
+				continue
+			}
+			if p.names[name] {
+				if err := bad(fmt.Errorf("CRONIC: Bad job name: %s (duplicate job name %q)", line, name)); err != nil {
+					return err
+				}
+				skipJob = true
+				continue
+			}
+			pendingName = name
+			continue
+		}
+
+		if m := includeLineMatcher.FindStringSubmatch(line); m != nil {
+			if len(pendingAnnotations) > 0 || pendingName != "" {
+				if err := bad(fmt.Errorf("CRONIC: Bad include: %s (annotations and names must be followed by a job)", line)); err != nil {
+					return err
+				}
+				continue
+			}
+			paths, err := p.resolveInclude(strings.TrimSpace(m[1]), file)
+			if err != nil {
+				if err := bad(fmt.Errorf("CRONIC: Bad include: %s (%v)", line, err)); err != nil {
+					return err
+				}
+				continue
+			}
+			for _, path := range paths {
+				included, err := os.Open(path)
+				if err != nil {
+					if err := bad(fmt.Errorf("CRONIC: Bad include: %s (%v)", line, err)); err != nil {
+						return err
+					}
+					continue
+				}
+				err = p.parseIncluded(included, path)
+				included.Close()
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
 		if line[0] == '#' {
 			continue
 		}
 
+		startLine := lineNumber
+
+		// A trailing backslash continues the line on the next one (but
+		// comments can't be continued). Leading whitespace on the
+		// continuation is ignored, and the backslash becomes a space.
+		for {
+			continues, rest := splitContinuation(line)
+			if !continues {
+				break
+			}
+
+			if !scanner.Scan() {
+				if err := scanner.Err(); err != nil {
+					return err
+				}
+				if err := bad(fmt.Errorf("CRONIC: Bad crontab line: %s (line continuation at end of file)", line)); err != nil {
+					return err
+				}
+				continue lines
+			}
+			lineNumber++
+
+			line = rest + " " + strings.TrimLeft(scanner.Text(), " \t")
+		}
+
 		r := envLineMatcher.FindAllStringSubmatch(line, -1)
 		if len(r) == 1 && len(r[0]) == 3 {
 			envKey := r[0][1]
-			envVal := r[0][2]
-
-			// Remove quotes (this emulates what Vixie cron does)
-			if envVal[0] == '"' || envVal[0] == '\'' {
-				if len(envVal) > 1 && envVal[0] == envVal[len(envVal)-1] {
-					envVal = envVal[1 : len(envVal)-1]
+			envVal, err := parseEnvValue(r[0][2])
+			if err != nil {
+				if err := bad(fmt.Errorf("CRONIC: Bad environment line: %s (%v)", line, err)); err != nil {
+					return err
 				}
+				continue
 			}
 
 			if envKey == "SHELL" {
-				logrus.Infof("CRONIC: Processes will be spawned using shell %s", envVal)
-				shell = envVal
+				p.logger().Infof("CRONIC: Processes will be spawned using shell %s", envVal)
+				p.shell = envVal
+			}
+
+			if envKey == "HOME" {
+				p.logger().Infof("CRONIC: Processes will run in HOME %s", envVal)
+				p.home = envVal
 			}
 
 			if envKey == "USER" {
-				logrus.Warnf("CRONIC: Processes will NOT be spawned as USER=%s", envVal)
+				p.logger().Warnf("CRONIC: Processes will NOT be spawned as USER=%s", envVal)
 			}
 
-			environ[envKey] = envVal
+			p.environ[envKey] = envVal
+
+			continue
+		}
 
+		if skipJob {
+			p.logger().Errorf("CRONIC: Skipping crontab line: %s (its annotations or name are bad)", line)
+			pendingAnnotations, pendingName, skipJob = nil, "", false
 			continue
 		}
 
-		jobLine, err := parseJobLine(line)
+		// Like in cron, % splits the line as written, not the values of
+		// the variables it refers to (e.g. a date format)
+		jobText, stdin := line, ""
+		if !p.LiteralPercent {
+			jobText, stdin = splitStdin(line)
+		}
+
+		// The job's env-allow and env-deny annotations apply to the
+		// variables it can expand, like to those it inherits
+		annotationValues := make(map[string]string, len(pendingAnnotations))
+		for _, a := range pendingAnnotations {
+			annotationValues[a.key] = a.value
+		}
+		vars := p.jobVariables(annotationValues, p.environ)
+
+		jobLine, err := p.expandJobLine(jobText, vars)
 		if err != nil {
-			return nil, err
+			if err := bad(err); err != nil {
+				return err
+			}
+			pendingAnnotations, pendingName = nil, ""
+			continue
 		}
 
-		jobs = append(jobs, &Job{CrontabLine: *jobLine, Position: position})
-		position++
+		job := &Job{
+			CrontabLine: *jobLine,
+			Position:    len(p.jobs),
+			Name:        pendingName,
+			File:        file,
+			Line:        startLine,
+		}
+		pendingName = ""
+
+		annotations := pendingAnnotations
+		pendingAnnotations = nil
+
+		if format == FormatAuto {
+			format = detectFormat(file, job.Command)
+			p.logger().Debugf("CRONIC: Crontab %s is in %s format", file, format)
+		}
+
+		if format == FormatSystem {
+			job.User, job.Command, err = splitUser(job.Command)
+			if err != nil {
+				if err := bad(fmt.Errorf("CRONIC: Bad crontab line: %s (%v)", line, err)); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		job.Stdin = p.expandVariables(stdin, vars)
+
+		if err := job.parseExec(); err != nil {
+			if err := bad(fmt.Errorf("CRONIC: Bad crontab line: %s (%v)", line, err)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := applyAnnotations(job, annotations); err != nil {
+			if err := bad(fmt.Errorf("CRONIC: Bad annotation for crontab line: %s (%v)", line, err)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Names are only taken by jobs that parse, so that a later job
+		// can have the name of one that was skipped
+		if job.Name != "" {
+			p.names[job.Name] = true
+		}
+		p.jobs = append(p.jobs, job)
 	}
 
 	if err := scanner.Err(); err != nil {
-		return nil, err
+		return err
 	}
 
-	return &Crontab{
-		Jobs: jobs,
-		Context: &Context{
-			Shell:   shell,
-			Environ: environ,
-		},
-	}, nil
+	if len(pendingAnnotations) > 0 {
+		return bad(fmt.Errorf("CRONIC: Bad annotation: %q is not followed by a job", pendingAnnotations[0].key))
+	}
+
+	if pendingName != "" {
+		return bad(fmt.Errorf("CRONIC: Bad job name: %q is not followed by a job", pendingName))
+	}
+
+	return nil
 }
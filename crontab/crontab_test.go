@@ -100,6 +100,105 @@ var parseCrontabTestCases = []struct {
 		},
 	},
 
+	{
+		"FOO=\"a b\"",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{"FOO": "a b"},
+			},
+			Jobs: []*Job{},
+		},
+	},
+
+	{
+		"FOO=a b",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{"FOO": "a b"},
+			},
+			Jobs: []*Job{},
+		},
+	},
+
+	{
+		"FOO=\"a # b\" # comment",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{"FOO": "a # b"},
+			},
+			Jobs: []*Job{},
+		},
+	},
+
+	{
+		"FOO=a b  # comment",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{"FOO": "a b"},
+			},
+			Jobs: []*Job{},
+		},
+	},
+
+	{
+		"FOO='a b'\t# comment",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{"FOO": "a b"},
+			},
+			Jobs: []*Job{},
+		},
+	},
+
+	{
+		"FOO=a#b",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{"FOO": "a#b"},
+			},
+			Jobs: []*Job{},
+		},
+	},
+
+	{
+		"FOO=  a b  ",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{"FOO": "a b"},
+			},
+			Jobs: []*Job{},
+		},
+	},
+
+	{
+		"FOO=",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{"FOO": ""},
+			},
+			Jobs: []*Job{},
+		},
+	},
+
+	{
+		"FOO=\"a b",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{"FOO": "\"a b"},
+			},
+			Jobs: []*Job{},
+		},
+	},
+
 	{
 		"* * * * * foo some # qux",
 		&Crontab{
@@ -118,6 +217,29 @@ var parseCrontabTestCases = []struct {
 		},
 	},
 
+	{
+		"SHELL=/bin/bash\nPATH=/usr/local/bin:/usr/bin:/bin\nHOME=/srv/app\n* * * * * foo",
+		&Crontab{
+			Context: &Context{
+				Shell: "/bin/bash",
+				Environ: map[string]string{
+					"SHELL": "/bin/bash",
+					"PATH":  "/usr/local/bin:/usr/bin:/bin",
+					"HOME":  "/srv/app",
+				},
+				Home: "/srv/app",
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "* * * * *",
+						Command:  "foo",
+					},
+				},
+			},
+		},
+	},
+
 	{
 		"* * * * * foo\nSHELL=some\n1 1 1 1 1 bar\nKEY=VAL",
 		&Crontab{
@@ -229,11 +351,115 @@ var parseCrontabTestCases = []struct {
 		},
 	},
 
+	{
+		"* * * * * foo \\\n  | bar \\  \n\t| baz",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "* * * * *",
+						Command:  "foo | bar | baz",
+					},
+				},
+			},
+		},
+	},
+
+	{
+		"* * * * * \\\n  foo",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "* * * * *",
+						Command:  "foo",
+					},
+				},
+			},
+		},
+	},
+
+	{
+		"*/5 \\\n * * * * foo",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "*/5 * * * *",
+						Command:  "foo",
+					},
+				},
+			},
+		},
+	},
+
+	{
+		"* * * * * foo \\\\",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "* * * * *",
+						Command:  "foo \\\\",
+					},
+				},
+			},
+		},
+	},
+
+	{
+		"# comment \\\n* * * * * foo",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "* * * * *",
+						Command:  "foo",
+					},
+				},
+			},
+		},
+	},
+
+	{
+		"FOO=a \\\n  b",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{"FOO": "a b"},
+			},
+			Jobs: []*Job{},
+		},
+	},
+
 	// Failure cases
 	{"* foo \n", nil},
 	{"* some * * *  more\n", nil},
 	{"* some * * *  \n", nil},
 	{"FOO\n", nil},
+	{"FOO=\"a\" b\n", nil},
+	{"FOO='a'b\n", nil},
+	{"* * * * * foo \\\n", nil},
 }
 
 func TestParseCrontab(t *testing.T) {
@@ -263,3 +489,117 @@ func TestParseCrontab(t *testing.T) {
 		}
 	}
 }
+
+var jobNameTestCases = []struct {
+	crontab string
+	names   []string
+}{
+	{"* * * * * foo\n", []string{""}},
+	{"# name: backup-db\n* * * * * foo\n* * * * * bar\n", []string{"backup-db", ""}},
+	{"#name:backup_2.db\n* * * * * foo\n", []string{"backup_2.db"}},
+	{"# name: a\n# cronic: quiet\n* * * * * foo\n# cronic: quiet\n# name: b\n* * * * * bar\n", []string{"a", "b"}},
+
+	// Failure cases
+	{"# name:\n* * * * * foo\n", nil},
+	{"# name: has spaces\n* * * * * foo\n", nil},
+	{"# name: 42\n* * * * * foo\n", nil},
+	{"# name: a\n# name: b\n* * * * * foo\n", nil},
+	{"# name: a\n* * * * * foo\n# name: a\n* * * * * bar\n", nil},
+	{"* * * * * foo\n# name: a\n", nil},
+}
+
+func TestParseCrontabJobNames(t *testing.T) {
+	for _, tt := range jobNameTestCases {
+		label := fmt.Sprintf("ParseCrontab(%q)", tt.crontab)
+
+		crontab, err := ParseCrontab(bytes.NewBufferString(tt.crontab))
+
+		if tt.names == nil {
+			assert.NotNil(t, err, label)
+			continue
+		}
+
+		if assert.Nil(t, err, label) && assert.Equal(t, len(tt.names), len(crontab.Jobs), label) {
+			for i, job := range crontab.Jobs {
+				assert.Equal(t, tt.names[i], job.Name, label)
+			}
+		}
+	}
+}
+
+var lenientCrontabTestCases = []struct {
+	crontab  string
+	commands []string
+	badLines int
+}{
+	{"* * * * * foo\n* bar\n* * * * * baz\n", []string{"foo", "baz"}, 1},
+	{"FOO\n* * * * * foo\n", []string{"foo"}, 1},
+	{"# name: has spaces\n* * * * * foo\n* * * * * bar\n", []string{"bar"}, 1},
+	{"# cronic: no-such-thing\n* * * * * foo\n* * * * * bar\n", []string{"bar"}, 1},
+	{"# cronic: quiet\n* bar\n* * * * * foo\n", []string{"foo"}, 1},
+	{"* * * * * foo\n* * * * * bar \\\n", []string{"foo"}, 1},
+	{"* * * * * foo\n# name: a\n", []string{"foo"}, 1},
+	{"# name: a\n* bar\n# name: a\n* * * * * foo\n", []string{"foo"}, 1},
+	{"# name: a\n* * * * * foo\n# name: a\n* * * * * bar\n", []string{"foo"}, 1},
+}
+
+func TestParseCrontabLenient(t *testing.T) {
+	parser := &Parser{Lenient: true}
+
+	for _, tt := range lenientCrontabTestCases {
+		label := fmt.Sprintf("ParseCrontab(%q)", tt.crontab)
+
+		crontab, err := parser.ParseCrontab(bytes.NewBufferString(tt.crontab), "")
+		if !assert.Nil(t, err, label) {
+			continue
+		}
+
+		commands := []string{}
+		for _, job := range crontab.Jobs {
+			commands = append(commands, job.Command)
+		}
+		assert.Equal(t, tt.commands, commands, label)
+		assert.Equal(t, tt.badLines, crontab.BadLines, label)
+	}
+}
+
+var newJobTestCases = []struct {
+	schedule    string
+	command     string
+	annotations map[string]string
+	ok          bool
+}{
+	{"* * * * *", "foo", nil, true},
+	{"@hourly", "foo bar", nil, true},
+	{"*/5 * * * *", "foo", map[string]string{"quiet": "true"}, true},
+
+	// Failure cases
+	{"", "foo", nil, false},
+	{"not a schedule", "foo", nil, false},
+	{"* * * * *", "", nil, false},
+	{"* * * * *", "foo\nbar", nil, false},
+	{"* * * * *", "foo \\", nil, false},
+	{"* * * * *", "2020 foo", nil, false},
+	{"* * * * *", "foo", map[string]string{"no-such-thing": "x"}, false},
+	{"* * * * *", "foo", map[string]string{"debug-command": `echo "it's"`}, false},
+}
+
+func TestNewJob(t *testing.T) {
+	for _, tt := range newJobTestCases {
+		label := fmt.Sprintf("NewJob(%q, %q, %v)", tt.schedule, tt.command, tt.annotations)
+
+		job, err := NewJob(tt.schedule, tt.command, tt.annotations)
+
+		if !tt.ok {
+			assert.Nil(t, job, label)
+			assert.NotNil(t, err, label)
+			continue
+		}
+
+		if assert.Nil(t, err, label) {
+			assert.Equal(t, tt.schedule, job.Schedule, label)
+			assert.Equal(t, tt.command, job.Command, label)
+			assert.NotNil(t, job.Expression, label)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package crontab
+
+import (
+	"sort"
+	"time"
+)
+
+// HotSpot is a minute when many jobs run at once.
+type HotSpot struct {
+	Minute time.Time
+	Jobs   []*Job
+}
+
+// HotSpots returns the minutes between from and from+period when at least
+// threshold jobs run, busiest first (and earliest first among equally busy
+// minutes). Jobs that run several times in a minute (e.g. every second)
+// count once.
+func HotSpots(jobs []*Job, from time.Time, period time.Duration, threshold int) []HotSpot {
+	from = from.Truncate(time.Minute)
+	until := from.Add(period)
+
+	// By Unix time, since expressions may use different timezones
+	minutes := make(map[int64][]*Job)
+
+	for _, job := range jobs {
+		// Skip the rest of each minute the job runs in
+		for next := job.Expression.Next(from.Add(-time.Nanosecond)); !next.IsZero() && next.Before(until); {
+			minute := next.Truncate(time.Minute)
+			minutes[minute.Unix()] = append(minutes[minute.Unix()], job)
+			next = job.Expression.Next(minute.Add(time.Minute - time.Nanosecond))
+		}
+	}
+
+	hotSpots := make([]HotSpot, 0)
+	for minute, minuteJobs := range minutes {
+		if len(minuteJobs) >= threshold {
+			hotSpots = append(hotSpots, HotSpot{Minute: time.Unix(minute, 0).In(from.Location()), Jobs: minuteJobs})
+		}
+	}
+
+	sort.Slice(hotSpots, func(i, j int) bool {
+		if len(hotSpots[i].Jobs) != len(hotSpots[j].Jobs) {
+			return len(hotSpots[i].Jobs) > len(hotSpots[j].Jobs)
+		}
+		return hotSpots[i].Minute.Before(hotSpots[j].Minute)
+	})
+
+	return hotSpots
+}
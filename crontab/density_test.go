@@ -0,0 +1,41 @@
+package crontab
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHotSpots(t *testing.T) {
+	tab, err := ParseCrontab(bytes.NewBufferString(`
+0 * * * * ./hourly-1
+0 * * * * ./hourly-2
+@hourly ./hourly-3
+*/30 * * * * ./half-hourly
+0 3 * * * ./nightly
+*/10 * * * * * * ./every-10-seconds
+`))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	from := localTime(2018, 4, 7, 0, 0)
+	hotSpots := HotSpots(tab.Jobs, from, 24*time.Hour, 4)
+
+	// 5 jobs run at the top of every hour (counting the one running every
+	// 10 seconds once), and 6 at 3 o'clock
+	if assert.Equal(t, 24, len(hotSpots)) {
+		assert.Equal(t, localTime(2018, 4, 7, 3, 0), hotSpots[0].Minute)
+		assert.Equal(t, 6, len(hotSpots[0].Jobs))
+
+		assert.Equal(t, localTime(2018, 4, 7, 0, 0), hotSpots[1].Minute)
+		assert.Equal(t, 5, len(hotSpots[1].Jobs))
+
+		assert.Equal(t, localTime(2018, 4, 7, 23, 0), hotSpots[23].Minute)
+	}
+
+	assert.Equal(t, 1, len(HotSpots(tab.Jobs, from, 24*time.Hour, 6)))
+	assert.Equal(t, 0, len(HotSpots(tab.Jobs, from, 24*time.Hour, 7)))
+}
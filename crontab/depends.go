@@ -0,0 +1,89 @@
+package crontab
+
+import (
+	"fmt"
+	"strings"
+)
+
+// validateDependencies checks that the jobs that jobs run after (see
+// Job.After) exist, and that no job runs after itself (directly or not).
+func validateDependencies(jobs []*Job) error {
+	byName := make(map[string]*Job)
+	for _, job := range jobs {
+		if job.Name != "" {
+			byName[job.Name] = job
+		}
+	}
+
+	for _, job := range jobs {
+		for _, name := range job.After {
+			if byName[name] == nil {
+				return fmt.Errorf("CRONIC: Bad annotation for crontab line: %s %s (annotation \"after\": no job is named %q)", job.Schedule, job.Command, name)
+			}
+		}
+	}
+
+	// Depth-first, from each job, keeping the path to the current one
+	done := make(map[*Job]bool)
+	var path []string
+
+	var visit func(job *Job) error
+	visit = func(job *Job) error {
+		for i, name := range path {
+			if name == job.Name {
+				cycle := append(append([]string{}, path[i:]...), job.Name)
+				return fmt.Errorf("CRONIC: Bad annotation: after (dependency cycle: %s)", strings.Join(cycle, " -> "))
+			}
+		}
+
+		if done[job] {
+			return nil
+		}
+
+		path = append(path, job.Name)
+		for _, name := range job.After {
+			if err := visit(byName[name]); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+
+		done[job] = true
+		return nil
+	}
+
+	for _, job := range jobs {
+		if err := visit(job); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CheckDependencies checks that the jobs that the crontab's jobs run after
+// are still among them, once some jobs have been left out (e.g. disabled
+// ones, or those of other shards): a job whose dependency is left out would
+// skip all its runs.
+func (tab *Crontab) CheckDependencies() error {
+	names := make(map[string]bool)
+	for _, job := range tab.Jobs {
+		if job.Name != "" {
+			names[job.Name] = true
+		}
+	}
+
+	for _, job := range tab.Jobs {
+		for _, name := range job.After {
+			if !names[name] {
+				described := describeJob(job)
+				if job.Name != "" {
+					described = fmt.Sprintf("job %q", job.Name)
+				}
+				return fmt.Errorf("CRONIC: %s runs after job %q, which was left out of the jobs to run", strings.ToUpper(described[:1])+described[1:], name)
+			}
+		}
+	}
+
+	return nil
+}
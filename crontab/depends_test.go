@@ -0,0 +1,68 @@
+package crontab
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var dependenciesTestCases = []struct {
+	crontab string
+	err     string
+}{
+	{"# name: a\n@daily a\n# cronic: after=a\n@daily b\n", ""},
+	{"# cronic: after=c\n# name: a\n@daily a\n# name: b\n# cronic: after=a\n@daily b\n# name: c\n@daily c\n", ""},
+	{"# name: a\n@daily a\n# name: b\n@daily b\n# cronic: after=a,b\n@daily c\n", ""},
+
+	{"# cronic: after=a\n@daily b\n", `no job is named "a"`},
+	{"# cronic: after=a,a\n# name: a\n@daily a\n", `lists "a" twice`},
+	{"# cronic: after=1a\n@daily a\n", `name "1a" must start with a letter`},
+	{"# cronic: after\n@daily a\n", `requires a value`},
+	{"# name: a\n# cronic: after=a\n@daily a\n", "dependency cycle: a -> a"},
+	{"# name: a\n# cronic: after=c\n@daily a\n# name: b\n# cronic: after=a\n@daily b\n# name: c\n# cronic: after=b\n@daily c\n", "dependency cycle: a -> c -> b -> a"},
+}
+
+func TestParseCrontabChecksDependencies(t *testing.T) {
+	for _, tt := range dependenciesTestCases {
+		label := fmt.Sprintf("ParseCrontab(%q)", tt.crontab)
+
+		_, err := ParseCrontab(bytes.NewBufferString(tt.crontab))
+		if tt.err == "" {
+			assert.Nil(t, err, label)
+		} else if assert.NotNil(t, err, label) {
+			assert.Contains(t, err.Error(), tt.err, label)
+		}
+	}
+
+	_, err := ParseConfig(bytes.NewBufferString("jobs:\n  - {name: a, schedule: '@daily', command: a, annotations: {after: b}}\n  - {name: b, schedule: '@daily', command: b, annotations: {after: a}}\n"))
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "dependency cycle: a -> b -> a")
+	}
+}
+
+func TestCheckDependencies(t *testing.T) {
+	for _, tt := range []struct {
+		crontab string
+		err     string
+	}{
+		{"# name: a\n@daily a\n# cronic: after=a\n@daily b\n", ""},
+		{"# name: a\n# cronic: if-env=CRONIC_TEST_UNSET\n@daily a\n# name: c\n@daily c\n", ""},
+		{"# name: a\n# cronic: if-env=CRONIC_TEST_UNSET\n@daily a\n# cronic: after=a\n@daily b\n", `The job on line 5 runs after job "a", which was left out`},
+		{"# name: a\n# cronic: if-env=CRONIC_TEST_UNSET\n@daily a\n# name: b\n# cronic: after=a\n@daily b\n", `Job "b" runs after job "a", which was left out`},
+	} {
+		tab, err := ParseCrontab(bytes.NewBufferString(tt.crontab))
+		if !assert.Nil(t, err, tt.crontab) {
+			continue
+		}
+
+		tab.RemoveDisabled()
+		err = tab.CheckDependencies()
+		if tt.err == "" {
+			assert.Nil(t, err, tt.crontab)
+		} else if assert.NotNil(t, err, tt.crontab) {
+			assert.Contains(t, err.Error(), tt.err, tt.crontab)
+		}
+	}
+}
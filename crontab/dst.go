@@ -0,0 +1,107 @@
+package crontab
+
+import (
+	"strings"
+	"time"
+)
+
+// wallClockExpression runs a schedule by the wall clock, handling daylight
+// saving time transitions like Vixie cron does:
+//
+//   - When the clock jumps forward, jobs with fixed times (e.g. "30 2 * * *")
+//     that would have run in the skipped hour run once, right after the
+//     jump. Jobs that run every hour (or minute, or second) don't run in
+//     the skipped hour.
+//   - When the clock goes back, jobs with fixed times don't run again in the
+//     repeated hour, but jobs that run every hour (or minute, or second) do.
+//
+// The wrapped expression is evaluated in UTC, where wall clock times don't
+// repeat or skip.
+type wallClockExpression struct {
+	Expression
+
+	// Whether the schedule's seconds, minutes or hours are a wildcard (e.g.
+	// "*", or "*/15"), which is what makes a job "fixed" for Vixie cron
+	wildcard bool
+}
+
+// newWallClockExpression wraps expr, a cronexpr expression whose fields are
+// fields (which tell whether it's a wildcard).
+func newWallClockExpression(expr Expression, fields []string) *wallClockExpression {
+	var timeFields []string
+
+	switch len(fields) {
+	case 1:
+		return &wallClockExpression{expr, strings.ToLower(fields[0]) == "@hourly"}
+	case 5, 6:
+		timeFields = fields[:2]
+	default:
+		timeFields = fields[:3]
+	}
+
+	for _, field := range timeFields {
+		if strings.HasPrefix(field, "*") {
+			return &wallClockExpression{expr, true}
+		}
+	}
+	return &wallClockExpression{expr, false}
+}
+
+// Next returns the next run after fromTime, going through the periods
+// between the transitions of fromTime's location, in which the offset from
+// UTC doesn't change.
+func (e *wallClockExpression) Next(fromTime time.Time) time.Time {
+	location := fromTime.Location()
+
+	start, end := fromTime.ZoneBounds()
+	_, offset := fromTime.Zone()
+	search := wallClock(fromTime, offset)
+
+	// Fixed jobs don't run again if the clock went back at the start of the
+	// period
+	if !e.wildcard && !start.IsZero() {
+		_, previousOffset := start.Add(-time.Nanosecond).Zone()
+		if repeatedUntil := wallClock(start, offset).Add(time.Duration(previousOffset-offset) * time.Second); repeatedUntil.After(search) {
+			search = repeatedUntil.Add(-time.Nanosecond)
+		}
+	}
+
+	for {
+		next := e.Expression.Next(search)
+		if next.IsZero() {
+			return next
+		}
+
+		run := time.Unix(next.Unix()-int64(offset), int64(next.Nanosecond())).In(location)
+		if end.IsZero() || run.Before(end) {
+			return run
+		}
+
+		// The run is after the end of the period: the next period starts
+		// on another wall clock time
+		_, nextOffset := end.Zone()
+		endWallClock := wallClock(end, offset)
+
+		if nextOffset > offset && !e.wildcard {
+			// The clock jumps forward, over the run
+			if next.Before(endWallClock.Add(time.Duration(nextOffset-offset) * time.Second)) {
+				return end.In(location)
+			}
+		}
+
+		search = wallClock(end, nextOffset).Add(-time.Nanosecond)
+		if nextOffset < offset && !e.wildcard {
+			// The clock goes back, over runs that fixed jobs already had
+			search = endWallClock.Add(-time.Nanosecond)
+		}
+
+		offset = nextOffset
+		_, end = end.ZoneBounds()
+	}
+}
+
+// wallClock returns the wall clock time of t at offset (in seconds east of
+// UTC), as a time in UTC.
+func wallClock(t time.Time, offset int) time.Time {
+	return t.UTC().Add(time.Duration(offset) * time.Second)
+}
@@ -0,0 +1,76 @@
+package crontab
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// In Paris, the clock jumps from 02:00 CET to 03:00 CEST on March 25th 2018,
+// and goes back from 03:00 CEST to 02:00 CET on October 28th 2018.
+var dstTestCases = []struct {
+	line     string
+	from     string
+	expected []string
+}{
+	// Fixed jobs in the skipped hour run once, right after the jump
+	{"30 2 * * * x", "2018-03-25T00:00", []string{"03-25 03:00 CEST", "03-26 02:30 CEST"}},
+	{"0,30 2 * * * x", "2018-03-25T00:00", []string{"03-25 03:00 CEST", "03-26 02:00 CEST"}},
+	{"30 1 * * * x", "2018-03-25T00:00", []string{"03-25 01:30 CET", "03-26 01:30 CEST"}},
+	{"30 3 * * * x", "2018-03-25T00:00", []string{"03-25 03:30 CEST", "03-26 03:30 CEST"}},
+	{"@daily x", "2018-03-24T12:00", []string{"03-25 00:00 CET", "03-26 00:00 CEST"}},
+	{"@systemd *-*-* 02:30 x", "2018-03-25T00:00", []string{"03-25 03:00 CEST", "03-26 02:30 CEST"}},
+	{"@quartz 0 30 2 ? * * x", "2018-03-25T00:00", []string{"03-25 03:00 CEST", "03-26 02:30 CEST"}},
+
+	// Wildcard jobs don't run in the skipped hour
+	{"0 * * * * x", "2018-03-25T00:30", []string{"03-25 01:00 CET", "03-25 03:00 CEST", "03-25 04:00 CEST"}},
+	{"*/30 2-3 * * * x", "2018-03-25T00:00", []string{"03-25 03:00 CEST", "03-25 03:30 CEST", "03-26 02:00 CEST"}},
+
+	// Fixed jobs in the repeated hour only run the first time
+	{"30 2 * * * x", "2018-10-28T00:00", []string{"10-28 02:30 CEST", "10-29 02:30 CET"}},
+	{"0,30 2 * * * x", "2018-10-28T02:45", []string{"10-29 02:00 CET", "10-29 02:30 CET"}},
+	{"@systemd *-*-* 02:30 x", "2018-10-28T00:00", []string{"10-28 02:30 CEST", "10-29 02:30 CET"}},
+
+	// Wildcard jobs run both times
+	{"*/30 * * * * x", "2018-10-28T01:45", []string{"10-28 02:00 CEST", "10-28 02:30 CEST", "10-28 02:00 CET", "10-28 02:30 CET", "10-28 03:00 CET"}},
+	{"@hourly x", "2018-10-28T00:30", []string{"10-28 01:00 CEST", "10-28 02:00 CEST", "10-28 02:00 CET", "10-28 03:00 CET"}},
+}
+
+func TestWallClockExpressionHandlesDST(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	for _, tt := range dstTestCases {
+		label := fmt.Sprintf("%q from %s", tt.line, tt.from)
+
+		line, err := parseJobLine(tt.line)
+		if !assert.Nil(t, err, label) {
+			continue
+		}
+
+		from, err := time.ParseInLocation("2006-01-02T15:04", tt.from, paris)
+		if !assert.Nil(t, err, label) {
+			continue
+		}
+
+		runs := make([]string, len(tt.expected))
+		for i := range runs {
+			from = line.Expression.Next(from)
+			runs[i] = from.Format("01-02 15:04 MST")
+		}
+		assert.Equal(t, tt.expected, runs, label)
+	}
+}
+
+func TestWallClockExpressionInTimezone(t *testing.T) {
+	line, err := parseJobLine("@systemd *-*-* 02:30 Europe/Paris x")
+	if assert.Nil(t, err) {
+		// 00:00 CET, in UTC
+		next := line.Expression.Next(time.Date(2018, 3, 24, 23, 0, 0, 0, time.UTC))
+		assert.Equal(t, time.Date(2018, 3, 25, 1, 0, 0, 0, time.UTC), next.UTC())
+	}
+}
@@ -0,0 +1,39 @@
+package crontab
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseEnvPatterns parses a comma-separated list of environment variable
+// names, or prefixes ending in "*" (e.g. "AWS_*"), like the allowed_env of
+// namespaces.
+func ParseEnvPatterns(value string) ([]string, error) {
+	patterns := make([]string, 0)
+	for _, pattern := range strings.Split(value, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			return nil, fmt.Errorf("empty pattern in %q", value)
+		}
+		if strings.Contains(strings.TrimSuffix(pattern, "*"), "*") || strings.ContainsAny(pattern, "= \t") {
+			return nil, fmt.Errorf("bad pattern %q (expected a variable name, or a prefix ending in *)", pattern)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// MatchesEnvPattern reports whether the environment variable name matches
+// one of patterns (see ParseEnvPatterns).
+func MatchesEnvPattern(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "*") {
+			if strings.HasPrefix(name, strings.TrimSuffix(pattern, "*")) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package crontab
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EventType identifies the job events that notifications can be sent for.
+type EventType string
+
+const (
+	EventStart   EventType = "start"
+	EventSuccess EventType = "success"
+	EventFailure EventType = "failure"
+	EventTimeout EventType = "timeout"
+	EventSkip    EventType = "skip"
+)
+
+var EventTypes = []EventType{EventStart, EventSuccess, EventFailure, EventTimeout, EventSkip}
+
+// ParseEventTypes parses a comma-separated list of event types, e.g.
+// "failure,timeout".
+func ParseEventTypes(list string) ([]EventType, error) {
+	eventTypes := make([]EventType, 0)
+
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		eventType, ok := findEventType(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown event %q (expected one of %s)", name, eventTypeNames())
+		}
+
+		eventTypes = append(eventTypes, eventType)
+	}
+
+	if len(eventTypes) == 0 {
+		return nil, fmt.Errorf("no events in %q", list)
+	}
+
+	return eventTypes, nil
+}
+
+func findEventType(name string) (EventType, bool) {
+	for _, eventType := range EventTypes {
+		if string(eventType) == name {
+			return eventType, true
+		}
+	}
+	return "", false
+}
+
+func eventTypeNames() string {
+	names := make([]string, 0, len(EventTypes))
+	for _, eventType := range EventTypes {
+		names = append(names, string(eventType))
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,38 @@
+package crontab
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var parseEventTypesTestCases = []struct {
+	list     string
+	expected []EventType
+}{
+	{"failure", []EventType{EventFailure}},
+	{"failure,timeout", []EventType{EventFailure, EventTimeout}},
+	{" start , success,", []EventType{EventStart, EventSuccess}},
+
+	// Failure cases
+	{"", nil},
+	{",", nil},
+	{"failure,explosion", nil},
+}
+
+func TestParseEventTypes(t *testing.T) {
+	for _, tt := range parseEventTypesTestCases {
+		label := fmt.Sprintf("ParseEventTypes(%q)", tt.list)
+
+		eventTypes, err := ParseEventTypes(tt.list)
+
+		if tt.expected == nil {
+			assert.Nil(t, eventTypes, label)
+			assert.NotNil(t, err, label)
+		} else {
+			assert.Nil(t, err, label)
+			assert.Equal(t, tt.expected, eventTypes, label)
+		}
+	}
+}
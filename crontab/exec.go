@@ -0,0 +1,93 @@
+package crontab
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Commands starting with EXEC_PREFIX are run directly, without a shell.
+const EXEC_PREFIX = "exec:"
+
+// SplitArgs splits a command into arguments, for commands that run without a
+// shell. Arguments are separated by whitespace, which can be included in an
+// argument using quotes: single quotes are taken literally, and a backslash
+// escapes the next character outside of them. Nothing else is special (e.g.
+// there are no variables, globs, or redirections).
+func SplitArgs(command string) ([]string, error) {
+	args := make([]string, 0)
+
+	var (
+		arg     strings.Builder
+		inArg   bool
+		quote   rune
+		escaped bool
+	)
+
+	for _, c := range command {
+		switch {
+		case escaped:
+			arg.WriteRune(c)
+			escaped = false
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				arg.WriteRune(c)
+			}
+		case c == '\\':
+			escaped = true
+			inArg = true
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			} else {
+				arg.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(c)
+			inArg = true
+		}
+	}
+
+	if escaped {
+		return nil, fmt.Errorf("command ends with a backslash")
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+
+	if inArg {
+		args = append(args, arg.String())
+	}
+
+	if len(args) == 0 {
+		return nil, fmt.Errorf("missing command after %q", EXEC_PREFIX)
+	}
+
+	return args, nil
+}
+
+// parseExec sets the job's Argv if its command starts with EXEC_PREFIX.
+func (job *Job) parseExec() error {
+	if !strings.HasPrefix(job.Command, EXEC_PREFIX) {
+		return nil
+	}
+
+	argv, err := SplitArgs(job.Command[len(EXEC_PREFIX):])
+	if err != nil {
+		return err
+	}
+
+	job.Argv = argv
+	return nil
+}
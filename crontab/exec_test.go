@@ -0,0 +1,60 @@
+package crontab
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var splitArgsTestCases = []struct {
+	command  string
+	expected []string
+}{
+	{"backup", []string{"backup"}},
+	{"  /usr/bin/backup  --all\t-v ", []string{"/usr/bin/backup", "--all", "-v"}},
+	{`echo 'a b' "c d"`, []string{"echo", "a b", "c d"}},
+	{`echo '$HOME; rm -rf /' "it's" 'say "hi"'`, []string{"echo", "$HOME; rm -rf /", "it's", `say "hi"`}},
+	{`echo a\ b \"c\" "d\"e" '\'`, []string{"echo", "a b", `"c"`, `d"e`, `\`}},
+	{`echo '' ""`, []string{"echo", "", ""}},
+	{`echo a'b'"c"`, []string{"echo", "abc"}},
+
+	// Failure cases
+	{"", nil},
+	{"   ", nil},
+	{"echo 'a", nil},
+	{`echo "a`, nil},
+	{`echo a\`, nil},
+}
+
+func TestSplitArgs(t *testing.T) {
+	for _, tt := range splitArgsTestCases {
+		label := fmt.Sprintf("SplitArgs(%q)", tt.command)
+
+		args, err := SplitArgs(tt.command)
+
+		if tt.expected == nil {
+			assert.NotNil(t, err, label)
+		} else if assert.Nil(t, err, label) {
+			assert.Equal(t, tt.expected, args, label)
+		}
+	}
+}
+
+func TestParseCrontabSplitsExecCommands(t *testing.T) {
+	crontab, err := ParseCrontab(bytes.NewBufferString("* * * * * exec: echo 'a b'\n* * * * * echo 'a b'\n"))
+	if assert.Nil(t, err) && assert.Equal(t, 2, len(crontab.Jobs)) {
+		assert.Equal(t, []string{"echo", "a b"}, crontab.Jobs[0].Argv)
+		assert.Equal(t, "exec: echo 'a b'", crontab.Jobs[0].Command)
+		assert.Nil(t, crontab.Jobs[1].Argv)
+	}
+
+	_, err = ParseCrontab(bytes.NewBufferString("* * * * * exec: echo 'a b\n"))
+	assert.NotNil(t, err)
+
+	job, err := NewJob("@hourly", "exec: echo hi", nil)
+	if assert.Nil(t, err) {
+		assert.Equal(t, []string{"echo", "hi"}, job.Argv)
+	}
+}
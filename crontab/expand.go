@@ -0,0 +1,234 @@
+package crontab
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var (
+	// e.g. "${ENVIRONMENT}", or "${REGION:-us-east-1}", or "$${HOME}" (which
+	// is left to the shell, as "${HOME}")
+	variableMatcher = regexp.MustCompile(`^\$?\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+	// e.g. "@vault:secret/data/app#password", or "@/run/secrets/password" (see
+	// the secrets package), but not "@midnight"
+	secretReferenceMatcher = regexp.MustCompile(`^@(@|/|[a-z][a-z0-9-]*:)`)
+)
+
+// variables are what expand replaces "${VAR}" with: the first of environs
+// that sets VAR, or else cronic's environment, less the variables the
+// Parser's EnvAllow and EnvDeny, or the job's own allow and deny patterns,
+// exclude.
+type variables struct {
+	environs     []map[string]string
+	inheritAllow []string
+	inheritDeny  []string
+	allow, deny  []string
+}
+
+// jobVariables returns the variables of a job with the given annotations:
+// those environs set, and those of cronic's environment it inherits given
+// its env-allow and env-deny annotations. Bad patterns are reported when
+// the annotations are applied, so until then they exclude everything.
+func (p *Parser) jobVariables(annotations map[string]string, environs ...map[string]string) variables {
+	vars := variables{
+		environs:     environs,
+		inheritAllow: p.EnvAllow,
+		inheritDeny:  p.EnvDeny,
+	}
+
+	if value, ok := annotations["env-allow"]; ok {
+		patterns, err := ParseEnvPatterns(value)
+		if err != nil {
+			patterns = []string{}
+		}
+		vars.allow = patterns
+	}
+
+	if value, ok := annotations["env-deny"]; ok {
+		patterns, err := ParseEnvPatterns(value)
+		if err != nil {
+			patterns = []string{"*"}
+		}
+		vars.deny = patterns
+	}
+
+	return vars
+}
+
+func (v variables) lookup(key string) (string, bool) {
+	for _, environ := range v.environs {
+		if value, ok := environ[key]; ok {
+			return value, true
+		}
+	}
+
+	if excludesEnv(v.inheritAllow, v.inheritDeny, key) || excludesEnv(v.allow, v.deny, key) {
+		return "", false
+	}
+
+	return os.LookupEnv(key)
+}
+
+// excludesEnv reports whether the environment variable name is excluded by
+// allow (if set) or deny.
+func excludesEnv(allow, deny []string, name string) bool {
+	return allow != nil && !MatchesEnvPattern(allow, name) || MatchesEnvPattern(deny, name)
+}
+
+// expandVariables replaces "${VAR}" in s with the value of VAR in vars
+// (see variables). "${VAR:-value}"
+// is replaced with value if VAR isn't set (or is empty), and "${VAR}" is
+// left as-is if it isn't set, so that the shell can expand it when the job
+// runs. So is "${VAR}" if VAR refers to a secret, which is only resolved
+// when the job starts. "$${VAR}" is replaced with "${VAR}". Values are
+// inserted as-is (see expandCommand for commands).
+func (p *Parser) expandVariables(s string, vars variables) string {
+	if !p.ExpandVariables {
+		return s
+	}
+
+	expanded, _ := expand(s, false, vars)
+	return expanded
+}
+
+// expandCommand replaces "${VAR}" in a shell command like expandVariables,
+// but quotes values so that the shell takes them literally, and leaves
+// "${VAR}" as-is between single quotes, where the shell wouldn't expand it.
+func (p *Parser) expandCommand(command string, vars variables) string {
+	if !p.ExpandVariables {
+		return command
+	}
+
+	expanded, _ := expand(command, true, vars)
+	return expanded
+}
+
+// expandJobLine parses a job line once its variables are expanded, as-is so
+// that they can be part of its schedule (e.g. "*/${EVERY}"). Its command is
+// then expanded again from the line as written, with expandCommand.
+func (p *Parser) expandJobLine(line string, vars variables) (*CrontabLine, error) {
+	if !p.ExpandVariables {
+		return p.parseJobLine(line)
+	}
+
+	expanded, replacements := expand(line, false, vars)
+
+	jobLine, err := p.parseJobLine(expanded)
+	if err != nil || len(replacements) == 0 || !strings.HasSuffix(expanded, jobLine.Command) {
+		return jobLine, err
+	}
+
+	// Where the command starts in the line as written
+	commandStarts := len(expanded) - len(jobLine.Command)
+	start := commandStarts
+	for _, r := range replacements {
+		if r.expandedStart >= commandStarts {
+			break
+		}
+		if r.expandedEnd > commandStarts {
+			return nil, fmt.Errorf("CRONIC: Bad crontab line: %s (%s is part of both the schedule and the command)", line, line[r.start:r.end])
+		}
+		start += (r.end - r.start) - (r.expandedEnd - r.expandedStart)
+	}
+
+	jobLine.Command = p.expandCommand(line[start:], vars)
+	return jobLine, nil
+}
+
+// replacement is where expand replaced a variable, in the string as written
+// and as expanded.
+type replacement struct {
+	start, end                 int
+	expandedStart, expandedEnd int
+}
+
+// expand replaces the variables of s (see expandVariables), quoting their
+// values for the shell if quote is set (see expandCommand), and returns
+// where it replaced them.
+func expand(s string, quote bool, vars variables) (string, []replacement) {
+	var (
+		b            strings.Builder
+		replacements []replacement
+		quoted       byte
+	)
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		if quote {
+			switch {
+			case quoted == '\'':
+				if c == '\'' {
+					quoted = 0
+				}
+				b.WriteByte(c)
+				continue
+			case c == '\\' && i+1 < len(s):
+				b.WriteString(s[i : i+2])
+				i++
+				continue
+			case c == '"':
+				quoted ^= '"'
+			case c == '\'' && quoted == 0:
+				quoted = '\''
+			}
+		}
+
+		var m []int
+		if c == '$' {
+			m = variableMatcher.FindStringSubmatchIndex(s[i:])
+		}
+		if m == nil {
+			b.WriteByte(c)
+			continue
+		}
+
+		match := s[i : i+m[1]]
+		value := match
+		v, ok := vars.lookup(s[i+m[2] : i+m[3]])
+		switch {
+		case strings.HasPrefix(match, "$$"):
+			value = match[1:]
+		case ok && secretReferenceMatcher.MatchString(v):
+			// Left to the shell, which gets the secret once it's resolved
+		case m[4] != -1 && (!ok || v == ""):
+			value = s[i+m[4] : i+m[5]]
+		case ok:
+			value = v
+			if quote {
+				value = shellQuote(v, quoted == '"')
+			}
+		}
+
+		replacements = append(replacements, replacement{
+			start:         i,
+			end:           i + m[1],
+			expandedStart: b.Len(),
+			expandedEnd:   b.Len() + len(value),
+		})
+		b.WriteString(value)
+		i += m[1] - 1
+	}
+
+	return b.String(), replacements
+}
+
+// shellQuote quotes s so that shells take it literally, between double
+// quotes if inDoubleQuotes is set, or else on its own.
+func shellQuote(s string, inDoubleQuotes bool) string {
+	if inDoubleQuotes {
+		var b strings.Builder
+		for _, c := range s {
+			if strings.ContainsRune("\\\"$`", c) {
+				b.WriteByte('\\')
+			}
+			b.WriteRune(c)
+		}
+		return b.String()
+	}
+
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,168 @@
+package crontab
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var expandVariablesTestCases = []struct {
+	s        string
+	expected string
+}{
+	{"echo ${FOO}", "echo crontab"},
+	{"echo ${CRONIC_TEST_PROCESS}", "echo process"},
+	{"echo ${FOO}-${CRONIC_TEST_PROCESS}", "echo crontab-process"},
+	{"echo ${EMPTY}.", "echo ."},
+
+	// Unset variables are left to the shell, unless they have a default
+	{"echo ${CRONIC_TEST_UNSET}", "echo ${CRONIC_TEST_UNSET}"},
+	{"echo ${CRONIC_TEST_UNSET:-default}", "echo default"},
+	{"echo ${EMPTY:-default}", "echo default"},
+	{"echo ${FOO:-default}", "echo crontab"},
+	{"echo ${CRONIC_TEST_UNSET:-}", "echo "},
+
+	// Other forms aren't expanded, and $${VAR} is left to the shell
+	{"echo $FOO ${1} ${FOO", "echo $FOO ${1} ${FOO"},
+	{"echo $${FOO} $$${FOO}", "echo ${FOO} $${FOO}"},
+}
+
+var expandCommandTestCases = []struct {
+	s        string
+	expected string
+}{
+	{"echo ${FOO}", "echo 'crontab'"},
+	{"echo ${MSG}", `echo 'hello world; rm -rf /tmp/x'`},
+	{"echo ${QUOTE}", `echo 'it'\''s'`},
+	{`echo "${MSG}"`, `echo "hello world; rm -rf /tmp/x"`},
+	{`echo "${SHELL_SYNTAX}"`, `echo "\"\$(id)\` + "`" + `\\"`},
+
+	// The shell wouldn't expand variables between single quotes
+	{"echo '${FOO}' ${FOO}", "echo '${FOO}' 'crontab'"},
+	{`echo "'${FOO}'"`, `echo "'crontab'"`},
+	{`echo \'${FOO}`, `echo \''crontab'`},
+
+	// Defaults are inserted as written, and $${VAR} is left to the shell
+	{"echo ${CRONIC_TEST_UNSET:-$HOME}", "echo $HOME"},
+	{"echo $${FOO}", "echo ${FOO}"},
+	{"echo ${CRONIC_TEST_UNSET}", "echo ${CRONIC_TEST_UNSET}"},
+}
+
+func TestExpandVariables(t *testing.T) {
+	p := &Parser{ExpandVariables: true}
+	defer os.Unsetenv("CRONIC_TEST_PROCESS")
+	os.Setenv("CRONIC_TEST_PROCESS", "process")
+	os.Unsetenv("CRONIC_TEST_UNSET")
+
+	environ := map[string]string{"FOO": "crontab", "EMPTY": ""}
+
+	for _, tt := range expandVariablesTestCases {
+		assert.Equal(t, tt.expected, p.expandVariables(tt.s, variables{environs: []map[string]string{environ}}), fmt.Sprintf("expandVariables(%q)", tt.s))
+	}
+}
+
+func TestExpandCommand(t *testing.T) {
+	p := &Parser{ExpandVariables: true}
+	os.Unsetenv("CRONIC_TEST_UNSET")
+
+	environ := map[string]string{
+		"FOO":          "crontab",
+		"MSG":          "hello world; rm -rf /tmp/x",
+		"QUOTE":        "it's",
+		"SHELL_SYNTAX": "\"$(id)`\\",
+	}
+
+	for _, tt := range expandCommandTestCases {
+		assert.Equal(t, tt.expected, p.expandCommand(tt.s, variables{environs: []map[string]string{environ}}), fmt.Sprintf("expandCommand(%q)", tt.s))
+	}
+}
+
+func TestParseCrontabExpandsVariables(t *testing.T) {
+	p := &Parser{ExpandVariables: true}
+
+	tab, err := p.ParseCrontab(bytes.NewBufferString("EVERY=15\nENV=staging\n*/${EVERY} * * * * ./report.sh ${ENV}\nENV=prod\n@hourly echo ${ENV}\n"), "")
+	if assert.Nil(t, err) && assert.Equal(t, 2, len(tab.Jobs)) {
+		assert.Equal(t, "*/15 * * * *", tab.Jobs[0].Schedule)
+		assert.Equal(t, "./report.sh 'staging'", tab.Jobs[0].Command)
+		assert.Equal(t, "echo 'prod'", tab.Jobs[1].Command)
+	}
+
+	// Values are quoted in commands, but not in schedules
+	tab, err = p.ParseCrontab(bytes.NewBufferString("SCHEDULE=@hourly\nMSG=hello world; rm -rf /tmp/x\n${SCHEDULE} echo ${MSG} '${MSG}' $${MSG}\n"), "")
+	if assert.Nil(t, err) && assert.Equal(t, 1, len(tab.Jobs)) {
+		assert.Equal(t, "@hourly", tab.Jobs[0].Schedule)
+		assert.Equal(t, `echo 'hello world; rm -rf /tmp/x' '${MSG}' ${MSG}`, tab.Jobs[0].Command)
+	}
+
+	// A variable can't be part of both
+	_, err = p.ParseCrontab(bytes.NewBufferString("JOB=@hourly echo hi\n${JOB}\n"), "")
+	assert.NotNil(t, err)
+
+	tab, err = p.ParseConfig(bytes.NewBufferString("env: {ENV: staging}\njobs:\n  - {schedule: '@hourly', command: 'echo ${ENV}'}\n  - {schedule: '@hourly', command: 'echo ${ENV}', env: {ENV: prod}}\n"))
+	if assert.Nil(t, err) && assert.Equal(t, 2, len(tab.Jobs)) {
+		assert.Equal(t, "echo 'staging'", tab.Jobs[0].Command)
+		assert.Equal(t, "echo 'prod'", tab.Jobs[1].Command)
+	}
+
+	tab, err = ParseCrontab(bytes.NewBufferString("ENV=staging\n@hourly echo ${ENV}\n"))
+	if assert.Nil(t, err) && assert.Equal(t, 1, len(tab.Jobs)) {
+		assert.Equal(t, "echo ${ENV}", tab.Jobs[0].Command)
+	}
+}
+
+func TestParseCrontabExpandsOnlyInheritedVariables(t *testing.T) {
+	p := &Parser{ExpandVariables: true}
+	defer os.Unsetenv("CRONIC_TEST_MSG")
+	defer os.Unsetenv("CRONIC_TEST_SECRET")
+
+	os.Setenv("CRONIC_TEST_MSG", "hello world; rm -rf /tmp/x")
+	os.Setenv("CRONIC_TEST_SECRET", "hunter2")
+
+	tab, err := p.ParseCrontab(bytes.NewBufferString(`@hourly echo ${CRONIC_TEST_MSG} ${CRONIC_TEST_SECRET}
+# cronic: env-deny=CRONIC_TEST_SECRET
+@hourly echo ${CRONIC_TEST_MSG} ${CRONIC_TEST_SECRET}
+# cronic: env-allow=CRONIC_TEST_MSG
+@hourly echo ${CRONIC_TEST_MSG} ${CRONIC_TEST_SECRET:-none}
+CRONIC_TEST_SECRET=crontab
+# cronic: env-deny=CRONIC_TEST_*
+@hourly echo ${CRONIC_TEST_MSG} ${CRONIC_TEST_SECRET}
+`), "")
+	if assert.Nil(t, err) && assert.Equal(t, 4, len(tab.Jobs)) {
+		assert.Equal(t, `echo 'hello world; rm -rf /tmp/x' 'hunter2'`, tab.Jobs[0].Command)
+		assert.Equal(t, `echo 'hello world; rm -rf /tmp/x' ${CRONIC_TEST_SECRET}`, tab.Jobs[1].Command)
+		assert.Equal(t, `echo 'hello world; rm -rf /tmp/x' none`, tab.Jobs[2].Command)
+
+		// Variables set in the crontab are always passed
+		assert.Equal(t, `echo ${CRONIC_TEST_MSG} 'crontab'`, tab.Jobs[3].Command)
+	}
+
+	// Like -env-allow and -env-deny
+	p.EnvAllow, p.EnvDeny = []string{"CRONIC_TEST_*"}, []string{"CRONIC_TEST_SECRET"}
+
+	tab, err = p.ParseConfig(bytes.NewBufferString(`jobs:
+  - {schedule: '@hourly', command: 'echo ${CRONIC_TEST_MSG} ${CRONIC_TEST_SECRET} ${HOME}'}
+  - {schedule: '@hourly', command: 'echo ${CRONIC_TEST_MSG}', annotations: {env-deny: CRONIC_TEST_MSG}}
+`))
+	if assert.Nil(t, err) && assert.Equal(t, 2, len(tab.Jobs)) {
+		assert.Equal(t, `echo 'hello world; rm -rf /tmp/x' ${CRONIC_TEST_SECRET} ${HOME}`, tab.Jobs[0].Command)
+		assert.Equal(t, `echo ${CRONIC_TEST_MSG}`, tab.Jobs[1].Command)
+	}
+}
+
+func TestParseCrontabLeavesSecretsToTheShell(t *testing.T) {
+	p := &Parser{ExpandVariables: true}
+
+	tab, err := p.ParseCrontab(bytes.NewBufferString(`DB_PASSWORD=@vault:secret/data/app#password
+DB_PASSWORD_FILE=@/run/secrets/db-password
+LABEL=@@/home
+SCHEDULE=@midnight
+${SCHEDULE} pg_dump --password=${DB_PASSWORD} --password-file="${DB_PASSWORD_FILE:-none}" --label ${LABEL}
+`), "")
+	if assert.Nil(t, err) && assert.Equal(t, 1, len(tab.Jobs)) {
+		assert.Equal(t, "@midnight", tab.Jobs[0].Schedule)
+		assert.Equal(t, `pg_dump --password=${DB_PASSWORD} --password-file="${DB_PASSWORD_FILE:-none}" --label ${LABEL}`, tab.Jobs[0].Command)
+	}
+}
@@ -0,0 +1,86 @@
+package crontab
+
+import (
+	"fmt"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+// Crontab formats, which tell whether job lines have a user field between the
+// schedule and the command.
+const (
+	// Pick the format of each file: system crontabs are /etc/crontab and the
+	// files in /etc/cron.d, and crontabs whose first job's command starts
+	// with the name of a user (that isn't also a command)
+	FormatAuto = "auto"
+
+	// Job lines are a schedule and a command, like in crontab -e
+	FormatUser = "user"
+
+	// Job lines are a schedule, a user and a command, like in /etc/crontab
+	FormatSystem = "system"
+)
+
+var (
+	crontabFormats = []string{FormatAuto, FormatUser, FormatSystem}
+
+	// Where system crontabs live (a file, or a directory of files)
+	systemCrontabPaths = []string{"/etc/crontab", "/etc/cron.d"}
+
+	// Stubbed in tests, which can't rely on the users of the host
+	lookupUser = func(name string) error {
+		_, err := user.Lookup(name)
+		return err
+	}
+)
+
+// ParseCrontabFormat checks that format is one of FormatAuto, FormatUser or
+// FormatSystem.
+func ParseCrontabFormat(format string) (string, error) {
+	if !containsString(crontabFormats, format) {
+		return "", fmt.Errorf("unknown crontab format %q (expected one of %s)", format, strings.Join(crontabFormats, ", "))
+	}
+	return format, nil
+}
+
+// detectFormat picks the format of the crontab file at path (which can be
+// empty), given the command of its first job line, when parsing with
+// FormatAuto.
+func detectFormat(path string, command string) string {
+	if path != "" {
+		path = filepath.Clean(path)
+		for _, systemPath := range systemCrontabPaths {
+			if path == systemPath || filepath.Dir(path) == systemPath {
+				return FormatSystem
+			}
+		}
+	}
+
+	fields := strings.Fields(command)
+	if len(fields) < 2 || strings.ContainsAny(fields[0], "/=") {
+		return FormatUser
+	}
+
+	if lookupUser(fields[0]) != nil {
+		return FormatUser
+	}
+
+	// e.g. a "backup" command, on a host with a "backup" user
+	if _, err := exec.LookPath(fields[0]); err == nil {
+		return FormatUser
+	}
+
+	return FormatSystem
+}
+
+// splitUser splits the user field off the command of a job line in a system
+// crontab.
+func splitUser(command string) (string, string, error) {
+	fields := jobLineSeparator.FindAllStringIndex(command, 2)
+	if len(fields) < 2 {
+		return "", "", fmt.Errorf("missing command after user %q", command)
+	}
+	return command[:fields[0][1]], command[fields[1][0]:], nil
+}
@@ -0,0 +1,79 @@
+package crontab
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var crontabFormatTestCases = []struct {
+	format   string
+	path     string
+	crontab  string
+	users    []string
+	commands []string
+}{
+	{FormatUser, "", "* * * * * alice echo hi\n", []string{""}, []string{"alice echo hi"}},
+	{FormatSystem, "", "* * * * * alice echo hi\n@hourly  bob   ./backup.sh\n", []string{"alice", "bob"}, []string{"echo hi", "./backup.sh"}},
+	{FormatSystem, "", "# cronic: quiet\n* * * * * alice exec: echo hi\n", []string{"alice"}, []string{"exec: echo hi"}},
+
+	// Detected from the path
+	{FormatAuto, "/etc/crontab", "* * * * * alice echo hi\n", []string{"alice"}, []string{"echo hi"}},
+	{FormatAuto, "/etc/cron.d/backups", "* * * * * nobody-known echo hi\n", []string{"nobody-known"}, []string{"echo hi"}},
+
+	// Detected from the first job's command
+	{FormatAuto, "", "* * * * * alice echo hi\n* * * * * bob echo bye\n", []string{"alice", "bob"}, []string{"echo hi", "echo bye"}},
+	{FormatAuto, "", "* * * * * echo hi\n* * * * * alice echo bye\n", []string{"", ""}, []string{"echo hi", "alice echo bye"}},
+	{FormatAuto, "", "* * * * * alice\n", []string{""}, []string{"alice"}},
+	{FormatAuto, "", "* * * * * ls -l\n", []string{""}, []string{"ls -l"}},
+
+	// Failure cases
+	{FormatSystem, "", "* * * * * alice\n", nil, nil},
+}
+
+func TestParseCrontabFormats(t *testing.T) {
+	defer func(lookup func(string) error) {
+		lookupUser = lookup
+	}(lookupUser)
+
+	// "ls" is a user too, but also a command
+	lookupUser = func(name string) error {
+		if name == "alice" || name == "bob" || name == "ls" {
+			return nil
+		}
+		return errors.New("unknown user")
+	}
+
+	for _, tt := range crontabFormatTestCases {
+		label := fmt.Sprintf("ParseCrontabAt(%q, %q) in %s format", tt.crontab, tt.path, tt.format)
+
+		parser := &Parser{Format: tt.format}
+		crontab, err := parser.ParseCrontab(bytes.NewBufferString(tt.crontab), tt.path)
+
+		if tt.users == nil {
+			assert.NotNil(t, err, label)
+			continue
+		}
+
+		if assert.Nil(t, err, label) && assert.Equal(t, len(tt.users), len(crontab.Jobs), label) {
+			for i, job := range crontab.Jobs {
+				assert.Equal(t, tt.users[i], job.User, label)
+				assert.Equal(t, tt.commands[i], job.Command, label)
+			}
+		}
+	}
+}
+
+func TestParseCrontabFormat(t *testing.T) {
+	for _, format := range []string{FormatAuto, FormatUser, FormatSystem} {
+		parsed, err := ParseCrontabFormat(format)
+		assert.Nil(t, err)
+		assert.Equal(t, format, parsed)
+	}
+
+	_, err := ParseCrontabFormat("vixie")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,192 @@
+package crontab
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+const holidayLayout = "2006-01-02"
+
+// Holidays is a calendar of days when the jobs with a skip-holidays
+// annotation don't run (e.g. bank holidays, for financial batch jobs).
+type Holidays struct {
+	days map[string]bool
+}
+
+// ReadHolidays reads holidays from a file, which is either an iCalendar
+// (RFC 5545) file, whose events are holidays, or a list of dates (one per
+// line, like those of @dates-file).
+func ReadHolidays(path string) (*Holidays, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var holidays *Holidays
+	if bytes.Contains(data, []byte("BEGIN:VCALENDAR")) {
+		holidays, err = parseICalHolidays(data)
+	} else {
+		holidays, err = parseHolidayDates(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("CRONIC: Bad holidays in %s: %v", path, err)
+	}
+
+	return holidays, nil
+}
+
+func parseHolidayDates(data []byte) (*Holidays, error) {
+	holidays := &Holidays{days: make(map[string]bool)}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		day, err := ParseDate(line)
+		if err != nil {
+			return nil, err
+		}
+		holidays.add(day)
+	}
+
+	return holidays, scanner.Err()
+}
+
+// parseICalHolidays reads the days of the events of an iCalendar file: the
+// days from their start until their end (excluding it, like iCalendar does
+// for events that last whole days), or the day they start on if they don't
+// last whole days. Days are those of the local time zone, so events with
+// times in UTC or in a TZID of their own count on the local day they start
+// on. Recurring events only count once.
+func parseICalHolidays(data []byte) (*Holidays, error) {
+	holidays := &Holidays{days: make(map[string]bool)}
+
+	var start, end time.Time
+	inEvent := false
+
+	for _, line := range unfoldICalLines(data) {
+		name, params, value := parseICalLine(line)
+
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			start, end = time.Time{}, time.Time{}
+			inEvent = true
+		case name == "DTSTART" && inEvent, name == "DTEND" && inEvent:
+			day, err := parseICalDay(value, params)
+			if err != nil {
+				return nil, fmt.Errorf("bad %s: %q (%v)", name, value, err)
+			}
+
+			// Only events lasting whole days (whose times are dates)
+			// end on a day they don't include
+			if name == "DTSTART" {
+				start = day
+			} else if len(value) == 8 {
+				end = day
+			}
+		case name == "END" && value == "VEVENT":
+			if start.IsZero() {
+				return nil, fmt.Errorf("event without DTSTART")
+			}
+
+			holidays.add(start)
+			for day := start.AddDate(0, 0, 1); day.Before(end); day = day.AddDate(0, 0, 1) {
+				holidays.add(day)
+			}
+			inEvent = false
+		}
+	}
+
+	return holidays, nil
+}
+
+// unfoldICalLines splits data into lines, joining those that were folded
+// (continued on lines starting with whitespace).
+func unfoldICalLines(data []byte) []string {
+	lines := make([]string, 0)
+	for _, line := range strings.Split(strings.Replace(string(data), "\r\n", "\n", -1), "\n") {
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// parseICalDay returns the local day a DTSTART or DTEND falls on: its date
+// (for dates, e.g. "20181225"), or the local date of its time (e.g.
+// "20181224T230000Z" in UTC, or "20181224T230000" in its TZID parameter's
+// time zone, if it has one, and in the local one otherwise).
+func parseICalDay(value string, params map[string]string) (time.Time, error) {
+	if len(value) == 8 {
+		return time.ParseInLocation("20060102", value, time.Local)
+	}
+
+	var t time.Time
+	var err error
+
+	if strings.HasSuffix(value, "Z") {
+		t, err = time.ParseInLocation("20060102T150405Z", value, time.UTC)
+	} else {
+		location := time.Local
+		if tzid, ok := params["TZID"]; ok {
+			if location, err = time.LoadLocation(tzid); err != nil {
+				return time.Time{}, fmt.Errorf("unknown TZID %q", tzid)
+			}
+		}
+		t, err = time.ParseInLocation("20060102T150405", value, location)
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected a date or a time, e.g. 20181225 or 20181225T090000Z")
+	}
+
+	t = t.In(time.Local)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local), nil
+}
+
+// parseICalLine returns the name, the parameters (e.g. ";VALUE=DATE", with
+// their names in upper case) and the value of a content line.
+func parseICalLine(line string) (string, map[string]string, string) {
+	colon := strings.IndexByte(line, ':')
+	if colon == -1 {
+		return "", nil, ""
+	}
+
+	params := make(map[string]string)
+	fields := strings.Split(line[:colon], ";")
+	for _, param := range fields[1:] {
+		if equals := strings.IndexByte(param, '='); equals != -1 {
+			params[strings.ToUpper(param[:equals])] = strings.Trim(param[equals+1:], `"`)
+		}
+	}
+	return strings.ToUpper(fields[0]), params, strings.TrimSpace(line[colon+1:])
+}
+
+func (h *Holidays) add(day time.Time) {
+	h.days[day.Format(holidayLayout)] = true
+}
+
+// Contains reports whether t falls on a holiday (in its location). A nil
+// calendar has no holidays.
+func (h *Holidays) Contains(t time.Time) bool {
+	if h == nil {
+		return false
+	}
+	return h.days[t.Format(holidayLayout)]
+}
+
+// Len returns how many holidays there are.
+func (h *Holidays) Len() int {
+	if h == nil {
+		return 0
+	}
+	return len(h.days)
+}
@@ -0,0 +1,133 @@
+package crontab
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeHolidays(t *testing.T, contents string) string {
+	dir, err := ioutil.TempDir("", "cronic-holidays")
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	path := filepath.Join(dir, "holidays")
+	assert.Nil(t, ioutil.WriteFile(path, []byte(contents), 0644))
+	return path
+}
+
+func day(date string) time.Time {
+	t, _ := time.ParseInLocation("2006-01-02 15:04", date, time.Local)
+	return t
+}
+
+func TestReadHolidaysReadsDates(t *testing.T) {
+	path := writeHolidays(t, "# Bank holidays\n2018-12-25\n\n2018-12-26T00:00\n")
+	defer os.RemoveAll(filepath.Dir(path))
+
+	holidays, err := ReadHolidays(path)
+	if assert.Nil(t, err) {
+		assert.Equal(t, 2, holidays.Len())
+		assert.True(t, holidays.Contains(day("2018-12-25 09:30")))
+		assert.True(t, holidays.Contains(day("2018-12-26 23:59")))
+		assert.False(t, holidays.Contains(day("2018-12-27 00:00")))
+	}
+}
+
+func TestReadHolidaysReadsICalendars(t *testing.T) {
+	path := writeHolidays(t, "BEGIN:VCALENDAR\r\n"+
+		"VERSION:2.0\r\n"+
+		"BEGIN:VEVENT\r\n"+
+		"DTSTART;VALUE=DATE:20181225\r\n"+
+		"DTEND;VALUE=DATE:20181227\r\n"+
+		"SUMMARY:Christmas and\r\n"+
+		"  Boxing Day\r\n"+
+		"END:VEVENT\r\n"+
+		"BEGIN:VEVENT\r\n"+
+		"DTSTART;VALUE=DATE:20190101\r\n"+
+		"SUMMARY:New Year's Day\r\n"+
+		"END:VEVENT\r\n"+
+		"BEGIN:VEVENT\r\n"+
+		"DTSTART;TZID=Europe/London:20190419T090000\r\n"+
+		"DTEND;TZID=Europe/London:20190419T170000\r\n"+
+		"SUMMARY:Good Friday (half day)\r\n"+
+		"END:VEVENT\r\n"+
+		"END:VCALENDAR\r\n")
+	defer os.RemoveAll(filepath.Dir(path))
+
+	holidays, err := ReadHolidays(path)
+	if assert.Nil(t, err) {
+		assert.Equal(t, 4, holidays.Len())
+		assert.True(t, holidays.Contains(day("2018-12-25 00:00")))
+		assert.True(t, holidays.Contains(day("2018-12-26 12:00")))
+		assert.False(t, holidays.Contains(day("2018-12-27 00:00")))
+		assert.True(t, holidays.Contains(day("2019-01-01 00:00")))
+		assert.True(t, holidays.Contains(day("2019-04-19 00:00")))
+	}
+}
+
+func TestReadHolidaysConvertsICalendarTimes(t *testing.T) {
+	path := writeHolidays(t, "BEGIN:VCALENDAR\r\n"+
+		"BEGIN:VEVENT\r\n"+
+		"DTSTART:20181224T230000Z\r\n"+
+		"DTEND:20181225T230000Z\r\n"+
+		"END:VEVENT\r\n"+
+		"BEGIN:VEVENT\r\n"+
+		"DTSTART;TZID=\"Asia/Tokyo\":20190101T080000\r\n"+
+		"END:VEVENT\r\n"+
+		"END:VCALENDAR\r\n")
+	defer os.RemoveAll(filepath.Dir(path))
+
+	defer func(local *time.Location) {
+		time.Local = local
+	}(time.Local)
+
+	for _, tt := range []struct {
+		local    string
+		holidays []string
+	}{
+		{"UTC", []string{"2018-12-24", "2018-12-31"}},
+		{"Europe/Paris", []string{"2018-12-25", "2019-01-01"}},
+		{"America/New_York", []string{"2018-12-24", "2018-12-31"}},
+	} {
+		location, err := time.LoadLocation(tt.local)
+		if !assert.Nil(t, err) {
+			return
+		}
+		time.Local = location
+
+		holidays, err := ReadHolidays(path)
+		if assert.Nil(t, err, tt.local) {
+			assert.Equal(t, len(tt.holidays), holidays.Len(), tt.local)
+			for _, date := range tt.holidays {
+				assert.True(t, holidays.Contains(day(date+" 12:00")), "%s in %s", date, tt.local)
+			}
+		}
+	}
+}
+
+func TestReadHolidaysRejectsBadFiles(t *testing.T) {
+	for _, contents := range []string{
+		"2018-12-25\nchristmas\n",
+		"BEGIN:VCALENDAR\nBEGIN:VEVENT\nSUMMARY:When?\nEND:VEVENT\nEND:VCALENDAR\n",
+		"BEGIN:VCALENDAR\nBEGIN:VEVENT\nDTSTART:2018\nEND:VEVENT\nEND:VCALENDAR\n",
+		"BEGIN:VCALENDAR\nBEGIN:VEVENT\nDTSTART:20181225T09\nEND:VEVENT\nEND:VCALENDAR\n",
+		"BEGIN:VCALENDAR\nBEGIN:VEVENT\nDTSTART;TZID=Nowhere/Special:20181225T090000\nEND:VEVENT\nEND:VCALENDAR\n",
+	} {
+		path := writeHolidays(t, contents)
+		_, err := ReadHolidays(path)
+		assert.NotNil(t, err, contents)
+		os.RemoveAll(filepath.Dir(path))
+	}
+
+	_, err := ReadHolidays("/nonexistent/holidays")
+	assert.True(t, os.IsNotExist(err))
+
+	var holidays *Holidays
+	assert.False(t, holidays.Contains(time.Now()))
+}
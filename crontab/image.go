@@ -0,0 +1,51 @@
+package crontab
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Image pull policies of jobs that run in containers
+const (
+	// Pull the image if it isn't there
+	PullMissing = "missing"
+
+	// Pull the image before each run (e.g. for mutable tags, like latest)
+	PullAlways = "always"
+
+	// Never pull the image, which must be there
+	PullNever = "never"
+)
+
+var pullPolicies = []string{PullMissing, PullAlways, PullNever}
+
+// ParsePullPolicy checks that policy is one of PullMissing, PullAlways or
+// PullNever.
+func ParsePullPolicy(policy string) (string, error) {
+	if !containsString(pullPolicies, policy) {
+		return "", fmt.Errorf("unknown pull policy %q (expected one of %s)", policy, strings.Join(pullPolicies, ", "))
+	}
+	return policy, nil
+}
+
+// ParseMounts parses a comma-separated list of bind mounts, like those of
+// docker run -v: SOURCE:TARGET, with an optional :ro or :rw, and absolute
+// paths.
+func ParseMounts(value string) ([]string, error) {
+	mounts := make([]string, 0)
+	for _, mount := range strings.Split(value, ",") {
+		parts := strings.Split(mount, ":")
+		if len(parts) == 3 && parts[2] != "ro" && parts[2] != "rw" {
+			return nil, fmt.Errorf("bad mount %q (the mode must be ro or rw)", mount)
+		}
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("bad mount %q (expected SOURCE:TARGET[:ro])", mount)
+		}
+		if !filepath.IsAbs(parts[0]) || !filepath.IsAbs(parts[1]) {
+			return nil, fmt.Errorf("bad mount %q (paths must be absolute)", mount)
+		}
+		mounts = append(mounts, mount)
+	}
+	return mounts, nil
+}
@@ -0,0 +1,98 @@
+package crontab
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	// e.g. "#include /etc/cronic.d/*.cron"
+	includeLineMatcher = regexp.MustCompile(`^#include(?:\s+(.*))?$`)
+)
+
+// resolveInclude returns the files an "#include" line in file refers to, in
+// order. Relative patterns are relative to file's directory. A pattern that
+// isn't a glob must match a file, but a glob can match none (e.g. an empty
+// directory of crontab fragments), and the directories it matches are
+// skipped. Files that are already being parsed (i.e. that would include
+// themselves) are rejected.
+func (p *crontabParser) resolveInclude(pattern string, file string) ([]string, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("missing path")
+	}
+
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(filepath.Dir(file), pattern)
+	}
+
+	var paths []string
+
+	if !strings.ContainsAny(pattern, "*?[") {
+		info, err := os.Stat(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			return nil, fmt.Errorf("%s is a directory", pattern)
+		}
+		paths = []string{pattern}
+	} else {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("bad pattern %q: %v", pattern, err)
+		}
+
+		for _, match := range matches {
+			if info, err := os.Stat(match); err == nil && info.IsDir() {
+				continue
+			}
+			paths = append(paths, match)
+		}
+	}
+
+	for _, path := range paths {
+		id, err := includeID(path)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, including := range p.including {
+			if including == id {
+				cycle := append(append([]string{}, p.including[i:]...), id)
+				return nil, fmt.Errorf("include cycle: %s", strings.Join(cycle, " -> "))
+			}
+		}
+	}
+
+	return paths, nil
+}
+
+// parseIncluded parses an included file (see resolveInclude).
+func (p *crontabParser) parseIncluded(reader io.Reader, path string) error {
+	id, err := includeID(path)
+	if err != nil {
+		return err
+	}
+
+	p.including = append(p.including, id)
+	p.depth++
+	defer func() {
+		p.including = p.including[:len(p.including)-1]
+		p.depth--
+	}()
+
+	return p.parse(reader, path)
+}
+
+// includeID identifies a file for cycle detection: its absolute path, with
+// symlinks resolved when it exists.
+func includeID(path string) (string, error) {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	return filepath.Abs(path)
+}
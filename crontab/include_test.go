@@ -0,0 +1,135 @@
+package crontab
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeCrontabFiles(t *testing.T, dir string, files map[string]string) {
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.Nil(t, ioutil.WriteFile(path, []byte(contents), 0644))
+	}
+}
+
+func TestParseCrontabIncludesFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cronic-test")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	writeCrontabFiles(t, dir, map[string]string{
+		"crontab":           "FOO=main\n* * * * * first\n#include cron.d/*.cron\n\n# name: last\n* * * * * last\n",
+		"cron.d/a.cron":     "# cronic: quiet\n@hourly a\n#include ../extra\n",
+		"cron.d/b.cron":     "BAR=b\n@daily \\\n  b\n",
+		"cron.d/ignored":    "* * * * * ignored\n",
+		"cron.d/dir.cron/x": "* * * * * ignored\n",
+		"extra":             "@weekly extra\n",
+	})
+
+	path := filepath.Join(dir, "crontab")
+	contents, err := ioutil.ReadFile(path)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	tab, err := ParseCrontabAt(bytes.NewReader(contents), path)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	expected := []struct {
+		command string
+		file    string
+		line    int
+	}{
+		{"first", path, 2},
+		{"a", filepath.Join(dir, "cron.d/a.cron"), 2},
+		{"extra", filepath.Join(dir, "extra"), 1},
+		{"b", filepath.Join(dir, "cron.d/b.cron"), 2},
+		{"last", path, 6},
+	}
+
+	if assert.Equal(t, len(expected), len(tab.Jobs)) {
+		for i, job := range tab.Jobs {
+			assert.Equal(t, i, job.Position)
+			assert.Equal(t, expected[i].command, job.Command)
+			assert.Equal(t, expected[i].file, job.File, job.Command)
+			assert.Equal(t, expected[i].line, job.Line, job.Command)
+		}
+		assert.True(t, tab.Jobs[1].Quiet)
+		assert.Equal(t, "last", tab.Jobs[4].Name)
+	}
+
+	assert.Equal(t, map[string]string{"FOO": "main", "BAR": "b"}, tab.Context.Environ)
+}
+
+func TestParseCrontabRejectsBadIncludes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cronic-test")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	writeCrontabFiles(t, dir, map[string]string{
+		"self":      "#include self\n",
+		"loop-a":    "#include loop-b\n",
+		"loop-b":    "* * * * * b\n#include loop-a\n",
+		"bad-line":  "* * * * * ok\n\nnot a job\n",
+		"named":     "# name: dup\n* * * * * a\n",
+		"dangling":  "# cronic: quiet\n",
+		"annotated": "# cronic: quiet\n#include named\n* * * * * a\n",
+	})
+
+	for _, tt := range []struct {
+		crontab string
+		err     string
+	}{
+		{"#include", "missing path"},
+		{"#include missing", "no such file"},
+		{"#include .", "is a directory"},
+		{"#include [", "bad pattern"},
+		{"#include self", "include cycle: " + filepath.Join(dir, "self") + " -> " + filepath.Join(dir, "self")},
+		{"#include loop-a", "include cycle: " + filepath.Join(dir, "loop-a") + " -> " + filepath.Join(dir, "loop-b") + " -> " + filepath.Join(dir, "loop-a") + ") (in " + filepath.Join(dir, "loop-b") + ":2)"},
+		{"#include bad-line", "(in " + filepath.Join(dir, "bad-line") + ":3)"},
+		{"#include dangling", "is not followed by a job (in " + filepath.Join(dir, "dangling") + ":1)"},
+		{"# name: dup\n* * * * * a\n#include named", "duplicate job name \"dup\""},
+		{"#include annotated", "annotations and names must be followed by a job"},
+		{"# name: a\n#include named\n* * * * * a", "annotations and names must be followed by a job"},
+	} {
+		_, err := ParseCrontabAt(bytes.NewBufferString(tt.crontab), filepath.Join(dir, "crontab"))
+		if assert.NotNil(t, err, tt.crontab) {
+			assert.Contains(t, err.Error(), tt.err, tt.crontab)
+		}
+	}
+}
+
+func TestParseCrontabIncludesRelativeToWorkingDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cronic-test")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	writeCrontabFiles(t, dir, map[string]string{"fragment": "* * * * * included\n"})
+
+	wd, err := os.Getwd()
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.Chdir(wd)
+	assert.Nil(t, os.Chdir(dir))
+
+	tab, err := ParseCrontab(bytes.NewBufferString("#include fragment\n"))
+	if assert.Nil(t, err) && assert.Equal(t, 1, len(tab.Jobs)) {
+		assert.Equal(t, "included", tab.Jobs[0].Command)
+		assert.Equal(t, "fragment", tab.Jobs[0].File)
+	}
+}
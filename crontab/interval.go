@@ -0,0 +1,69 @@
+package crontab
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+var (
+	// e.g. "@every 10m command", or "@after 10m command"
+	intervalLineMatcher = regexp.MustCompile(`^(@(every|after)\s+(\S+))\s+(\S.*)$`)
+)
+
+// When the interval of an "@every" schedule starts
+const (
+	// At the start of the previous run (or when cronic starts), like a
+	// ticker: a run that lasts longer than the interval delays the next
+	IntervalFromStart = "start"
+
+	// At the end of the previous run, so that there's always an interval
+	// between runs
+	IntervalFromEnd = "end"
+)
+
+// intervalExpression runs a job at a fixed interval.
+type intervalExpression struct {
+	interval time.Duration
+
+	// Whether the interval always starts at the end of the previous run
+	// ("@after", rather than "@every" and the interval-from annotation)
+	fromEnd bool
+}
+
+func (i *intervalExpression) Next(fromTime time.Time) time.Time {
+	return fromTime.Add(i.interval)
+}
+
+// parseIntervalLine parses a job line whose schedule is an interval. It
+// returns nil if the line has another kind of schedule.
+func parseIntervalLine(line string) (*CrontabLine, error) {
+	matches := intervalLineMatcher.FindStringSubmatch(line)
+	if matches == nil {
+		return nil, nil
+	}
+
+	interval, err := time.ParseDuration(matches[3])
+	if err != nil || interval < time.Second {
+		return nil, fmt.Errorf("bad interval: %q (expected a duration of at least 1s, e.g. 10m)", matches[3])
+	}
+
+	return &CrontabLine{
+		Expression: &intervalExpression{interval: interval, fromEnd: matches[2] == "after"},
+		Schedule:   matches[1],
+		Command:    matches[4],
+	}, nil
+}
+
+// isInterval reports whether the job's schedule is an interval.
+func (job *Job) isInterval() bool {
+	_, ok := job.Expression.(*intervalExpression)
+	return ok
+}
+
+// isAfterInterval reports whether the job's schedule is an "@after"
+// interval.
+func (job *Job) isAfterInterval() bool {
+	expr, ok := job.Expression.(*intervalExpression)
+	return ok && expr.fromEnd
+}
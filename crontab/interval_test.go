@@ -0,0 +1,63 @@
+package crontab
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var intervalTestCases = []struct {
+	line     string
+	schedule string
+	command  string
+	interval time.Duration
+}{
+	{"@every 10m echo hi", "@every 10m", "echo hi", 10 * time.Minute},
+	{"@every   1h30m   echo  hi", "@every   1h30m", "echo  hi", 90 * time.Minute},
+	{"@after 15m ./poll.sh", "@after 15m", "./poll.sh", 15 * time.Minute},
+
+	// Failure cases
+	{"@every 10 echo hi", "", "", 0},
+	{"@every 500ms echo hi", "", "", 0},
+	{"@every -1m echo hi", "", "", 0},
+	{"@after 0s echo hi", "", "", 0},
+}
+
+func TestParseIntervalLine(t *testing.T) {
+	for _, tt := range intervalTestCases {
+		label := fmt.Sprintf("parseJobLine(%q)", tt.line)
+
+		line, err := parseJobLine(tt.line)
+
+		if tt.interval == 0 {
+			assert.Nil(t, line, label)
+			assert.NotNil(t, err, label)
+			continue
+		}
+
+		if assert.Nil(t, err, label) {
+			assert.Equal(t, tt.schedule, line.Schedule, label)
+			assert.Equal(t, tt.command, line.Command, label)
+
+			from := localTime(2018, 4, 7, 12, 0)
+			assert.Equal(t, from.Add(tt.interval), line.Expression.Next(from), label)
+		}
+	}
+}
+
+func TestAfterIntervalStartsAtTheEnd(t *testing.T) {
+	job, err := NewJob("@after 15m", "./poll.sh", nil)
+	if assert.Nil(t, err) {
+		assert.True(t, job.IntervalFromEnd)
+	}
+
+	job, err = NewJob("@every 15m", "./poll.sh", nil)
+	if assert.Nil(t, err) {
+		assert.False(t, job.IntervalFromEnd)
+	}
+
+	_, err = NewJob("@after 15m", "./poll.sh", map[string]string{"interval-from": "start"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,137 @@
+package crontab
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorhill/cronexpr"
+)
+
+var (
+	// Days of the month before the last one, as in Quartz (e.g. "L-3")
+	lastDayOffsetMatcher = regexp.MustCompile(`^[Ll]-([0-9]+)$`)
+
+	// How many days in a row lastDayOffsetExpression may rule out before
+	// giving up, for schedules whose offsets never fall in their months
+	// (e.g. "L-30" in February)
+	lastDayOffsetSearchLimit = 512
+)
+
+// parseCronFields parses a schedule's fields with cronexpr (which supports
+// Quartz's L, W and # in days of the month and of the week), and with
+// lastDayOffsetExpression if its days of the month include offsets from the
+// last day (which cronexpr doesn't support).
+func parseCronFields(fields []string) (Expression, error) {
+	dom, dow := 2, 4
+	switch len(fields) {
+	case 5, 6:
+	case 7:
+		dom, dow = 3, 5
+	default:
+		return parseCronexpr(fields)
+	}
+
+	offsets := make(map[int]bool)
+	others := make([]string, 0)
+	candidates := make([]string, 0)
+
+	for _, entry := range strings.Split(fields[dom], ",") {
+		m := lastDayOffsetMatcher.FindStringSubmatch(entry)
+		if m == nil {
+			others = append(others, entry)
+			continue
+		}
+
+		offset, _ := strconv.Atoi(m[1])
+		if offset < 1 || offset > 30 {
+			return nil, fmt.Errorf("day of the month %q out of range (L-1 to L-30)", entry)
+		}
+		offsets[offset] = true
+
+		// The days it can fall on, in months of 28 to 31 days
+		first := 28 - offset
+		if first < 1 {
+			first = 1
+		}
+		candidates = append(candidates, fmt.Sprintf("%d-%d", first, 31-offset))
+	}
+
+	if len(offsets) == 0 {
+		return parseCronexpr(fields)
+	}
+
+	if fields[dow] != "*" && fields[dow] != "?" {
+		return nil, fmt.Errorf("day of the month %q can't be used with a day of the week", fields[dom])
+	}
+
+	expr := &lastDayOffsetExpression{offsets: offsets}
+
+	var err error
+	if expr.candidates, err = parseCronexpr(withField(fields, dom, strings.Join(candidates, ","))); err != nil {
+		return nil, err
+	}
+	if len(others) > 0 {
+		if expr.others, err = parseCronexpr(withField(fields, dom, strings.Join(others, ","))); err != nil {
+			return nil, err
+		}
+	}
+
+	return expr, nil
+}
+
+func parseCronexpr(fields []string) (Expression, error) {
+	expr, err := cronexpr.Parse(strings.Join(fields, " "))
+	if err != nil {
+		return nil, err
+	}
+	return expr, nil
+}
+
+func withField(fields []string, index int, value string) []string {
+	copied := append([]string{}, fields...)
+	copied[index] = value
+	return copied
+}
+
+// lastDayOffsetExpression runs a schedule whose days of the month include
+// offsets from the last day (e.g. "L-3"). Their runs are those of the days
+// they could fall on (e.g. the 25th to the 28th, for "L-3"), on the days
+// they do fall on, and the runs of the schedule's other days of the month
+// (if it has any) are those of an expression of their own.
+type lastDayOffsetExpression struct {
+	candidates Expression
+	offsets    map[int]bool
+	others     Expression
+}
+
+func (e *lastDayOffsetExpression) Next(fromTime time.Time) time.Time {
+	next := e.nextOffset(fromTime)
+	if e.others != nil {
+		if other := e.others.Next(fromTime); !other.IsZero() && (next.IsZero() || other.Before(next)) {
+			next = other
+		}
+	}
+	return next
+}
+
+func (e *lastDayOffsetExpression) nextOffset(fromTime time.Time) time.Time {
+	search := fromTime
+	for i := 0; i < lastDayOffsetSearchLimit; i++ {
+		next := e.candidates.Next(search)
+		if next.IsZero() {
+			return next
+		}
+
+		lastDay := time.Date(next.Year(), next.Month()+1, 0, 0, 0, 0, 0, next.Location()).Day()
+		if e.offsets[lastDay-next.Day()] {
+			return next
+		}
+
+		// Rule out the rest of the day
+		search = time.Date(next.Year(), next.Month(), next.Day()+1, 0, 0, 0, 0, next.Location()).Add(-time.Nanosecond)
+	}
+	return time.Time{}
+}
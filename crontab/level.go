@@ -0,0 +1,45 @@
+package crontab
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Level is the severity of what's logged: cronic's messages, and the lines
+// of jobs' output (see Job.StdoutLevel).
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// ParseLevel parses the name of a level (e.g. "warn", or "warning").
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown level %q", name)
+}
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warning"
+	default:
+		return "error"
+	}
+}
@@ -0,0 +1,194 @@
+package crontab
+
+import (
+	"fmt"
+	"time"
+)
+
+var (
+	// How long jobs with a timeout of at least this long are assumed to run
+	// for, which makes them heavy (like jobs with resource limits)
+	LINT_HEAVY_TIMEOUT = time.Hour
+
+	// How far ahead Lint looks for heavy jobs that run at the same time
+	LINT_HORIZON = 7 * 24 * time.Hour
+
+	// How many runs of each job Lint looks at within LINT_HORIZON
+	LINT_MAX_RUNS = 10000
+)
+
+// The checks of Lint
+const (
+	LintDuplicate        = "duplicate"
+	LintNeverRuns        = "never-runs"
+	LintHeavyOverlap     = "heavy-overlap"
+	LintNoTimeout        = "no-timeout"
+	LintUnescapedPercent = "unescaped-percent"
+)
+
+// LintChecks are the checks of Lint, in the order it runs them.
+var LintChecks = []string{LintDuplicate, LintNeverRuns, LintHeavyOverlap, LintNoTimeout, LintUnescapedPercent}
+
+// LintIssue is a likely mistake in a job, found by Lint.
+type LintIssue struct {
+	Check    string `json:"check"`
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Position int    `json:"position"`
+	Name     string `json:"name,omitempty"`
+	Message  string `json:"message"`
+}
+
+func (i LintIssue) String() string {
+	location := i.File
+	if i.Line != 0 {
+		location = fmt.Sprintf("%s:%d", location, i.Line)
+	}
+	if location == "" {
+		location = fmt.Sprintf("job %d", i.Position)
+	}
+	return fmt.Sprintf("%s: %s: %s", location, i.Check, i.Message)
+}
+
+// Lint checks jobs the zero Parser parsed for likely mistakes (see
+// Parser.Lint).
+func Lint(jobs []*Job, now time.Time, skip map[string]bool) []LintIssue {
+	return (&Parser{}).Lint(jobs, now, skip)
+}
+
+// Lint checks jobs p parsed for likely mistakes (as of now), skipping the checks in
+// skip, and returns the issues it found, in the order of the jobs:
+//
+//   - duplicate: jobs with the same schedule and command as another
+//   - never-runs: jobs whose schedule never matches (e.g. February 30th), or
+//     whose @at time has passed
+//   - heavy-overlap: heavy jobs (with a memory or CPU limit, or a timeout of
+//     at least LINT_HEAVY_TIMEOUT) that can run at the same time as another,
+//     assuming they last as long as their timeout (or a minute)
+//   - no-timeout: jobs without a timeout
+//   - unescaped-percent: commands with a % that isn't escaped, which ends
+//     the command (see splitStdin), or would in cron if p leaves them as-is
+//     (see Parser.LiteralPercent)
+func (p *Parser) Lint(jobs []*Job, now time.Time, skip map[string]bool) []LintIssue {
+	issues := make([]LintIssue, 0)
+	report := func(check string, job *Job, format string, args ...interface{}) {
+		if skip[check] {
+			return
+		}
+		issues = append(issues, LintIssue{
+			Check:    check,
+			File:     job.File,
+			Line:     job.Line,
+			Position: job.Position,
+			Name:     job.Name,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	seen := make(map[string]*Job)
+	for i, job := range jobs {
+		key := job.Schedule + " " + job.Command
+		if first, ok := seen[key]; ok {
+			report(LintDuplicate, job, "same schedule and command as %s", describeJob(first))
+		} else {
+			seen[key] = job
+		}
+
+		if at, ok := job.RunsOnce(); ok {
+			if !at.IsZero() && !at.After(now) {
+				report(LintNeverRuns, job, "its time (%s) has passed", at.Format(time.RFC3339))
+			}
+		} else if job.Expression.Next(now).IsZero() {
+			report(LintNeverRuns, job, "the schedule %q never matches", job.Schedule)
+		}
+
+		if !skip[LintHeavyOverlap] && isHeavy(job) {
+			for _, other := range jobs[:i] {
+				if !isHeavy(other) {
+					continue
+				}
+				if at, ok := overlap(other, job, now); ok {
+					report(LintHeavyOverlap, job, "can run at the same time as %s, which is heavy too (e.g. at %s)", describeJob(other), at.Format(time.RFC3339))
+				}
+			}
+		}
+
+		if job.Timeout == 0 {
+			report(LintNoTimeout, job, "a run that hangs is never killed (see the timeout annotation)")
+		}
+
+		if job.Stdin != "" || p.LiteralPercent && hasUnescapedPercent(job.Command) {
+			report(LintUnescapedPercent, job, "the command has an unescaped %%, which ends the command in cron (the rest is fed to its stdin): escape it as \\%%")
+		}
+	}
+
+	return issues
+}
+
+func describeJob(job *Job) string {
+	if job.Line != 0 {
+		return fmt.Sprintf("the job on line %d", job.Line)
+	}
+	return fmt.Sprintf("job %d", job.Position)
+}
+
+func isHeavy(job *Job) bool {
+	return job.MemoryLimit > 0 || job.CPULimit > 0 || job.Timeout >= LINT_HEAVY_TIMEOUT
+}
+
+// runWindow is how long a run of the job is assumed to last.
+func runWindow(job *Job) time.Duration {
+	if job.Timeout > 0 {
+		return job.Timeout
+	}
+	return time.Minute
+}
+
+// lintRuns returns the start of the runs of the job within LINT_HORIZON of now
+// (up to LINT_MAX_RUNS of them).
+func lintRuns(job *Job, now time.Time) []time.Time {
+	runs := make([]time.Time, 0)
+	until := now.Add(LINT_HORIZON)
+	for next := job.Expression.Next(now); !next.IsZero() && next.Before(until) && len(runs) < LINT_MAX_RUNS; next = job.Expression.Next(next) {
+		runs = append(runs, next)
+	}
+	return runs
+}
+
+// overlap returns the first time runs of both jobs are assumed to be running
+// at once, if any.
+func overlap(a *Job, b *Job, now time.Time) (time.Time, bool) {
+	aRuns, bRuns := lintRuns(a, now), lintRuns(b, now)
+	aWindow, bWindow := runWindow(a), runWindow(b)
+
+	for i, j := 0, 0; i < len(aRuns) && j < len(bRuns); {
+		aEnd, bEnd := aRuns[i].Add(aWindow), bRuns[j].Add(bWindow)
+		if aRuns[i].Before(bEnd) && bRuns[j].Before(aEnd) {
+			if aRuns[i].After(bRuns[j]) {
+				return aRuns[i], true
+			}
+			return bRuns[j], true
+		}
+
+		if aEnd.Before(bEnd) {
+			i++
+		} else {
+			j++
+		}
+	}
+	return time.Time{}, false
+}
+
+// hasUnescapedPercent reports whether command has a % that isn't preceded
+// by a backslash (cron doesn't care about quotes).
+func hasUnescapedPercent(command string) bool {
+	for i := 0; i < len(command); i++ {
+		switch command[i] {
+		case '\\':
+			i++
+		case '%':
+			return true
+		}
+	}
+	return false
+}
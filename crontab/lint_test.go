@@ -0,0 +1,61 @@
+package crontab
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Saturday, April 7th 2018, at noon
+var lintNow = time.Date(2018, 4, 7, 12, 0, 0, 0, time.UTC)
+
+const lintCrontab = `# cronic: timeout=5m
+0 3 * * * ./backup.sh
+# cronic: timeout=5m
+0 3 * * * ./backup.sh
+# cronic: timeout=5m
+0 0 30 2 * ./never.sh
+# cronic: timeout=5m
+@at 2018-04-06T12:00:00Z ./missed.sh
+# cronic: timeout=2h
+0 1 * * * ./report.sh
+# cronic: memory-limit=1G
+30 2 * * * ./reindex.sh
+# cronic: memory-limit=1G
+0 4 * * * ./vacuum.sh
+@hourly date +\%F
+@hourly date +%F
+`
+
+func TestLint(t *testing.T) {
+	tab, err := ParseCrontab(strings.NewReader(lintCrontab))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	messages := make([]string, 0)
+	for _, issue := range Lint(tab.Jobs, lintNow, nil) {
+		messages = append(messages, issue.String())
+	}
+
+	assert.Equal(t, []string{
+		":4: duplicate: same schedule and command as the job on line 2",
+		":6: never-runs: the schedule \"0 0 30 2 *\" never matches",
+		":8: never-runs: its time (2018-04-06T12:00:00Z) has passed",
+		":12: heavy-overlap: can run at the same time as the job on line 10, which is heavy too (e.g. at 2018-04-08T02:30:00Z)",
+		":12: no-timeout: a run that hangs is never killed (see the timeout annotation)",
+		":14: no-timeout: a run that hangs is never killed (see the timeout annotation)",
+		":15: no-timeout: a run that hangs is never killed (see the timeout annotation)",
+		":16: no-timeout: a run that hangs is never killed (see the timeout annotation)",
+		":16: unescaped-percent: the command has an unescaped %, which ends the command in cron (the rest is fed to its stdin): escape it as \\%",
+	}, messages)
+
+	// Checks can be skipped
+	issues := Lint(tab.Jobs, lintNow, map[string]bool{LintNoTimeout: true, LintDuplicate: true, LintNeverRuns: true, LintHeavyOverlap: true})
+	if assert.Len(t, issues, 1) {
+		assert.Equal(t, LintUnescapedPercent, issues[0].Check)
+		assert.Equal(t, 8, issues[0].Position)
+	}
+}
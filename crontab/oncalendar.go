@@ -0,0 +1,286 @@
+package crontab
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorhill/cronexpr"
+)
+
+var (
+	calendarWeekdaysMatcher = regexp.MustCompile(`^[A-Za-z]+(\.\.[A-Za-z]+)?(,[A-Za-z]+(\.\.[A-Za-z]+)?)*$`)
+	calendarDateMatcher     = regexp.MustCompile(`^[0-9*,./]+(-[0-9*,./]+){1,2}$`)
+	calendarTimeMatcher     = regexp.MustCompile(`^[0-9*,./]+(:[0-9*,./]+){1,2}$`)
+
+	calendarEventShorthands = map[string]string{
+		"minutely":     "*-*-* *:*:00",
+		"hourly":       "*-*-* *:00:00",
+		"daily":        "*-*-* 00:00:00",
+		"weekly":       "Mon *-*-* 00:00:00",
+		"monthly":      "*-*-01 00:00:00",
+		"quarterly":    "*-01,04,07,10-01 00:00:00",
+		"semiannually": "*-01,07-01 00:00:00",
+		"yearly":       "*-01-01 00:00:00",
+		"annually":     "*-01-01 00:00:00",
+	}
+
+	calendarWeekdays = map[string]int{
+		"sun": 0, "sunday": 0,
+		"mon": 1, "monday": 1,
+		"tue": 2, "tuesday": 2,
+		"wed": 3, "wednesday": 3,
+		"thu": 4, "thursday": 4,
+		"fri": 5, "friday": 5,
+		"sat": 6, "saturday": 6,
+	}
+)
+
+// locationExpression evaluates an expression in another timezone than the
+// local one.
+type locationExpression struct {
+	Expression
+	location *time.Location
+}
+
+func (e *locationExpression) Next(fromTime time.Time) time.Time {
+	return e.Expression.Next(fromTime.In(e.location))
+}
+
+// parseCalendarEvent parses a systemd calendar event (see systemd.time(7)),
+// i.e. "[WEEKDAYS] [DATE] [TIME] [TIMEZONE]" (e.g. "Mon..Fri 02:00", or
+// "Sat *-*-1..7 18:00:00 Europe/Paris"), or one of its shorthands (e.g.
+// "daily"). Unlike systemd, combining weekdays and days of the month isn't
+// supported (since cron would run the job when either matches).
+func parseCalendarEvent(event string) (Expression, error) {
+	if expanded, ok := calendarEventShorthands[strings.ToLower(event)]; ok {
+		event = expanded
+	}
+
+	tokens := strings.Fields(event)
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty calendar event")
+	}
+
+	weekdays, date, clock := "*", "*-*-*", "00:00:00"
+	var location *time.Location
+
+	i := 0
+	if isCalendarWeekdays(tokens[0]) {
+		weekdays = tokens[0]
+		i++
+	}
+
+	if i < len(tokens) && isCalendarDate(tokens[i]) {
+		date = tokens[i]
+		i++
+	}
+
+	if i < len(tokens) && isCalendarTime(tokens[i]) {
+		clock = tokens[i]
+		i++
+	}
+
+	// A timezone can only follow something else
+	if i == len(tokens)-1 && i > 0 {
+		loc, err := time.LoadLocation(tokens[i])
+		if err != nil {
+			return nil, fmt.Errorf("bad timezone %q in calendar event %q", tokens[i], event)
+		}
+		location = loc
+		i++
+	}
+
+	if i != len(tokens) {
+		return nil, fmt.Errorf("bad calendar event %q", event)
+	}
+
+	dow, err := parseCalendarWeekdays(weekdays)
+	if err != nil {
+		return nil, err
+	}
+
+	dateParts := strings.Split(date, "-")
+	if len(dateParts) == 2 {
+		dateParts = append([]string{"*"}, dateParts...)
+	}
+	if len(dateParts) != 3 {
+		return nil, fmt.Errorf("bad date %q in calendar event %q", date, event)
+	}
+
+	clockParts := strings.Split(clock, ":")
+	if len(clockParts) == 2 {
+		clockParts = append(clockParts, "00")
+	}
+	if len(clockParts) != 3 {
+		return nil, fmt.Errorf("bad time %q in calendar event %q", clock, event)
+	}
+
+	fields := make([]string, 0, 7)
+	for _, component := range []struct {
+		value    string
+		min, max int
+	}{
+		{clockParts[2], 0, 59},
+		{clockParts[1], 0, 59},
+		{clockParts[0], 0, 23},
+		{dateParts[2], 1, 31},
+		{dateParts[1], 1, 12},
+	} {
+		field, err := parseCalendarComponent(component.value, component.min, component.max)
+		if err != nil {
+			return nil, fmt.Errorf("%v in calendar event %q", err, event)
+		}
+		fields = append(fields, field)
+	}
+
+	year, err := parseCalendarComponent(dateParts[0], 1970, 2099)
+	if err != nil {
+		return nil, fmt.Errorf("%v in calendar event %q", err, event)
+	}
+	fields = append(fields, dow, year)
+
+	if dow != "*" && fields[3] != "*" {
+		return nil, fmt.Errorf("calendar event %q can't restrict both weekdays and days of the month", event)
+	}
+
+	cronExpr, err := cronexpr.Parse(strings.Join(fields, " "))
+	if err != nil {
+		return nil, err
+	}
+
+	expr := newWallClockExpression(cronExpr, fields)
+	if location != nil {
+		return &locationExpression{expr, location}, nil
+	}
+	return expr, nil
+}
+
+// parseCalendarWeekdays translates weekdays (e.g. "Mon..Fri,Sun") to a
+// cron day of the week field.
+func parseCalendarWeekdays(weekdays string) (string, error) {
+	if weekdays == "*" {
+		return weekdays, nil
+	}
+
+	days := make(map[int]bool)
+
+	for _, item := range strings.Split(weekdays, ",") {
+		bounds := strings.Split(item, "..")
+		if len(bounds) > 2 {
+			return "", fmt.Errorf("bad weekdays %q", weekdays)
+		}
+
+		first, ok := calendarWeekdays[strings.ToLower(bounds[0])]
+		if !ok {
+			return "", fmt.Errorf("bad weekday %q", bounds[0])
+		}
+
+		last, ok := calendarWeekdays[strings.ToLower(bounds[len(bounds)-1])]
+		if !ok {
+			return "", fmt.Errorf("bad weekday %q", bounds[len(bounds)-1])
+		}
+
+		// Ranges can wrap around (e.g. "Fri..Mon")
+		for day := first; ; day = (day + 1) % 7 {
+			days[day] = true
+			if day == last {
+				break
+			}
+		}
+	}
+
+	numbers := make([]int, 0, len(days))
+	for day := range days {
+		numbers = append(numbers, day)
+	}
+	sort.Ints(numbers)
+
+	fields := make([]string, len(numbers))
+	for i, day := range numbers {
+		fields[i] = strconv.Itoa(day)
+	}
+	return strings.Join(fields, ","), nil
+}
+
+// parseCalendarComponent translates a component of a date or time (e.g.
+// "1..5", "*/15", or "1,15") to a cron field.
+func parseCalendarComponent(component string, min int, max int) (string, error) {
+	items := strings.Split(component, ",")
+
+	for i, item := range items {
+		value, step := item, ""
+		if slash := strings.Index(item, "/"); slash != -1 {
+			value, step = item[:slash], item[slash:]
+
+			if n, err := strconv.Atoi(step[1:]); err != nil || n < 1 {
+				return "", fmt.Errorf("bad repetition %q", item)
+			}
+		}
+
+		if value == "*" {
+			continue
+		}
+
+		bounds := strings.Split(value, "..")
+		if len(bounds) > 2 {
+			return "", fmt.Errorf("bad range %q", item)
+		}
+
+		for j, bound := range bounds {
+			n, err := strconv.Atoi(bound)
+			if err != nil || n < min || n > max {
+				return "", fmt.Errorf("bad value %q (expected %d-%d)", bound, min, max)
+			}
+			bounds[j] = strconv.Itoa(n)
+		}
+
+		items[i] = strings.Join(bounds, "-") + step
+	}
+
+	return strings.Join(items, ","), nil
+}
+
+// calendarEventLength returns how many of fields (the fields of a job line)
+// are a calendar event, going by what they look like rather than whether
+// they're valid (so that e.g. a bad time is reported as such, rather than
+// parsed as part of the command).
+func calendarEventLength(fields []string) int {
+	if len(fields) == 0 {
+		return 0
+	}
+
+	if _, ok := calendarEventShorthands[strings.ToLower(fields[0])]; ok {
+		return 1
+	}
+
+	i := 0
+	for _, looksLike := range []func(string) bool{isCalendarWeekdays, isCalendarDate, isCalendarTime} {
+		if i < len(fields) && looksLike(fields[i]) {
+			i++
+		}
+	}
+
+	if i > 0 && i < len(fields) {
+		if _, err := time.LoadLocation(fields[i]); err == nil && fields[i] != "" && fields[i] != "Local" {
+			i++
+		}
+	}
+
+	return i
+}
+
+func isCalendarWeekdays(token string) bool {
+	return calendarWeekdaysMatcher.MatchString(token)
+}
+
+func isCalendarDate(token string) bool {
+	return calendarDateMatcher.MatchString(token)
+}
+
+func isCalendarTime(token string) bool {
+	return calendarTimeMatcher.MatchString(token)
+}
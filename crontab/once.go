@@ -0,0 +1,62 @@
+package crontab
+
+import (
+	"regexp"
+	"time"
+)
+
+var (
+	// e.g. "@at 2018-04-07T09:30:00Z command", or "@once command"
+	onceLineMatcher = regexp.MustCompile(`^(@at\s+(\S+)|@once)\s+(\S.*)$`)
+)
+
+// onceExpression runs a job a single time: at a given time, or as soon as
+// it's scheduled if that's zero (for "@once").
+type onceExpression struct {
+	at time.Time
+}
+
+// Next returns the time of the run if it's after fromTime, or the zero time
+// otherwise (including for "@once", whose run isn't at a particular time).
+func (o *onceExpression) Next(fromTime time.Time) time.Time {
+	if o.at.After(fromTime) {
+		return o.at
+	}
+	return time.Time{}
+}
+
+// parseOnceLine parses a job line whose schedule is a single run. It returns
+// nil if the line has another kind of schedule.
+func parseOnceLine(line string) (*CrontabLine, error) {
+	matches := onceLineMatcher.FindStringSubmatch(line)
+	if matches == nil {
+		return nil, nil
+	}
+
+	expr := &onceExpression{}
+
+	if matches[2] != "" {
+		at, err := ParseDate(matches[2])
+		if err != nil {
+			return nil, err
+		}
+		expr.at = at
+	}
+
+	return &CrontabLine{
+		Expression: expr,
+		Schedule:   matches[1],
+		Command:    matches[3],
+	}, nil
+}
+
+// RunsOnce reports whether the job runs a single time ("@at" or "@once"),
+// and when (the zero time for "@once", which runs as soon as it's
+// scheduled).
+func (job *Job) RunsOnce() (time.Time, bool) {
+	expr, ok := job.Expression.(*onceExpression)
+	if !ok {
+		return time.Time{}, false
+	}
+	return expr.at, true
+}
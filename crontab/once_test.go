@@ -0,0 +1,61 @@
+package crontab
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var onceTestCases = []struct {
+	line     string
+	schedule string
+	command  string
+	at       time.Time
+	ok       bool
+}{
+	{"@once ./migrate.sh", "@once", "./migrate.sh", time.Time{}, true},
+	{"@at 2018-04-07T13:00 echo hi", "@at 2018-04-07T13:00", "echo hi", localTime(2018, 4, 7, 13, 0), true},
+	{"@at   2025-01-01T03:00:00Z   echo  hi", "@at   2025-01-01T03:00:00Z", "echo  hi", time.Date(2025, 1, 1, 3, 0, 0, 0, time.UTC), true},
+
+	// Failure cases
+	{"@at tomorrow echo hi", "", "", time.Time{}, false},
+	{"@at 2018-04-07", "", "", time.Time{}, false},
+}
+
+func TestParseOnceLine(t *testing.T) {
+	for _, tt := range onceTestCases {
+		label := fmt.Sprintf("parseJobLine(%q)", tt.line)
+
+		line, err := parseJobLine(tt.line)
+
+		if !tt.ok {
+			assert.Nil(t, line, label)
+			assert.NotNil(t, err, label)
+			continue
+		}
+
+		if assert.Nil(t, err, label) {
+			assert.Equal(t, tt.schedule, line.Schedule, label)
+			assert.Equal(t, tt.command, line.Command, label)
+
+			job := &Job{CrontabLine: *line}
+			at, ok := job.RunsOnce()
+			assert.True(t, ok, label)
+			assert.True(t, tt.at.Equal(at), "%s: %v", label, at)
+
+			// There is never a next run after that one
+			assert.True(t, line.Expression.Next(tt.at).IsZero(), label)
+		}
+	}
+}
+
+func TestRunsOnce(t *testing.T) {
+	line, err := parseJobLine("@hourly echo hi")
+	if assert.Nil(t, err) {
+		job := &Job{CrontabLine: *line}
+		_, ok := job.RunsOnce()
+		assert.False(t, ok)
+	}
+}
@@ -0,0 +1,51 @@
+package crontab
+
+import (
+	"strings"
+)
+
+// splitStdin splits the command of a crontab line into the command and its
+// stdin, which ends with a newline unless it's empty: like in POSIX cron,
+// an unescaped % ends the command, and the rest of the line, with its other
+// unescaped % replaced by newlines, is fed to the command's stdin ("\%" is a
+// literal %). Parsers with LiteralPercent set leave % as-is instead.
+func splitStdin(command string) (string, string) {
+	var cmd, stdin strings.Builder
+	out := &cmd
+	for i := 0; i < len(command); i++ {
+		switch {
+		case command[i] == '\\' && i+1 < len(command) && command[i+1] == '%':
+			out.WriteByte('%')
+			i++
+		case command[i] == '%' && out == &cmd:
+			out = &stdin
+		case command[i] == '%':
+			out.WriteByte('\n')
+		default:
+			out.WriteByte(command[i])
+		}
+	}
+
+	input := stdin.String()
+	if input != "" && !strings.HasSuffix(input, "\n") {
+		input += "\n"
+	}
+	return cmd.String(), input
+}
+
+// joinStdin is the reverse of splitStdin, for writing jobs to crontabs
+// (unless literalPercent).
+func joinStdin(command string, stdin string, literalPercent bool) string {
+	if literalPercent {
+		return command
+	}
+
+	escaped := strings.Replace(command, "%", `\%`, -1)
+	if stdin == "" {
+		return escaped
+	}
+
+	stdin = strings.TrimSuffix(stdin, "\n")
+	stdin = strings.Replace(stdin, "%", `\%`, -1)
+	return escaped + "%" + strings.Replace(stdin, "\n", "%", -1)
+}
@@ -0,0 +1,72 @@
+package crontab
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var splitStdinTestCases = []struct {
+	command string
+	cmd     string
+	stdin   string
+}{
+	{"echo hi", "echo hi", ""},
+	{"cat%hello%world", "cat", "hello\nworld\n"},
+	{`date +\%F`, "date +%F", ""},
+	{`mail -s \%s root%50\% done%`, "mail -s %s root", "50% done\n"},
+	{`printf 'a\nb'`, `printf 'a\nb'`, ""},
+	{"cat%", "cat", ""},
+}
+
+func TestSplitStdin(t *testing.T) {
+	for _, tt := range splitStdinTestCases {
+		cmd, stdin := splitStdin(tt.command)
+		assert.Equal(t, tt.cmd, cmd, tt.command)
+		assert.Equal(t, tt.stdin, stdin, tt.command)
+
+		// Jobs are written back as equivalent lines
+		cmd, stdin = splitStdin(joinStdin(cmd, stdin, false))
+		assert.Equal(t, tt.cmd, cmd, tt.command)
+		assert.Equal(t, tt.stdin, stdin, tt.command)
+	}
+}
+
+func TestSplitStdinCanBeDisabled(t *testing.T) {
+	parser := &Parser{LiteralPercent: true}
+
+	tab, err := parser.ParseCrontab(strings.NewReader("* * * * * date +%F"), "")
+	if assert.Nil(t, err) && assert.Len(t, tab.Jobs, 1) {
+		assert.Equal(t, "date +%F", tab.Jobs[0].Command)
+		assert.Equal(t, "", tab.Jobs[0].Stdin)
+	}
+}
+
+func TestParseCrontabSplitsStdin(t *testing.T) {
+	tab, err := ParseCrontab(strings.NewReader("* * * * * ./send.sh -s report%Hello,%%  the report"))
+	if assert.Nil(t, err) && assert.Len(t, tab.Jobs, 1) {
+		assert.Equal(t, "./send.sh -s report", tab.Jobs[0].Command)
+		assert.Equal(t, "Hello,\n\n  the report\n", tab.Jobs[0].Stdin)
+	}
+
+	job, err := NewJob("@hourly", `date +\%F >> /tmp/dates`, nil)
+	if assert.Nil(t, err) {
+		assert.Equal(t, "date +%F >> /tmp/dates", job.Command)
+
+		line, err := FormatJob(job)
+		assert.Nil(t, err)
+		assert.Equal(t, "@hourly date +\\%F >> /tmp/dates\n", line)
+	}
+}
+
+func TestParseCrontabDoesntSplitVariables(t *testing.T) {
+	tab, err := ParseCrontab(strings.NewReader("FMT=%Y-%m-%d\nGREETING=50% off\n* * * * * date +${FMT}\n* * * * * cat%${GREETING}%bye"))
+	if assert.Nil(t, err) && assert.Len(t, tab.Jobs, 2) {
+		assert.Equal(t, "date +%Y-%m-%d", tab.Jobs[0].Command)
+		assert.Equal(t, "", tab.Jobs[0].Stdin)
+
+		assert.Equal(t, "cat", tab.Jobs[1].Command)
+		assert.Equal(t, "50% off\nbye\n", tab.Jobs[1].Stdin)
+	}
+}
@@ -0,0 +1,50 @@
+package crontab
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// I/O scheduling classes (see ioprio_set(2)), for the ionice annotation.
+const (
+	// Served first, with a level from 0 (highest priority) to 7
+	IOClassRealtime = "realtime"
+
+	// The default class, with a level from 0 (highest priority) to 7
+	IOClassBestEffort = "best-effort"
+
+	// Only served when no other process needs the disk
+	IOClassIdle = "idle"
+)
+
+var ioClasses = []string{IOClassRealtime, IOClassBestEffort, IOClassIdle}
+
+// ParseIOPriority parses an I/O priority, i.e. a class and an optional level
+// (e.g. "best-effort:7", or "idle"). The level defaults to 4, like ionice's.
+func ParseIOPriority(priority string) (string, int, error) {
+	parts := strings.SplitN(priority, ":", 2)
+
+	class := parts[0]
+	if !containsString(ioClasses, class) {
+		return "", 0, fmt.Errorf("unknown I/O scheduling class %q (expected one of %s)", class, strings.Join(ioClasses, ", "))
+	}
+
+	if len(parts) == 1 {
+		if class == IOClassIdle {
+			return class, 0, nil
+		}
+		return class, 4, nil
+	}
+
+	if class == IOClassIdle {
+		return "", 0, fmt.Errorf("I/O scheduling class %q has no levels", class)
+	}
+
+	level, err := strconv.Atoi(parts[1])
+	if err != nil || level < 0 || level > 7 {
+		return "", 0, fmt.Errorf("bad I/O priority level %q (expected 0-7)", parts[1])
+	}
+
+	return class, level, nil
+}
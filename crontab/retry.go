@@ -0,0 +1,121 @@
+package crontab
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Classes of failures, for retry conditions (which are either one of these,
+// or an exit code).
+const (
+	// The command couldn't be started
+	FailureSpawn = "spawn"
+
+	// The command was killed by a signal
+	FailureSignal = "signal"
+
+	// The command ran for longer than its timeout
+	FailureTimeout = "timeout"
+
+	// The command succeeded, but without the output the job expects
+	FailureOutput = "output"
+)
+
+// What to do when a job's command can't be started (e.g. because the shell
+// is missing), which is usually a problem with the host rather than the job.
+const (
+	// Report a failure, like any other (see RetryPolicy)
+	SpawnFailureFail = "fail"
+
+	// Keep trying to start the command, with an exponential backoff
+	SpawnFailureRetry = "retry"
+
+	// Report a failure, and pause the job until it's resumed
+	SpawnFailurePause = "pause"
+)
+
+var (
+	DEFAULT_RETRY_DELAY = 10 * time.Second
+
+	failureClasses       = []string{FailureSpawn, FailureSignal, FailureTimeout, FailureOutput}
+	spawnFailurePolicies = []string{SpawnFailureFail, SpawnFailureRetry, SpawnFailurePause}
+)
+
+// ParseSpawnFailurePolicy checks that policy is one of SpawnFailureFail,
+// SpawnFailureRetry or SpawnFailurePause.
+func ParseSpawnFailurePolicy(policy string) (string, error) {
+	if !containsString(spawnFailurePolicies, policy) {
+		return "", fmt.Errorf("unknown spawn failure policy %q (expected one of %s)", policy, strings.Join(spawnFailurePolicies, ", "))
+	}
+	return policy, nil
+}
+
+// RetryPolicy says which failed runs of a job to retry, and how.
+type RetryPolicy struct {
+	// How many times to retry a run
+	Retries int
+
+	// How long to wait before each retry
+	Delay time.Duration
+
+	// Conditions a failure must match to be retried (if empty, any failure
+	// is), and conditions that prevent it from being retried
+	On    []string
+	Never []string
+}
+
+// ParseFailureConditions parses a comma-separated list of exit codes and
+// failure classes, e.g. "timeout,75".
+func ParseFailureConditions(list string) ([]string, error) {
+	conditions := make([]string, 0)
+
+	for _, condition := range strings.Split(list, ",") {
+		condition = strings.TrimSpace(condition)
+		if condition == "" {
+			continue
+		}
+
+		if code, err := strconv.Atoi(condition); err == nil {
+			if code < 0 || code > 255 {
+				return nil, fmt.Errorf("exit code %d out of range (0-255)", code)
+			}
+			condition = strconv.Itoa(code)
+		} else if !containsString(failureClasses, condition) {
+			return nil, fmt.Errorf("unknown failure %q (expected an exit code, or one of %s)", condition, strings.Join(failureClasses, ", "))
+		}
+
+		conditions = append(conditions, condition)
+	}
+
+	if len(conditions) == 0 {
+		return nil, fmt.Errorf("no failures in %q", list)
+	}
+
+	return conditions, nil
+}
+
+// Allows reports whether a run that failed because of condition (an exit
+// code or a failure class) should be retried, given how many times it was
+// retried already.
+func (p *RetryPolicy) Allows(condition string, retries int) bool {
+	if p == nil || retries >= p.Retries {
+		return false
+	}
+
+	if containsString(p.Never, condition) {
+		return false
+	}
+
+	return len(p.On) == 0 || containsString(p.On, condition)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
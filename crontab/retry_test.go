@@ -0,0 +1,57 @@
+package crontab
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var parseFailureConditionsTestCases = []struct {
+	list     string
+	expected []string
+}{
+	{"75", []string{"75"}},
+	{" timeout , 075,spawn,signal ", []string{FailureTimeout, "75", FailureSpawn, FailureSignal}},
+
+	// Failure cases
+	{"", nil},
+	{",", nil},
+	{"256", nil},
+	{"-1", nil},
+	{"crash", nil},
+}
+
+func TestParseFailureConditions(t *testing.T) {
+	for _, tt := range parseFailureConditionsTestCases {
+		label := fmt.Sprintf("ParseFailureConditions(%q)", tt.list)
+
+		conditions, err := ParseFailureConditions(tt.list)
+
+		if tt.expected == nil {
+			assert.NotNil(t, err, label)
+		} else {
+			assert.Nil(t, err, label)
+			assert.Equal(t, tt.expected, conditions, label)
+		}
+	}
+}
+
+func TestRetryPolicyAllows(t *testing.T) {
+	var none *RetryPolicy
+	assert.False(t, none.Allows("1", 0))
+
+	always := &RetryPolicy{Retries: 2}
+	assert.True(t, always.Allows("1", 0))
+	assert.True(t, always.Allows(FailureSpawn, 1))
+	assert.False(t, always.Allows("1", 2))
+
+	selective := &RetryPolicy{Retries: 2, On: []string{FailureTimeout, "75"}}
+	assert.True(t, selective.Allows("75", 0))
+	assert.True(t, selective.Allows(FailureTimeout, 0))
+	assert.False(t, selective.Allows("1", 0))
+
+	never := &RetryPolicy{Retries: 2, Never: []string{"2"}}
+	assert.False(t, never.Allows("2", 0))
+	assert.True(t, never.Allows("1", 0))
+}
@@ -0,0 +1,41 @@
+package crontab
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	// How long before their timeout jobs get their checkpoint signal,
+	// unless they set checkpoint-grace (at most half of their timeout)
+	DEFAULT_CHECKPOINT_GRACE = time.Minute
+
+	// The signals that can be sent to jobs, by name
+	signalNames = map[string]syscall.Signal{
+		"HUP":   syscall.SIGHUP,
+		"INT":   syscall.SIGINT,
+		"QUIT":  syscall.SIGQUIT,
+		"TERM":  syscall.SIGTERM,
+		"USR1":  syscall.SIGUSR1,
+		"USR2":  syscall.SIGUSR2,
+		"ALRM":  syscall.SIGALRM,
+		"WINCH": syscall.SIGWINCH,
+	}
+)
+
+// ParseSignal parses a signal name, with or without its "SIG" prefix (e.g.
+// "SIGUSR1" or "usr1"), or number.
+func ParseSignal(name string) (syscall.Signal, error) {
+	if number, err := strconv.Atoi(name); err == nil && number > 0 && number < 32 {
+		return syscall.Signal(number), nil
+	}
+
+	signal, ok := signalNames[strings.TrimPrefix(strings.ToUpper(name), "SIG")]
+	if !ok {
+		return 0, fmt.Errorf("unknown signal %q", name)
+	}
+	return signal, nil
+}
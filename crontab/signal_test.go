@@ -0,0 +1,26 @@
+package crontab
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSignal(t *testing.T) {
+	for name, expected := range map[string]syscall.Signal{
+		"SIGUSR1": syscall.SIGUSR1,
+		"usr2":    syscall.SIGUSR2,
+		"Hup":     syscall.SIGHUP,
+		"15":      syscall.SIGTERM,
+	} {
+		signal, err := ParseSignal(name)
+		assert.Nil(t, err, name)
+		assert.Equal(t, expected, signal, name)
+	}
+
+	for _, name := range []string{"", "SIG", "LOUD", "0", "64"} {
+		_, err := ParseSignal(name)
+		assert.NotNil(t, err, name)
+	}
+}
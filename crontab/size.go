@@ -0,0 +1,45 @@
+package crontab
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var byteSizeUnits = map[string]int64{
+	"":  1,
+	"K": 1 << 10,
+	"M": 1 << 20,
+	"G": 1 << 30,
+	"T": 1 << 40,
+}
+
+// ParseByteSize parses a size in bytes, optionally followed by a binary unit
+// (e.g. "512M" for 512 MiB, or "1.5G"). Units are case-insensitive, and may
+// be followed by "B" or "iB" (e.g. "512MiB").
+func ParseByteSize(size string) (int64, error) {
+	number := strings.TrimRight(size, "KMGTkmgtIiBb")
+	unit := strings.ToUpper(size[len(number):])
+	if len(unit) > 2 && strings.HasSuffix(unit, "IB") {
+		unit = unit[:len(unit)-2]
+	} else {
+		unit = strings.TrimSuffix(unit, "B")
+	}
+
+	multiplier, ok := byteSizeUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("bad size %q (unknown unit)", size)
+	}
+
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil || value < 0 || math.IsInf(value, 0) || math.IsNaN(value) {
+		return 0, fmt.Errorf("bad size %q", size)
+	}
+
+	bytes := value * float64(multiplier)
+	if bytes >= math.MaxInt64 {
+		return 0, fmt.Errorf("size %q is too large", size)
+	}
+	return int64(bytes), nil
+}
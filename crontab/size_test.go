@@ -0,0 +1,44 @@
+package crontab
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var byteSizeTestCases = []struct {
+	size  string
+	bytes int64
+	ok    bool
+}{
+	{"1024", 1024, true},
+	{"512M", 512 << 20, true},
+	{"512m", 512 << 20, true},
+	{"512MB", 512 << 20, true},
+	{"512MiB", 512 << 20, true},
+	{"1.5G", 3 << 29, true},
+	{"2T", 2 << 40, true},
+	{"100B", 100, true},
+
+	// Failure cases
+	{"", 0, false},
+	{"M", 0, false},
+	{"512X", 0, false},
+	{"512iB", 0, false},
+	{"-1M", 0, false},
+	{"9999999999T", 0, false},
+}
+
+func TestParseByteSize(t *testing.T) {
+	for _, tt := range byteSizeTestCases {
+		bytes, err := ParseByteSize(tt.size)
+		if !tt.ok {
+			assert.NotNil(t, err, tt.size)
+			continue
+		}
+
+		if assert.Nil(t, err, tt.size) {
+			assert.Equal(t, tt.bytes, bytes, tt.size)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package crontab
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Schedule syntaxes. Jobs can use another syntax than the default by
+// prefixing their schedule with "@" and its name (e.g. "@quartz").
+const (
+	// Vixie cron, with optional seconds and years (see cronexpr)
+	SyntaxCron = "cron"
+
+	// Quartz, with seconds and optional years, and days of the week
+	// numbered from 1 (Sunday) to 7
+	SyntaxQuartz = "quartz"
+
+	// systemd calendar events, as in OnCalendar= (see parseCalendarEvent)
+	SyntaxSystemd = "systemd"
+)
+
+var (
+	scheduleSyntaxes = map[string]*scheduleSyntax{
+		SyntaxCron: {
+			fieldCounts: fixedFieldCounts(
+				7, // POSIX + seconds + years
+				6, // POSIX + years
+				5, // POSIX
+				1, // shorthand (e.g. @hourly)
+			),
+			parse: func(schedule string) (Expression, error) {
+				fields := strings.Fields(schedule)
+				expr, err := parseCronFields(fields)
+				if err != nil {
+					return nil, err
+				}
+				return newWallClockExpression(expr, fields), nil
+			},
+		},
+		SyntaxQuartz: {
+			fieldCounts: fixedFieldCounts(7, 6),
+			parse:       parseQuartz,
+		},
+		SyntaxSystemd: {
+			fieldCounts: func(fields []string) []int {
+				return []int{calendarEventLength(fields)}
+			},
+			parse: parseCalendarEvent,
+		},
+	}
+
+	syntaxNames = []string{SyntaxCron, SyntaxQuartz, SyntaxSystemd}
+
+	// Numbers in Quartz's day of the week field, except for intervals
+	// (e.g. "*/2") and nth days of the month (e.g. "6#3")
+	quartzDowMatcher = regexp.MustCompile(`(^|[^#/0-9])([0-9]+)`)
+)
+
+// scheduleSyntax parses schedules of one syntax.
+type scheduleSyntax struct {
+	// How many of the whitespace-separated fields of a job line the
+	// schedule could be, tried in order when splitting the line
+	fieldCounts func(fields []string) []int
+
+	parse func(schedule string) (Expression, error)
+}
+
+func fixedFieldCounts(counts ...int) func([]string) []int {
+	return func([]string) []int {
+		return counts
+	}
+}
+
+// ParseScheduleSyntax checks that syntax is one of SyntaxCron, SyntaxQuartz
+// or SyntaxSystemd.
+func ParseScheduleSyntax(syntax string) (string, error) {
+	if _, ok := scheduleSyntaxes[syntax]; !ok {
+		return "", fmt.Errorf("unknown schedule syntax %q (expected one of %s)", syntax, strings.Join(syntaxNames, ", "))
+	}
+	return syntax, nil
+}
+
+// splitSyntaxPrefix returns the syntax of a job line (defaultSyntax if it has
+// no prefix, or SyntaxCron if that's empty), and how long its prefix (if it
+// has one, e.g. "@quartz ") is.
+func splitSyntaxPrefix(line string, indices [][]int, defaultSyntax string) (*scheduleSyntax, int) {
+	if len(indices) > 0 && strings.HasPrefix(line, "@") {
+		if syntax, ok := scheduleSyntaxes[line[1:indices[0][1]]]; ok {
+			if len(indices) > 1 {
+				return syntax, indices[1][0]
+			}
+			return syntax, len(line)
+		}
+	}
+
+	if defaultSyntax == "" {
+		defaultSyntax = SyntaxCron
+	}
+	return scheduleSyntaxes[defaultSyntax], 0
+}
+
+// parseQuartz parses a Quartz schedule, by translating it to cronexpr's
+// syntax (which only differs in how days of the week are numbered, in "L"
+// alone meaning the last day of the week, and in years being required when
+// there are seconds).
+func parseQuartz(schedule string) (Expression, error) {
+	fields := strings.Fields(schedule)
+	if len(fields) != 6 && len(fields) != 7 {
+		return nil, fmt.Errorf("quartz schedule %q must have 6 or 7 fields", schedule)
+	}
+
+	dow, err := translateQuartzDow(fields[5])
+	if err != nil {
+		return nil, err
+	}
+	fields[5] = dow
+
+	if len(fields) == 6 {
+		fields = append(fields, "*")
+	}
+
+	expr, err := parseCronFields(fields)
+	if err != nil {
+		return nil, err
+	}
+	return newWallClockExpression(expr, fields), nil
+}
+
+func translateQuartzDow(field string) (string, error) {
+	entries := strings.Split(field, ",")
+	for i, entry := range entries {
+		if entry == "L" || entry == "l" {
+			entries[i] = "7"
+		}
+	}
+	field = strings.Join(entries, ",")
+
+	var translated strings.Builder
+	last := 0
+
+	for _, match := range quartzDowMatcher.FindAllStringSubmatchIndex(field, -1) {
+		day, _ := strconv.Atoi(field[match[4]:match[5]])
+		if day < 1 || day > 7 {
+			return "", fmt.Errorf("quartz day of the week %d out of range (1-7)", day)
+		}
+
+		translated.WriteString(field[last:match[4]])
+		translated.WriteString(strconv.Itoa(day - 1))
+		last = match[5]
+	}
+
+	translated.WriteString(field[last:])
+	return translated.String(), nil
+}
@@ -0,0 +1,137 @@
+package crontab
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var scheduleSyntaxTestCases = []struct {
+	line     string
+	schedule string
+	command  string
+	next     time.Time
+}{
+	// Saturday, April 7th 2018, at noon
+	{"@cron @hourly echo hi", "@cron @hourly", "echo hi", localTime(2018, 4, 7, 13, 0)},
+
+	{"0 18 LW * * ./payroll.sh", "0 18 LW * *", "./payroll.sh", localTime(2018, 4, 30, 18, 0)},
+	{"0 9 15W * * echo hi", "0 9 15W * *", "echo hi", localTime(2018, 4, 16, 9, 0)},
+	{"0 9 * * 2#2 echo hi", "0 9 * * 2#2", "echo hi", localTime(2018, 4, 10, 9, 0)},
+	{"0 17 * * 5L echo hi", "0 17 * * 5L", "echo hi", localTime(2018, 4, 27, 17, 0)},
+	{"0 18 L-3 * * echo hi", "0 18 L-3 * *", "echo hi", localTime(2018, 4, 27, 18, 0)},
+	{"0 0 1,L-1 * * echo hi", "0 0 1,L-1 * *", "echo hi", localTime(2018, 4, 29, 0, 0)},
+	{"0 0 0 20,L-1 * ? * echo hi", "0 0 0 20,L-1 * ? *", "echo hi", localTime(2018, 4, 20, 0, 0)},
+
+	{"@quartz 0 30 2 ? * MON-FRI ./backup.sh", "@quartz 0 30 2 ? * MON-FRI", "./backup.sh", localTime(2018, 4, 9, 2, 30)},
+	{"@quartz 0 0 12 ? * 2-6 * echo hi", "@quartz 0 0 12 ? * 2-6 *", "echo hi", localTime(2018, 4, 9, 12, 0)},
+	{"@quartz 0 0 9 ? * 1 echo sunday", "@quartz 0 0 9 ? * 1", "echo sunday", localTime(2018, 4, 8, 9, 0)},
+	{"@quartz 0 0 9 ? * 7#2 echo hi", "@quartz 0 0 9 ? * 7#2", "echo hi", localTime(2018, 4, 14, 9, 0)},
+	{"@quartz 0 0 9 15 * ? echo hi", "@quartz 0 0 9 15 * ?", "echo hi", localTime(2018, 4, 15, 9, 0)},
+	{"@quartz 0 0 9 ? * L echo hi", "@quartz 0 0 9 ? * L", "echo hi", localTime(2018, 4, 14, 9, 0)},
+	{"@quartz 0 0 9 ? * 6L echo hi", "@quartz 0 0 9 ? * 6L", "echo hi", localTime(2018, 4, 27, 9, 0)},
+	{"@quartz 0 0 9 L-2 * ? echo hi", "@quartz 0 0 9 L-2 * ?", "echo hi", localTime(2018, 4, 28, 9, 0)},
+	{"@quartz 0 0 9 LW * ? echo hi", "@quartz 0 0 9 LW * ?", "echo hi", localTime(2018, 4, 30, 9, 0)},
+
+	{"@systemd Mon..Fri 02:00 ./backup.sh", "@systemd Mon..Fri 02:00", "./backup.sh", localTime(2018, 4, 9, 2, 0)},
+	{"@systemd daily echo hi", "@systemd daily", "echo hi", localTime(2018, 4, 8, 0, 0)},
+	{"@systemd Sat,Sun 10:00 echo weekend", "@systemd Sat,Sun 10:00", "echo weekend", localTime(2018, 4, 8, 10, 0)},
+	{"@systemd Fri..Mon *-*-* 13:00 echo hi", "@systemd Fri..Mon *-*-* 13:00", "echo hi", localTime(2018, 4, 7, 13, 0)},
+	{"@systemd *-*-01,15 06:30:15 echo hi", "@systemd *-*-01,15 06:30:15", "echo hi", localTime(2018, 4, 15, 6, 30).Add(15 * time.Second)},
+	{"@systemd 04-08 */6:00 echo hi", "@systemd 04-08 */6:00", "echo hi", localTime(2018, 4, 8, 0, 0)},
+	{"@systemd 2018-05-1..3 echo hi", "@systemd 2018-05-1..3", "echo hi", localTime(2018, 5, 1, 0, 0)},
+	{"@systemd 2018-04-08 18:00 UTC echo hi", "@systemd 2018-04-08 18:00 UTC", "echo hi", time.Date(2018, 4, 8, 18, 0, 0, 0, time.UTC)},
+
+	// Failure cases
+	{"0 0 L-3 * 1 echo hi", "", "", time.Time{}},
+	{"0 0 L-31 * * echo hi", "", "", time.Time{}},
+	{"0 0 L-0 * * echo hi", "", "", time.Time{}},
+	{"0 0 L-x * * echo hi", "", "", time.Time{}},
+	{"@quartz 0 0 9 L-2 * MON echo hi", "", "", time.Time{}},
+	{"@quartz 0 0 9 ? * 8 echo hi", "", "", time.Time{}},
+	{"@quartz * * * * * echo hi", "", "", time.Time{}},
+	{"@quartz", "", "", time.Time{}},
+	{"@systemd Mon *-*-01 00:00 echo hi", "", "", time.Time{}},
+	{"@systemd Mon..Fri 25:00 echo hi", "", "", time.Time{}},
+	{"@systemd Someday 02:00 echo hi", "", "", time.Time{}},
+	{"@systemd ./backup.sh", "", "", time.Time{}},
+}
+
+func TestParseJobLineSyntaxes(t *testing.T) {
+	for _, tt := range scheduleSyntaxTestCases {
+		label := fmt.Sprintf("parseJobLine(%q)", tt.line)
+
+		line, err := parseJobLine(tt.line)
+
+		if tt.next.IsZero() {
+			assert.Nil(t, line, label)
+			assert.NotNil(t, err, label)
+			continue
+		}
+
+		if assert.Nil(t, err, label) {
+			assert.Equal(t, tt.schedule, line.Schedule, label)
+			assert.Equal(t, tt.command, line.Command, label)
+
+			next := line.Expression.Next(localTime(2018, 4, 7, 12, 0))
+			assert.True(t, tt.next.Equal(next), "%s: %v", label, next)
+		}
+	}
+}
+
+func TestLastDayOffsets(t *testing.T) {
+	line, err := parseJobLine("0 0 L-1 * * echo hi")
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	// 2020 is a leap year
+	next := localTime(2020, 1, 1, 0, 0)
+	for _, expected := range []time.Time{
+		localTime(2020, 1, 30, 0, 0),
+		localTime(2020, 2, 28, 0, 0),
+		localTime(2020, 3, 30, 0, 0),
+		localTime(2020, 4, 29, 0, 0),
+	} {
+		next = line.Expression.Next(next)
+		assert.True(t, expected.Equal(next), "expected %v, got %v", expected, next)
+	}
+
+	// February never has a day 30 days before its last one
+	line, err = parseJobLine("0 0 L-30 2 * echo hi")
+	if assert.Nil(t, err) {
+		assert.True(t, line.Expression.Next(localTime(2020, 1, 1, 0, 0)).IsZero())
+	}
+}
+
+func TestDefaultScheduleSyntax(t *testing.T) {
+	parser := &Parser{ScheduleSyntax: SyntaxSystemd}
+
+	line, err := parser.parseJobLine("Mon..Fri 02:00 ./backup.sh")
+	if assert.Nil(t, err) {
+		assert.Equal(t, "Mon..Fri 02:00", line.Schedule)
+		assert.Equal(t, "./backup.sh", line.Command)
+	}
+
+	// Other syntaxes are still available with a prefix
+	line, err = parser.parseJobLine("@cron 0 2 * * 1-5 ./backup.sh")
+	if assert.Nil(t, err) {
+		assert.Equal(t, "@cron 0 2 * * 1-5", line.Schedule)
+	}
+
+	_, err = parser.parseJobLine("0 2 * * 1-5 ./backup.sh")
+	assert.NotNil(t, err)
+}
+
+func TestParseScheduleSyntax(t *testing.T) {
+	for _, syntax := range []string{SyntaxCron, SyntaxQuartz, SyntaxSystemd} {
+		parsed, err := ParseScheduleSyntax(syntax)
+		assert.Nil(t, err)
+		assert.Equal(t, syntax, parsed)
+	}
+
+	_, err := ParseScheduleSyntax("anacron")
+	assert.NotNil(t, err)
+}
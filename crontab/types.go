@@ -1,6 +1,8 @@
 package crontab
 
 import (
+	"regexp"
+	"syscall"
 	"time"
 )
 
@@ -17,14 +19,201 @@ type CrontabLine struct {
 type Job struct {
 	CrontabLine
 	Position int
+
+	// The arguments of the command, if it runs without a shell (i.e. it
+	// starts with EXEC_PREFIX)
+	Argv []string
+
+	// Identifies the job, unlike its position, which changes when jobs are
+	// added or removed (empty for unnamed jobs). Set using "# name:" lines,
+	// or in structured configurations.
+	Name string
+
+	// Who the job runs as, in system crontabs (see FormatSystem), or empty
+	// to run as cronic's user
+	User string
+
+	// Fed to the command's stdin: in crontabs, what follows an unescaped %
+	// (unless Parser.LiteralPercent is set), or the stdin of structured
+	// configurations
+	Stdin string
+
+	// The file fed to the command's stdin instead (relative to the job's
+	// directory), set using the stdin annotation
+	StdinFile string
+
+	// Where the job is defined: the crontab file it's in (which can be
+	// included by another one, or empty if the crontab wasn't read from a
+	// file), and the line it starts on
+	File string
+	Line int
+
+	// Only set in structured configurations (see ParseConfig)
+	Environ map[string]string
+	Dir     string
+
+	// Set using "# cronic:" annotations (which are also kept as-is in
+	// Annotations)
+	Annotations  map[string]string
+	PathPrepend  string
+	StdoutLevel  *Level
+	StderrLevel  *Level
+	Quiet        bool
+	DebugCommand string
+	Namespace    string
+
+	// Commands to run once a run succeeds, or fails (and won't be retried)
+	OnSuccess string
+	OnFailure string
+
+	// Override the global webhook settings
+	WebhookURL    string
+	WebhookEvents []EventType
+
+	// Overrides the Slack webhook's default channel
+	SlackChannel string
+
+	// Override the facility and tag of the job's messages, when sending
+	// them to syslog
+	SyslogFacility string
+	SyslogTag      string
+
+	// How long the job can run before it's killed (0 for no limit), and
+	// before cronic warns that it's still running (0 for no warning)
+	Timeout   time.Duration
+	WarnAfter time.Duration
+
+	// Delays each scheduled run by up to Splay, to spread out the runs of
+	// jobs (or hosts) that are due at the same time. The delay is random,
+	// unless SplayStable, in which case it's the same for every run of the
+	// job on a given host.
+	Splay       time.Duration
+	SplayStable bool
+
+	// When the job doesn't run (in addition to the global blackout), and
+	// what happens to its scheduled runs then (skipped unless OnBlackout is
+	// BlackoutDefer)
+	Blackout   Blackout
+	OnBlackout string
+
+	// Skip the scheduled runs that fall on holidays (see cron.Options)
+	SkipHolidays bool
+
+	// The job only runs if IfEnv holds, and unless UnlessEnv does (if
+	// they're set), when cronic starts (see Crontab.RemoveDisabled)
+	IfEnv     *EnvCondition
+	UnlessEnv *EnvCondition
+
+	// If set, sent to the job's processes CheckpointGrace before its
+	// timeout, so they can save their progress
+	CheckpointSignal syscall.Signal
+	CheckpointGrace  time.Duration
+
+	// Pause the job once it failed this many times in a row (0 to never),
+	// for PauseFor (0 until it's resumed)
+	PauseAfterFailures int
+	PauseFor           time.Duration
+
+	// A host-wide lock the job holds while running (shared with other
+	// cronic processes)
+	Lock string
+
+	// The names of the jobs whose most recent runs must have succeeded for
+	// the job to run (waiting for their runs at the same time, if any)
+	After []string
+
+	// Nil if failed runs aren't retried
+	Retry *RetryPolicy
+
+	// Overrides the crontab's shell
+	Shell string
+
+	// Whether the interval of an "@every" schedule starts at the end of the
+	// previous run (see IntervalFromEnd)
+	IntervalFromEnd bool
+
+	// What to do when the command can't be started (one of the
+	// SpawnFailure* policies, or empty for cronic's default)
+	OnSpawnFailure string
+
+	// If set, a run that exits successfully still fails (as FailureOutput)
+	// unless a line of its output contains ExpectOutput, and one matches
+	// ExpectOutputMatch
+	ExpectOutput      string
+	ExpectOutputMatch *regexp.Regexp
+
+	// How many lines of output per second cronic relays (0 for cronic's
+	// default)
+	OutputRateLimit int
+
+	// How many lines of output per second cronic logs, with bursts of how
+	// many, and one in how many lines it logs (0 for cronic's defaults):
+	// unlike with OutputRateLimit, the other lines aren't logged, but the
+	// job isn't slowed down
+	LogRateLimit int
+	LogBurst     int
+	LogSample    int
+
+	// How many bytes of output cronic logs per run (0 for no limit)
+	MaxOutput int64
+
+	// Resource limits of the job's processes (0 for no limit): memory in
+	// bytes, CPUs' worth of time, and open files
+	MemoryLimit int64
+	CPULimit    float64
+	NoFile      int
+
+	// The niceness of the job's processes (0 to inherit cronic's)
+	Nice int
+
+	// The umask of the job's processes (nil to inherit cronic's)
+	Umask *int
+
+	// If set, the job runs in a fresh container of this image, pulled
+	// according to ImagePull (one of the Pull* policies, or empty for
+	// PullMissing), with these bind mounts (see ParseMounts)
+	Image     string
+	ImagePull string
+	Mounts    []string
+
+	// The Kubernetes Job manifest to run the job with, when containers are
+	// Kubernetes Jobs (the executor's if empty)
+	JobTemplate string
+
+	// If set, the job runs on this remote host ([USER@]HOST[:PORT]) over
+	// SSH, authenticating with SSHKey (the executor's if empty)
+	Host   string
+	SSHKey string
+
+	// Which of cronic's environment variables the job inherits (see
+	// ParseEnvPatterns): only those EnvAllow matches (if set), except those
+	// EnvDeny matches
+	EnvAllow []string
+	EnvDeny  []string
+
+	// The I/O scheduling class of the job's processes (one of the IOClass*
+	// classes, or empty to inherit cronic's), and its level
+	IOClass string
+	IOLevel int
+
+	// Whether to log the fields of output lines that are JSON objects,
+	// rather than the lines (nil for cronic's default)
+	JSONOutput *bool
 }
 
 type Context struct {
 	Shell   string
 	Environ map[string]string
+
+	// The working directory of jobs that don't set their own: the
+	// crontab's HOME, if it sets one (like cron does)
+	Home string
 }
 
 type Crontab struct {
 	Jobs    []*Job
 	Context *Context
+
+	// How many malformed lines were skipped (see Parser.Lenient)
+	BadLines int
 }
@@ -0,0 +1,115 @@
+package crontab
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FormatJob formats a job like the zero Parser does.
+func FormatJob(job *Job) (string, error) {
+	return (&Parser{}).FormatJob(job)
+}
+
+// FormatJob formats a job as crontab lines (its name and annotations, if any,
+// then the job itself), which p can parse back.
+func (p *Parser) FormatJob(job *Job) (string, error) {
+	lines := make([]string, 0, 3)
+
+	if job.Name != "" {
+		if err := ValidateJobName(job.Name); err != nil {
+			return "", err
+		}
+		lines = append(lines, "# name: "+job.Name)
+	}
+
+	if len(job.Annotations) > 0 {
+		keys := make([]string, 0, len(job.Annotations))
+		for key := range job.Annotations {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		pairs := make([]string, 0, len(keys))
+		for _, key := range keys {
+			value, err := quoteAnnotationValue(job.Annotations[key])
+			if err != nil {
+				return "", fmt.Errorf("annotation %q: %v", key, err)
+			}
+			pairs = append(pairs, fmt.Sprintf("%s=%s", key, value))
+		}
+
+		lines = append(lines, "# cronic: "+strings.Join(pairs, " "))
+	}
+
+	lines = append(lines, job.Schedule+" "+joinStdin(job.Command, job.Stdin, p.LiteralPercent))
+
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+func quoteAnnotationValue(value string) (string, error) {
+	switch {
+	case strings.ContainsAny(value, "\r\n"):
+		return "", fmt.Errorf("value must be a single line")
+	case value != "" && !strings.ContainsAny(value, " \t\"'"):
+		return value, nil
+	case !strings.Contains(value, `"`):
+		return `"` + value + `"`, nil
+	case !strings.Contains(value, `'`):
+		return `'` + value + `'`, nil
+	default:
+		return "", fmt.Errorf("value cannot contain both single and double quotes")
+	}
+}
+
+// WriteCrontab writes jobs to a crontab at path like the zero Parser does.
+func WriteCrontab(path string, header string, jobs []*Job) error {
+	return (&Parser{}).WriteCrontab(path, header, jobs)
+}
+
+// WriteCrontab writes jobs to a crontab at path, which p can parse back. The
+// file is replaced atomically, so a concurrent reader never sees a partial
+// crontab.
+func (p *Parser) WriteCrontab(path string, header string, jobs []*Job) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := p.writeJobs(tmp, header, jobs); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (p *Parser) writeJobs(w io.Writer, header string, jobs []*Job) error {
+	for _, line := range strings.Split(header, "\n") {
+		if _, err := fmt.Fprintf(w, "# %s\n", line); err != nil {
+			return err
+		}
+	}
+
+	for _, job := range jobs {
+		formatted, err := p.FormatJob(job)
+		if err != nil {
+			return err
+		}
+
+		if _, err := fmt.Fprintf(w, "\n%s", formatted); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
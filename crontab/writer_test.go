@@ -0,0 +1,71 @@
+package crontab
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteCrontabRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cronic-test")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	jobs := make([]*Job, 0)
+	for _, annotations := range []map[string]string{
+		nil,
+		{"quiet": "true", "path-prepend": "/opt/app/bin"},
+		{"debug-command": "df -h /var"},
+		{"debug-command": `echo "broken"`},
+		{"debug-command": `echo 'broken'`},
+	} {
+		job, err := NewJob("*/5 * * * *", "foo bar", annotations)
+		if !assert.Nil(t, err) {
+			return
+		}
+		jobs = append(jobs, job)
+	}
+	jobs[1].Name = "backup-db"
+
+	path := filepath.Join(dir, "crontab")
+	if !assert.Nil(t, WriteCrontab(path, "Managed by cronic", jobs)) {
+		return
+	}
+
+	file, err := os.Open(path)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer file.Close()
+
+	tab, err := ParseCrontab(file)
+	if assert.Nil(t, err) && assert.Equal(t, len(jobs), len(tab.Jobs)) {
+		for i, job := range tab.Jobs {
+			assert.Equal(t, jobs[i].Schedule, job.Schedule)
+			assert.Equal(t, jobs[i].Command, job.Command)
+			assert.Equal(t, jobs[i].Annotations, job.Annotations)
+			assert.Equal(t, jobs[i].Name, job.Name)
+		}
+	}
+
+	// No temporary files are left behind
+	entries, err := ioutil.ReadDir(dir)
+	if assert.Nil(t, err) {
+		assert.Equal(t, 1, len(entries))
+	}
+}
+
+func TestFormatJobRejectsUnquotableValues(t *testing.T) {
+	job := &Job{
+		CrontabLine: CrontabLine{Schedule: "* * * * *", Command: "foo"},
+		Annotations: map[string]string{"debug-command": `echo "it's"`},
+	}
+
+	_, err := FormatJob(job)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/samgaw/cronic/cron"
+	"github.com/samgaw/cronic/web"
+
+	"github.com/sirupsen/logrus"
+)
+
+const ctlUsage = `Usage: %s ctl [OPTIONS] COMMAND [ARGS]
+
+Commands:
+  jobs              list the jobs, and whether they're running, paused or failing
+  next              list the jobs by their next run
+  run JOB           trigger a run of the job (by name or position)
+  cancel JOB        cancel the job's current run
+  pause JOB         stop scheduling the job
+  resume JOB        resume scheduling the job
+  tail [-f] JOB     show the job's recent output (and follow it, with -f)
+  runs [-n N] JOB   show the job's last runs (with -history-db or -state-store)
+
+Available options:
+`
+
+// ctlMain runs "cronic ctl", which controls a cronic daemon through the API
+// of its web dashboard (see -listen).
+func ctlMain(args []string) {
+	flags := flag.NewFlagSet("ctl", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, ctlUsage, os.Args[0])
+		flags.PrintDefaults()
+	}
+
+	defaultAddr := os.Getenv("CRONIC_ADDR")
+	if defaultAddr == "" {
+		defaultAddr = "localhost:8080"
+	}
+
+	addr := flags.String("addr", defaultAddr, "the address the daemon serves its dashboard on (see -listen), e.g. localhost:8080 or unix:/run/cronic.sock (defaults to $CRONIC_ADDR, or localhost:8080)")
+	apiToken := flags.String("api-token", os.Getenv("CRONIC_API_TOKEN"), "present this bearer token to the daemon (defaults to $CRONIC_API_TOKEN)")
+	namespace := flags.String("namespace", "", "with jobs and next, only list the jobs in this namespace")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+		return
+	}
+
+	client, err := web.NewClient(*addr, *apiToken)
+	if err != nil {
+		logrus.Fatal(err)
+		return
+	}
+
+	command, args := flags.Arg(0), flags.Args()[1:]
+
+	// The commands other than listing jobs take a job
+	jobArg := func() string {
+		if len(args) != 1 {
+			flags.Usage()
+			os.Exit(2)
+		}
+		return args[0]
+	}
+
+	switch command {
+	case "jobs", "next":
+		if len(args) != 0 {
+			flags.Usage()
+			os.Exit(2)
+			return
+		}
+
+		jobs, err := client.Jobs(*namespace)
+		if err != nil {
+			ctlFatal(err)
+			return
+		}
+
+		if command == "jobs" {
+			printJobs(jobs)
+		} else {
+			printNextRuns(jobs)
+		}
+	case "run", "cancel", "pause", "resume":
+		actions := map[string]func(string) (*cron.JobSnapshot, error){
+			"run":    client.Run,
+			"cancel": client.Cancel,
+			"pause":  client.Pause,
+			"resume": client.Resume,
+		}
+
+		job, err := actions[command](jobArg())
+		if err != nil {
+			ctlFatal(err)
+			return
+		}
+		printJobs([]cron.JobSnapshot{*job})
+	case "tail":
+		tailFlags := flag.NewFlagSet("tail", flag.ExitOnError)
+		tailFlags.Usage = flags.Usage
+		follow := tailFlags.Bool("f", false, "follow the job's output as it's emitted")
+		tailFlags.Parse(args)
+		args = tailFlags.Args()
+
+		id := jobArg()
+
+		if !*follow {
+			job, err := client.Job(id)
+			if err != nil {
+				ctlFatal(err)
+				return
+			}
+			for _, line := range job.Output {
+				printOutputLine(line)
+			}
+			return
+		}
+
+		ctx, stop := context.WithCancel(context.Background())
+		defer stop()
+
+		termChan := make(chan os.Signal, 1)
+		signal.Notify(termChan, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			<-termChan
+			stop()
+		}()
+
+		if err := client.Follow(ctx, id, printOutputLine); err != nil {
+			ctlFatal(err)
+			return
+		}
+	case "runs":
+		runsFlags := flag.NewFlagSet("runs", flag.ExitOnError)
+		runsFlags.Usage = flags.Usage
+		limit := runsFlags.Int("n", 20, "show this many runs")
+		runsFlags.Parse(args)
+		args = runsFlags.Args()
+
+		runs, err := client.Runs(jobArg(), *limit)
+		if err != nil {
+			ctlFatal(err)
+			return
+		}
+		printRuns(runs)
+	default:
+		fmt.Fprintf(os.Stderr, "%s ctl: unknown command: %s\n\n", os.Args[0], command)
+		flags.Usage()
+		os.Exit(2)
+	}
+}
+
+// ctlFatal reports an error talking to the daemon, without logrus' noise:
+// "cronic ctl" is meant for people at a terminal.
+func ctlFatal(err error) {
+	fmt.Fprintf(os.Stderr, "%s ctl: %v\n", os.Args[0], err)
+	os.Exit(1)
+}
+
+func printJobs(jobs []cron.JobSnapshot) {
+	out := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(out, "JOB\tSCHEDULE\tSTATUS\tLAST RUN\tNEXT RUN\tCOMMAND\n")
+	for _, job := range jobs {
+		fmt.Fprintf(out, "%s\t%s\t%s\t%s\t%s\t%s\n", ctlJobName(job), job.Schedule, jobState(job), lastRun(job), nextRun(job), job.Command)
+	}
+	out.Flush()
+}
+
+func printNextRuns(jobs []cron.JobSnapshot) {
+	sorted := make([]cron.JobSnapshot, 0, len(jobs))
+	for _, job := range jobs {
+		if job.NextRun != nil {
+			sorted = append(sorted, job)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].NextRun.Before(*sorted[j].NextRun)
+	})
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(out, "NEXT RUN\tIN\tJOB\tSCHEDULE\n")
+	for _, job := range sorted {
+		in := time.Until(*job.NextRun).Round(time.Second)
+		if in < 0 {
+			in = 0
+		}
+		fmt.Fprintf(out, "%s\t%s\t%s\t%s\n", job.NextRun.Format(time.RFC3339), in, ctlJobName(job), job.Schedule)
+	}
+	out.Flush()
+}
+
+func printRuns(runs []cron.RunResult) {
+	out := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(out, "RUN ID\tSTARTED\tDURATION\tRESULT\tEXIT CODE\tOUTPUT\n")
+	for _, run := range runs {
+		exitCode, output := "-", "-"
+		if run.ExitCode != nil {
+			exitCode = fmt.Sprint(*run.ExitCode)
+		}
+		if run.OutputFile != "" {
+			output = run.OutputFile
+		}
+
+		fmt.Fprintf(out, "%s\t%s\t%s\t%s\t%s\t%s\n", run.RunID, run.StartedAt.Format(time.RFC3339), run.FinishedAt.Sub(run.StartedAt).Round(time.Millisecond), runOutcome(run), exitCode, output)
+	}
+	out.Flush()
+}
+
+// runOutcome describes how a run went.
+func runOutcome(run cron.RunResult) string {
+	switch {
+	case run.Success:
+		return "success"
+	case run.TimedOut:
+		return "timed out"
+	default:
+		return "failed"
+	}
+}
+
+func printOutputLine(line cron.OutputLine) {
+	out := os.Stdout
+	if line.Channel == "stderr" {
+		out = os.Stderr
+	}
+	fmt.Fprintln(out, line.Line)
+}
+
+// ctlJobName identifies a job in the output of "cronic ctl", using its
+// position (which the commands also accept) for jobs without a name.
+func ctlJobName(job cron.JobSnapshot) string {
+	if job.Name != "" {
+		return job.Name
+	}
+	return fmt.Sprint(job.Position)
+}
+
+func jobState(job cron.JobSnapshot) string {
+	switch {
+	case job.Draining:
+		return "draining"
+	case job.Running:
+		return "running"
+	case job.Paused:
+		return "paused"
+	case job.LastResult != nil && job.LastResult.TimedOut:
+		return "timed out"
+	case job.LastResult != nil && !job.LastResult.Success:
+		return "failing"
+	default:
+		return "ok"
+	}
+}
+
+func lastRun(job cron.JobSnapshot) string {
+	if job.LastResult == nil {
+		return "-"
+	}
+	return job.LastResult.StartedAt.Format(time.RFC3339)
+}
+
+func nextRun(job cron.JobSnapshot) string {
+	if job.NextRun == nil {
+		return "-"
+	}
+	return job.NextRun.Format(time.RFC3339)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/samgaw/cronic/cronictest"
+	"github.com/samgaw/cronic/crontab"
+	"github.com/samgaw/cronic/ical"
+
+	"github.com/sirupsen/logrus"
+)
+
+// exportICalMain runs "cronic export-ical", which writes the runs cronic
+// would start over a period of time as an iCalendar file, to overlay them on
+// a shared calendar.
+func exportICalMain(args []string) {
+	flags := flag.NewFlagSet("export-ical", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s export-ical [OPTIONS] CRONTAB > schedule.ics\n       %s export-ical [OPTIONS] -config FILE > schedule.ics\n\nAvailable options:\n", os.Args[0], os.Args[0])
+		flags.PrintDefaults()
+	}
+
+	from := flags.String("from", "", "export runs after this date, e.g. 2018-04-07 or 2018-04-07T09:30 (defaults to now)")
+	horizon := flags.Duration("horizon", 7*24*time.Hour, "export runs up to this long after -from")
+	duration := flags.Duration("duration", 15*time.Minute, "make each run's event this long")
+	tabFlags := addCrontabFlags(flags)
+	flags.Parse(args)
+
+	var err error
+
+	start := time.Now()
+	if *from != "" {
+		start, err = crontab.ParseDate(*from)
+		if err != nil {
+			logrus.Fatalf("CRONIC: Bad -from: %v", err)
+			return
+		}
+	}
+
+	if *horizon <= 0 {
+		logrus.Fatalf("CRONIC: Bad -horizon: %v isn't positive", *horizon)
+		return
+	}
+
+	if *duration <= 0 {
+		logrus.Fatalf("CRONIC: Bad -duration: %v isn't positive", *duration)
+		return
+	}
+
+	tab, _ := tabFlags.read(flags)
+	end := start.Add(*horizon)
+	runs := cronictest.New(tab, start).AdvanceTo(end)
+
+	if err := ical.Write(os.Stdout, runs, *duration, time.Now()); err != nil {
+		logrus.Fatal(err)
+		return
+	}
+
+	logrus.Infof("CRONIC: Exported %d runs from %s to %s", len(runs), start.Format(time.RFC3339), end.Format(time.RFC3339))
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/samgaw/cronic/hub"
+
+	"github.com/sirupsen/logrus"
+)
+
+// instancesFlag collects the -instance flags.
+type instancesFlag []string
+
+func (f *instancesFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *instancesFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// hubMain runs "cronic hub", which serves the combined jobs of a fleet of
+// cronic daemons.
+func hubMain(args []string) {
+	flags := flag.NewFlagSet("hub", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s hub [OPTIONS] -instance [NAME=]URL...\n\nAvailable options:\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+
+	var specs instancesFlag
+	flags.Var(&specs, "instance", "poll the web API of the cronic daemon at this URL, e.g. web-1=http://web-1:8080 (repeat for each daemon)")
+	listen := flags.String("listen", ":8080", "serve the fleet's dashboard on this address")
+	pollInterval := flags.Duration("poll-interval", 30*time.Second, "poll the daemons this often")
+	apiToken := flags.String("api-token", os.Getenv("CRONIC_API_TOKEN"), "present this bearer token to the daemons (defaults to $CRONIC_API_TOKEN)")
+	debug := flags.Bool("debug", false, "enable debug logging")
+	json := flags.Bool("json", false, "enable JSON logging")
+	flags.Parse(args)
+
+	if *debug {
+		logrus.SetLevel(logrus.DebugLevel)
+	}
+
+	if *json {
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	} else {
+		logrus.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+	}
+
+	if len(specs) == 0 || flags.NArg() != 0 {
+		flags.Usage()
+		os.Exit(2)
+		return
+	}
+
+	instances := make([]*hub.Instance, 0, len(specs))
+	names := make(map[string]bool)
+
+	for _, spec := range specs {
+		instance, err := hub.ParseInstance(spec, *apiToken)
+		if err != nil {
+			logrus.Fatal(err)
+			return
+		}
+
+		if names[instance.Name] {
+			logrus.Fatalf("CRONIC: Bad instance: %q (another instance has the same name)", spec)
+			return
+		}
+		names[instance.Name] = true
+
+		instances = append(instances, instance)
+	}
+
+	fleet := hub.New(instances, logrus.WithField("component", "hub"))
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	logrus.Infof("CRONIC: Polling %d instances every %v", len(instances), *pollInterval)
+	go fleet.Run(ctx, *pollInterval)
+
+	server := &http.Server{Addr: *listen, Handler: fleet}
+
+	go func() {
+		logrus.Infof("CRONIC: Serving fleet dashboard on %s", *listen)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logrus.Fatal(err)
+		}
+	}()
+
+	termChan := make(chan os.Signal, 1)
+	signal.Notify(termChan, syscall.SIGINT, syscall.SIGTERM)
+
+	termSig := <-termChan
+	logrus.Infof("CRONIC: Received %s, shutting down", termSig)
+
+	server.Close()
+	logrus.Info("CRONIC: Exiting")
+}
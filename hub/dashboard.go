@@ -0,0 +1,130 @@
+package hub
+
+// Like the dashboard of daemons (see the web package), the fleet's is a
+// single static page, loading everything from the JSON API. Jobs are
+// controlled from their instance's dashboard, which it links to.
+const dashboardHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Cronic fleet</title>
+<style>
+  body { font-family: sans-serif; margin: 2em; color: #222; }
+  table { border-collapse: collapse; width: 100%; margin-bottom: 2em; }
+  th, td { text-align: left; padding: 0.4em 0.8em; border-bottom: 1px solid #ddd; }
+  code { font-size: 0.9em; }
+  .ok { color: #2a7a2a; }
+  .failed { color: #b22; }
+  .paused { color: #a60; }
+</style>
+</head>
+<body>
+<h1>Cronic fleet</h1>
+<h2>Instances</h2>
+<table>
+  <thead>
+    <tr><th>Instance</th><th>Health</th><th>Last seen</th><th>Jobs</th><th>Running</th><th>Paused</th><th>Failing</th></tr>
+  </thead>
+  <tbody id="instances"></tbody>
+</table>
+<h2>Jobs</h2>
+<table>
+  <thead>
+    <tr><th>Instance</th><th>Job</th><th>Schedule</th><th>Command</th><th>Next run</th><th>State</th><th>Last result</th></tr>
+  </thead>
+  <tbody id="jobs"></tbody>
+</table>
+<script>
+"use strict";
+
+var urls = {};
+
+function text(value, className) {
+  var span = document.createElement("span");
+  span.textContent = value;
+  if (className) {
+    span.className = className;
+  }
+  return span;
+}
+
+function cell(row, content) {
+  var td = document.createElement("td");
+  td.appendChild(typeof content === "string" ? text(content) : content);
+  row.appendChild(td);
+}
+
+function link(label, href) {
+  var a = document.createElement("a");
+  a.textContent = label;
+  a.href = href;
+  return a;
+}
+
+function time(value) {
+  return value ? new Date(value).toLocaleString() : "never";
+}
+
+function health(instance) {
+  return instance.healthy ? text("reachable", "ok") : text("unreachable: " + instance.error, "failed");
+}
+
+function state(job) {
+  if (job.paused) {
+    return text("paused since " + time(job.paused_since), "paused");
+  }
+  return text(job.running ? "running since " + time(job.running_since) : "idle");
+}
+
+function result(job) {
+  var r = job.last_result;
+  if (!r) {
+    return text("never ran");
+  }
+  return text((r.success ? "succeeded" : "failed: " + r.error) + " at " + time(r.finished_at), r.success ? "ok" : "failed");
+}
+
+function refresh() {
+  fetch("api/instances").then(function(response) { return response.json(); }).then(function(instances) {
+    var tbody = document.getElementById("instances");
+    tbody.textContent = "";
+    instances.forEach(function(instance) {
+      urls[instance.name] = instance.url;
+
+      var row = document.createElement("tr");
+      cell(row, link(instance.name, instance.url + "/"));
+      cell(row, health(instance));
+      cell(row, time(instance.last_seen));
+      cell(row, String(instance.jobs));
+      cell(row, String(instance.running));
+      cell(row, String(instance.paused));
+      cell(row, text(String(instance.failing), instance.failing > 0 ? "failed" : ""));
+      tbody.appendChild(row);
+    });
+  });
+
+  fetch("api/jobs").then(function(response) { return response.json(); }).then(function(jobs) {
+    var tbody = document.getElementById("jobs");
+    tbody.textContent = "";
+    jobs.forEach(function(job) {
+      var row = document.createElement("tr");
+      cell(row, link(job.instance, (urls[job.instance] || "") + "/"));
+      cell(row, job.name ? job.name : "#" + job.position);
+      cell(row, job.schedule);
+      var command = document.createElement("code");
+      command.textContent = job.command;
+      cell(row, command);
+      cell(row, job.next_run ? time(job.next_run) : "-");
+      cell(row, state(job));
+      cell(row, result(job));
+      tbody.appendChild(row);
+    });
+  });
+}
+
+refresh();
+setInterval(refresh, 5000);
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,245 @@
+// Package hub aggregates the jobs of a fleet of cronic daemons, polled from
+// their web APIs, into a single inventory, with the health of each daemon.
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samgaw/cronic/cron"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	POLL_TIMEOUT = 10 * time.Second
+)
+
+// The error of instances until they're first polled
+const errNotPolled = "not polled yet"
+
+// Instance is a cronic daemon serving its web API (see -listen).
+type Instance struct {
+	Name  string
+	URL   string
+	Token string
+}
+
+// ParseInstance parses "[NAME=]URL" (e.g. "web-1=http://web-1:8080"). The
+// name defaults to the URL's host.
+func ParseInstance(spec string, token string) (*Instance, error) {
+	name, rawURL := "", spec
+	if i := strings.Index(spec, "="); i != -1 && !strings.Contains(spec[:i], "/") {
+		name, rawURL = spec[:i], spec[i+1:]
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("CRONIC: Bad instance: %q (expected e.g. web-1=http://web-1:8080)", spec)
+	}
+
+	if name == "" {
+		name = u.Host
+	}
+
+	return &Instance{Name: name, URL: strings.TrimSuffix(rawURL, "/"), Token: token}, nil
+}
+
+// InstanceStatus is the health of an instance, as of its last poll.
+type InstanceStatus struct {
+	Name     string     `json:"name"`
+	URL      string     `json:"url"`
+	Healthy  bool       `json:"healthy"`
+	Error    string     `json:"error,omitempty"`
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+	Jobs     int        `json:"jobs"`
+	Running  int        `json:"running"`
+	Paused   int        `json:"paused"`
+	Failing  int        `json:"failing"`
+}
+
+// FleetJob is a job of one of the instances.
+type FleetJob struct {
+	Instance string `json:"instance"`
+	cron.JobSnapshot
+}
+
+// Hub polls instances, and keeps their last known jobs. Jobs of instances
+// that can't be reached are kept (and reported as such), since they likely
+// still exist.
+type Hub struct {
+	instances []*Instance
+	client    *http.Client
+	logger    *logrus.Entry
+
+	mu       sync.Mutex
+	statuses map[string]*InstanceStatus
+	jobs     map[string][]cron.JobSnapshot
+}
+
+func New(instances []*Instance, logger *logrus.Entry) *Hub {
+	h := &Hub{
+		instances: instances,
+		client:    &http.Client{Timeout: POLL_TIMEOUT},
+		logger:    logger,
+		statuses:  make(map[string]*InstanceStatus),
+		jobs:      make(map[string][]cron.JobSnapshot),
+	}
+
+	for _, instance := range instances {
+		h.statuses[instance.Name] = &InstanceStatus{Name: instance.Name, URL: instance.URL, Error: errNotPolled}
+	}
+
+	return h
+}
+
+// Run polls all instances every interval, until ctx is done.
+func (h *Hub) Run(ctx context.Context, interval time.Duration) {
+	for {
+		h.Poll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Poll polls all instances once, concurrently.
+func (h *Hub) Poll(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	for _, instance := range h.instances {
+		wg.Add(1)
+
+		go func(instance *Instance) {
+			defer wg.Done()
+
+			jobs, err := h.fetchJobs(ctx, instance)
+			h.update(instance, jobs, err)
+		}(instance)
+	}
+
+	wg.Wait()
+}
+
+func (h *Hub) fetchJobs(ctx context.Context, instance *Instance) ([]cron.JobSnapshot, error) {
+	req, err := http.NewRequest(http.MethodGet, instance.URL+"/api/jobs", nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	if instance.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+instance.Token)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	var jobs []cron.JobSnapshot
+	if err := json.NewDecoder(resp.Body).Decode(&jobs); err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+func (h *Hub) update(instance *Instance, jobs []cron.JobSnapshot, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	status := h.statuses[instance.Name]
+
+	if err != nil {
+		// Only report changes, rather than every failed poll
+		if status.Healthy || status.Error == errNotPolled {
+			h.logger.WithField("instance", instance.Name).Warnf("CRONIC: Failed to poll instance: %v", err)
+		}
+
+		status.Healthy = false
+		status.Error = err.Error()
+		return
+	}
+
+	if !status.Healthy && status.LastSeen != nil {
+		h.logger.WithField("instance", instance.Name).Info("CRONIC: Instance is reachable again")
+	}
+
+	now := time.Now()
+	status.Healthy = true
+	status.Error = ""
+	status.LastSeen = &now
+	status.Jobs = len(jobs)
+	status.Running, status.Paused, status.Failing = 0, 0, 0
+
+	for _, job := range jobs {
+		if job.Running {
+			status.Running++
+		}
+		if job.Paused {
+			status.Paused++
+		}
+		if failing(job) {
+			status.Failing++
+		}
+	}
+
+	h.jobs[instance.Name] = jobs
+}
+
+// failing reports whether the last run of a job failed.
+func failing(job cron.JobSnapshot) bool {
+	return job.LastResult != nil && !job.LastResult.Success
+}
+
+// Instances returns the status of all instances, by name.
+func (h *Hub) Instances() []InstanceStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	statuses := make([]InstanceStatus, 0, len(h.statuses))
+	for _, status := range h.statuses {
+		statuses = append(statuses, *status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// Jobs returns the last known jobs of all instances, by instance, and then
+// position.
+func (h *Hub) Jobs() []FleetJob {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	jobs := make([]FleetJob, 0)
+	for name, snapshots := range h.jobs {
+		for _, snapshot := range snapshots {
+			jobs = append(jobs, FleetJob{Instance: name, JobSnapshot: snapshot})
+		}
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		if jobs[i].Instance != jobs[j].Instance {
+			return jobs[i].Instance < jobs[j].Instance
+		}
+		return jobs[i].Position < jobs[j].Position
+	})
+	return jobs
+}
@@ -0,0 +1,152 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/samgaw/cronic/cron"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func discardLogger() *logrus.Entry {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	return logrus.NewEntry(logger)
+}
+
+func newTestInstance(t *testing.T, token string, jobs []cron.JobSnapshot) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/jobs", r.URL.Path)
+		if token != "" && r.Header.Get("Authorization") != "Bearer "+token {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(jobs)
+	}))
+}
+
+func TestParseInstance(t *testing.T) {
+	instance, err := ParseInstance("web-1=http://10.0.0.1:8080/", "secret")
+	if assert.Nil(t, err) {
+		assert.Equal(t, "web-1", instance.Name)
+		assert.Equal(t, "http://10.0.0.1:8080", instance.URL)
+		assert.Equal(t, "secret", instance.Token)
+	}
+
+	instance, err = ParseInstance("http://web-2:8080", "")
+	if assert.Nil(t, err) {
+		assert.Equal(t, "web-2:8080", instance.Name)
+	}
+
+	// Only the name is before the first "=", if it isn't part of the URL
+	instance, err = ParseInstance("http://web-3:8080/?a=b", "")
+	if assert.Nil(t, err) {
+		assert.Equal(t, "web-3:8080", instance.Name)
+	}
+
+	for _, spec := range []string{"web-1", "web-1=", "ftp://web-1", "web-1=http://"} {
+		_, err := ParseInstance(spec, "")
+		assert.NotNil(t, err, spec)
+	}
+}
+
+func TestHubAggregatesInstances(t *testing.T) {
+	healthy := newTestInstance(t, "", []cron.JobSnapshot{
+		{Position: 1, Schedule: "@daily", Command: "false", LastResult: &cron.RunResult{Success: false}},
+		{Position: 0, Name: "backup", Schedule: "@hourly", Command: "./backup.sh", Running: true},
+	})
+	defer healthy.Close()
+
+	authenticated := newTestInstance(t, "secret", []cron.JobSnapshot{
+		{Position: 0, Schedule: "@hourly", Command: "true", Paused: true},
+	})
+	defer authenticated.Close()
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "oops", http.StatusInternalServerError)
+	}))
+	defer down.Close()
+
+	hub := New([]*Instance{
+		{Name: "a", URL: healthy.URL},
+		{Name: "b", URL: authenticated.URL, Token: "secret"},
+		{Name: "c", URL: down.URL},
+	}, discardLogger())
+
+	hub.Poll(context.Background())
+
+	instances := hub.Instances()
+	if assert.Equal(t, 3, len(instances)) {
+		assert.True(t, instances[0].Healthy)
+		assert.Equal(t, 2, instances[0].Jobs)
+		assert.Equal(t, 1, instances[0].Running)
+		assert.Equal(t, 1, instances[0].Failing)
+
+		assert.True(t, instances[1].Healthy)
+		assert.Equal(t, 1, instances[1].Paused)
+
+		assert.False(t, instances[2].Healthy)
+		assert.Nil(t, instances[2].LastSeen)
+		assert.Regexp(t, "500", instances[2].Error)
+	}
+
+	jobs := hub.Jobs()
+	if assert.Equal(t, 3, len(jobs)) {
+		assert.Equal(t, "a", jobs[0].Instance)
+		assert.Equal(t, "backup", jobs[0].Name)
+		assert.Equal(t, "a", jobs[1].Instance)
+		assert.Equal(t, 1, jobs[1].Position)
+		assert.Equal(t, "b", jobs[2].Instance)
+	}
+
+	// Jobs of instances that become unreachable are kept
+	healthy.Close()
+	hub.Poll(context.Background())
+
+	instances = hub.Instances()
+	assert.False(t, instances[0].Healthy)
+	assert.NotNil(t, instances[0].LastSeen)
+	assert.Equal(t, 3, len(hub.Jobs()))
+}
+
+func TestHubServesFleet(t *testing.T) {
+	instance := newTestInstance(t, "", []cron.JobSnapshot{
+		{Position: 0, Schedule: "@hourly", Command: "true", LastResult: &cron.RunResult{Success: true}},
+	})
+	defer instance.Close()
+
+	hub := New([]*Instance{{Name: "a", URL: instance.URL}}, discardLogger())
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		hub.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	// Instances are unhealthy until they're polled
+	assert.Equal(t, http.StatusServiceUnavailable, get("/api/health").Code)
+
+	hub.Poll(context.Background())
+
+	assert.Equal(t, http.StatusOK, get("/api/health").Code)
+	assert.Equal(t, http.StatusOK, get("/").Code)
+	assert.Equal(t, http.StatusNotFound, get("/api/nope").Code)
+
+	var jobs []FleetJob
+	if assert.Nil(t, json.Unmarshal(get("/api/jobs?instance=a").Body.Bytes(), &jobs)) {
+		assert.Equal(t, 1, len(jobs))
+	}
+	if assert.Nil(t, json.Unmarshal(get("/api/jobs?instance=b").Body.Bytes(), &jobs)) {
+		assert.Equal(t, 0, len(jobs))
+	}
+
+	w := httptest.NewRecorder()
+	hub.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/jobs", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
@@ -0,0 +1,67 @@
+package hub
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// fleetHealth summarizes the health of the fleet.
+type fleetHealth struct {
+	Healthy   bool             `json:"healthy"`
+	Instances []InstanceStatus `json:"instances"`
+}
+
+// ServeHTTP serves the fleet's dashboard, and the JSON API it's built on:
+//
+//	GET /                the dashboard
+//	GET /api/instances   the health of each instance
+//	GET /api/jobs        the jobs of all instances (or those of ?instance=)
+//	GET /api/health      200 if all instances are reachable and none of
+//	                     their jobs is failing, 503 otherwise
+func (h *Hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(dashboardHTML))
+	case "/api/instances":
+		writeJSON(w, http.StatusOK, h.Instances())
+	case "/api/jobs":
+		instance := r.URL.Query().Get("instance")
+
+		jobs := make([]FleetJob, 0)
+		for _, job := range h.Jobs() {
+			if instance == "" || job.Instance == instance {
+				jobs = append(jobs, job)
+			}
+		}
+
+		writeJSON(w, http.StatusOK, jobs)
+	case "/api/health":
+		health := fleetHealth{Healthy: true, Instances: h.Instances()}
+		for _, instance := range health.Instances {
+			if !instance.Healthy || instance.Failing > 0 {
+				health.Healthy = false
+			}
+		}
+
+		code := http.StatusOK
+		if !health.Healthy {
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, health)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,99 @@
+// Package ical writes the runs of a crontab (see cronictest) as the events
+// of an iCalendar (RFC 5545) file, so that schedules can be overlaid on
+// shared calendars.
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/samgaw/cronic/cronictest"
+	"github.com/samgaw/cronic/crontab"
+)
+
+// The longest lines can be (in octets, excluding the line break), beyond
+// which they're folded
+const maxLineLength = 75
+
+const timeFormat = "20060102T150405Z"
+
+// Write writes a calendar with an event for each run, lasting duration.
+// Events are identified by their job and time, so that importing a calendar
+// again updates the events it has in common with the last one.
+func Write(w io.Writer, runs []cronictest.Run, duration time.Duration, now time.Time) error {
+	out := bufio.NewWriter(w)
+	write := func(line string) {
+		out.WriteString(fold(line))
+	}
+
+	write("BEGIN:VCALENDAR")
+	write("VERSION:2.0")
+	write("PRODID:-//samgaw//cronic//EN")
+	write("CALSCALE:GREGORIAN")
+	write("METHOD:PUBLISH")
+	write("X-WR-CALNAME:cronic")
+
+	for _, run := range runs {
+		name := jobName(run.Job)
+
+		write("BEGIN:VEVENT")
+		write(fmt.Sprintf("UID:%s-%s@cronic", run.At.UTC().Format(timeFormat), strings.Map(uidRune, name)))
+		write("DTSTAMP:" + now.UTC().Format(timeFormat))
+		write("DTSTART:" + run.At.UTC().Format(timeFormat))
+		write("DTEND:" + run.At.Add(duration).UTC().Format(timeFormat))
+		write("SUMMARY:" + escape(name))
+		write("DESCRIPTION:" + escape(run.Job.Schedule+" "+run.Job.Command))
+		if run.Job.Namespace != "" {
+			write("CATEGORIES:" + escape(run.Job.Namespace))
+		}
+		write("TRANSP:TRANSPARENT")
+		write("END:VEVENT")
+	}
+
+	write("END:VCALENDAR")
+	return out.Flush()
+}
+
+// jobName identifies a job in events, using its position for jobs without a
+// name (like "cronic simulate").
+func jobName(job *crontab.Job) string {
+	if job.Name != "" {
+		return job.Name
+	}
+	return fmt.Sprintf("job-%d", job.Position)
+}
+
+// uidRune keeps the runes of names that are safe in UIDs.
+func uidRune(r rune) rune {
+	if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.' {
+		return r
+	}
+	return '_'
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+
+func escape(text string) string {
+	return escaper.Replace(text)
+}
+
+// fold ends a content line, breaking it into lines of at most maxLineLength
+// octets (continued with a space), without splitting UTF-8 sequences.
+func fold(line string) string {
+	var b strings.Builder
+	length := 0
+	for _, r := range line {
+		size := len(string(r))
+		if length+size > maxLineLength {
+			b.WriteString("\r\n ")
+			length = 1
+		}
+		b.WriteRune(r)
+		length += size
+	}
+	b.WriteString("\r\n")
+	return b.String()
+}
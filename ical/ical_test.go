@@ -0,0 +1,80 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samgaw/cronic/cronictest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testStart = time.Date(2018, 4, 7, 12, 0, 0, 0, time.UTC)
+
+const testCrontab = `
+# name: backup
+0 13 * * * ./backup.sh --bucket s3://backups,s3://archive
+
+30 12 * * * echo hi
+`
+
+func TestWrite(t *testing.T) {
+	tab, err := cronictest.Parse(strings.NewReader(testCrontab), testStart)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	var buf bytes.Buffer
+	err = Write(&buf, tab.AdvanceTo(testStart.Add(2*time.Hour)), 15*time.Minute, testStart)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	assert.Equal(t, strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//samgaw//cronic//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"X-WR-CALNAME:cronic",
+		"BEGIN:VEVENT",
+		"UID:20180407T123000Z-job-1@cronic",
+		"DTSTAMP:20180407T120000Z",
+		"DTSTART:20180407T123000Z",
+		"DTEND:20180407T124500Z",
+		"SUMMARY:job-1",
+		"DESCRIPTION:30 12 * * * echo hi",
+		"TRANSP:TRANSPARENT",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:20180407T130000Z-backup@cronic",
+		"DTSTAMP:20180407T120000Z",
+		"DTSTART:20180407T130000Z",
+		"DTEND:20180407T131500Z",
+		"SUMMARY:backup",
+		"DESCRIPTION:0 13 * * * ./backup.sh --bucket s3://backups\\,s3://archive",
+		"TRANSP:TRANSPARENT",
+		"END:VEVENT",
+		"END:VCALENDAR",
+		"",
+	}, "\r\n"), buf.String())
+}
+
+var foldTestCases = []struct {
+	line   string
+	folded string
+}{
+	{"SUMMARY:backup", "SUMMARY:backup\r\n"},
+	{strings.Repeat("a", 75), strings.Repeat("a", 75) + "\r\n"},
+	{strings.Repeat("a", 80), strings.Repeat("a", 75) + "\r\n aaaaa\r\n"},
+	// UTF-8 sequences aren't split
+	{strings.Repeat("a", 74) + "é", strings.Repeat("a", 74) + "\r\n é\r\n"},
+}
+
+func TestFold(t *testing.T) {
+	for _, tt := range foldTestCases {
+		assert.Equal(t, tt.folded, fold(tt.line))
+	}
+}
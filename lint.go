@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/sirupsen/logrus"
+)
+
+// lintMain runs "cronic lint", which checks a crontab for likely mistakes,
+// and exits with a non-zero status if it finds any (e.g. in CI).
+func lintMain(args []string) {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s lint [OPTIONS] CRONTAB\n       %s lint [OPTIONS] -config FILE\n\nAvailable options:\n", os.Args[0], os.Args[0])
+		flags.PrintDefaults()
+	}
+
+	jsonOutput := flags.Bool("json", false, "print the issues as a JSON array, for other tools")
+	skip := flags.String("skip", "", "skip these checks (comma-separated): "+strings.Join(crontab.LintChecks, ", "))
+	tabFlags := addCrontabFlags(flags)
+	flags.Parse(args)
+
+	skipped := make(map[string]bool)
+	for _, check := range strings.Split(*skip, ",") {
+		check = strings.TrimSpace(check)
+		if check == "" {
+			continue
+		}
+		if !isLintCheck(check) {
+			logrus.Fatalf("CRONIC: Bad -skip: unknown check %q (expected one of %s)", check, strings.Join(crontab.LintChecks, ", "))
+			return
+		}
+		skipped[check] = true
+	}
+
+	tab, parser := tabFlags.read(flags)
+	issues := parser.Lint(tab.Jobs, time.Now(), skipped)
+
+	if *jsonOutput {
+		if err := json.NewEncoder(os.Stdout).Encode(issues); err != nil {
+			logrus.Fatal(err)
+			return
+		}
+	} else {
+		for _, issue := range issues {
+			fmt.Println(issue)
+		}
+	}
+
+	if len(issues) > 0 {
+		os.Exit(1)
+	}
+}
+
+func isLintCheck(check string) bool {
+	for _, known := range crontab.LintChecks {
+		if check == known {
+			return true
+		}
+	}
+	return false
+}
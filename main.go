@@ -1,28 +1,151 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
 	"os/signal"
-	"sync"
+	"runtime/pprof"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/samgaw/cronic/cron"
 	"github.com/samgaw/cronic/crontab"
-	
+	"github.com/samgaw/cronic/notify"
+	"github.com/samgaw/cronic/scheduler"
+	"github.com/samgaw/cronic/secrets"
+	"github.com/samgaw/cronic/spot"
+
 	"github.com/sirupsen/logrus"
 )
 
-
 var Usage = func() {
-	fmt.Fprintf(os.Stderr, "Usage: %s [OPTIONS] CRONTAB\n\nAvailable options:\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Usage: %s [OPTIONS] CRONTAB\n       %s [OPTIONS] -config FILE\n       %s simulate [OPTIONS] CRONTAB\n       %s next [-n 10] CRONTAB\n       %s lint [OPTIONS] CRONTAB\n       %s export-ical [OPTIONS] CRONTAB\n       %s hub [OPTIONS] -instance [NAME=]URL...\n       %s ctl [OPTIONS] COMMAND [ARGS]\n\nAvailable options:\n", os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0])
 	flag.PrintDefaults()
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "hub" {
+		hubMain(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "ctl" {
+		ctlMain(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "simulate" {
+		simulateMain(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "next" {
+		nextMain(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "lint" {
+		lintMain(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "export-ical" {
+		exportICalMain(os.Args[2:])
+		return
+	}
+
+	scheduleSyntax := flag.String("schedule-syntax", crontab.SyntaxCron, "the syntax of schedules without a syntax prefix, e.g. @quartz (cron, quartz, systemd)")
+	configPath := flag.String("config", "", "read jobs from this YAML configuration file, instead of a crontab")
+	expand := flag.Bool("expand", false, "replace ${VAR} in schedules and commands with the value of VAR when parsing the crontab (or -config), quoted for the shell in commands")
+	literalPercent := flag.Bool("literal-percent", false, "leave % in crontab commands as-is, instead of feeding what follows the first one to the command's stdin (like cron)")
+	crontabFormat := flag.String("crontab-format", crontab.FormatAuto, "whether job lines have a user field before the command, like /etc/crontab (auto, user, system)")
+	strict := flag.Bool("strict", true, "refuse to start (or reload) if a crontab line is malformed; with -strict=false, malformed lines are logged and skipped")
+	watchTab := flag.Bool("watch", false, "reload the jobs of the crontab (or -config) when it changes, including when it's replaced (e.g. Kubernetes ConfigMaps)")
 	debug := flag.Bool("debug", false, "enable debug logging")
 	json := flag.Bool("json", false, "enable JSON logging")
+	passthrough := flag.Bool("passthrough", false, "write jobs' output as it is to cronic's stdout and stderr, instead of logging it")
+	passthroughPrefix := flag.Bool("passthrough-prefix", false, "with -passthrough, prefix the lines of jobs' output with the job's name (e.g. \"[backup] \")")
+	syslogEndpoint := flag.String("syslog", "", "also send jobs' output and what happens to their runs to syslog: local, or a server's URL (e.g. udp://logs:514, tcp://logs:514, unix:///dev/log)")
+	syslogFacility := flag.String("syslog-facility", "cron", "with -syslog, the facility of jobs' messages, unless the job sets syslog-facility")
+	syslogTag := flag.String("syslog-tag", "cronic", "with -syslog, the tag of jobs' messages, unless the job sets syslog-tag")
+	journald := flag.Bool("journald", false, "send jobs' output and what happens to their runs to the systemd journal, identified by the job's name, instead of logging them")
+	gelfAddr := flag.String("gelf-addr", "", "also send jobs' output and what happens to their runs to this Graylog GELF input (e.g. udp://graylog:12201, tcp://graylog:12201)")
+	lokiURL := flag.String("loki-url", "", "also push jobs' output and what happens to their runs to this Grafana Loki server (e.g. http://loki:3100), labelled by job")
+	eventSocket := flag.String("event-socket", "", "stream jobs' events and output as newline-delimited JSON to the clients of a Unix socket at this path (e.g. /run/cronic/events.sock)")
+	readBufferSize := flag.String("read-buffer-size", "64K", "read lines of jobs' output up to this long (e.g. 1M), and handle longer ones according to -long-lines")
+	longLines := flag.String("long-lines", cron.LongLineSplit, "log lines of jobs' output longer than -read-buffer-size in several chunks, truncate them, or drop them (split, truncate, drop)")
+	jsonOutput := flag.Bool("json-output", false, "log the fields of jobs' output lines that are JSON objects, rather than the lines")
+	listen := flag.String("listen", "", "serve the web dashboard on this address (e.g. :8080, or unix:/run/cronic.sock for a Unix socket)")
+	grpcListen := flag.String("grpc-listen", "", "serve the gRPC control API on this address (e.g. :9090, or unix:/run/cronic-grpc.sock), with the -api-token of the dashboard")
+	grpcTLSCert := flag.String("grpc-tls-cert", "", "with -grpc-listen, serve the gRPC API over TLS with this certificate (PEM file)")
+	grpcTLSKey := flag.String("grpc-tls-key", "", "with -grpc-listen, the private key of -grpc-tls-cert (PEM file)")
+	archiveDir := flag.String("archive-dir", "", "store the output of each run in this directory")
+	archiveCompression := flag.String("archive-compression", cron.CompressionNone, "compress archived output (none, gzip)")
+	archiveCompressMinSize := flag.Int64("archive-compress-min-size", 1024*1024, "only compress the archived output of runs that emitted at least this many bytes")
+	failureTail := flag.Int("failure-tail", 20, "include up to this many of the last lines of output when a job fails (max. 100)")
+	webhookURL := flag.String("webhook-url", "", "POST job events to this URL (jobs can override it using the webhook-url annotation)")
+	webhookEvents := flag.String("webhook-events", "start,success,failure,timeout,skip", "comma-separated list of events to send to the webhook")
+	webhookTemplate := flag.String("webhook-template", "", "render webhook payloads using the Go template in this file (instead of sending events as JSON)")
+	slackWebhook := flag.String("slack-webhook", os.Getenv("CRONIC_SLACK_WEBHOOK"), "post job failures to this Slack incoming webhook (defaults to $CRONIC_SLACK_WEBHOOK)")
+	slackTemplate := flag.String("slack-template", "", "render the text of Slack messages using the Go template in this file")
+	smtpAddr := flag.String("smtp-addr", os.Getenv("CRONIC_SMTP_ADDR"), "send mail to MAILTO through this SMTP server, e.g. smtp.example.com:587 (defaults to $CRONIC_SMTP_ADDR)")
+	smtpUser := flag.String("smtp-user", os.Getenv("CRONIC_SMTP_USER"), "authenticate to the SMTP server as this user (defaults to $CRONIC_SMTP_USER)")
+	smtpPassword := flag.String("smtp-password", os.Getenv("CRONIC_SMTP_PASSWORD"), "authenticate to the SMTP server with this password (defaults to $CRONIC_SMTP_PASSWORD)")
+	mailFrom := flag.String("mail-from", "", "send mail from this address (defaults to cronic@HOSTNAME)")
+	mailWhen := flag.String("mail-when", notify.MailWhenOutput, "send mail when a run emits output (like cron), on failure, or always (output, failure, always)")
+	statsdAddr := flag.String("statsd-addr", "", "send metrics about runs to this StatsD server (e.g. localhost:8125), with DogStatsD tags")
+	statsdPrefix := flag.String("statsd-prefix", "cronic", "prefix the names of StatsD metrics with this")
+	onSpawnFailure := flag.String("on-spawn-failure", crontab.SpawnFailureFail, "when a job's command can't be started, report a failure, retry with a backoff, or report a failure and pause the job (fail, retry, pause)")
+	onShutdown := flag.String("on-shutdown", cron.ShutdownWait, "when shutting down, wait for the runs in progress to finish (wait), send SIGTERM to their processes and wait for them (term), or kill them right away (kill)")
+	onMissingCommand := flag.String("on-missing-command", cron.MissingCommandIgnore, "at startup, look up the program each job's command starts in its PATH, and warn or exit if it doesn't exist (ignore, warn, fail)")
+	timeout := flag.Duration("timeout", 0, "stop runs that last longer than this (e.g. 6h), unless the job has a timeout annotation (0 for no limit)")
+	warnAfter := flag.Duration("warn-after", 0, "warn about runs that are still going after this long (e.g. 1h), and every as long after that, unless the job has a warn-after annotation (0 to disable)")
+	only := flag.String("only", "", "only run the crontab's jobs whose name or command matches one of these patterns (comma-separated): globs (e.g. backup-*), or regular expressions between slashes (e.g. /^backup-/)")
+	exclude := flag.String("exclude", "", "don't run the crontab's jobs whose name or command matches one of these patterns (comma-separated, like -only)")
+	shardFlag := flag.String("shard", "", "only run the crontab's jobs that belong to this shard, as I/N (e.g. 0/3) or host/N (picked from a hash of the hostname), to split a crontab between several instances")
+	holidays := flag.String("holidays", "", "skip the runs of jobs with a skip-holidays annotation on the days of this file: an iCalendar file, or a list of dates (one per line)")
+	blackout := flag.String("blackout", "", "don't run jobs during these weekly windows of local time, e.g. \"Sat 00:00-04:00,Mon-Fri 12:00-13:00\" (jobs skip their runs then, unless they have an on-blackout=defer annotation)")
+	maxConcurrentRuns := flag.Int("max-concurrent-runs", cron.MAX_CONCURRENT_RUNS, "run at most this many jobs at once, across all jobs (0 for no limit)")
+	logRateLimit := flag.Int("log-rate-limit", 0, "log at most this many lines of output per second from each job, without slowing it down (0 to disable)")
+	logBurst := flag.Int("log-burst", 0, "with -log-rate-limit, allow bursts of this many lines (defaults to -log-rate-limit)")
+	logSample := flag.Int("log-sample", 0, "log only one in this many lines of output from each job (0 to log them all)")
+	outputRateLimit := flag.Int("output-rate-limit", 0, "relay at most this many lines of output per second from each job, slowing down jobs that emit more (0 to disable)")
+	cgroupDir := flag.String("cgroup-dir", "", "apply the memory-limit and cpu-limit of jobs with cgroups created in this cgroup v2 directory, which must be delegated to cronic with the memory and cpu controllers enabled")
+	envAllow := flag.String("env-allow", "", "only let jobs inherit these of cronic's environment variables: a comma-separated list of names, or prefixes ending in * (e.g. PATH,HOME,APP_*)")
+	envDeny := flag.String("env-deny", "", "don't let jobs inherit these of cronic's environment variables (e.g. AWS_*,DATABASE_URL)")
+	containerExecutor := flag.String("container-executor", "docker", "run the jobs with an image annotation in Docker containers (docker), or as Kubernetes Jobs (kubernetes)")
+	kubernetesAPI := flag.String("kubernetes-api", "", "with -container-executor kubernetes, use the API server at this URL, without authentication (e.g. http://localhost:8001 for kubectl proxy), rather than that of the cluster cronic runs in")
+	kubernetesNamespace := flag.String("kubernetes-namespace", "", "with -container-executor kubernetes, create Jobs in this namespace, unless their template has one (defaults to cronic's)")
+	kubernetesTemplate := flag.String("kubernetes-template", "", "with -container-executor kubernetes, create Jobs from this manifest (YAML or JSON), unless the job has a k8s-template annotation")
+	sshKey := flag.String("ssh-key", "", "authenticate to the hosts of jobs with a host annotation with this private key, unless they have a key annotation (defaults to ssh's keys, and those of its agent)")
+	sshKnownHosts := flag.String("ssh-known-hosts", "", "check the keys of the hosts of jobs against this known_hosts file (defaults to ssh's)")
+	dockerHost := flag.String("docker-host", dockerDefaultHost(), "run the jobs with an image annotation in containers, with the Docker daemon at this address (defaults to $DOCKER_HOST, or unix:///var/run/docker.sock)")
+	vaultAddr := flag.String("vault-addr", os.Getenv("VAULT_ADDR"), "resolve the @vault: secrets of jobs' environment variables with this Vault server (defaults to $VAULT_ADDR), authenticating with $VAULT_TOKEN or -vault-token-file")
+	vaultTokenFile := flag.String("vault-token-file", "", "with -vault-addr, read the Vault token from this file each time (e.g. the sink of a Vault agent), rather than from $VAULT_TOKEN")
+	awsRegion := flag.String("aws-region", awsDefaultRegion(), "resolve the @aws-sm: secrets of jobs' environment variables with AWS Secrets Manager in this region (defaults to $AWS_REGION, or $AWS_DEFAULT_REGION)")
+	secretsCacheTTL := flag.Duration("secrets-cache-ttl", secrets.SECRETS_CACHE_TTL, "cache the secrets fetched from Vault and AWS Secrets Manager for this long, unless Vault leases them for a different time")
+	selfCheckInterval := flag.Duration("self-check-interval", 0, "check that cronic can still run jobs and send notifications this often (e.g. 5m), and alert if it can't (0 to disable)")
+	spotProvider := flag.String("spot-provider", "", "watch for spot instance interruption notices from this cloud (ec2, gcp), and stop starting runs once one arrives")
+	spotPollInterval := flag.Duration("spot-poll-interval", 5*time.Second, "check for spot instance interruption notices this often")
+	hotSpotThreshold := flag.Int("hot-spot-threshold", 10, "warn about minutes of the next day when at least this many jobs run at once (0 to disable)")
+	exitWhenDone := flag.Bool("exit-when-done", false, "exit once all the jobs that run a single time (@at, @once) are done, with a non-zero status if any of them failed")
+	failFast := flag.Bool("fail-fast", false, "exit with a non-zero status as soon as a run of any job fails (once it won't be retried), stopping the other jobs' runs")
+	stateFile := flag.String("state-file", "", "keep the last results of jobs in this JSON file, so they survive restarts (like -state-store file:///path)")
+	stateStore := flag.String("state-store", "", "record the result of each run in this store, so it survives restarts: file:///path, sqlite:///path, postgres://..., mysql://... (with the mysql build tag), or redis://host:port/db")
+	historyDB := flag.String("history-db", "", "record every run (and where its output is archived, with -archive-dir) in this SQLite database, serving them on the dashboard's API (like -state-store sqlite:///path)")
+	historyRetention := flag.Duration("history-retention", 0, "with -history-db (or an SQL -state-store), delete runs this long after they finish (0 to keep them all)")
+	historyExport := flag.String("history-export", "", "also record every run in this central database, which a fleet of cronic processes can report into: postgres://... or mysql://... (with the mysql build tag)")
+	stateInstance := flag.String("state-instance", "", "record runs in the state store (and -history-export) as this instance, so several cronic processes can share it (defaults to the hostname)")
+	lockDir := flag.String("lock-dir", cron.DEFAULT_LOCK_DIR, "keep the locks jobs share with other cronic processes (see the lock annotation) in this directory")
+	notifyConfigPath := flag.String("notify-config", "", "read notifier settings from this JSON file, overriding the flags (reloaded on SIGHUP)")
+	namespacesPath := flag.String("namespaces", "", "read the namespaces jobs can belong to from this JSON file")
+	managedCrontab := flag.String("managed-crontab", "", "allow creating, updating and deleting jobs via the API, and store them in this crontab (requires -api-token)")
+	apiToken := flag.String("api-token", os.Getenv("CRONIC_API_TOKEN"), "require this bearer token to control jobs via the web dashboard (defaults to $CRONIC_API_TOKEN)")
+	forwardSignals := flag.String("forward-signals", "", "forward these signals (e.g. USR1,USR2) to the processes of running jobs")
+	forwardSignalsTo := flag.String("forward-signals-to", "", "only forward -forward-signals to the jobs with these names (comma-separated)")
 	flag.Parse()
 
 	if *debug {
@@ -35,57 +158,369 @@ func main() {
 		logrus.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
 	}
 
-	if flag.NArg() != 1 {
-		Usage()
-		os.Exit(2)
+	bufferSize, err := crontab.ParseByteSize(*readBufferSize)
+	if err != nil || bufferSize < 16 || bufferSize > 1<<30 {
+		logrus.Fatalf("CRONIC: Bad -read-buffer-size: %q (expected a size from 16 bytes to 1G)", *readBufferSize)
+		return
+	}
+
+	var envAllowPatterns, envDenyPatterns []string
+	if *envAllow != "" {
+		envAllowPatterns, err = crontab.ParseEnvPatterns(*envAllow)
+		if err != nil {
+			logrus.Fatalf("CRONIC: Bad -env-allow: %v", err)
+			return
+		}
+	}
+	if *envDeny != "" {
+		envDenyPatterns, err = crontab.ParseEnvPatterns(*envDeny)
+		if err != nil {
+			logrus.Fatalf("CRONIC: Bad -env-deny: %v", err)
+			return
+		}
+	}
+
+	forwarded, err := parseForwardedSignals(*forwardSignals)
+	if err != nil {
+		logrus.Fatalf("CRONIC: Bad -forward-signals: %v", err)
 		return
 	}
 
-	crontabFileName := flag.Args()[0]
-	logrus.Infof("CRONIC: Read crontab %s", crontabFileName)
+	opts := scheduler.Options{
+		Parse: scheduler.ParseOptions{
+			Lenient:         !*strict,
+			Format:          *crontabFormat,
+			ScheduleSyntax:  *scheduleSyntax,
+			ExpandVariables: *expand,
+			EnvAllow:        envAllowPatterns,
+			EnvDeny:         envDenyPatterns,
+			LiteralPercent:  *literalPercent,
+		},
+		ManagedCrontab:         *managedCrontab,
+		APIToken:               *apiToken,
+		Only:                   *only,
+		Exclude:                *exclude,
+		Shard:                  *shardFlag,
+		Watch:                  *watchTab,
+		Timeout:                *timeout,
+		WarnAfter:              *warnAfter,
+		OnSpawnFailure:         *onSpawnFailure,
+		FailureTailLines:       *failureTail,
+		MaxConcurrentRuns:      *maxConcurrentRuns,
+		Holidays:               *holidays,
+		Blackout:               *blackout,
+		LockDir:                *lockDir,
+		CgroupDir:              *cgroupDir,
+		ContainerExecutor:      *containerExecutor,
+		DockerHost:             *dockerHost,
+		KubernetesAPI:          *kubernetesAPI,
+		KubernetesNamespace:    *kubernetesNamespace,
+		KubernetesTemplate:     *kubernetesTemplate,
+		SSHKey:                 *sshKey,
+		SSHKnownHosts:          *sshKnownHosts,
+		VaultAddr:              *vaultAddr,
+		VaultToken:             os.Getenv("VAULT_TOKEN"),
+		VaultTokenFile:         *vaultTokenFile,
+		AWSRegion:              *awsRegion,
+		SecretsCacheTTL:        *secretsCacheTTL,
+		LogRateLimit:           *logRateLimit,
+		LogBurst:               *logBurst,
+		LogSample:              *logSample,
+		OutputRateLimit:        *outputRateLimit,
+		ReadBufferSize:         int(bufferSize),
+		LongLines:              *longLines,
+		JSONOutput:             *jsonOutput,
+		Passthrough:            *passthrough,
+		PassthroughPrefix:      *passthroughPrefix,
+		Syslog:                 *syslogEndpoint,
+		SyslogFacility:         *syslogFacility,
+		SyslogTag:              *syslogTag,
+		Journald:               *journald,
+		GELFAddr:               *gelfAddr,
+		LokiURL:                *lokiURL,
+		EventSocket:            *eventSocket,
+		ArchiveDir:             *archiveDir,
+		ArchiveCompression:     *archiveCompression,
+		ArchiveCompressMinSize: *archiveCompressMinSize,
+		StateFile:              *stateFile,
+		StateStore:             *stateStore,
+		HistoryDB:              *historyDB,
+		HistoryRetention:       *historyRetention,
+		HistoryExport:          *historyExport,
+		StateInstance:          *stateInstance,
+		Notify: scheduler.NotifyOptions{
+			ConfigPath:      *notifyConfigPath,
+			WebhookURL:      *webhookURL,
+			WebhookEvents:   *webhookEvents,
+			WebhookTemplate: *webhookTemplate,
+			SlackWebhook:    *slackWebhook,
+			SlackTemplate:   *slackTemplate,
+			SMTPAddr:        *smtpAddr,
+			SMTPUser:        *smtpUser,
+			SMTPPassword:    *smtpPassword,
+			MailFrom:        *mailFrom,
+			MailWhen:        *mailWhen,
+		},
+		StatsDAddr:        *statsdAddr,
+		StatsDPrefix:      *statsdPrefix,
+		Namespaces:        *namespacesPath,
+		OnMissingCommand:  *onMissingCommand,
+		HotSpotThreshold:  *hotSpotThreshold,
+		SelfCheckInterval: *selfCheckInterval,
+		OnShutdown:        *onShutdown,
+		FailFast:          *failFast,
+	}
+
+	var sched *scheduler.Scheduler
+	if *configPath != "" {
+		if flag.NArg() != 0 {
+			Usage()
+			os.Exit(2)
+			return
+		}
 
-	tab, err := readCrontabAtPath(crontabFileName)
+		sched, err = scheduler.LoadConfig(*configPath, opts)
+	} else {
+		if flag.NArg() != 1 {
+			Usage()
+			os.Exit(2)
+			return
+		}
+
+		sched, err = scheduler.Load(flag.Args()[0], opts)
+	}
 
 	if err != nil {
 		logrus.Fatal(err)
 		return
 	}
 
-	var (
-		wg        sync.WaitGroup
-		exitChans []chan interface{}
-	)
+	// Before the jobs start, so that StreamRuns doesn't miss any run
+	if *grpcListen != "" {
+		if err := sched.ServeGRPC(*grpcListen, *grpcTLSCert, *grpcTLSKey); err != nil {
+			logrus.Fatal(err)
+			return
+		}
+	}
+
+	if err := sched.Start(); err != nil {
+		logrus.Fatal(err)
+		return
+	}
+
+	// e.g. as an init container, whose work is done once its jobs are
+	oneShotsDone := make(chan []*scheduler.JobStatus, 1)
+	if *exitWhenDone {
+		go func() {
+			oneShotsDone <- sched.WaitOneShots()
+		}()
+	}
+
+	if *listen != "" {
+		if err := sched.ServeDashboard(*listen); err != nil {
+			logrus.Fatal(err)
+			return
+		}
+	}
+
+	if *spotProvider != "" {
+		provider, err := spot.NewProvider(*spotProvider)
+		if err != nil {
+			logrus.Fatal(err)
+			return
+		}
 
-	for _, job := range tab.Jobs {
-		exitChan := make(chan interface{}, 1)
-		exitChans = append(exitChans, exitChan)
+		logrus.Infof("CRONIC: Watching for %s spot instance interruptions", *spotProvider)
 
-		cronLogger := logrus.WithFields(logrus.Fields{
-			"job.schedule": job.Schedule,
-			"job.command":  job.Command,
-			"job.position": job.Position,
+		spotCtx, stopSpot := context.WithCancel(context.Background())
+		defer stopSpot()
+
+		go spot.Watch(spotCtx, provider, *spotPollInterval, logrus.WithField("component", "spot"), func(notice string) {
+			logrus.Warnf("CRONIC: Spot instance interruption (%s), draining jobs", notice)
+			sched.Drain()
 		})
+	}
+
+	// SIGTSTP and SIGCONT let you pause and resume all jobs, e.g. while
+	// performing maintenance (individual jobs can be paused via the API,
+	// and stay paused). SIGCONT is also sent to processes that weren't
+	// paused (e.g. by systemd along with SIGTERM), so it's only reported if
+	// jobs were.
+	pauseChan := make(chan os.Signal, 1)
+	signal.Notify(pauseChan, syscall.SIGTSTP, syscall.SIGCONT)
+
+	go func() {
+		for sig := range pauseChan {
+			if sig == syscall.SIGTSTP {
+				logrus.Infof("CRONIC: Received %s, pausing all jobs", sig)
+				sched.Pause()
+			} else if sched.Paused() {
+				logrus.Infof("CRONIC: Received %s, resuming all jobs", sig)
+				sched.Resume()
+			}
+		}
+	}()
+
+	if len(forwarded) > 0 {
+		var names []string
+		if *forwardSignalsTo != "" {
+			names = strings.Split(*forwardSignalsTo, ",")
+		}
+
+		forwardChan := make(chan os.Signal, 1)
+		for _, sig := range forwarded {
+			signal.Notify(forwardChan, sig)
+		}
 
-		cron.StartJob(&wg, tab.Context, job, exitChan, cronLogger)
+		go func() {
+			for sig := range forwardChan {
+				count := sched.Signal(sig.(syscall.Signal), names)
+				logrus.Infof("CRONIC: Received %s, forwarded it to %d running jobs", sig, count)
+			}
+		}()
 	}
 
+	// SIGQUIT (and SIGUSR1, unless it's forwarded to jobs) writes a report
+	// of the jobs' status to stderr, along with cronic's goroutines with
+	// -debug, instead of exiting.
+	reportChan := make(chan os.Signal, 1)
+	signal.Notify(reportChan, syscall.SIGQUIT)
+	if !containsSignal(forwarded, syscall.SIGUSR1) {
+		signal.Notify(reportChan, syscall.SIGUSR1)
+	}
+
+	go func() {
+		for sig := range reportChan {
+			logrus.Infof("CRONIC: Received %s, writing a status report", sig)
+			sched.WriteReport(os.Stderr)
+			if *debug {
+				pprof.Lookup("goroutine").WriteTo(os.Stderr, 2)
+			}
+		}
+	}()
+
+	// SIGHUP reloads the notifiers (and their templates), keeping the
+	// current ones if the new configuration is invalid.
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+
+	go func() {
+		for sig := range hupChan {
+			logrus.Infof("CRONIC: Received %s, reloading notifiers", sig)
+			if err := sched.ReloadNotifiers(); err != nil {
+				logrus.Errorf("CRONIC: Failed to reload notifiers, keeping the current ones: %v", err)
+			}
+		}
+	}()
+
 	termChan := make(chan os.Signal, 1)
 	signal.Notify(termChan, syscall.SIGINT, syscall.SIGTERM)
 
-	termSig := <-termChan
+	failed := false
 
-	logrus.Infof("CRONIC: Received %s, shutting down", termSig)
-	for _, c := range exitChans {
-		c <- true
+	select {
+	case termSig := <-termChan:
+		logrus.Infof("CRONIC: Received %s, shutting down", termSig)
+	case <-sched.Failed():
+		// The failure is logged, and the runs in progress stopped
+		failed = true
+	case oneShots := <-oneShotsDone:
+		if len(oneShots) == 0 {
+			logrus.Fatal("CRONIC: Bad -exit-when-done: no job runs a single time (using @at or @once)")
+			return
+		}
+
+		for _, status := range oneShots {
+			if result := status.LastResult(); result == nil || !result.Success {
+				failed = true
+			}
+		}
+
+		logrus.Info("CRONIC: All jobs that run a single time are done, shutting down")
 	}
 
-	logrus.Info("CRONIC: Waiting for jobs to finish")
-	wg.Wait()
+	// A second signal stops the runs in progress (along with the processes
+	// they started), rather than waiting for them
+	go func() {
+		termSig := <-termChan
+		logrus.Warnf("CRONIC: Received %s again, stopping running jobs", termSig)
+		sched.StopRuns()
+	}()
+
+	sched.Stop()
 
 	logrus.Info("CRONIC: Exiting")
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// parseForwardedSignals parses the -forward-signals list. The signals cronic
+// handles itself can't be forwarded.
+func parseForwardedSignals(list string) ([]syscall.Signal, error) {
+	var signals []syscall.Signal
+
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		sig, err := crontab.ParseSignal(name)
+		if err != nil {
+			return nil, err
+		}
+
+		switch sig {
+		case syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGTSTP, syscall.SIGCONT, syscall.SIGCHLD, syscall.SIGQUIT:
+			return nil, fmt.Errorf("%v is handled by cronic itself", sig)
+		}
+
+		signals = append(signals, sig)
+	}
+
+	return signals, nil
+}
+
+func containsSignal(signals []syscall.Signal, sig syscall.Signal) bool {
+	for _, s := range signals {
+		if s == sig {
+			return true
+		}
+	}
+	return false
+}
+
+// dockerDefaultHost returns the Docker daemon of the Docker CLI's
+// environment.
+func dockerDefaultHost() string {
+	if host := os.Getenv("DOCKER_HOST"); host != "" {
+		return host
+	}
+	return cron.DOCKER_HOST
+}
+
+// awsDefaultRegion returns the region of the AWS CLI and SDKs' environment.
+func awsDefaultRegion() string {
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		return region
+	}
+	return os.Getenv("AWS_DEFAULT_REGION")
+}
+
+func readCrontabAtPath(parser *crontab.Parser, path string) (*crontab.Crontab, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	return parser.ParseCrontab(file, path)
 }
 
-func readCrontabAtPath(path string) (*crontab.Crontab, error) {
+func readConfigAtPath(parser *crontab.Parser, path string) (*crontab.Crontab, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
@@ -93,5 +528,5 @@ func readCrontabAtPath(path string) (*crontab.Crontab, error) {
 
 	defer file.Close()
 
-	return crontab.ParseCrontab(file)
+	return parser.ParseConfig(file)
 }
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/samgaw/cronic/cronictest"
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/sirupsen/logrus"
+)
+
+// nextMain runs "cronic next", which prints the next runs cronic would start,
+// across all jobs, without running anything.
+func nextMain(args []string) {
+	flags := flag.NewFlagSet("next", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s next [OPTIONS] CRONTAB\n       %s next [OPTIONS] -config FILE\n\nAvailable options:\n", os.Args[0], os.Args[0])
+		flags.PrintDefaults()
+	}
+
+	n := flags.Int("n", 10, "print this many runs")
+	from := flags.String("from", "", "print the runs after this date, e.g. 2018-04-07 or 2018-04-07T09:30 (defaults to now)")
+	tabFlags := addCrontabFlags(flags)
+	flags.Parse(args)
+
+	var err error
+
+	if *n <= 0 {
+		logrus.Fatalf("CRONIC: Bad -n: %d isn't positive", *n)
+		return
+	}
+
+	start := time.Now()
+	if *from != "" {
+		start, err = crontab.ParseDate(*from)
+		if err != nil {
+			logrus.Fatalf("CRONIC: Bad -from: %v", err)
+			return
+		}
+	}
+
+	tab, _ := tabFlags.read(flags)
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	for _, run := range cronictest.New(tab, start).Next(*n) {
+		fmt.Fprintf(out, "%s\tin %s\t%s\t%s\n", run.At.Format(time.RFC3339), run.At.Sub(start).Round(time.Second), simulatedJobName(run.Job), run.Command)
+	}
+	out.Flush()
+}
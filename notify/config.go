@@ -0,0 +1,76 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Config holds the settings of the notifiers. They are usually set using
+// flags, but can also be read from a file (see -notify-config), which is
+// reloaded on SIGHUP so that e.g. a webhook can be rotated without restarting
+// cronic.
+type Config struct {
+	WebhookURL      string `json:"webhook_url"`
+	WebhookEvents   string `json:"webhook_events"`
+	WebhookTemplate string `json:"webhook_template"`
+
+	SlackWebhook  string `json:"slack_webhook"`
+	SlackTemplate string `json:"slack_template"`
+
+	SMTPAddr     string `json:"smtp_addr"`
+	SMTPUser     string `json:"smtp_user"`
+	SMTPPassword string `json:"smtp_password"`
+	MailFrom     string `json:"mail_from"`
+	MailWhen     string `json:"mail_when"`
+
+	// Attached to all events (and so metrics), unless the job's namespace
+	// has a label of the same name
+	Labels map[string]string `json:"labels"`
+}
+
+// ParseConfig reads a Config from a JSON object.
+func ParseConfig(reader io.Reader) (*Config, error) {
+	config := &Config{}
+
+	decoder := json.NewDecoder(reader)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(config); err != nil {
+		return nil, fmt.Errorf("CRONIC: Bad notifier configuration: %v", err)
+	}
+
+	return config, nil
+}
+
+// Merge returns a copy of the config, where settings that aren't set are
+// taken from defaults.
+func (c *Config) Merge(defaults *Config) *Config {
+	merged := *c
+
+	for _, setting := range []struct {
+		value    *string
+		fallback string
+	}{
+		{&merged.WebhookURL, defaults.WebhookURL},
+		{&merged.WebhookEvents, defaults.WebhookEvents},
+		{&merged.WebhookTemplate, defaults.WebhookTemplate},
+		{&merged.SlackWebhook, defaults.SlackWebhook},
+		{&merged.SlackTemplate, defaults.SlackTemplate},
+		{&merged.SMTPAddr, defaults.SMTPAddr},
+		{&merged.SMTPUser, defaults.SMTPUser},
+		{&merged.SMTPPassword, defaults.SMTPPassword},
+		{&merged.MailFrom, defaults.MailFrom},
+		{&merged.MailWhen, defaults.MailWhen},
+	} {
+		if *setting.value == "" {
+			*setting.value = setting.fallback
+		}
+	}
+
+	if merged.Labels == nil {
+		merged.Labels = defaults.Labels
+	}
+
+	return &merged
+}
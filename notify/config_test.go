@@ -0,0 +1,44 @@
+package notify
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseConfig(t *testing.T) {
+	config, err := ParseConfig(strings.NewReader(`{"slack_webhook": "https://hooks.slack.com/new", "labels": {"env": "prod"}}`))
+	if assert.Nil(t, err) {
+		assert.Equal(t, &Config{SlackWebhook: "https://hooks.slack.com/new", Labels: map[string]string{"env": "prod"}}, config)
+	}
+
+	_, err = ParseConfig(strings.NewReader(`{"slack_hook": "https://hooks.slack.com/new"}`))
+	assert.NotNil(t, err)
+
+	_, err = ParseConfig(strings.NewReader(`{"slack_webhook": 1}`))
+	assert.NotNil(t, err)
+}
+
+func TestConfigMerge(t *testing.T) {
+	defaults := &Config{
+		WebhookURL:    "http://default/hook",
+		WebhookEvents: "failure",
+		SlackWebhook:  "https://hooks.slack.com/old",
+		MailWhen:      MailWhenOutput,
+		Labels:        map[string]string{"env": "dev"},
+	}
+
+	config := &Config{SlackWebhook: "https://hooks.slack.com/new", MailWhen: MailWhenFailure}
+
+	assert.Equal(t, &Config{
+		WebhookURL:    "http://default/hook",
+		WebhookEvents: "failure",
+		SlackWebhook:  "https://hooks.slack.com/new",
+		MailWhen:      MailWhenFailure,
+		Labels:        map[string]string{"env": "dev"},
+	}, config.Merge(defaults))
+
+	// The config itself is left alone
+	assert.Equal(t, "", config.WebhookURL)
+}
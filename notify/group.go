@@ -0,0 +1,97 @@
+package notify
+
+import (
+	"sync"
+
+	"github.com/samgaw/cronic/cron"
+)
+
+// Closer is a notifier that sends notifications in the background, and must
+// be closed to deliver those that are pending.
+type Closer interface {
+	cron.Notifier
+	Close()
+}
+
+// Group notifies a set of notifiers, which can be replaced while jobs are
+// running (e.g. when the configuration is reloaded).
+type Group struct {
+	mu        sync.RWMutex
+	notifiers []cron.Notifier
+	labels    map[string]string
+}
+
+func NewGroup() *Group {
+	return &Group{}
+}
+
+func (g *Group) Notify(event *cron.Event) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	if len(g.labels) > 0 {
+		event = withLabels(event, g.labels)
+	}
+
+	for _, notifier := range g.notifiers {
+		notifier.Notify(event)
+	}
+}
+
+// Replace switches to new notifiers and labels, then closes the previous
+// notifiers that aren't part of the new ones.
+func (g *Group) Replace(notifiers []cron.Notifier, labels map[string]string) {
+	g.mu.Lock()
+	previous := g.notifiers
+	g.notifiers = notifiers
+	g.labels = labels
+	g.mu.Unlock()
+
+	closeNotifiers(previous, notifiers)
+}
+
+// Healthy checks the notifiers that can be checked (see cron.HealthChecker).
+func (g *Group) Healthy() error {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return cron.CheckNotifiers(g.notifiers)
+}
+
+// Close closes all notifiers, delivering pending notifications.
+func (g *Group) Close() {
+	g.Replace(nil, nil)
+}
+
+func closeNotifiers(notifiers []cron.Notifier, keep []cron.Notifier) {
+	for _, notifier := range notifiers {
+		if closer, ok := notifier.(Closer); ok && !containsNotifier(keep, notifier) {
+			closer.Close()
+		}
+	}
+}
+
+func containsNotifier(notifiers []cron.Notifier, notifier cron.Notifier) bool {
+	for _, n := range notifiers {
+		if n == notifier {
+			return true
+		}
+	}
+	return false
+}
+
+// withLabels returns a copy of the event with extra labels (the namespace's
+// labels take precedence).
+func withLabels(event *cron.Event, labels map[string]string) *cron.Event {
+	merged := make(map[string]string, len(labels)+len(event.Labels))
+	for key, value := range labels {
+		merged[key] = value
+	}
+	for key, value := range event.Labels {
+		merged[key] = value
+	}
+
+	copied := *event
+	copied.Labels = merged
+	return &copied
+}
@@ -0,0 +1,90 @@
+package notify
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/samgaw/cronic/cron"
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingNotifier struct {
+	mu     sync.Mutex
+	events []*cron.Event
+	closed bool
+}
+
+func (n *recordingNotifier) Notify(event *cron.Event) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.events = append(n.events, event)
+}
+
+func (n *recordingNotifier) Close() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.closed = true
+}
+
+func TestGroupReplacesNotifiers(t *testing.T) {
+	static, old, replacement := &recordingNotifier{}, &recordingNotifier{}, &recordingNotifier{}
+
+	group := NewGroup()
+	group.Replace([]cron.Notifier{static, old}, nil)
+	group.Notify(testEvent(crontab.EventFailure, testJob()))
+
+	group.Replace([]cron.Notifier{static, replacement}, nil)
+	group.Notify(testEvent(crontab.EventFailure, testJob()))
+
+	assert.Len(t, static.events, 2)
+	assert.Len(t, old.events, 1)
+	assert.Len(t, replacement.events, 1)
+
+	// Only notifiers that were replaced are closed
+	assert.True(t, old.closed)
+	assert.False(t, static.closed)
+	assert.False(t, replacement.closed)
+
+	group.Close()
+	assert.True(t, static.closed)
+	assert.True(t, replacement.closed)
+}
+
+func TestGroupAddsLabels(t *testing.T) {
+	notifier := &recordingNotifier{}
+
+	group := NewGroup()
+	group.Replace([]cron.Notifier{notifier}, map[string]string{"env": "prod", "team": "ops"})
+
+	event := testEvent(crontab.EventFailure, testJob())
+	event.Labels = map[string]string{"team": "data"}
+	group.Notify(event)
+
+	if assert.Len(t, notifier.events, 1) {
+		assert.Equal(t, map[string]string{"env": "prod", "team": "data"}, notifier.events[0].Labels)
+	}
+
+	// The original event is left alone, since other notifiers may use it
+	assert.Equal(t, map[string]string{"team": "data"}, event.Labels)
+}
+
+type unhealthyNotifier struct {
+	recordingNotifier
+}
+
+func (n *unhealthyNotifier) Healthy() error {
+	return errors.New("broken")
+}
+
+func TestGroupChecksNotifiers(t *testing.T) {
+	group := NewGroup()
+	assert.Nil(t, group.Healthy())
+
+	group.Replace([]cron.Notifier{&recordingNotifier{}, &unhealthyNotifier{}, &unhealthyNotifier{}}, nil)
+	if err := group.Healthy(); assert.NotNil(t, err) {
+		assert.Equal(t, "broken; broken", err.Error())
+	}
+}
@@ -0,0 +1,153 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/samgaw/cronic/cron"
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/sirupsen/logrus"
+)
+
+// When to send mail (see MailOptions.When)
+const (
+	MailWhenOutput  = "output"
+	MailWhenFailure = "failure"
+	MailWhenAlways  = "always"
+)
+
+// MailOptions configures how mail is sent.
+type MailOptions struct {
+	// The SMTP server (host:port), and the credentials to use, if any
+	Addr     string
+	Username string
+	Password string
+
+	From string
+	To   []string
+
+	// MailWhenOutput (like cron: whenever a run emits output),
+	// MailWhenFailure, or MailWhenAlways
+	When string
+
+	// Used in subjects, like cron does
+	Hostname string
+}
+
+// Mail emails the output of runs, like cron does for MAILTO.
+type Mail struct {
+	*sender
+
+	opts MailOptions
+
+	// Overridden in tests
+	sendMail func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// ParseMailTo parses the value of MAILTO, which is a list of addresses
+// separated by commas.
+func ParseMailTo(value string) []string {
+	addresses := make([]string, 0)
+	for _, address := range strings.Split(value, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
+}
+
+func NewMail(opts MailOptions, logger *logrus.Entry) (*Mail, error) {
+	switch opts.When {
+	case MailWhenOutput, MailWhenFailure, MailWhenAlways:
+	default:
+		return nil, fmt.Errorf("CRONIC: Bad mail setting: %q (expected %s, %s, or %s)", opts.When, MailWhenOutput, MailWhenFailure, MailWhenAlways)
+	}
+
+	m := &Mail{opts: opts, sendMail: smtp.SendMail}
+	m.sender = newSender(m.send, logger)
+	return m, nil
+}
+
+func (m *Mail) Notify(event *cron.Event) {
+	// Runs that will be retried are reported by the last retry
+	if event.Result == nil || event.Result.WillRetry {
+		return
+	}
+
+	switch m.opts.When {
+	case MailWhenOutput:
+		if event.Result.OutputLines == 0 {
+			return
+		}
+	case MailWhenFailure:
+		if event.Result.Success {
+			return
+		}
+	}
+
+	m.enqueue("", event)
+}
+
+func (m *Mail) send(_ string, event *cron.Event) error {
+	var auth smtp.Auth
+	if m.opts.Username != "" {
+		host := m.opts.Addr
+		if i := strings.LastIndex(host, ":"); i != -1 {
+			host = host[:i]
+		}
+		auth = smtp.PlainAuth("", m.opts.Username, m.opts.Password, host)
+	}
+
+	return m.sendMail(m.opts.Addr, auth, m.opts.From, m.opts.To, m.message(event))
+}
+
+func (m *Mail) message(event *cron.Event) []byte {
+	var buf bytes.Buffer
+
+	subject := fmt.Sprintf("Cron <%s> %s", m.opts.Hostname, event.Command)
+	switch event.Type {
+	case crontab.EventFailure:
+		subject += " (failed)"
+	case crontab.EventTimeout:
+		subject += " (timed out)"
+	}
+
+	header := func(key string, value string) {
+		// Headers can't span lines
+		value = strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+		fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+	}
+
+	header("From", m.opts.From)
+	header("To", strings.Join(m.opts.To, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header("Date", event.Time.Format(time.RFC1123Z))
+	header("Auto-Submitted", "auto-generated")
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("X-Cronic-Run-ID", event.RunID)
+	buf.WriteString("\r\n")
+
+	result := event.Result
+
+	if omitted := result.OutputLines - len(event.Output); omitted > 0 {
+		fmt.Fprintf(&buf, "[%d earlier lines omitted]\r\n", omitted)
+	}
+
+	// Lines starting with "." are escaped by smtp.SendMail
+	for _, line := range event.Output {
+		buf.WriteString(line.Line)
+		buf.WriteString("\r\n")
+	}
+
+	if !result.Success {
+		fmt.Fprintf(&buf, "\r\n%s\r\n", result.Error)
+	}
+
+	return buf.Bytes()
+}
@@ -0,0 +1,134 @@
+package notify
+
+import (
+	"fmt"
+	"net/smtp"
+	"strings"
+	"testing"
+
+	"github.com/samgaw/cronic/cron"
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type sentMail struct {
+	addr string
+	auth smtp.Auth
+	from string
+	to   []string
+	msg  string
+}
+
+func newTestMail(t *testing.T, when string, username string) (*Mail, chan sentMail) {
+	mail, err := NewMail(MailOptions{
+		Addr:     "smtp.example.com:587",
+		Username: username,
+		Password: "secret",
+		From:     "cronic@example.com",
+		To:       []string{"ops@example.com", "dev@example.com"},
+		When:     when,
+		Hostname: "worker-1",
+	}, discardLogger())
+
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	sent := make(chan sentMail, 10)
+	mail.sendMail = func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+		sent <- sentMail{addr, auth, from, to, string(msg)}
+		return nil
+	}
+
+	return mail, sent
+}
+
+func resultEvent(success bool, output ...string) *cron.Event {
+	eventType := crontab.EventSuccess
+	if !success {
+		eventType = crontab.EventFailure
+	}
+
+	event := testEvent(eventType, testJob())
+	event.RunID = "20180407T194044Z-0-2"
+	event.Result = &cron.RunResult{Success: success, OutputLines: len(output)}
+	if !success {
+		event.Result.Error = "CRONIC: Error running command: exit status 1"
+	}
+
+	for _, line := range output {
+		event.Output = append(event.Output, cron.OutputLine{Channel: "stdout", Line: line})
+	}
+
+	return event
+}
+
+var mailWhenTestCases = []struct {
+	when     string
+	success  bool
+	output   []string
+	expected bool
+}{
+	{MailWhenOutput, true, nil, false},
+	{MailWhenOutput, true, []string{"done"}, true},
+	{MailWhenOutput, false, nil, false},
+	{MailWhenFailure, true, []string{"done"}, false},
+	{MailWhenFailure, false, nil, true},
+	{MailWhenAlways, true, nil, true},
+}
+
+func TestMailFollowsMailWhen(t *testing.T) {
+	for _, tt := range mailWhenTestCases {
+		label := fmt.Sprintf("%s, success=%v, output=%v", tt.when, tt.success, tt.output)
+
+		mail, sent := newTestMail(t, tt.when, "")
+		mail.Notify(testEvent(crontab.EventStart, testJob()))
+		mail.Notify(resultEvent(tt.success, tt.output...))
+		mail.Close()
+
+		assert.Equal(t, tt.expected, len(sent) == 1, label)
+	}
+}
+
+func TestMailSkipsRunsThatWillBeRetried(t *testing.T) {
+	mail, sent := newTestMail(t, MailWhenAlways, "")
+
+	retried := resultEvent(false, "oops")
+	retried.Result.WillRetry = true
+
+	mail.Notify(retried)
+	mail.Close()
+
+	assert.Equal(t, 0, len(sent))
+}
+
+func TestMailMessage(t *testing.T) {
+	mail, sent := newTestMail(t, MailWhenAlways, "cronic")
+
+	event := resultEvent(false, "dumping database", "pg_dump: connection refused")
+	event.Result.OutputLines = 5
+
+	mail.Notify(event)
+	mail.Close()
+
+	message := <-sent
+	assert.Equal(t, "smtp.example.com:587", message.addr)
+	assert.NotNil(t, message.auth)
+	assert.Equal(t, "cronic@example.com", message.from)
+	assert.Equal(t, []string{"ops@example.com", "dev@example.com"}, message.to)
+
+	assert.Contains(t, message.msg, "To: ops@example.com, dev@example.com\r\n")
+	assert.Contains(t, message.msg, "Subject: Cron <worker-1> backup (failed)\r\n")
+	assert.True(t, strings.HasSuffix(message.msg, "\r\n\r\n[3 earlier lines omitted]\r\ndumping database\r\npg_dump: connection refused\r\n\r\nCRONIC: Error running command: exit status 1\r\n"))
+}
+
+func TestNewMailRejectsBadWhen(t *testing.T) {
+	_, err := NewMail(MailOptions{When: "sometimes"}, discardLogger())
+	assert.NotNil(t, err)
+}
+
+func TestParseMailTo(t *testing.T) {
+	assert.Equal(t, []string{"a@example.com", "b@example.com"}, ParseMailTo(" a@example.com, b@example.com,"))
+	assert.Equal(t, []string{}, ParseMailTo(""))
+}
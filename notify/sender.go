@@ -0,0 +1,129 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/samgaw/cronic/cron"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	NOTIFICATION_QUEUE_SIZE = 100
+	NOTIFICATION_TIMEOUT    = 10 * time.Second
+)
+
+// sender sends notifications in the background, in order, so that slow
+// receivers never delay jobs.
+type sender struct {
+	send   func(target string, event *cron.Event) error
+	logger *logrus.Entry
+
+	mu      sync.Mutex
+	closed  bool
+	queue   chan delivery
+	done    chan struct{}
+	dropped int
+	lastErr error
+}
+
+// A delivery is an event to send to a target (e.g. a URL).
+type delivery struct {
+	target string
+	event  *cron.Event
+}
+
+func newSender(send func(target string, event *cron.Event) error, logger *logrus.Entry) *sender {
+	s := &sender{
+		send:   send,
+		logger: logger,
+		queue:  make(chan delivery, NOTIFICATION_QUEUE_SIZE),
+		done:   make(chan struct{}),
+	}
+
+	go s.deliver()
+
+	return s
+}
+
+func (s *sender) enqueue(target string, event *cron.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	select {
+	case s.queue <- delivery{target, event}:
+	default:
+		s.dropped++
+		s.logger.Warnf("CRONIC: Notification queue is full, dropping %s event", event.Type)
+	}
+}
+
+// Healthy reports whether notifications were dropped, or failed to be
+// delivered, since it was last called (see cron.HealthChecker).
+func (s *sender) Healthy() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dropped, lastErr := s.dropped, s.lastErr
+	s.dropped, s.lastErr = 0, nil
+
+	if dropped > 0 {
+		return fmt.Errorf("dropped %d notifications (the queue is full)", dropped)
+	}
+	if lastErr != nil {
+		return fmt.Errorf("failed to send notification: %v", lastErr)
+	}
+	return nil
+}
+
+// Close delivers the notifications that are already queued, and stops the
+// sender.
+func (s *sender) Close() {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mu.Unlock()
+
+	<-s.done
+}
+
+func (s *sender) deliver() {
+	defer close(s.done)
+
+	for d := range s.queue {
+		if err := s.send(d.target, d.event); err != nil {
+			s.logger.WithField("event", d.event.Type).Errorf("CRONIC: Failed to send notification: %v", err)
+
+			s.mu.Lock()
+			s.lastErr = err
+			s.mu.Unlock()
+		}
+	}
+}
+
+// postJSON POSTs a JSON payload, and checks that it was accepted.
+func postJSON(url string, payload []byte) error {
+	client := &http.Client{Timeout: NOTIFICATION_TIMEOUT}
+
+	response, err := client.Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status: %s", response.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/samgaw/cronic/cron"
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/sirupsen/logrus"
+)
+
+// The text of Slack messages, unless overridden
+const defaultSlackTemplate = `:rotating_light: Job {{ if eq .Type "timeout" }}timed out{{ else }}failed{{ end }}: ` + "`{{ slack .Command }}`"
+
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// Slack posts failures (and timeouts) to a Slack incoming webhook, with the
+// details needed to triage them. Jobs can be posted to a different channel
+// using the "slack-channel" annotation.
+type Slack struct {
+	*sender
+
+	url      string
+	template *template.Template
+}
+
+type slackMessage struct {
+	Channel     string            `json:"channel,omitempty"`
+	Text        string            `json:"text"`
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+type slackAttachment struct {
+	Fallback string       `json:"fallback"`
+	Color    string       `json:"color"`
+	Fields   []slackField `json:"fields"`
+	Text     string       `json:"text,omitempty"`
+	MrkdwnIn []string     `json:"mrkdwn_in"`
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+// NewSlack creates a Slack notifier posting to the incoming webhook at url.
+// If tmpl is nil, a default template is used for the text of messages.
+func NewSlack(url string, tmpl *template.Template, logger *logrus.Entry) *Slack {
+	if tmpl == nil {
+		tmpl = template.Must(ParseTemplate(defaultSlackTemplate))
+	}
+
+	s := &Slack{url: url, template: tmpl}
+	s.sender = newSender(s.send, logger)
+	return s
+}
+
+func (s *Slack) Notify(event *cron.Event) {
+	// Failures that will be retried are only reported if the last retry
+	// fails too
+	if event.Result != nil && event.Result.WillRetry {
+		return
+	}
+
+	if event.Type == crontab.EventFailure || event.Type == crontab.EventTimeout {
+		s.enqueue(s.url, event)
+	}
+}
+
+func (s *Slack) send(url string, event *cron.Event) error {
+	payload, err := s.payload(event)
+	if err != nil {
+		return err
+	}
+	return postJSON(url, payload)
+}
+
+func (s *Slack) payload(event *cron.Event) ([]byte, error) {
+	var text bytes.Buffer
+	if err := s.template.Execute(&text, event); err != nil {
+		return nil, err
+	}
+
+	var fields []slackField
+	if event.Name != "" {
+		fields = append(fields, slackField{Title: "Job", Value: slackEscape(event.Name), Short: true})
+	}
+
+	fields = append(fields,
+		slackField{Title: "Command", Value: "`" + slackEscape(event.Command) + "`"},
+		slackField{Title: "Schedule", Value: slackEscape(event.Schedule), Short: true},
+	)
+
+	if event.Namespace != "" {
+		fields = append(fields, slackField{Title: "Namespace", Value: slackEscape(event.Namespace), Short: true})
+	}
+
+	attachment := slackAttachment{
+		Fallback: text.String(),
+		Color:    "danger",
+		MrkdwnIn: []string{"text", "fields"},
+	}
+
+	if result := event.Result; result != nil {
+		duration := time.Duration(event.DurationSeconds * float64(time.Second))
+		fields = append(fields, slackField{Title: "Duration", Value: duration.Round(time.Millisecond).String(), Short: true})
+
+		if result.ExitCode != nil {
+			fields = append(fields, slackField{Title: "Exit code", Value: fmt.Sprintf("%d", *result.ExitCode), Short: true})
+		}
+
+		fields = append(fields, slackField{Title: "Run ID", Value: result.RunID, Short: true})
+
+		if result.PausedUntil != nil {
+			fields = append(fields, slackField{Title: "Paused until", Value: result.PausedUntil.Format(time.RFC3339), Short: true})
+		} else if result.Paused {
+			fields = append(fields, slackField{Title: "Paused", Value: "until resumed", Short: true})
+		}
+
+		if len(result.OutputTail) > 0 {
+			attachment.Text = "```" + slackEscape(cron.FormatOutput(result.OutputTail)) + "```"
+		}
+	}
+
+	attachment.Fields = fields
+
+	return json.Marshal(slackMessage{
+		Channel:     event.Job.SlackChannel,
+		Text:        text.String(),
+		Attachments: []slackAttachment{attachment},
+	})
+}
+
+// slackEscape escapes the characters Slack uses for links and mentions.
+func slackEscape(text string) string {
+	return slackEscaper.Replace(text)
+}
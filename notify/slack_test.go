@@ -0,0 +1,132 @@
+package notify
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/samgaw/cronic/cron"
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func failureEvent(job *crontab.Job) *cron.Event {
+	exitCode := 3
+	started := time.Date(2018, 4, 7, 19, 40, 44, 0, time.UTC)
+
+	event := testEvent(crontab.EventFailure, job)
+	event.RunID = "20180407T194044Z-0-2"
+	event.DurationSeconds = 1.5
+	event.Result = &cron.RunResult{
+		RunID:      event.RunID,
+		StartedAt:  started,
+		FinishedAt: started.Add(1500 * time.Millisecond),
+		ExitCode:   &exitCode,
+		OutputTail: []cron.OutputLine{{Channel: "stderr", Line: "pg_dump: <connection refused>"}},
+	}
+	return event
+}
+
+func TestSlackPostsFailures(t *testing.T) {
+	server, bodies := newReceiver()
+	defer server.Close()
+
+	slack := NewSlack(server.URL, nil, discardLogger())
+
+	job := testJob()
+	job.SlackChannel = "#ops"
+
+	slack.Notify(testEvent(crontab.EventStart, job))
+	slack.Notify(testEvent(crontab.EventSuccess, job))
+	slack.Notify(failureEvent(job))
+	slack.Close()
+
+	if !assert.Equal(t, 1, len(bodies)) {
+		return
+	}
+
+	var message slackMessage
+	if !assert.Nil(t, json.Unmarshal([]byte(<-bodies), &message)) {
+		return
+	}
+
+	assert.Equal(t, "#ops", message.Channel)
+	assert.Equal(t, ":rotating_light: Job failed: `backup`", message.Text)
+
+	if assert.Equal(t, 1, len(message.Attachments)) {
+		attachment := message.Attachments[0]
+		assert.Equal(t, "```[stderr] pg_dump: &lt;connection refused&gt;```", attachment.Text)
+
+		values := make(map[string]string)
+		for _, field := range attachment.Fields {
+			values[field.Title] = field.Value
+		}
+
+		assert.Equal(t, map[string]string{
+			"Command":   "`backup`",
+			"Schedule":  "@hourly",
+			"Duration":  "1.5s",
+			"Exit code": "3",
+			"Run ID":    "20180407T194044Z-0-2",
+		}, values)
+	}
+}
+
+func TestSlackIncludesJobNames(t *testing.T) {
+	server, bodies := newReceiver()
+	defer server.Close()
+
+	slack := NewSlack(server.URL, nil, discardLogger())
+
+	event := failureEvent(testJob())
+	event.Name = "backup-db"
+
+	slack.Notify(event)
+	slack.Close()
+
+	var message slackMessage
+	if assert.Equal(t, 1, len(bodies)) && assert.Nil(t, json.Unmarshal([]byte(<-bodies), &message)) && assert.Equal(t, 1, len(message.Attachments)) {
+		field := message.Attachments[0].Fields[0]
+		assert.Equal(t, "Job", field.Title)
+		assert.Equal(t, "backup-db", field.Value)
+	}
+}
+
+func TestSlackSkipsFailuresThatWillBeRetried(t *testing.T) {
+	server, bodies := newReceiver()
+	defer server.Close()
+
+	slack := NewSlack(server.URL, nil, discardLogger())
+
+	retried := failureEvent(testJob())
+	retried.Result.WillRetry = true
+
+	slack.Notify(retried)
+	slack.Notify(failureEvent(testJob()))
+	slack.Close()
+
+	assert.Equal(t, 1, len(bodies))
+}
+
+func TestSlackRendersTemplate(t *testing.T) {
+	server, bodies := newReceiver()
+	defer server.Close()
+
+	tmpl, err := ParseTemplate(`<!here> {{ slack .Command }} is broken`)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	job := testJob()
+	job.Command = "a > b"
+
+	slack := NewSlack(server.URL, tmpl, discardLogger())
+	slack.Notify(failureEvent(job))
+	slack.Close()
+
+	var message slackMessage
+	if assert.Nil(t, json.Unmarshal([]byte(<-bodies), &message)) {
+		assert.Equal(t, "<!here> a &gt; b is broken", message.Text)
+	}
+}
@@ -0,0 +1,92 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"text/template"
+
+	"github.com/samgaw/cronic/cron"
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Webhook POSTs job events to a URL, either set for all jobs, or per job
+// using the "webhook-url" annotation.
+type Webhook struct {
+	*sender
+
+	url      string
+	events   []crontab.EventType
+	template *template.Template
+}
+
+// NewWebhook creates a webhook sending the given events (unless overridden by
+// a job's "webhook-events" annotation) to url (which may be empty if only
+// some jobs have a webhook). If tmpl is nil, the payload is the event as
+// JSON.
+func NewWebhook(url string, events []crontab.EventType, tmpl *template.Template, logger *logrus.Entry) *Webhook {
+	w := &Webhook{url: url, events: events, template: tmpl}
+	w.sender = newSender(w.send, logger)
+	return w
+}
+
+// ParseTemplate parses a notification template. Templates are executed with a
+// cron.Event, and can use the "json" function to encode values as JSON, e.g.
+// {"text": {{ json .Command }}}, and "slack" to escape them for Slack.
+func ParseTemplate(text string) (*template.Template, error) {
+	return template.New("notification").Funcs(template.FuncMap{
+		"json": func(value interface{}) (string, error) {
+			encoded, err := json.Marshal(value)
+			return string(encoded), err
+		},
+		"slack": slackEscape,
+	}).Parse(text)
+}
+
+func (w *Webhook) Notify(event *cron.Event) {
+	url := w.url
+	if event.Job.WebhookURL != "" {
+		url = event.Job.WebhookURL
+	}
+
+	events := w.events
+	if event.Job.WebhookEvents != nil {
+		events = event.Job.WebhookEvents
+	}
+
+	if url == "" || !containsEventType(events, event.Type) {
+		return
+	}
+
+	w.enqueue(url, event)
+}
+
+func (w *Webhook) send(url string, event *cron.Event) error {
+	payload, err := w.payload(event)
+	if err != nil {
+		return err
+	}
+	return postJSON(url, payload)
+}
+
+func (w *Webhook) payload(event *cron.Event) ([]byte, error) {
+	if w.template == nil {
+		return json.Marshal(event)
+	}
+
+	var buf bytes.Buffer
+	if err := w.template.Execute(&buf, event); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func containsEventType(eventTypes []crontab.EventType, eventType crontab.EventType) bool {
+	for _, t := range eventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+package notify
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/samgaw/cronic/cron"
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func discardLogger() *logrus.Entry {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	return logrus.NewEntry(logger)
+}
+
+// newReceiver returns a server recording the bodies it receives.
+func newReceiver() (*httptest.Server, chan string) {
+	bodies := make(chan string, 10)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies <- string(body)
+	}))
+
+	return server, bodies
+}
+
+func testEvent(eventType crontab.EventType, job *crontab.Job) *cron.Event {
+	return &cron.Event{
+		Type:     eventType,
+		Time:     time.Now(),
+		Job:      job,
+		Position: job.Position,
+		Schedule: job.Schedule,
+		Command:  job.Command,
+	}
+}
+
+func testJob() *crontab.Job {
+	return &crontab.Job{CrontabLine: crontab.CrontabLine{Schedule: "@hourly", Command: "backup"}}
+}
+
+func TestWebhookSendsFilteredEvents(t *testing.T) {
+	server, bodies := newReceiver()
+	defer server.Close()
+
+	webhook := NewWebhook(server.URL, []crontab.EventType{crontab.EventFailure}, nil, discardLogger())
+
+	job := testJob()
+	webhook.Notify(testEvent(crontab.EventStart, job))
+	webhook.Notify(testEvent(crontab.EventFailure, job))
+	webhook.Close()
+
+	close(bodies)
+
+	received := make([]cron.Event, 0)
+	for body := range bodies {
+		var event cron.Event
+		if assert.Nil(t, json.Unmarshal([]byte(body), &event)) {
+			received = append(received, event)
+		}
+	}
+
+	if assert.Equal(t, 1, len(received)) {
+		assert.Equal(t, crontab.EventFailure, received[0].Type)
+		assert.Equal(t, "backup", received[0].Command)
+	}
+}
+
+func TestWebhookUsesJobOverrides(t *testing.T) {
+	global, globalBodies := newReceiver()
+	defer global.Close()
+
+	override, overrideBodies := newReceiver()
+	defer override.Close()
+
+	webhook := NewWebhook(global.URL, []crontab.EventType{crontab.EventFailure}, nil, discardLogger())
+
+	job := testJob()
+	job.WebhookURL = override.URL
+	job.WebhookEvents = []crontab.EventType{crontab.EventSuccess}
+
+	webhook.Notify(testEvent(crontab.EventFailure, job))
+	webhook.Notify(testEvent(crontab.EventSuccess, job))
+	webhook.Close()
+
+	assert.Equal(t, 0, len(globalBodies))
+	assert.Equal(t, 1, len(overrideBodies))
+}
+
+func TestWebhookWithoutURLIgnoresEvents(t *testing.T) {
+	webhook := NewWebhook("", crontab.EventTypes, nil, discardLogger())
+	webhook.Notify(testEvent(crontab.EventFailure, testJob()))
+	webhook.Close()
+
+	// Notifying a closed webhook is harmless
+	webhook.Notify(testEvent(crontab.EventFailure, testJob()))
+}
+
+func TestWebhookReportsFailedDeliveries(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	webhook := NewWebhook(server.URL, crontab.EventTypes, nil, discardLogger())
+	assert.Nil(t, webhook.Healthy())
+
+	webhook.Notify(testEvent(crontab.EventFailure, testJob()))
+	webhook.Close()
+
+	if err := webhook.Healthy(); assert.NotNil(t, err) {
+		assert.Regexp(t, "500", err.Error())
+	}
+
+	// Failures are only reported once
+	assert.Nil(t, webhook.Healthy())
+}
+
+func TestWebhookRendersTemplate(t *testing.T) {
+	server, bodies := newReceiver()
+	defer server.Close()
+
+	tmpl, err := ParseTemplate(`{"text": {{ json (printf "%s: %s" .Type .Command) }}}`)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	webhook := NewWebhook(server.URL, crontab.EventTypes, tmpl, discardLogger())
+	webhook.Notify(testEvent(crontab.EventFailure, testJob()))
+	webhook.Close()
+
+	assert.Equal(t, `{"text": "failure: backup"}`, <-bodies)
+}
@@ -0,0 +1,6 @@
+// Package rpc serves the gRPC control API of cronic, defined in cronic.proto,
+// alongside the JSON API of the web dashboard.
+//
+// It's only built with the grpc build tag (go build -tags grpc), so that
+// cronic doesn't otherwise depend on gRPC and protobuf.
+package rpc
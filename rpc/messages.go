@@ -0,0 +1,94 @@
+//go:build grpc
+// +build grpc
+
+package rpc
+
+import (
+	"github.com/golang/protobuf/proto"
+)
+
+// The messages of cronic.proto. golang/protobuf encodes them using their
+// struct tags, so they're kept in sync with cronic.proto by hand rather than
+// generated, which spares the build a protoc step.
+
+type ListJobsRequest struct {
+	Namespace string `protobuf:"bytes,1,opt,name=namespace,proto3" json:"namespace,omitempty"`
+}
+
+type ListJobsResponse struct {
+	Jobs []*Job `protobuf:"bytes,1,rep,name=jobs,proto3" json:"jobs,omitempty"`
+}
+
+type JobRequest struct {
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+}
+
+type Job struct {
+	Name       string     `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Position   int32      `protobuf:"varint,2,opt,name=position,proto3" json:"position,omitempty"`
+	Schedule   string     `protobuf:"bytes,3,opt,name=schedule,proto3" json:"schedule,omitempty"`
+	Command    string     `protobuf:"bytes,4,opt,name=command,proto3" json:"command,omitempty"`
+	Namespace  string     `protobuf:"bytes,5,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	Managed    bool       `protobuf:"varint,6,opt,name=managed,proto3" json:"managed,omitempty"`
+	NextRun    string     `protobuf:"bytes,7,opt,name=next_run,json=nextRun,proto3" json:"next_run,omitempty"`
+	Running    bool       `protobuf:"varint,8,opt,name=running,proto3" json:"running,omitempty"`
+	Paused     bool       `protobuf:"varint,9,opt,name=paused,proto3" json:"paused,omitempty"`
+	LastResult *RunResult `protobuf:"bytes,10,opt,name=last_result,json=lastResult,proto3" json:"last_result,omitempty"`
+}
+
+type RunResult struct {
+	RunId       string `protobuf:"bytes,1,opt,name=run_id,json=runId,proto3" json:"run_id,omitempty"`
+	Iteration   uint64 `protobuf:"varint,2,opt,name=iteration,proto3" json:"iteration,omitempty"`
+	StartedAt   string `protobuf:"bytes,3,opt,name=started_at,json=startedAt,proto3" json:"started_at,omitempty"`
+	FinishedAt  string `protobuf:"bytes,4,opt,name=finished_at,json=finishedAt,proto3" json:"finished_at,omitempty"`
+	Success     bool   `protobuf:"varint,5,opt,name=success,proto3" json:"success,omitempty"`
+	TimedOut    bool   `protobuf:"varint,6,opt,name=timed_out,json=timedOut,proto3" json:"timed_out,omitempty"`
+	ExitCode    int32  `protobuf:"varint,7,opt,name=exit_code,json=exitCode,proto3" json:"exit_code,omitempty"`
+	Error       string `protobuf:"bytes,8,opt,name=error,proto3" json:"error,omitempty"`
+	OutputLines int32  `protobuf:"varint,9,opt,name=output_lines,json=outputLines,proto3" json:"output_lines,omitempty"`
+}
+
+type StreamRunsRequest struct {
+	Job string `protobuf:"bytes,1,opt,name=job,proto3" json:"job,omitempty"`
+}
+
+type RunEvent struct {
+	Type            string     `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	Time            string     `protobuf:"bytes,2,opt,name=time,proto3" json:"time,omitempty"`
+	Name            string     `protobuf:"bytes,3,opt,name=name,proto3" json:"name,omitempty"`
+	Position        int32      `protobuf:"varint,4,opt,name=position,proto3" json:"position,omitempty"`
+	Namespace       string     `protobuf:"bytes,5,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	RunId           string     `protobuf:"bytes,6,opt,name=run_id,json=runId,proto3" json:"run_id,omitempty"`
+	Iteration       uint64     `protobuf:"varint,7,opt,name=iteration,proto3" json:"iteration,omitempty"`
+	Result          *RunResult `protobuf:"bytes,8,opt,name=result,proto3" json:"result,omitempty"`
+	DurationSeconds float64    `protobuf:"fixed64,9,opt,name=duration_seconds,json=durationSeconds,proto3" json:"duration_seconds,omitempty"`
+	SkipReason      string     `protobuf:"bytes,10,opt,name=skip_reason,json=skipReason,proto3" json:"skip_reason,omitempty"`
+}
+
+func (m *ListJobsRequest) Reset()         { *m = ListJobsRequest{} }
+func (m *ListJobsRequest) String() string { return proto.CompactTextString(m) }
+func (*ListJobsRequest) ProtoMessage()    {}
+
+func (m *ListJobsResponse) Reset()         { *m = ListJobsResponse{} }
+func (m *ListJobsResponse) String() string { return proto.CompactTextString(m) }
+func (*ListJobsResponse) ProtoMessage()    {}
+
+func (m *JobRequest) Reset()         { *m = JobRequest{} }
+func (m *JobRequest) String() string { return proto.CompactTextString(m) }
+func (*JobRequest) ProtoMessage()    {}
+
+func (m *Job) Reset()         { *m = Job{} }
+func (m *Job) String() string { return proto.CompactTextString(m) }
+func (*Job) ProtoMessage()    {}
+
+func (m *RunResult) Reset()         { *m = RunResult{} }
+func (m *RunResult) String() string { return proto.CompactTextString(m) }
+func (*RunResult) ProtoMessage()    {}
+
+func (m *StreamRunsRequest) Reset()         { *m = StreamRunsRequest{} }
+func (m *StreamRunsRequest) String() string { return proto.CompactTextString(m) }
+func (*StreamRunsRequest) ProtoMessage()    {}
+
+func (m *RunEvent) Reset()         { *m = RunEvent{} }
+func (m *RunEvent) String() string { return proto.CompactTextString(m) }
+func (*RunEvent) ProtoMessage()    {}
@@ -0,0 +1,253 @@
+//go:build grpc
+// +build grpc
+
+package rpc
+
+import (
+	"context"
+	"crypto/subtle"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samgaw/cronic/cron"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// How many events to hold for each StreamRuns call (in excess, events are
+// dropped)
+var STREAM_BUFFER_SIZE = 256
+
+// Server implements the Cronic service, and is a notifier, to stream runs.
+//
+// Like the web dashboard, it requires the token (if set) to change jobs:
+// TriggerJob, PauseJob and ResumeJob calls must present it as a bearer token
+// in their "authorization" metadata.
+type Server struct {
+	registry *cron.Registry
+	token    string
+	logger   *logrus.Entry
+
+	mu          sync.Mutex
+	subscribers map[chan *cron.Event]struct{}
+}
+
+func NewServer(registry *cron.Registry, token string, logger *logrus.Entry) *Server {
+	return &Server{
+		registry:    registry,
+		token:       token,
+		logger:      logger,
+		subscribers: make(map[chan *cron.Event]struct{}),
+	}
+}
+
+// GRPCServer returns a gRPC server serving the Cronic service.
+func (s *Server) GRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	server := grpc.NewServer(opts...)
+	RegisterCronicServer(server, s)
+	return server
+}
+
+func (s *Server) Notify(event *cron.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for subscriber := range s.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+			// The client is too slow
+		}
+	}
+}
+
+func (s *Server) ListJobs(ctx context.Context, req *ListJobsRequest) (*ListJobsResponse, error) {
+	resp := &ListJobsResponse{Jobs: make([]*Job, 0)}
+	for _, jobStatus := range s.registry.Jobs() {
+		if req.Namespace == "" || jobStatus.Job.Namespace == req.Namespace {
+			resp.Jobs = append(resp.Jobs, newJob(jobStatus.Snapshot()))
+		}
+	}
+	return resp, nil
+}
+
+func (s *Server) TriggerJob(ctx context.Context, req *JobRequest) (*Job, error) {
+	jobStatus, err := s.authorizedJob(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.jobLogger(jobStatus).Info("CRONIC: Run requested")
+	if err := jobStatus.Trigger(); err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return newJob(jobStatus.Snapshot()), nil
+}
+
+func (s *Server) PauseJob(ctx context.Context, req *JobRequest) (*Job, error) {
+	jobStatus, err := s.authorizedJob(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	jobStatus.Pause()
+	s.jobLogger(jobStatus).Info("CRONIC: Job paused")
+	return newJob(jobStatus.Snapshot()), nil
+}
+
+func (s *Server) ResumeJob(ctx context.Context, req *JobRequest) (*Job, error) {
+	jobStatus, err := s.authorizedJob(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	jobStatus.Resume()
+	s.jobLogger(jobStatus).Info("CRONIC: Job resumed")
+	return newJob(jobStatus.Snapshot()), nil
+}
+
+func (s *Server) StreamRuns(req *StreamRunsRequest, stream RunStream) error {
+	position := -1
+	if req.Job != "" {
+		jobStatus := s.findJob(req.Job)
+		if jobStatus == nil {
+			return status.Error(codes.NotFound, "no such job")
+		}
+		position = jobStatus.Job.Position
+	}
+
+	events := make(chan *cron.Event, STREAM_BUFFER_SIZE)
+
+	s.mu.Lock()
+	s.subscribers[events] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.subscribers, events)
+		s.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case event := <-events:
+			if position != -1 && event.Position != position {
+				continue
+			}
+			if err := stream.Send(newRunEvent(event)); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// authorizedJob finds the job a call changes, once it's checked the call
+// presents the token.
+func (s *Server) authorizedJob(ctx context.Context, id string) (*cron.JobStatus, error) {
+	if !s.authorized(ctx) {
+		return nil, status.Error(codes.Unauthenticated, "unauthorized")
+	}
+
+	jobStatus := s.findJob(id)
+	if jobStatus == nil {
+		return nil, status.Error(codes.NotFound, "no such job")
+	}
+	return jobStatus, nil
+}
+
+func (s *Server) authorized(ctx context.Context) bool {
+	if s.token == "" {
+		return true
+	}
+
+	const prefix = "Bearer "
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		if strings.HasPrefix(value, prefix) && subtle.ConstantTimeCompare([]byte(value[len(prefix):]), []byte(s.token)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// findJob finds a job by name or position (names never start with a digit).
+func (s *Server) findJob(id string) *cron.JobStatus {
+	position, err := strconv.Atoi(id)
+	if err != nil {
+		return s.registry.JobByName(id)
+	}
+
+	return s.registry.Job(position)
+}
+
+func (s *Server) jobLogger(jobStatus *cron.JobStatus) *logrus.Entry {
+	return s.logger.WithFields(logrus.Fields(cron.JobFields(jobStatus.Job)))
+}
+
+func newJob(snapshot cron.JobSnapshot) *Job {
+	job := &Job{
+		Name:       snapshot.Name,
+		Position:   int32(snapshot.Position),
+		Schedule:   snapshot.Schedule,
+		Command:    snapshot.Command,
+		Namespace:  snapshot.Namespace,
+		Managed:    snapshot.Managed,
+		Running:    snapshot.Running,
+		Paused:     snapshot.Paused,
+		LastResult: newRunResult(snapshot.LastResult),
+	}
+	if snapshot.NextRun != nil {
+		job.NextRun = formatTime(*snapshot.NextRun)
+	}
+	return job
+}
+
+func newRunResult(result *cron.RunResult) *RunResult {
+	if result == nil {
+		return nil
+	}
+
+	runResult := &RunResult{
+		RunId:       result.RunID,
+		Iteration:   result.Iteration,
+		StartedAt:   formatTime(result.StartedAt),
+		FinishedAt:  formatTime(result.FinishedAt),
+		Success:     result.Success,
+		TimedOut:    result.TimedOut,
+		ExitCode:    -1,
+		Error:       result.Error,
+		OutputLines: int32(result.OutputLines),
+	}
+	if result.ExitCode != nil {
+		runResult.ExitCode = int32(*result.ExitCode)
+	}
+	return runResult
+}
+
+func newRunEvent(event *cron.Event) *RunEvent {
+	return &RunEvent{
+		Type:            string(event.Type),
+		Time:            formatTime(event.Time),
+		Name:            event.Name,
+		Position:        int32(event.Position),
+		Namespace:       event.Namespace,
+		RunId:           event.RunID,
+		Iteration:       event.Iteration,
+		Result:          newRunResult(event.Result),
+		DurationSeconds: event.DurationSeconds,
+		SkipReason:      event.SkipReason,
+	}
+}
+
+func formatTime(t time.Time) string {
+	return t.Format(time.RFC3339Nano)
+}
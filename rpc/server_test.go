@@ -0,0 +1,162 @@
+//go:build grpc
+// +build grpc
+
+package rpc
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/samgaw/cronic/cron"
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func discardLogger() *logrus.Entry {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	return logrus.NewEntry(logger)
+}
+
+// newTestClient serves the jobs of a registry that's never started (so that
+// jobs only run when tests want them to), and returns a client calling it.
+func newTestClient(t *testing.T, token string) (*Client, *Server, []*cron.JobStatus, func()) {
+	cronCtx := &crontab.Context{Shell: "/bin/sh", Environ: map[string]string{}}
+	registry := cron.NewRegistry(cronCtx, &cron.Options{}, cron.NewLogger(nil), nil)
+
+	jobs := []*cron.JobStatus{
+		registry.Add(&crontab.Job{
+			CrontabLine: crontab.CrontabLine{Schedule: "* * * * *", Command: "true"},
+			Name:        "backup-db",
+		}, false),
+		registry.Add(&crontab.Job{
+			CrontabLine: crontab.CrontabLine{Schedule: "@daily", Command: "false"},
+		}, false),
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := NewServer(registry, token, discardLogger())
+	grpcServer := server.GRPCServer()
+	go grpcServer.Serve(listener)
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewClient(conn), server, jobs, func() {
+		conn.Close()
+		grpcServer.Stop()
+	}
+}
+
+func TestServerControlsJobs(t *testing.T) {
+	client, _, jobs, stop := newTestClient(t, "")
+	defer stop()
+
+	ctx := context.Background()
+
+	resp, err := client.ListJobs(ctx, &ListJobsRequest{})
+	if assert.Nil(t, err) && assert.Len(t, resp.Jobs, 2) {
+		assert.Equal(t, "backup-db", resp.Jobs[0].Name)
+		assert.Equal(t, "@daily", resp.Jobs[1].Schedule)
+	}
+
+	job, err := client.PauseJob(ctx, &JobRequest{Id: "backup-db"})
+	if assert.Nil(t, err) {
+		assert.True(t, job.Paused)
+		assert.True(t, jobs[0].Paused())
+	}
+
+	_, err = client.ResumeJob(ctx, &JobRequest{Id: "backup-db"})
+	assert.Nil(t, err)
+	assert.False(t, jobs[0].Paused())
+
+	_, err = client.TriggerJob(ctx, &JobRequest{Id: "1"})
+	assert.Nil(t, err)
+
+	// Nothing is consuming the trigger, so the first run is still pending
+	_, err = client.TriggerJob(ctx, &JobRequest{Id: "1"})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	_, err = client.PauseJob(ctx, &JobRequest{Id: "nope"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestServerRequiresTokenToChangeJobs(t *testing.T) {
+	client, _, _, stop := newTestClient(t, "secret")
+	defer stop()
+
+	ctx := context.Background()
+
+	_, err := client.ListJobs(ctx, &ListJobsRequest{})
+	assert.Nil(t, err)
+
+	_, err = client.PauseJob(ctx, &JobRequest{Id: "1"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.PauseJob(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer wrong"), &JobRequest{Id: "1"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.PauseJob(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer secret"), &JobRequest{Id: "1"})
+	assert.Nil(t, err)
+}
+
+func TestServerStreamsRuns(t *testing.T) {
+	client, server, jobs, stop := newTestClient(t, "")
+	defer stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := make(chan *RunEvent, 10)
+	go client.StreamRuns(ctx, &StreamRunsRequest{Job: "1"}, func(event *RunEvent) {
+		events <- event
+	})
+
+	// Wait for the call to subscribe
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		server.mu.Lock()
+		subscribed := len(server.subscribers) == 1
+		server.mu.Unlock()
+
+		if subscribed {
+			break
+		}
+	}
+
+	exitCode := 1
+	server.Notify(&cron.Event{Type: crontab.EventStart, Position: 0, RunID: "other"})
+	server.Notify(&cron.Event{
+		Type:     crontab.EventFailure,
+		Job:      jobs[1].Job,
+		Position: 1,
+		RunID:    "20180407T174100Z-1-2",
+		Result:   &cron.RunResult{RunID: "20180407T174100Z-1-2", ExitCode: &exitCode},
+	})
+
+	// Only the job's runs are streamed
+	select {
+	case event := <-events:
+		assert.Equal(t, "failure", event.Type)
+		assert.Equal(t, "20180407T174100Z-1-2", event.RunId)
+		if assert.NotNil(t, event.Result) {
+			assert.Equal(t, int32(1), event.Result.ExitCode)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for the run event")
+	}
+}
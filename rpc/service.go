@@ -0,0 +1,151 @@
+//go:build grpc
+// +build grpc
+
+package rpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// CronicServer is the Cronic service of cronic.proto.
+type CronicServer interface {
+	ListJobs(ctx context.Context, req *ListJobsRequest) (*ListJobsResponse, error)
+	TriggerJob(ctx context.Context, req *JobRequest) (*Job, error)
+	PauseJob(ctx context.Context, req *JobRequest) (*Job, error)
+	ResumeJob(ctx context.Context, req *JobRequest) (*Job, error)
+	StreamRuns(req *StreamRunsRequest, stream RunStream) error
+}
+
+// RunStream is the server's end of StreamRuns.
+type RunStream interface {
+	Send(event *RunEvent) error
+	grpc.ServerStream
+}
+
+// RegisterCronicServer registers the Cronic service's implementation.
+func RegisterCronicServer(s *grpc.Server, srv CronicServer) {
+	s.RegisterService(&cronicServiceDesc, srv)
+}
+
+var cronicServiceDesc = grpc.ServiceDesc{
+	ServiceName: "cronic.Cronic",
+	HandlerType: (*CronicServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "ListJobs", Handler: unaryHandler("ListJobs", func() interface{} { return &ListJobsRequest{} }, func(srv CronicServer, ctx context.Context, req interface{}) (interface{}, error) {
+			return srv.ListJobs(ctx, req.(*ListJobsRequest))
+		})},
+		{MethodName: "TriggerJob", Handler: unaryHandler("TriggerJob", func() interface{} { return &JobRequest{} }, func(srv CronicServer, ctx context.Context, req interface{}) (interface{}, error) {
+			return srv.TriggerJob(ctx, req.(*JobRequest))
+		})},
+		{MethodName: "PauseJob", Handler: unaryHandler("PauseJob", func() interface{} { return &JobRequest{} }, func(srv CronicServer, ctx context.Context, req interface{}) (interface{}, error) {
+			return srv.PauseJob(ctx, req.(*JobRequest))
+		})},
+		{MethodName: "ResumeJob", Handler: unaryHandler("ResumeJob", func() interface{} { return &JobRequest{} }, func(srv CronicServer, ctx context.Context, req interface{}) (interface{}, error) {
+			return srv.ResumeJob(ctx, req.(*JobRequest))
+		})},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "StreamRuns", Handler: streamRunsHandler, ServerStreams: true},
+	},
+	Metadata: "cronic.proto",
+}
+
+// unaryHandler returns the handler of a unary method, which decodes its
+// request (created by newRequest) and calls it (through interceptor, if
+// any).
+func unaryHandler(method string, newRequest func() interface{}, call func(CronicServer, context.Context, interface{}) (interface{}, error)) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		req := newRequest()
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+
+		if interceptor == nil {
+			return call(srv.(CronicServer), ctx, req)
+		}
+
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/cronic.Cronic/" + method}
+		return interceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return call(srv.(CronicServer), ctx, req)
+		})
+	}
+}
+
+func streamRunsHandler(srv interface{}, stream grpc.ServerStream) error {
+	req := &StreamRunsRequest{}
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+	return srv.(CronicServer).StreamRuns(req, &runStream{stream})
+}
+
+type runStream struct {
+	grpc.ServerStream
+}
+
+func (s *runStream) Send(event *RunEvent) error {
+	return s.ServerStream.SendMsg(event)
+}
+
+// Client calls the Cronic service of a cronic daemon.
+type Client struct {
+	conn *grpc.ClientConn
+}
+
+func NewClient(conn *grpc.ClientConn) *Client {
+	return &Client{conn: conn}
+}
+
+func (c *Client) ListJobs(ctx context.Context, req *ListJobsRequest, opts ...grpc.CallOption) (*ListJobsResponse, error) {
+	resp := &ListJobsResponse{}
+	if err := c.conn.Invoke(ctx, "/cronic.Cronic/ListJobs", req, resp, opts...); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) TriggerJob(ctx context.Context, req *JobRequest, opts ...grpc.CallOption) (*Job, error) {
+	return c.invokeJob(ctx, "TriggerJob", req, opts)
+}
+
+func (c *Client) PauseJob(ctx context.Context, req *JobRequest, opts ...grpc.CallOption) (*Job, error) {
+	return c.invokeJob(ctx, "PauseJob", req, opts)
+}
+
+func (c *Client) ResumeJob(ctx context.Context, req *JobRequest, opts ...grpc.CallOption) (*Job, error) {
+	return c.invokeJob(ctx, "ResumeJob", req, opts)
+}
+
+func (c *Client) invokeJob(ctx context.Context, method string, req *JobRequest, opts []grpc.CallOption) (*Job, error) {
+	job := &Job{}
+	if err := c.conn.Invoke(ctx, "/cronic.Cronic/"+method, req, job, opts...); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// StreamRuns calls onEvent with each run event, until ctx is done or the
+// stream fails.
+func (c *Client) StreamRuns(ctx context.Context, req *StreamRunsRequest, onEvent func(*RunEvent), opts ...grpc.CallOption) error {
+	stream, err := c.conn.NewStream(ctx, &cronicServiceDesc.Streams[0], "/cronic.Cronic/StreamRuns", opts...)
+	if err != nil {
+		return err
+	}
+
+	if err := stream.SendMsg(req); err != nil {
+		return err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+
+	for {
+		event := &RunEvent{}
+		if err := stream.RecvMsg(event); err != nil {
+			return err
+		}
+		onEvent(event)
+	}
+}
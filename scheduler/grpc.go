@@ -0,0 +1,49 @@
+//go:build grpc
+// +build grpc
+
+package scheduler
+
+import (
+	"fmt"
+
+	"github.com/samgaw/cronic/rpc"
+	"github.com/samgaw/cronic/web"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// ServeGRPC serves the gRPC control API on addr (over TLS, with a
+// certificate and key, if set), until the scheduler stops. Call it before
+// starting the scheduler, so that the runs it streams include the first
+// ones. Jobs can only be controlled with Options.APIToken.
+func (s *Scheduler) ServeGRPC(addr string, certFile string, keyFile string) error {
+	var serverOpts []grpc.ServerOption
+	if certFile != "" || keyFile != "" {
+		creds, err := credentials.NewServerTLSFromFile(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("CRONIC: Bad -grpc-tls-cert or -grpc-tls-key: %v", err)
+		}
+		serverOpts = append(serverOpts, grpc.Creds(creds))
+	}
+
+	listener, err := web.Listen(addr)
+	if err != nil {
+		return err
+	}
+
+	server := rpc.NewServer(s.registry, s.opts.APIToken, s.logrusLogger.WithField("component", "grpc"))
+	s.cron.Notifiers = append(s.cron.Notifiers, server)
+
+	grpcServer := server.GRPCServer(serverOpts...)
+
+	go func() {
+		s.logger.Infof("CRONIC: Serving gRPC API on %s", addr)
+		if err := grpcServer.Serve(listener); err != nil {
+			s.logger.Errorf("CRONIC: Failed to serve the gRPC API: %v", err)
+		}
+	}()
+
+	s.closers = append(s.closers, grpcServer.Stop)
+	return nil
+}
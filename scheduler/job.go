@@ -0,0 +1,171 @@
+package scheduler
+
+import (
+	"syscall"
+	"time"
+
+	"github.com/samgaw/cronic/cron"
+	"github.com/samgaw/cronic/crontab"
+)
+
+var (
+	ErrNoSuchJob     = cron.ErrNoSuchJob
+	ErrDuplicateName = cron.ErrDuplicateName
+	ErrNotRunning    = cron.ErrNotRunning
+)
+
+// Job is a job to schedule: its schedule and command, like a crontab line,
+// with the annotations that set how it runs (e.g. "timeout": "1h", see the
+// README).
+type Job struct {
+	// Identifies the job (e.g. in messages, or with Scheduler.Job), if set
+	Name string
+
+	// A schedule, in the syntax of Options.Parse.ScheduleSyntax unless it
+	// has a syntax prefix (e.g. "@quartz")
+	Schedule string
+
+	Command     string
+	Annotations map[string]string
+
+	// Fed to the command's stdin
+	Stdin string
+}
+
+// newJob returns the Job of a parsed job.
+func newJob(job *crontab.Job) *Job {
+	annotations := make(map[string]string, len(job.Annotations))
+	for key, value := range job.Annotations {
+		annotations[key] = value
+	}
+
+	return &Job{
+		Name:        job.Name,
+		Schedule:    job.Schedule,
+		Command:     job.Command,
+		Annotations: annotations,
+		Stdin:       job.Stdin,
+	}
+}
+
+// RunResult is the result of a run of a job.
+type RunResult struct {
+	RunID      string
+	TraceID    string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Success    bool
+	TimedOut   bool
+	Error      string
+
+	// The exit code of the command, if it ran (-1 if it was killed by a
+	// signal)
+	ExitCode *int
+
+	// How many lines of output the run emitted, and the last of them if it
+	// failed (see Options.FailureTailLines)
+	OutputLines int
+	OutputTail  []string
+
+	// How many runs of the job in a row failed, up to this one (0 if it
+	// succeeded)
+	ConsecutiveFailures int
+
+	// How many times the scheduled run was retried before this one, and
+	// whether it will be retried again
+	Retry     int
+	WillRetry bool
+}
+
+func newRunResult(result *cron.RunResult) *RunResult {
+	if result == nil {
+		return nil
+	}
+
+	tail := make([]string, len(result.OutputTail))
+	for i, line := range result.OutputTail {
+		tail[i] = line.Line
+	}
+
+	return &RunResult{
+		RunID:               result.RunID,
+		TraceID:             result.TraceID,
+		StartedAt:           result.StartedAt,
+		FinishedAt:          result.FinishedAt,
+		Success:             result.Success,
+		TimedOut:            result.TimedOut,
+		Error:               result.Error,
+		ExitCode:            result.ExitCode,
+		OutputLines:         result.OutputLines,
+		OutputTail:          tail,
+		ConsecutiveFailures: result.ConsecutiveFailures,
+		Retry:               result.Retry,
+		WillRetry:           result.WillRetry,
+	}
+}
+
+// JobStatus is a scheduled job, through which it can be observed and
+// controlled while it's scheduled.
+type JobStatus struct {
+	status *cron.JobStatus
+}
+
+// Job returns the job.
+func (s *JobStatus) Job() *Job {
+	return newJob(s.status.Job)
+}
+
+// Managed returns whether the job is a managed job (see
+// Scheduler.AddManaged).
+func (s *JobStatus) Managed() bool {
+	return s.status.Snapshot().Managed
+}
+
+// NextRun returns when the job runs next, or the zero time if it isn't
+// scheduled to.
+func (s *JobStatus) NextRun() time.Time {
+	if next := s.status.Snapshot().NextRun; next != nil {
+		return *next
+	}
+	return time.Time{}
+}
+
+// Running returns whether a run of the job is in progress.
+func (s *JobStatus) Running() bool {
+	return s.status.Snapshot().Running
+}
+
+// LastResult returns the result of the job's last run, or nil if it hasn't
+// run yet.
+func (s *JobStatus) LastResult() *RunResult {
+	return newRunResult(s.status.Snapshot().LastResult)
+}
+
+// Trigger starts a run of the job now, outside of its schedule.
+func (s *JobStatus) Trigger() error {
+	return s.status.Trigger()
+}
+
+// Cancel stops the current run, which then fails (and isn't retried).
+func (s *JobStatus) Cancel() error {
+	return s.status.Cancel()
+}
+
+// Signal sends sig to the processes of the current run.
+func (s *JobStatus) Signal(sig syscall.Signal) error {
+	return s.status.Signal(sig)
+}
+
+// Pause stops the job's scheduled runs (it can still be triggered), until
+// it's resumed.
+func (s *JobStatus) Pause() {
+	s.status.Pause()
+}
+
+func (s *JobStatus) Resume() {
+	s.status.Resume()
+}
+
+func (s *JobStatus) Paused() bool {
+	return s.status.Paused()
+}
@@ -0,0 +1,271 @@
+package scheduler
+
+import (
+	"context"
+	"io/ioutil"
+	"log/slog"
+	"time"
+
+	"github.com/samgaw/cronic/cron"
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Level is the severity of a LogEntry.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	default:
+		return "error"
+	}
+}
+
+// LogEntry is a message of cronic, or a line of a job's output, with its
+// fields (e.g. job.name, or run.id).
+type LogEntry struct {
+	Time    time.Time
+	Level   Level
+	Message string
+	Fields  map[string]interface{}
+}
+
+// Logger receives what a scheduler logs, e.g. to log it with zap, zerolog or
+// slog (see SlogLogger). Log is called from the goroutines of jobs, so it
+// must be safe for concurrent use, and shouldn't block. Entries of all
+// levels are passed on, unless the Logger is a LevelLogger.
+type Logger interface {
+	Log(entry *LogEntry)
+}
+
+// LevelLogger is a Logger that only logs entries of some levels, which
+// Enabled reports. The entries of other levels aren't even made (e.g. debug
+// messages, which are many). Enabled is called once, when the scheduler is
+// created.
+type LevelLogger interface {
+	Logger
+	Enabled(level Level) bool
+}
+
+// LoggerFunc makes a Logger of a function.
+type LoggerFunc func(entry *LogEntry)
+
+func (f LoggerFunc) Log(entry *LogEntry) {
+	f(entry)
+}
+
+// SlogLogger returns a Logger that logs with logger, at the levels it's
+// enabled for.
+func SlogLogger(logger *slog.Logger) LevelLogger {
+	return &slogLogger{logger: logger}
+}
+
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+func (l *slogLogger) Enabled(level Level) bool {
+	return l.logger.Enabled(context.Background(), slogLevel(level))
+}
+
+func (l *slogLogger) Log(entry *LogEntry) {
+	level := slogLevel(entry.Level)
+	if !l.logger.Enabled(context.Background(), level) {
+		return
+	}
+
+	record := slog.NewRecord(entry.Time, level, entry.Message, 0)
+	for key, value := range entry.Fields {
+		record.AddAttrs(slog.Any(key, value))
+	}
+	l.logger.Handler().Handle(context.Background(), record)
+}
+
+func slogLevel(level Level) slog.Level {
+	switch level {
+	case LevelDebug:
+		return slog.LevelDebug
+	case LevelInfo:
+		return slog.LevelInfo
+	case LevelWarn:
+		return slog.LevelWarn
+	default:
+		return slog.LevelError
+	}
+}
+
+// discardLogger discards what's logged.
+type discardLogger struct{}
+
+func (discardLogger) Log(*LogEntry) {}
+
+func (discardLogger) Enabled(Level) bool {
+	return false
+}
+
+// cronHandler returns the handler the scheduler's jobs log with, which
+// passes their entries on to logger (or logs with logrus' standard logger if
+// it's nil), at the levels it's enabled for if it's a LevelLogger.
+func cronHandler(logger Logger) cron.Handler {
+	if logger == nil {
+		return &logrusHandler{logger: logrus.StandardLogger()}
+	}
+
+	handler := &loggerHandler{logger: logger, minLevel: LevelDebug}
+	if levelLogger, ok := logger.(LevelLogger); ok {
+		// The lowest level it's enabled for (if any)
+		handler.minLevel = LevelError + 1
+		for level := LevelError; level >= LevelDebug; level-- {
+			if levelLogger.Enabled(level) {
+				handler.minLevel = level
+			}
+		}
+	}
+	return handler
+}
+
+// loggerHandler passes the entries of cron's loggers on to a Logger.
+type loggerHandler struct {
+	logger   Logger
+	minLevel Level
+}
+
+func (h *loggerHandler) Enabled(level crontab.Level) bool {
+	return logLevel(level) >= h.minLevel
+}
+
+func (h *loggerHandler) Handle(entry *cron.Entry) {
+	fields := make(map[string]interface{}, len(entry.Data))
+	for key, value := range entry.Data {
+		fields[key] = value
+	}
+
+	h.logger.Log(&LogEntry{
+		Time:    entry.Time,
+		Level:   logLevel(entry.Level),
+		Message: entry.Message,
+		Fields:  fields,
+	})
+}
+
+func logLevel(level crontab.Level) Level {
+	switch level {
+	case crontab.LevelDebug:
+		return LevelDebug
+	case crontab.LevelInfo:
+		return LevelInfo
+	case crontab.LevelWarn:
+		return LevelWarn
+	default:
+		return LevelError
+	}
+}
+
+// logrusHandler logs the entries of cron's loggers with a logrus logger.
+type logrusHandler struct {
+	logger *logrus.Logger
+}
+
+func (h *logrusHandler) Enabled(level crontab.Level) bool {
+	return h.logger.Level >= logrusLevel(level)
+}
+
+func (h *logrusHandler) Handle(entry *cron.Entry) {
+	logged := h.logger.WithFields(logrus.Fields(entry.Data))
+	switch entry.Level {
+	case crontab.LevelDebug:
+		logged.Debug(entry.Message)
+	case crontab.LevelInfo:
+		logged.Info(entry.Message)
+	case crontab.LevelWarn:
+		logged.Warn(entry.Message)
+	default:
+		logged.Error(entry.Message)
+	}
+}
+
+func logrusLevel(level crontab.Level) logrus.Level {
+	switch level {
+	case crontab.LevelDebug:
+		return logrus.DebugLevel
+	case crontab.LevelInfo:
+		return logrus.InfoLevel
+	case crontab.LevelWarn:
+		return logrus.WarnLevel
+	default:
+		return logrus.ErrorLevel
+	}
+}
+
+// logrusEntry returns the logrus entry the packages that log with logrus
+// (e.g. crontab's parser, or notify) log with, which passes their entries
+// on to logger (or logs with logrus' standard logger if
+// it's nil), at the levels it's enabled for if it's a LevelLogger.
+func logrusEntry(logger Logger) *logrus.Entry {
+	if logger == nil {
+		return logrus.NewEntry(logrus.StandardLogger())
+	}
+
+	bridge := logrus.New()
+	bridge.Out = ioutil.Discard
+	bridge.Level = logrus.DebugLevel
+	if levelLogger, ok := logger.(LevelLogger); ok {
+		// The lowest level it's enabled for
+		bridge.Level = logrus.ErrorLevel
+		for level, logrusLevel := range map[Level]logrus.Level{LevelWarn: logrus.WarnLevel, LevelInfo: logrus.InfoLevel, LevelDebug: logrus.DebugLevel} {
+			if levelLogger.Enabled(level) && logrusLevel > bridge.Level {
+				bridge.Level = logrusLevel
+			}
+		}
+	}
+	bridge.Hooks.Add(&loggerHook{logger: logger})
+	return logrus.NewEntry(bridge)
+}
+
+// loggerHook passes the entries of a logrus logger on to a Logger.
+type loggerHook struct {
+	logger Logger
+}
+
+func (h *loggerHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *loggerHook) Fire(entry *logrus.Entry) error {
+	level := LevelError
+	switch entry.Level {
+	case logrus.DebugLevel:
+		level = LevelDebug
+	case logrus.InfoLevel:
+		level = LevelInfo
+	case logrus.WarnLevel:
+		level = LevelWarn
+	}
+
+	fields := make(map[string]interface{}, len(entry.Data))
+	for key, value := range entry.Data {
+		fields[key] = value
+	}
+
+	h.logger.Log(&LogEntry{
+		Time:    entry.Time,
+		Level:   level,
+		Message: entry.Message,
+		Fields:  fields,
+	})
+	return nil
+}
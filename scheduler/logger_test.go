@@ -0,0 +1,120 @@
+package scheduler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchedulerLogsWithLogger(t *testing.T) {
+	entries := make(chan *LogEntry, 100)
+
+	s, err := New(Options{
+		Logger: LoggerFunc(func(entry *LogEntry) {
+			entries <- entry
+		}),
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	assert.Nil(t, s.Add(&Job{Name: "greet", Schedule: "@once", Command: "echo hello"}))
+
+	assert.Nil(t, s.Start())
+	defer s.Stop()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case entry := <-entries:
+			if entry.Message != "hello" {
+				continue
+			}
+
+			assert.Equal(t, LevelInfo, entry.Level)
+			assert.Equal(t, "greet", entry.Fields["job.name"])
+			assert.Equal(t, "stdout", entry.Fields["channel"])
+			return
+		case <-timeout:
+			t.Fatal("the job's output wasn't logged")
+		}
+	}
+}
+
+func TestSlogLogger(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := SlogLogger(slog.New(slog.NewJSONHandler(&buffer, &slog.HandlerOptions{Level: slog.LevelInfo})))
+
+	logger.Log(&LogEntry{Level: LevelDebug, Message: "CRONIC: Not logged"})
+	logger.Log(&LogEntry{
+		Time:    time.Date(2018, 4, 7, 12, 0, 0, 0, time.UTC),
+		Level:   LevelWarn,
+		Message: "CRONIC: Job is still running",
+		Fields:  map[string]interface{}{"job.name": "backup"},
+	})
+
+	var logged map[string]interface{}
+	if assert.Nil(t, json.Unmarshal(buffer.Bytes(), &logged)) {
+		assert.Equal(t, map[string]interface{}{
+			"time":     "2018-04-07T12:00:00Z",
+			"level":    "WARN",
+			"msg":      "CRONIC: Job is still running",
+			"job.name": "backup",
+		}, logged)
+	}
+
+	assert.False(t, logger.Enabled(LevelDebug))
+	assert.True(t, logger.Enabled(LevelInfo))
+}
+
+func TestLogrusEntryLogsAtEnabledLevels(t *testing.T) {
+	var buffer bytes.Buffer
+	entry := logrusEntry(SlogLogger(slog.New(slog.NewTextHandler(&buffer, &slog.HandlerOptions{Level: slog.LevelWarn}))))
+
+	assert.Equal(t, logrus.WarnLevel, entry.Logger.Level)
+
+	entry = logrusEntry(LoggerFunc(func(*LogEntry) {}))
+	assert.Equal(t, logrus.DebugLevel, entry.Logger.Level)
+}
+
+func TestCronHandlerHandlesEnabledLevels(t *testing.T) {
+	var buffer bytes.Buffer
+	handler := cronHandler(SlogLogger(slog.New(slog.NewTextHandler(&buffer, &slog.HandlerOptions{Level: slog.LevelWarn}))))
+
+	assert.False(t, handler.Enabled(crontab.LevelInfo))
+	assert.True(t, handler.Enabled(crontab.LevelWarn))
+
+	handler = cronHandler(LoggerFunc(func(*LogEntry) {}))
+	assert.True(t, handler.Enabled(crontab.LevelDebug))
+}
+
+func TestLoadLogsWithLogger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cronic-scheduler")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "crontab")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("SHELL=/bin/bash\n* bar\n0 3 * * * ./backup.sh\n"), 0644))
+
+	var messages []string
+	s, err := Load(path, Options{Parse: ParseOptions{Lenient: true}, Logger: LoggerFunc(func(entry *LogEntry) {
+		messages = append(messages, entry.Message)
+	})})
+	if assert.Nil(t, err) {
+		assert.Len(t, s.Jobs(), 1)
+		assert.Contains(t, messages, "CRONIC: Processes will be spawned using shell /bin/bash")
+		assert.Contains(t, messages, "CRONIC: Bad crontab line: * bar, skipping it")
+	}
+}
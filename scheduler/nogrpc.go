@@ -0,0 +1,14 @@
+//go:build !grpc
+// +build !grpc
+
+package scheduler
+
+import (
+	"fmt"
+)
+
+// ServeGRPC fails: cronic is only built with its gRPC control API with the
+// grpc build tag (see the rpc package).
+func (s *Scheduler) ServeGRPC(addr string, certFile string, keyFile string) error {
+	return fmt.Errorf("CRONIC: Bad -grpc-listen: this cronic was built without gRPC support (build it with -tags grpc)")
+}
@@ -0,0 +1,157 @@
+package scheduler
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"text/template"
+
+	"github.com/samgaw/cronic/cron"
+	"github.com/samgaw/cronic/crontab"
+	"github.com/samgaw/cronic/notify"
+)
+
+// ReloadNotifiers creates the notifiers again, reading Options.Notify's
+// ConfigPath (and the templates) again, and keeps the current ones if they
+// are invalid.
+func (s *Scheduler) ReloadNotifiers() error {
+	return s.loadNotifiers()
+}
+
+// loadNotifiers creates the notifiers from their configuration (read from
+// Options.Notify.ConfigPath, if set, with Options.Notify for what it doesn't
+// set), and replaces those of the group with them.
+func (s *Scheduler) loadNotifiers() error {
+	config := s.opts.Notify.config()
+	if s.opts.Notify.ConfigPath != "" {
+		fileConfig, err := readNotifyConfigAtPath(s.opts.Notify.ConfigPath)
+		if err != nil {
+			return err
+		}
+		config = fileConfig.Merge(config)
+	}
+
+	notifiers := append([]cron.Notifier(nil), s.staticNotifiers...)
+
+	// Don't leak the notifiers created before an error
+	fail := func(err error) error {
+		for _, notifier := range notifiers[len(s.staticNotifiers):] {
+			notifier.(notify.Closer).Close()
+		}
+		return err
+	}
+
+	webhook, err := s.newWebhook(config.WebhookURL, config.WebhookEvents, config.WebhookTemplate)
+	if err != nil {
+		return fail(err)
+	}
+	notifiers = append(notifiers, webhook)
+
+	if config.SlackWebhook != "" {
+		slack, err := s.newSlack(config.SlackWebhook, config.SlackTemplate)
+		if err != nil {
+			return fail(err)
+		}
+		notifiers = append(notifiers, slack)
+	}
+
+	mailTo := s.cronCtx.Environ["MAILTO"]
+	if len(notify.ParseMailTo(mailTo)) > 0 {
+		if config.SMTPAddr == "" {
+			s.logger.Warnf("CRONIC: MAILTO is set, but -smtp-addr isn't: not sending mail")
+		} else {
+			mail, err := s.newMail(config.SMTPAddr, config.SMTPUser, config.SMTPPassword, config.MailFrom, mailTo, config.MailWhen)
+			if err != nil {
+				return fail(err)
+			}
+
+			s.logger.Infof("CRONIC: Sending mail to %s", mailTo)
+			notifiers = append(notifiers, mail)
+		}
+	}
+
+	s.notifiers.Replace(notifiers, config.Labels)
+	return nil
+}
+
+func (s *Scheduler) newWebhook(url string, events string, templatePath string) (*notify.Webhook, error) {
+	eventTypes := crontab.EventTypes
+	if events != "" {
+		var err error
+		eventTypes, err = crontab.ParseEventTypes(events)
+		if err != nil {
+			return nil, fmt.Errorf("CRONIC: Bad -webhook-events: %v", err)
+		}
+	}
+
+	tmpl, err := readTemplateAtPath(templatePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return notify.NewWebhook(url, eventTypes, tmpl, s.logrusLogger.WithField("component", "webhook")), nil
+}
+
+func (s *Scheduler) newSlack(url string, templatePath string) (*notify.Slack, error) {
+	tmpl, err := readTemplateAtPath(templatePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return notify.NewSlack(url, tmpl, s.logrusLogger.WithField("component", "slack")), nil
+}
+
+func (s *Scheduler) newMail(addr string, user string, password string, from string, mailTo string, when string) (*notify.Mail, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+
+	if from == "" {
+		from = "cronic@" + hostname
+	}
+
+	if when == "" {
+		when = notify.MailWhenOutput
+	}
+
+	return notify.NewMail(notify.MailOptions{
+		Addr:     addr,
+		Username: user,
+		Password: password,
+		From:     from,
+		To:       notify.ParseMailTo(mailTo),
+		When:     when,
+		Hostname: hostname,
+	}, s.logrusLogger.WithField("component", "mail"))
+}
+
+// readTemplateAtPath reads a notification template, if path isn't empty.
+func readTemplateAtPath(path string) (*template.Template, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	text, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := notify.ParseTemplate(string(text))
+	if err != nil {
+		return nil, fmt.Errorf("CRONIC: Bad template %s: %v", path, err)
+	}
+
+	return tmpl, nil
+}
+
+func readNotifyConfigAtPath(path string) (*notify.Config, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	return notify.ParseConfig(file)
+}
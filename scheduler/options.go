@@ -0,0 +1,671 @@
+package scheduler
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/samgaw/cronic/cron"
+	"github.com/samgaw/cronic/crontab"
+	"github.com/samgaw/cronic/notify"
+	"github.com/samgaw/cronic/secrets"
+	"github.com/samgaw/cronic/state"
+	"github.com/samgaw/cronic/telemetry"
+)
+
+// Options configures a Scheduler, like the flags of the cronic command with
+// the same names (see the README). The zero value runs jobs as processes on
+// this machine, with cronic's defaults.
+type Options struct {
+	// What jobs share, like the variables at the top of a crontab: their
+	// variables, shell (/bin/sh if empty), and working directory (the
+	// program's if empty)
+	Environ map[string]string
+	Shell   string
+	Dir     string
+
+	// Where cronic's messages, and the output of jobs, are logged (logrus'
+	// standard logger if nil)
+	Logger Logger
+
+	// How crontabs are parsed (see Load)
+	Parse ParseOptions
+
+	// Called once each run of a job is done. Like notifiers, it's called
+	// from the job's goroutine, so it must not block.
+	OnRun func(job *Job, result *RunResult)
+
+	// Lets the jobs of this crontab be created, updated and deleted while
+	// the scheduler runs (e.g. with the API of the dashboard), which needs
+	// APIToken (see AddManaged)
+	ManagedCrontab string
+
+	// Required to control jobs with the dashboard and the gRPC API (see
+	// ServeDashboard and ServeGRPC)
+	APIToken string
+
+	// Which of the crontab's jobs to schedule (see Load): those whose name
+	// or command matches Only (if set), except those matching Exclude, and
+	// those of Shard (e.g. "0/3", or "host/3")
+	Only    string
+	Exclude string
+	Shard   string
+
+	// Reload the jobs of the crontab when it changes (see Load)
+	Watch bool
+
+	// How runs go, unless the job says otherwise: how long they can last,
+	// and after how long cronic warns about them (0 for no limit, or no
+	// warning), what happens when their command can't be started (see
+	// crontab.SpawnFailureFail, the default), and how many of their last
+	// lines of output are kept when they fail
+	Timeout          time.Duration
+	WarnAfter        time.Duration
+	OnSpawnFailure   string
+	FailureTailLines int
+
+	// How many jobs can run at once (0 for no limit)
+	MaxConcurrentRuns int
+
+	// The holidays of jobs with a skip-holidays annotation (an iCalendar
+	// file, or a list of dates), and the weekly windows when no job runs
+	// (e.g. "Sat 00:00-04:00")
+	Holidays string
+	Blackout string
+
+	// Where the locks jobs share with other cronic processes are kept (a
+	// cronic-locks directory in the temporary directory if empty)
+	LockDir string
+
+	// The cgroup v2 directory the cgroups of jobs with memory or CPU limits
+	// are created in
+	CgroupDir string
+
+	// How jobs with an image run: in Docker containers ("docker", the
+	// default), with the daemon at DockerHost (unix:///var/run/docker.sock
+	// if empty), or as Kubernetes Jobs ("kubernetes")
+	ContainerExecutor   string
+	DockerHost          string
+	KubernetesAPI       string
+	KubernetesNamespace string
+	KubernetesTemplate  string
+
+	// How jobs with a host annotation authenticate to it, and check its
+	// key (ssh's defaults if empty)
+	SSHKey        string
+	SSHKnownHosts string
+
+	// Where the secrets of jobs' environment variables come from: Vault
+	// (with the token of VaultTokenFile, or else VaultToken), and AWS
+	// Secrets Manager, and how long they're cached (process-wide, 5m if 0)
+	VaultAddr       string
+	VaultToken      string
+	VaultTokenFile  string
+	AWSRegion       string
+	SecretsCacheTTL time.Duration
+
+	// How much of jobs' output is logged, per second (with bursts of
+	// LogBurst lines) and in how many lines (0 to log it all), and how much
+	// is relayed, slowing down jobs that emit more
+	LogRateLimit    int
+	LogBurst        int
+	LogSample       int
+	OutputRateLimit int
+
+	// The length of the lines of output read from jobs (process-wide, 64K
+	// if 0), and what happens to longer ones: see cron.LongLineSplit (the
+	// default)
+	ReadBufferSize int
+	LongLines      string
+
+	// Log the fields of jobs' output lines that are JSON objects
+	JSONOutput bool
+
+	// Write jobs' output to stdout and stderr instead of logging it,
+	// prefixed with the job's name if PassthroughPrefix is set
+	Passthrough       bool
+	PassthroughPrefix bool
+
+	// Where else jobs' output, and what happens to their runs, go: syslog
+	// ("local", or a server's URL, with the facility "cron" and the tag
+	// "cronic" if empty), the systemd journal, Graylog, Loki, and the clients
+	// of a Unix socket
+	Syslog         string
+	SyslogFacility string
+	SyslogTag      string
+	Journald       bool
+	GELFAddr       string
+	LokiURL        string
+	EventSocket    string
+
+	// Where the output of each run is archived, compressed ("none", the
+	// default, or "gzip") when it's at least ArchiveCompressMinSize bytes
+	ArchiveDir             string
+	ArchiveCompression     string
+	ArchiveCompressMinSize int64
+
+	// Where the results of runs are recorded (see the README): StateFile,
+	// StateStore or HistoryDB, and HistoryExport, as StateInstance (the
+	// hostname if empty). Runs are deleted HistoryRetention after they finish
+	// (0 to keep them).
+	StateFile        string
+	StateStore       string
+	HistoryDB        string
+	HistoryRetention time.Duration
+	HistoryExport    string
+	StateInstance    string
+
+	// Who's notified of runs (see NotifyOptions)
+	Notify NotifyOptions
+
+	// Where metrics about runs are sent (traces and metrics also go to the
+	// OTLP endpoint of $OTEL_EXPORTER_OTLP_ENDPOINT, if set)
+	StatsDAddr   string
+	StatsDPrefix string
+
+	// The JSON file of the namespaces jobs can belong to
+	Namespaces string
+
+	// Checked once the scheduler starts: the programs jobs start are looked
+	// up (see cron.MissingCommandIgnore, the default), and the minutes when
+	// at least HotSpotThreshold jobs run at once are logged (0 to disable)
+	OnMissingCommand string
+	HotSpotThreshold int
+
+	// Check that jobs can still run, and notifications be sent, this often
+	// (0 to disable)
+	SelfCheckInterval time.Duration
+
+	// What happens to runs in progress when the scheduler stops (see
+	// cron.ShutdownWait, the default)
+	OnShutdown string
+
+	// Stop the runs in progress as soon as a run fails, once it won't be
+	// retried (see Scheduler.Failed)
+	FailFast bool
+}
+
+// ParseOptions configures how crontabs are parsed, like the flags of the
+// cronic command with the same names. The zero value parses them like cron
+// does.
+type ParseOptions struct {
+	// Skip malformed lines (logging them) rather than failing
+	Lenient bool
+
+	// Whether job lines have a user field (see crontab.FormatAuto, the
+	// default, crontab.FormatUser and crontab.FormatSystem)
+	Format string
+
+	// The syntax of schedules without a syntax prefix (see
+	// crontab.SyntaxCron, the default)
+	ScheduleSyntax string
+
+	// Replace ${VAR} in schedules and commands with the value of VAR, of
+	// the crontab or of the program's environment, less the variables
+	// EnvAllow (if set) and EnvDeny exclude, which jobs don't inherit either
+	ExpandVariables bool
+	EnvAllow        []string
+	EnvDeny         []string
+
+	// Leave % in commands as-is, instead of feeding what follows the first
+	// one to the command's stdin
+	LiteralPercent bool
+}
+
+func (o ParseOptions) parser(logger Logger) *crontab.Parser {
+	return &crontab.Parser{
+		Lenient:         o.Lenient,
+		Format:          o.Format,
+		ScheduleSyntax:  o.ScheduleSyntax,
+		ExpandVariables: o.ExpandVariables,
+		EnvAllow:        o.EnvAllow,
+		EnvDeny:         o.EnvDeny,
+		LiteralPercent:  o.LiteralPercent,
+		Logger:          logrusEntry(logger),
+	}
+}
+
+// check checks the crontab format and schedule syntax, if set.
+func (o ParseOptions) check() error {
+	if o.ScheduleSyntax != "" {
+		if _, err := crontab.ParseScheduleSyntax(o.ScheduleSyntax); err != nil {
+			return fmt.Errorf("CRONIC: Bad -schedule-syntax: %v", err)
+		}
+	}
+
+	if o.Format != "" {
+		if _, err := crontab.ParseCrontabFormat(o.Format); err != nil {
+			return fmt.Errorf("CRONIC: Bad -crontab-format: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// NotifyOptions configures the notifiers, like the flags of the cronic
+// command with the same names. Those of the ConfigPath file (see
+// -notify-config) take precedence, and are read again by
+// Scheduler.ReloadNotifiers.
+type NotifyOptions struct {
+	ConfigPath string
+
+	// Where job events are POSTed (all of them if WebhookEvents is empty),
+	// and the Go template they're rendered with (as JSON if empty)
+	WebhookURL      string
+	WebhookEvents   string
+	WebhookTemplate string
+
+	SlackWebhook  string
+	SlackTemplate string
+
+	// How mail is sent to the crontab's MAILTO, and when (see
+	// notify.MailWhenOutput, the default)
+	SMTPAddr     string
+	SMTPUser     string
+	SMTPPassword string
+	MailFrom     string
+	MailWhen     string
+}
+
+func (o NotifyOptions) config() *notify.Config {
+	return &notify.Config{
+		WebhookURL:      o.WebhookURL,
+		WebhookEvents:   o.WebhookEvents,
+		WebhookTemplate: o.WebhookTemplate,
+		SlackWebhook:    o.SlackWebhook,
+		SlackTemplate:   o.SlackTemplate,
+		SMTPAddr:        o.SMTPAddr,
+		SMTPUser:        o.SMTPUser,
+		SMTPPassword:    o.SMTPPassword,
+		MailFrom:        o.MailFrom,
+		MailWhen:        o.MailWhen,
+	}
+}
+
+// configure sets the cron.Options the scheduler's jobs run with from opts,
+// opening what they need (e.g. the state store), which close closes.
+func (s *Scheduler) configure(opts *Options) error {
+	var err error
+
+	if opts.ManagedCrontab != "" && opts.APIToken == "" {
+		// Managed jobs run any command they're given, so whoever can create
+		// them must be known
+		return fmt.Errorf("CRONIC: -managed-crontab requires -api-token (or $CRONIC_API_TOKEN)")
+	}
+
+	if opts.ReadBufferSize != 0 {
+		if opts.ReadBufferSize < 16 || opts.ReadBufferSize > 1<<30 {
+			return fmt.Errorf("CRONIC: Bad -read-buffer-size: %d (expected a size from 16 bytes to 1G)", opts.ReadBufferSize)
+		}
+		cron.READ_BUFFER_SIZE = opts.ReadBufferSize
+	}
+
+	if opts.LongLines != "" {
+		cron.LONG_LINE_POLICY, err = cron.ParseLongLinePolicy(opts.LongLines)
+		if err != nil {
+			return fmt.Errorf("CRONIC: Bad -long-lines: %v", err)
+		}
+	}
+
+	if opts.SecretsCacheTTL != 0 {
+		secrets.SECRETS_CACHE_TTL = opts.SecretsCacheTTL
+	}
+
+	s.jobFilter, err = cron.ParseJobFilter(opts.Only, opts.Exclude)
+	if err != nil {
+		return fmt.Errorf("CRONIC: Bad -only or -exclude: %v", err)
+	}
+
+	if opts.Shard != "" {
+		s.shard, err = cron.ParseShard(opts.Shard)
+		if err != nil {
+			return fmt.Errorf("CRONIC: Bad -shard: %v", err)
+		}
+	}
+
+	s.onMissingCommand = cron.MissingCommandIgnore
+	if opts.OnMissingCommand != "" {
+		s.onMissingCommand, err = cron.ParseMissingCommandPolicy(opts.OnMissingCommand)
+		if err != nil {
+			return fmt.Errorf("CRONIC: Bad -on-missing-command: %v", err)
+		}
+	}
+
+	s.onShutdown = cron.ShutdownWait
+	if opts.OnShutdown != "" {
+		s.onShutdown, err = cron.ParseShutdownPolicy(opts.OnShutdown)
+		if err != nil {
+			return fmt.Errorf("CRONIC: Bad -on-shutdown: %v", err)
+		}
+	}
+
+	cronOpts := &cron.Options{
+		FailureTailLines: opts.FailureTailLines,
+		LockDir:          opts.LockDir,
+		OutputRateLimit:  opts.OutputRateLimit,
+		LogRateLimit:     opts.LogRateLimit,
+		LogBurst:         opts.LogBurst,
+		LogSample:        opts.LogSample,
+		Timeout:          opts.Timeout,
+		WarnAfter:        opts.WarnAfter,
+		CgroupDir:        opts.CgroupDir,
+		EnvAllow:         opts.Parse.EnvAllow,
+		EnvDeny:          opts.Parse.EnvDeny,
+		JSONOutput:       opts.JSONOutput,
+		Kill:             make(chan struct{}),
+	}
+	s.cron = cronOpts
+
+	if opts.OnSpawnFailure != "" {
+		cronOpts.OnSpawnFailure, err = crontab.ParseSpawnFailurePolicy(opts.OnSpawnFailure)
+		if err != nil {
+			return fmt.Errorf("CRONIC: Bad -on-spawn-failure: %v", err)
+		}
+	}
+
+	switch opts.ContainerExecutor {
+	case "", "docker":
+		dockerHost := opts.DockerHost
+		if dockerHost == "" {
+			dockerHost = cron.DOCKER_HOST
+		}
+		cronOpts.ContainerExecutor, err = cron.NewDockerExecutor(dockerHost)
+	case "kubernetes":
+		cronOpts.ContainerExecutor, err = cron.NewKubernetesExecutor(opts.KubernetesAPI, opts.KubernetesNamespace, opts.KubernetesTemplate)
+	default:
+		err = fmt.Errorf("CRONIC: Bad -container-executor: %q (expected docker or kubernetes)", opts.ContainerExecutor)
+	}
+	if err != nil {
+		return err
+	}
+
+	cronOpts.RemoteExecutor = cron.NewSSHExecutor(opts.SSHKey, opts.SSHKnownHosts)
+
+	secretProviders := map[string]secrets.Provider{
+		"aws-sm": secrets.NewAWSSecretsManager(opts.AWSRegion),
+	}
+	if opts.VaultAddr != "" {
+		vault := secrets.NewVault(opts.VaultAddr, opts.VaultToken, opts.VaultTokenFile)
+		secretProviders["vault"] = vault
+
+		go vault.KeepTokenAlive(s.ctx, s.logrusLogger.WithField("component", "vault"))
+
+		s.logger.Infof("CRONIC: Resolving secrets with Vault at %s", opts.VaultAddr)
+	}
+	cronOpts.Secrets = secrets.NewResolver(secretProviders, s.logrusLogger.WithField("component", "secrets"))
+
+	if opts.Passthrough {
+		cronOpts.Passthrough = cron.NewPassthrough(os.Stdout, os.Stderr, opts.PassthroughPrefix)
+	}
+
+	if opts.Syslog != "" {
+		facility, tag := opts.SyslogFacility, opts.SyslogTag
+		if facility == "" {
+			facility = "cron"
+		}
+		if tag == "" {
+			tag = "cronic"
+		}
+
+		cronOpts.Syslog, err = cron.NewSyslog(opts.Syslog, facility, tag)
+		if err != nil {
+			return err
+		}
+		s.closers = append(s.closers, cronOpts.Syslog.Close)
+
+		s.logger.Infof("CRONIC: Sending jobs' messages to syslog (%s)", opts.Syslog)
+	}
+
+	if opts.Journald {
+		cronOpts.Journal, err = cron.NewJournal()
+		if err != nil {
+			return err
+		}
+		s.closers = append(s.closers, cronOpts.Journal.Close)
+
+		s.logger.Infof("CRONIC: Sending jobs' messages to the journal")
+	}
+
+	if opts.GELFAddr != "" {
+		cronOpts.GELF, err = cron.NewGELF(opts.GELFAddr, s.logger.WithField("component", "gelf"))
+		if err != nil {
+			return err
+		}
+		s.closers = append(s.closers, cronOpts.GELF.Close)
+
+		s.logger.Infof("CRONIC: Sending jobs' messages to Graylog at %s", opts.GELFAddr)
+	}
+
+	if opts.LokiURL != "" {
+		cronOpts.Loki, err = cron.NewLoki(opts.LokiURL, s.logger.WithField("component", "loki"))
+		if err != nil {
+			return err
+		}
+		s.closers = append(s.closers, cronOpts.Loki.Close)
+
+		s.logger.Infof("CRONIC: Pushing jobs' messages to Loki at %s", opts.LokiURL)
+	}
+
+	if opts.EventSocket != "" {
+		cronOpts.EventStream, err = cron.NewEventStream(opts.EventSocket, s.logger.WithField("component", "events"))
+		if err != nil {
+			return err
+		}
+		s.closers = append(s.closers, cronOpts.EventStream.Close)
+
+		s.logger.Infof("CRONIC: Streaming jobs' events to %s", opts.EventSocket)
+	}
+
+	cronOpts.Clock = cron.StartClockWatcher(s.ctx, s.logger.WithField("component", "clock"))
+	cronOpts.Timers = cron.NewTimerQueue(cronOpts.Clock)
+
+	if opts.MaxConcurrentRuns > 0 {
+		cronOpts.Workers = cron.NewWorkerPool(opts.MaxConcurrentRuns)
+	}
+
+	if opts.Holidays != "" {
+		cronOpts.Holidays, err = crontab.ReadHolidays(opts.Holidays)
+		if err != nil {
+			return err
+		}
+
+		s.logger.Infof("CRONIC: Read %d holidays from %s", cronOpts.Holidays.Len(), opts.Holidays)
+	}
+
+	// Always set, so that it can be changed with the API
+	var blackout crontab.Blackout
+	if opts.Blackout != "" {
+		blackout, err = crontab.ParseBlackout(opts.Blackout)
+		if err != nil {
+			return fmt.Errorf("CRONIC: Bad -blackout: %v", err)
+		}
+	}
+	cronOpts.Blackout = cron.NewGlobalBlackout(blackout)
+
+	if opts.ArchiveDir != "" {
+		archive, err := cron.NewArchive(opts.ArchiveDir)
+		if err != nil {
+			return err
+		}
+
+		if opts.ArchiveCompression != "" {
+			archive.Compression, err = cron.ParseCompression(opts.ArchiveCompression)
+			if err != nil {
+				return err
+			}
+		}
+		archive.CompressMinSize = opts.ArchiveCompressMinSize
+
+		s.logger.Infof("CRONIC: Archiving output to %s", opts.ArchiveDir)
+		cronOpts.Archive = archive
+	}
+
+	if err := s.openState(opts); err != nil {
+		return err
+	}
+
+	// Unlike the notifiers, metrics aren't reloaded (though they get the
+	// labels of the notifier configuration).
+	telemetryConfig, err := telemetry.ConfigFromEnv(os.Getenv)
+	if err != nil {
+		return err
+	}
+
+	if telemetryConfig != nil {
+		exporter := telemetry.NewExporter(telemetryConfig, s.logrusLogger.WithField("component", "telemetry"))
+
+		s.logger.Infof("CRONIC: Exporting traces and metrics over OTLP")
+		s.staticNotifiers = append(s.staticNotifiers, exporter)
+		cronOpts.PropagateTraceContext = true
+	}
+
+	if opts.StatsDAddr != "" {
+		statsd, err := telemetry.NewStatsD(opts.StatsDAddr, opts.StatsDPrefix, s.logrusLogger.WithField("component", "statsd"))
+		if err != nil {
+			return err
+		}
+
+		s.logger.Infof("CRONIC: Sending metrics to StatsD at %s", opts.StatsDAddr)
+		s.staticNotifiers = append(s.staticNotifiers, statsd)
+	}
+
+	s.notifiers = notify.NewGroup()
+	s.closers = append(s.closers, s.notifiers.Close)
+
+	cronOpts.Notifiers = []cron.Notifier{s.notifiers}
+	if cronOpts.EventStream != nil {
+		cronOpts.Notifiers = append(cronOpts.Notifiers, cronOpts.EventStream)
+	}
+
+	if opts.FailFast {
+		failFast := cron.NewFailFast()
+		cronOpts.Notifiers = append(cronOpts.Notifiers, failFast)
+		s.failed = make(chan struct{})
+		go s.failFast(failFast.Failures())
+	}
+
+	if opts.OnRun != nil {
+		cronOpts.Notifiers = append(cronOpts.Notifiers, runNotifier(opts.OnRun))
+	}
+
+	if err := s.loadNotifiers(); err != nil {
+		return err
+	}
+
+	if opts.Namespaces != "" {
+		file, err := os.Open(opts.Namespaces)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		cronOpts.Namespaces, err = cron.ParseNamespaces(file)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// openState opens the stores the results of runs are recorded in, if any.
+func (s *Scheduler) openState(opts *Options) error {
+	var err error
+
+	stateStore := opts.StateStore
+	if opts.StateFile != "" && stateStore != "" {
+		return fmt.Errorf("CRONIC: Bad -state-file: -state-store is set too")
+	}
+
+	if opts.HistoryDB != "" {
+		if opts.StateFile != "" || stateStore != "" {
+			return fmt.Errorf("CRONIC: Bad -history-db: -state-file or -state-store is set too")
+		}
+
+		path, err := filepath.Abs(opts.HistoryDB)
+		if err != nil {
+			return fmt.Errorf("CRONIC: Bad -history-db: %v", err)
+		}
+		stateStore = (&url.URL{Scheme: "sqlite", Path: path}).String()
+	}
+
+	var store cron.StateStore
+	defer func() {
+		s.cron.State = store
+		if store != nil {
+			s.closers = append(s.closers, func() { store.Close() })
+		}
+	}()
+
+	if opts.StateFile != "" {
+		store, err = state.NewFile(opts.StateFile)
+		if err != nil {
+			return err
+		}
+
+		s.logger.Infof("CRONIC: Keeping the last results of jobs in %s", opts.StateFile)
+	}
+
+	instance := opts.StateInstance
+	if instance == "" && (stateStore != "" || opts.HistoryExport != "") {
+		instance, err = os.Hostname()
+		if err != nil {
+			return err
+		}
+	}
+
+	if stateStore != "" {
+		store, err = state.Open(stateStore, instance)
+		if err != nil {
+			return err
+		}
+
+		s.logger.Infof("CRONIC: Recording runs in %s, as %s", stateStore, instance)
+	}
+
+	if opts.HistoryRetention != 0 {
+		sql, ok := store.(*state.SQL)
+		if !ok {
+			return fmt.Errorf("CRONIC: Bad -history-retention: needs -history-db, or an SQL -state-store")
+		}
+
+		s.logger.Infof("CRONIC: Deleting runs %v after they finish", opts.HistoryRetention)
+		sql.Retention = opts.HistoryRetention
+	}
+
+	if opts.HistoryExport != "" {
+		u, err := url.Parse(opts.HistoryExport)
+		if err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql" && u.Scheme != "mysql") {
+			return fmt.Errorf("CRONIC: Bad -history-export: expected a postgres:// or mysql:// URL")
+		}
+
+		export, err := state.Open(opts.HistoryExport, instance)
+		if err != nil {
+			return err
+		}
+
+		// The URL's password isn't logged
+		s.logger.Infof("CRONIC: Exporting runs to %s://%s%s, as %s", u.Scheme, u.Host, u.Path, instance)
+		if store == nil {
+			store = export
+		} else {
+			store = state.NewExport(store, export)
+		}
+	}
+
+	return nil
+}
+
+// failFast stops the runs in progress once one of failures arrives (see
+// Options.FailFast), and closes s.failed.
+func (s *Scheduler) failFast(failures <-chan *cron.Event) {
+	select {
+	case event := <-failures:
+		cron.JobLogger(s.logger, event.Job).WithField("run.id", event.RunID).Error("CRONIC: Job failed, stopping running jobs and shutting down (-fail-fast)")
+		s.StopRuns()
+		close(s.failed)
+	case <-s.ctx.Done():
+	}
+}
@@ -0,0 +1,674 @@
+// Package scheduler embeds cronic in Go programs: it schedules and runs jobs
+// like cronic does (with their annotations, retries, locks, notifiers, and so
+// on), whether they come from a crontab or are defined in Go:
+//
+//	s, err := scheduler.New(scheduler.Options{
+//		Environ: map[string]string{"BUCKET": "s3://backups"},
+//		OnRun: func(job *scheduler.Job, result *scheduler.RunResult) {
+//			if !result.Success {
+//				log.Printf("%s failed: %s", job.Name, result.Error)
+//			}
+//		},
+//	})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//
+//	err = s.Add(&scheduler.Job{
+//		Name:        "backup",
+//		Schedule:    "0 3 * * *",
+//		Command:     "./backup.sh",
+//		Annotations: map[string]string{"timeout": "1h"},
+//	})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//
+//	if err := s.Start(); err != nil {
+//		log.Fatal(err)
+//	}
+//	defer s.Stop()
+//
+// Options has the settings of the cronic command's flags, and the scheduled
+// jobs can be observed and controlled while they run through their JobStatus
+// (e.g. to trigger, pause or cancel them). The cronic command is a Scheduler
+// too.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/samgaw/cronic/cron"
+	"github.com/samgaw/cronic/crontab"
+	"github.com/samgaw/cronic/notify"
+	"github.com/samgaw/cronic/watch"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	MANAGED_CRONTAB_HEADER = "Managed by cronic: changes to this file are overwritten when jobs are\nchanged via the API. Jobs use the environment of the main crontab."
+
+	// How many of the busiest minutes to warn about (see
+	// Options.HotSpotThreshold)
+	MAX_HOT_SPOT_WARNINGS = 5
+)
+
+// Scheduler schedules jobs, and runs them.
+type Scheduler struct {
+	opts     Options
+	cron     *cron.Options
+	cronCtx  *crontab.Context
+	logger   *cron.Logger
+	registry *cron.Registry
+
+	// What the packages that log with logrus (e.g. notify) log with
+	logrusLogger *logrus.Entry
+
+	jobFilter        *cron.JobFilter
+	shard            *cron.Shard
+	onMissingCommand string
+	onShutdown       string
+
+	notifiers       *notify.Group
+	staticNotifiers []cron.Notifier
+
+	// The crontab (or configuration file) the jobs were loaded from, if any
+	// (see Load)
+	path   string
+	config bool
+
+	// ctx is done once the scheduler stops, and runs once the runs in
+	// progress are to stop (see StopRuns)
+	ctx      context.Context
+	cancel   context.CancelFunc
+	runs     context.Context
+	stopRuns context.CancelFunc
+
+	// Stops the self-check, which wg waits for
+	stopSelfCheck context.CancelFunc
+	wg            sync.WaitGroup
+
+	// Closed once a run fails, with Options.FailFast
+	failed chan struct{}
+
+	// Release what the scheduler opened, in reverse order
+	closers []func()
+}
+
+// New creates a scheduler with no jobs.
+func New(opts Options) (*Scheduler, error) {
+	if err := opts.Parse.check(); err != nil {
+		return nil, err
+	}
+
+	s := &Scheduler{
+		opts:          opts,
+		logger:        cron.NewLogger(cronHandler(opts.Logger)),
+		logrusLogger:  logrusEntry(opts.Logger),
+		stopSelfCheck: func() {},
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.runs, s.stopRuns = context.WithCancel(context.Background())
+
+	s.cronCtx = &crontab.Context{
+		Shell:   opts.Shell,
+		Environ: make(map[string]string, len(opts.Environ)),
+		Home:    opts.Dir,
+	}
+	if s.cronCtx.Shell == "" {
+		s.cronCtx.Shell = "/bin/sh"
+	}
+	for k, v := range opts.Environ {
+		s.cronCtx.Environ[k] = v
+	}
+
+	if err := s.configure(&s.opts); err != nil {
+		s.close()
+		return nil, err
+	}
+
+	var persist cron.PersistFunc
+	if opts.ManagedCrontab != "" {
+		persist = func(jobs []*crontab.Job) error {
+			return s.managedParser().WriteCrontab(opts.ManagedCrontab, MANAGED_CRONTAB_HEADER, jobs)
+		}
+	}
+
+	s.registry = cron.NewRegistry(s.cronCtx, s.cron, s.logger, persist)
+	return s, nil
+}
+
+// Load creates a scheduler for the jobs of the crontab at path, which share
+// its variables (in addition to those of opts). Jobs disabled by their if-env
+// or unless-env annotations are left out, and so are those Options.Only,
+// Options.Exclude and Options.Shard leave out.
+func Load(path string, opts Options) (*Scheduler, error) {
+	return load(path, false, opts)
+}
+
+// LoadConfig creates a scheduler for the jobs of the YAML configuration file
+// at path (see -config), like Load.
+func LoadConfig(path string, opts Options) (*Scheduler, error) {
+	return load(path, true, opts)
+}
+
+func load(path string, config bool, opts Options) (*Scheduler, error) {
+	if err := opts.Parse.check(); err != nil {
+		return nil, err
+	}
+
+	// The parser's messages (e.g. about skipped lines) go to opts.Logger
+	// too
+	parser := opts.Parse.parser(opts.Logger)
+
+	if config {
+		parser.Logger.Infof("CRONIC: Read configuration %s", path)
+	} else {
+		parser.Logger.Infof("CRONIC: Read crontab %s", path)
+	}
+
+	tab, err := readCrontabAtPath(parser, path, config)
+	if err != nil {
+		return nil, err
+	}
+
+	environ := make(map[string]string, len(opts.Environ)+len(tab.Context.Environ))
+	for k, v := range opts.Environ {
+		environ[k] = v
+	}
+	for k, v := range tab.Context.Environ {
+		environ[k] = v
+	}
+	opts.Environ = environ
+	opts.Shell = tab.Context.Shell
+	if tab.Context.Home != "" {
+		opts.Dir = tab.Context.Home
+	}
+
+	s, err := New(opts)
+	if err != nil {
+		return nil, err
+	}
+	s.path, s.config = path, config
+
+	if err := s.addCrontab(tab); err != nil {
+		s.close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// addCrontab adds the jobs of tab that run, once they're filtered.
+func (s *Scheduler) addCrontab(tab *crontab.Crontab) error {
+	total := s.filter(tab)
+	if s.jobFilter != nil || s.shard != nil {
+		if s.shard != nil {
+			s.logger.Infof("CRONIC: Running %d of the crontab's %d jobs, as shard %s", len(tab.Jobs), total, s.shard)
+		} else {
+			s.logger.Infof("CRONIC: Running %d of the crontab's %d jobs", len(tab.Jobs), total)
+		}
+	}
+
+	if err := tab.CheckDependencies(); err != nil {
+		return err
+	}
+
+	for _, job := range tab.Jobs {
+		if err := s.add(job, false); err != nil {
+			return fmt.Errorf("%v (job at %s:%d)", err, job.File, job.Line)
+		}
+	}
+
+	s.crontabParsed(tab)
+	return nil
+}
+
+// filter removes the jobs of tab that don't run: those that their if-env or
+// unless-env annotations disable (which it logs), and those Options.Only,
+// Options.Exclude and Options.Shard leave out. It returns how many jobs
+// would run without the latter.
+func (s *Scheduler) filter(tab *crontab.Crontab) int {
+	for _, job := range tab.RemoveDisabled() {
+		fields := cron.Fields{}
+		for _, key := range []string{"if-env", "unless-env"} {
+			if value, ok := job.Annotations[key]; ok {
+				fields[key] = value
+			}
+		}
+		cron.JobLogger(s.logger, job).WithFields(fields).Info("CRONIC: Job is disabled by its if-env or unless-env annotation")
+	}
+
+	total := len(tab.Jobs)
+	s.jobFilter.Filter(tab)
+	s.shard.Filter(tab)
+	return total
+}
+
+// ParseJob parses a job written like in a crontab: its line, optionally
+// preceded by its annotations (e.g. "# cronic: timeout=1m\n*/5 * * * *
+// ./sync.sh"), like the zero ParseOptions do. What's wrong with bad jobs is
+// returned, rather than logged.
+func ParseJob(text string) (*Job, error) {
+	return parseJob(ParseOptions{}, text)
+}
+
+// ParseJob parses a job like the package's ParseJob, but with the
+// scheduler's Options.Parse (even if lenient, bad jobs are errors).
+func (s *Scheduler) ParseJob(text string) (*Job, error) {
+	return parseJob(s.opts.Parse, text)
+}
+
+func parseJob(opts ParseOptions, text string) (*Job, error) {
+	opts.Lenient = false
+
+	// The parser has nothing to say about the job that isn't an error
+	tab, err := opts.parser(discardLogger{}).ParseCrontab(strings.NewReader(text), "")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tab.Jobs) != 1 {
+		return nil, fmt.Errorf("CRONIC: Bad job: expected 1 job, got %d", len(tab.Jobs))
+	}
+	return newJob(tab.Jobs[0]), nil
+}
+
+// Add schedules job (once the scheduler is started, or right away if it is).
+// The job can't be changed at runtime, like the jobs of a crontab.
+func (s *Scheduler) Add(job *Job) error {
+	return s.addJob(job, false)
+}
+
+// AddManaged schedules job like Add, but as a managed job, which can be
+// changed at runtime if Options.ManagedCrontab is set (and is then saved
+// to it). The jobs of Options.ManagedCrontab are added when the scheduler
+// starts.
+func (s *Scheduler) AddManaged(job *Job) error {
+	return s.addJob(job, true)
+}
+
+func (s *Scheduler) addJob(job *Job, managed bool) error {
+	// The schedule and command are taken as they are
+	parser := &crontab.Parser{ScheduleSyntax: s.opts.Parse.ScheduleSyntax, LiteralPercent: true}
+
+	crontabJob, err := parser.NewJob(job.Schedule, job.Command, job.Annotations)
+	if err != nil {
+		return err
+	}
+	crontabJob.Name = job.Name
+	crontabJob.Stdin = job.Stdin
+
+	return s.add(crontabJob, managed)
+}
+
+func (s *Scheduler) add(job *crontab.Job, managed bool) error {
+	if _, err := s.cron.Namespace(job); err != nil {
+		return fmt.Errorf("%v: %q", err, job.Namespace)
+	}
+
+	if job.Name != "" && s.registry.JobByName(job.Name) != nil {
+		return fmt.Errorf("%v: %q", ErrDuplicateName, job.Name)
+	}
+
+	s.registry.Add(job, managed)
+	return nil
+}
+
+// Start schedules the jobs, once it has added those of
+// Options.ManagedCrontab, and checked them (see Options.OnMissingCommand).
+func (s *Scheduler) Start() error {
+	return s.StartContext(context.Background())
+}
+
+// StartContext schedules the jobs like Start, until ctx is done, which also
+// stops the runs in progress (along with the processes they started).
+func (s *Scheduler) StartContext(ctx context.Context) error {
+	if err := s.addManaged(); err != nil {
+		return err
+	}
+
+	jobs := make([]*crontab.Job, 0)
+	for _, status := range s.registry.Jobs() {
+		jobs = append(jobs, status.Job)
+	}
+
+	if s.cron.Holidays == nil {
+		for _, job := range jobs {
+			if job.SkipHolidays {
+				cron.JobLogger(s.logger, job).Warn("CRONIC: Job has a skip-holidays annotation, but there are no holidays (see -holidays)")
+			}
+		}
+	}
+
+	if s.opts.HotSpotThreshold > 0 {
+		s.warnAboutHotSpots(crontab.HotSpots(jobs, time.Now(), 24*time.Hour, s.opts.HotSpotThreshold))
+	}
+
+	if s.onMissingCommand != cron.MissingCommandIgnore {
+		if err := s.checkCommands(jobs); err != nil {
+			return err
+		}
+	}
+
+	var watcher *watch.Watcher
+	if s.opts.Watch {
+		if s.path == "" {
+			return fmt.Errorf("CRONIC: Bad -watch: the jobs weren't loaded from a crontab")
+		}
+
+		var err error
+		watcher, err = watch.New(s.path)
+		if err != nil {
+			return fmt.Errorf("CRONIC: Bad -watch: %v", err)
+		}
+	}
+
+	// As PID 1 (e.g. in a container), cronic inherits orphaned processes,
+	// which nobody else would reap
+	if os.Getpid() == 1 {
+		s.logger.Info("CRONIC: Running as PID 1, reaping orphaned processes")
+		cron.StartReaper(s.ctx, s.logger.WithField("component", "reaper"))
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.StopRuns()
+		case <-s.runs.Done():
+		}
+	}()
+
+	s.registry.StartContext(s.runs)
+
+	if s.opts.SelfCheckInterval > 0 {
+		var selfCheckCtx context.Context
+		selfCheckCtx, s.stopSelfCheck = context.WithCancel(s.ctx)
+
+		s.logger.Infof("CRONIC: Checking cronic itself every %v", s.opts.SelfCheckInterval)
+		cron.StartSelfCheck(selfCheckCtx, &s.wg, s.cronCtx, s.cron, s.opts.SelfCheckInterval, s.logger.WithField("component", "self-check"))
+	}
+
+	if watcher != nil {
+		s.logger.Infof("CRONIC: Watching %s for changes", s.path)
+		go watcher.Run(s.ctx, s.logrusLogger.WithField("component", "watch"), s.reload)
+	}
+
+	return nil
+}
+
+// addManaged adds the jobs of Options.ManagedCrontab, if it exists.
+func (s *Scheduler) addManaged() error {
+	if s.opts.ManagedCrontab == "" {
+		return nil
+	}
+
+	s.logger.Infof("CRONIC: Read managed crontab %s", s.opts.ManagedCrontab)
+
+	managed, err := readCrontabAtPath(s.managedParser(), s.opts.ManagedCrontab, false)
+	if os.IsNotExist(err) {
+		// It will be created when the first job is
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, job := range managed.Jobs {
+		if err := s.add(job, true); err != nil {
+			return fmt.Errorf("%v (managed job %d)", err, job.Position)
+		}
+	}
+	return nil
+}
+
+// managedParser returns the parser of Options.ManagedCrontab, which cronic
+// writes without user fields, whatever Options.Parse.Format is.
+func (s *Scheduler) managedParser() *crontab.Parser {
+	parser := s.opts.Parse.parser(s.opts.Logger)
+	parser.Format = crontab.FormatUser
+	return parser
+}
+
+// reload replaces the jobs with those of the new contents of the crontab
+// (see Options.Watch), unless they're invalid.
+func (s *Scheduler) reload(contents []byte) {
+	s.logger.Infof("CRONIC: %s changed, reloading jobs", s.path)
+
+	parser := s.opts.Parse.parser(s.opts.Logger)
+	parse := func(reader io.Reader) (*crontab.Crontab, error) {
+		return parser.ParseCrontab(reader, s.path)
+	}
+	if s.config {
+		parse = parser.ParseConfig
+	}
+
+	changed, err := parse(strings.NewReader(string(contents)))
+	if err == nil {
+		s.filter(changed)
+		err = changed.CheckDependencies()
+	}
+	if err == nil {
+		err = s.registry.Reload(changed)
+	}
+	if err == nil {
+		s.crontabParsed(changed)
+	}
+	if err != nil {
+		s.logger.Errorf("CRONIC: Failed to reload %s, keeping the current jobs: %v", s.path, err)
+	}
+}
+
+// crontabParsed tells the notifiers that report on the crontab that it was
+// (re)loaded.
+func (s *Scheduler) crontabParsed(tab *crontab.Crontab) {
+	for _, notifier := range s.staticNotifiers {
+		if monitor, ok := notifier.(cron.CrontabMonitor); ok {
+			monitor.CrontabParsed(tab)
+		}
+	}
+}
+
+// warnAboutHotSpots logs the busiest of the minutes when many jobs run at
+// once, which are usually only discovered when they overload something.
+func (s *Scheduler) warnAboutHotSpots(hotSpots []crontab.HotSpot) {
+	for i, hotSpot := range hotSpots {
+		if i == MAX_HOT_SPOT_WARNINGS {
+			s.logger.Warnf("CRONIC: %d more minutes have as many jobs running at once", len(hotSpots)-i)
+			return
+		}
+
+		jobs := make([]string, len(hotSpot.Jobs))
+		for j, job := range hotSpot.Jobs {
+			jobs[j] = job.Name
+			if jobs[j] == "" {
+				jobs[j] = fmt.Sprintf("job %d", job.Position)
+			}
+		}
+
+		s.logger.Warnf("CRONIC: %d jobs run at once at %s (%s): consider spreading them out, e.g. by moving some of them to other minutes", len(hotSpot.Jobs), hotSpot.Minute.Format("15:04"), strings.Join(jobs, ", "))
+	}
+}
+
+// checkCommands checks that the programs jobs start exist, and warns about
+// those that don't, or fails if Options.OnMissingCommand is
+// cron.MissingCommandFail.
+func (s *Scheduler) checkCommands(jobs []*crontab.Job) error {
+	missing := 0
+
+	for _, job := range jobs {
+		if err := cron.CheckCommand(s.cronCtx, s.cron, job); err != nil {
+			cron.JobLogger(s.logger, job).Warn(err)
+			missing++
+		}
+	}
+
+	if missing > 0 && s.onMissingCommand == cron.MissingCommandFail {
+		return fmt.Errorf("CRONIC: The commands of %d jobs weren't found (see -on-missing-command)", missing)
+	}
+	return nil
+}
+
+// StopRuns stops the runs in progress (along with the processes they
+// started), e.g. while Stop waits for them.
+func (s *Scheduler) StopRuns() {
+	s.stopRuns()
+}
+
+// Stop stops scheduling the jobs, and waits for runs in progress to finish
+// (once Options.OnShutdown is applied to them), before closing what the
+// scheduler opened (e.g. its state store).
+func (s *Scheduler) Stop() {
+	cron.StopRunsOnShutdown(s.registry, s.onShutdown, s.StopRuns, s.logger)
+
+	s.logger.Info("CRONIC: Waiting for jobs to finish")
+
+	s.stopSelfCheck()
+	s.registry.Shutdown()
+	s.wg.Wait()
+
+	s.close()
+}
+
+// close stops what runs in the background, and closes what the scheduler
+// opened.
+func (s *Scheduler) close() {
+	s.cancel()
+	s.stopRuns()
+
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		s.closers[i]()
+	}
+	s.closers = nil
+}
+
+// Failed returns a channel that's closed once a run fails, with
+// Options.FailFast (and so never without it). The runs in progress are
+// stopped by then.
+func (s *Scheduler) Failed() <-chan struct{} {
+	return s.failed
+}
+
+// WaitOneShots waits until the jobs that run a single time (using @at or
+// @once) are done, and returns them, or nil if there are none. Call it once
+// the scheduler is started.
+func (s *Scheduler) WaitOneShots() []*JobStatus {
+	return newJobStatuses(s.registry.WaitOneShots())
+}
+
+// Drain stops all new runs, but lets runs in progress finish.
+func (s *Scheduler) Drain() {
+	s.registry.Drain()
+}
+
+// Pause stops the scheduled runs of all jobs until Resume is called. Jobs
+// keep their own paused state (see JobStatus.Pause).
+func (s *Scheduler) Pause() {
+	s.registry.Pause()
+}
+
+func (s *Scheduler) Resume() {
+	s.registry.Resume()
+}
+
+// Paused reports whether all jobs are paused (see Pause).
+func (s *Scheduler) Paused() bool {
+	return s.registry.Paused()
+}
+
+// Signal sends sig to the running jobs, or only to those with one of names
+// if it isn't empty, and returns how many it was sent to.
+func (s *Scheduler) Signal(sig syscall.Signal, names []string) int {
+	var only map[string]bool
+	if len(names) > 0 {
+		only = make(map[string]bool)
+		for _, name := range names {
+			only[strings.TrimSpace(name)] = true
+		}
+	}
+
+	signaled := 0
+	for _, status := range s.registry.Jobs() {
+		if only != nil && !only[status.Job.Name] {
+			continue
+		}
+
+		if err := status.Signal(sig); err == nil {
+			signaled++
+		} else if err != ErrNotRunning {
+			cron.JobLogger(s.logger, status.Job).Warnf("CRONIC: Failed to forward %s: %v", sig, err)
+		}
+	}
+
+	return signaled
+}
+
+// WriteReport writes a report of the jobs' status to w.
+func (s *Scheduler) WriteReport(w io.Writer) {
+	cron.WriteReport(w, s.registry.Jobs(), s.cron.State, time.Now())
+}
+
+// Jobs returns the status of the scheduled jobs, in position order.
+func (s *Scheduler) Jobs() []*JobStatus {
+	return newJobStatuses(s.registry.Jobs())
+}
+
+// Job returns the status of the job with this name, or nil if there's none.
+func (s *Scheduler) Job(name string) *JobStatus {
+	status := s.registry.JobByName(name)
+	if status == nil {
+		return nil
+	}
+	return &JobStatus{status: status}
+}
+
+// Trigger starts a run of the job with this name now, outside of its
+// schedule.
+func (s *Scheduler) Trigger(name string) error {
+	status := s.Job(name)
+	if status == nil {
+		return ErrNoSuchJob
+	}
+	return status.Trigger()
+}
+
+func newJobStatuses(statuses []*cron.JobStatus) []*JobStatus {
+	if statuses == nil {
+		return nil
+	}
+
+	wrapped := make([]*JobStatus, len(statuses))
+	for i, status := range statuses {
+		wrapped[i] = &JobStatus{status: status}
+	}
+	return wrapped
+}
+
+// runNotifier calls Options.OnRun once runs are done.
+type runNotifier func(job *Job, result *RunResult)
+
+func (f runNotifier) Notify(event *cron.Event) {
+	if event.Result != nil {
+		f(newJob(event.Job), newRunResult(event.Result))
+	}
+}
+
+func readCrontabAtPath(parser *crontab.Parser, path string, config bool) (*crontab.Crontab, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	if config {
+		return parser.ParseConfig(file)
+	}
+	return parser.ParseCrontab(file, path)
+}
@@ -0,0 +1,205 @@
+package scheduler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestLogger() Logger {
+	return LoggerFunc(func(*LogEntry) {})
+}
+
+func TestSchedulerRunsJobs(t *testing.T) {
+	results := make(chan *RunResult, 1)
+
+	s, err := New(Options{
+		Environ: map[string]string{"GREETING": "hello"},
+		Logger:  newTestLogger(),
+		OnRun: func(job *Job, result *RunResult) {
+			if job.Name == "greet" {
+				results <- result
+			}
+		},
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	job, err := ParseJob("# name: greet\n@once test \"$GREETING\" = hello")
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Nil(t, s.Add(job))
+	assert.Equal(t, ErrDuplicateName.Error()+`: "greet"`, s.Add(&Job{Name: "greet", Schedule: "@once", Command: "true"}).Error())
+
+	assert.Nil(t, s.Start())
+	defer s.Stop()
+
+	select {
+	case result := <-results:
+		assert.True(t, result.Success, result.Error)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the job didn't run")
+	}
+
+	assert.Len(t, s.Jobs(), 1)
+	if status := s.Job("greet"); assert.NotNil(t, status) {
+		assert.Equal(t, "@once", status.Job().Schedule)
+		assert.True(t, status.LastResult().Success)
+	}
+	assert.Nil(t, s.Job("nope"))
+	assert.Equal(t, ErrNoSuchJob, s.Trigger("nope"))
+}
+
+func TestAddChecksJobs(t *testing.T) {
+	s, err := New(Options{Logger: newTestLogger()})
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer s.Stop()
+
+	assert.EqualError(t, s.Add(&Job{Schedule: "*/5 * * * *"}), "CRONIC: Command is required")
+	assert.NotNil(t, s.Add(&Job{Schedule: "*/5 * * *", Command: "./sync.sh"}))
+	assert.NotNil(t, s.Add(&Job{Schedule: "*/5 * * * *", Command: "./sync.sh", Annotations: map[string]string{"timeout": "soon"}}))
+
+	// The command is taken as it is, % included
+	assert.Nil(t, s.Add(&Job{Schedule: "*/5 * * * *", Command: "./report-100%", Stdin: "hello", Annotations: map[string]string{"timeout": "1m"}}))
+	if assert.Len(t, s.Jobs(), 1) {
+		job := s.Jobs()[0].Job()
+		assert.Equal(t, "./report-100%", job.Command)
+		assert.Equal(t, "hello", job.Stdin)
+		assert.Equal(t, map[string]string{"timeout": "1m"}, job.Annotations)
+	}
+}
+
+func TestNewChecksOptions(t *testing.T) {
+	for _, opts := range []Options{
+		{Parse: ParseOptions{ScheduleSyntax: "nope"}},
+		{Parse: ParseOptions{Format: "nope"}},
+		{OnShutdown: "nope"},
+		{OnMissingCommand: "nope"},
+		{LongLines: "nope"},
+		{Shard: "3/3"},
+		{Blackout: "someday"},
+		{ContainerExecutor: "nope"},
+		{ManagedCrontab: "managed.crontab"},
+		{StateFile: "state.json", StateStore: "sqlite:///state.db"},
+	} {
+		opts.Logger = newTestLogger()
+		_, err := New(opts)
+		assert.NotNil(t, err, "%+v", opts)
+	}
+}
+
+func TestStartAddsManagedJobs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cronic-scheduler")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "managed.crontab")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("# name: sync\n*/5 * * * * ./sync.sh\n"), 0644))
+
+	s, err := New(Options{ManagedCrontab: path, APIToken: "secret", Logger: newTestLogger()})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Nil(t, s.Add(&Job{Name: "backup", Schedule: "0 3 * * *", Command: "./backup.sh"}))
+
+	assert.Nil(t, s.Start())
+	defer s.Stop()
+
+	if assert.Len(t, s.Jobs(), 2) {
+		assert.False(t, s.Jobs()[0].Managed())
+		assert.True(t, s.Jobs()[1].Managed())
+		assert.Equal(t, "sync", s.Jobs()[1].Job().Name)
+	}
+}
+
+func TestStartChecksCommands(t *testing.T) {
+	s, err := New(Options{OnMissingCommand: "fail", Logger: newTestLogger()})
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer s.Stop()
+
+	assert.Nil(t, s.Add(&Job{Schedule: "@once", Command: "/nonexistent/cronic-test"}))
+	assert.EqualError(t, s.Start(), "CRONIC: The commands of 1 jobs weren't found (see -on-missing-command)")
+}
+
+func TestLoadReadsCrontabs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cronic-scheduler")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "crontab")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("SHELL=/bin/bash\n*/5 * * * * ./sync.sh\n# cronic: if-env=ROLE=worker\n@hourly ./work.sh\n# name: backup\n0 3 * * * ./backup.sh\n"), 0644))
+
+	s, err := Load(path, Options{Environ: map[string]string{"ROLE": "web"}, Logger: newTestLogger()})
+	if assert.Nil(t, err) {
+		assert.Len(t, s.Jobs(), 2)
+		assert.Equal(t, "./backup.sh", s.Jobs()[1].Job().Command)
+		s.Stop()
+	}
+
+	s, err = Load(path, Options{Only: "backup", Logger: newTestLogger()})
+	if assert.Nil(t, err) {
+		assert.Len(t, s.Jobs(), 1)
+		s.Stop()
+	}
+
+	_, err = Load(filepath.Join(dir, "nope"), Options{})
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestParseJob(t *testing.T) {
+	job, err := ParseJob("# name: sync\n# cronic: timeout=1m\n*/5 * * * * ./sync.sh%hello")
+	if assert.Nil(t, err) {
+		assert.Equal(t, &Job{
+			Name:        "sync",
+			Schedule:    "*/5 * * * *",
+			Command:     "./sync.sh",
+			Annotations: map[string]string{"timeout": "1m"},
+			Stdin:       "hello\n",
+		}, job)
+	}
+
+	_, err = ParseJob("*/5 * * * * ./sync.sh\n0 3 * * * ./backup.sh")
+	assert.EqualError(t, err, "CRONIC: Bad job: expected 1 job, got 2")
+
+	_, err = ParseJob("FOO=bar")
+	assert.NotNil(t, err)
+
+}
+
+func TestParseJobReturnsParserErrors(t *testing.T) {
+	_, err := ParseJob("# cronic: timeout=soon\n*/5 * * * * ./sync.sh")
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "CRONIC: Bad annotation for crontab line: */5 * * * * ./sync.sh")
+		assert.Contains(t, err.Error(), `annotation "timeout"`)
+	}
+
+	// Even if the scheduler's crontabs are parsed leniently
+	s, err := New(Options{Parse: ParseOptions{Lenient: true, ScheduleSyntax: "systemd"}, Logger: newTestLogger()})
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer s.Stop()
+
+	_, err = s.ParseJob("*-*-* 25:00 ./sync.sh")
+	assert.NotNil(t, err)
+
+	job, err := s.ParseJob("*-*-* 02:00 ./sync.sh")
+	if assert.Nil(t, err) {
+		assert.Equal(t, "./sync.sh", job.Command)
+		assert.Nil(t, s.Add(job))
+	}
+}
@@ -0,0 +1,34 @@
+package scheduler
+
+import (
+	"net/http"
+
+	"github.com/samgaw/cronic/web"
+)
+
+// ServeDashboard serves the web dashboard (and its API) on addr (e.g. ":8080",
+// or "unix:/run/cronic.sock"), until the scheduler stops. Jobs can only be
+// controlled with Options.APIToken.
+func (s *Scheduler) ServeDashboard(addr string) error {
+	listener, err := web.Listen(addr)
+	if err != nil {
+		return err
+	}
+
+	handler := web.NewServer(s.registry, s.cron.Archive, s.cron.State, s.opts.APIToken, s.logrusLogger.WithField("component", "web"))
+	handler.Parser = s.managedParser()
+
+	server := &http.Server{
+		Handler: handler,
+	}
+
+	go func() {
+		s.logger.Infof("CRONIC: Serving dashboard on %s", addr)
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			s.logger.Errorf("CRONIC: Failed to serve the dashboard: %v", err)
+		}
+	}()
+
+	s.closers = append(s.closers, func() { server.Close() })
+	return nil
+}
@@ -0,0 +1,282 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	AWS_TIMEOUT = 10 * time.Second
+
+	// Where to get the credentials of the instance's role, when they
+	// aren't in the environment
+	AWS_METADATA_URL = "http://169.254.169.254"
+)
+
+// AWSSecretsManager fetches secrets from AWS Secrets Manager, with the
+// credentials in cronic's environment (AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN), or else those of the EC2
+// instance's role.
+type AWSSecretsManager struct {
+	Region string
+
+	// The Secrets Manager endpoint (the region's if empty)
+	URL string
+
+	client *http.Client
+
+	mu          sync.Mutex
+	credentials *awsCredentials
+}
+
+type awsCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	Token           string
+	Expiration      time.Time
+}
+
+func NewAWSSecretsManager(region string) *AWSSecretsManager {
+	return &AWSSecretsManager{
+		Region: region,
+		client: &http.Client{Timeout: AWS_TIMEOUT},
+	}
+}
+
+func (a *AWSSecretsManager) Fetch(ctx context.Context, path string) (*Secret, error) {
+	if a.Region == "" {
+		return nil, fmt.Errorf("no AWS region (see -aws-region)")
+	}
+
+	endpoint := a.URL
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://secretsmanager.%s.amazonaws.com/", a.Region)
+	}
+
+	credentials, err := a.getCredentials(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("no AWS credentials: %v", err)
+	}
+
+	body, err := json.Marshal(map[string]string{"SecretId": path})
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	request.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	signAWSRequest(request, body, credentials, a.Region, "secretsmanager", time.Now())
+
+	response, err := a.client.Do(request.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	contents, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		var awsError struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(contents, &awsError) == nil && awsError.Type != "" {
+			return nil, fmt.Errorf("Secrets Manager responded with status %d: %s: %s", response.StatusCode, awsError.Type, awsError.Message)
+		}
+		return nil, fmt.Errorf("Secrets Manager responded with status %d", response.StatusCode)
+	}
+
+	var value struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := json.Unmarshal(contents, &value); err != nil {
+		return nil, fmt.Errorf("bad response from Secrets Manager: %v", err)
+	}
+
+	secret := &Secret{Value: value.SecretString}
+
+	// Secrets with several values are usually JSON objects (e.g. those of
+	// RDS databases)
+	var fields map[string]interface{}
+	if json.Unmarshal([]byte(value.SecretString), &fields) == nil {
+		secret.Fields = make(map[string]string, len(fields))
+		for key, field := range fields {
+			if s, ok := field.(string); ok {
+				secret.Fields[key] = s
+			} else if encoded, err := json.Marshal(field); err == nil {
+				secret.Fields[key] = string(encoded)
+			}
+		}
+	}
+
+	return secret, nil
+}
+
+// getCredentials returns the credentials in the environment, or those of the
+// instance's role (which are cached until shortly before they expire).
+func (a *AWSSecretsManager) getCredentials(ctx context.Context) (*awsCredentials, error) {
+	if id := os.Getenv("AWS_ACCESS_KEY_ID"); id != "" {
+		return &awsCredentials{
+			AccessKeyID:     id,
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			Token:           os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.credentials != nil && time.Now().Add(5*time.Minute).Before(a.credentials.Expiration) {
+		return a.credentials, nil
+	}
+
+	credentials, err := a.instanceCredentials(ctx)
+	if err != nil {
+		return nil, err
+	}
+	a.credentials = credentials
+	return credentials, nil
+}
+
+// instanceCredentials gets the credentials of the instance's role from its
+// metadata service (with IMDSv2).
+func (a *AWSSecretsManager) instanceCredentials(ctx context.Context) (*awsCredentials, error) {
+	request, err := http.NewRequest(http.MethodPut, AWS_METADATA_URL+"/latest/api/token", nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+
+	token, err := a.getMetadata(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	get := func(path string) ([]byte, error) {
+		request, err := http.NewRequest(http.MethodGet, AWS_METADATA_URL+"/latest/meta-data/iam/security-credentials/"+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("X-aws-ec2-metadata-token", string(token))
+		return a.getMetadata(ctx, request)
+	}
+
+	role, err := get("")
+	if err != nil {
+		return nil, err
+	}
+
+	contents, err := get(strings.TrimSpace(strings.SplitN(string(role), "\n", 2)[0]))
+	if err != nil {
+		return nil, err
+	}
+
+	var credentials awsCredentials
+	if err := json.Unmarshal(contents, &credentials); err != nil {
+		return nil, fmt.Errorf("bad instance credentials: %v", err)
+	}
+	return &credentials, nil
+}
+
+func (a *AWSSecretsManager) getMetadata(ctx context.Context, request *http.Request) ([]byte, error) {
+	response, err := a.client.Do(request.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("the instance metadata service responded with status %d", response.StatusCode)
+	}
+	return ioutil.ReadAll(response.Body)
+}
+
+// signAWSRequest signs request (whose body is body) with AWS' Signature
+// Version 4.
+func signAWSRequest(request *http.Request, body []byte, credentials *awsCredentials, region string, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	request.Header.Set("X-Amz-Date", amzDate)
+	if credentials.Token != "" {
+		request.Header.Set("X-Amz-Security-Token", credentials.Token)
+	}
+
+	headers := map[string]string{"host": request.URL.Host}
+	for name, values := range request.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := request.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		path,
+		canonicalQuery(request.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hexSHA256(body),
+	}, "\n")
+
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hexSHA256([]byte(canonicalRequest))}, "\n")
+
+	key := []byte("AWS4" + credentials.SecretAccessKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", credentials.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func canonicalQuery(query url.Values) string {
+	// Encode escapes spaces as +, where AWS expects %20
+	return strings.Replace(query.Encode(), "+", "%20", -1)
+}
+
+func hexSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
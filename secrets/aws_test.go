@@ -0,0 +1,78 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignAWSRequest(t *testing.T) {
+	// The example of AWS' documentation
+	request, _ := http.NewRequest(http.MethodGet, "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+
+	credentials := &awsCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	signAWSRequest(request, nil, credentials, "us-east-1", "iam", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	assert.Equal(t, "20150830T123600Z", request.Header.Get("X-Amz-Date"))
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7", request.Header.Get("Authorization"))
+}
+
+func TestAWSSecretsManagerFetchesSecrets(t *testing.T) {
+	os.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	os.Setenv("AWS_SESSION_TOKEN", "session")
+	defer os.Unsetenv("AWS_ACCESS_KEY_ID")
+	defer os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+	defer os.Unsetenv("AWS_SESSION_TOKEN")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secretsmanager.GetSecretValue", r.Header.Get("X-Amz-Target"))
+		assert.Equal(t, "session", r.Header.Get("X-Amz-Security-Token"))
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/"))
+		assert.Contains(t, r.Header.Get("Authorization"), "/eu-west-1/secretsmanager/aws4_request")
+
+		body, _ := ioutil.ReadAll(r.Body)
+		var input map[string]string
+		json.Unmarshal(body, &input)
+
+		switch input["SecretId"] {
+		case "prod/db":
+			w.Write([]byte(`{"Name": "prod/db", "SecretString": "{\"username\": \"app\", \"port\": 5432}"}`))
+		case "prod/token":
+			w.Write([]byte(`{"Name": "prod/token", "SecretString": "hunter2"}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type": "ResourceNotFoundException", "message": "Secrets Manager can't find the specified secret."}`))
+		}
+	}))
+	defer server.Close()
+
+	provider := NewAWSSecretsManager("eu-west-1")
+	provider.URL = server.URL
+
+	secret, err := provider.Fetch(context.Background(), "prod/db")
+	if assert.Nil(t, err) {
+		assert.Equal(t, map[string]string{"username": "app", "port": "5432"}, secret.Fields)
+	}
+
+	secret, err = provider.Fetch(context.Background(), "prod/token")
+	if assert.Nil(t, err) {
+		assert.Equal(t, "hunter2", secret.Value)
+		assert.Nil(t, secret.Fields)
+	}
+
+	_, err = provider.Fetch(context.Background(), "nope")
+	assert.EqualError(t, err, "Secrets Manager responded with status 400: ResourceNotFoundException: Secrets Manager can't find the specified secret.")
+
+	_, err = NewAWSSecretsManager("").Fetch(context.Background(), "prod/db")
+	assert.EqualError(t, err, "no AWS region (see -aws-region)")
+}
@@ -0,0 +1,195 @@
+// Package secrets resolves the secrets that the values of jobs' environment
+// variables refer to, so that they don't have to live in the crontab or in
+// cronic's environment:
+//
+//	VAR=@/run/secrets/db-password          the contents of a file
+//	VAR=@vault:secret/data/app#password    a field of a Vault secret
+//	VAR=@aws-sm:prod/app#password          an AWS Secrets Manager secret (or
+//	                                       a field of its JSON)
+//
+// A value starting with @@ is used literally, less the first @. Other values
+// starting with @ (e.g. @midnight) aren't references, and are left as-is.
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// How long to cache the secrets of providers, unless the provider
+	// says otherwise (e.g. with a Vault lease)
+	SECRETS_CACHE_TTL = 5 * time.Minute
+
+	// How long past their expiry to keep using cached secrets when they
+	// can't be fetched again (e.g. because Vault is down)
+	SECRETS_MAX_STALE = time.Hour
+)
+
+// Secret is a secret fetched by a provider.
+type Secret struct {
+	// The secret, and its fields if it has some (e.g. those of a Vault
+	// secret, or of an AWS Secrets Manager secret that's a JSON object)
+	Value  string
+	Fields map[string]string
+
+	// How long the secret can be cached (0 for SECRETS_CACHE_TTL)
+	TTL time.Duration
+}
+
+// Provider fetches secrets from a secret manager.
+type Provider interface {
+	Fetch(ctx context.Context, path string) (*Secret, error)
+}
+
+type cachedSecret struct {
+	secret  *Secret
+	expires time.Time
+}
+
+// Resolver resolves references to secrets (see the package's
+// documentation), and implements cron.SecretResolver. Files are read each
+// time, so that they can be rotated, while the secrets of providers are
+// cached.
+type Resolver struct {
+	providers map[string]Provider
+	logger    *logrus.Entry
+	now       func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]*cachedSecret
+}
+
+// NewResolver returns a resolver of references to files, and to the secrets
+// of providers, by scheme (e.g. "vault").
+func NewResolver(providers map[string]Provider, logger *logrus.Entry) *Resolver {
+	return &Resolver{
+		providers: providers,
+		logger:    logger,
+		now:       time.Now,
+		cache:     make(map[string]*cachedSecret),
+	}
+}
+
+// The schemes of the known providers, with the flag that configures them, to
+// tell references to providers that aren't configured from values that
+// aren't references
+var schemes = map[string]string{
+	"vault":  "-vault-addr",
+	"aws-sm": "-aws-region",
+}
+
+func (r *Resolver) Resolve(ctx context.Context, value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, "@@"):
+		return value[1:], nil
+	case strings.HasPrefix(value, "@/"):
+		return readFile(value[1:])
+	}
+
+	ref := strings.TrimPrefix(value, "@")
+
+	i := strings.Index(ref, ":")
+	if i == -1 {
+		return value, nil
+	}
+	scheme, path := ref[:i], ref[i+1:]
+
+	flag, known := schemes[scheme]
+	provider, ok := r.providers[scheme]
+	switch {
+	case !known && !ok:
+		return value, nil
+	case !ok:
+		return "", fmt.Errorf("%s secrets aren't configured (see %s)", scheme, flag)
+	}
+
+	key := ""
+	if j := strings.LastIndex(path, "#"); j != -1 {
+		path, key = path[:j], path[j+1:]
+	}
+	if path == "" {
+		return "", fmt.Errorf("bad secret %q: no path", value)
+	}
+
+	secret, err := r.fetch(ctx, scheme, provider, path)
+	if err != nil {
+		return "", err
+	}
+
+	return secretValue(secret, key)
+}
+
+// fetch returns the secret at path, from the cache or from provider.
+func (r *Resolver) fetch(ctx context.Context, scheme string, provider Provider, path string) (*Secret, error) {
+	cacheKey := scheme + ":" + path
+	now := r.now()
+
+	r.mu.Lock()
+	cached := r.cache[cacheKey]
+	r.mu.Unlock()
+
+	if cached != nil && now.Before(cached.expires) {
+		return cached.secret, nil
+	}
+
+	secret, err := provider.Fetch(ctx, path)
+	if err != nil {
+		if cached != nil && now.Before(cached.expires.Add(SECRETS_MAX_STALE)) {
+			r.logger.Warnf("CRONIC: Failed to renew secret %s, using the cached one: %v", cacheKey, err)
+			return cached.secret, nil
+		}
+		return nil, fmt.Errorf("can't fetch secret %s: %v", cacheKey, err)
+	}
+
+	ttl := secret.TTL
+	if ttl <= 0 {
+		ttl = SECRETS_CACHE_TTL
+	}
+
+	r.mu.Lock()
+	r.cache[cacheKey] = &cachedSecret{secret: secret, expires: now.Add(ttl)}
+	r.mu.Unlock()
+
+	return secret, nil
+}
+
+// secretValue returns the field key of secret, or its value if key is
+// empty (or its only field, if it only has fields).
+func secretValue(secret *Secret, key string) (string, error) {
+	if key != "" {
+		value, ok := secret.Fields[key]
+		if !ok {
+			return "", fmt.Errorf("the secret has no field %q", key)
+		}
+		return value, nil
+	}
+
+	if secret.Value == "" && len(secret.Fields) > 0 {
+		if len(secret.Fields) > 1 {
+			return "", fmt.Errorf("the secret has several fields: pick one (with #FIELD)")
+		}
+		for _, value := range secret.Fields {
+			return value, nil
+		}
+	}
+	return secret.Value, nil
+}
+
+// readFile returns the contents of the file at path, less a trailing newline
+// (as left by most editors, and echo).
+func readFile(path string) (string, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	value := strings.TrimSuffix(string(contents), "\n")
+	return strings.TrimSuffix(value, "\r"), nil
+}
@@ -0,0 +1,119 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+type testProvider struct {
+	secrets map[string]*Secret
+	err     error
+	fetches int
+}
+
+func (p *testProvider) Fetch(ctx context.Context, path string) (*Secret, error) {
+	p.fetches++
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	secret, ok := p.secrets[path]
+	if !ok {
+		return nil, errors.New("no such secret")
+	}
+	return secret, nil
+}
+
+func newTestResolver(provider Provider) *Resolver {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	return NewResolver(map[string]Provider{"vault": provider}, logrus.NewEntry(logger))
+}
+
+func TestResolverResolvesReferences(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cronic-secrets")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "db-password")
+	if !assert.Nil(t, ioutil.WriteFile(path, []byte("hunter2\n"), 0600)) {
+		return
+	}
+
+	provider := &testProvider{secrets: map[string]*Secret{
+		"secret/data/app": {Fields: map[string]string{"password": "hunter3", "user": "app"}},
+		"secret/data/key": {Fields: map[string]string{"key": "s3cr3t"}},
+	}}
+	resolver := newTestResolver(provider)
+
+	for _, tt := range []struct {
+		value    string
+		expected string
+		err      string
+	}{
+		{"@" + path, "hunter2", ""},
+		{"@" + filepath.Join(dir, "nope"), "", "open " + filepath.Join(dir, "nope") + ": no such file or directory"},
+		{"@vault:secret/data/app#password", "hunter3", ""},
+		{"@vault:secret/data/key", "s3cr3t", ""},
+		{"@vault:secret/data/app", "", "the secret has several fields: pick one (with #FIELD)"},
+		{"@vault:secret/data/app#nope", "", `the secret has no field "nope"`},
+		{"@vault:secret/data/nope#key", "", "can't fetch secret vault:secret/data/nope: no such secret"},
+		{"@vault:#key", "", `bad secret "@vault:#key": no path`},
+		{"@aws-sm:prod/app", "", "aws-sm secrets aren't configured (see -aws-region)"},
+		{"@@vault:secret/data/app", "@vault:secret/data/app", ""},
+		{"@midnight", "@midnight", ""},
+		{"@example.com:8080", "@example.com:8080", ""},
+	} {
+		value, err := resolver.Resolve(context.Background(), tt.value)
+		if tt.err != "" {
+			assert.EqualError(t, err, tt.err, tt.value)
+		} else if assert.Nil(t, err, tt.value) {
+			assert.Equal(t, tt.expected, value, tt.value)
+		}
+	}
+}
+
+func TestResolverCachesSecrets(t *testing.T) {
+	provider := &testProvider{secrets: map[string]*Secret{
+		"secret/data/app": {Fields: map[string]string{"password": "hunter2", "user": "app"}, TTL: time.Minute},
+	}}
+	resolver := newTestResolver(provider)
+
+	now := time.Date(2018, 4, 7, 17, 41, 0, 0, time.UTC)
+	resolver.now = func() time.Time { return now }
+
+	resolve := func() (string, error) {
+		return resolver.Resolve(context.Background(), "@vault:secret/data/app#password")
+	}
+
+	// Fields share the same fetch
+	resolve()
+	resolver.Resolve(context.Background(), "@vault:secret/data/app#user")
+	assert.Equal(t, 1, provider.fetches)
+
+	// Once expired, secrets are renewed
+	now = now.Add(2 * time.Minute)
+	resolve()
+	assert.Equal(t, 2, provider.fetches)
+
+	// ... or kept for a while if they can't be
+	provider.err = errors.New("Vault is down")
+	now = now.Add(2 * time.Minute)
+	value, err := resolve()
+	assert.Nil(t, err)
+	assert.Equal(t, "hunter2", value)
+
+	now = now.Add(SECRETS_MAX_STALE)
+	_, err = resolve()
+	assert.EqualError(t, err, "can't fetch secret vault:secret/data/app: Vault is down")
+}
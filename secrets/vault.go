@@ -0,0 +1,191 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	VAULT_TIMEOUT = 10 * time.Second
+
+	// How long to wait before trying to renew the token again, when it
+	// couldn't be renewed
+	VAULT_RENEW_RETRY = time.Minute
+)
+
+// Vault fetches secrets from HashiCorp Vault's key/value secrets engines
+// (version 1 or 2: with version 2, paths include "data/", e.g.
+// secret/data/app).
+type Vault struct {
+	Addr string
+
+	// The token to authenticate with, or a file to read it from each time
+	// (e.g. the sink of a Vault agent, which keeps it renewed)
+	Token     string
+	TokenFile string
+
+	client *http.Client
+}
+
+func NewVault(addr string, token string, tokenFile string) *Vault {
+	return &Vault{
+		Addr:      strings.TrimSuffix(addr, "/"),
+		Token:     token,
+		TokenFile: tokenFile,
+		client:    &http.Client{Timeout: VAULT_TIMEOUT},
+	}
+}
+
+type vaultResponse struct {
+	LeaseDuration int                    `json:"lease_duration"`
+	Data          map[string]interface{} `json:"data"`
+	Auth          *struct {
+		LeaseDuration int  `json:"lease_duration"`
+		Renewable     bool `json:"renewable"`
+	} `json:"auth"`
+	Errors []string `json:"errors"`
+}
+
+func (v *Vault) Fetch(ctx context.Context, path string) (*Secret, error) {
+	response, err := v.call(ctx, http.MethodGet, "/v1/"+strings.TrimPrefix(path, "/"))
+	if err != nil {
+		return nil, err
+	}
+
+	data := response.Data
+
+	// Version 2 nests the secret's fields, next to their metadata
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = nested
+		}
+	}
+
+	secret := &Secret{
+		Fields: make(map[string]string, len(data)),
+		TTL:    time.Duration(response.LeaseDuration) * time.Second,
+	}
+	for key, value := range data {
+		if s, ok := value.(string); ok {
+			secret.Fields[key] = s
+			continue
+		}
+
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		secret.Fields[key] = string(encoded)
+	}
+
+	return secret, nil
+}
+
+// RenewToken renews the token, and returns for how long it's valid, and
+// whether it can be renewed again.
+func (v *Vault) RenewToken(ctx context.Context) (time.Duration, bool, error) {
+	response, err := v.call(ctx, http.MethodPost, "/v1/auth/token/renew-self")
+	if err != nil {
+		return 0, false, err
+	}
+	if response.Auth == nil {
+		return 0, false, fmt.Errorf("no auth in the response")
+	}
+
+	return time.Duration(response.Auth.LeaseDuration) * time.Second, response.Auth.Renewable, nil
+}
+
+// KeepTokenAlive renews the token halfway through its lease until ctx is
+// done, or until it can't be renewed anymore (e.g. it has no TTL, like root
+// tokens, or reached its max TTL). Tokens read from a TokenFile are left to
+// whoever writes it.
+func (v *Vault) KeepTokenAlive(ctx context.Context, logger *logrus.Entry) {
+	if v.TokenFile != "" {
+		return
+	}
+
+	for {
+		ttl, renewable, err := v.RenewToken(ctx)
+
+		wait := ttl / 2
+		switch {
+		case err != nil:
+			logger.Warnf("CRONIC: Failed to renew the Vault token: %v", err)
+			wait = VAULT_RENEW_RETRY
+		case !renewable || ttl == 0:
+			logger.Debugf("CRONIC: The Vault token can't be renewed, not renewing it")
+			return
+		default:
+			logger.Debugf("CRONIC: Renewed the Vault token, for %v", ttl)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (v *Vault) call(ctx context.Context, method string, path string) (*vaultResponse, error) {
+	token, err := v.token()
+	if err != nil {
+		return nil, err
+	}
+
+	var body io.Reader
+	if method == http.MethodPost {
+		body = strings.NewReader("{}")
+	}
+
+	request, err := http.NewRequest(method, v.Addr+path, body)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("X-Vault-Token", token)
+
+	response, err := v.client.Do(request.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	contents, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded vaultResponse
+	if err := json.Unmarshal(contents, &decoded); err != nil && response.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("bad response from Vault: %v", err)
+	}
+
+	if response.StatusCode != http.StatusOK {
+		if len(decoded.Errors) > 0 {
+			return nil, fmt.Errorf("Vault responded with status %d: %s", response.StatusCode, strings.Join(decoded.Errors, "; "))
+		}
+		return nil, fmt.Errorf("Vault responded with status %d", response.StatusCode)
+	}
+
+	return &decoded, nil
+}
+
+func (v *Vault) token() (string, error) {
+	if v.TokenFile == "" {
+		return v.Token, nil
+	}
+
+	token, err := readFile(v.TokenFile)
+	if err != nil {
+		return "", fmt.Errorf("can't read the Vault token: %v", err)
+	}
+	return strings.TrimSpace(token), nil
+}
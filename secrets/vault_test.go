@@ -0,0 +1,92 @@
+package secrets
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestVault(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s.token" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors": ["permission denied"]}`))
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v1/secret/data/app":
+			w.Write([]byte(`{"lease_duration": 0, "data": {"data": {"password": "hunter2", "port": 5432}, "metadata": {"version": 3}}}`))
+		case "/v1/kv/app":
+			w.Write([]byte(`{"lease_duration": 60, "data": {"password": "hunter3"}}`))
+		case "/v1/auth/token/renew-self":
+			assert.Equal(t, http.MethodPost, r.Method)
+			w.Write([]byte(`{"auth": {"lease_duration": 3600, "renewable": true}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors": []}`))
+		}
+	}))
+}
+
+func TestVaultFetchesSecrets(t *testing.T) {
+	server := newTestVault(t)
+	defer server.Close()
+
+	vault := NewVault(server.URL+"/", "s.token", "")
+
+	// Version 2
+	secret, err := vault.Fetch(context.Background(), "secret/data/app")
+	if assert.Nil(t, err) {
+		assert.Equal(t, map[string]string{"password": "hunter2", "port": "5432"}, secret.Fields)
+		assert.Equal(t, time.Duration(0), secret.TTL)
+	}
+
+	// Version 1
+	secret, err = vault.Fetch(context.Background(), "kv/app")
+	if assert.Nil(t, err) {
+		assert.Equal(t, map[string]string{"password": "hunter3"}, secret.Fields)
+		assert.Equal(t, time.Minute, secret.TTL)
+	}
+
+	_, err = vault.Fetch(context.Background(), "kv/nope")
+	assert.EqualError(t, err, "Vault responded with status 404")
+
+	_, err = NewVault(server.URL, "s.wrong", "").Fetch(context.Background(), "kv/app")
+	assert.EqualError(t, err, "Vault responded with status 403: permission denied")
+
+	ttl, renewable, err := vault.RenewToken(context.Background())
+	if assert.Nil(t, err) {
+		assert.Equal(t, time.Hour, ttl)
+		assert.True(t, renewable)
+	}
+}
+
+func TestVaultReadsTokenFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cronic-secrets")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	server := newTestVault(t)
+	defer server.Close()
+
+	tokenFile := filepath.Join(dir, "token")
+	vault := NewVault(server.URL, "", tokenFile)
+
+	_, err = vault.Fetch(context.Background(), "kv/app")
+	assert.NotNil(t, err)
+
+	// The file is read on each call, so it can be rotated
+	assert.Nil(t, ioutil.WriteFile(tokenFile, []byte("s.token\n"), 0600))
+	_, err = vault.Fetch(context.Background(), "kv/app")
+	assert.Nil(t, err)
+}
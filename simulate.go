@@ -0,0 +1,158 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/samgaw/cronic/cronictest"
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/sirupsen/logrus"
+)
+
+// simulateMain runs "cronic simulate", which prints the runs cronic would
+// start over a period of time, without running anything.
+func simulateMain(args []string) {
+	flags := flag.NewFlagSet("simulate", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s simulate [OPTIONS] CRONTAB\n       %s simulate [OPTIONS] -config FILE\n\nAvailable options:\n", os.Args[0], os.Args[0])
+		flags.PrintDefaults()
+	}
+
+	from := flags.String("from", "", "simulate runs after this date, e.g. 2018-04-07 or 2018-04-07T09:30 (defaults to now)")
+	to := flags.String("to", "", "simulate runs up to this date, in the same formats as -from (defaults to the same time a day after -from)")
+	tabFlags := addCrontabFlags(flags)
+	flags.Parse(args)
+
+	start, end, err := simulationPeriod(*from, *to, time.Now())
+	if err != nil {
+		logrus.Fatal(err)
+		return
+	}
+
+	tab, _ := tabFlags.read(flags)
+	runs := cronictest.New(tab, start).AdvanceTo(end)
+	printSimulatedRuns(os.Stdout, runs)
+
+	logrus.Infof("CRONIC: %d runs from %s to %s", len(runs), start.Format(time.RFC3339), end.Format(time.RFC3339))
+}
+
+// simulationPeriod returns the period -from and -to ask "cronic simulate" to
+// simulate runs over: from now (if from is empty) to a day later, at the
+// same time of day (if to is empty, even when a change to or from DST makes
+// that day shorter or longer than 24 hours).
+func simulationPeriod(from, to string, now time.Time) (time.Time, time.Time, error) {
+	var err error
+
+	start := now
+	if from != "" {
+		start, err = crontab.ParseDate(from)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("CRONIC: Bad -from: %v", err)
+		}
+	}
+
+	end := start.AddDate(0, 0, 1)
+	if to != "" {
+		end, err = crontab.ParseDate(to)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("CRONIC: Bad -to: %v", err)
+		}
+	}
+
+	if end.Before(start) {
+		return time.Time{}, time.Time{}, fmt.Errorf("CRONIC: Bad -to: %s is before -from", to)
+	}
+
+	return start, end, nil
+}
+
+// printSimulatedRuns prints runs as "cronic simulate" does: one per line,
+// with its time, its job's name and its command, in aligned columns.
+func printSimulatedRuns(w io.Writer, runs []cronictest.Run) {
+	out := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, run := range runs {
+		fmt.Fprintf(out, "%s\t%s\t%s\n", run.At.Format(time.RFC3339), simulatedJobName(run.Job), run.Command)
+	}
+	out.Flush()
+}
+
+// simulatedJobName identifies a job in the output of "cronic simulate",
+// using its position for jobs without a name.
+func simulatedJobName(job *crontab.Job) string {
+	if job.Name != "" {
+		return job.Name
+	}
+	return fmt.Sprintf("job-%d", job.Position)
+}
+
+// crontabFlags are the flags the subcommands that read a crontab (without
+// running it) share with cronic.
+type crontabFlags struct {
+	configPath     *string
+	scheduleSyntax *string
+	crontabFormat  *string
+	expand         *bool
+	literalPercent *bool
+}
+
+func addCrontabFlags(flags *flag.FlagSet) *crontabFlags {
+	return &crontabFlags{
+		configPath:     flags.String("config", "", "read jobs from this YAML configuration file, instead of a crontab"),
+		scheduleSyntax: flags.String("schedule-syntax", crontab.SyntaxCron, "the syntax of schedules without a syntax prefix, e.g. @quartz (cron, quartz, systemd)"),
+		crontabFormat:  flags.String("crontab-format", crontab.FormatAuto, "whether job lines have a user field before the command, like /etc/crontab (auto, user, system)"),
+		expand:         flags.Bool("expand", false, "replace ${VAR} in schedules and commands with the value of VAR when parsing the crontab (or -config), quoted for the shell in commands"),
+		literalPercent: flags.Bool("literal-percent", false, "leave % in crontab commands as-is, instead of feeding what follows the first one to the command's stdin (like cron)"),
+	}
+}
+
+// read reads the crontab (or -config) the parsed flags point to, exiting if
+// it can't. It returns the parser it read it with too.
+func (f *crontabFlags) read(flags *flag.FlagSet) (*crontab.Crontab, *crontab.Parser) {
+	var err error
+
+	parser := &crontab.Parser{
+		ExpandVariables: *f.expand,
+		LiteralPercent:  *f.literalPercent,
+	}
+
+	parser.ScheduleSyntax, err = crontab.ParseScheduleSyntax(*f.scheduleSyntax)
+	if err != nil {
+		logrus.Fatalf("CRONIC: Bad -schedule-syntax: %v", err)
+		return nil, nil
+	}
+
+	parser.Format, err = crontab.ParseCrontabFormat(*f.crontabFormat)
+	if err != nil {
+		logrus.Fatalf("CRONIC: Bad -crontab-format: %v", err)
+		return nil, nil
+	}
+
+	var tab *crontab.Crontab
+
+	if *f.configPath != "" {
+		if flags.NArg() != 0 {
+			flags.Usage()
+			os.Exit(2)
+			return nil, nil
+		}
+		tab, err = readConfigAtPath(parser, *f.configPath)
+	} else {
+		if flags.NArg() != 1 {
+			flags.Usage()
+			os.Exit(2)
+			return nil, nil
+		}
+		tab, err = readCrontabAtPath(parser, flags.Arg(0))
+	}
+
+	if err != nil {
+		logrus.Fatal(err)
+		return nil, nil
+	}
+	return tab, parser
+}
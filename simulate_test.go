@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samgaw/cronic/cronictest"
+	"github.com/stretchr/testify/assert"
+)
+
+var simulationPeriodTestCases = []struct {
+	from  string
+	to    string
+	start string
+	end   string
+	err   string
+}{
+	{"", "", "2018-04-07T09:30:00+01:00", "2018-04-08T09:30:00+01:00", ""},
+	{"2018-04-07", "", "2018-04-07T00:00:00+01:00", "2018-04-08T00:00:00+01:00", ""},
+	{"2018-04-07T09:30", "2018-04-14", "2018-04-07T09:30:00+01:00", "2018-04-14T00:00:00+01:00", ""},
+	{"", "2018-04-07T12:00", "2018-04-07T09:30:00+01:00", "2018-04-07T12:00:00+01:00", ""},
+	{"2018-04-07", "2018-04-07", "2018-04-07T00:00:00+01:00", "2018-04-07T00:00:00+01:00", ""},
+
+	// A day after -from is 23 or 25 hours later when DST starts or ends
+	{"2018-03-24T12:00", "", "2018-03-24T12:00:00Z", "2018-03-25T12:00:00+01:00", ""},
+	{"2018-10-27T12:00", "", "2018-10-27T12:00:00+01:00", "2018-10-28T12:00:00Z", ""},
+
+	{"2018-04-07", "2018-04-06", "", "", "CRONIC: Bad -to: 2018-04-06 is before -from"},
+	{"", "2018-04-07T09:00", "", "", "CRONIC: Bad -to: 2018-04-07T09:00 is before -from"},
+	{"tomorrow", "", "", "", "CRONIC: Bad -from: bad date"},
+	{"2018-04-07", "2018-13-01", "", "", "CRONIC: Bad -to: bad date"},
+}
+
+func TestSimulationPeriod(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	defer func(local *time.Location) {
+		time.Local = local
+	}(time.Local)
+
+	time.Local = london
+	now := time.Date(2018, 4, 7, 9, 30, 0, 0, london)
+
+	for _, tt := range simulationPeriodTestCases {
+		label := fmt.Sprintf("simulationPeriod(%q, %q)", tt.from, tt.to)
+		start, end, err := simulationPeriod(tt.from, tt.to, now)
+
+		if tt.err != "" {
+			if assert.NotNil(t, err, label) {
+				assert.Contains(t, err.Error(), tt.err, label)
+			}
+			continue
+		}
+
+		if assert.Nil(t, err, label) {
+			assert.Equal(t, tt.start, start.Format(time.RFC3339), label)
+			assert.Equal(t, tt.end, end.Format(time.RFC3339), label)
+		}
+	}
+}
+
+func TestPrintSimulatedRuns(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	// DST starts at 1:00 on that day, which becomes 2:00
+	start := time.Date(2018, 3, 25, 0, 0, 0, 0, london)
+	tab, err := cronictest.Parse(strings.NewReader("0 * * * * ./hourly.sh\n# name: backup\n30 2 * * * ./backup.sh\n"), start)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	var out bytes.Buffer
+	printSimulatedRuns(&out, tab.AdvanceTo(time.Date(2018, 3, 25, 3, 0, 0, 0, london)))
+
+	assert.Equal(t, strings.Join([]string{
+		"2018-03-25T02:00:00+01:00  job-0   ./hourly.sh",
+		"2018-03-25T02:30:00+01:00  backup  ./backup.sh",
+		"2018-03-25T03:00:00+01:00  job-0   ./hourly.sh",
+		"",
+	}, "\n"), out.String())
+}
@@ -0,0 +1,170 @@
+// Package spot watches for the interruption notices that clouds send to spot
+// (or preemptible) instances shortly before reclaiming them, so that cronic
+// can stop starting runs that would be killed halfway through.
+package spot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	EC2_METADATA_URL = "http://169.254.169.254"
+	GCP_METADATA_URL = "http://metadata.google.internal"
+	METADATA_TIMEOUT = 2 * time.Second
+)
+
+// Provider checks whether the instance cronic runs on is about to be
+// interrupted.
+type Provider interface {
+	// Interrupted returns a description of the interruption, if one was
+	// announced.
+	Interrupted(ctx context.Context) (string, bool, error)
+}
+
+// NewProvider returns the provider for a cloud (ec2 or gcp).
+func NewProvider(cloud string) (Provider, error) {
+	client := &http.Client{Timeout: METADATA_TIMEOUT}
+
+	switch cloud {
+	case "ec2":
+		return &EC2{URL: EC2_METADATA_URL, client: client}, nil
+	case "gcp":
+		return &GCP{URL: GCP_METADATA_URL, client: client}, nil
+	default:
+		return nil, fmt.Errorf("CRONIC: Bad spot provider: %q (expected ec2 or gcp)", cloud)
+	}
+}
+
+// Watch polls provider every interval until ctx is done, or until an
+// interruption is announced, in which case it calls onInterruption (once).
+func Watch(ctx context.Context, provider Provider, interval time.Duration, logger *logrus.Entry, onInterruption func(notice string)) {
+	for {
+		notice, interrupted, err := provider.Interrupted(ctx)
+		if err != nil {
+			// The metadata service can be briefly unavailable
+			logger.Debugf("CRONIC: Failed to check for spot interruptions: %v", err)
+		} else if interrupted {
+			onInterruption(notice)
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// EC2 checks the instance metadata service (using IMDSv2 if available) for
+// spot instance interruption notices.
+type EC2 struct {
+	URL    string
+	client *http.Client
+}
+
+type ec2InstanceAction struct {
+	Action string `json:"action"`
+	Time   string `json:"time"`
+}
+
+func (e *EC2) Interrupted(ctx context.Context) (string, bool, error) {
+	request, err := http.NewRequest(http.MethodGet, e.URL+"/latest/meta-data/spot/instance-action", nil)
+	if err != nil {
+		return "", false, err
+	}
+
+	// Without a token, this falls back to IMDSv1
+	if token, err := e.token(ctx); err == nil {
+		request.Header.Set("X-aws-ec2-metadata-token", token)
+	}
+
+	body, status, err := get(ctx, e.client, request)
+	if err != nil {
+		return "", false, err
+	}
+
+	switch status {
+	case http.StatusNotFound:
+		return "", false, nil
+	case http.StatusOK:
+	default:
+		return "", false, fmt.Errorf("unexpected status %d", status)
+	}
+
+	var action ec2InstanceAction
+	if err := json.Unmarshal(body, &action); err != nil {
+		return "", false, fmt.Errorf("bad instance action: %v", err)
+	}
+
+	return fmt.Sprintf("EC2 will %s the instance at %s", action.Action, action.Time), true, nil
+}
+
+func (e *EC2) token(ctx context.Context) (string, error) {
+	request, err := http.NewRequest(http.MethodPut, e.URL+"/latest/api/token", nil)
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+
+	body, status, err := get(ctx, e.client, request)
+	if err != nil {
+		return "", err
+	}
+	if status != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %d", status)
+	}
+
+	return string(body), nil
+}
+
+// GCP checks the metadata server for preemption of preemptible (or spot) VMs.
+type GCP struct {
+	URL    string
+	client *http.Client
+}
+
+func (g *GCP) Interrupted(ctx context.Context) (string, bool, error) {
+	request, err := http.NewRequest(http.MethodGet, g.URL+"/computeMetadata/v1/instance/preempted", nil)
+	if err != nil {
+		return "", false, err
+	}
+	request.Header.Set("Metadata-Flavor", "Google")
+
+	body, status, err := get(ctx, g.client, request)
+	if err != nil {
+		return "", false, err
+	}
+	if status != http.StatusOK {
+		return "", false, fmt.Errorf("unexpected status %d", status)
+	}
+
+	if strings.TrimSpace(string(body)) != "TRUE" {
+		return "", false, nil
+	}
+
+	return "GCP is preempting the instance", true, nil
+}
+
+func get(ctx context.Context, client *http.Client, request *http.Request) ([]byte, int, error) {
+	response, err := client.Do(request.WithContext(ctx))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return body, response.StatusCode, nil
+}
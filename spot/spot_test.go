@@ -0,0 +1,148 @@
+package spot
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func discardLogger() *logrus.Entry {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	return logrus.NewEntry(logger)
+}
+
+// newEC2 returns a fake metadata service, which announces an interruption
+// once interrupted is closed.
+func newEC2(interrupted chan struct{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/latest/api/token":
+			w.Write([]byte("token"))
+		case r.URL.Path == "/latest/meta-data/spot/instance-action":
+			if r.Header.Get("X-aws-ec2-metadata-token") != "token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			select {
+			case <-interrupted:
+				w.Write([]byte(`{"action": "terminate", "time": "2017-09-18T08:22:00Z"}`))
+			default:
+				http.NotFound(w, r)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestEC2(t *testing.T) {
+	interrupted := make(chan struct{})
+	server := newEC2(interrupted)
+	defer server.Close()
+
+	provider := &EC2{URL: server.URL, client: http.DefaultClient}
+
+	_, ok, err := provider.Interrupted(context.Background())
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	close(interrupted)
+	notice, ok, err := provider.Interrupted(context.Background())
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "EC2 will terminate the instance at 2017-09-18T08:22:00Z", notice)
+}
+
+func TestGCP(t *testing.T) {
+	preempted := "FALSE"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/computeMetadata/v1/instance/preempted" || r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(preempted))
+	}))
+	defer server.Close()
+
+	provider := &GCP{URL: server.URL, client: http.DefaultClient}
+
+	_, ok, err := provider.Interrupted(context.Background())
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	preempted = "TRUE"
+	_, ok, err = provider.Interrupted(context.Background())
+	assert.Nil(t, err)
+	assert.True(t, ok)
+}
+
+func TestNewProvider(t *testing.T) {
+	for _, cloud := range []string{"ec2", "gcp"} {
+		provider, err := NewProvider(cloud)
+		assert.Nil(t, err, cloud)
+		assert.NotNil(t, provider, cloud)
+	}
+
+	_, err := NewProvider("azure")
+	assert.NotNil(t, err)
+}
+
+func TestWatchStopsOnInterruption(t *testing.T) {
+	interrupted := make(chan struct{})
+	server := newEC2(interrupted)
+	defer server.Close()
+
+	notices := make(chan string, 2)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		Watch(context.Background(), &EC2{URL: server.URL, client: http.DefaultClient}, 10*time.Millisecond, discardLogger(), func(notice string) {
+			notices <- notice
+		})
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 0, len(notices))
+
+	close(interrupted)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the interruption")
+	}
+
+	assert.Equal(t, 1, len(notices))
+}
+
+func TestWatchStopsWithContext(t *testing.T) {
+	server := newEC2(make(chan struct{}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		Watch(ctx, &EC2{URL: server.URL, client: http.DefaultClient}, 10*time.Millisecond, discardLogger(), func(string) {
+			t.Error("unexpected interruption")
+		})
+	}()
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for Watch to return")
+	}
+}
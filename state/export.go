@@ -0,0 +1,48 @@
+package state
+
+import (
+	"fmt"
+
+	"github.com/samgaw/cronic/cron"
+)
+
+// Export records runs in a store, and exports them to another (e.g. a
+// central database a fleet of cronic processes reports into). Results are
+// only read from the store.
+type Export struct {
+	store  cron.StateStore
+	export cron.StateStore
+}
+
+func NewExport(store cron.StateStore, export cron.StateStore) *Export {
+	return &Export{store: store, export: export}
+}
+
+// Record records the result in the store first, so that it's kept even if
+// the export fails.
+func (e *Export) Record(key string, result *cron.RunResult) error {
+	if err := e.store.Record(key, result); err != nil {
+		return err
+	}
+
+	if err := e.export.Record(key, result); err != nil {
+		return fmt.Errorf("CRONIC: Failed to export the run: %v", err)
+	}
+	return nil
+}
+
+func (e *Export) Last(key string) (*cron.RunResult, error) {
+	return e.store.Last(key)
+}
+
+func (e *Export) History(key string, limit int) ([]*cron.RunResult, error) {
+	return e.store.History(key, limit)
+}
+
+func (e *Export) Close() error {
+	err := e.store.Close()
+	if exportErr := e.export.Close(); err == nil {
+		err = exportErr
+	}
+	return err
+}
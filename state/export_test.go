@@ -0,0 +1,54 @@
+package state
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cronic-state")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := NewFile(filepath.Join(dir, "state.json"))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	central := filepath.Join(dir, "central.db")
+	export, err := NewSQL(SQLite, central, "test")
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	testStore(t, NewExport(store, export))
+
+	// The runs were exported too
+	export, err = NewSQL(SQLite, central, "test")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer export.Close()
+
+	history, err := export.History("backup", 10)
+	if assert.Nil(t, err) && assert.Len(t, history, 2) {
+		assert.Equal(t, "run-2", history[0].RunID)
+	}
+
+	// Failed exports are reported, once the run is recorded
+	export.Close()
+	e := NewExport(store, export)
+	assert.NotNil(t, e.Record("backup", newTestResult("run-4", true, time.Now())))
+
+	last, err := e.Last("backup")
+	if assert.Nil(t, err) && assert.NotNil(t, last) {
+		assert.Equal(t, "run-4", last.RunID)
+	}
+}
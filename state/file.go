@@ -0,0 +1,89 @@
+package state
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/samgaw/cronic/cron"
+)
+
+// File keeps the results of runs in a JSON file, which is rewritten (by
+// replacing it, so it's never half-written) after each run.
+type File struct {
+	path string
+
+	mu   sync.Mutex
+	jobs map[string][]*cron.RunResult
+}
+
+// NewFile loads the state in the file at path, if it exists.
+func NewFile(path string) (*File, error) {
+	f := &File{path: path, jobs: make(map[string][]*cron.RunResult)}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return f, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &f.jobs); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (f *File) Record(key string, result *cron.RunResult) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.jobs[key] = keep(f.jobs[key], result)
+
+	data, err := json.Marshal(f.jobs)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(f.path), filepath.Base(f.path)+".")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), f.path)
+}
+
+func (f *File) Last(key string) (*cron.RunResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if history := f.jobs[key]; len(history) > 0 {
+		return history[0], nil
+	}
+	return nil, nil
+}
+
+func (f *File) History(key string, n int) ([]*cron.RunResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]*cron.RunResult(nil), limit(f.jobs[key], n)...), nil
+}
+
+func (f *File) Close() error {
+	return nil
+}
@@ -0,0 +1,65 @@
+package state
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cronic-state")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "state.json")
+
+	store, err := NewFile(path)
+	if assert.Nil(t, err) {
+		testStore(t, store)
+	}
+
+	// The state survives restarts
+	store, err = NewFile(path)
+	if assert.Nil(t, err) {
+		last, err := store.Last("backup")
+		if assert.Nil(t, err) && assert.NotNil(t, last) {
+			assert.Equal(t, "run-2", last.RunID)
+		}
+	}
+}
+
+func TestFileKeepsRecentHistory(t *testing.T) {
+	defer func(size int) {
+		HISTORY_SIZE = size
+	}(HISTORY_SIZE)
+
+	HISTORY_SIZE = 2
+
+	dir, err := ioutil.TempDir("", "cronic-state")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := NewFile(filepath.Join(dir, "state.json"))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	t0 := time.Now()
+	for _, runID := range []string{"run-1", "run-2", "run-3"} {
+		assert.Nil(t, store.Record("backup", newTestResult(runID, true, t0)))
+	}
+
+	history, err := store.History("backup", 10)
+	if assert.Nil(t, err) && assert.Equal(t, 2, len(history)) {
+		assert.Equal(t, "run-3", history[0].RunID)
+		assert.Equal(t, "run-2", history[1].RunID)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build mysql
+// +build mysql
+
+package state
+
+import (
+	// The database/sql driver of the MySQL dialect
+	_ "github.com/go-sql-driver/mysql"
+)
@@ -0,0 +1,260 @@
+package state
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samgaw/cronic/cron"
+)
+
+var (
+	REDIS_TIMEOUT = 5 * time.Second
+)
+
+// Redis keeps the results of runs in Redis lists (one per job, named
+// "cronic:INSTANCE:runs:JOB"), most recent first.
+type Redis struct {
+	addr     string
+	password string
+	db       int
+	instance string
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewRedis returns a store for the Redis server at u (redis://[:PASSWORD@]HOST[:PORT][/DB]).
+// It connects on first use.
+func NewRedis(u *url.URL, instance string) (*Redis, error) {
+	r := &Redis{addr: u.Host, instance: instance}
+
+	if u.Port() == "" {
+		r.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+
+	if u.User != nil {
+		r.password, _ = u.User.Password()
+	}
+
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		n, err := strconv.Atoi(db)
+		if err != nil {
+			return nil, fmt.Errorf("CRONIC: Bad Redis database: %q", db)
+		}
+		r.db = n
+	}
+
+	return r, nil
+}
+
+func (r *Redis) key(job string) string {
+	return fmt.Sprintf("cronic:%s:runs:%s", r.instance, job)
+}
+
+func (r *Redis) Record(key string, result *cron.RunResult) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	if _, err := r.do("LPUSH", r.key(key), string(data)); err != nil {
+		return err
+	}
+
+	_, err = r.do("LTRIM", r.key(key), "0", strconv.Itoa(HISTORY_SIZE-1))
+	return err
+}
+
+func (r *Redis) Last(key string) (*cron.RunResult, error) {
+	history, err := r.History(key, 1)
+	if err != nil || len(history) == 0 {
+		return nil, err
+	}
+	return history[0], nil
+}
+
+func (r *Redis) History(key string, n int) ([]*cron.RunResult, error) {
+	if n == 0 {
+		return nil, nil
+	}
+
+	reply, err := r.do("LRANGE", r.key(key), "0", strconv.Itoa(n-1))
+	if err != nil {
+		return nil, err
+	}
+
+	items, ok := reply.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("CRONIC: Unexpected reply from Redis: %v", reply)
+	}
+
+	history := make([]*cron.RunResult, 0, len(items))
+	for _, item := range items {
+		data, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("CRONIC: Unexpected reply from Redis: %v", item)
+		}
+
+		result := &cron.RunResult{}
+		if err := json.Unmarshal([]byte(data), result); err != nil {
+			return nil, err
+		}
+		history = append(history, result)
+	}
+
+	return history, nil
+}
+
+func (r *Redis) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.conn == nil {
+		return nil
+	}
+
+	err := r.conn.Close()
+	r.conn = nil
+	return err
+}
+
+// do sends a command, and returns its reply. The connection is dropped after
+// errors, and made again by the next command.
+func (r *Redis) do(args ...string) (interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.conn == nil {
+		if err := r.connect(); err != nil {
+			return nil, err
+		}
+	}
+
+	reply, err := r.roundTrip(args)
+	if err != nil {
+		if _, ok := err.(redisError); !ok {
+			r.conn.Close()
+			r.conn = nil
+		}
+		return nil, err
+	}
+
+	return reply, nil
+}
+
+func (r *Redis) connect() error {
+	conn, err := net.DialTimeout("tcp", r.addr, REDIS_TIMEOUT)
+	if err != nil {
+		return err
+	}
+
+	r.conn = conn
+	r.reader = bufio.NewReader(conn)
+
+	if r.password != "" {
+		if _, err := r.roundTrip([]string{"AUTH", r.password}); err != nil {
+			conn.Close()
+			r.conn = nil
+			return err
+		}
+	}
+
+	if r.db != 0 {
+		if _, err := r.roundTrip([]string{"SELECT", strconv.Itoa(r.db)}); err != nil {
+			conn.Close()
+			r.conn = nil
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Redis) roundTrip(args []string) (interface{}, error) {
+	r.conn.SetDeadline(time.Now().Add(REDIS_TIMEOUT))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	if _, err := io.WriteString(r.conn, b.String()); err != nil {
+		return nil, err
+	}
+
+	return readRESP(r.reader)
+}
+
+// redisError is an error reply, after which the connection can still be
+// used.
+type redisError string
+
+func (e redisError) Error() string {
+	return "CRONIC: Redis error: " + string(e)
+}
+
+// readRESP reads a reply in the Redis protocol: a string, an integer, nil,
+// or a slice of replies.
+func readRESP(reader *bufio.Reader) (interface{}, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("CRONIC: Empty reply from Redis")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = readRESP(reader); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("CRONIC: Unexpected reply from Redis: %q", line)
+	}
+}
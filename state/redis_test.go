@@ -0,0 +1,142 @@
+package state
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRedis implements the few list commands the store uses.
+type fakeRedis struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	lists    map[string][]string
+	commands []string
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fakeRedis{listener: listener, lists: make(map[string][]string)}
+	go f.serve()
+	return f
+}
+
+func (f *fakeRedis) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	for {
+		reply, err := readRESP(reader)
+		if err != nil {
+			return
+		}
+
+		items := reply.([]interface{})
+		args := make([]string, len(items))
+		for i, item := range items {
+			args[i] = item.(string)
+		}
+
+		fmt.Fprint(conn, f.execute(args))
+	}
+}
+
+func (f *fakeRedis) execute(args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.commands = append(f.commands, args[0])
+
+	switch args[0] {
+	case "AUTH", "SELECT":
+		return "+OK\r\n"
+	case "LPUSH":
+		f.lists[args[1]] = append([]string{args[2]}, f.lists[args[1]]...)
+		return fmt.Sprintf(":%d\r\n", len(f.lists[args[1]]))
+	case "LTRIM", "LRANGE":
+		list := f.lists[args[1]]
+		start, _ := strconv.Atoi(args[2])
+		stop, _ := strconv.Atoi(args[3])
+		if stop >= len(list) {
+			stop = len(list) - 1
+		}
+		list = list[start : stop+1]
+
+		if args[0] == "LTRIM" {
+			f.lists[args[1]] = list
+			return "+OK\r\n"
+		}
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "*%d\r\n", len(list))
+		for _, item := range list {
+			fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(item), item)
+		}
+		return b.String()
+	default:
+		return "-ERR unknown command\r\n"
+	}
+}
+
+func TestRedis(t *testing.T) {
+	server := newFakeRedis(t)
+	defer server.listener.Close()
+
+	u, _ := url.Parse("redis://:secret@" + server.listener.Addr().String() + "/2")
+
+	store, err := NewRedis(u, "test")
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	testStore(t, store)
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	assert.Equal(t, []string{"AUTH", "SELECT"}, server.commands[:2])
+	assert.Equal(t, 2, len(server.lists["cronic:test:runs:backup"]))
+	assert.Equal(t, 1, len(server.lists["cronic:test:runs:@hourly echo hi"]))
+}
+
+func TestRedisReportsErrors(t *testing.T) {
+	server := newFakeRedis(t)
+	defer server.listener.Close()
+
+	u, _ := url.Parse("redis://" + server.listener.Addr().String())
+
+	store, err := NewRedis(u, "test")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer store.Close()
+
+	_, err = store.do("GET", "key")
+	assert.Equal(t, redisError("ERR unknown command"), err)
+
+	// The connection can still be used
+	_, err = store.do("LRANGE", "key", "0", "-1")
+	assert.Nil(t, err)
+}
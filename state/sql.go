@@ -0,0 +1,229 @@
+package state
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samgaw/cronic/cron"
+
+	// The database/sql drivers of the SQL dialects
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var (
+	// How often SQL stores with a retention delete the runs that are past it
+	PRUNE_INTERVAL = time.Hour
+)
+
+// Dialect describes how an SQL database differs from the others, as far as
+// SQL is concerned.
+type Dialect struct {
+	Driver string
+
+	// Returns the placeholder of the nth (from 1) parameter of a query
+	Placeholder func(n int) string
+
+	// The statements creating the tables, if they differ from the others'
+	Schema []string
+}
+
+var (
+	SQLite = &Dialect{
+		Driver:      "sqlite3",
+		Placeholder: func(int) string { return "?" },
+	}
+
+	Postgres = &Dialect{
+		Driver:      "postgres",
+		Placeholder: func(n int) string { return fmt.Sprintf("$%d", n) },
+	}
+
+	// MySQL's driver is only included in cronic when it's built with the
+	// mysql tag.
+	MySQL = &Dialect{
+		Driver:      "mysql",
+		Placeholder: func(int) string { return "?" },
+		Schema:      []string{createMySQLRunsTable},
+	}
+)
+
+// The full result is stored as JSON, and the fields worth querying have
+// their own columns.
+const createRunsTable = `CREATE TABLE IF NOT EXISTS cronic_runs (
+	instance    TEXT NOT NULL,
+	job         TEXT NOT NULL,
+	run_id      TEXT NOT NULL,
+	started_at  TIMESTAMP NOT NULL,
+	finished_at TIMESTAMP NOT NULL,
+	success     BOOLEAN NOT NULL,
+	timed_out   BOOLEAN NOT NULL,
+	exit_code   INTEGER,
+	error       TEXT NOT NULL,
+	result      TEXT NOT NULL,
+	PRIMARY KEY (instance, run_id)
+)`
+
+const createRunsIndex = `CREATE INDEX IF NOT EXISTS cronic_runs_job ON cronic_runs (instance, job, finished_at)`
+
+// MySQL can't index TEXT columns, or create indexes "IF NOT EXISTS".
+const createMySQLRunsTable = `CREATE TABLE IF NOT EXISTS cronic_runs (
+	instance    VARCHAR(255) NOT NULL,
+	job         VARCHAR(500) NOT NULL,
+	run_id      VARCHAR(255) NOT NULL,
+	started_at  DATETIME(6) NOT NULL,
+	finished_at DATETIME(6) NOT NULL,
+	success     BOOLEAN NOT NULL,
+	timed_out   BOOLEAN NOT NULL,
+	exit_code   INTEGER,
+	error       TEXT NOT NULL,
+	result      MEDIUMTEXT NOT NULL,
+	PRIMARY KEY (instance, run_id),
+	INDEX cronic_runs_job (instance, job, finished_at)
+)`
+
+// SQL keeps the results of runs in the cronic_runs table of a database
+// (created if it doesn't exist), where they can be queried, e.g.:
+//
+//	SELECT job, count(*) FROM cronic_runs WHERE NOT success GROUP BY job
+type SQL struct {
+	// How long to keep runs for, after they finish (0 to keep them all)
+	Retention time.Duration
+
+	db       *sql.DB
+	dialect  *Dialect
+	instance string
+
+	mu         sync.Mutex
+	lastPruned time.Time
+}
+
+// NewSQL connects to the database at dsn (in the format of the dialect's
+// driver), and creates the cronic_runs table if needed.
+func NewSQL(dialect *Dialect, dsn string, instance string) (*SQL, error) {
+	db, err := sql.Open(dialect.Driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := dialect.Schema
+	if schema == nil {
+		schema = []string{createRunsTable, createRunsIndex}
+	}
+
+	for _, statement := range schema {
+		if _, err := db.Exec(statement); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("CRONIC: Failed to create the state tables: %v", err)
+		}
+	}
+
+	return &SQL{db: db, dialect: dialect, instance: instance}, nil
+}
+
+// query replaces the "?" placeholders of query with the dialect's.
+func (s *SQL) query(query string) string {
+	parts := strings.Split(query, "?")
+
+	var b strings.Builder
+	for i, part := range parts {
+		b.WriteString(part)
+		if i < len(parts)-1 {
+			b.WriteString(s.dialect.Placeholder(i + 1))
+		}
+	}
+	return b.String()
+}
+
+func (s *SQL) Record(key string, result *cron.RunResult) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(
+		s.query(`INSERT INTO cronic_runs (instance, job, run_id, started_at, finished_at, success, timed_out, exit_code, error, result) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+		s.instance, key, result.RunID, result.StartedAt.UTC(), result.FinishedAt.UTC(), result.Success, result.TimedOut, result.ExitCode, result.Error, string(data),
+	)
+	if err != nil {
+		return err
+	}
+
+	return s.pruneIfDue()
+}
+
+// pruneIfDue deletes the runs past the retention, at most every
+// PRUNE_INTERVAL.
+func (s *SQL) pruneIfDue() error {
+	if s.Retention <= 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastPruned) < PRUNE_INTERVAL {
+		return nil
+	}
+	s.lastPruned = now
+
+	_, err := s.Prune(now.Add(-s.Retention))
+	return err
+}
+
+// Prune deletes the runs of the instance that finished before before, and
+// returns how many it deleted.
+func (s *SQL) Prune(before time.Time) (int64, error) {
+	res, err := s.db.Exec(
+		s.query(`DELETE FROM cronic_runs WHERE instance = ? AND finished_at < ?`),
+		s.instance, before.UTC(),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("CRONIC: Failed to prune runs: %v", err)
+	}
+	return res.RowsAffected()
+}
+
+func (s *SQL) Last(key string) (*cron.RunResult, error) {
+	history, err := s.History(key, 1)
+	if err != nil || len(history) == 0 {
+		return nil, err
+	}
+	return history[0], nil
+}
+
+func (s *SQL) History(key string, n int) ([]*cron.RunResult, error) {
+	rows, err := s.db.Query(
+		s.query(`SELECT result FROM cronic_runs WHERE instance = ? AND job = ? ORDER BY finished_at DESC LIMIT ?`),
+		s.instance, key, n,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := make([]*cron.RunResult, 0)
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+
+		result := &cron.RunResult{}
+		if err := json.Unmarshal([]byte(data), result); err != nil {
+			return nil, err
+		}
+		history = append(history, result)
+	}
+
+	return history, rows.Err()
+}
+
+func (s *SQL) Close() error {
+	return s.db.Close()
+}
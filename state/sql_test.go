@@ -0,0 +1,108 @@
+package state
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/samgaw/cronic/cron"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQLite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cronic-state")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "state.db")
+
+	store, err := NewSQL(SQLite, path, "test")
+	if assert.Nil(t, err) {
+		testStore(t, store)
+	}
+
+	// Other instances' runs are kept apart
+	store, err = NewSQL(SQLite, path, "other")
+	if assert.Nil(t, err) {
+		last, err := store.Last("backup")
+		assert.Nil(t, err)
+		assert.Nil(t, last)
+		store.Close()
+	}
+}
+
+func TestSQLPrunesRuns(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cronic-state")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := NewSQL(SQLite, filepath.Join(dir, "state.db"), "test")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer store.Close()
+
+	store.Retention = 24 * time.Hour
+
+	now := time.Now()
+	insert := func(runID string, age time.Duration) {
+		finishedAt := now.Add(-age).UTC()
+		_, err := store.db.Exec(
+			`INSERT INTO cronic_runs (instance, job, run_id, started_at, finished_at, success, timed_out, exit_code, error, result) VALUES ('test', 'backup', ?, ?, ?, 1, 0, 0, '', '{}')`,
+			runID, finishedAt, finishedAt,
+		)
+		assert.Nil(t, err)
+	}
+
+	insert("a", 72*time.Hour)
+	insert("b", 48*time.Hour)
+
+	// Recording a run prunes those past the retention
+	assert.Nil(t, store.Record("backup", &cron.RunResult{RunID: "c", StartedAt: now, FinishedAt: now, Success: true}))
+
+	history, err := store.History("backup", 10)
+	if assert.Nil(t, err) && assert.Len(t, history, 1) {
+		assert.Equal(t, "c", history[0].RunID)
+	}
+
+	// But only every PRUNE_INTERVAL
+	insert("d", 48*time.Hour)
+	assert.Nil(t, store.Record("backup", &cron.RunResult{RunID: "e", StartedAt: now, FinishedAt: now, Success: true}))
+
+	history, _ = store.History("backup", 10)
+	assert.Len(t, history, 3)
+
+	deleted, err := store.Prune(now.Add(-time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), deleted)
+}
+
+// Set CRONIC_TEST_POSTGRES_URL to a disposable database to run this
+func TestPostgres(t *testing.T) {
+	dsn := os.Getenv("CRONIC_TEST_POSTGRES_URL")
+	if dsn == "" {
+		t.Skip("CRONIC_TEST_POSTGRES_URL isn't set")
+	}
+
+	store, err := NewSQL(Postgres, dsn, t.Name())
+	if assert.Nil(t, err) {
+		_, err := store.db.Exec(`DELETE FROM cronic_runs WHERE instance = $1`, t.Name())
+		assert.Nil(t, err)
+		testStore(t, store)
+	}
+}
+
+func TestSQLPlaceholders(t *testing.T) {
+	store := &SQL{dialect: Postgres}
+	assert.Equal(t, "SELECT $1, $2", store.query("SELECT ?, ?"))
+
+	store = &SQL{dialect: SQLite}
+	assert.Equal(t, "SELECT ?, ?", store.query("SELECT ?, ?"))
+}
@@ -0,0 +1,122 @@
+package telemetry
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config configures the export of traces and metrics over OTLP (HTTP/JSON).
+type Config struct {
+	// Where to send traces and metrics (either can be empty to disable it)
+	TracesEndpoint  string
+	MetricsEndpoint string
+
+	// Sent with every request (e.g. for authentication)
+	Headers map[string]string
+
+	// Describe cronic (e.g. service.name)
+	ResourceAttributes map[string]string
+
+	MetricInterval time.Duration
+}
+
+// ConfigFromEnv reads the configuration from the standard OpenTelemetry
+// environment variables. It returns nil if exporting isn't enabled.
+func ConfigFromEnv(getenv func(string) string) (*Config, error) {
+	if strings.EqualFold(getenv("OTEL_SDK_DISABLED"), "true") {
+		return nil, nil
+	}
+
+	if protocol := getenv("OTEL_EXPORTER_OTLP_PROTOCOL"); protocol != "" && protocol != "http/json" {
+		return nil, fmt.Errorf("CRONIC: Unsupported OTEL_EXPORTER_OTLP_PROTOCOL: %q (only http/json is supported)", protocol)
+	}
+
+	base := strings.TrimSuffix(getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "/")
+
+	config := &Config{
+		TracesEndpoint:     signalEndpoint(getenv, base, "TRACES", "/v1/traces"),
+		MetricsEndpoint:    signalEndpoint(getenv, base, "METRICS", "/v1/metrics"),
+		ResourceAttributes: map[string]string{"service.name": "cronic"},
+		MetricInterval:     60 * time.Second,
+	}
+
+	if config.TracesEndpoint == "" && config.MetricsEndpoint == "" {
+		return nil, nil
+	}
+
+	headers, err := parseKeyValues(getenv("OTEL_EXPORTER_OTLP_HEADERS"))
+	if err != nil {
+		return nil, fmt.Errorf("CRONIC: Bad OTEL_EXPORTER_OTLP_HEADERS: %v", err)
+	}
+	config.Headers = headers
+
+	attributes, err := parseKeyValues(getenv("OTEL_RESOURCE_ATTRIBUTES"))
+	if err != nil {
+		return nil, fmt.Errorf("CRONIC: Bad OTEL_RESOURCE_ATTRIBUTES: %v", err)
+	}
+	for key, value := range attributes {
+		config.ResourceAttributes[key] = value
+	}
+
+	if name := getenv("OTEL_SERVICE_NAME"); name != "" {
+		config.ResourceAttributes["service.name"] = name
+	}
+
+	if interval := getenv("OTEL_METRIC_EXPORT_INTERVAL"); interval != "" {
+		ms, err := strconv.Atoi(interval)
+		if err != nil || ms <= 0 {
+			return nil, fmt.Errorf("CRONIC: Bad OTEL_METRIC_EXPORT_INTERVAL: %q", interval)
+		}
+		config.MetricInterval = time.Duration(ms) * time.Millisecond
+	}
+
+	return config, nil
+}
+
+// signalEndpoint returns the endpoint for traces or metrics, which can be set
+// directly, or derived from the base endpoint.
+func signalEndpoint(getenv func(string) string, base string, signal string, path string) string {
+	if strings.EqualFold(getenv("OTEL_"+signal+"_EXPORTER"), "none") {
+		return ""
+	}
+
+	if endpoint := getenv("OTEL_EXPORTER_OTLP_" + signal + "_ENDPOINT"); endpoint != "" {
+		return endpoint
+	}
+
+	if base == "" {
+		return ""
+	}
+
+	return base + path
+}
+
+// parseKeyValues parses a list of key=value pairs separated by commas, where
+// values are URL-encoded (as used by OTEL_RESOURCE_ATTRIBUTES).
+func parseKeyValues(list string) (map[string]string, error) {
+	values := make(map[string]string)
+
+	for _, pair := range strings.Split(list, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		i := strings.Index(pair, "=")
+		if i == -1 {
+			return nil, fmt.Errorf("missing value in %q", pair)
+		}
+
+		key := strings.TrimSpace(pair[:i])
+		value, err := url.QueryUnescape(strings.TrimSpace(pair[i+1:]))
+		if err != nil || key == "" {
+			return nil, fmt.Errorf("bad pair %q", pair)
+		}
+
+		values[key] = value
+	}
+
+	return values, nil
+}
@@ -0,0 +1,103 @@
+package telemetry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	type testCase struct {
+		name     string
+		env      map[string]string
+		expected *Config
+		err      bool
+	}
+
+	testCases := []testCase{
+		{
+			name:     "disabled without endpoint",
+			env:      map[string]string{"OTEL_SERVICE_NAME": "foo"},
+			expected: nil,
+		},
+		{
+			name: "base endpoint",
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318/",
+				"OTEL_EXPORTER_OTLP_HEADERS":  "Authorization=Bearer%20secret,X-Foo = bar",
+				"OTEL_RESOURCE_ATTRIBUTES":    "service.name=ignored,host.name=box",
+				"OTEL_SERVICE_NAME":           "batch",
+				"OTEL_METRIC_EXPORT_INTERVAL": "1500",
+			},
+			expected: &Config{
+				TracesEndpoint:     "http://collector:4318/v1/traces",
+				MetricsEndpoint:    "http://collector:4318/v1/metrics",
+				Headers:            map[string]string{"Authorization": "Bearer secret", "X-Foo": "bar"},
+				ResourceAttributes: map[string]string{"service.name": "batch", "host.name": "box"},
+				MetricInterval:     1500 * time.Millisecond,
+			},
+		},
+		{
+			name: "signal endpoints",
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_ENDPOINT":        "http://collector:4318",
+				"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "http://traces/custom",
+				"OTEL_METRICS_EXPORTER":              "none",
+			},
+			expected: &Config{
+				TracesEndpoint:     "http://traces/custom",
+				Headers:            map[string]string{},
+				ResourceAttributes: map[string]string{"service.name": "cronic"},
+				MetricInterval:     60 * time.Second,
+			},
+		},
+		{
+			name: "sdk disabled",
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318",
+				"OTEL_SDK_DISABLED":           "true",
+			},
+			expected: nil,
+		},
+		{
+			name: "unsupported protocol",
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4317",
+				"OTEL_EXPORTER_OTLP_PROTOCOL": "grpc",
+			},
+			err: true,
+		},
+		{
+			name: "bad headers",
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318",
+				"OTEL_EXPORTER_OTLP_HEADERS":  "Authorization",
+			},
+			err: true,
+		},
+		{
+			name: "bad interval",
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318",
+				"OTEL_METRIC_EXPORT_INTERVAL": "soon",
+			},
+			err: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := ConfigFromEnv(func(key string) string { return tc.env[key] })
+
+			if tc.err {
+				assert.NotNil(t, err)
+				return
+			}
+
+			if assert.Nil(t, err) {
+				assert.Equal(t, tc.expected, config)
+			}
+		})
+	}
+}
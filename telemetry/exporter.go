@@ -0,0 +1,442 @@
+package telemetry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samgaw/cronic/cron"
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// How often to export spans, and how many to hold while the collector
+	// is unreachable (in excess, spans are dropped)
+	SPAN_EXPORT_INTERVAL = 5 * time.Second
+	SPAN_QUEUE_SIZE      = 2048
+
+	EXPORT_TIMEOUT = 10 * time.Second
+
+	// Bounds (in seconds) of the buckets of the run duration histogram
+	DURATION_BUCKETS = []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 600, 1800, 3600}
+
+	// Bounds (in seconds) of the buckets of the histogram of how late runs
+	// started
+	LAG_BUCKETS = []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 60}
+)
+
+// Exporter exports a span for each run, and metrics about runs and skips,
+// to an OpenTelemetry collector. It's notified of job events like any other
+// notifier, and sends them in the background.
+type Exporter struct {
+	config *Config
+	client *http.Client
+	logger *logrus.Entry
+
+	resource  otlpResource
+	startTime time.Time
+
+	mu        sync.Mutex
+	spans     []otlpSpan
+	runs      map[string]*counter
+	durations map[string]*histogram
+	lags      map[string]*histogram
+	skips     map[string]*counter
+	badLines  int64
+
+	// The last export error since Healthy was called
+	lastErr error
+
+	// Serializes exports, so that spans are sent in order
+	exportMu sync.Mutex
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+type counter struct {
+	attributes []otlpAttribute
+	value      int64
+}
+
+type histogram struct {
+	attributes []otlpAttribute
+	bounds     []float64
+	count      int64
+	sum        float64
+	buckets    []int64
+}
+
+func NewExporter(config *Config, logger *logrus.Entry) *Exporter {
+	e := &Exporter{
+		config:    config,
+		client:    &http.Client{Timeout: EXPORT_TIMEOUT},
+		logger:    logger,
+		resource:  otlpResource{Attributes: stringAttributes(config.ResourceAttributes)},
+		startTime: time.Now(),
+		runs:      make(map[string]*counter),
+		durations: make(map[string]*histogram),
+		lags:      make(map[string]*histogram),
+		skips:     make(map[string]*counter),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	go e.run()
+
+	return e
+}
+
+func (e *Exporter) Notify(event *cron.Event) {
+	switch event.Type {
+	case crontab.EventSuccess, crontab.EventFailure, crontab.EventTimeout:
+		if event.Result != nil {
+			e.recordRun(event)
+		}
+	case crontab.EventSkip:
+		e.recordSkip(event)
+	}
+}
+
+func (e *Exporter) CrontabParsed(tab *crontab.Crontab) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.badLines = int64(tab.BadLines)
+}
+
+// Close exports what's left, and stops the exporter.
+func (e *Exporter) Close() {
+	e.once.Do(func() { close(e.stop) })
+	<-e.done
+}
+
+func (e *Exporter) run() {
+	defer close(e.done)
+
+	spans := time.NewTicker(SPAN_EXPORT_INTERVAL)
+	defer spans.Stop()
+
+	metrics := time.NewTicker(e.config.MetricInterval)
+	defer metrics.Stop()
+
+	for {
+		select {
+		case <-spans.C:
+			e.exportSpans()
+		case <-metrics.C:
+			e.exportMetrics()
+		case <-e.stop:
+			e.exportSpans()
+			e.exportMetrics()
+			return
+		}
+	}
+}
+
+func (e *Exporter) recordRun(event *cron.Event) {
+	result := event.Result
+	attributes := jobAttributes(event)
+
+	status := otlpStatus{Code: statusCodeUnset}
+	outcome := "success"
+	if !result.Success {
+		status = otlpStatus{Code: statusCodeError, Message: result.Error}
+		outcome = string(event.Type)
+	}
+
+	spanAttributes := append(copyAttributes(attributes),
+		stringAttribute("cronic.run.id", result.RunID),
+		intAttribute("cronic.run.iteration", int64(result.Iteration)),
+	)
+	if result.ExitCode != nil {
+		spanAttributes = append(spanAttributes, intAttribute("process.exit.code", int64(*result.ExitCode)))
+	}
+
+	span := otlpSpan{
+		TraceID:           result.TraceID,
+		SpanID:            result.SpanID,
+		Name:              "cronic.run",
+		Kind:              spanKindInternal,
+		StartTimeUnixNano: unixNano(result.StartedAt),
+		EndTimeUnixNano:   unixNano(result.FinishedAt),
+		Attributes:        spanAttributes,
+		Status:            status,
+	}
+
+	runAttributes := append(copyAttributes(attributes), stringAttribute("cronic.run.result", outcome))
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.config.TracesEndpoint != "" {
+		if len(e.spans) < SPAN_QUEUE_SIZE {
+			e.spans = append(e.spans, span)
+		} else {
+			e.logger.Warn("CRONIC: Span queue is full, dropping span")
+		}
+	}
+
+	addCounter(e.runs, runAttributes, 1)
+	addHistogram(e.durations, attributes, DURATION_BUCKETS, result.FinishedAt.Sub(result.StartedAt).Seconds())
+	if result.ScheduledAt != nil {
+		addHistogram(e.lags, attributes, LAG_BUCKETS, result.StartedAt.Sub(*result.ScheduledAt).Seconds())
+	}
+}
+
+func (e *Exporter) recordSkip(event *cron.Event) {
+	attributes := append(jobAttributes(event), stringAttribute("cronic.skip.reason", event.SkipReason))
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	addCounter(e.skips, attributes, 1)
+}
+
+func addCounter(counters map[string]*counter, attributes []otlpAttribute, value int64) {
+	key := attributesKey(attributes)
+
+	c, ok := counters[key]
+	if !ok {
+		c = &counter{attributes: attributes}
+		counters[key] = c
+	}
+	c.value += value
+}
+
+func addHistogram(histograms map[string]*histogram, attributes []otlpAttribute, bounds []float64, value float64) {
+	key := attributesKey(attributes)
+
+	h, ok := histograms[key]
+	if !ok {
+		h = &histogram{attributes: attributes, bounds: bounds, buckets: make([]int64, len(bounds)+1)}
+		histograms[key] = h
+	}
+	h.count++
+	h.sum += value
+	h.buckets[sort.SearchFloat64s(bounds, value)]++
+}
+
+// jobAttributes describes the job an event is about. Named jobs are
+// identified by their name, rather than their position and command.
+func jobAttributes(event *cron.Event) []otlpAttribute {
+	var attributes []otlpAttribute
+	if event.Name != "" {
+		attributes = []otlpAttribute{
+			stringAttribute("cronic.job.name", event.Name),
+			stringAttribute("cronic.job.schedule", event.Schedule),
+		}
+	} else {
+		attributes = []otlpAttribute{
+			intAttribute("cronic.job.position", int64(event.Position)),
+			stringAttribute("cronic.job.schedule", event.Schedule),
+			stringAttribute("cronic.job.command", event.Command),
+		}
+	}
+
+	if event.Namespace != "" {
+		attributes = append(attributes, stringAttribute("cronic.job.namespace", event.Namespace))
+	}
+
+	for _, label := range stringAttributes(event.Labels) {
+		label.Key = "cronic.label." + label.Key
+		attributes = append(attributes, label)
+	}
+
+	return attributes
+}
+
+func copyAttributes(attributes []otlpAttribute) []otlpAttribute {
+	return append([]otlpAttribute(nil), attributes...)
+}
+
+// attributesKey identifies a set of attributes, to aggregate data points.
+func attributesKey(attributes []otlpAttribute) string {
+	var key strings.Builder
+	for _, attribute := range attributes {
+		key.WriteString(strconv.Quote(attribute.Key))
+		if attribute.Value.StringValue != nil {
+			key.WriteString(strconv.Quote(*attribute.Value.StringValue))
+		} else if attribute.Value.IntValue != nil {
+			key.WriteString(*attribute.Value.IntValue)
+		}
+		key.WriteByte(';')
+	}
+	return key.String()
+}
+
+func (e *Exporter) exportSpans() {
+	e.exportMu.Lock()
+	defer e.exportMu.Unlock()
+
+	e.mu.Lock()
+	spans := e.spans
+	e.spans = nil
+	e.mu.Unlock()
+
+	if len(spans) == 0 {
+		return
+	}
+
+	payload := otlpTraces{ResourceSpans: []otlpResourceSpans{{
+		Resource:   e.resource,
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: scopeName}, Spans: spans}},
+	}}}
+
+	if err := e.post(e.config.TracesEndpoint, payload); err != nil {
+		e.logger.Warnf("CRONIC: Failed to export %d spans: %v", len(spans), err)
+		e.setError(err)
+	}
+}
+
+func (e *Exporter) exportMetrics() {
+	if e.config.MetricsEndpoint == "" {
+		return
+	}
+
+	e.exportMu.Lock()
+	defer e.exportMu.Unlock()
+
+	payload := otlpMetrics{ResourceMetrics: []otlpResourceMetrics{{
+		Resource:     e.resource,
+		ScopeMetrics: []otlpScopeMetrics{{Scope: otlpScope{Name: scopeName}, Metrics: e.metrics(time.Now())}},
+	}}}
+
+	if err := e.post(e.config.MetricsEndpoint, payload); err != nil {
+		e.logger.Warnf("CRONIC: Failed to export metrics: %v", err)
+		e.setError(err)
+	}
+}
+
+func (e *Exporter) setError(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.lastErr = err
+}
+
+// Healthy reports whether an export failed since it was last called (see
+// cron.HealthChecker).
+func (e *Exporter) Healthy() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	err := e.lastErr
+	e.lastErr = nil
+
+	if err != nil {
+		return fmt.Errorf("failed to export telemetry: %v", err)
+	}
+	return nil
+}
+
+// metrics returns the current value of each metric (they are cumulative, so
+// nothing is lost if an export fails).
+func (e *Exporter) metrics(now time.Time) []otlpMetric {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	start := unixNano(e.startTime)
+	end := unixNano(now)
+
+	sum := func(counters map[string]*counter) *otlpSum {
+		points := make([]otlpNumberDataPoint, 0, len(counters))
+		for _, key := range sortedKeys(counters) {
+			c := counters[key]
+			points = append(points, otlpNumberDataPoint{
+				Attributes:        c.attributes,
+				StartTimeUnixNano: start,
+				TimeUnixNano:      end,
+				AsInt:             strconv.FormatInt(c.value, 10),
+			})
+		}
+		return &otlpSum{DataPoints: points, AggregationTemporality: aggregationTemporalityCumulative, IsMonotonic: true}
+	}
+
+	distribution := func(histograms map[string]*histogram) *otlpHistogram {
+		keys := make([]string, 0, len(histograms))
+		for key := range histograms {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		points := make([]otlpHistogramDataPoint, 0, len(histograms))
+		for _, key := range keys {
+			h := histograms[key]
+
+			buckets := make([]string, len(h.buckets))
+			for i, count := range h.buckets {
+				buckets[i] = strconv.FormatInt(count, 10)
+			}
+
+			points = append(points, otlpHistogramDataPoint{
+				Attributes:        h.attributes,
+				StartTimeUnixNano: start,
+				TimeUnixNano:      end,
+				Count:             strconv.FormatInt(h.count, 10),
+				Sum:               h.sum,
+				BucketCounts:      buckets,
+				ExplicitBounds:    h.bounds,
+			})
+		}
+		return &otlpHistogram{AggregationTemporality: aggregationTemporalityCumulative, DataPoints: points}
+	}
+
+	return []otlpMetric{
+		{Name: "cronic.runs", Description: "Completed runs, by result", Unit: "{run}", Sum: sum(e.runs)},
+		{Name: "cronic.run.duration", Description: "Duration of runs", Unit: "s", Histogram: distribution(e.durations)},
+		{Name: "cronic.run.lag", Description: "How late scheduled runs started", Unit: "s", Histogram: distribution(e.lags)},
+		{Name: "cronic.skips", Description: "Skipped runs, by reason", Unit: "{run}", Sum: sum(e.skips)},
+		{Name: "cronic.crontab.bad_lines", Description: "Crontab lines that were skipped", Unit: "{line}", Gauge: &otlpGauge{DataPoints: []otlpNumberDataPoint{{
+			Attributes:        []otlpAttribute{},
+			StartTimeUnixNano: start,
+			TimeUnixNano:      end,
+			AsInt:             strconv.FormatInt(e.badLines, 10),
+		}}}},
+	}
+}
+
+func sortedKeys(counters map[string]*counter) []string {
+	keys := make([]string, 0, len(counters))
+	for key := range counters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (e *Exporter) post(url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range e.config.Headers {
+		request.Header.Set(key, value)
+	}
+
+	response, err := e.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", response.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,253 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/samgaw/cronic/cron"
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func discardLogger() *logrus.Entry {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	return logrus.NewEntry(logger)
+}
+
+// newCollector returns a server recording the bodies it receives, by path.
+func newCollector() (*httptest.Server, chan *http.Request, chan []byte) {
+	requests := make(chan *http.Request, 10)
+	bodies := make(chan []byte, 10)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests <- r
+		bodies <- body
+	}))
+
+	return server, requests, bodies
+}
+
+func testResultEvent(success bool) *cron.Event {
+	exitCode := 0
+	eventType := crontab.EventSuccess
+	if !success {
+		exitCode = 3
+		eventType = crontab.EventFailure
+	}
+
+	started := time.Unix(1500000000, 0)
+	scheduled := started.Add(-250 * time.Millisecond)
+	result := &cron.RunResult{
+		RunID:       "run",
+		TraceID:     "0af7651916cd43dd8448eb211c80319c",
+		SpanID:      "b7ad6b7169203331",
+		Iteration:   2,
+		StartedAt:   started,
+		FinishedAt:  started.Add(2 * time.Second),
+		ScheduledAt: &scheduled,
+		LagSeconds:  0.25,
+		Success:     success,
+		ExitCode:    &exitCode,
+	}
+	if !success {
+		result.Error = "exit status 3"
+	}
+
+	return &cron.Event{
+		Type:      eventType,
+		Time:      result.FinishedAt,
+		Position:  1,
+		Schedule:  "@hourly",
+		Command:   "backup",
+		Namespace: "batch",
+		Labels:    map[string]string{"team": "data"},
+		RunID:     result.RunID,
+		Iteration: result.Iteration,
+		Result:    result,
+	}
+}
+
+func attributeMap(attributes []otlpAttribute) map[string]string {
+	values := make(map[string]string)
+	for _, attribute := range attributes {
+		if attribute.Value.StringValue != nil {
+			values[attribute.Key] = *attribute.Value.StringValue
+		} else if attribute.Value.IntValue != nil {
+			values[attribute.Key] = *attribute.Value.IntValue
+		}
+	}
+	return values
+}
+
+func TestExporterExportsSpans(t *testing.T) {
+	server, requests, bodies := newCollector()
+	defer server.Close()
+
+	config := &Config{
+		TracesEndpoint:     server.URL + "/v1/traces",
+		Headers:            map[string]string{"Authorization": "Bearer secret"},
+		ResourceAttributes: map[string]string{"service.name": "cronic"},
+		MetricInterval:     time.Hour,
+	}
+
+	exporter := NewExporter(config, discardLogger())
+	exporter.Notify(testResultEvent(false))
+	exporter.Close()
+
+	request := <-requests
+	assert.Equal(t, "/v1/traces", request.URL.Path)
+	assert.Equal(t, "Bearer secret", request.Header.Get("Authorization"))
+	assert.Equal(t, "application/json", request.Header.Get("Content-Type"))
+
+	var traces otlpTraces
+	if !assert.Nil(t, json.Unmarshal(<-bodies, &traces)) {
+		return
+	}
+
+	if !assert.Len(t, traces.ResourceSpans, 1) {
+		return
+	}
+	assert.Equal(t, map[string]string{"service.name": "cronic"}, attributeMap(traces.ResourceSpans[0].Resource.Attributes))
+
+	spans := traces.ResourceSpans[0].ScopeSpans[0].Spans
+	if !assert.Len(t, spans, 1) {
+		return
+	}
+
+	span := spans[0]
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", span.TraceID)
+	assert.Equal(t, "b7ad6b7169203331", span.SpanID)
+	assert.Equal(t, "1500000000000000000", span.StartTimeUnixNano)
+	assert.Equal(t, "1500000002000000000", span.EndTimeUnixNano)
+	assert.Equal(t, otlpStatus{Code: statusCodeError, Message: "exit status 3"}, span.Status)
+	assert.Equal(t, map[string]string{
+		"cronic.job.position":  "1",
+		"cronic.job.schedule":  "@hourly",
+		"cronic.job.command":   "backup",
+		"cronic.job.namespace": "batch",
+		"cronic.label.team":    "data",
+		"cronic.run.id":        "run",
+		"cronic.run.iteration": "2",
+		"process.exit.code":    "3",
+	}, attributeMap(span.Attributes))
+}
+
+func TestJobAttributesUseNames(t *testing.T) {
+	event := testResultEvent(true)
+	event.Name = "backup-db"
+
+	assert.Equal(t, map[string]string{
+		"cronic.job.name":      "backup-db",
+		"cronic.job.schedule":  "@hourly",
+		"cronic.job.namespace": "batch",
+		"cronic.label.team":    "data",
+	}, attributeMap(jobAttributes(event)))
+}
+
+func TestExporterExportsMetrics(t *testing.T) {
+	server, requests, bodies := newCollector()
+	defer server.Close()
+
+	config := &Config{
+		MetricsEndpoint:    server.URL + "/v1/metrics",
+		ResourceAttributes: map[string]string{"service.name": "cronic"},
+		MetricInterval:     time.Hour,
+	}
+
+	exporter := NewExporter(config, discardLogger())
+	exporter.Notify(testResultEvent(true))
+	exporter.Notify(testResultEvent(true))
+	exporter.Notify(testResultEvent(false))
+
+	skip := testResultEvent(true)
+	skip.Type = crontab.EventSkip
+	skip.Result = nil
+	skip.SkipReason = cron.SkipReasonRunning
+	exporter.Notify(skip)
+
+	exporter.CrontabParsed(&crontab.Crontab{BadLines: 3})
+
+	exporter.Close()
+
+	// No traces endpoint: only metrics are sent
+	request := <-requests
+	assert.Equal(t, "/v1/metrics", request.URL.Path)
+
+	var metrics otlpMetrics
+	if !assert.Nil(t, json.Unmarshal(<-bodies, &metrics)) {
+		return
+	}
+
+	byName := make(map[string]otlpMetric)
+	for _, metric := range metrics.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		byName[metric.Name] = metric
+	}
+
+	runs := byName["cronic.runs"].Sum
+	if assert.NotNil(t, runs) && assert.Len(t, runs.DataPoints, 2) {
+		counts := make(map[string]string)
+		for _, point := range runs.DataPoints {
+			counts[attributeMap(point.Attributes)["cronic.run.result"]] = point.AsInt
+		}
+		assert.Equal(t, map[string]string{"success": "2", "failure": "1"}, counts)
+		assert.True(t, runs.IsMonotonic)
+	}
+
+	durations := byName["cronic.run.duration"].Histogram
+	if assert.NotNil(t, durations) && assert.Len(t, durations.DataPoints, 1) {
+		point := durations.DataPoints[0]
+		assert.Equal(t, "3", point.Count)
+		assert.Equal(t, 6.0, point.Sum)
+		// 2s falls in the (1, 5] bucket
+		assert.Equal(t, "3", point.BucketCounts[3])
+		assert.Equal(t, "batch", attributeMap(point.Attributes)["cronic.job.namespace"])
+	}
+
+	lags := byName["cronic.run.lag"].Histogram
+	if assert.NotNil(t, lags) && assert.Len(t, lags.DataPoints, 1) {
+		point := lags.DataPoints[0]
+		assert.Equal(t, "3", point.Count)
+		// 250ms falls in the (0.1, 0.5] bucket
+		assert.Equal(t, "3", point.BucketCounts[3])
+		assert.Equal(t, LAG_BUCKETS, point.ExplicitBounds)
+	}
+
+	skips := byName["cronic.skips"].Sum
+	if assert.NotNil(t, skips) && assert.Len(t, skips.DataPoints, 1) {
+		assert.Equal(t, "1", skips.DataPoints[0].AsInt)
+		assert.Equal(t, "running", attributeMap(skips.DataPoints[0].Attributes)["cronic.skip.reason"])
+	}
+
+	badLines := byName["cronic.crontab.bad_lines"].Gauge
+	if assert.NotNil(t, badLines) && assert.Len(t, badLines.DataPoints, 1) {
+		assert.Equal(t, "3", badLines.DataPoints[0].AsInt)
+	}
+}
+
+func TestExporterReportsFailedExports(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	config := &Config{MetricsEndpoint: server.URL + "/v1/metrics", MetricInterval: time.Hour}
+
+	exporter := NewExporter(config, discardLogger())
+	assert.Nil(t, exporter.Healthy())
+
+	exporter.Notify(testResultEvent(true))
+	exporter.Close()
+
+	if err := exporter.Healthy(); assert.NotNil(t, err) {
+		assert.Regexp(t, "503", err.Error())
+	}
+	assert.Nil(t, exporter.Healthy())
+}
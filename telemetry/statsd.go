@@ -0,0 +1,152 @@
+package telemetry
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/samgaw/cronic/cron"
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// Longer tags are truncated (Datadog drops tags over 200 characters)
+	STATSD_MAX_TAG_LENGTH = 200
+
+	statsdTagReplacer = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", " ")
+)
+
+// StatsD sends metrics about runs to a StatsD server over UDP, with tags in
+// the DogStatsD format (supported by Datadog, Telegraf, and others):
+//
+//	PREFIX.runs                  count of completed runs, tagged with result
+//	PREFIX.failures              count of failed runs
+//	PREFIX.consecutive_failures  gauge of how many runs in a row failed
+//	PREFIX.run.duration          timing of runs, in milliseconds
+//	PREFIX.run.lag               timing of how late scheduled runs started
+//	PREFIX.skips                 count of skipped runs, tagged with reason
+//	PREFIX.crontab.bad_lines     gauge of the crontab lines that were skipped
+type StatsD struct {
+	conn   net.Conn
+	prefix string
+	logger *logrus.Entry
+}
+
+func NewStatsD(addr string, prefix string, logger *logrus.Entry) (*StatsD, error) {
+	// UDP is connectionless: this only resolves the address.
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("CRONIC: Bad StatsD address: %s (%v)", addr, err)
+	}
+
+	if prefix != "" && !strings.HasSuffix(prefix, ".") {
+		prefix += "."
+	}
+
+	return &StatsD{conn: conn, prefix: prefix, logger: logger}, nil
+}
+
+func (s *StatsD) Notify(event *cron.Event) {
+	tags := statsdTags(event)
+
+	switch event.Type {
+	case crontab.EventSuccess, crontab.EventFailure, crontab.EventTimeout:
+		if event.Result == nil {
+			return
+		}
+
+		result := "success"
+		if !event.Result.Success {
+			result = string(event.Type)
+		}
+
+		duration := event.Result.FinishedAt.Sub(event.Result.StartedAt)
+
+		metrics := []string{
+			s.metric("runs", "1", "c", append(tags, "result:"+result)),
+			s.metric("run.duration", strconv.FormatInt(duration.Nanoseconds()/1e6, 10), "ms", tags),
+		}
+		if event.Result.ScheduledAt != nil {
+			lag := event.Result.StartedAt.Sub(*event.Result.ScheduledAt)
+			metrics = append(metrics, s.metric("run.lag", strconv.FormatInt(lag.Nanoseconds()/1e6, 10), "ms", tags))
+		}
+		if !event.Result.Success {
+			metrics = append(metrics, s.metric("failures", "1", "c", tags))
+		}
+		metrics = append(metrics, s.metric("consecutive_failures", strconv.Itoa(event.Result.ConsecutiveFailures), "g", tags))
+
+		s.send(metrics)
+	case crontab.EventSkip:
+		s.send([]string{s.metric("skips", "1", "c", append(tags, "reason:"+event.SkipReason))})
+	}
+}
+
+func (s *StatsD) CrontabParsed(tab *crontab.Crontab) {
+	s.send([]string{s.metric("crontab.bad_lines", strconv.Itoa(tab.BadLines), "g", nil)})
+}
+
+func (s *StatsD) Close() {
+	s.conn.Close()
+}
+
+func (s *StatsD) metric(name string, value string, metricType string, tags []string) string {
+	metric := s.prefix + name + ":" + value + "|" + metricType
+	if len(tags) > 0 {
+		metric += "|#" + strings.Join(tags, ",")
+	}
+	return metric
+}
+
+// send sends metrics in a single datagram. Since it's UDP, this doesn't
+// block, and errors only mean the server is unreachable.
+func (s *StatsD) send(metrics []string) {
+	if _, err := s.conn.Write([]byte(strings.Join(metrics, "\n"))); err != nil {
+		s.logger.Debugf("CRONIC: Failed to send metrics to StatsD: %v", err)
+	}
+}
+
+// statsdTags describes the job an event is about. Named jobs are identified
+// by their name, rather than their position and command.
+func statsdTags(event *cron.Event) []string {
+	var tags []string
+	if event.Name != "" {
+		tags = []string{
+			statsdTag("job_name", event.Name),
+			statsdTag("schedule", event.Schedule),
+		}
+	} else {
+		tags = []string{
+			statsdTag("job_position", strconv.Itoa(event.Position)),
+			statsdTag("schedule", event.Schedule),
+			statsdTag("command", event.Command),
+		}
+	}
+
+	if event.Namespace != "" {
+		tags = append(tags, statsdTag("namespace", event.Namespace))
+	}
+
+	keys := make([]string, 0, len(event.Labels))
+	for key := range event.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		tags = append(tags, statsdTag(key, event.Labels[key]))
+	}
+
+	return tags
+}
+
+func statsdTag(key string, value string) string {
+	tag := statsdTagReplacer.Replace(key + ":" + value)
+	if len(tag) > STATSD_MAX_TAG_LENGTH {
+		tag = tag[:STATSD_MAX_TAG_LENGTH]
+	}
+	return tag
+}
@@ -0,0 +1,98 @@
+package telemetry
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samgaw/cronic/cron"
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newStatsDServer returns a UDP server, and a channel of the datagrams it
+// receives.
+func newStatsDServer(t *testing.T) (net.PacketConn, chan string) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	datagrams := make(chan string, 10)
+
+	go func() {
+		buffer := make([]byte, 65536)
+		for {
+			n, _, err := conn.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+			datagrams <- string(buffer[:n])
+		}
+	}()
+
+	return conn, datagrams
+}
+
+func expectDatagram(t *testing.T, datagrams chan string) []string {
+	select {
+	case datagram := <-datagrams:
+		return strings.Split(datagram, "\n")
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for metrics")
+		return nil
+	}
+}
+
+func TestStatsDSendsMetrics(t *testing.T) {
+	server, datagrams := newStatsDServer(t)
+	defer server.Close()
+
+	statsd, err := NewStatsD(server.LocalAddr().String(), "cronic", discardLogger())
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer statsd.Close()
+
+	tags := "job_position:1,schedule:@hourly,command:backup,namespace:batch,team:data"
+
+	statsd.Notify(testResultEvent(true))
+	assert.Equal(t, []string{
+		"cronic.runs:1|c|#" + tags + ",result:success",
+		"cronic.run.duration:2000|ms|#" + tags,
+		"cronic.run.lag:250|ms|#" + tags,
+		"cronic.consecutive_failures:0|g|#" + tags,
+	}, expectDatagram(t, datagrams))
+
+	statsd.Notify(testResultEvent(false))
+	assert.Equal(t, []string{
+		"cronic.runs:1|c|#" + tags + ",result:failure",
+		"cronic.run.duration:2000|ms|#" + tags,
+		"cronic.run.lag:250|ms|#" + tags,
+		"cronic.failures:1|c|#" + tags,
+		"cronic.consecutive_failures:0|g|#" + tags,
+	}, expectDatagram(t, datagrams))
+
+	skip := testResultEvent(true)
+	skip.Type = crontab.EventSkip
+	skip.Result = nil
+	skip.SkipReason = cron.SkipReasonPaused
+	statsd.Notify(skip)
+	assert.Equal(t, []string{"cronic.skips:1|c|#" + tags + ",reason:paused"}, expectDatagram(t, datagrams))
+
+	// Named jobs are tagged with their name instead
+	named := testResultEvent(true)
+	named.Name = "backup-db"
+	statsd.Notify(named)
+	assert.Equal(t, "cronic.runs:1|c|#job_name:backup-db,schedule:@hourly,namespace:batch,team:data,result:success", expectDatagram(t, datagrams)[0])
+
+	statsd.CrontabParsed(&crontab.Crontab{BadLines: 2})
+	assert.Equal(t, []string{"cronic.crontab.bad_lines:2|g"}, expectDatagram(t, datagrams))
+}
+
+func TestStatsdTag(t *testing.T) {
+	assert.Equal(t, "command:a_b_c_d", statsdTag("command", "a,b|c#d"))
+	assert.Equal(t, STATSD_MAX_TAG_LENGTH, len(statsdTag("command", strings.Repeat("x", 500))))
+}
@@ -0,0 +1,88 @@
+// Package watch watches files for changes, to reload them without a signal.
+package watch
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// How long to wait for a file's changes to settle before reading it,
+	// since editors (and Kubernetes) change a file in several steps
+	DEBOUNCE = 200 * time.Millisecond
+)
+
+// Watcher watches a file for changes to its contents.
+type Watcher struct {
+	path     string
+	watcher  *fsnotify.Watcher
+	contents []byte
+}
+
+// New starts watching the file at path. Its directory is watched rather than
+// the file itself, so that changes that replace the file are noticed too:
+// e.g. editors that write a new file and rename it, or Kubernetes, which
+// mounts the files of a ConfigMap as symlinks into a directory it swaps.
+func New(path string) (*Watcher, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	return &Watcher{path: path, watcher: watcher, contents: contents}, nil
+}
+
+// Run calls onChange with the new contents of the file each time they
+// change, until ctx is done.
+func (w *Watcher) Run(ctx context.Context, logger *logrus.Entry, onChange func(contents []byte)) {
+	defer w.watcher.Close()
+
+	// Only set while waiting for changes to settle
+	var settled <-chan time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.watcher.Events:
+			// Whatever changed in the directory, the contents of
+			// the file are what matters
+			settled = time.After(DEBOUNCE)
+		case err := <-w.watcher.Errors:
+			logger.Warnf("CRONIC: Error watching %s: %v", w.path, err)
+		case <-settled:
+			settled = nil
+
+			contents, err := ioutil.ReadFile(w.path)
+			if err != nil {
+				// e.g. the file is being replaced, which will
+				// be another event
+				logger.Warnf("CRONIC: Failed to read %s: %v", w.path, err)
+				continue
+			}
+
+			if bytes.Equal(contents, w.contents) {
+				continue
+			}
+
+			w.contents = contents
+			onChange(contents)
+		}
+	}
+}
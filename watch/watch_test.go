@@ -0,0 +1,106 @@
+package watch
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func discardLogger() *logrus.Entry {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	return logrus.NewEntry(logger)
+}
+
+// startWatching watches path, and returns a channel of its new contents.
+func startWatching(t *testing.T, path string) (chan string, context.CancelFunc) {
+	watcher, err := New(path)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	changes := make(chan string, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go watcher.Run(ctx, discardLogger(), func(contents []byte) {
+		changes <- string(contents)
+	})
+
+	return changes, cancel
+}
+
+func expectChange(t *testing.T, changes chan string, expected string) {
+	select {
+	case contents := <-changes:
+		assert.Equal(t, expected, contents)
+	case <-time.After(5 * time.Second):
+		t.Errorf("timed out waiting for %q", expected)
+	}
+}
+
+func expectNoChange(t *testing.T, changes chan string) {
+	select {
+	case contents := <-changes:
+		t.Errorf("unexpected change: %q", contents)
+	case <-time.After(3 * DEBOUNCE):
+	}
+}
+
+func TestWatcherNoticesChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cronic-watch")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "crontab")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("@hourly true\n"), 0644))
+
+	changes, cancel := startWatching(t, path)
+	defer cancel()
+
+	assert.Nil(t, ioutil.WriteFile(path, []byte("@daily true\n"), 0644))
+	expectChange(t, changes, "@daily true\n")
+
+	// Changes that don't change the contents are ignored
+	now := time.Now()
+	assert.Nil(t, os.Chtimes(path, now, now))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "other"), []byte("hi"), 0644))
+	expectNoChange(t, changes)
+
+	// Like editors that replace the file
+	assert.Nil(t, ioutil.WriteFile(path+".tmp", []byte("@weekly true\n"), 0644))
+	assert.Nil(t, os.Rename(path+".tmp", path))
+	expectChange(t, changes, "@weekly true\n")
+}
+
+func TestWatcherNoticesSymlinkSwaps(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cronic-watch")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// Like the files of a ConfigMap in Kubernetes: crontab links to
+	// ..data/crontab, and ..data links to a directory of the current
+	// version, which is swapped on updates
+	for version, contents := range map[string]string{"v1": "@hourly true\n", "v2": "@daily true\n"} {
+		assert.Nil(t, os.Mkdir(filepath.Join(dir, version), 0755))
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, version, "crontab"), []byte(contents), 0644))
+	}
+	assert.Nil(t, os.Symlink("v1", filepath.Join(dir, "..data")))
+	assert.Nil(t, os.Symlink("..data/crontab", filepath.Join(dir, "crontab")))
+
+	changes, cancel := startWatching(t, filepath.Join(dir, "crontab"))
+	defer cancel()
+
+	assert.Nil(t, os.Symlink("v2", filepath.Join(dir, "..data_tmp")))
+	assert.Nil(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+	expectChange(t, changes, "@daily true\n")
+}
@@ -0,0 +1,244 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samgaw/cronic/cron"
+)
+
+var (
+	// How long requests other than streaming output can take
+	CLIENT_TIMEOUT = 10 * time.Second
+)
+
+// Client controls a cronic daemon through the API of its Server (see
+// "cronic ctl").
+type Client struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// NewClient returns a client for the daemon serving its API on addr: a URL
+// (e.g. http://localhost:8080), a host and port, or unix:PATH for a daemon
+// listening on a Unix socket (see Listen). token is presented as a bearer
+// token, if set.
+func NewClient(addr string, token string) (*Client, error) {
+	c := &Client{token: token, client: &http.Client{}}
+
+	switch {
+	case strings.HasPrefix(addr, "unix:"):
+		path := strings.TrimPrefix(addr, "unix:")
+		if path == "" {
+			return nil, fmt.Errorf("CRONIC: Bad address: %q (expected e.g. unix:/run/cronic.sock)", addr)
+		}
+
+		c.url = "http://cronic"
+		c.client.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", path)
+			},
+		}
+	case strings.Contains(addr, "://"):
+		u, err := url.Parse(addr)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("CRONIC: Bad address: %q (expected e.g. http://localhost:8080)", addr)
+		}
+		c.url = strings.TrimSuffix(addr, "/")
+	default:
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return nil, fmt.Errorf("CRONIC: Bad address: %q (expected e.g. localhost:8080)", addr)
+		}
+		if strings.HasPrefix(addr, ":") {
+			addr = "localhost" + addr
+		}
+		c.url = "http://" + addr
+	}
+
+	return c, nil
+}
+
+// Jobs returns all jobs (or those in namespace, if set).
+func (c *Client) Jobs(namespace string) ([]cron.JobSnapshot, error) {
+	path := "/api/jobs"
+	if namespace != "" {
+		path += "?namespace=" + url.QueryEscape(namespace)
+	}
+
+	var jobs []cron.JobSnapshot
+	err := c.do(http.MethodGet, path, &jobs)
+	return jobs, err
+}
+
+// Job returns a job, by name or position.
+func (c *Client) Job(id string) (*JobDetail, error) {
+	var job JobDetail
+	if err := c.do(http.MethodGet, jobPath(id, ""), &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Runs returns up to limit of the last runs of a job, most recent first.
+func (c *Client) Runs(id string, limit int) ([]cron.RunResult, error) {
+	var runs []cron.RunResult
+	err := c.do(http.MethodGet, jobPath(id, "runs")+"?limit="+strconv.Itoa(limit), &runs)
+	return runs, err
+}
+
+// Run triggers a run of a job.
+func (c *Client) Run(id string) (*cron.JobSnapshot, error) {
+	return c.act(id, "run")
+}
+
+// Cancel cancels the current run of a job.
+func (c *Client) Cancel(id string) (*cron.JobSnapshot, error) {
+	return c.act(id, "cancel")
+}
+
+// Pause stops scheduling a job.
+func (c *Client) Pause(id string) (*cron.JobSnapshot, error) {
+	return c.act(id, "pause")
+}
+
+// Resume resumes scheduling a job.
+func (c *Client) Resume(id string) (*cron.JobSnapshot, error) {
+	return c.act(id, "resume")
+}
+
+// Follow calls onLine with the recent output of a job, then with its
+// output as it's emitted, until ctx is done (or the daemon goes away).
+func (c *Client) Follow(ctx context.Context, id string, onLine func(cron.OutputLine)) error {
+	req, err := c.newRequest(http.MethodGet, jobPath(id, "output"))
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := responseError(resp); err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data := strings.TrimPrefix(scanner.Text(), "data: ")
+		if data == scanner.Text() {
+			continue
+		}
+
+		var line cron.OutputLine
+		if err := json.Unmarshal([]byte(data), &line); err != nil {
+			return err
+		}
+		onLine(line)
+	}
+
+	if ctx.Err() != nil {
+		return nil
+	}
+	return scanner.Err()
+}
+
+func (c *Client) act(id string, action string) (*cron.JobSnapshot, error) {
+	var job cron.JobSnapshot
+	if err := c.do(http.MethodPost, jobPath(id, action), &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (c *Client) do(method string, path string, result interface{}) error {
+	req, err := c.newRequest(method, path)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), CLIENT_TIMEOUT)
+	defer cancel()
+
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := responseError(resp); err != nil {
+		return err
+	}
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+func (c *Client) newRequest(method string, path string) (*http.Request, error) {
+	req, err := http.NewRequest(method, c.url+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set(RequestHeader, "1")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return req, nil
+}
+
+func jobPath(id string, action string) string {
+	path := "/api/jobs/" + url.PathEscape(id)
+	if action != "" {
+		path += "/" + action
+	}
+	return path
+}
+
+// responseError returns the error the server responded with, if any.
+func responseError(resp *http.Response) error {
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxRequestSize))
+	message := strings.TrimSpace(string(body))
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound && (message == "" || message == "404 page not found"):
+		return fmt.Errorf("no such job")
+	case resp.StatusCode == http.StatusUnauthorized:
+		return fmt.Errorf("unauthorized (see -api-token)")
+	case message != "":
+		return fmt.Errorf("%s", message)
+	default:
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+}
+
+// Listen listens on addr: a TCP address (e.g. :8080), or unix:PATH for a
+// Unix socket, replacing the socket a previous cronic may have left there.
+func Listen(addr string) (net.Listener, error) {
+	if !strings.HasPrefix(addr, "unix:") {
+		return net.Listen("tcp", addr)
+	}
+
+	path := strings.TrimPrefix(addr, "unix:")
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	return net.Listen("unix", path)
+}
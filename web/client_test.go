@@ -0,0 +1,123 @@
+package web
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/samgaw/cronic/cron"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientControlsJobs(t *testing.T) {
+	server, jobs := newTestServer("secret")
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	client, err := NewClient(httpServer.URL, "secret")
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	snapshots, err := client.Jobs("")
+	if assert.Nil(t, err) && assert.Len(t, snapshots, 2) {
+		assert.Equal(t, "false", snapshots[1].Command)
+	}
+
+	snapshot, err := client.Pause("1")
+	if assert.Nil(t, err) {
+		assert.True(t, snapshot.Paused)
+		assert.True(t, jobs[1].Paused())
+	}
+
+	_, err = client.Resume("1")
+	assert.Nil(t, err)
+	assert.False(t, jobs[1].Paused())
+
+	_, err = client.Run("0")
+	assert.Nil(t, err)
+
+	detail, err := client.Job("0")
+	if assert.Nil(t, err) {
+		assert.Equal(t, "true", detail.Command)
+	}
+
+	// The server's errors are reported
+	_, err = client.Run("0")
+	assert.NotNil(t, err)
+
+	_, err = client.Cancel("1")
+	assert.NotNil(t, err)
+
+	_, err = client.Job("nope")
+	assert.EqualError(t, err, "no such job")
+
+	err = client.Follow(context.Background(), "nope", func(cron.OutputLine) {})
+	assert.EqualError(t, err, "no such job")
+
+	_, err = client.Runs("0", 10)
+	assert.EqualError(t, err, "run history is disabled (see -history-db or -state-store)")
+
+	client, _ = NewClient(httpServer.URL, "")
+	_, err = client.Pause("1")
+	assert.EqualError(t, err, "unauthorized (see -api-token)")
+}
+
+func TestClientConnectsToUnixSockets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cronic-web")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	addr := "unix:" + filepath.Join(dir, "cronic.sock")
+
+	listener, err := Listen(addr)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	server, _ := newTestServer("")
+	httpServer := &http.Server{Handler: server}
+	go httpServer.Serve(listener)
+	defer httpServer.Close()
+
+	client, err := NewClient(addr, "")
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	snapshots, err := client.Jobs("")
+	assert.Nil(t, err)
+	assert.Len(t, snapshots, 2)
+}
+
+var newClientTestCases = []struct {
+	addr string
+	url  string
+}{
+	{"http://localhost:8080/", "http://localhost:8080"},
+	{"https://cronic.example.com", "https://cronic.example.com"},
+	{"web-1:8080", "http://web-1:8080"},
+	{":8080", "http://localhost:8080"},
+	{"unix:/run/cronic.sock", "http://cronic"},
+	{"unix:", ""},
+	{"ftp://localhost", ""},
+	{"localhost", ""},
+}
+
+func TestNewClient(t *testing.T) {
+	for _, tt := range newClientTestCases {
+		client, err := NewClient(tt.addr, "")
+		if tt.url == "" {
+			assert.NotNil(t, err, tt.addr)
+		} else if assert.Nil(t, err, tt.addr) {
+			assert.Equal(t, tt.url, client.url, tt.addr)
+		}
+	}
+}
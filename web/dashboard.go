@@ -0,0 +1,234 @@
+package web
+
+import (
+	"net/http"
+)
+
+func (s *Server) serveDashboard(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(dashboardHTML))
+}
+
+// The dashboard is a single static page: everything it displays is loaded
+// from the JSON API, so it doesn't need any templating.
+const dashboardHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Cronic</title>
+<style>
+  body { font-family: sans-serif; margin: 2em; color: #222; }
+  table { border-collapse: collapse; width: 100%; }
+  th, td { text-align: left; padding: 0.4em 0.8em; border-bottom: 1px solid #ddd; }
+  code { font-size: 0.9em; }
+  .ok { color: #2a7a2a; }
+  .failed { color: #b22; }
+  .paused { color: #a60; }
+  pre { background: #111; color: #eee; padding: 1em; height: 20em; overflow: auto; }
+  .stderr { color: #f88; }
+</style>
+</head>
+<body>
+<h1>Cronic</h1>
+<table>
+  <thead>
+    <tr><th>#</th><th>Schedule</th><th>Command</th><th>Next run</th><th>State</th><th>Last result</th><th></th></tr>
+  </thead>
+  <tbody id="jobs"></tbody>
+</table>
+<h2 id="output-title" hidden></h2>
+<pre id="output" hidden></pre>
+<script>
+"use strict";
+
+var source = null;
+
+function text(value) {
+  var span = document.createElement("span");
+  span.textContent = value;
+  return span;
+}
+
+function cell(row, content) {
+  var td = document.createElement("td");
+  td.appendChild(typeof content === "string" ? text(content) : content);
+  row.appendChild(td);
+}
+
+function button(label, onclick) {
+  var b = document.createElement("button");
+  b.textContent = label;
+  b.onclick = onclick;
+  return b;
+}
+
+function headers() {
+  var h = {"X-Cronic-Request": "1"};
+  var token = sessionStorage.getItem("cronic-token");
+  if (token) {
+    h["Authorization"] = "Bearer " + token;
+  }
+  return h;
+}
+
+// askToken prompts for the API token when a request was refused without it,
+// and returns whether one was given.
+function askToken(what) {
+  var token = prompt(what + " requires an API token:");
+  if (token) {
+    sessionStorage.setItem("cronic-token", token);
+  }
+  return !!token;
+}
+
+function send(method, path) {
+  fetch(path, {method: method, headers: headers()}).then(function(response) {
+    if (response.status === 401) {
+      if (askToken("Controlling jobs")) {
+        send(method, path);
+      }
+      return;
+    }
+    if (!response.ok) {
+      response.text().then(function(message) { alert(message); });
+    }
+    refresh();
+  });
+}
+
+function id(job) {
+  return encodeURIComponent(job.name || String(job.position));
+}
+
+function label(job) {
+  return job.name ? job.name : "#" + job.position;
+}
+
+function post(job, action) {
+  send("POST", "api/jobs/" + id(job) + "/" + action);
+}
+
+function remove(job) {
+  if (confirm("Delete job " + label(job) + ": " + job.command + "?")) {
+    send("DELETE", "api/jobs/" + id(job));
+  }
+}
+
+function state(job) {
+  var s = text(job.running ? "running since " + new Date(job.running_since).toLocaleString() : "idle");
+  if (job.paused) {
+    s.textContent += ", paused since " + new Date(job.paused_since).toLocaleString();
+    s.className = "paused";
+  }
+  if (job.all_paused) {
+    s.textContent += ", all jobs paused";
+    s.className = "paused";
+  }
+  return s;
+}
+
+function result(job) {
+  var r = job.last_result;
+  if (!r) {
+    return text("never ran");
+  }
+  var s = text((r.success ? "succeeded" : "failed: " + r.error) + " at " + new Date(r.finished_at).toLocaleString());
+  s.className = r.success ? "ok" : "failed";
+  return s;
+}
+
+function tail(job) {
+  if (source) {
+    source.abort();
+  }
+
+  var title = document.getElementById("output-title");
+  var output = document.getElementById("output");
+  title.textContent = "Output of job " + label(job) + ": " + job.command;
+  title.hidden = false;
+  output.textContent = "";
+  output.hidden = false;
+
+  // Output requires the token, which EventSource can't send: the events are
+  // read off a fetch instead
+  source = new AbortController();
+  fetch("api/jobs/" + id(job) + "/output", {headers: headers(), signal: source.signal}).then(function(response) {
+    if (response.status === 401) {
+      if (askToken("Following output")) {
+        tail(job);
+      }
+      return;
+    }
+
+    var reader = response.body.getReader();
+    var decoder = new TextDecoder();
+    var buffered = "";
+
+    function read() {
+      return reader.read().then(function(chunk) {
+        if (chunk.done) {
+          return;
+        }
+        buffered += decoder.decode(chunk.value, {stream: true});
+        var events = buffered.split("\n\n");
+        buffered = events.pop();
+        events.forEach(function(event) {
+          event.split("\n").forEach(function(field) {
+            if (field.indexOf("data: ") === 0) {
+              var line = JSON.parse(field.slice("data: ".length));
+              var span = text("[" + line.iteration + "] " + line.line + "\n");
+              span.className = line.channel;
+              output.appendChild(span);
+              output.scrollTop = output.scrollHeight;
+            }
+          });
+        });
+        return read();
+      });
+    }
+    return read();
+  }).catch(function() {});
+}
+
+function render(jobs) {
+  var tbody = document.getElementById("jobs");
+  tbody.innerHTML = "";
+
+  jobs.forEach(function(job) {
+    var row = document.createElement("tr");
+    cell(row, label(job));
+    cell(row, job.schedule);
+    var command = document.createElement("code");
+    command.textContent = job.command;
+    cell(row, command);
+    cell(row, job.next_run ? new Date(job.next_run).toLocaleString() : "never");
+    cell(row, state(job));
+    cell(row, result(job));
+
+    var actions = document.createElement("span");
+    actions.appendChild(button("Run now", function() { post(job, "run"); }));
+    actions.appendChild(button(job.paused ? "Resume" : "Pause", function() { post(job, job.paused ? "resume" : "pause"); }));
+    actions.appendChild(button("Tail", function() { tail(job); }));
+    if (job.managed) {
+      actions.appendChild(button("Delete", function() { remove(job); }));
+    }
+    cell(row, actions);
+
+    tbody.appendChild(row);
+  });
+}
+
+function refresh() {
+  fetch("api/jobs").then(function(response) { return response.json(); }).then(render);
+}
+
+refresh();
+setInterval(refresh, 2000);
+</script>
+</body>
+</html>
+`
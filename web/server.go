@@ -0,0 +1,507 @@
+package web
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samgaw/cronic/cron"
+	"github.com/samgaw/cronic/crontab"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Server serves the dashboard and the JSON API it's built on:
+//
+//	GET    /                       the dashboard
+//	GET    /api/jobs               all jobs (or those in ?namespace=)
+//	POST   /api/jobs               create a managed job
+//	GET    /api/jobs/{id}          a single job, with its recent output
+//	PUT    /api/jobs/{id}          replace a managed job
+//	DELETE /api/jobs/{id}          delete a managed job
+//	GET    /api/jobs/{id}/output   the job's output, as server-sent events
+//	GET    /api/jobs/{id}/runs     the job's last runs (?limit=, 20 by default)
+//	POST   /api/jobs/{id}/run      trigger a run of the job
+//	POST   /api/jobs/{id}/cancel   cancel the job's current run
+//	POST   /api/jobs/{id}/pause    stop scheduling the job
+//	POST   /api/jobs/{id}/resume   resume scheduling the job
+//	GET    /api/runs/{id}/output   the archived output of a run
+//	GET    /api/blackout           the global blackout windows
+//	PUT    /api/blackout           replace the global blackout windows
+//
+// Jobs are identified by their name, or by their position (crontab jobs
+// first, then managed jobs). If a token is set, requests other than GET, and
+// requests for jobs' output (live, recent or archived), must present it as a
+// bearer token. If it isn't, requests other than GET must set the
+// X-Cronic-Request header instead, which other sites' pages can't make
+// browsers send.
+type Server struct {
+	// How the jobs of requests are parsed (like by the zero Parser if nil),
+	// which should be how the managed crontab is
+	Parser *crontab.Parser
+
+	registry *cron.Registry
+	archive  *cron.Archive
+	state    cron.StateStore
+	token    string
+	logger   *logrus.Entry
+}
+
+// JobDetail is a job, along with its recent output.
+type JobDetail struct {
+	cron.JobSnapshot
+	Output []cron.OutputLine `json:"output"`
+}
+
+// jobRequest is the body of requests creating or replacing a job.
+type jobRequest struct {
+	Name        string            `json:"name"`
+	Schedule    string            `json:"schedule"`
+	Command     string            `json:"command"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// blackoutBody is the body of requests and responses about the global
+// blackout (see crontab.ParseBlackout).
+type blackoutBody struct {
+	Blackout string `json:"blackout"`
+
+	// When the blackout window in progress ends, if there's one
+	Until *time.Time `json:"until,omitempty"`
+}
+
+// The header that requests other than GET must set when there's no token (to
+// any value), so that other sites can't have browsers send them (CSRF).
+const RequestHeader = "X-Cronic-Request"
+
+// Job definitions are small: this is generous.
+const maxRequestSize = 64 * 1024
+
+// How many runs /api/jobs/{id}/runs returns, by default and at most
+const (
+	defaultRunsLimit = 20
+	maxRunsLimit     = 1000
+)
+
+// NewServer serves the jobs of registry, with the output of their runs in
+// archive and their history in state (either of which can be nil).
+func NewServer(registry *cron.Registry, archive *cron.Archive, state cron.StateStore, token string, logger *logrus.Entry) *Server {
+	return &Server{registry: registry, archive: archive, state: state, token: token, logger: logger}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+	parts := strings.Split(path, "/")
+
+	if (r.Method != http.MethodGet || servesOutput(parts)) && !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="cronic"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method != http.MethodGet && s.token == "" && r.Header.Get(RequestHeader) == "" {
+		http.Error(w, "requests other than GET must set the "+RequestHeader+" header", http.StatusForbidden)
+		return
+	}
+
+	if path == "" {
+		s.serveDashboard(w, r)
+		return
+	}
+
+	if len(parts) == 4 && parts[0] == "api" && parts[1] == "runs" && parts[3] == "output" {
+		if allowMethod(w, r, http.MethodGet) {
+			s.serveArchivedOutput(w, r, parts[2])
+		}
+		return
+	}
+
+	if path == "api/blackout" {
+		if allowMethod(w, r, http.MethodGet, http.MethodPut) {
+			s.serveBlackout(w, r)
+		}
+		return
+	}
+
+	if len(parts) < 2 || parts[0] != "api" || parts[1] != "jobs" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if len(parts) == 2 {
+		if !allowMethod(w, r, http.MethodGet, http.MethodPost) {
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			s.createJob(w, r)
+			return
+		}
+
+		namespace := r.URL.Query().Get("namespace")
+
+		jobs := s.registry.Jobs()
+		snapshots := make([]cron.JobSnapshot, 0, len(jobs))
+		for _, status := range jobs {
+			if namespace == "" || status.Job.Namespace == namespace {
+				snapshots = append(snapshots, status.Snapshot())
+			}
+		}
+
+		writeJSON(w, http.StatusOK, snapshots)
+		return
+	}
+
+	status := s.findJob(parts[2])
+	if status == nil || len(parts) > 4 {
+		http.NotFound(w, r)
+		return
+	}
+
+	action := ""
+	if len(parts) == 4 {
+		action = parts[3]
+	}
+
+	switch action {
+	case "":
+		if !allowMethod(w, r, http.MethodGet, http.MethodPut, http.MethodDelete) {
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPut:
+			s.updateJob(w, r, status)
+		case http.MethodDelete:
+			s.deleteJob(w, status)
+		default:
+			writeJSON(w, http.StatusOK, JobDetail{status.Snapshot(), status.Output()})
+		}
+	case "output":
+		if allowMethod(w, r, http.MethodGet) {
+			s.streamOutput(w, r, status)
+		}
+	case "runs":
+		if allowMethod(w, r, http.MethodGet) {
+			s.serveRuns(w, r, status)
+		}
+	case "run":
+		if allowMethod(w, r, http.MethodPost) {
+			s.jobLogger(status).Info("CRONIC: Run requested")
+			if err := status.Trigger(); err != nil {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			writeJSON(w, http.StatusAccepted, status.Snapshot())
+		}
+	case "cancel":
+		if allowMethod(w, r, http.MethodPost) {
+			if err := status.Cancel(); err != nil {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			s.jobLogger(status).Info("CRONIC: Run cancelled")
+			writeJSON(w, http.StatusAccepted, status.Snapshot())
+		}
+	case "pause":
+		if allowMethod(w, r, http.MethodPost) {
+			status.Pause()
+			s.jobLogger(status).Info("CRONIC: Job paused")
+			writeJSON(w, http.StatusOK, status.Snapshot())
+		}
+	case "resume":
+		if allowMethod(w, r, http.MethodPost) {
+			status.Resume()
+			s.jobLogger(status).Info("CRONIC: Job resumed")
+			writeJSON(w, http.StatusOK, status.Snapshot())
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// servesOutput reports whether the route of a request returns jobs' output,
+// which requires the token like changes do.
+func servesOutput(parts []string) bool {
+	if len(parts) < 3 || parts[0] != "api" {
+		return false
+	}
+
+	switch parts[1] {
+	case "runs":
+		return true
+	case "jobs":
+		return len(parts) == 3 || parts[3] == "output"
+	default:
+		return false
+	}
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	if s.token == "" {
+		return true
+	}
+
+	const prefix = "Bearer "
+
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, prefix) {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(header[len(prefix):]), []byte(s.token)) == 1
+}
+
+func (s *Server) jobLogger(status *cron.JobStatus) *logrus.Entry {
+	return s.logger.WithFields(logrus.Fields(cron.JobFields(status.Job)))
+}
+
+// findJob finds a job by name or position (names never start with a digit).
+func (s *Server) findJob(id string) *cron.JobStatus {
+	position, err := strconv.Atoi(id)
+	if err != nil {
+		return s.registry.JobByName(id)
+	}
+
+	return s.registry.Job(position)
+}
+
+func (s *Server) createJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.readJob(w, r)
+	if !ok {
+		return
+	}
+
+	status, err := s.registry.Create(job)
+	if err != nil {
+		s.writeRegistryError(w, err)
+		return
+	}
+
+	s.jobLogger(status).Info("CRONIC: Job created")
+	writeJSON(w, http.StatusCreated, status.Snapshot())
+}
+
+func (s *Server) updateJob(w http.ResponseWriter, r *http.Request, current *cron.JobStatus) {
+	job, ok := s.readJob(w, r)
+	if !ok {
+		return
+	}
+
+	status, err := s.registry.Update(current.Job.Position, job)
+	if err != nil {
+		s.writeRegistryError(w, err)
+		return
+	}
+
+	s.jobLogger(status).Info("CRONIC: Job updated")
+	writeJSON(w, http.StatusOK, status.Snapshot())
+}
+
+func (s *Server) deleteJob(w http.ResponseWriter, status *cron.JobStatus) {
+	if err := s.registry.Delete(status.Job.Position); err != nil {
+		s.writeRegistryError(w, err)
+		return
+	}
+
+	s.jobLogger(status).Info("CRONIC: Job deleted")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) readJob(w http.ResponseWriter, r *http.Request) (*crontab.Job, bool) {
+	var request jobRequest
+
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("bad request: %v", err), http.StatusBadRequest)
+		return nil, false
+	}
+
+	parser := s.Parser
+	if parser == nil {
+		parser = &crontab.Parser{}
+	}
+
+	job, err := parser.NewJob(request.Schedule, request.Command, request.Annotations)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	if request.Name != "" {
+		if err := crontab.ValidateJobName(request.Name); err != nil {
+			http.Error(w, fmt.Sprintf("CRONIC: Bad job name: %v", err), http.StatusBadRequest)
+			return nil, false
+		}
+		job.Name = request.Name
+	}
+
+	return job, true
+}
+
+func (s *Server) writeRegistryError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+
+	switch err {
+	case cron.ErrNoSuchJob:
+		code = http.StatusNotFound
+	case cron.ErrNoSuchNamespace:
+		code = http.StatusBadRequest
+	case cron.ErrNotManaged, cron.ErrNotPersisted:
+		code = http.StatusForbidden
+	case cron.ErrDuplicateName:
+		code = http.StatusConflict
+	case cron.ErrRegistryShutdown:
+		code = http.StatusServiceUnavailable
+	default:
+		s.logger.Errorf("CRONIC: Failed to persist jobs: %v", err)
+	}
+
+	http.Error(w, err.Error(), code)
+}
+
+func (s *Server) serveBlackout(w http.ResponseWriter, r *http.Request) {
+	global := s.registry.Blackout()
+	if global == nil {
+		http.Error(w, "the global blackout can't be changed", http.StatusNotFound)
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		var request blackoutBody
+
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize))
+		decoder.DisallowUnknownFields()
+
+		if err := decoder.Decode(&request); err != nil {
+			http.Error(w, fmt.Sprintf("bad request: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		var blackout crontab.Blackout
+		if request.Blackout != "" {
+			var err error
+			if blackout, err = crontab.ParseBlackout(request.Blackout); err != nil {
+				http.Error(w, fmt.Sprintf("CRONIC: Bad blackout: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+
+		global.Set(blackout)
+		s.logger.WithField("blackout", blackout.String()).Info("CRONIC: Global blackout changed")
+	}
+
+	blackout := global.Get()
+	response := blackoutBody{Blackout: blackout.String()}
+	if until, ok := blackout.Contains(time.Now()); ok {
+		response.Until = &until
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) serveArchivedOutput(w http.ResponseWriter, r *http.Request, runID string) {
+	if s.archive == nil {
+		http.Error(w, "output archiving is disabled", http.StatusNotFound)
+		return
+	}
+
+	output, err := s.archive.Open(runID)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer output.Close()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.Copy(w, output)
+}
+
+func (s *Server) serveRuns(w http.ResponseWriter, r *http.Request, status *cron.JobStatus) {
+	if s.state == nil {
+		http.Error(w, "run history is disabled (see -history-db or -state-store)", http.StatusNotFound)
+		return
+	}
+
+	limit := defaultRunsLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxRunsLimit {
+			http.Error(w, fmt.Sprintf("bad limit: %q (expected 1 to %d)", value, maxRunsLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	runs, err := s.state.History(cron.StateKey(status.Job), limit)
+	if err != nil {
+		s.logger.Errorf("CRONIC: Failed to load the run history: %v", err)
+		http.Error(w, "failed to load the run history", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, runs)
+}
+
+func (s *Server) streamOutput(w http.ResponseWriter, r *http.Request, status *cron.JobStatus) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	// Subscribe before replaying the buffer so that we don't miss lines
+	// emitted in between (at the cost of maybe sending some twice).
+	lines := status.Subscribe()
+	defer status.Unsubscribe(lines)
+
+	for _, line := range status.Output() {
+		writeEvent(w, line)
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case line := <-lines:
+			writeEvent(w, line)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, line cron.OutputLine) {
+	data, err := json.Marshal(line)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "data: %s\n\n", data)
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, code int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(value)
+}
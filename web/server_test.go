@@ -0,0 +1,467 @@
+package web
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/samgaw/cronic/cron"
+	"github.com/samgaw/cronic/crontab"
+	"github.com/samgaw/cronic/state"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestServer(token string) (*Server, []*cron.JobStatus) {
+	return newTestServerWithArchive(token, nil)
+}
+
+func newTestServerWithArchive(token string, archive *cron.Archive) (*Server, []*cron.JobStatus) {
+	registry := newTestRegistry(nil)
+
+	jobs := []*cron.JobStatus{
+		registry.Add(&crontab.Job{
+			CrontabLine: crontab.CrontabLine{Schedule: "* * * * *", Command: "true"},
+		}, false),
+		registry.Add(&crontab.Job{
+			CrontabLine: crontab.CrontabLine{Schedule: "@daily", Command: "false"},
+		}, false),
+	}
+
+	return NewServer(registry, archive, nil, token, discardLogger()), jobs
+}
+
+// newRequest returns a request to the server like the dashboard and clients
+// make them.
+func newRequest(method string, path string, body io.Reader) *http.Request {
+	request := httptest.NewRequest(method, path, body)
+	request.Header.Set(RequestHeader, "1")
+	return request
+}
+
+// The registry is never started, so that jobs only run when tests want them
+// to.
+func newTestRegistry(persist cron.PersistFunc) *cron.Registry {
+	cronCtx := &crontab.Context{Shell: "/bin/sh", Environ: map[string]string{}}
+	return cron.NewRegistry(cronCtx, &cron.Options{}, cron.NewLogger(nil), persist)
+}
+
+func discardLogger() *logrus.Entry {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	return logrus.NewEntry(logger)
+}
+
+var serverTestCases = []struct {
+	method string
+	path   string
+	code   int
+}{
+	{"GET", "/", http.StatusOK},
+	{"POST", "/", http.StatusMethodNotAllowed},
+	{"GET", "/api/jobs", http.StatusOK},
+	{"GET", "/api/jobs/1", http.StatusOK},
+	{"GET", "/api/jobs/2", http.StatusNotFound},
+	{"GET", "/api/jobs/foo", http.StatusNotFound},
+	{"GET", "/api/jobs/1/run", http.StatusMethodNotAllowed},
+	{"POST", "/api/jobs/1/run", http.StatusAccepted},
+	{"GET", "/api/jobs/1/cancel", http.StatusMethodNotAllowed},
+	{"POST", "/api/jobs/1/cancel", http.StatusConflict},
+	{"POST", "/api/jobs/1/pause", http.StatusOK},
+	{"POST", "/api/jobs/1/resume", http.StatusOK},
+	{"POST", "/api/jobs/1/explode", http.StatusNotFound},
+	{"GET", "/api/jobs/1/runs", http.StatusNotFound},
+	{"GET", "/api/blackout", http.StatusNotFound},
+	{"GET", "/nope", http.StatusNotFound},
+}
+
+func TestServerRoutes(t *testing.T) {
+	for _, tt := range serverTestCases {
+		server, _ := newTestServer("")
+
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, newRequest(tt.method, tt.path, nil))
+
+		assert.Equal(t, tt.code, recorder.Code, "%s %s", tt.method, tt.path)
+	}
+}
+
+func TestServerListsJobs(t *testing.T) {
+	server, _ := newTestServer("")
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, newRequest("GET", "/api/jobs", nil))
+
+	var snapshots []cron.JobSnapshot
+	if assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &snapshots)) {
+		if assert.Equal(t, 2, len(snapshots)) {
+			assert.Equal(t, "true", snapshots[0].Command)
+			assert.Equal(t, "@daily", snapshots[1].Schedule)
+		}
+	}
+}
+
+func TestServerPausesAndResumesJobs(t *testing.T) {
+	server, jobs := newTestServer("")
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, newRequest("POST", "/api/jobs/1/pause", nil))
+	assert.True(t, jobs[1].Paused())
+	assert.False(t, jobs[0].Paused())
+
+	var snapshot cron.JobSnapshot
+	if assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &snapshot)) {
+		assert.True(t, snapshot.Paused)
+		assert.NotNil(t, snapshot.PausedSince)
+	}
+
+	server.ServeHTTP(httptest.NewRecorder(), newRequest("POST", "/api/jobs/1/resume", nil))
+	assert.False(t, jobs[1].Paused())
+}
+
+var authTestCases = []struct {
+	method        string
+	authorization string
+	code          int
+}{
+	{"GET", "", http.StatusOK},
+	{"POST", "", http.StatusUnauthorized},
+	{"POST", "Bearer wrong", http.StatusUnauthorized},
+	{"POST", "secret", http.StatusUnauthorized},
+	{"POST", "Bearer secret", http.StatusAccepted},
+	{"DELETE", "", http.StatusUnauthorized},
+}
+
+func TestServerRequiresTokenToControlJobs(t *testing.T) {
+	for _, tt := range authTestCases {
+		server, _ := newTestServer("secret")
+
+		request := newRequest(tt.method, "/api/jobs/1/run", nil)
+		if tt.method == "GET" {
+			request = newRequest(tt.method, "/api/jobs", nil)
+		}
+		if tt.authorization != "" {
+			request.Header.Set("Authorization", tt.authorization)
+		}
+
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, request)
+
+		assert.Equal(t, tt.code, recorder.Code, "%s %q", tt.method, tt.authorization)
+	}
+}
+
+func TestServerRequiresTokenForOutput(t *testing.T) {
+	server, _ := newTestServer("secret")
+
+	for _, path := range []string{"/api/jobs/1", "/api/jobs/1/output", "/api/runs/20180407T194044Z-1-0/output"} {
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, newRequest("GET", path, nil))
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code, path)
+	}
+
+	request := newRequest("GET", "/api/jobs/1", nil)
+	request.Header.Set("Authorization", "Bearer secret")
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestServerRequiresRequestHeaderWithoutToken(t *testing.T) {
+	server, jobs := newTestServer("")
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest("POST", "/api/jobs/1/pause", nil))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.False(t, jobs[1].Paused())
+
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest("GET", "/api/jobs/1", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestServerRejectsOverlappingRuns(t *testing.T) {
+	server, _ := newTestServer("")
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, newRequest("POST", "/api/jobs/1/run", nil))
+	assert.Equal(t, http.StatusAccepted, recorder.Code)
+
+	// Nothing is consuming the trigger, so the first run is still pending.
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, newRequest("POST", "/api/jobs/1/run", nil))
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+}
+
+func TestServerServesArchivedOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cronic-web")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	runID := "20180407T194044Z-1-0"
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, runID+".log"), []byte("hello\n"), 0644))
+
+	server, _ := newTestServerWithArchive("secret", &cron.Archive{Dir: dir})
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, newRequest("GET", "/api/runs/"+runID+"/output", nil))
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	for _, tt := range []struct {
+		runID string
+		code  int
+	}{
+		{runID, http.StatusOK},
+		{"20180407T194044Z-1-1", http.StatusNotFound},
+		{"..", http.StatusNotFound},
+	} {
+		request := newRequest("GET", "/api/runs/"+tt.runID+"/output", nil)
+		request.Header.Set("Authorization", "Bearer secret")
+
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, request)
+		assert.Equal(t, tt.code, recorder.Code, tt.runID)
+
+		if tt.code == http.StatusOK {
+			assert.Equal(t, "hello\n", recorder.Body.String())
+		}
+	}
+}
+
+func TestServerManagesJobs(t *testing.T) {
+	var persisted []*crontab.Job
+	registry := newTestRegistry(func(jobs []*crontab.Job) error {
+		persisted = jobs
+		return nil
+	})
+	fixed := registry.Add(&crontab.Job{
+		CrontabLine: crontab.CrontabLine{Schedule: "* * * * *", Command: "true"},
+	}, false)
+
+	server := NewServer(registry, nil, nil, "", discardLogger())
+
+	send := func(method string, path string, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, newRequest(method, path, strings.NewReader(body)))
+		return recorder
+	}
+
+	recorder := send("POST", "/api/jobs", `{"schedule": "@hourly", "command": "echo hi", "annotations": {"quiet": "true"}}`)
+	if !assert.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String()) {
+		return
+	}
+
+	var snapshot cron.JobSnapshot
+	if assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &snapshot)) {
+		assert.Equal(t, 1, snapshot.Position)
+		assert.True(t, snapshot.Managed)
+		assert.Equal(t, map[string]string{"quiet": "true"}, snapshot.Annotations)
+	}
+
+	if assert.Equal(t, 1, len(persisted)) {
+		assert.Equal(t, "echo hi", persisted[0].Command)
+		assert.True(t, persisted[0].Quiet)
+	}
+
+	recorder = send("PUT", "/api/jobs/1", `{"schedule": "@daily", "command": "echo bye"}`)
+	assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, "echo bye", registry.Job(1).Job.Command)
+	if assert.Equal(t, 1, len(persisted)) {
+		assert.Equal(t, "@daily", persisted[0].Schedule)
+	}
+
+	for _, tt := range []struct {
+		method string
+		path   string
+		body   string
+		code   int
+	}{
+		{"POST", "/api/jobs", `{"schedule": "nope", "command": "echo hi"}`, http.StatusBadRequest},
+		{"POST", "/api/jobs", `{"schedule": "@hourly"}`, http.StatusBadRequest},
+		{"POST", "/api/jobs", `{"schedule": "@hourly", "command": "x", "extra": 1}`, http.StatusBadRequest},
+		{"POST", "/api/jobs", `{"schedule": "@hourly", "command": "x", "annotations": {"bogus": "1"}}`, http.StatusBadRequest},
+		{"PUT", "/api/jobs/0", `{"schedule": "@hourly", "command": "x"}`, http.StatusForbidden},
+		{"DELETE", "/api/jobs/0", "", http.StatusForbidden},
+		{"DELETE", "/api/jobs/2", "", http.StatusNotFound},
+		{"PATCH", "/api/jobs/1", "", http.StatusMethodNotAllowed},
+	} {
+		recorder := send(tt.method, tt.path, tt.body)
+		assert.Equal(t, tt.code, recorder.Code, "%s %s %s", tt.method, tt.path, tt.body)
+	}
+
+	recorder = send("DELETE", "/api/jobs/1", "")
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	assert.Nil(t, registry.Job(1))
+	assert.Equal(t, fixed, registry.Job(0))
+	assert.Equal(t, 0, len(persisted))
+}
+
+func TestServerFindsJobsByName(t *testing.T) {
+	registry := newTestRegistry(func(jobs []*crontab.Job) error {
+		return nil
+	})
+	registry.Add(&crontab.Job{
+		CrontabLine: crontab.CrontabLine{Schedule: "* * * * *", Command: "true"},
+		Name:        "backup-db",
+	}, false)
+
+	server := NewServer(registry, nil, nil, "", discardLogger())
+
+	send := func(method string, path string, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, newRequest(method, path, strings.NewReader(body)))
+		return recorder
+	}
+
+	recorder := send("GET", "/api/jobs/backup-db", "")
+	var snapshot cron.JobSnapshot
+	if assert.Equal(t, http.StatusOK, recorder.Code) && assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &snapshot)) {
+		assert.Equal(t, "backup-db", snapshot.Name)
+		assert.Equal(t, 0, snapshot.Position)
+	}
+
+	recorder = send("POST", "/api/jobs", `{"name": "report", "schedule": "@hourly", "command": "echo hi"}`)
+	assert.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	assert.Equal(t, http.StatusOK, send("GET", "/api/jobs/report", "").Code)
+	assert.Equal(t, http.StatusNotFound, send("GET", "/api/jobs/nope", "").Code)
+
+	for _, tt := range []struct {
+		method string
+		path   string
+		body   string
+		code   int
+	}{
+		{"POST", "/api/jobs", `{"name": "backup-db", "schedule": "@hourly", "command": "x"}`, http.StatusConflict},
+		{"POST", "/api/jobs", `{"name": "1st", "schedule": "@hourly", "command": "x"}`, http.StatusBadRequest},
+		{"POST", "/api/jobs", `{"name": "has spaces", "schedule": "@hourly", "command": "x"}`, http.StatusBadRequest},
+		{"PUT", "/api/jobs/report", `{"name": "backup-db", "schedule": "@hourly", "command": "x"}`, http.StatusConflict},
+		{"PUT", "/api/jobs/report", `{"name": "report", "schedule": "@daily", "command": "x"}`, http.StatusOK},
+		{"DELETE", "/api/jobs/report", "", http.StatusNoContent},
+	} {
+		recorder := send(tt.method, tt.path, tt.body)
+		assert.Equal(t, tt.code, recorder.Code, "%s %s %s", tt.method, tt.path, tt.body)
+	}
+}
+
+func TestServerRefusesChangesWithoutPersistence(t *testing.T) {
+	server, _ := newTestServer("")
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, newRequest("POST", "/api/jobs", strings.NewReader(`{"schedule": "@hourly", "command": "true"}`)))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+}
+
+func TestServerFiltersJobsByNamespace(t *testing.T) {
+	registry := newTestRegistry(nil)
+	for _, namespace := range []string{"", "billing", "search"} {
+		registry.Add(&crontab.Job{
+			CrontabLine: crontab.CrontabLine{Schedule: "@daily", Command: "true"},
+			Namespace:   namespace,
+		}, false)
+	}
+
+	server := NewServer(registry, nil, nil, "", discardLogger())
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, newRequest("GET", "/api/jobs?namespace=billing", nil))
+
+	var snapshots []cron.JobSnapshot
+	if assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &snapshots)) && assert.Equal(t, 1, len(snapshots)) {
+		assert.Equal(t, "billing", snapshots[0].Namespace)
+		assert.Equal(t, 1, snapshots[0].Position)
+	}
+}
+
+func TestServerServesRunHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cronic-state")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := state.NewFile(filepath.Join(dir, "state.json"))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	registry := newTestRegistry(nil)
+	status := registry.Add(&crontab.Job{
+		CrontabLine: crontab.CrontabLine{Schedule: "@daily", Command: "./backup.sh"},
+		Name:        "backup",
+	}, false)
+
+	for _, runID := range []string{"first", "second", "third"} {
+		assert.Nil(t, store.Record(cron.StateKey(status.Job), &cron.RunResult{RunID: runID, OutputFile: "/var/log/" + runID + ".log"}))
+	}
+
+	server := NewServer(registry, nil, store, "", discardLogger())
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, newRequest("GET", "/api/jobs/backup/runs?limit=2", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	var runs []cron.RunResult
+	if assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &runs)) && assert.Len(t, runs, 2) {
+		// Most recent first
+		assert.Equal(t, "third", runs[0].RunID)
+		assert.Equal(t, "/var/log/second.log", runs[1].OutputFile)
+	}
+
+	for _, limit := range []string{"0", "nope", "1001"} {
+		recorder = httptest.NewRecorder()
+		server.ServeHTTP(recorder, newRequest("GET", "/api/jobs/backup/runs?limit="+limit, nil))
+		assert.Equal(t, http.StatusBadRequest, recorder.Code, limit)
+	}
+}
+
+func TestServerChangesBlackout(t *testing.T) {
+	cronCtx := &crontab.Context{Shell: "/bin/sh", Environ: map[string]string{}}
+	registry := cron.NewRegistry(cronCtx, &cron.Options{Blackout: cron.NewGlobalBlackout(nil)}, cron.NewLogger(nil), nil)
+	server := NewServer(registry, nil, nil, "secret", discardLogger())
+
+	request := newRequest("PUT", "/api/blackout", strings.NewReader(`{"blackout": "Sat 00:00-04:00"}`))
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	request.Header.Set("Authorization", "Bearer secret")
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "Sat 00:00-04:00", registry.Blackout().Get().String())
+
+	// A window that never ends is in progress
+	request = newRequest("PUT", "/api/blackout", strings.NewReader(`{"blackout": "00:00-24:00"}`))
+	request.Header.Set("Authorization", "Bearer secret")
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+
+	var body blackoutBody
+	if assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &body)) {
+		assert.Equal(t, "00:00-24:00", body.Blackout)
+		assert.NotNil(t, body.Until)
+	}
+
+	request = newRequest("PUT", "/api/blackout", strings.NewReader(`{"blackout": "Someday 00:00-04:00"}`))
+	request.Header.Set("Authorization", "Bearer secret")
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	request = newRequest("PUT", "/api/blackout", strings.NewReader(`{"blackout": ""}`))
+	request.Header.Set("Authorization", "Bearer secret")
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Nil(t, registry.Blackout().Get())
+}